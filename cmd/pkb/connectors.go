@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/auth"
+	"github.com/cwoolley/personal-knowledge-base/internal/config"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/browser"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/feed"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/gcal"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/gdrive"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/github"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/gmail"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/httpjson"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/imap"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/mailarchive"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/notion"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/obsidian"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/plugin"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/slack"
+	"github.com/cwoolley/personal-knowledge-base/internal/extract"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+	"github.com/cwoolley/personal-knowledge-base/internal/registry"
+	"github.com/cwoolley/personal-knowledge-base/internal/search"
+	"github.com/cwoolley/personal-knowledge-base/internal/syncer"
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	calendar "google.golang.org/api/calendar/v3"
+	drive "google.golang.org/api/drive/v3"
+	gm "google.golang.org/api/gmail/v1"
+)
+
+// needsConnectors is the annotation marking commands that cannot run
+// unless every configured connector was built.
+const needsConnectors = "pkb/needs-connectors"
+
+// connectorsReady returns the error that prevented the configured connectors
+// from being built, if any. Set by main.
+var connectorsReady = func() error { return nil }
+
+// listConnectors returns the configured connector instances and how
+// building each one went. Overridden in tests and by main.
+var listConnectors = func(ctx context.Context) ([]registry.Instance, error) {
+	return buildApp(ctx).list()
+}
+
+// app holds what pkb builds once at startup from its configuration.
+type app struct {
+	cfg       *config.Config
+	instances []registry.Instance
+	engine    *search.Engine
+	// openIndex opens the local index on first use, so the connector that
+	// searches it and the syncer that fills it share one copy.
+	openIndex func() (*index.Index, error)
+	// err is why the connectors could not all be built; searching and
+	// syncing report it.
+	err error
+}
+
+// buildApp loads the configuration and builds every configured connector.
+// Problems are recorded in the returned app's err rather than returned, so
+// commands that don't need connectors still work.
+func buildApp(ctx context.Context) *app {
+	appCfg, err := loadConfig()
+	if err != nil {
+		return &app{err: fmt.Errorf("failed to load config: %w", err)}
+	}
+	a := &app{cfg: appCfg}
+	a.openIndex = sync.OnceValues(func() (*index.Index, error) {
+		return index.Open(indexPath(appCfg))
+	})
+
+	insts := appCfg.Connectors
+	if len(insts) == 0 {
+		insts = defaultConnectors(appCfg)
+	}
+	if len(insts) == 0 {
+		a.err = credentialsError()
+		return a
+	}
+
+	r := registry.New()
+	a.register(r)
+	a.instances, a.err = r.Build(ctx, insts)
+	a.engine = search.New(registry.Connectors(a.instances)...)
+	return a
+}
+
+// defaultConnectors returns the instances used when the config file lists
+// none: Google Drive and Gmail once Google credentials are set, Google
+// Calendar once pkb auth has granted access to it, Slack, Notion and GitHub
+// once their tokens are set, the local index once a sync has created it,
+// and every archive pkb import has imported.
+func defaultConnectors(appCfg *config.Config) []config.ConnectorConfig {
+	var insts []config.ConnectorConfig
+	if appCfg.GoogleClientID != "" && appCfg.GoogleClientSecret != "" {
+		insts = append(insts,
+			config.ConnectorConfig{Name: "google-drive", Type: "google-drive"},
+			config.ConnectorConfig{Name: "gmail", Type: "gmail"},
+		)
+		// Tokens from before Calendar support lack its scope; Calendar
+		// joins the defaults once pkb auth has added it.
+		if tok, err := gdrive.LoadToken(appCfg.TokenPath); err == nil && slices.Contains(auth.GrantedScopes(tok), calendar.CalendarReadonlyScope) {
+			insts = append(insts, config.ConnectorConfig{Name: "google-calendar", Type: "google-calendar"})
+		}
+	}
+	if appCfg.SlackToken != "" {
+		insts = append(insts, config.ConnectorConfig{Name: "slack", Type: "slack"})
+	}
+	if appCfg.NotionToken != "" {
+		insts = append(insts, config.ConnectorConfig{Name: "notion", Type: "notion"})
+	}
+	if appCfg.GitHubToken != "" {
+		insts = append(insts, config.ConnectorConfig{Name: "github", Type: "github"})
+	}
+	if _, err := os.Stat(indexPath(appCfg)); err == nil {
+		insts = append(insts, config.ConnectorConfig{Name: "index", Type: "index"})
+	}
+	return append(insts, importedConnectors(appCfg)...)
+}
+
+// register adds every connector type pkb supports to r.
+func (a *app) register(r *registry.Registry) {
+	r.Register("google-drive", func(ctx context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		ts, err := a.googleTokenSource(ctx, inst, drive.DriveReadonlyScope)
+		if err != nil {
+			return nil, err
+		}
+		client, err := newAPIClient(ctx, ts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Google Drive client: %w", err)
+		}
+		return gdrive.NewConnector(client).WithName(inst.Name), nil
+	})
+	r.Register("gmail", func(ctx context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		ts, err := a.googleTokenSource(ctx, inst, gm.GmailReadonlyScope)
+		if err != nil {
+			return nil, err
+		}
+		client, err := newGmailAPIClient(ctx, ts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Gmail client: %w", err)
+		}
+		return gmail.NewConnector(client).WithName(inst.Name), nil
+	})
+	r.Register("google-calendar", func(ctx context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		ts, err := a.googleTokenSource(ctx, inst, calendar.CalendarReadonlyScope)
+		if err != nil {
+			return nil, err
+		}
+		client, err := newCalendarAPIClient(ctx, ts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Google Calendar client: %w", err)
+		}
+		return gcal.NewConnector(client).WithName(inst.Name).WithCalendars(splitList(inst.Setting("calendars", ""))...), nil
+	})
+	r.Register("index", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		ix, err := a.openIndex()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open local index: %w", err)
+		}
+		return index.NewConnector(ix).WithName(inst.Name), nil
+	})
+	r.Register("obsidian", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		path := inst.Setting("path", "")
+		if path == "" {
+			return nil, errors.New("settings.path is required: set it to the vault directory")
+		}
+		if info, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("vault: %w", err)
+		} else if !info.IsDir() {
+			return nil, fmt.Errorf("vault %s is not a directory", path)
+		}
+		c := obsidian.NewConnector(path).WithName(inst.Name).WithVault(inst.Setting("vault", filepath.Base(path)))
+		switch urls := inst.Setting("urls", "obsidian"); urls {
+		case "obsidian":
+		case "file":
+			c.WithFileURLs()
+		default:
+			return nil, fmt.Errorf("settings.urls is %q, want obsidian or file", urls)
+		}
+		switch attachments := inst.Setting("attachments", "false"); attachments {
+		case "false":
+		case "true":
+			c.WithAttachments(extract.New())
+		default:
+			return nil, fmt.Errorf("settings.attachments is %q, want true or false", attachments)
+		}
+		return c, nil
+	})
+	r.Register("slack", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		token := inst.Setting("token", a.cfg.SlackToken)
+		if token == "" {
+			return nil, errors.New("settings.token is required: set it or PKB_SLACK_TOKEN to a Slack user token")
+		}
+		c := slack.NewConnector(slack.NewAPIClient(token, nil)).WithName(inst.Name)
+		return c.WithChannels(splitList(inst.Setting("channels", ""))...), nil
+	})
+	r.Register("notion", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		token := inst.Setting("token", a.cfg.NotionToken)
+		if token == "" {
+			return nil, errors.New("settings.token is required: set it or PKB_NOTION_TOKEN to a Notion integration token")
+		}
+		return notion.NewConnector(notion.NewAPIClient(token, nil)).WithName(inst.Name), nil
+	})
+	r.Register("github", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		token := inst.Setting("token", a.cfg.GitHubToken)
+		if token == "" {
+			return nil, errors.New("settings.token is required: set it or PKB_GITHUB_TOKEN to a GitHub personal access token")
+		}
+		client := github.NewAPIClient(token, nil)
+		if apiURL := inst.Setting("api_url", ""); apiURL != "" {
+			client.WithBaseURL(apiURL)
+		}
+		kinds := splitList(inst.Setting("search", github.KindIssues))
+		for _, k := range kinds {
+			if !slices.Contains(github.Kinds, k) {
+				return nil, fmt.Errorf("settings.search has %q, want %s", k, strings.Join(github.Kinds, ", "))
+			}
+		}
+		c := github.NewConnector(client).WithName(inst.Name).WithKinds(kinds...)
+		return c.WithRepos(splitList(inst.Setting("repos", ""))...).WithOrgs(splitList(inst.Setting("orgs", ""))...), nil
+	})
+	r.Register("imap", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		account := imap.Account{
+			Host:     inst.Setting("host", ""),
+			Username: inst.Setting("username", ""),
+			Password: inst.Setting("password", ""),
+		}
+		for _, s := range []struct{ key, value string }{{"host", account.Host}, {"username", account.Username}, {"password", account.Password}} {
+			if s.value == "" {
+				return nil, fmt.Errorf("settings.%s is required", s.key)
+			}
+		}
+		if port := inst.Setting("port", ""); port != "" {
+			p, err := strconv.Atoi(port)
+			if err != nil || p <= 0 || p > 65535 {
+				return nil, fmt.Errorf("settings.port is %q, want a port number", port)
+			}
+			account.Port = p
+		}
+		security, err := imap.ParseSecurity(inst.Setting("security", ""))
+		if err != nil {
+			return nil, fmt.Errorf("settings.security: %w", err)
+		}
+		account.Security = security
+		return imap.NewConnector(imap.NewAPIClient(account)).WithName(inst.Name).WithMailbox(inst.Setting("mailbox", "")), nil
+	})
+	r.Register("mail-archive", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		paths := splitList(inst.Setting("paths", ""))
+		if len(paths) == 0 {
+			return nil, errors.New("settings.paths is required: set it to mbox files and Maildir directories, comma-separated")
+		}
+		for _, path := range paths {
+			if _, err := os.Stat(path); err != nil {
+				return nil, fmt.Errorf("mail archive: %w", err)
+			}
+		}
+		c := mailarchive.NewConnector(a.cfg.ServerURL, paths...).WithName(inst.Name)
+		return c.WithIndexDir(filepath.Join(a.cfg.DataDir, "mail-archive")), nil
+	})
+	r.Register("browser", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		profiles := splitList(inst.Setting("profiles", ""))
+		if len(profiles) == 0 {
+			return nil, errors.New("settings.profiles is required: set it to Firefox or Chromium profile directories, comma-separated")
+		}
+		for _, dir := range profiles {
+			if _, err := os.Stat(dir); err != nil {
+				return nil, fmt.Errorf("browser: %w", err)
+			}
+		}
+		return browser.NewConnector(profiles...).WithName(inst.Name), nil
+	})
+	r.Register("feed", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		urls := splitList(inst.Setting("urls", ""))
+		if len(urls) == 0 {
+			return nil, errors.New("settings.urls is required: set it to RSS or Atom feed addresses, comma-separated")
+		}
+		for _, u := range urls {
+			if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return nil, fmt.Errorf("settings.urls has %q, want an http or https address", u)
+			}
+		}
+		c := feed.NewConnector(nil, urls...).WithName(inst.Name).WithIndexDir(filepath.Join(a.cfg.DataDir, "feed"))
+		if refresh := inst.Setting("refresh", ""); refresh != "" {
+			d, err := time.ParseDuration(refresh)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("settings.refresh is %q, want a duration such as 1h", refresh)
+			}
+			c.WithRefresh(d)
+		}
+		return c, nil
+	})
+	for kind := range importers {
+		r.Register(kind, a.importFactory(kind))
+	}
+	r.Register("plugin", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		command := inst.Setting("command", "")
+		if command == "" {
+			return nil, errors.New("settings.command is required: set it to the plugin program")
+		}
+		path, err := exec.LookPath(command)
+		if err != nil {
+			return nil, fmt.Errorf("settings.command: %w", err)
+		}
+		c := plugin.NewConnector(path, splitList(inst.Setting("args", ""))...).WithName(inst.Name)
+		if timeout := inst.Setting("timeout", ""); timeout != "" {
+			d, err := time.ParseDuration(timeout)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("settings.timeout is %q, want a duration such as 30s", timeout)
+			}
+			c.WithTimeout(d)
+		}
+		return c, nil
+	})
+	r.Register("http-json", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		spec := httpjson.Spec{
+			URL:         inst.Setting("url", ""),
+			Method:      inst.Setting("method", ""),
+			Body:        inst.Setting("body", ""),
+			QueryParam:  inst.Setting("query_param", ""),
+			LimitParam:  inst.Setting("limit_param", ""),
+			CursorParam: inst.Setting("cursor_param", ""),
+			Token:       inst.Setting("token", ""),
+			Username:    inst.Setting("username", ""),
+			Password:    inst.Setting("password", ""),
+			Results:     inst.Setting("results", ""),
+			NextCursor:  inst.Setting("next_cursor", ""),
+			Headers:     prefixedSettings(inst, "header."),
+			Fields:      prefixedSettings(inst, "result."),
+			Metadata:    prefixedSettings(inst, "metadata."),
+		}
+		for _, s := range []struct{ key, value string }{
+			{"url", spec.URL}, {"results", spec.Results},
+			{"result.title", spec.Fields[httpjson.FieldTitle]}, {"result.url", spec.Fields[httpjson.FieldURL]},
+		} {
+			if s.value == "" {
+				return nil, fmt.Errorf("settings.%s is required", s.key)
+			}
+		}
+		c, err := httpjson.NewConnector(spec, nil)
+		if err != nil {
+			return nil, fmt.Errorf("settings: %w", err)
+		}
+		return c.WithName(inst.Name), nil
+	})
+}
+
+// prefixedSettings returns the settings of inst whose keys start with
+// prefix, keyed by the rest of the key.
+func prefixedSettings(inst config.ConnectorConfig, prefix string) map[string]string {
+	settings := map[string]string{}
+	for k, v := range inst.Settings {
+		if name, ok := strings.CutPrefix(k, prefix); ok && name != "" && v != "" {
+			settings[name] = v
+		}
+	}
+	return settings
+}
+
+// googleScopes are the OAuth scopes pkb auth requests.
+var googleScopes = []string{drive.DriveReadonlyScope, gm.GmailReadonlyScope, calendar.CalendarReadonlyScope}
+
+// splitList splits a comma-separated setting, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// googleTokenSource returns the OAuth token source for a Google instance
+// that needs scope. The client_id, client_secret and token_path settings
+// override the environment, so several Google accounts can be configured.
+func (a *app) googleTokenSource(ctx context.Context, inst config.ConnectorConfig, scope string) (oauth2.TokenSource, error) {
+	oauthCfg := &oauth2.Config{
+		ClientID:     inst.Setting("client_id", a.cfg.GoogleClientID),
+		ClientSecret: inst.Setting("client_secret", a.cfg.GoogleClientSecret),
+		Scopes:       googleScopes,
+		Endpoint:     google.Endpoint,
+	}
+	if oauthCfg.ClientID == "" || oauthCfg.ClientSecret == "" {
+		return nil, credentialsError()
+	}
+
+	tokenPath := inst.Setting("token_path", a.cfg.TokenPath)
+	tok, err := gdrive.LoadToken(tokenPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OAuth token from %s: %w\n\n"+
+			"You may need to complete the OAuth flow first.", tokenPath, err)
+	}
+	if missing := auth.MissingScopes(tok, []string{scope}); len(missing) > 0 {
+		return nil, fmt.Errorf("the OAuth token in %s does not grant %s; run pkb auth to add it", tokenPath, scope)
+	}
+	return oauthCfg.TokenSource(ctx, tok), nil
+}
+
+// search runs a search across the built connectors.
+func (a *app) search(ctx context.Context, req search.Request) (*search.Response, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	return a.engine.Execute(ctx, req)
+}
+
+// sync crawls every built connector that supports it into the local index.
+func (a *app) sync(ctx context.Context, progress func(syncer.Progress)) error {
+	if a.err != nil {
+		return a.err
+	}
+	var crawlers []connectors.Crawler
+	for _, c := range registry.Connectors(a.instances) {
+		if cr, ok := c.(connectors.Crawler); ok {
+			crawlers = append(crawlers, cr)
+		}
+	}
+	if len(crawlers) == 0 {
+		return errors.New("no configured connector supports sync")
+	}
+	ix, err := a.openIndex()
+	if err != nil {
+		return fmt.Errorf("failed to open local index: %w", err)
+	}
+	s := &syncer.Syncer{Index: ix, StatePath: syncStatePath(a.cfg), Crawlers: crawlers}
+	return s.Run(ctx, progress)
+}
+
+// view returns an item from the named instance, for the item pages of
+// pkb serve. Sources that don't serve item pages have none to find.
+func (a *app) view(ctx context.Context, source, id string) (connectors.View, error) {
+	if a.err != nil {
+		return connectors.View{}, a.err
+	}
+	for _, c := range registry.Connectors(a.instances) {
+		if v, ok := c.(connectors.Viewer); ok && c.Name() == source {
+			return v.View(ctx, id)
+		}
+	}
+	return connectors.View{}, fmt.Errorf("source %q: %w", source, connectors.ErrNotFound)
+}
+
+// list returns the configured instances. It fails only when there are none
+// to show; per-instance errors are in the instances.
+func (a *app) list() ([]registry.Instance, error) {
+	if a.instances == nil {
+		return nil, a.err
+	}
+	return a.instances, nil
+}
+
+// printConnectors writes one line per instance with its status.
+func printConnectors(out io.Writer, insts []registry.Instance) {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tSTATUS")
+	for _, inst := range insts {
+		status := "active"
+		switch {
+		case !inst.Config.IsEnabled():
+			status = "disabled"
+		case inst.Err != nil:
+			// Only the first line: some errors carry multi-line advice.
+			msg, _, _ := strings.Cut(inst.Err.Error(), "\n")
+			status = "error: " + msg
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", inst.Config.Name, inst.Config.Type, status)
+	}
+	_ = tw.Flush()
+}
+
+// newConnectorsCmd returns the "connectors" command group.
+func newConnectorsCmd(out io.Writer) *cobra.Command {
+	connectorsCmd := &cobra.Command{
+		Use:   "connectors",
+		Short: "Inspect the configured connectors",
+	}
+	connectorsCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List configured connector instances and whether each one works",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			insts, err := listConnectors(cmd.Context())
+			if err != nil {
+				return err
+			}
+			printConnectors(out, insts)
+			return nil
+		},
+	})
+	return connectorsCmd
+}
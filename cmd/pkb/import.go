@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/config"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus/chatexport"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus/highlights"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus/notionexport"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus/slackexport"
+	"github.com/cwoolley/personal-knowledge-base/internal/registry"
+	"github.com/spf13/cobra"
+)
+
+// importer reads one kind of export archive for pkb import.
+type importer struct {
+	read  func(path string) (*corpus.Corpus, error)
+	short string
+	// items and entries name what the archive holds, for the summary
+	// printed after an import.
+	items, entries string
+}
+
+// importers are the archive formats pkb import reads, by kind. Each kind
+// is also the connector type that searches its imports.
+var importers = map[string]importer{
+	chatexport.Kind: {
+		read:    chatexport.Read,
+		short:   "Import ChatGPT or Claude conversations (conversations.json or the export ZIP)",
+		items:   "conversations",
+		entries: "messages",
+	},
+	highlights.Kind: {
+		read:    highlights.Read,
+		short:   "Import Kindle clippings or a Pocket or Instapaper export (file, ZIP or folder)",
+		items:   "books and articles",
+		entries: "highlights and saved articles",
+	},
+	slackexport.Kind: {
+		read:    slackexport.Read,
+		short:   "Import a Slack workspace export (ZIP)",
+		items:   "conversations",
+		entries: "messages",
+	},
+	notionexport.Kind: {
+		read:    notionexport.Read,
+		short:   "Import a Notion Markdown & CSV export (ZIP)",
+		items:   "pages and databases",
+		entries: "entries",
+	},
+}
+
+// importsDir returns where imported archives are stored.
+func importsDir(appCfg *config.Config) string {
+	return filepath.Join(appCfg.DataDir, "imports")
+}
+
+// importArchive reads an archive of the given kind and saves it as the
+// import called name, replacing any earlier one.
+func importArchive(kind, path, name string) (*corpus.Corpus, error) {
+	if !corpus.ValidName(name) {
+		return nil, fmt.Errorf("invalid name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	appCfg, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := checkImportName(appCfg, kind, name); err != nil {
+		return nil, err
+	}
+	c, err := importers[kind].read(path)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		c.Origin = abs
+	}
+	c.Imported = time.Now().UTC()
+	if err := corpus.Save(importsDir(appCfg), name, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// checkImportName fails if name is taken by an instance other than one
+// that searches an import of kind, since two instances of the same name
+// would stop every search. Without configured connectors, the instances
+// are the defaults, whose earlier imports the new one may replace whatever
+// their kind.
+func checkImportName(appCfg *config.Config, kind, name string) error {
+	insts, configured := appCfg.Connectors, true
+	if len(insts) == 0 {
+		insts, configured = defaultConnectors(appCfg), false
+	}
+	for _, inst := range insts {
+		if inst.Name != name || inst.Type == kind {
+			continue
+		}
+		if _, ok := importers[inst.Type]; ok && !configured {
+			continue
+		}
+		return fmt.Errorf("name %q is taken by the %s connector %q: choose another with --name", name, inst.Type, inst.Name)
+	}
+	return nil
+}
+
+// newImportCmd returns the "import" command group, with a command per
+// archive format.
+func newImportCmd(out io.Writer) *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import an export archive as a local source",
+		Long: "Read an export archive into a local source that is searched with the others and\n" +
+			"whose items pkb serve shows. Importing again with the same name replaces it.",
+	}
+	kinds := make([]string, 0, len(importers))
+	for kind := range importers {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		imp := importers[kind]
+		var name string
+		cmd := &cobra.Command{
+			Use:   kind + " <archive>",
+			Short: imp.short,
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				c, err := importArchive(kind, args[0], name)
+				if err != nil {
+					return fmt.Errorf("import: %w", err)
+				}
+				fmt.Fprintf(out, "Imported %d %s (%d %s) as %q; search it with source:%s\n",
+					len(c.Items), imp.items, c.Len(), imp.entries, name, name)
+				return nil
+			},
+		}
+		cmd.Flags().StringVar(&name, "name", kind, "name of the source to import into")
+		importCmd.AddCommand(cmd)
+	}
+	return importCmd
+}
+
+// importFactory returns the factory for instances of the given import
+// kind. The import setting names the import to search, which defaults to
+// the instance's name.
+func (a *app) importFactory(kind string) registry.Factory {
+	return func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		name := inst.Setting("import", inst.Name)
+		info, err := corpus.ReadInfo(importsDir(a.cfg), name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("no import named %q: run pkb import %s <archive> --name %s", name, kind, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.Kind != kind {
+			return nil, fmt.Errorf("import %q is a %s, not a %s", name, info.Kind, kind)
+		}
+		return corpus.NewConnector(importsDir(a.cfg), name, a.cfg.ServerURL).WithName(inst.Name), nil
+	}
+}
+
+// importedConnectors returns an instance for each import, named after it.
+func importedConnectors(appCfg *config.Config) []config.ConnectorConfig {
+	names, _ := corpus.List(importsDir(appCfg))
+	var insts []config.ConnectorConfig
+	for _, name := range names {
+		if info, err := corpus.ReadInfo(importsDir(appCfg), name); err == nil {
+			insts = append(insts, config.ConnectorConfig{Name: name, Type: info.Kind})
+		}
+	}
+	return insts
+}
@@ -10,25 +10,31 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/cwoolley/personal-knowledge-base/internal/apiclient"
 	"github.com/cwoolley/personal-knowledge-base/internal/auth"
-	pkbweb "github.com/cwoolley/personal-knowledge-base/internal/web"
 	"github.com/cwoolley/personal-knowledge-base/internal/config"
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/gcal"
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors/gdrive"
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors/gmail"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+	"github.com/cwoolley/personal-knowledge-base/internal/registry"
 	"github.com/cwoolley/personal-knowledge-base/internal/search"
 	"github.com/cwoolley/personal-knowledge-base/internal/server"
+	"github.com/cwoolley/personal-knowledge-base/internal/syncer"
 	"github.com/cwoolley/personal-knowledge-base/internal/tui"
+	pkbweb "github.com/cwoolley/personal-knowledge-base/internal/web"
 	"github.com/spf13/cobra"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
-	drive "google.golang.org/api/drive/v3"
-	gm "google.golang.org/api/gmail/v1"
 )
 
 // version is set at build time via ldflags: -X main.version=<value>
@@ -60,6 +66,9 @@ var newAPIClient = gdrive.NewAPIClient
 // newGmailAPIClient creates a Gmail API client. Overridden in tests.
 var newGmailAPIClient = gmail.NewAPIClient
 
+// newCalendarAPIClient creates a Calendar API client. Overridden in tests.
+var newCalendarAPIClient = gcal.NewAPIClient
+
 // openBrowser opens a URL in the default browser. Overridden in tests.
 var openBrowser = func(rawURL string) error {
 	return exec.Command("open", rawURL).Start()
@@ -78,8 +87,8 @@ type httpServer interface {
 }
 
 // SearchFunc abstracts the search operation for testability.
-// sources filters which connectors to query; nil means all.
-type SearchFunc func(ctx context.Context, query string, sources []string) ([]connectors.Result, error)
+// req.Sources filters which connectors to query; nil means all.
+type SearchFunc func(ctx context.Context, req search.Request) (*search.Response, error)
 
 func truncateSnippet(s string) string {
 	const maxLen = 80
@@ -89,37 +98,245 @@ func truncateSnippet(s string) string {
 	return s[:maxLen-3] + "..."
 }
 
+// resultByline formats the author and modification date of a result,
+// e.g. "Alice · 2024-03-01". Returns "" when neither is known.
+func resultByline(r connectors.Result) string {
+	var parts []string
+	if r.Author != "" {
+		parts = append(parts, r.Author)
+	}
+	if !r.ModifiedAt.IsZero() {
+		parts = append(parts, r.ModifiedAt.Format(time.DateOnly))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// printResult writes a single numbered search result. Snippet and byline
+// lines are omitted when empty.
+func printResult(out io.Writer, n int, r connectors.Result) {
+	fmt.Fprintf(out, "%d. %s\n", n, r.Title)
+	if s := truncateSnippet(r.Snippet); s != "" {
+		fmt.Fprintf(out, "   %s\n", s)
+	}
+	if b := resultByline(r); b != "" {
+		fmt.Fprintf(out, "   %s\n", b)
+	}
+	fmt.Fprintf(out, "   %s\n   [%s]\n\n", r.URL, r.Source)
+}
+
+// writeJSONError writes a JSON {"error": msg} body with the given status.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// printSourceWarnings writes one warning line per failed source, so partial
+// results are never mistaken for complete ones, and one per query operator
+// a source ignored.
+func printSourceWarnings(w io.Writer, resp *search.Response) {
+	for _, s := range resp.Failed() {
+		fmt.Fprintf(w, "Warning: %s failed, results may be incomplete: %s\n", s.Name, s.Error)
+	}
+	for _, s := range resp.Sources {
+		for _, warning := range s.Warnings {
+			fmt.Fprintf(w, "Warning: %s: %s\n", s.Name, warning)
+		}
+	}
+}
+
+// parseSearchRequest reads the q, sources, limit, cursor and sort query
+// parameters shared by the search endpoints. Errors are client errors.
+func parseSearchRequest(r *http.Request) (search.Request, error) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		return search.Request{}, errors.New("missing required parameter: q")
+	}
+	sortOrder, err := search.ParseSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		return search.Request{}, err
+	}
+	req := search.Request{Query: q, Cursor: r.URL.Query().Get("cursor"), Sort: sortOrder}
+	if s := r.URL.Query().Get("sources"); s != "" {
+		req.Sources = strings.Split(s, ",")
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			return search.Request{}, errors.New("invalid parameter: limit must be a non-negative integer")
+		}
+		req.Limit = limit
+	}
+	return req, nil
+}
+
+// searchErrorStatus maps a search error to an HTTP status: a bad cursor or
+// query is the client's fault, anything else is a server error.
+func searchErrorStatus(err error) int {
+	if errors.Is(err, search.ErrInvalidCursor) || errors.Is(err, query.ErrSyntax) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
 // searchHandler returns an http.Handler for the /search endpoint.
 func searchHandler(searchFn SearchFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		q := r.URL.Query().Get("q")
-		if q == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			_ = json.NewEncoder(w).Encode(map[string]string{"error": "missing required parameter: q"})
+		req, err := parseSearchRequest(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		var sources []string
-		if s := r.URL.Query().Get("sources"); s != "" {
-			sources = strings.Split(s, ",")
+		resp, err := searchFn(r.Context(), req)
+		if err != nil {
+			writeJSONError(w, searchErrorStatus(err), err.Error())
+			return
 		}
-		results, err := searchFn(r.Context(), q, sources)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(apiclient.NewSearchEnvelope(resp))
+	})
+}
+
+// streamHandler returns an http.Handler for the /search/stream endpoint. It
+// takes the same parameters as /search but replies with Server-Sent Events,
+// sending each connector's results as soon as that connector finishes. Errors
+// detected before the first event get a plain JSON error response.
+func streamHandler(searchFn SearchFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseSearchRequest(r)
 		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeJSONError(w, http.StatusInternalServerError, "streaming not supported")
 			return
 		}
+
+		started := false
+		send := func(event string, v any) {
+			if !started {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-cache")
+				started = true
+			}
+			_ = apiclient.WriteEvent(w, event, v)
+			flusher.Flush()
+		}
+		req.OnStart = func(sources []string) {
+			send(apiclient.EventStart, apiclient.StreamStart{Version: apiclient.APIVersion, Sources: sources})
+		}
+		req.OnBatch = func(b search.Batch) {
+			send(apiclient.EventBatch, apiclient.NewStreamBatch(b))
+		}
+
+		resp, err := searchFn(r.Context(), req)
+		switch {
+		case err != nil && !started:
+			writeJSONError(w, searchErrorStatus(err), err.Error())
+		case err != nil:
+			send(apiclient.EventError, map[string]string{"error": err.Error()})
+		default:
+			send(apiclient.EventDone, apiclient.NewSearchEnvelope(resp))
+		}
+	})
+}
+
+// explainHandler returns an http.Handler for the /search/explain endpoint.
+// It takes the same parameters as /search, runs the search with
+// Request.Explain set and replies with the per-connector details instead of
+// the results.
+func explainHandler(searchFn SearchFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseSearchRequest(r)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		parsed, err := query.Parse(req.Query)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Explain = true
+		resp, err := searchFn(r.Context(), req)
+		if err != nil {
+			writeJSONError(w, searchErrorStatus(err), err.Error())
+			return
+		}
+		env := apiclient.ExplainEnvelope{Version: apiclient.APIVersion, Query: parsed.String(), Sources: resp.Sources}
+		if env.Sources == nil {
+			env.Sources = []search.SourceStatus{}
+		}
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(results)
+		_ = json.NewEncoder(w).Encode(env)
 	})
 }
 
+// printExplanation writes the per-connector details of an explained search.
+func printExplanation(out io.Writer, env *apiclient.ExplainEnvelope) {
+	fmt.Fprintf(out, "Query: %s\n\n", env.Query)
+	if len(env.Sources) == 0 {
+		fmt.Fprintln(out, "No sources matched.")
+		return
+	}
+	for _, s := range env.Sources {
+		outcome := fmt.Sprintf("%d results", s.Count)
+		if !s.OK {
+			outcome = "failed"
+		}
+		fmt.Fprintf(out, "%s: %s in %dms\n", s.Name, outcome, s.DurationMS)
+		if s.NativeQuery != "" {
+			fmt.Fprintf(out, "   native query: %s\n", s.NativeQuery)
+		}
+		keys := make([]string, 0, len(s.Params))
+		for k := range s.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(out, "   %s: %s\n", k, s.Params[k])
+		}
+		for _, warning := range s.Warnings {
+			fmt.Fprintf(out, "   warning: %s\n", warning)
+		}
+		if s.Error != "" {
+			fmt.Fprintf(out, "   error: %s\n", s.Error)
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+// fetchPage follows continuation cursors from the first page until it
+// reaches the requested 1-based page. It returns that page and the number of
+// results on the pages before it, so numbering can continue across pages.
+// If the results run out first, an empty page is returned.
+func fetchPage(ctx context.Context, client *apiclient.Client, req search.Request, page int) (*search.Response, int, error) {
+	offset := 0
+	for n := 1; ; n++ {
+		resp, err := client.SearchPage(ctx, req)
+		if err != nil {
+			return nil, 0, err
+		}
+		if n == page {
+			return resp, offset, nil
+		}
+		if resp.NextCursor == "" {
+			return &search.Response{Results: []connectors.Result{}}, offset, nil
+		}
+		offset += len(resp.Results)
+		req.Cursor = resp.NextCursor
+	}
+}
+
 // startEmbeddedServer starts a server on :0 with the search handler and
 // returns an apiclient pointed at it plus a cleanup function.
 var startEmbeddedServer = func(searchFn SearchFunc) (*apiclient.Client, func(), error) {
 	srv := server.New(":0")
 	srv.Handle("GET /search", searchHandler(searchFn))
+	srv.Handle("GET /search/stream", streamHandler(searchFn))
+	srv.Handle("GET /search/explain", explainHandler(searchFn))
 	if err := srv.Listen(); err != nil {
 		return nil, nil, fmt.Errorf("start embedded server: %w", err)
 	}
@@ -134,12 +351,19 @@ func newRootCmd(searchFn SearchFunc, out io.Writer) *cobra.Command {
 	root := &cobra.Command{
 		Use:   "pkb",
 		Short: "Personal Knowledge Base — search across all your services",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.Annotations[needsConnectors] == "" {
+				return nil
+			}
+			return connectorsReady()
+		},
 	}
 
 	searchCmd := &cobra.Command{
-		Use:   "search [query...]",
-		Short: "Search across all connected services",
-		Args:  cobra.MinimumNArgs(1),
+		Use:         "search [query...]",
+		Short:       "Search across all connected services",
+		Args:        cobra.MinimumNArgs(1),
+		Annotations: map[string]string{needsConnectors: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			client, cleanup, err := startEmbeddedServer(searchFn)
 			if err != nil {
@@ -148,51 +372,107 @@ func newRootCmd(searchFn SearchFunc, out io.Writer) *cobra.Command {
 			defer cleanup()
 
 			sourcesFlag, _ := cmd.Flags().GetStringSlice("sources")
-			query := strings.Join(args, " ")
-			results, err := client.Search(cmd.Context(), query, sourcesFlag)
+			limit, _ := cmd.Flags().GetInt("limit")
+			page, _ := cmd.Flags().GetInt("page")
+			if limit < 0 {
+				return fmt.Errorf("--limit must not be negative")
+			}
+			if page < 1 {
+				return fmt.Errorf("--page must be 1 or greater")
+			}
+			sortFlag, _ := cmd.Flags().GetString("sort")
+			sortOrder, err := search.ParseSort(sortFlag)
 			if err != nil {
 				return err
 			}
 
-			if len(results) == 0 {
-				fmt.Fprintln(out, "No results found.")
+			req := search.Request{Query: strings.Join(args, " "), Sources: sourcesFlag, Limit: limit, Sort: sortOrder}
+			if explain, _ := cmd.Flags().GetBool("explain"); explain {
+				env, err := client.Explain(cmd.Context(), req)
+				if err != nil {
+					return err
+				}
+				printExplanation(out, env)
 				return nil
 			}
+			resp, offset, err := fetchPage(cmd.Context(), client, req, page)
+			if err != nil {
+				return err
+			}
 
-			for i, r := range results {
-				if s := truncateSnippet(r.Snippet); s != "" {
-					fmt.Fprintf(out, "%d. %s\n   %s\n   %s\n   [%s]\n\n", i+1, r.Title, s, r.URL, r.Source)
+			printSourceWarnings(cmd.ErrOrStderr(), resp)
+			if len(resp.Results) == 0 {
+				if page > 1 {
+					fmt.Fprintln(out, "No more results.")
 				} else {
-					fmt.Fprintf(out, "%d. %s\n   %s\n   [%s]\n\n", i+1, r.Title, r.URL, r.Source)
+					fmt.Fprintln(out, "No results found.")
 				}
+				return nil
+			}
+
+			for i, r := range resp.Results {
+				printResult(out, offset+i+1, r)
+			}
+			if resp.NextCursor != "" {
+				fmt.Fprintf(out, "More results available: rerun with --page %d\n", page+1)
 			}
 			return nil
 		},
 	}
-	searchCmd.Flags().StringSlice("sources", nil, "Limit search to specific sources (comma-separated: gdrive,gmail)")
+	searchCmd.Flags().StringSlice("sources", nil, "Limit search to specific sources (comma-separated connector names, see pkb connectors list)")
+	searchCmd.Flags().Int("limit", 0, "Maximum results per source per page (0 uses each source's default)")
+	searchCmd.Flags().Int("page", 1, "Page of results to show, starting at 1")
+	searchCmd.Flags().String("sort", string(search.SortRelevance), "Result order: relevance, date or source")
+	searchCmd.Flags().Bool("explain", false, "Show each source's native query, parameters, latency and errors instead of results")
 
 	serveCmd := &cobra.Command{
-		Use:   "serve",
-		Short: "Start the HTTP API server",
+		Use:         "serve",
+		Short:       "Start the HTTP API server",
+		Annotations: map[string]string{needsConnectors: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			addr, _ := cmd.Flags().GetString("addr")
 			srv := server.New(addr)
 			srv.Handle("GET /search", searchHandler(searchFn))
+			srv.Handle("GET /search/stream", streamHandler(searchFn))
+			srv.Handle("GET /search/explain", explainHandler(searchFn))
+			srv.Handle("GET /view/{source}/{id}", pkbweb.ViewHandler(viewItem))
 			srv.Handle("GET /", pkbweb.Handler())
 
 			if err := srv.Listen(); err != nil {
 				return err
 			}
 			fmt.Fprintf(out, "Listening on %s\n", srv.Addr())
+
+			syncInterval, _ := cmd.Flags().GetDuration("sync-interval")
+			if syncInterval > 0 {
+				ctx, cancel := context.WithCancel(cmd.Context())
+				defer cancel()
+				go syncLoop(ctx, syncInterval, out)
+			}
 			return serveLoop(srv, out)
 		},
 	}
 	serveCmd.Flags().String("addr", ":8080", "listen address")
+	serveCmd.Flags().Duration("sync-interval", 0, "Sync sources into the local index at this interval, e.g. 30m (0 disables)")
+
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Copy documents from your sources into the local index for offline search",
+		Long: "Crawl every source into the local index. Progress is saved after each page,\n" +
+			"so an interrupted sync resumes where it stopped.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := runSync(cmd.Context(), printSyncProgress(out)); err != nil {
+				return fmt.Errorf("sync: %w", err)
+			}
+			return nil
+		},
+	}
 
 	interactiveCmd := &cobra.Command{
-		Use:     "interactive",
-		Short:   "Launch the interactive TUI",
-		Aliases: []string{"tui"},
+		Use:         "interactive",
+		Short:       "Launch the interactive TUI",
+		Aliases:     []string{"tui"},
+		Annotations: map[string]string{needsConnectors: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			client, cleanup, err := startEmbeddedServer(searchFn)
 			if err != nil {
@@ -200,7 +480,7 @@ func newRootCmd(searchFn SearchFunc, out io.Writer) *cobra.Command {
 			}
 			defer cleanup()
 
-			apiSearch := tui.SearchFunc(client.Search)
+			apiSearch := tui.SearchFunc(client.SearchStream)
 			model := tui.NewModel(apiSearch)
 			p := newTeaProgram(model)
 			_, err = p.Run()
@@ -231,16 +511,28 @@ func newRootCmd(searchFn SearchFunc, out io.Writer) *cobra.Command {
 					"  export PKB_GOOGLE_CLIENT_SECRET=\"your-client-secret\"")
 			}
 
+			// An existing token keeps what it was granted: only missing
+			// scopes are requested, and Google adds them to the old ones.
+			scopes := googleScopes
+			existing, _ := gdrive.LoadToken(appCfg.TokenPath)
+			if existing != nil {
+				if missing := auth.MissingScopes(existing, googleScopes); len(missing) > 0 {
+					scopes = missing
+					fmt.Fprintf(out, "Requesting additional access: %s\n", strings.Join(missing, ", "))
+				}
+			}
+
 			oauthCfg := &oauth2.Config{
 				ClientID:     appCfg.GoogleClientID,
 				ClientSecret: appCfg.GoogleClientSecret,
-				Scopes:       []string{drive.DriveReadonlyScope, gm.GmailReadonlyScope},
+				Scopes:       scopes,
 				Endpoint:     googleOAuthEndpoint(),
 			}
 
 			flow := &auth.Flow{
 				Config:  oauthCfg,
 				OpenURL: openBrowser,
+				Options: []oauth2.AuthCodeOption{auth.IncludeGrantedScopes},
 			}
 
 			fmt.Fprintln(out, "Opening browser for Google authorization...")
@@ -248,6 +540,11 @@ func newRootCmd(searchFn SearchFunc, out io.Writer) *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("authorization failed: %w", err)
 			}
+			// Google only returns a refresh token on first consent; the old
+			// one also covers the scopes just added.
+			if token.RefreshToken == "" && existing != nil {
+				token.RefreshToken = existing.RefreshToken
+			}
 
 			if err := gdrive.SaveToken(appCfg.TokenPath, token); err != nil {
 				return fmt.Errorf("save token: %w", err)
@@ -260,9 +557,12 @@ func newRootCmd(searchFn SearchFunc, out io.Writer) *cobra.Command {
 
 	root.AddCommand(searchCmd)
 	root.AddCommand(serveCmd)
+	root.AddCommand(syncCmd)
 	root.AddCommand(interactiveCmd)
 	root.AddCommand(versionCmd)
 	root.AddCommand(authCmd)
+	root.AddCommand(newConnectorsCmd(out))
+	root.AddCommand(newImportCmd(out))
 	return root
 }
 
@@ -278,56 +578,74 @@ func run(args []string, searchFn SearchFunc) error {
 	return runWithOutput(args, searchFn, os.Stdout)
 }
 
-func buildSearchFn() SearchFunc {
-	appCfg, err := loadConfig()
-	if err != nil {
-		return func(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
-			return nil, fmt.Errorf("failed to load config: %w", err)
-		}
-	}
+// credentialsError explains how to configure Google credentials.
+func credentialsError() error {
+	return fmt.Errorf("Google Drive credentials not configured.\n\n" +
+		"Set these environment variables:\n" +
+		"  export PKB_GOOGLE_CLIENT_ID=\"your-client-id\"\n" +
+		"  export PKB_GOOGLE_CLIENT_SECRET=\"your-client-secret\"\n\n" +
+		"See README.md for setup instructions.")
+}
 
-	if appCfg.GoogleClientID == "" || appCfg.GoogleClientSecret == "" {
-		return func(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
-			return nil, fmt.Errorf("Google Drive credentials not configured.\n\n" +
-				"Set these environment variables:\n" +
-				"  export PKB_GOOGLE_CLIENT_ID=\"your-client-id\"\n" +
-				"  export PKB_GOOGLE_CLIENT_SECRET=\"your-client-secret\"\n\n" +
-				"See README.md for setup instructions.")
-		}
-	}
+// indexPath returns where the offline index is stored.
+func indexPath(appCfg *config.Config) string {
+	return filepath.Join(appCfg.DataDir, "index.gob")
+}
 
-	return func(ctx context.Context, query string, sources []string) ([]connectors.Result, error) {
-		oauthCfg := &oauth2.Config{
-			ClientID:     appCfg.GoogleClientID,
-			ClientSecret: appCfg.GoogleClientSecret,
-			Scopes:       []string{drive.DriveReadonlyScope, gm.GmailReadonlyScope},
-			Endpoint:     google.Endpoint,
-		}
+// syncStatePath returns where sync progress is stored.
+func syncStatePath(appCfg *config.Config) string {
+	return filepath.Join(appCfg.DataDir, "sync.json")
+}
 
-		tok, err := gdrive.LoadToken(appCfg.TokenPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load OAuth token from %s: %w\n\n"+
-				"You may need to complete the OAuth flow first.", appCfg.TokenPath, err)
-		}
+// buildSearchFn builds the configured connectors and returns a search over
+// them. Configuration errors are returned by every call.
+func buildSearchFn() SearchFunc {
+	return buildApp(context.Background()).search
+}
 
-		client, err := newAPIClient(ctx, oauthCfg.TokenSource(ctx, tok))
-		if err != nil {
-			return nil, fmt.Errorf("failed to create Google Drive client: %w", err)
-		}
+// runSync crawls every configured source into the local index, calling
+// progress as it goes. Overridden in tests and by main.
+var runSync = func(ctx context.Context, progress func(syncer.Progress)) error {
+	return buildApp(ctx).sync(ctx, progress)
+}
 
-		driveConnector := gdrive.NewConnector(client)
+// viewItem returns an item from a source whose results link to pkb serve's
+// item pages. Overridden in tests and by main.
+var viewItem pkbweb.ViewFunc = func(ctx context.Context, source, id string) (connectors.View, error) {
+	return buildApp(ctx).view(ctx, source, id)
+}
 
-		// Create Gmail connector with the same token source.
-		gmailClient, err := newGmailAPIClient(ctx, oauthCfg.TokenSource(ctx, tok))
-		if err != nil {
-			// Gmail is optional — fall back to Drive only.
-			engine := search.New(driveConnector)
-			return engine.SearchWithSources(ctx, query, sources)
+// printSyncProgress returns a sync progress callback that writes one line
+// per update to out.
+func printSyncProgress(out io.Writer) func(syncer.Progress) {
+	return func(p syncer.Progress) {
+		switch {
+		case p.Err != nil:
+			fmt.Fprintf(out, "%s: sync failed after %d documents: %v\n", p.Source, p.Indexed, p.Err)
+		case p.Incremental && p.Done:
+			fmt.Fprintf(out, "%s: up to date, %d updated, %d deleted\n", p.Source, p.Indexed, p.Deleted)
+		case p.Incremental:
+			fmt.Fprintf(out, "%s: %d updated, %d deleted...\n", p.Source, p.Indexed, p.Deleted)
+		case p.Done:
+			fmt.Fprintf(out, "%s: done, %d documents indexed\n", p.Source, p.Indexed)
+		default:
+			fmt.Fprintf(out, "%s: %d documents indexed...\n", p.Source, p.Indexed)
 		}
-		gmailConnector := gmail.NewConnector(gmailClient)
+	}
+}
 
-		engine := search.New(driveConnector, gmailConnector)
-		return engine.SearchWithSources(ctx, query, sources)
+// syncLoop syncs immediately and then every interval until ctx is done.
+// Failures are reported to out and retried at the next interval.
+func syncLoop(ctx context.Context, interval time.Duration, out io.Writer) {
+	for {
+		if err := runSync(ctx, printSyncProgress(out)); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(out, "Sync failed: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
 	}
 }
 
@@ -356,7 +674,15 @@ func serveLoop(srv httpServer, out io.Writer) error {
 }
 
 func main() {
-	if err := run(os.Args[1:], buildSearchFn()); err != nil {
+	// Build the connectors once; commands that need them fail up front if
+	// any is misconfigured.
+	a := buildApp(context.Background())
+	connectorsReady = func() error { return a.err }
+	runSync = a.sync
+	viewItem = a.view
+	listConnectors = func(context.Context) ([]registry.Instance, error) { return a.list() }
+
+	if err := run(os.Args[1:], a.search); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -20,13 +20,23 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/cwoolley/personal-knowledge-base/internal/apiclient"
+	"github.com/cwoolley/personal-knowledge-base/internal/auth"
 	"github.com/cwoolley/personal-knowledge-base/internal/config"
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors/gcal"
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors/gdrive"
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors/gmail"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+	"github.com/cwoolley/personal-knowledge-base/internal/registry"
+	"github.com/cwoolley/personal-knowledge-base/internal/search"
+	"github.com/cwoolley/personal-knowledge-base/internal/syncer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
+	calendar "google.golang.org/api/calendar/v3"
+	drive "google.golang.org/api/drive/v3"
+	gm "google.golang.org/api/gmail/v1"
 )
 
 // syncBuffer is a thread-safe bytes.Buffer for use in concurrent tests.
@@ -56,15 +66,15 @@ func (sb *syncBuffer) Len() int {
 // ensure syncBuffer satisfies io.Writer.
 var _ io.Writer = (*syncBuffer)(nil)
 
-func noopSearch(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
-	return nil, nil
+func noopSearch(_ context.Context, _ search.Request) (*search.Response, error) {
+	return &search.Response{}, nil
 }
 
 func TestTruncateSnippet(t *testing.T) {
 	tests := []struct {
-		name   string
-		input  string
-		want   string
+		name  string
+		input string
+		want  string
 	}{
 		{"empty", "", ""},
 		{"short", "hello world", "hello world"},
@@ -106,10 +116,10 @@ func TestInteractiveCommand_EmbeddedServerError(t *testing.T) {
 }
 
 func TestSearchCommand_PrintsSnippet(t *testing.T) {
-	mockSearch := func(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
-		return []connectors.Result{
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return &search.Response{Results: []connectors.Result{
 			{Title: "Doc", Snippet: "This is the snippet text", URL: "https://example.com", Source: "mock"},
-		}, nil
+		}}, nil
 	}
 	var buf bytes.Buffer
 	err := runWithOutput([]string{"search", "test"}, mockSearch, &buf)
@@ -119,10 +129,10 @@ func TestSearchCommand_PrintsSnippet(t *testing.T) {
 }
 
 func TestSearchCommand_OmitsEmptySnippet(t *testing.T) {
-	mockSearch := func(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
-		return []connectors.Result{
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return &search.Response{Results: []connectors.Result{
 			{Title: "Doc", Snippet: "", URL: "https://example.com", Source: "mock"},
-		}, nil
+		}}, nil
 	}
 	var buf bytes.Buffer
 	err := runWithOutput([]string{"search", "test"}, mockSearch, &buf)
@@ -133,12 +143,32 @@ func TestSearchCommand_OmitsEmptySnippet(t *testing.T) {
 	assert.Equal(t, 3, len(lines), "expected 3 lines (title, URL, source) with no snippet line")
 }
 
+func TestSearchCommand_PrintsByline(t *testing.T) {
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return &search.Response{Results: []connectors.Result{
+			{Title: "Doc", URL: "https://example.com", Source: "mock", Author: "Alice", ModifiedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		}}, nil
+	}
+	var buf bytes.Buffer
+	err := runWithOutput([]string{"search", "test"}, mockSearch, &buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "Alice · 2024-03-01")
+}
+
+func TestResultByline(t *testing.T) {
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, "", resultByline(connectors.Result{}))
+	assert.Equal(t, "Alice", resultByline(connectors.Result{Author: "Alice"}))
+	assert.Equal(t, "2024-03-01", resultByline(connectors.Result{ModifiedAt: date}))
+	assert.Equal(t, "Alice · 2024-03-01", resultByline(connectors.Result{Author: "Alice", ModifiedAt: date}))
+}
+
 func TestSearchCommand_TruncatesLongSnippet(t *testing.T) {
 	long := strings.Repeat("z", 200)
-	mockSearch := func(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
-		return []connectors.Result{
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return &search.Response{Results: []connectors.Result{
 			{Title: "Doc", Snippet: long, URL: "https://example.com", Source: "mock"},
-		}, nil
+		}}, nil
 	}
 	var buf bytes.Buffer
 	err := runWithOutput([]string{"search", "test"}, mockSearch, &buf)
@@ -154,11 +184,11 @@ func TestRun_ReturnsNilOnSuccess(t *testing.T) {
 }
 
 func TestSearchCommand_PrintsResults(t *testing.T) {
-	mockSearch := func(_ context.Context, query string, _ []string) ([]connectors.Result, error) {
-		return []connectors.Result{
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return &search.Response{Results: []connectors.Result{
 			{Title: "Test Doc", URL: "https://example.com/doc", Source: "mock"},
 			{Title: "Another Doc", URL: "https://example.com/doc2", Source: "mock"},
-		}, nil
+		}}, nil
 	}
 
 	var buf bytes.Buffer
@@ -178,8 +208,8 @@ func TestSearchCommand_NoQuery(t *testing.T) {
 
 // BUG-011: Test the "no results" output path.
 func TestSearchCommand_NoResults(t *testing.T) {
-	mockSearch := func(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
-		return []connectors.Result{}, nil
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return &search.Response{Results: []connectors.Result{}}, nil
 	}
 	var buf bytes.Buffer
 	err := runWithOutput([]string{"search", "empty"}, mockSearch, &buf)
@@ -189,7 +219,7 @@ func TestSearchCommand_NoResults(t *testing.T) {
 
 // BUG-011: Test the search error path.
 func TestSearchCommand_Error(t *testing.T) {
-	mockSearch := func(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
 		return nil, fmt.Errorf("connection failed")
 	}
 	var buf bytes.Buffer
@@ -199,11 +229,11 @@ func TestSearchCommand_Error(t *testing.T) {
 
 func TestSearchCommand_SourcesFlag_PassesSingleSource(t *testing.T) {
 	var receivedSources []string
-	mockSearch := func(_ context.Context, _ string, sources []string) ([]connectors.Result, error) {
-		receivedSources = sources
-		return []connectors.Result{
+	mockSearch := func(_ context.Context, req search.Request) (*search.Response, error) {
+		receivedSources = req.Sources
+		return &search.Response{Results: []connectors.Result{
 			{Title: "Test", URL: "https://example.com", Source: "gdrive"},
-		}, nil
+		}}, nil
 	}
 	var buf bytes.Buffer
 	err := runWithOutput([]string{"search", "--sources", "gdrive", "test query"}, mockSearch, &buf)
@@ -213,11 +243,11 @@ func TestSearchCommand_SourcesFlag_PassesSingleSource(t *testing.T) {
 
 func TestSearchCommand_SourcesFlag_PassesMultipleSources(t *testing.T) {
 	var receivedSources []string
-	mockSearch := func(_ context.Context, _ string, sources []string) ([]connectors.Result, error) {
-		receivedSources = sources
-		return []connectors.Result{
+	mockSearch := func(_ context.Context, req search.Request) (*search.Response, error) {
+		receivedSources = req.Sources
+		return &search.Response{Results: []connectors.Result{
 			{Title: "Test", URL: "https://example.com", Source: "gdrive"},
-		}, nil
+		}}, nil
 	}
 	var buf bytes.Buffer
 	err := runWithOutput([]string{"search", "--sources", "gdrive,gmail", "test query"}, mockSearch, &buf)
@@ -227,11 +257,11 @@ func TestSearchCommand_SourcesFlag_PassesMultipleSources(t *testing.T) {
 
 func TestSearchCommand_SourcesFlag_OmittedPassesNil(t *testing.T) {
 	var receivedSources []string
-	mockSearch := func(_ context.Context, _ string, sources []string) ([]connectors.Result, error) {
-		receivedSources = sources
-		return []connectors.Result{
+	mockSearch := func(_ context.Context, req search.Request) (*search.Response, error) {
+		receivedSources = req.Sources
+		return &search.Response{Results: []connectors.Result{
 			{Title: "Test", URL: "https://example.com", Source: "mock"},
-		}, nil
+		}}, nil
 	}
 	var buf bytes.Buffer
 	err := runWithOutput([]string{"search", "test query"}, mockSearch, &buf)
@@ -241,18 +271,19 @@ func TestSearchCommand_SourcesFlag_OmittedPassesNil(t *testing.T) {
 
 // BUG-008: buildSearchFn uses config.Load() instead of inline os.Getenv.
 func TestBuildSearchFn_UsesConfig(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
 	t.Setenv("PKB_GOOGLE_CLIENT_ID", "")
 	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "")
 
 	fn := buildSearchFn()
-	_, err := fn(context.Background(), "test", nil)
+	_, err := fn(context.Background(), search.Request{Query: "test"})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "Google Drive credentials not configured")
 }
 
 // BUG-009: The "serve" subcommand is registered and accepts --addr.
 func TestServeCommand_IsRegistered(t *testing.T) {
-	mockSearch := func(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
 		return nil, nil
 	}
 	var buf bytes.Buffer
@@ -271,7 +302,7 @@ func TestServeCommand_IsRegistered(t *testing.T) {
 
 // BUG-010: The "interactive" subcommand is registered with alias "tui".
 func TestInteractiveCommand_IsRegistered(t *testing.T) {
-	mockSearch := func(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
 		return nil, nil
 	}
 	var buf bytes.Buffer
@@ -353,12 +384,13 @@ func TestVersionCommand_IsRegistered(t *testing.T) {
 // now defensive. This test verifies the structure is correct by
 // confirming that valid config still works and missing creds are caught.
 func TestBuildSearchFn_PropagatesConfigError(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
 	// With empty env vars, buildSearchFn should return the "not configured" error.
 	t.Setenv("PKB_GOOGLE_CLIENT_ID", "")
 	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "")
 
 	fn := buildSearchFn()
-	_, err := fn(context.Background(), "test", nil)
+	_, err := fn(context.Background(), search.Request{Query: "test"})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "Google Drive credentials not configured")
 }
@@ -371,7 +403,7 @@ func TestBuildSearchFn_ConfigLoadError(t *testing.T) {
 	t.Cleanup(func() { loadConfig = orig })
 
 	fn := buildSearchFn()
-	_, err := fn(context.Background(), "test", nil)
+	_, err := fn(context.Background(), search.Request{Query: "test"})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to load config")
 }
@@ -382,7 +414,7 @@ func TestBuildSearchFn_TokenLoadError(t *testing.T) {
 	t.Setenv("PKB_TOKEN_PATH", "/nonexistent/path/token.json")
 
 	fn := buildSearchFn()
-	_, err := fn(context.Background(), "test", nil)
+	_, err := fn(context.Background(), search.Request{Query: "test"})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to load OAuth token")
 }
@@ -405,7 +437,7 @@ func TestBuildSearchFn_APIClientError(t *testing.T) {
 	t.Cleanup(func() { newAPIClient = orig })
 
 	fn := buildSearchFn()
-	_, err = fn(context.Background(), "test", nil)
+	_, err = fn(context.Background(), search.Request{Query: "test"})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create Google Drive client")
 }
@@ -424,7 +456,7 @@ func TestBuildSearchFn_SuccessPath(t *testing.T) {
 	fn := buildSearchFn()
 	// The closure creates a real Drive client. The search call will fail
 	// because there's no real API, but all lines in buildSearchFn are exercised.
-	_, err = fn(context.Background(), "test", nil)
+	_, err = fn(context.Background(), search.Request{Query: "test"})
 	assert.Error(t, err)
 }
 
@@ -468,8 +500,8 @@ type mockHTTPServer struct {
 	addr        string
 }
 
-func (m *mockHTTPServer) Serve() error        { return m.serveFunc() }
-func (m *mockHTTPServer) Addr() string         { return m.addr }
+func (m *mockHTTPServer) Serve() error                     { return m.serveFunc() }
+func (m *mockHTTPServer) Addr() string                     { return m.addr }
 func (m *mockHTTPServer) Shutdown(_ context.Context) error { return m.shutdownErr }
 
 func TestServeLoop_ErrServerClosed(t *testing.T) {
@@ -621,10 +653,10 @@ func TestServeSearch_WithQuery_ReturnsJSON(t *testing.T) {
 	}
 	t.Cleanup(func() { makeSignalCh = origMakeSignalCh })
 
-	mockSearch := func(_ context.Context, query string, _ []string) ([]connectors.Result, error) {
-		return []connectors.Result{
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return &search.Response{Results: []connectors.Result{
 			{Title: "API Doc", URL: "https://example.com/api", Source: "mock"},
-		}, nil
+		}}, nil
 	}
 
 	buf := &syncBuffer{}
@@ -642,8 +674,10 @@ func TestServeSearch_WithQuery_ReturnsJSON(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
 
-	var results []connectors.Result
-	require.NoError(t, json.NewDecoder(resp.Body).Decode(&results))
+	var env apiclient.SearchEnvelope
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&env))
+	assert.Equal(t, apiclient.APIVersion, env.Version)
+	results := env.Results
 	require.Len(t, results, 1)
 	assert.Equal(t, "API Doc", results[0].Title)
 	assert.Equal(t, "https://example.com/api", results[0].URL)
@@ -666,11 +700,11 @@ func TestServeSearch_WithSources_PassesThroughFilter(t *testing.T) {
 	t.Cleanup(func() { makeSignalCh = origMakeSignalCh })
 
 	var capturedSources []string
-	mockSearch := func(_ context.Context, _ string, sources []string) ([]connectors.Result, error) {
-		capturedSources = sources
-		return []connectors.Result{
+	mockSearch := func(_ context.Context, req search.Request) (*search.Response, error) {
+		capturedSources = req.Sources
+		return &search.Response{Results: []connectors.Result{
 			{Title: "Filtered", Source: "gdrive"},
-		}, nil
+		}}, nil
 	}
 
 	buf := &syncBuffer{}
@@ -706,10 +740,10 @@ func TestServeSearch_WithoutSources_PassesNil(t *testing.T) {
 
 	sourcesCalled := false
 	var capturedSources []string
-	mockSearch := func(_ context.Context, _ string, sources []string) ([]connectors.Result, error) {
+	mockSearch := func(_ context.Context, req search.Request) (*search.Response, error) {
 		sourcesCalled = true
-		capturedSources = sources
-		return []connectors.Result{}, nil
+		capturedSources = req.Sources
+		return &search.Response{Results: []connectors.Result{}}, nil
 	}
 
 	buf := &syncBuffer{}
@@ -778,7 +812,7 @@ func TestServeSearch_SearchError_Returns500(t *testing.T) {
 	}
 	t.Cleanup(func() { makeSignalCh = origMakeSignalCh })
 
-	failSearch := func(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
+	failSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
 		return nil, fmt.Errorf("search engine exploded")
 	}
 
@@ -809,7 +843,8 @@ func TestServeSearch_SearchError_Returns500(t *testing.T) {
 	}
 }
 
-func TestBuildSearchFn_GmailClientError_FallsBackToDriveOnly(t *testing.T) {
+func TestBuildSearchFn_GmailClientError_IsReported(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
 	t.Setenv("PKB_GOOGLE_CLIENT_ID", "test-id")
 	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "test-secret")
 
@@ -826,11 +861,12 @@ func TestBuildSearchFn_GmailClientError_FallsBackToDriveOnly(t *testing.T) {
 	}
 	t.Cleanup(func() { newGmailAPIClient = orig })
 
+	// A broken Gmail setup is a configuration error, not a silent fallback
+	// to Drive only.
 	fn := buildSearchFn()
-	// Should still work (falls back to Drive only), though Drive search will fail
-	// because there's no real API. The point is it didn't crash from Gmail error.
-	_, err = fn(context.Background(), "test", nil)
-	assert.Error(t, err)
+	_, err = fn(context.Background(), search.Request{Query: "test"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `connector "gmail" (type "gmail"): failed to create Gmail client: gmail not available`)
 }
 
 // --- auth command tests ---
@@ -992,3 +1028,1073 @@ func TestAuthCommand_SuccessPath(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "fresh-token", loaded.AccessToken)
 }
+
+// --- pagination tests ---
+
+func TestSearchCommand_LimitFlag_PassesLimit(t *testing.T) {
+	var received search.Request
+	mockSearch := func(_ context.Context, req search.Request) (*search.Response, error) {
+		received = req
+		return &search.Response{Results: []connectors.Result{{Title: "Doc"}}}, nil
+	}
+	var buf bytes.Buffer
+	err := runWithOutput([]string{"search", "--limit", "5", "test"}, mockSearch, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 5, received.Limit)
+	assert.Empty(t, received.Cursor)
+}
+
+func TestSearchCommand_PageFlag_FollowsCursors(t *testing.T) {
+	var cursors []string
+	mockSearch := func(_ context.Context, req search.Request) (*search.Response, error) {
+		cursors = append(cursors, req.Cursor)
+		switch req.Cursor {
+		case "":
+			return &search.Response{Results: []connectors.Result{{Title: "First"}, {Title: "Second"}}, NextCursor: "p2"}, nil
+		case "p2":
+			return &search.Response{Results: []connectors.Result{{Title: "Third"}}, NextCursor: "p3"}, nil
+		}
+		return nil, fmt.Errorf("unexpected cursor %q", req.Cursor)
+	}
+	var buf bytes.Buffer
+	err := runWithOutput([]string{"search", "--page", "2", "test"}, mockSearch, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "p2"}, cursors)
+	output := buf.String()
+	assert.NotContains(t, output, "First")
+	assert.Contains(t, output, "3. Third", "numbering continues from earlier pages")
+	assert.Contains(t, output, "--page 3")
+}
+
+func TestSearchCommand_PageFlag_PastEnd(t *testing.T) {
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return &search.Response{Results: []connectors.Result{{Title: "Only"}}}, nil
+	}
+	var buf bytes.Buffer
+	err := runWithOutput([]string{"search", "--page", "3", "test"}, mockSearch, &buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "No more results.")
+}
+
+func TestSearchCommand_InvalidPaginationFlags(t *testing.T) {
+	var buf bytes.Buffer
+	assert.ErrorContains(t, runWithOutput([]string{"search", "--page", "0", "test"}, noopSearch, &buf), "--page")
+	assert.ErrorContains(t, runWithOutput([]string{"search", "--limit", "-1", "test"}, noopSearch, &buf), "--limit")
+}
+
+func TestSearchHandler_Pagination(t *testing.T) {
+	var received search.Request
+	h := searchHandler(func(_ context.Context, req search.Request) (*search.Response, error) {
+		received = req
+		return &search.Response{Results: []connectors.Result{}, NextCursor: "next-tok"}, nil
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=x&limit=7&cursor=abc", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 7, received.Limit)
+	assert.Equal(t, "abc", received.Cursor)
+	var env apiclient.SearchEnvelope
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &env))
+	assert.Equal(t, "next-tok", env.NextCursor)
+}
+
+func TestSearchHandler_ReportsSourceStatuses(t *testing.T) {
+	h := searchHandler(func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return &search.Response{
+			Results: []connectors.Result{{Title: "Doc", Source: "gmail"}},
+			Sources: []search.SourceStatus{
+				{Name: "gmail", OK: true, DurationMS: 5, Count: 1},
+				{Name: "google-drive", Error: "quota exceeded", DurationMS: 9},
+			},
+		}, nil
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=x", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"version": 1,
+		"results": [{"Title": "Doc", "Snippet": "", "URL": "", "Source": "gmail"}],
+		"sources": [
+			{"name": "gmail", "ok": true, "duration_ms": 5, "count": 1},
+			{"name": "google-drive", "ok": false, "error": "quota exceeded", "duration_ms": 9, "count": 0}
+		]
+	}`, rec.Body.String())
+}
+
+func TestSearchCommand_WarnsOnFailedSources(t *testing.T) {
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return &search.Response{
+			Results: []connectors.Result{{Title: "Doc", URL: "u", Source: "gmail"}},
+			Sources: []search.SourceStatus{
+				{Name: "gmail", OK: true, Count: 1},
+				{Name: "google-drive", Error: "quota exceeded"},
+			},
+		}, nil
+	}
+	var buf bytes.Buffer
+	require.NoError(t, runWithOutput([]string{"search", "test"}, mockSearch, &buf))
+	assert.Contains(t, buf.String(), "Warning: google-drive failed, results may be incomplete: quota exceeded")
+	assert.NotContains(t, buf.String(), "gmail failed")
+}
+
+func TestSearchHandler_InvalidLimit_Returns400(t *testing.T) {
+	h := searchHandler(noopSearch)
+	for _, limit := range []string{"abc", "-3"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=x&limit="+limit, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "limit=%s", limit)
+		assert.Contains(t, rec.Body.String(), "limit")
+	}
+}
+
+func TestSearchHandler_InvalidCursor_Returns400(t *testing.T) {
+	h := searchHandler(func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return nil, fmt.Errorf("decode: %w", search.ErrInvalidCursor)
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=x&cursor=bogus", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid cursor")
+}
+
+func TestSearchCommand_SortFlag(t *testing.T) {
+	var received search.Request
+	mockSearch := func(_ context.Context, req search.Request) (*search.Response, error) {
+		received = req
+		return &search.Response{Results: []connectors.Result{{Title: "Doc"}}}, nil
+	}
+	var buf bytes.Buffer
+	require.NoError(t, runWithOutput([]string{"search", "--sort", "date", "test"}, mockSearch, &buf))
+	assert.Equal(t, search.SortDate, received.Sort)
+
+	err := runWithOutput([]string{"search", "--sort", "bogus", "test"}, mockSearch, &buf)
+	assert.ErrorIs(t, err, search.ErrInvalidSort)
+}
+
+func TestSearchHandler_Sort(t *testing.T) {
+	var received search.Request
+	h := searchHandler(func(_ context.Context, req search.Request) (*search.Response, error) {
+		received = req
+		return &search.Response{Results: []connectors.Result{}}, nil
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=x&sort=source", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, search.SortSource, received.Sort)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=x&sort=bogus", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid sort")
+}
+
+func TestStreamHandler_SendsEventsPerSource(t *testing.T) {
+	h := streamHandler(func(_ context.Context, req search.Request) (*search.Response, error) {
+		req.OnStart([]string{"gmail", "google-drive"})
+		req.OnBatch(search.Batch{
+			Source:  "gmail",
+			Results: []connectors.Result{{Title: "Mail", Source: "gmail"}},
+			Status:  search.SourceStatus{Name: "gmail", OK: true, Count: 1},
+		})
+		req.OnBatch(search.Batch{Source: "google-drive", Status: search.SourceStatus{Name: "google-drive", Error: "quota"}})
+		return &search.Response{Results: []connectors.Result{{Title: "Mail", Source: "gmail"}}}, nil
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search/stream?q=x", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	assert.Contains(t, body, "event: start\ndata: {\"version\":1,\"sources\":[\"gmail\",\"google-drive\"]}\n\n")
+	assert.Contains(t, body, `"source":"gmail"`)
+	assert.Contains(t, body, `"source":"google-drive","results":[]`)
+	assert.True(t, strings.HasSuffix(body, "\n\n"))
+	assert.Less(t, strings.Index(body, "event: batch"), strings.Index(body, "event: done"))
+}
+
+func TestStreamHandler_ErrorBeforeStart_ReturnsJSON(t *testing.T) {
+	h := streamHandler(func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return nil, fmt.Errorf("decode: %w", search.ErrInvalidCursor)
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search/stream?q=x&cursor=bad", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid cursor")
+}
+
+func TestStreamHandler_ErrorAfterStart_SendsErrorEvent(t *testing.T) {
+	h := streamHandler(func(_ context.Context, req search.Request) (*search.Response, error) {
+		req.OnStart([]string{"gmail"})
+		return nil, fmt.Errorf("all connectors failed")
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search/stream?q=x", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "event: error\ndata: {\"error\":\"all connectors failed\"}")
+}
+
+func TestStreamHandler_MissingQuery_Returns400(t *testing.T) {
+	rec := httptest.NewRecorder()
+	streamHandler(noopSearch).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search/stream", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestStreamHandler_RoundTripsThroughAPIClient(t *testing.T) {
+	engine := search.New(&stubConnector{name: "stub", results: []connectors.Result{{Title: "Doc"}}})
+	client, cleanup, err := startEmbeddedServer(engine.Execute)
+	require.NoError(t, err)
+	defer cleanup()
+
+	var batches []search.Batch
+	resp, err := client.SearchStream(context.Background(), search.Request{
+		Query:   "doc",
+		OnBatch: func(b search.Batch) { batches = append(batches, b) },
+	})
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	assert.Equal(t, "stub", batches[0].Source)
+	require.Len(t, resp.Results, 1)
+	assert.Equal(t, "Doc", resp.Results[0].Title)
+}
+
+// stubConnector returns fixed results.
+type stubConnector struct {
+	name    string
+	results []connectors.Result
+}
+
+func (s *stubConnector) Name() string { return s.name }
+
+func (s *stubConnector) Search(_ context.Context, _ connectors.Request) (connectors.Page, error) {
+	return connectors.Page{Results: s.results}, nil
+}
+
+func TestSearchHandler_InvalidQuery_Returns400(t *testing.T) {
+	h := searchHandler(func(_ context.Context, req search.Request) (*search.Response, error) {
+		_, err := query.Parse(req.Query)
+		return nil, err
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, `/search?q=%22unterminated`, nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unterminated quote")
+}
+
+func TestSearchCommand_PrintsQueryWarnings(t *testing.T) {
+	mockSearch := func(_ context.Context, _ search.Request) (*search.Response, error) {
+		return &search.Response{
+			Results: []connectors.Result{{Title: "Doc", URL: "u", Source: "google-drive"}},
+			Sources: []search.SourceStatus{{Name: "google-drive", OK: true, Count: 1, Warnings: []string{"from:bob is not supported by this source and was ignored"}}},
+		}, nil
+	}
+	var buf bytes.Buffer
+	require.NoError(t, runWithOutput([]string{"search", "notes", "from:bob"}, mockSearch, &buf))
+	assert.Contains(t, buf.String(), "Warning: google-drive: from:bob is not supported by this source and was ignored")
+}
+
+func TestExplainHandler_ReportsNativeRequests(t *testing.T) {
+	var received search.Request
+	h := explainHandler(func(_ context.Context, req search.Request) (*search.Response, error) {
+		received = req
+		return &search.Response{
+			Results: []connectors.Result{{Title: "Doc"}},
+			Sources: []search.SourceStatus{{Name: "gmail", OK: true, Count: 1, DurationMS: 7, NativeQuery: "subject:x", Params: map[string]string{"maxResults": "20"}}},
+		}, nil
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search/explain?q=title:x&limit=5", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, received.Explain)
+	assert.Equal(t, 5, received.Limit)
+	assert.JSONEq(t, `{
+		"version": 1,
+		"query": "title:x",
+		"sources": [{"name": "gmail", "ok": true, "duration_ms": 7, "count": 1, "native_query": "subject:x", "params": {"maxResults": "20"}}]
+	}`, rec.Body.String())
+}
+
+func TestExplainHandler_InvalidQuery_Returns400(t *testing.T) {
+	rec := httptest.NewRecorder()
+	explainHandler(noopSearch).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search/explain?q=before:someday", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestSearchCommand_Explain(t *testing.T) {
+	var received search.Request
+	mockSearch := func(_ context.Context, req search.Request) (*search.Response, error) {
+		received = req
+		return &search.Response{
+			Results: []connectors.Result{{Title: "Should Not Print"}},
+			Sources: []search.SourceStatus{
+				{Name: "gmail", Error: "quota exceeded", DurationMS: 12, NativeQuery: "budget"},
+				{Name: "google-drive", OK: true, Count: 3, DurationMS: 40, NativeQuery: "fullText contains 'budget' and trashed = false",
+					Params: map[string]string{"pageSize": "50"}, Warnings: []string{"from:bob was ignored"}},
+			},
+		}, nil
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, runWithOutput([]string{"search", "--explain", "budget", "from:bob"}, mockSearch, &buf))
+	out := buf.String()
+
+	assert.True(t, received.Explain)
+	assert.Contains(t, out, "Query: budget from:bob")
+	assert.Contains(t, out, "gmail: failed in 12ms")
+	assert.Contains(t, out, "   error: quota exceeded")
+	assert.Contains(t, out, "google-drive: 3 results in 40ms")
+	assert.Contains(t, out, "   native query: fullText contains 'budget' and trashed = false")
+	assert.Contains(t, out, "   pageSize: 50")
+	assert.Contains(t, out, "   warning: from:bob was ignored")
+	assert.NotContains(t, out, "Should Not Print")
+}
+
+func TestSearchCommand_WithoutExplain_DoesNotRequestIt(t *testing.T) {
+	var received search.Request
+	mockSearch := func(_ context.Context, req search.Request) (*search.Response, error) {
+		received = req
+		return &search.Response{}, nil
+	}
+	var buf bytes.Buffer
+	require.NoError(t, runWithOutput([]string{"search", "budget"}, mockSearch, &buf))
+	assert.False(t, received.Explain)
+}
+
+// --- sync tests ---
+
+func TestSyncCommand_PrintsProgress(t *testing.T) {
+	orig := runSync
+	runSync = func(_ context.Context, progress func(syncer.Progress)) error {
+		progress(syncer.Progress{Source: "gmail", Indexed: 100})
+		progress(syncer.Progress{Source: "gmail", Indexed: 150, Done: true})
+		progress(syncer.Progress{Source: "google-drive", Err: fmt.Errorf("quota exceeded")})
+		progress(syncer.Progress{Source: "notes", Incremental: true, Indexed: 2, Deleted: 1})
+		progress(syncer.Progress{Source: "notes", Incremental: true, Indexed: 3, Deleted: 1, Done: true})
+		return nil
+	}
+	t.Cleanup(func() { runSync = orig })
+
+	var buf bytes.Buffer
+	require.NoError(t, runWithOutput([]string{"sync"}, noopSearch, &buf))
+	output := buf.String()
+	assert.Contains(t, output, "gmail: 100 documents indexed...")
+	assert.Contains(t, output, "gmail: done, 150 documents indexed")
+	assert.Contains(t, output, "google-drive: sync failed after 0 documents: quota exceeded")
+	assert.Contains(t, output, "notes: 2 updated, 1 deleted...")
+	assert.Contains(t, output, "notes: up to date, 3 updated, 1 deleted")
+}
+
+func TestSyncCommand_Error(t *testing.T) {
+	orig := runSync
+	runSync = func(context.Context, func(syncer.Progress)) error { return fmt.Errorf("boom") }
+	t.Cleanup(func() { runSync = orig })
+
+	var buf bytes.Buffer
+	err := runWithOutput([]string{"sync"}, noopSearch, &buf)
+	assert.EqualError(t, err, "sync: boom")
+}
+
+func TestRunSync_MissingCredentials(t *testing.T) {
+	t.Setenv("PKB_GOOGLE_CLIENT_ID", "")
+	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "")
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+
+	err := runSync(context.Background(), nil)
+	assert.ErrorContains(t, err, "credentials not configured")
+}
+
+func TestServeCommand_SyncInterval_RunsBackgroundSync(t *testing.T) {
+	testCh := make(chan os.Signal, 1)
+	origMakeSignalCh := makeSignalCh
+	makeSignalCh = func() (chan os.Signal, func()) {
+		return testCh, func() {}
+	}
+	t.Cleanup(func() { makeSignalCh = origMakeSignalCh })
+
+	synced := make(chan struct{}, 1)
+	stopped := make(chan struct{})
+	origSync := runSync
+	runSync = func(ctx context.Context, progress func(syncer.Progress)) error {
+		progress(syncer.Progress{Source: "gmail", Indexed: 1, Done: true})
+		synced <- struct{}{}
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err()
+	}
+	t.Cleanup(func() { runSync = origSync })
+
+	buf := &syncBuffer{}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- runWithOutput([]string{"serve", "--addr", ":0", "--sync-interval", "1h"}, noopSearch, buf)
+	}()
+	waitForServe(t, buf, errCh)
+
+	select {
+	case <-synced:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for background sync")
+	}
+
+	testCh <- syscall.SIGINT
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for serve to shut down")
+	}
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		t.Fatal("background sync was not cancelled on shutdown")
+	}
+	assert.Contains(t, buf.String(), "gmail: done, 1 documents indexed")
+	assert.NotContains(t, buf.String(), "Sync failed", "cancellation is not a failure")
+}
+
+func TestBuildSearchFn_SearchesLocalIndexWithoutCredentials(t *testing.T) {
+	t.Setenv("PKB_GOOGLE_CLIENT_ID", "")
+	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "")
+	dataDir := t.TempDir()
+	t.Setenv("PKB_DATA_DIR", dataDir)
+
+	ix, err := index.Open(filepath.Join(dataDir, "index.gob"))
+	require.NoError(t, err)
+	ix.Put(connectors.Document{Result: connectors.Result{Title: "Budget", Source: "gmail", ID: "m1"}, Body: "quarterly numbers"})
+	require.NoError(t, ix.Save())
+
+	resp, err := buildSearchFn()(context.Background(), search.Request{Query: "quarterly"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	assert.Equal(t, "Budget", resp.Results[0].Title)
+	assert.Equal(t, "gmail", resp.Results[0].Source)
+	require.Len(t, resp.Sources, 1)
+	assert.Equal(t, "index", resp.Sources[0].Name)
+}
+
+// writeConfigFile points PKB_CONFIG at a config file with the given contents.
+func writeConfigFile(t *testing.T, contents string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+	t.Setenv("PKB_CONFIG", path)
+}
+
+func TestBuildSearchFn_UsesConfiguredInstances(t *testing.T) {
+	t.Setenv("PKB_GOOGLE_CLIENT_ID", "")
+	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "")
+	dataDir := t.TempDir()
+	t.Setenv("PKB_DATA_DIR", dataDir)
+	writeConfigFile(t, `{"connectors": [
+		{"name": "offline", "type": "index"},
+		{"type": "gmail", "enabled": false}
+	]}`)
+
+	ix, err := index.Open(filepath.Join(dataDir, "index.gob"))
+	require.NoError(t, err)
+	ix.Put(connectors.Document{Result: connectors.Result{Title: "Budget", Source: "gmail", ID: "m1"}, Body: "quarterly numbers"})
+	require.NoError(t, ix.Save())
+
+	resp, err := buildSearchFn()(context.Background(), search.Request{Query: "quarterly"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	require.Len(t, resp.Sources, 1)
+	assert.Equal(t, "offline", resp.Sources[0].Name)
+}
+
+func TestBuildSearchFn_MisconfiguredInstance(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	writeConfigFile(t, `{"connectors": [{"name": "notes", "type": "obsidain"}]}`)
+
+	_, err := buildSearchFn()(context.Background(), search.Request{Query: "test"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `connector "notes" (type "obsidain"): unknown type (available: browser, chat-export, feed, github, gmail, google-calendar, google-drive, highlights, http-json, imap, index, mail-archive, notion, notion-export, obsidian, plugin, slack, slack-export)`)
+}
+
+func TestRunSync_SkipsConnectorsThatCannotCrawl(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("PKB_DATA_DIR", dataDir)
+	writeConfigFile(t, `{"connectors": [{"type": "index"}]}`)
+
+	err := runSync(context.Background(), nil)
+	assert.EqualError(t, err, "no configured connector supports sync")
+}
+
+func TestSearchCommand_FailsWhenConnectorsAreMisconfigured(t *testing.T) {
+	orig := connectorsReady
+	connectorsReady = func() error { return fmt.Errorf("connector \"notes\": bad settings") }
+	t.Cleanup(func() { connectorsReady = orig })
+
+	for _, args := range [][]string{{"search", "q"}, {"serve", "--addr", ":0"}, {"interactive"}} {
+		var buf bytes.Buffer
+		err := runWithOutput(args, noopSearch, &buf)
+		assert.EqualError(t, err, `connector "notes": bad settings`, "pkb %s", args[0])
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, runWithOutput([]string{"version"}, noopSearch, &buf), "commands that don't search still work")
+}
+
+func TestConnectorsListCommand(t *testing.T) {
+	disabled := false
+	orig := listConnectors
+	listConnectors = func(context.Context) ([]registry.Instance, error) {
+		return []registry.Instance{
+			{Config: config.ConnectorConfig{Name: "gmail", Type: "gmail"}, Connector: gmail.NewConnector(nil)},
+			{Config: config.ConnectorConfig{Name: "old-drive", Type: "google-drive", Enabled: &disabled}},
+			{Config: config.ConnectorConfig{Name: "work", Type: "gmail"}, Err: fmt.Errorf("failed to load OAuth token\n\nYou may need to complete the OAuth flow first.")},
+		}, nil
+	}
+	t.Cleanup(func() { listConnectors = orig })
+
+	var buf bytes.Buffer
+	require.NoError(t, runWithOutput([]string{"connectors", "list"}, noopSearch, &buf))
+	assert.Equal(t, "NAME       TYPE          STATUS\n"+
+		"gmail      gmail         active\n"+
+		"old-drive  google-drive  disabled\n"+
+		"work       gmail         error: failed to load OAuth token\n", buf.String())
+}
+
+func TestConnectorsListCommand_NothingConfigured(t *testing.T) {
+	t.Setenv("PKB_GOOGLE_CLIENT_ID", "")
+	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "")
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	t.Setenv("PKB_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+
+	var buf bytes.Buffer
+	err := runWithOutput([]string{"connectors", "list"}, noopSearch, &buf)
+	assert.ErrorContains(t, err, "credentials not configured")
+}
+
+func TestBuildSearchFn_ObsidianVault(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	vault := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(vault, "Budget.md"), []byte("# Budget\nQuarterly numbers."), 0600))
+	data, err := json.Marshal(map[string]any{"connectors": []map[string]any{
+		{"name": "notes", "type": "obsidian", "settings": map[string]string{"path": vault, "vault": "Work"}},
+	}})
+	require.NoError(t, err)
+	writeConfigFile(t, string(data))
+
+	resp, err := buildSearchFn()(context.Background(), search.Request{Query: "quarterly"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	assert.Equal(t, "notes", resp.Results[0].Source)
+	assert.Equal(t, "obsidian://open?vault=Work&file=Budget", resp.Results[0].URL)
+}
+
+func TestBuildSearchFn_ObsidianAttachments(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	vault := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(vault, "Budget.md"), []byte("# Budget\nQuarterly numbers."), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(vault, "report.html"), []byte("<title>Quarterly report</title><p>Revenue grew.</p>"), 0600))
+	data, err := json.Marshal(map[string]any{"connectors": []map[string]any{
+		{"name": "notes", "type": "obsidian", "settings": map[string]string{"path": vault, "attachments": "true"}},
+	}})
+	require.NoError(t, err)
+	writeConfigFile(t, string(data))
+
+	resp, err := buildSearchFn()(context.Background(), search.Request{Query: "revenue"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	assert.Equal(t, "Quarterly report", resp.Results[0].Title)
+	assert.Equal(t, "text/html", resp.Results[0].MimeType)
+
+	data, err = json.Marshal(map[string]any{"connectors": []map[string]any{
+		{"name": "bad", "type": "obsidian", "settings": map[string]string{"path": vault, "attachments": "yes"}},
+	}})
+	require.NoError(t, err)
+	writeConfigFile(t, string(data))
+	_, err = buildSearchFn()(context.Background(), search.Request{Query: "revenue"})
+	assert.ErrorContains(t, err, `connector "bad" (type "obsidian"): settings.attachments is "yes", want true or false`)
+}
+
+func TestBuildSearchFn_ObsidianVaultMissing(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	writeConfigFile(t, `{"connectors": [{"type": "obsidian"}, {"name": "gone", "type": "obsidian", "settings": {"path": "/nonexistent/vault"}}]}`)
+
+	_, err := buildSearchFn()(context.Background(), search.Request{Query: "test"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `connector "obsidian" (type "obsidian"): settings.path is required`)
+	assert.Contains(t, err.Error(), `connector "gone" (type "obsidian"): vault: stat /nonexistent/vault`)
+}
+
+func TestBuildSearchFn_SlackInstances(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	t.Setenv("PKB_SLACK_TOKEN", "")
+	writeConfigFile(t, `{"connectors": [{"name": "work-slack", "type": "slack", "settings": {"token": "xoxp-1", "channels": "C1, C2"}}, {"name": "home-slack", "type": "slack"}]}`)
+
+	_, err := buildSearchFn()(context.Background(), search.Request{Query: "test"})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), `"work-slack"`)
+	assert.Contains(t, err.Error(), `connector "home-slack" (type "slack"): settings.token is required`)
+}
+
+func TestDefaultConnectors_SlackToken(t *testing.T) {
+	insts := defaultConnectors(&config.Config{SlackToken: "xoxp-1", DataDir: t.TempDir()})
+	assert.Equal(t, []config.ConnectorConfig{{Name: "slack", Type: "slack"}}, insts)
+}
+
+func TestDefaultConnectors_NotionToken(t *testing.T) {
+	insts := defaultConnectors(&config.Config{NotionToken: "secret_1", DataDir: t.TempDir()})
+	assert.Equal(t, []config.ConnectorConfig{{Name: "notion", Type: "notion"}}, insts)
+}
+
+func TestDefaultConnectors_GitHubToken(t *testing.T) {
+	insts := defaultConnectors(&config.Config{GitHubToken: "ghp_1", DataDir: t.TempDir()})
+	assert.Equal(t, []config.ConnectorConfig{{Name: "github", Type: "github"}}, insts)
+}
+
+func TestBuildSearchFn_GitHubInstances(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	t.Setenv("PKB_GITHUB_TOKEN", "")
+	writeConfigFile(t, `{"connectors": [
+		{"name": "gh", "type": "github", "settings": {"token": "ghp_1", "search": "issues,code", "repos": "acme/api"}},
+		{"name": "no-token", "type": "github"},
+		{"name": "bad-kind", "type": "github", "settings": {"token": "ghp_1", "search": "issues,wikis"}}
+	]}`)
+
+	a := buildApp(context.Background())
+	require.Error(t, a.err)
+	assert.NotContains(t, a.err.Error(), `"gh"`)
+	assert.Contains(t, a.err.Error(), `connector "no-token" (type "github"): settings.token is required`)
+	assert.Contains(t, a.err.Error(), `connector "bad-kind" (type "github"): settings.search has "wikis", want issues, code, discussions`)
+}
+
+func TestBuildSearchFn_NotionInstances(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	t.Setenv("PKB_NOTION_TOKEN", "")
+	writeConfigFile(t, `{"connectors": [{"name": "wiki", "type": "notion", "settings": {"token": "secret_1"}}, {"name": "other-wiki", "type": "notion"}]}`)
+
+	_, err := buildSearchFn()(context.Background(), search.Request{Query: "test"})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), `"wiki"`)
+	assert.Contains(t, err.Error(), `connector "other-wiki" (type "notion"): settings.token is required`)
+}
+
+func TestBuildSearchFn_IMAPInstances(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	t.Setenv("TEST_IMAP_PASSWORD", "s3cret")
+	writeConfigFile(t, `{"connectors": [
+		{"name": "work-mail", "type": "imap", "settings": {"host": "imap.example.com", "username": "me@example.com", "password": "$TEST_IMAP_PASSWORD", "mailbox": "Archive"}},
+		{"name": "home-mail", "type": "imap", "settings": {"host": "mail.example.org", "username": "me"}},
+		{"name": "old-mail", "type": "imap", "settings": {"host": "mail.example.net", "username": "me", "password": "x", "security": "ssl"}},
+		{"name": "odd-mail", "type": "imap", "settings": {"host": "mail.example.net", "username": "me", "password": "x", "port": "imaps"}}
+	]}`)
+
+	_, err := buildSearchFn()(context.Background(), search.Request{Query: "test"})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), `"work-mail"`)
+	assert.Contains(t, err.Error(), `connector "home-mail" (type "imap"): settings.password is required`)
+	assert.Contains(t, err.Error(), `connector "old-mail" (type "imap"): settings.security: unknown security "ssl"`)
+	assert.Contains(t, err.Error(), `connector "odd-mail" (type "imap"): settings.port is "imaps", want a port number`)
+}
+
+func TestBuildSearchFn_MailArchive(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("PKB_DATA_DIR", dataDir)
+	t.Setenv("PKB_SERVER_URL", "http://pkb.local:9000")
+	mbox := filepath.Join(t.TempDir(), "Archive.mbox")
+	require.NoError(t, os.WriteFile(mbox, []byte("From alice Fri Mar  1 09:00:00 2024\nSubject: Q2 budget\n\nQuarterly numbers.\n"), 0600))
+	data, err := json.Marshal(map[string]any{"connectors": []map[string]any{
+		{"name": "old-mail", "type": "mail-archive", "settings": map[string]string{"paths": mbox}},
+		{"name": "no-paths", "type": "mail-archive"},
+		{"name": "gone", "type": "mail-archive", "settings": map[string]string{"paths": mbox + ", /nonexistent/mail"}},
+	}})
+	require.NoError(t, err)
+	writeConfigFile(t, string(data))
+
+	a := buildApp(context.Background())
+	require.Error(t, a.err)
+	assert.NotContains(t, a.err.Error(), `"old-mail"`)
+	assert.Contains(t, a.err.Error(), `connector "no-paths" (type "mail-archive"): settings.paths is required`)
+	assert.Contains(t, a.err.Error(), `connector "gone" (type "mail-archive"): mail archive: stat /nonexistent/mail`)
+
+	writeConfigFile(t, `{"connectors": [{"name": "old-mail", "type": "mail-archive", "settings": {"paths": "`+mbox+`"}}]}`)
+	a = buildApp(context.Background())
+	resp, err := a.search(context.Background(), search.Request{Query: "quarterly"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	r := resp.Results[0]
+	assert.Equal(t, "http://pkb.local:9000/view/old-mail/"+neturl.PathEscape(r.ID), r.URL)
+	assert.FileExists(t, filepath.Join(dataDir, "mail-archive", "old-mail.gob"))
+
+	v, err := a.view(context.Background(), "old-mail", r.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Q2 budget", v.Title)
+	_, err = a.view(context.Background(), "other", r.ID)
+	assert.ErrorIs(t, err, connectors.ErrNotFound)
+}
+
+func TestBuildSearchFn_BrowserInstances(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	profile := t.TempDir()
+	writeConfigFile(t, `{"connectors": [
+		{"name": "web", "type": "browser", "settings": {"profiles": "`+profile+`"}},
+		{"name": "no-profiles", "type": "browser"},
+		{"name": "missing", "type": "browser", "settings": {"profiles": "/nonexistent/Default"}}
+	]}`)
+
+	a := buildApp(context.Background())
+	require.Error(t, a.err)
+	assert.NotContains(t, a.err.Error(), `"web"`)
+	assert.Contains(t, a.err.Error(), `connector "no-profiles" (type "browser"): settings.profiles is required`)
+	assert.Contains(t, a.err.Error(), `connector "missing" (type "browser"): browser: stat /nonexistent/Default: no such file or directory`)
+}
+
+func TestBuildSearchFn_FeedInstances(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	writeConfigFile(t, `{"connectors": [
+		{"name": "blogs", "type": "feed", "settings": {"urls": "https://go.dev/blog/feed.atom, https://example.com/rss", "refresh": "30m"}},
+		{"name": "no-urls", "type": "feed"},
+		{"name": "relative", "type": "feed", "settings": {"urls": "/feed.xml"}},
+		{"name": "slow", "type": "feed", "settings": {"urls": "https://example.com/rss", "refresh": "daily"}}
+	]}`)
+
+	a := buildApp(context.Background())
+	require.Error(t, a.err)
+	assert.NotContains(t, a.err.Error(), `"blogs"`)
+	assert.Contains(t, a.err.Error(), `connector "no-urls" (type "feed"): settings.urls is required`)
+	assert.Contains(t, a.err.Error(), `connector "relative" (type "feed"): settings.urls has "/feed.xml", want an http or https address`)
+	assert.Contains(t, a.err.Error(), `connector "slow" (type "feed"): settings.refresh is "daily", want a duration`)
+}
+
+func TestBuildSearchFn_PluginInstances(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	writeConfigFile(t, `{"connectors": [
+		{"name": "wiki", "type": "plugin", "settings": {"command": "sh", "args": "-c,exit 1", "timeout": "30s"}},
+		{"name": "no-command", "type": "plugin"},
+		{"name": "missing", "type": "plugin", "settings": {"command": "/nonexistent/pkb-plugin"}},
+		{"name": "slow", "type": "plugin", "settings": {"command": "sh", "timeout": "forever"}}
+	]}`)
+
+	a := buildApp(context.Background())
+	require.Error(t, a.err)
+	assert.NotContains(t, a.err.Error(), `"wiki"`)
+	assert.Contains(t, a.err.Error(), `connector "no-command" (type "plugin"): settings.command is required`)
+	assert.Contains(t, a.err.Error(), `connector "missing" (type "plugin"): settings.command: exec: "/nonexistent/pkb-plugin"`)
+	assert.Contains(t, a.err.Error(), `connector "slow" (type "plugin"): settings.timeout is "forever", want a duration`)
+	for _, inst := range a.instances {
+		if inst.Config.Name == "wiki" {
+			assert.Equal(t, 30*time.Second, inst.Connector.(connectors.TimeLimited).SearchTimeout())
+		}
+	}
+}
+
+func TestBuildSearchFn_HTTPJSONInstances(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	writeConfigFile(t, `{"connectors": [
+		{"name": "wiki", "type": "http-json", "settings": {"url": "https://wiki.example.com/api/search", "results": "$.hits",
+			"result.title": "$.title", "result.url": "$.link", "header.X-Team": "eng"}},
+		{"name": "no-url", "type": "http-json", "settings": {"results": "$.hits", "result.title": "$.title", "result.url": "$.link"}},
+		{"name": "no-title", "type": "http-json", "settings": {"url": "https://wiki.example.com/api/search", "results": "$.hits", "result.url": "$.link"}},
+		{"name": "bad-path", "type": "http-json", "settings": {"url": "https://wiki.example.com/api/search", "results": "hits",
+			"result.title": "$.title", "result.url": "$.link"}}
+	]}`)
+
+	a := buildApp(context.Background())
+	require.Error(t, a.err)
+	assert.NotContains(t, a.err.Error(), `"wiki"`)
+	assert.Contains(t, a.err.Error(), `connector "no-url" (type "http-json"): settings.url is required`)
+	assert.Contains(t, a.err.Error(), `connector "no-title" (type "http-json"): settings.result.title is required`)
+	assert.Contains(t, a.err.Error(), `connector "bad-path" (type "http-json"): settings: results: path "hits" does not start with $`)
+}
+
+func TestServeCommand_ServesItemViews(t *testing.T) {
+	testCh := make(chan os.Signal, 1)
+	origMakeSignalCh := makeSignalCh
+	makeSignalCh = func() (chan os.Signal, func()) {
+		return testCh, func() {}
+	}
+	t.Cleanup(func() { makeSignalCh = origMakeSignalCh })
+	origView := viewItem
+	viewItem = func(_ context.Context, source, id string) (connectors.View, error) {
+		if source != "old-mail" {
+			return connectors.View{}, connectors.ErrNotFound
+		}
+		return connectors.View{Title: "Message " + id}, nil
+	}
+	t.Cleanup(func() { viewItem = origView })
+
+	buf := &syncBuffer{}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- runWithOutput([]string{"serve", "--addr", ":0"}, noopSearch, buf)
+	}()
+	addr := waitForServe(t, buf, errCh)
+
+	resp, err := http.Get("http://" + addr + "/view/old-mail/a%2Fb%231")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "<h1>Message a/b#1</h1>")
+
+	resp, err = http.Get("http://" + addr + "/view/other/1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	testCh <- syscall.SIGINT
+	select {
+	case <-errCh:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for serve to shut down")
+	}
+}
+
+func TestAuthCommand_ExistingTokenRequestsOnlyMissingScopes(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// No refresh token: Google only sends one on first consent.
+		fmt.Fprintf(w, `{"access_token":"fresh-token","token_type":"Bearer","scope":%q}`, strings.Join(googleScopes, " "))
+	}))
+	defer tokenServer.Close()
+
+	origEndpoint := googleOAuthEndpoint
+	googleOAuthEndpoint = func() oauth2.Endpoint {
+		return oauth2.Endpoint{AuthURL: "http://example.com/auth", TokenURL: tokenServer.URL}
+	}
+	t.Cleanup(func() { googleOAuthEndpoint = origEndpoint })
+
+	tokenPath := filepath.Join(t.TempDir(), "token.json")
+	old := (&oauth2.Token{AccessToken: "old", RefreshToken: "old-refresh"}).WithExtra(map[string]any{
+		"scope": drive.DriveReadonlyScope + " " + gm.GmailReadonlyScope,
+	})
+	require.NoError(t, gdrive.SaveToken(tokenPath, old))
+
+	origLoad := loadConfig
+	loadConfig = func() (*config.Config, error) {
+		return &config.Config{GoogleClientID: "test-id", GoogleClientSecret: "test-secret", TokenPath: tokenPath}, nil
+	}
+	t.Cleanup(func() { loadConfig = origLoad })
+
+	var authURL *neturl.URL
+	orig := openBrowser
+	openBrowser = func(rawURL string) error {
+		authURL, _ = neturl.Parse(rawURL)
+		go func() {
+			//nolint:gosec // test-only HTTP request
+			resp, err := http.Get(authURL.Query().Get("redirect_uri") + "?code=test-code")
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		return nil
+	}
+	t.Cleanup(func() { openBrowser = orig })
+
+	var buf bytes.Buffer
+	require.NoError(t, runWithOutput([]string{"auth"}, noopSearch, &buf))
+
+	assert.Contains(t, buf.String(), "Requesting additional access: "+calendar.CalendarReadonlyScope)
+	assert.Equal(t, calendar.CalendarReadonlyScope, authURL.Query().Get("scope"))
+	assert.Equal(t, "true", authURL.Query().Get("include_granted_scopes"))
+	loaded, err := gdrive.LoadToken(tokenPath)
+	require.NoError(t, err)
+	assert.Equal(t, "fresh-token", loaded.AccessToken)
+	assert.Equal(t, "old-refresh", loaded.RefreshToken)
+	assert.Equal(t, googleScopes, auth.GrantedScopes(loaded))
+}
+
+func TestBuildSearchFn_CalendarTokenLacksScope(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	t.Setenv("PKB_GOOGLE_CLIENT_ID", "test-id")
+	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "test-secret")
+	tokenPath := filepath.Join(t.TempDir(), "token.json")
+	t.Setenv("PKB_TOKEN_PATH", tokenPath)
+	tok := (&oauth2.Token{AccessToken: "a", RefreshToken: "r"}).WithExtra(map[string]any{"scope": drive.DriveReadonlyScope})
+	require.NoError(t, gdrive.SaveToken(tokenPath, tok))
+	writeConfigFile(t, `{"connectors": [{"type": "google-calendar", "settings": {"calendars": "primary, team@example.com"}}]}`)
+
+	_, err := buildSearchFn()(context.Background(), search.Request{Query: "standup"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `connector "google-calendar" (type "google-calendar"): the OAuth token in `+tokenPath+` does not grant `+calendar.CalendarReadonlyScope+`; run pkb auth to add it`)
+}
+
+func TestBuildSearchFn_CalendarInstance(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	t.Setenv("PKB_GOOGLE_CLIENT_ID", "test-id")
+	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "test-secret")
+	tokenPath := filepath.Join(t.TempDir(), "token.json")
+	t.Setenv("PKB_TOKEN_PATH", tokenPath)
+	require.NoError(t, gdrive.SaveToken(tokenPath, &oauth2.Token{AccessToken: "a", RefreshToken: "r"}))
+	writeConfigFile(t, `{"connectors": [{"name": "meetings", "type": "google-calendar"}]}`)
+
+	orig := newCalendarAPIClient
+	newCalendarAPIClient = func(_ context.Context, _ oauth2.TokenSource) (*gcal.APIClient, error) {
+		return nil, fmt.Errorf("calendar not available")
+	}
+	t.Cleanup(func() { newCalendarAPIClient = orig })
+
+	_, err := buildSearchFn()(context.Background(), search.Request{Query: "standup"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `connector "meetings" (type "google-calendar"): failed to create Google Calendar client: calendar not available`)
+}
+
+func TestDefaultConnectors_CalendarOnceGranted(t *testing.T) {
+	tokenPath := filepath.Join(t.TempDir(), "token.json")
+	appCfg := &config.Config{GoogleClientID: "id", GoogleClientSecret: "secret", TokenPath: tokenPath, DataDir: t.TempDir()}
+	google := []config.ConnectorConfig{{Name: "google-drive", Type: "google-drive"}, {Name: "gmail", Type: "gmail"}}
+
+	require.NoError(t, gdrive.SaveToken(tokenPath, &oauth2.Token{AccessToken: "a"}))
+	assert.Equal(t, google, defaultConnectors(appCfg))
+
+	tok := (&oauth2.Token{AccessToken: "a"}).WithExtra(map[string]any{"scope": strings.Join(googleScopes, " ")})
+	require.NoError(t, gdrive.SaveToken(tokenPath, tok))
+	assert.Equal(t, append(google, config.ConnectorConfig{Name: "google-calendar", Type: "google-calendar"}), defaultConnectors(appCfg))
+}
+
+// writeSlackExport writes a minimal Slack export to a new directory.
+func writeSlackExport(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"users.json":              `[{"id": "U1", "name": "alice"}]`,
+		"channels.json":           `[{"id": "C1", "name": "general"}]`,
+		"general/2024-03-05.json": `[{"type": "message", "user": "U1", "text": "The offsite is in Lyon", "ts": "1709630400.000100"}, {"type": "message", "user": "U1", "text": "Bring a coat", "ts": "1709630500.000100"}]`,
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0700))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestImportCommand_SlackExport(t *testing.T) {
+	t.Setenv("PKB_GOOGLE_CLIENT_ID", "")
+	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "")
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	t.Setenv("PKB_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+
+	var buf bytes.Buffer
+	err := runWithOutput([]string{"import", "slack-export", writeSlackExport(t), "--name", "old-slack"}, noopSearch, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "Imported 1 conversations (2 messages) as \"old-slack\"; search it with source:old-slack\n", buf.String())
+
+	// Imports join the default connectors, under their name.
+	resp, err := buildSearchFn()(context.Background(), search.Request{Query: "lyon"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	assert.Equal(t, "old-slack", resp.Results[0].Source)
+	assert.Equal(t, "alice", resp.Results[0].Author)
+	assert.Equal(t, "http://localhost:8080/view/old-slack/general#p1709630400000100", resp.Results[0].URL)
+}
+
+func TestImportCommand_Errors(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	t.Setenv("PKB_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+
+	err := runWithOutput([]string{"import", "slack-export", writeSlackExport(t), "--name", "../up"}, noopSearch, io.Discard)
+	assert.EqualError(t, err, `import: invalid name "../up": use letters, digits, '.', '_' and '-'`)
+
+	err = runWithOutput([]string{"import", "notion-export", t.TempDir()}, noopSearch, io.Discard)
+	assert.ErrorContains(t, err, "not a Notion export")
+
+	err = runWithOutput([]string{"import", "slack-export"}, noopSearch, io.Discard)
+	assert.Error(t, err)
+}
+
+func TestImportCommand_NameTaken(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("PKB_DATA_DIR", dataDir)
+	t.Setenv("PKB_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+	t.Setenv("PKB_GOOGLE_CLIENT_ID", "id")
+	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "secret")
+	archive := writeSlackExport(t)
+
+	err := runWithOutput([]string{"import", "slack-export", archive, "--name", "gmail"}, noopSearch, io.Discard)
+	assert.EqualError(t, err, `import: name "gmail" is taken by the gmail connector "gmail": choose another with --name`)
+	_, err = os.Stat(filepath.Join(dataDir, "imports"))
+	assert.ErrorIs(t, err, os.ErrNotExist, "nothing is imported")
+
+	// An import's own name is not taken.
+	require.NoError(t, runWithOutput([]string{"import", "slack-export", archive, "--name", "work"}, noopSearch, io.Discard))
+	require.NoError(t, runWithOutput([]string{"import", "slack-export", archive, "--name", "work"}, noopSearch, io.Discard))
+
+	writeConfigFile(t, `{"connectors": [
+		{"name": "work", "type": "slack-export"},
+		{"name": "wiki", "type": "plugin", "settings": {"command": "pkb-wiki"}}
+	]}`)
+	require.NoError(t, runWithOutput([]string{"import", "slack-export", archive, "--name", "work"}, noopSearch, io.Discard))
+	err = runWithOutput([]string{"import", "slack-export", archive, "--name", "wiki"}, noopSearch, io.Discard)
+	assert.EqualError(t, err, `import: name "wiki" is taken by the plugin connector "wiki": choose another with --name`)
+}
+
+func TestBuildSearchFn_ImportInstances(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("PKB_DATA_DIR", dataDir)
+	t.Setenv("PKB_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, runWithOutput([]string{"import", "slack-export", writeSlackExport(t), "--name", "acme"}, noopSearch, io.Discard))
+	writeConfigFile(t, `{"connectors": [
+		{"name": "old-slack", "type": "slack-export", "settings": {"import": "acme"}},
+		{"name": "acme", "type": "slack-export"},
+		{"name": "gone", "type": "slack-export"},
+		{"name": "wiki", "type": "notion-export", "settings": {"import": "acme"}}
+	]}`)
+
+	a := buildApp(context.Background())
+	require.Error(t, a.err)
+	assert.NotContains(t, a.err.Error(), `"old-slack"`)
+	assert.NotContains(t, a.err.Error(), `"acme" (type`)
+	assert.Contains(t, a.err.Error(), `connector "gone" (type "slack-export"): no import named "gone": run pkb import slack-export <archive> --name gone`)
+	assert.Contains(t, a.err.Error(), `connector "wiki" (type "notion-export"): import "acme" is a slack-export, not a notion-export`)
+	assert.Len(t, registry.Connectors(a.instances), 2)
+}
+
+func TestImportCommand_ChatExport(t *testing.T) {
+	t.Setenv("PKB_GOOGLE_CLIENT_ID", "")
+	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "")
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	t.Setenv("PKB_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+	path := filepath.Join(t.TempDir(), "conversations.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"uuid": "c1", "name": "Vacuum tuning", "created_at": "2024-03-06T10:00:00Z", "chat_messages": [
+		{"sender": "human", "text": "Why is autovacuum slow?", "created_at": "2024-03-06T10:00:00Z"},
+		{"sender": "assistant", "text": "Raise the cost limit.", "created_at": "2024-03-06T10:00:30Z"}
+	]}]`), 0600))
+
+	var buf bytes.Buffer
+	err := runWithOutput([]string{"import", "chat-export", path, "--name", "claude"}, noopSearch, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "Imported 1 conversations (2 messages) as \"claude\"; search it with source:claude\n", buf.String())
+
+	resp, err := buildSearchFn()(context.Background(), search.Request{Query: "type:message cost limit"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	assert.Equal(t, "Vacuum tuning", resp.Results[0].Title)
+	assert.Equal(t, "Claude", resp.Results[0].Author)
+	assert.Equal(t, "http://localhost:8080/view/claude/c1#m2", resp.Results[0].URL)
+}
+
+func TestImportCommand_Highlights(t *testing.T) {
+	t.Setenv("PKB_GOOGLE_CLIENT_ID", "")
+	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "")
+	t.Setenv("PKB_DATA_DIR", t.TempDir())
+	t.Setenv("PKB_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+	path := filepath.Join(t.TempDir(), "My Clippings.txt")
+	require.NoError(t, os.WriteFile(path, []byte("Dune (Frank Herbert)\n"+
+		"- Your Highlight on Location 120-121 | Added on Tuesday, March 5, 2024 9:30:15 AM\n\nFear is the mind-killer.\n==========\n"+
+		"Dune (Frank Herbert)\n"+
+		"- Your Highlight on Location 120-121 | Added on Tuesday, March 5, 2024 9:30:15 AM\n\nFear is the mind-killer.\n==========\n"), 0600))
+
+	var buf bytes.Buffer
+	err := runWithOutput([]string{"import", "highlights", path, "--name", "kindle"}, noopSearch, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "Imported 1 books and articles (1 highlights and saved articles) as \"kindle\"; search it with source:kindle\n", buf.String())
+
+	resp, err := buildSearchFn()(context.Background(), search.Request{Query: "type:highlight from:herbert fear"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+	assert.Equal(t, "Dune", resp.Results[0].Title)
+	assert.Equal(t, "http://localhost:8080/view/kindle/"+resp.Results[0].ID, resp.Results[0].URL)
+	assert.True(t, strings.HasSuffix(resp.Results[0].ID, "#h1"), resp.Results[0].ID)
+	assert.Equal(t, "Fear is the mind-killer.", resp.Results[0].Snippet)
+}
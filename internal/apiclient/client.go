@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/search"
 )
 
 // Client calls the PKB HTTP API.
@@ -21,40 +23,153 @@ func New(baseURL string, httpClient *http.Client) *Client {
 	return &Client{baseURL: baseURL, httpClient: httpClient}
 }
 
+// APIVersion is the version of the /search response envelope. Bump it on
+// incompatible changes so clients can detect a mismatched server.
+const APIVersion = 1
+
+// SearchEnvelope is the JSON body returned by the /search endpoint.
+type SearchEnvelope struct {
+	Version    int                   `json:"version"`
+	Results    []connectors.Result   `json:"results"`
+	Sources    []search.SourceStatus `json:"sources"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// NewSearchEnvelope wraps an engine response for the wire.
+func NewSearchEnvelope(resp *search.Response) SearchEnvelope {
+	env := SearchEnvelope{
+		Version:    APIVersion,
+		Results:    resp.Results,
+		Sources:    resp.Sources,
+		NextCursor: resp.NextCursor,
+	}
+	if env.Results == nil {
+		env.Results = []connectors.Result{}
+	}
+	if env.Sources == nil {
+		env.Sources = []search.SourceStatus{}
+	}
+	return env
+}
+
+// ExplainEnvelope is the JSON body returned by the /search/explain endpoint.
+type ExplainEnvelope struct {
+	Version int `json:"version"`
+	// Query is the parsed query in canonical pkb syntax.
+	Query string `json:"query"`
+	// Sources describes, per connector, the native request sent and how it
+	// fared.
+	Sources []search.SourceStatus `json:"sources"`
+}
+
 // Search queries the /search endpoint and returns results.
 // If sources is non-nil, only those connectors are queried.
 func (c *Client) Search(ctx context.Context, query string, sources []string) ([]connectors.Result, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/search", nil)
+	resp, err := c.SearchPage(ctx, search.Request{Query: query, Sources: sources})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// SearchPage queries the /search endpoint for one page of results, including
+// the per-source status of the search. Pass the returned NextCursor back in
+// req.Cursor to fetch the following page.
+func (c *Client) SearchPage(ctx context.Context, req search.Request) (*search.Response, error) {
+	httpReq, err := c.newSearchRequest(ctx, "/search", req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+
+	var env SearchEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return env.response()
+}
+
+// response converts a decoded envelope back into an engine response,
+// rejecting envelopes from an incompatible server.
+func (env SearchEnvelope) response() (*search.Response, error) {
+	if env.Version != APIVersion {
+		return nil, fmt.Errorf("unsupported response version %d (want %d)", env.Version, APIVersion)
+	}
+	return &search.Response{Results: env.Results, NextCursor: env.NextCursor, Sources: env.Sources}, nil
+}
+
+// newSearchRequest builds a GET request for a search endpoint at path,
+// encoding req as query parameters.
+func (c *Client) newSearchRequest(ctx context.Context, path string, req search.Request) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 
-	params := req.URL.Query()
-	params.Set("q", query)
-	if len(sources) > 0 {
-		params.Set("sources", strings.Join(sources, ","))
+	params := httpReq.URL.Query()
+	params.Set("q", req.Query)
+	if len(req.Sources) > 0 {
+		params.Set("sources", strings.Join(req.Sources, ","))
+	}
+	if req.Limit > 0 {
+		params.Set("limit", strconv.Itoa(req.Limit))
+	}
+	if req.Cursor != "" {
+		params.Set("cursor", req.Cursor)
+	}
+	if req.Sort != "" {
+		params.Set("sort", string(req.Sort))
+	}
+	httpReq.URL.RawQuery = params.Encode()
+	return httpReq, nil
+}
+
+// decodeError turns a non-200 response with a JSON {"error": msg} body
+// into an error.
+func decodeError(resp *http.Response) error {
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		return fmt.Errorf("server returned %d", resp.StatusCode)
 	}
-	req.URL.RawQuery = params.Encode()
+	return fmt.Errorf("%s", errResp.Error)
+}
 
-	resp, err := c.httpClient.Do(req)
+// Explain queries the /search/explain endpoint, which runs the search and
+// reports each connector's native query, parameters, latency, result count
+// and error instead of the results.
+func (c *Client) Explain(ctx context.Context, req search.Request) (*ExplainEnvelope, error) {
+	httpReq, err := c.newSearchRequest(ctx, "/search/explain", req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		var errResp struct {
-			Error string `json:"error"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
-			return nil, fmt.Errorf("server returned %d", resp.StatusCode)
-		}
-		return nil, fmt.Errorf("%s", errResp.Error)
+		return nil, decodeError(resp)
 	}
 
-	var results []connectors.Result
-	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+	var env ExplainEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
 		return nil, fmt.Errorf("decode response: %w", err)
 	}
-	return results, nil
+	if env.Version != APIVersion {
+		return nil, fmt.Errorf("unsupported response version %d (want %d)", env.Version, APIVersion)
+	}
+	return &env, nil
 }
@@ -6,12 +6,21 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/search"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// writeEnvelope encodes env as a current-version /search response.
+func writeEnvelope(w http.ResponseWriter, env SearchEnvelope) {
+	env.Version = APIVersion
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(env)
+}
+
 func TestSearch_ReturnsResults(t *testing.T) {
 	want := []connectors.Result{
 		{Title: "Doc 1", Snippet: "snippet", URL: "https://example.com/1", Source: "gdrive"},
@@ -19,8 +28,7 @@ func TestSearch_ReturnsResults(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "/search", r.URL.Path)
 		assert.Equal(t, "test query", r.URL.Query().Get("q"))
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(want)
+		writeEnvelope(w, SearchEnvelope{Results: want})
 	}))
 	defer srv.Close()
 
@@ -30,11 +38,33 @@ func TestSearch_ReturnsResults(t *testing.T) {
 	assert.Equal(t, want, got)
 }
 
+func TestSearch_DecodesMetadataFields(t *testing.T) {
+	want := []connectors.Result{{
+		Title:      "Doc 1",
+		Source:     "gdrive",
+		ID:         "abc",
+		CreatedAt:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		ModifiedAt: time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC),
+		Author:     "Alice",
+		MimeType:   "text/markdown",
+		Score:      0.5,
+		Metadata:   map[string]string{"threadId": "t1"},
+	}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEnvelope(w, SearchEnvelope{Results: want})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	got, err := c.Search(context.Background(), "q", nil)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
 func TestSearch_SendsSourcesParam(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "gdrive", r.URL.Query().Get("sources"))
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode([]connectors.Result{})
+		writeEnvelope(w, SearchEnvelope{})
 	}))
 	defer srv.Close()
 
@@ -46,8 +76,7 @@ func TestSearch_SendsSourcesParam(t *testing.T) {
 func TestSearch_SendsMultipleSources(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "gdrive,gmail", r.URL.Query().Get("sources"))
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode([]connectors.Result{})
+		writeEnvelope(w, SearchEnvelope{})
 	}))
 	defer srv.Close()
 
@@ -59,8 +88,7 @@ func TestSearch_SendsMultipleSources(t *testing.T) {
 func TestSearch_OmitsSourcesWhenNil(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.False(t, r.URL.Query().Has("sources"))
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode([]connectors.Result{})
+		writeEnvelope(w, SearchEnvelope{})
 	}))
 	defer srv.Close()
 
@@ -145,3 +173,204 @@ func TestSearch_ContextCancellation(t *testing.T) {
 	_, err := c.Search(ctx, "q", nil)
 	assert.Error(t, err)
 }
+
+func TestSearchPage_SendsPaginationAndReadsCursor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "25", r.URL.Query().Get("limit"))
+		assert.Equal(t, "abc", r.URL.Query().Get("cursor"))
+		writeEnvelope(w, SearchEnvelope{Results: []connectors.Result{{Title: "Doc"}}, NextCursor: "def"})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	resp, err := c.SearchPage(context.Background(), search.Request{Query: "q", Limit: 25, Cursor: "abc"})
+	require.NoError(t, err)
+	assert.Len(t, resp.Results, 1)
+	assert.Equal(t, "def", resp.NextCursor)
+}
+
+func TestSearchPage_OmitsDefaultPagination(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.False(t, r.URL.Query().Has("limit"))
+		assert.False(t, r.URL.Query().Has("cursor"))
+		writeEnvelope(w, SearchEnvelope{})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	resp, err := c.SearchPage(context.Background(), search.Request{Query: "q"})
+	require.NoError(t, err)
+	assert.Empty(t, resp.NextCursor)
+}
+
+func TestSearchPage_SendsSort(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "date", r.URL.Query().Get("sort"))
+		writeEnvelope(w, SearchEnvelope{})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	_, err := c.SearchPage(context.Background(), search.Request{Query: "q", Sort: search.SortDate})
+	require.NoError(t, err)
+}
+
+func TestSearchPage_DecodesSourceStatuses(t *testing.T) {
+	sources := []search.SourceStatus{
+		{Name: "gmail", OK: true, DurationMS: 12, Count: 3},
+		{Name: "google-drive", Error: "quota exceeded", DurationMS: 40},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEnvelope(w, SearchEnvelope{Sources: sources})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	resp, err := c.SearchPage(context.Background(), search.Request{Query: "q"})
+	require.NoError(t, err)
+	assert.Equal(t, sources, resp.Sources)
+	assert.Equal(t, sources[1:], resp.Failed())
+}
+
+func TestSearchPage_RejectsUnknownVersion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(SearchEnvelope{Version: APIVersion + 1})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	_, err := c.SearchPage(context.Background(), search.Request{Query: "q"})
+	assert.ErrorContains(t, err, "unsupported response version")
+}
+
+func TestNewSearchEnvelope_UsesEmptySlices(t *testing.T) {
+	b, err := json.Marshal(NewSearchEnvelope(&search.Response{}))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version":1,"results":[],"sources":[]}`, string(b))
+}
+
+// writeEvents writes raw Server-Sent Events with the given names and data.
+func writeEvents(t *testing.T, w http.ResponseWriter, events ...any) {
+	t.Helper()
+	w.Header().Set("Content-Type", "text/event-stream")
+	for i := 0; i < len(events); i += 2 {
+		require.NoError(t, WriteEvent(w, events[i].(string), events[i+1]))
+	}
+}
+
+func TestSearchStream_DeliversEventsInOrder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/search/stream", r.URL.Path)
+		assert.Equal(t, "q", r.URL.Query().Get("q"))
+		assert.Equal(t, "text/event-stream", r.Header.Get("Accept"))
+		writeEvents(t, w,
+			EventStart, StreamStart{Version: APIVersion, Sources: []string{"gmail", "google-drive"}},
+			EventBatch, StreamBatch{Source: "gmail", Results: []connectors.Result{{Title: "Mail"}}, Status: search.SourceStatus{Name: "gmail", OK: true, Count: 1}},
+			"future-event", map[string]string{"ignored": "yes"},
+			EventBatch, StreamBatch{Source: "google-drive", Results: []connectors.Result{}, Status: search.SourceStatus{Name: "google-drive", Error: "quota"}},
+			EventDone, SearchEnvelope{Version: APIVersion, Results: []connectors.Result{{Title: "Mail"}}, NextCursor: "next"},
+		)
+	}))
+	defer srv.Close()
+
+	var started []string
+	var batches []search.Batch
+	c := New(srv.URL, srv.Client())
+	resp, err := c.SearchStream(context.Background(), search.Request{
+		Query:   "q",
+		OnStart: func(sources []string) { started = sources },
+		OnBatch: func(b search.Batch) { batches = append(batches, b) },
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"gmail", "google-drive"}, started)
+	require.Len(t, batches, 2)
+	assert.Equal(t, "gmail", batches[0].Source)
+	assert.Equal(t, "Mail", batches[0].Results[0].Title)
+	assert.Equal(t, "quota", batches[1].Status.Error)
+	assert.Equal(t, "next", resp.NextCursor)
+	assert.Len(t, resp.Results, 1)
+}
+
+func TestSearchStream_ErrorEvent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(t, w,
+			EventStart, StreamStart{Version: APIVersion, Sources: []string{"gmail"}},
+			EventError, map[string]string{"error": "all connectors failed"},
+		)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	_, err := c.SearchStream(context.Background(), search.Request{Query: "q"})
+	assert.ErrorContains(t, err, "all connectors failed")
+}
+
+func TestSearchStream_NonStreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid cursor"})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	_, err := c.SearchStream(context.Background(), search.Request{Query: "q"})
+	assert.ErrorContains(t, err, "invalid cursor")
+}
+
+func TestSearchStream_TruncatedStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(t, w, EventStart, StreamStart{Version: APIVersion})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	_, err := c.SearchStream(context.Background(), search.Request{Query: "q"})
+	assert.ErrorContains(t, err, "ended before done event")
+}
+
+func TestSearchStream_RejectsUnknownVersion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(t, w, EventStart, StreamStart{Version: APIVersion + 1})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	_, err := c.SearchStream(context.Background(), search.Request{Query: "q"})
+	assert.ErrorContains(t, err, "unsupported response version")
+}
+
+func TestExplain_DecodesEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/search/explain", r.URL.Path)
+		assert.Equal(t, "notes", r.URL.Query().Get("q"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ExplainEnvelope{
+			Version: APIVersion,
+			Query:   "notes",
+			Sources: []search.SourceStatus{{Name: "gmail", OK: true, NativeQuery: "notes", Params: map[string]string{"maxResults": "20"}}},
+		})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	env, err := c.Explain(context.Background(), search.Request{Query: "notes"})
+	require.NoError(t, err)
+	assert.Equal(t, "notes", env.Query)
+	require.Len(t, env.Sources, 1)
+	assert.Equal(t, "20", env.Sources[0].Params["maxResults"])
+}
+
+func TestExplain_ServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid query"})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.Client())
+	_, err := c.Explain(context.Background(), search.Request{Query: "x"})
+	assert.ErrorContains(t, err, "invalid query")
+}
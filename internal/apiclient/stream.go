@@ -0,0 +1,158 @@
+package apiclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/search"
+)
+
+// Event names sent by the /search/stream Server-Sent Events endpoint, in
+// order: one start, one batch per connector as it finishes, then either
+// done or error. The done event carries a SearchEnvelope with the merged,
+// ranked results; the error event carries {"error": msg}.
+const (
+	EventStart = "start"
+	EventBatch = "batch"
+	EventDone  = "done"
+	EventError = "error"
+)
+
+// StreamStart is the data of the start event.
+type StreamStart struct {
+	Version int `json:"version"`
+	// Sources lists the connectors being queried.
+	Sources []string `json:"sources"`
+}
+
+// StreamBatch is the data of a batch event.
+type StreamBatch struct {
+	Source  string              `json:"source"`
+	Results []connectors.Result `json:"results"`
+	Status  search.SourceStatus `json:"status"`
+}
+
+// NewStreamBatch converts an engine batch for the wire.
+func NewStreamBatch(b search.Batch) StreamBatch {
+	sb := StreamBatch{Source: b.Source, Results: b.Results, Status: b.Status}
+	if sb.Results == nil {
+		sb.Results = []connectors.Result{}
+	}
+	return sb
+}
+
+// WriteEvent writes one Server-Sent Event with v encoded as JSON data.
+func WriteEvent(w io.Writer, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %s event: %w", event, err)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+// SearchStream queries the /search/stream endpoint. req.OnStart and
+// req.OnBatch, when set, are called as the corresponding events arrive, so
+// callers can render results before the slowest connector finishes. The
+// merged response from the done event is returned.
+func (c *Client) SearchStream(ctx context.Context, req search.Request) (*search.Response, error) {
+	httpReq, err := c.newSearchRequest(ctx, "/search/stream", req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var event string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event == "" && data.Len() == 0 {
+				continue
+			}
+			done, result, err := dispatchEvent(event, data.String(), req)
+			if done {
+				return result, err
+			}
+			event = ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// Comment, e.g. a keep-alive.
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read stream: %w", err)
+	}
+	return nil, errors.New("read stream: ended before done event")
+}
+
+// dispatchEvent handles one complete event. It reports done=true with the
+// final response or error once the stream has finished.
+func dispatchEvent(event, data string, req search.Request) (done bool, resp *search.Response, err error) {
+	switch event {
+	case EventStart:
+		var start StreamStart
+		if err := json.Unmarshal([]byte(data), &start); err != nil {
+			return true, nil, fmt.Errorf("decode %s event: %w", event, err)
+		}
+		if start.Version != APIVersion {
+			return true, nil, fmt.Errorf("unsupported response version %d (want %d)", start.Version, APIVersion)
+		}
+		if req.OnStart != nil {
+			req.OnStart(start.Sources)
+		}
+	case EventBatch:
+		var batch StreamBatch
+		if err := json.Unmarshal([]byte(data), &batch); err != nil {
+			return true, nil, fmt.Errorf("decode %s event: %w", event, err)
+		}
+		if req.OnBatch != nil {
+			req.OnBatch(search.Batch{Source: batch.Source, Results: batch.Results, Status: batch.Status})
+		}
+	case EventDone:
+		var env SearchEnvelope
+		if err := json.Unmarshal([]byte(data), &env); err != nil {
+			return true, nil, fmt.Errorf("decode %s event: %w", event, err)
+		}
+		resp, err := env.response()
+		return true, resp, err
+	case EventError:
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &errResp); err != nil {
+			return true, nil, fmt.Errorf("decode %s event: %w", event, err)
+		}
+		return true, nil, fmt.Errorf("%s", errResp.Error)
+	}
+	// Unknown events are ignored so the server can add new ones.
+	return false, nil, nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"slices"
+	"strings"
 
 	"golang.org/x/oauth2"
 )
@@ -24,6 +26,41 @@ type Flow struct {
 	// ListenAddr is the address to listen on for the callback server.
 	// Defaults to "127.0.0.1:0" (random port on loopback) if empty.
 	ListenAddr string
+
+	// Options are added to the authorization URL, e.g.
+	// IncludeGrantedScopes.
+	Options []oauth2.AuthCodeOption
+}
+
+// IncludeGrantedScopes asks Google to add the requested scopes to those
+// the user granted before, so a token can gain scopes without losing any.
+var IncludeGrantedScopes = oauth2.SetAuthURLParam("include_granted_scopes", "true")
+
+// GrantedScopes returns the scopes tok was granted, as the token endpoint
+// reported them, or nil when they are unknown.
+func GrantedScopes(tok *oauth2.Token) []string {
+	scope, _ := tok.Extra("scope").(string)
+	if scope == "" {
+		return nil
+	}
+	return strings.Fields(scope)
+}
+
+// MissingScopes returns the scopes in want that tok was not granted. It
+// returns nil when tok's scopes are unknown, as for tokens saved before
+// they were recorded.
+func MissingScopes(tok *oauth2.Token, want []string) []string {
+	granted := GrantedScopes(tok)
+	if granted == nil {
+		return nil
+	}
+	var missing []string
+	for _, s := range want {
+		if !slices.Contains(granted, s) {
+			missing = append(missing, s)
+		}
+	}
+	return missing
 }
 
 // Run executes the OAuth flow. It blocks until the user completes
@@ -61,7 +98,8 @@ func (f *Flow) Run(ctx context.Context) (*oauth2.Token, error) {
 	// Point the redirect URL to the local callback server.
 	f.Config.RedirectURL = fmt.Sprintf("http://127.0.0.1:%d/callback", ln.Addr().(*net.TCPAddr).Port)
 
-	authURL := f.Config.AuthCodeURL("state", oauth2.AccessTypeOffline)
+	opts := append([]oauth2.AuthCodeOption{oauth2.AccessTypeOffline}, f.Options...)
+	authURL := f.Config.AuthCodeURL("state", opts...)
 	if err := f.OpenURL(authURL); err != nil {
 		return nil, fmt.Errorf("open browser: %w", err)
 	}
@@ -252,3 +252,40 @@ func TestFlow_Run_ListenerError(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "start callback server")
 }
+
+func TestFlow_Run_AddsOptionsToAuthURL(t *testing.T) {
+	cfg := &oauth2.Config{
+		ClientID: "test-id",
+		Scopes:   []string{"scope-b"},
+		Endpoint: oauth2.Endpoint{AuthURL: "http://example.com/auth", TokenURL: "http://example.com/token"},
+	}
+
+	var authURL *neturl.URL
+	flow := &Flow{
+		Config:  cfg,
+		Options: []oauth2.AuthCodeOption{IncludeGrantedScopes},
+		OpenURL: func(rawURL string) error {
+			authURL, _ = neturl.Parse(rawURL)
+			return fmt.Errorf("stop here")
+		},
+	}
+
+	_, err := flow.Run(context.Background())
+	require.Error(t, err)
+	require.NotNil(t, authURL)
+	assert.Equal(t, "true", authURL.Query().Get("include_granted_scopes"))
+	assert.Equal(t, "offline", authURL.Query().Get("access_type"))
+	assert.Equal(t, "scope-b", authURL.Query().Get("scope"))
+}
+
+func TestGrantedAndMissingScopes(t *testing.T) {
+	tok := (&oauth2.Token{AccessToken: "a"}).WithExtra(map[string]any{"scope": "scope-a scope-b"})
+	assert.Equal(t, []string{"scope-a", "scope-b"}, GrantedScopes(tok))
+	assert.Equal(t, []string{"scope-c"}, MissingScopes(tok, []string{"scope-a", "scope-c"}))
+	assert.Empty(t, MissingScopes(tok, []string{"scope-b"}))
+
+	// Scopes of tokens saved without them are unknown, not missing.
+	unknown := &oauth2.Token{AccessToken: "a"}
+	assert.Nil(t, GrantedScopes(unknown))
+	assert.Nil(t, MissingScopes(unknown, []string{"scope-a"}))
+}
@@ -1,6 +1,10 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 
@@ -8,10 +12,61 @@ import (
 )
 
 type Config struct {
-	ServerAddr        string
-	GoogleClientID    string
+	ServerAddr string
+	// ServerURL is where pkb serve is reached, for links to the items it
+	// shows itself, such as messages from a local mail archive.
+	ServerURL          string
+	GoogleClientID     string
 	GoogleClientSecret string
-	TokenPath         string
+	TokenPath          string
+	// SlackToken is the default token for Slack connector instances.
+	SlackToken string
+	// NotionToken is the default integration token for Notion connector
+	// instances.
+	NotionToken string
+	// GitHubToken is the default personal access token for GitHub
+	// connector instances.
+	GitHubToken string
+	// DataDir holds pkb's local data: the offline index and sync state.
+	DataDir string
+	// ConfigPath is the optional JSON config file Connectors is read from.
+	ConfigPath string
+	// Connectors lists the configured connector instances. It is empty when
+	// the config file is missing or lists none, and the caller picks
+	// defaults.
+	Connectors []ConnectorConfig
+}
+
+// ConnectorConfig configures one connector instance.
+type ConnectorConfig struct {
+	// Name identifies the instance in source filters and results. It
+	// defaults to Type.
+	Name string `json:"name"`
+	// Type selects the connector implementation, e.g. "gmail".
+	Type string `json:"type"`
+	// Enabled defaults to true when omitted.
+	Enabled *bool `json:"enabled,omitempty"`
+	// Settings are type-specific. Values may reference environment
+	// variables as $VAR or ${VAR}, to keep secrets out of the file.
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+// IsEnabled reports whether the instance should be built.
+func (c ConnectorConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// Setting returns the named setting, or fallback when it is unset or empty.
+func (c ConnectorConfig) Setting(key, fallback string) string {
+	if v := c.Settings[key]; v != "" {
+		return v
+	}
+	return fallback
+}
+
+// fileConfig is the layout of the config file.
+type fileConfig struct {
+	Connectors []ConnectorConfig `json:"connectors"`
 }
 
 // loadDotenv loads environment variables from a .env file if present.
@@ -25,10 +80,47 @@ func Load() (*Config, error) {
 		GoogleClientID:     os.Getenv("PKB_GOOGLE_CLIENT_ID"),
 		GoogleClientSecret: os.Getenv("PKB_GOOGLE_CLIENT_SECRET"),
 		TokenPath:          envOr("PKB_TOKEN_PATH", defaultTokenPath()),
+		SlackToken:         os.Getenv("PKB_SLACK_TOKEN"),
+		NotionToken:        os.Getenv("PKB_NOTION_TOKEN"),
+		GitHubToken:        os.Getenv("PKB_GITHUB_TOKEN"),
+		DataDir:            envOr("PKB_DATA_DIR", defaultDataDir()),
+		ConfigPath:         envOr("PKB_CONFIG", defaultConfigPath()),
+	}
+	connectors, err := loadConnectors(cfg.ConfigPath)
+	if err != nil {
+		return nil, err
 	}
+	cfg.Connectors = connectors
+	cfg.ServerURL = envOr("PKB_SERVER_URL", defaultServerURL(cfg.ServerAddr))
 	return cfg, nil
 }
 
+// loadConnectors reads the connector instances from the config file at
+// path. A missing file configures none.
+func loadConnectors(path string) ([]ConnectorConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	var fc fileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	for i := range fc.Connectors {
+		c := &fc.Connectors[i]
+		if c.Name == "" {
+			c.Name = c.Type
+		}
+		for k, v := range c.Settings {
+			c.Settings[k] = os.ExpandEnv(v)
+		}
+	}
+	return fc.Connectors, nil
+}
+
 // userHomeDir returns the user's home directory. Overridden in tests.
 var userHomeDir = os.UserHomeDir
 
@@ -45,6 +137,39 @@ func defaultTokenPath() string {
 	return filepath.Join(home, ".config", "pkb", "token.json")
 }
 
+// defaultConfigPath returns the XDG-compliant default path for the config
+// file: $XDG_CONFIG_HOME/pkb/config.json if set, otherwise
+// ~/.config/pkb/config.json.
+func defaultConfigPath() string {
+	return filepath.Join(filepath.Dir(defaultTokenPath()), "config.json")
+}
+
+// defaultDataDir returns the XDG-compliant default data directory.
+// Uses $XDG_DATA_HOME/pkb if set, otherwise ~/.local/share/pkb.
+func defaultDataDir() string {
+	if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" {
+		return filepath.Join(xdg, "pkb")
+	}
+	home, err := userHomeDir()
+	if err != nil {
+		return ".pkb"
+	}
+	return filepath.Join(home, ".local", "share", "pkb")
+}
+
+// defaultServerURL returns the URL of a server listening on addr on this
+// machine.
+func defaultServerURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://localhost:8080"
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
 func envOr(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -15,18 +15,37 @@ func TestLoad_DefaultValues(t *testing.T) {
 	cfg, err := Load()
 	require.NoError(t, err)
 	assert.Equal(t, ":8080", cfg.ServerAddr)
+	assert.Equal(t, "http://localhost:8080", cfg.ServerURL)
+}
+
+func TestLoad_ServerURL(t *testing.T) {
+	t.Setenv("PKB_SERVER_ADDR", "127.0.0.1:9090")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:9090", cfg.ServerURL)
+
+	t.Setenv("PKB_SERVER_URL", "https://pkb.example.com")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, "https://pkb.example.com", cfg.ServerURL)
 }
 
 func TestLoad_ReadsEnvVars(t *testing.T) {
 	t.Setenv("PKB_SERVER_ADDR", ":9090")
 	t.Setenv("PKB_GOOGLE_CLIENT_ID", "test-client-id")
 	t.Setenv("PKB_GOOGLE_CLIENT_SECRET", "test-secret")
+	t.Setenv("PKB_SLACK_TOKEN", "xoxp-test")
+	t.Setenv("PKB_NOTION_TOKEN", "secret_test")
+	t.Setenv("PKB_GITHUB_TOKEN", "ghp_test")
 
 	cfg, err := Load()
 	require.NoError(t, err)
 	assert.Equal(t, ":9090", cfg.ServerAddr)
 	assert.Equal(t, "test-client-id", cfg.GoogleClientID)
 	assert.Equal(t, "test-secret", cfg.GoogleClientSecret)
+	assert.Equal(t, "xoxp-test", cfg.SlackToken)
+	assert.Equal(t, "secret_test", cfg.NotionToken)
+	assert.Equal(t, "ghp_test", cfg.GitHubToken)
 }
 
 func TestLoad_TokenPathDefault_UsesXDGConfigHome(t *testing.T) {
@@ -68,6 +87,32 @@ func TestLoad_TokenPathEnvOverride(t *testing.T) {
 	assert.Equal(t, "/custom/token.json", cfg.TokenPath)
 }
 
+func TestLoad_DataDirDefault_UsesXDGDataHome(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", "")
+	t.Setenv("XDG_DATA_HOME", "/tmp/test-xdg-data")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/tmp/test-xdg-data", "pkb"), cfg.DataDir)
+}
+
+func TestLoad_DataDirDefault_FallsBackToHomeLocalShare(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", "")
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("HOME", "/tmp/test-home")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/tmp/test-home", ".local", "share", "pkb"), cfg.DataDir)
+}
+
+func TestLoad_DataDirEnvOverride(t *testing.T) {
+	t.Setenv("PKB_DATA_DIR", "/custom/data")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "/custom/data", cfg.DataDir)
+}
+
 func TestLoad_CallsLoadDotenv(t *testing.T) {
 	called := false
 	orig := loadDotenv
@@ -114,3 +159,55 @@ func TestLoad_EnvVarsTakePrecedenceOverDotenv(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "real-id", cfg.GoogleClientID)
 }
+
+func TestLoad_ConfigPathDefault_UsesXDGConfigHome(t *testing.T) {
+	t.Setenv("PKB_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", "/tmp/test-xdg-config")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/tmp/test-xdg-config", "pkb", "config.json"), cfg.ConfigPath)
+}
+
+func TestLoad_MissingConfigFile_ConfiguresNoConnectors(t *testing.T) {
+	t.Setenv("PKB_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Connectors)
+}
+
+func TestLoad_ReadsConnectorInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"connectors": [
+			{"type": "gmail"},
+			{"name": "work-drive", "type": "google-drive", "enabled": false},
+			{"name": "team", "type": "slack", "settings": {"token": "${TEST_PKB_SLACK_TOKEN}", "channel": "general"}}
+		]
+	}`), 0600))
+	t.Setenv("PKB_CONFIG", path)
+	t.Setenv("TEST_PKB_SLACK_TOKEN", "xoxb-secret")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	require.Len(t, cfg.Connectors, 3)
+
+	assert.Equal(t, "gmail", cfg.Connectors[0].Name, "name defaults to the type")
+	assert.True(t, cfg.Connectors[0].IsEnabled(), "enabled by default")
+	assert.Equal(t, "work-drive", cfg.Connectors[1].Name)
+	assert.False(t, cfg.Connectors[1].IsEnabled())
+	assert.Equal(t, "xoxb-secret", cfg.Connectors[2].Setting("token", ""), "environment variables are expanded")
+	assert.Equal(t, "general", cfg.Connectors[2].Setting("channel", ""))
+	assert.Equal(t, "fallback", cfg.Connectors[2].Setting("missing", "fallback"))
+}
+
+func TestLoad_InvalidConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"connectors": [`), 0600))
+	t.Setenv("PKB_CONFIG", path)
+
+	_, err := Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "parse config")
+}
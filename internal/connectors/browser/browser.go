@@ -0,0 +1,341 @@
+// Package browser searches the bookmarks and history of Firefox and
+// Chromium-based browsers, read from their profile directories. The
+// browsers keep their databases open and locked while running, so each is
+// copied before it is read, and read again only when it changes.
+package browser
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+const (
+	defaultLimit = 20
+	// mimeTypeBookmark is the MIME type of bookmarked pages, which type:bookmark
+	// selects. Pages only in the history have none.
+	mimeTypeBookmark = "text/uri-list"
+	// dateLayout is how visit dates are shown in snippets.
+	dateLayout = "2 Jan 2006"
+)
+
+// Browser families, as results name them.
+const (
+	browserFirefox  = "firefox"
+	browserChromium = "chromium"
+)
+
+// entry is a page a profile has visited or bookmarked.
+type entry struct {
+	URL       string
+	Title     string
+	Visits    int
+	LastVisit time.Time
+	// Bookmarked pages have the folder they are filed in, as a path from
+	// the top, and the time they were added.
+	Bookmarked bool
+	Folder     string
+	Added      time.Time
+	Tags       []string
+	hidden     bool
+}
+
+// time is when the page was last visited, or else bookmarked.
+func (e entry) time() time.Time {
+	if !e.LastVisit.IsZero() {
+		return e.LastVisit
+	}
+	return e.Added
+}
+
+// profile is a browser profile directory and what was last read from it.
+type profile struct {
+	dir     string
+	browser string
+	// label names the profile on results: its directory, and for Chromium
+	// also the browser's, since every browser's first profile is Default.
+	label   string
+	version string
+	entries []entry
+}
+
+// Connector implements connectors.Connector for a set of browser profiles.
+type Connector struct {
+	name string
+
+	// mu serializes reads of the profiles and guards them.
+	mu       sync.Mutex
+	profiles []*profile
+}
+
+// NewConnector creates a connector for the profile directories dirs: a
+// Firefox profile holds places.sqlite, and a Chromium one (Chrome, Edge,
+// Brave and others) History and Bookmarks files.
+func NewConnector(dirs ...string) *Connector {
+	c := &Connector{name: "browser"}
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		p := &profile{dir: dir, browser: browserChromium, label: filepath.Join(filepath.Base(filepath.Dir(dir)), filepath.Base(dir))}
+		if _, err := os.Stat(filepath.Join(dir, firefoxPlaces)); err == nil {
+			p.browser, p.label = browserFirefox, filepath.Base(dir)
+		}
+		c.profiles = append(c.profiles, p)
+	}
+	return c
+}
+
+// WithName sets the name the connector reports and stamps on its results.
+// It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the words matched against titles and addresses and the
+// profiles searched.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	var labels []string
+	for _, p := range c.profiles {
+		labels = append(labels, p.browser+":"+p.label)
+	}
+	return connectors.Explanation{
+		Query:  parsed.Text(),
+		Params: map[string]string{"profiles": strings.Join(labels, ","), "limit": strconv.Itoa(limit(req))},
+	}, nil
+}
+
+func limit(req connectors.Request) int {
+	if req.Limit > 0 {
+		return req.Limit
+	}
+	return defaultLimit
+}
+
+// Search matches pages by title and address, most recently visited first.
+// A profile that cannot be read is reported as a warning unless none can.
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	offset := 0
+	if req.Cursor != "" {
+		if offset, err = strconv.Atoi(req.Cursor); err != nil || offset < 0 {
+			return connectors.Page{}, fmt.Errorf("invalid browser cursor %q", req.Cursor)
+		}
+	}
+	var warnings []string
+	for _, cl := range parsed.Clauses {
+		if cl.Field == query.FieldFrom {
+			warnings = append(warnings, query.Unsupported(cl))
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var failures []string
+	for _, p := range c.profiles {
+		if err := ctx.Err(); err != nil {
+			return connectors.Page{}, err
+		}
+		if err := p.update(); err != nil {
+			failures = append(failures, fmt.Sprintf("%s profile %s: %v", p.browser, p.dir, err))
+		}
+	}
+	if len(failures) == len(c.profiles) && len(failures) > 0 {
+		return connectors.Page{}, fmt.Errorf("browser search: %s", strings.Join(failures, "; "))
+	}
+
+	var results []connectors.Result
+	for _, p := range c.profiles {
+		for _, e := range p.entries {
+			if matches(parsed, e) {
+				results = append(results, c.toResult(p, e))
+			}
+		}
+	}
+	// Pages visited at the same time are ordered by profile and address,
+	// as profiles' entries come in no particular order.
+	slices.SortFunc(results, func(a, b connectors.Result) int {
+		return cmp.Or(b.ModifiedAt.Compare(a.ModifiedAt), strings.Compare(a.ID, b.ID))
+	})
+
+	page := connectors.Page{Results: []connectors.Result{}, Warnings: append(warnings, failures...)}
+	if offset < len(results) {
+		end := min(offset+limit(req), len(results))
+		page.Results = results[offset:end]
+		if end < len(results) {
+			page.NextCursor = strconv.Itoa(end)
+		}
+	}
+	return page, nil
+}
+
+// update reads the profile again if its files changed since the last read.
+func (p *profile) update() error {
+	files := []string{firefoxPlaces, firefoxPlaces + "-wal"}
+	if p.browser == browserChromium {
+		files = []string{chromiumHistory, chromiumBookmarks}
+	}
+	var version strings.Builder
+	for _, f := range files {
+		if info, err := os.Stat(filepath.Join(p.dir, f)); err == nil {
+			fmt.Fprintf(&version, "%s %d %d;", f, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	if p.entries != nil && version.String() == p.version {
+		return nil
+	}
+
+	read := readChromium
+	if p.browser == browserFirefox {
+		read = readFirefox
+	}
+	entries, err := read(p.dir)
+	if err != nil {
+		return err
+	}
+	p.entries, p.version = entries, version.String()
+	return nil
+}
+
+// matches reports whether a page satisfies every clause of q. Words and
+// phrases match titles, addresses, tags and folders, ignoring case.
+func matches(q query.Query, e entry) bool {
+	for _, cl := range q.Clauses {
+		value := strings.ToLower(cl.Value)
+		var in bool
+		switch cl.Field {
+		case query.FieldText:
+			in = strings.Contains(strings.ToLower(e.Title), value) ||
+				strings.Contains(strings.ToLower(e.URL), value) ||
+				strings.Contains(strings.ToLower(e.Folder), value) ||
+				slices.ContainsFunc(e.Tags, func(t string) bool { return strings.EqualFold(t, cl.Value) })
+		case query.FieldTitle:
+			in = strings.Contains(strings.ToLower(e.Title), value)
+		case query.FieldType:
+			in = e.Bookmarked && query.MatchesMIMEType(cl.Value, mimeTypeBookmark)
+		case query.FieldAfter:
+			in = !e.time().IsZero() && !e.time().Before(cl.Date())
+		case query.FieldBefore:
+			in = !e.time().IsZero() && e.time().Before(cl.Date())
+		default:
+			continue // source: is resolved by the engine; from: is unsupported
+		}
+		if in == cl.Negated {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Connector) toResult(p *profile, e entry) connectors.Result {
+	r := connectors.Result{
+		Title:      e.Title,
+		URL:        e.URL,
+		Source:     c.name,
+		ID:         p.browser + ":" + p.label + " " + e.URL,
+		CreatedAt:  e.Added,
+		ModifiedAt: e.time(),
+		Snippet:    snippet(e),
+		Metadata:   map[string]string{"browser": p.browser, "profile": p.label},
+	}
+	if r.Title == "" {
+		r.Title = e.URL
+	}
+	if e.Visits > 0 {
+		r.Metadata["visits"] = strconv.Itoa(e.Visits)
+	}
+	if e.Bookmarked {
+		r.MimeType = mimeTypeBookmark
+		r.Metadata["folder"] = e.Folder
+	}
+	if len(e.Tags) > 0 {
+		r.Metadata["tags"] = strings.Join(e.Tags, ", ")
+	}
+	return r
+}
+
+// snippet describes a page's address and visits, as in
+// "go.dev/doc — visited 5 times, last on 2 Mar 2024 · bookmarked in Dev".
+func snippet(e entry) string {
+	var parts []string
+	switch {
+	case e.Visits == 1:
+		parts = append(parts, "visited once, on "+e.LastVisit.Format(dateLayout))
+	case e.Visits > 1:
+		parts = append(parts, fmt.Sprintf("visited %d times, last on %s", e.Visits, e.LastVisit.Format(dateLayout)))
+	}
+	if e.Bookmarked && e.Folder != "" {
+		parts = append(parts, "bookmarked in "+e.Folder)
+	} else if e.Bookmarked {
+		parts = append(parts, "bookmarked")
+	}
+	if len(e.Tags) > 0 {
+		parts = append(parts, "tagged "+strings.Join(e.Tags, ", "))
+	}
+	addr := strings.TrimPrefix(strings.TrimPrefix(e.URL, "https://"), "http://")
+	if len(addr) > 100 {
+		addr = addr[:100] + "…"
+	}
+	if len(parts) == 0 {
+		return addr
+	}
+	return addr + " — " + strings.Join(parts, " · ")
+}
+
+// copyDB copies a database, and its write-ahead log if it has one, to a
+// temporary directory, so it can be read while the browser holds it
+// locked and keeps writing to it. cleanup removes the copy.
+func copyDB(path string) (snapshot string, cleanup func(), err error) {
+	dir, err := os.MkdirTemp("", "pkb-browser-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	snapshot = filepath.Join(dir, filepath.Base(path))
+	for _, suffix := range []string{"", "-wal"} {
+		err := copyFile(path+suffix, snapshot+suffix)
+		if err != nil && (suffix == "" || !os.IsNotExist(err)) {
+			cleanup()
+			return "", nil, err
+		}
+	}
+	return snapshot, cleanup, nil
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,170 @@
+package browser
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	firefoxProfile  = "testdata/firefox"
+	chromiumProfile = "testdata/chromium/Default"
+)
+
+func search(t *testing.T, c *Connector, q string) connectors.Page {
+	t.Helper()
+	page, err := c.Search(context.Background(), connectors.Request{Query: q})
+	require.NoError(t, err)
+	return page
+}
+
+func titles(page connectors.Page) []string {
+	var titles []string
+	for _, r := range page.Results {
+		titles = append(titles, r.Title)
+	}
+	return titles
+}
+
+func TestConnector_Name(t *testing.T) {
+	assert.Equal(t, "browser", NewConnector().Name())
+	assert.Equal(t, "laptop", NewConnector().WithName("laptop").Name())
+}
+
+func TestConnector_Search_Firefox(t *testing.T) {
+	c := NewConnector(firefoxProfile).WithName("web")
+
+	page := search(t, c, "golang")
+
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, connectors.Result{
+		Title:      "Effective Go",
+		Snippet:    "go.dev/doc/effective_go — visited 5 times, last on 2 Mar 2024 · bookmarked in Bookmarks Toolbar/Dev · tagged golang",
+		URL:        "https://go.dev/doc/effective_go",
+		Source:     "web",
+		ID:         "firefox:firefox https://go.dev/doc/effective_go",
+		CreatedAt:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ModifiedAt: time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC),
+		MimeType:   "text/uri-list",
+		Metadata: map[string]string{
+			"browser": "firefox",
+			"profile": "firefox",
+			"visits":  "5",
+			"folder":  "Bookmarks Toolbar/Dev",
+			"tags":    "golang",
+		},
+	}, page.Results[0])
+
+	assert.Equal(t, []string{"Only in the log"}, titles(search(t, c, "wal.example")), "recent visits still in the write-ahead log are found")
+	assert.Empty(t, search(t, c, "t.co").Results, "redirects are hidden")
+	assert.Empty(t, search(t, c, "Most Visited").Results, "saved bookmark searches are skipped")
+}
+
+func TestConnector_Search_Chromium(t *testing.T) {
+	c := NewConnector(chromiumProfile)
+
+	page := search(t, c, "caching")
+
+	require.Len(t, page.Results, 1)
+	r := page.Results[0]
+	assert.Equal(t, "Caching RFC (draft 3)", r.Title, "bookmark names win over page titles")
+	assert.Equal(t, time.Date(2024, 3, 3, 10, 0, 0, 0, time.UTC), r.ModifiedAt)
+	assert.Equal(t, time.Date(2024, 2, 17, 0, 0, 0, 0, time.UTC), r.CreatedAt)
+	assert.Equal(t, map[string]string{
+		"browser": "chromium",
+		"profile": filepath.Join("chromium", "Default"),
+		"visits":  "7",
+		"folder":  "Bookmarks bar/Design docs",
+	}, r.Metadata)
+
+	assert.Equal(t, []string{"Hiking trails near Lyon"}, titles(search(t, c, "lyon")), "bookmarks never visited are found")
+	assert.Empty(t, search(t, c, "accounts.example.com").Results)
+}
+
+func TestConnector_Search_Filters(t *testing.T) {
+	c := NewConnector(firefoxProfile, chromiumProfile)
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"go.dev", []string{"The Go Blog", "Effective Go"}},
+		{"type:bookmark -filler", []string{"Caching RFC (draft 3)", "Effective Go", "Hiking trails near Lyon", "Unvisited reading"}},
+		{"-type:bookmark after:2024-03-01", []string{"How SQLite stores data", "Only in the log", "The Go Blog"}},
+		{"after:2024-03-04 before:2024-03-06", []string{"The Go Blog"}},
+		{"title:go -blog", []string{"Effective Go"}},
+		{`"design docs"`, []string{"Caching RFC (draft 3)"}},
+		{"type:pdf", nil},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			assert.Equal(t, tc.want, titles(search(t, c, tc.query)))
+		})
+	}
+
+	page := search(t, c, "from:alice go.dev")
+	assert.Len(t, page.Results, 2)
+	assert.Equal(t, []string{"from:alice is not supported by this source and was ignored"}, page.Warnings)
+}
+
+func TestConnector_Search_Paging(t *testing.T) {
+	c := NewConnector(firefoxProfile, chromiumProfile)
+
+	page, err := c.Search(context.Background(), connectors.Request{Query: "filler", Limit: 500})
+	require.NoError(t, err)
+	assert.Equal(t, "500", page.NextCursor)
+	assert.Equal(t, "Filler page 699", page.Results[0].Title, "most recently visited first")
+
+	page, err = c.Search(context.Background(), connectors.Request{Query: "filler", Limit: 500, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Len(t, page.Results, 400)
+	assert.Empty(t, page.NextCursor)
+
+	_, err = c.Search(context.Background(), connectors.Request{Query: "filler", Cursor: "x"})
+	assert.EqualError(t, err, `invalid browser cursor "x"`)
+}
+
+func TestConnector_Search_UnreadableProfiles(t *testing.T) {
+	empty := t.TempDir()
+
+	page := search(t, NewConnector(chromiumProfile, empty), "lyon")
+	assert.Len(t, page.Results, 1)
+	require.Len(t, page.Warnings, 1)
+	assert.Contains(t, page.Warnings[0], "chromium profile "+empty+": no History or Bookmarks in "+empty)
+
+	_, err := NewConnector(empty).Search(context.Background(), connectors.Request{Query: "lyon"})
+	assert.ErrorContains(t, err, "browser search: chromium profile "+empty)
+}
+
+func TestConnector_Search_RereadsChangedProfiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Default")
+	require.NoError(t, os.Mkdir(dir, 0o755))
+	bookmarks := func(name string) {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(chromiumProfile, chromiumBookmarks))
+		require.NoError(t, err)
+		data = []byte(strings.Replace(string(data), "Hiking trails near Lyon", name, 1))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, chromiumBookmarks), data, 0o644))
+	}
+	bookmarks("Hiking trails near Lyon")
+	c := NewConnector(dir)
+	assert.Len(t, search(t, c, "hiking").Results, 1)
+
+	bookmarks("Cycling routes near Lyon (updated)")
+	assert.Empty(t, search(t, c, "hiking").Results)
+	assert.Len(t, search(t, c, "cycling").Results, 1)
+}
+
+func TestConnector_Explain(t *testing.T) {
+	exp, err := NewConnector(firefoxProfile, chromiumProfile).Explain(connectors.Request{Query: "go blog type:bookmark"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "go blog", exp.Query)
+	assert.Equal(t, "firefox:firefox,chromium:"+filepath.Join("chromium", "Default"), exp.Params["profiles"])
+}
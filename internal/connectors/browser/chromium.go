@@ -0,0 +1,149 @@
+package browser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files of a Chromium profile (Chrome, Chromium, Edge, Brave and others):
+// its history database and its bookmarks, in JSON.
+const (
+	chromiumHistory   = "History"
+	chromiumBookmarks = "Bookmarks"
+)
+
+// webkitEpoch is the start of Chromium's timestamps, 1601-01-01 UTC, in
+// microseconds from the Unix epoch.
+const webkitEpoch = -11644473600 * 1000 * 1000
+
+// readChromium reads the history and bookmarks of the Chromium profile in
+// dir. Either file may be missing, but not both.
+func readChromium(dir string) ([]entry, error) {
+	byURL := map[string]*entry{}
+	var order []string
+	add := func(e entry) *entry {
+		if p, ok := byURL[e.URL]; ok {
+			return p
+		}
+		byURL[e.URL] = &e
+		order = append(order, e.URL)
+		return byURL[e.URL]
+	}
+
+	history, err := readChromiumHistory(filepath.Join(dir, chromiumHistory))
+	missing := errors.Is(err, fs.ErrNotExist)
+	if err != nil && !missing {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	for _, e := range history {
+		add(e)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, chromiumBookmarks))
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && missing:
+		return nil, fmt.Errorf("no %s or %s in %s", chromiumHistory, chromiumBookmarks, dir)
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("read bookmarks: %w", err)
+	default:
+		var file struct {
+			Roots map[string]json.RawMessage `json:"roots"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("read bookmarks: %w", err)
+		}
+		// The roots are the bar, other and mobile folders, beside
+		// bookkeeping such as sync_transaction_version.
+		for _, name := range []string{"bookmark_bar", "other", "synced"} {
+			var root chromiumNode
+			if raw, ok := file.Roots[name]; !ok || json.Unmarshal(raw, &root) != nil {
+				continue
+			}
+			root.walk(nil, func(n chromiumNode, folder []string) {
+				p := add(entry{URL: n.URL, Title: n.Name})
+				p.Bookmarked = true
+				p.Folder = strings.Join(folder, "/")
+				added, _ := strconv.ParseInt(n.DateAdded, 10, 64)
+				p.Added = webkitTime(added)
+				if n.Name != "" {
+					p.Title = n.Name
+				}
+			})
+		}
+	}
+
+	entries := make([]entry, 0, len(order))
+	for _, u := range order {
+		entries = append(entries, *byURL[u])
+	}
+	return entries, nil
+}
+
+// readChromiumHistory reads the visited URLs from a copy of a History
+// database.
+func readChromiumHistory(path string) ([]entry, error) {
+	snapshot, cleanup, err := copyDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	db, err := openSQLite(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var entries []entry
+	err = db.scan("urls", func(r sqliteRow) error {
+		// Hidden URLs are redirects and subframes.
+		if r.int("hidden") != 0 || r.int("visit_count") == 0 {
+			return nil
+		}
+		entries = append(entries, entry{
+			URL:       r.text("url"),
+			Title:     r.text("title"),
+			Visits:    int(r.int("visit_count")),
+			LastVisit: webkitTime(r.int("last_visit_time")),
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// chromiumNode is a bookmark or folder in a Bookmarks file.
+type chromiumNode struct {
+	Type      string         `json:"type"`
+	Name      string         `json:"name"`
+	URL       string         `json:"url"`
+	DateAdded string         `json:"date_added"`
+	Children  []chromiumNode `json:"children"`
+}
+
+// walk calls fn with each bookmark under n and the names of the folders
+// leading to it.
+func (n chromiumNode) walk(folder []string, fn func(chromiumNode, []string)) {
+	if n.Type == "url" {
+		fn(n, folder)
+		return
+	}
+	folder = append(folder[:len(folder):len(folder)], n.Name)
+	for _, c := range n.Children {
+		c.walk(folder, fn)
+	}
+}
+
+// webkitTime converts Chromium's microseconds since 1601.
+func webkitTime(us int64) time.Time {
+	if us <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(us + webkitEpoch).UTC()
+}
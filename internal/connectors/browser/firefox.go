@@ -0,0 +1,143 @@
+package browser
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// firefoxPlaces is the database of a Firefox profile holding its history
+// and bookmarks.
+const firefoxPlaces = "places.sqlite"
+
+// Bookmark types in moz_bookmarks.
+const (
+	firefoxBookmark = 1
+	firefoxFolder   = 2
+)
+
+// firefoxRoots names the built-in bookmark folders, by GUID. Their titles
+// in the database are internal names.
+var firefoxRoots = map[string]string{
+	"menu________": "Bookmarks Menu",
+	"toolbar_____": "Bookmarks Toolbar",
+	"unfiled_____": "Other Bookmarks",
+	"mobile______": "Mobile Bookmarks",
+	"tags________": "Tags",
+	"root________": "",
+}
+
+// readFirefox reads the history and bookmarks of the Firefox profile in
+// dir, from a copy of its database.
+func readFirefox(dir string) ([]entry, error) {
+	snapshot, cleanup, err := copyDB(filepath.Join(dir, firefoxPlaces))
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	db, err := openSQLite(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	places := map[int64]*entry{}
+	err = db.scan("moz_places", func(r sqliteRow) error {
+		places[r.int("id")] = &entry{
+			URL:       r.text("url"),
+			Title:     r.text("title"),
+			Visits:    int(r.int("visit_count")),
+			LastVisit: microTime(r.int("last_visit_date")),
+			hidden:    r.int("hidden") != 0,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+
+	type folder struct {
+		title  string
+		parent int64
+		guid   string
+	}
+	folders := map[int64]folder{}
+	var bookmarks []sqliteRow
+	err = db.scan("moz_bookmarks", func(r sqliteRow) error {
+		switch r.int("type") {
+		case firefoxFolder:
+			folders[r.int("id")] = folder{title: r.text("title"), parent: r.int("parent"), guid: r.text("guid")}
+		case firefoxBookmark:
+			bookmarks = append(bookmarks, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read bookmarks: %w", err)
+	}
+
+	// path returns a folder's path from the root, and whether it is in the
+	// tags folder: Firefox files a tag as a folder there, holding a
+	// bookmark for every page with the tag.
+	path := func(id int64) (string, bool) {
+		var names []string
+		for range maxDepth {
+			f, ok := folders[id]
+			if !ok {
+				break
+			}
+			if name, ok := firefoxRoots[f.guid]; ok {
+				if f.guid == "tags________" {
+					return "", true
+				}
+				if name != "" {
+					names = append(names, name)
+				}
+			} else {
+				names = append(names, f.title)
+			}
+			id = f.parent
+		}
+		for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+			names[i], names[j] = names[j], names[i]
+		}
+		return strings.Join(names, "/"), false
+	}
+	for _, b := range bookmarks {
+		p, ok := places[b.int("fk")]
+		if !ok {
+			continue
+		}
+		folder, isTag := path(b.int("parent"))
+		if isTag {
+			p.Tags = append(p.Tags, folders[b.int("parent")].title)
+			continue
+		}
+		p.Bookmarked = true
+		p.Folder = folder
+		p.Added = microTime(b.int("dateAdded"))
+		if title := b.text("title"); title != "" {
+			p.Title = title
+		}
+	}
+
+	entries := make([]entry, 0, len(places))
+	for _, p := range places {
+		// Hidden places are redirects and embedded frames; place: URLs are
+		// saved searches of the bookmarks themselves.
+		if (p.hidden && !p.Bookmarked) || strings.HasPrefix(p.URL, "place:") || p.Visits == 0 && !p.Bookmarked {
+			continue
+		}
+		entries = append(entries, *p)
+	}
+	return entries, nil
+}
+
+// microTime converts Firefox's microseconds since the Unix epoch.
+func microTime(us int64) time.Time {
+	if us <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(us).UTC()
+}
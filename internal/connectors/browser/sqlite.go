@@ -0,0 +1,469 @@
+package browser
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// Browsers keep history in SQLite databases. pkb only needs to read a few
+// tables from a copy of them, so rather than depend on a SQLite library it
+// reads the file format directly: the table b-trees of a database in UTF-8,
+// with the committed frames of its write-ahead log applied. See
+// https://www.sqlite.org/fileformat.html.
+
+const sqliteMagic = "SQLite format 3\x00"
+
+// B-tree page types.
+const (
+	pageInteriorTable = 5
+	pageLeafTable     = 13
+)
+
+// maxDepth bounds how deep a b-tree is followed, so a corrupt file cannot
+// recurse forever.
+const maxDepth = 64
+
+var errCorrupt = errors.New("database file is corrupt")
+
+// sqliteDB is a read-only SQLite database.
+type sqliteDB struct {
+	file     *os.File
+	wal      *os.File
+	pageSize int
+	// usable is the page size less the bytes reserved at the end of each
+	// page.
+	usable int
+	// walPages holds the offset in wal of the latest committed copy of
+	// each page the log has.
+	walPages map[uint32]int64
+	tables   map[string]sqliteTable
+}
+
+// sqliteTable is a table's schema.
+type sqliteTable struct {
+	root    uint32
+	columns []string
+	// rowid is the index of the INTEGER PRIMARY KEY column, whose value is
+	// the row's key rather than part of its record, or -1.
+	rowid int
+}
+
+// openSQLite opens the database at path, and its write-ahead log if
+// path-wal exists.
+func openSQLite(path string) (*sqliteDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	db := &sqliteDB{file: f}
+	if err := db.init(path); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+func (db *sqliteDB) init(path string) error {
+	hdr := make([]byte, 100)
+	if _, err := db.file.ReadAt(hdr, 0); err != nil || string(hdr[:16]) != sqliteMagic {
+		return errors.New("not a SQLite database")
+	}
+	db.pageSize = int(binary.BigEndian.Uint16(hdr[16:]))
+	if db.pageSize == 1 {
+		db.pageSize = 65536
+	}
+	if db.pageSize < 512 || db.pageSize&(db.pageSize-1) != 0 {
+		return errCorrupt
+	}
+	db.usable = db.pageSize - int(hdr[20])
+	if enc := binary.BigEndian.Uint32(hdr[56:]); enc > 1 {
+		return errors.New("only UTF-8 databases are supported")
+	}
+
+	if wal, err := os.Open(path + "-wal"); err == nil {
+		db.wal = wal
+		if db.walPages, err = readWAL(wal, db.pageSize); err != nil {
+			return fmt.Errorf("write-ahead log: %w", err)
+		}
+	}
+	return db.readSchema()
+}
+
+// Close closes the database's files.
+func (db *sqliteDB) Close() error {
+	if db.wal != nil {
+		db.wal.Close()
+	}
+	return db.file.Close()
+}
+
+// page returns page n, counting from 1.
+func (db *sqliteDB) page(n uint32) ([]byte, error) {
+	if n == 0 {
+		return nil, errCorrupt
+	}
+	p := make([]byte, db.pageSize)
+	var err error
+	if off, ok := db.walPages[n]; ok {
+		_, err = db.wal.ReadAt(p, off)
+	} else {
+		_, err = db.file.ReadAt(p, int64(n-1)*int64(db.pageSize))
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errCorrupt
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// readWAL returns the offsets of the pages in a write-ahead log's
+// committed transactions. Frames are valid while their salts match the
+// log's header and their checksums chain; a transaction counts once its
+// commit frame is read.
+func readWAL(wal *os.File, pageSize int) (map[uint32]int64, error) {
+	hdr := make([]byte, 32)
+	if _, err := wal.ReadAt(hdr, 0); err != nil {
+		return nil, nil // empty: nothing to apply
+	}
+	var order binary.ByteOrder
+	switch binary.BigEndian.Uint32(hdr) {
+	case 0x377f0682:
+		order = binary.LittleEndian
+	case 0x377f0683:
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("bad header")
+	}
+	if int(binary.BigEndian.Uint32(hdr[8:])) != pageSize {
+		return nil, errors.New("page size differs from the database's")
+	}
+	s0, s1 := walChecksum(hdr[:24], 0, 0, order)
+	if s0 != binary.BigEndian.Uint32(hdr[24:]) || s1 != binary.BigEndian.Uint32(hdr[28:]) {
+		return nil, nil // never written to
+	}
+
+	committed := map[uint32]int64{}
+	pending := map[uint32]int64{}
+	frame := make([]byte, 24+pageSize)
+	for off := int64(32); ; off += int64(len(frame)) {
+		if _, err := wal.ReadAt(frame, off); err != nil {
+			break
+		}
+		if string(frame[8:16]) != string(hdr[16:24]) {
+			break
+		}
+		s0, s1 = walChecksum(frame[:8], s0, s1, order)
+		s0, s1 = walChecksum(frame[24:], s0, s1, order)
+		if s0 != binary.BigEndian.Uint32(frame[16:]) || s1 != binary.BigEndian.Uint32(frame[20:]) {
+			break
+		}
+		pending[binary.BigEndian.Uint32(frame)] = off + 24
+		if binary.BigEndian.Uint32(frame[4:]) != 0 { // a commit frame
+			for n, o := range pending {
+				committed[n] = o
+			}
+			clear(pending)
+		}
+	}
+	return committed, nil
+}
+
+// walChecksum continues the log's running checksum over b.
+func walChecksum(b []byte, s0, s1 uint32, order binary.ByteOrder) (uint32, uint32) {
+	for i := 0; i+8 <= len(b); i += 8 {
+		s0 += order.Uint32(b[i:]) + s1
+		s1 += order.Uint32(b[i+4:]) + s0
+	}
+	return s0, s1
+}
+
+// readSchema reads the tables from the schema table, rooted at page 1.
+func (db *sqliteDB) readSchema() error {
+	db.tables = map[string]sqliteTable{}
+	return db.walk(1, 0, func(_ int64, rec []any) error {
+		if len(rec) < 5 {
+			return nil
+		}
+		typ, _ := rec[0].(string)
+		name, _ := rec[1].(string)
+		root, _ := rec[3].(int64)
+		sql, _ := rec[4].(string)
+		if typ != "table" || root <= 0 || root > math.MaxUint32 {
+			return nil // an index, view, trigger or WITHOUT ROWID table
+		}
+		columns, rowid := parseColumns(sql)
+		db.tables[strings.ToLower(name)] = sqliteTable{root: uint32(root), columns: columns, rowid: rowid}
+		return nil
+	})
+}
+
+// parseColumns returns the column names of a CREATE TABLE statement, and
+// the index of its INTEGER PRIMARY KEY column or -1.
+func parseColumns(sql string) ([]string, int) {
+	start, end := strings.IndexByte(sql, '('), strings.LastIndexByte(sql, ')')
+	if start < 0 || end < start {
+		return nil, -1
+	}
+	var columns []string
+	rowid := -1
+	depth, from := 0, start+1
+	defs := []string{}
+	for i := start + 1; i < end; i++ {
+		switch sql[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				defs = append(defs, sql[from:i])
+				from = i + 1
+			}
+		}
+	}
+	defs = append(defs, sql[from:end])
+	for _, def := range defs {
+		fields := strings.Fields(def)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+			continue // a table constraint
+		}
+		upper := strings.ToUpper(def)
+		if len(fields) > 1 && strings.ToUpper(fields[1]) == "INTEGER" && strings.Contains(upper, "PRIMARY KEY") && !strings.Contains(upper, " DESC") {
+			rowid = len(columns)
+		}
+		columns = append(columns, strings.Trim(fields[0], "\"`[]'"))
+	}
+	return columns, rowid
+}
+
+// sqliteRow is a row of a table, by column name. Values are nil, int64,
+// float64, string or []byte.
+type sqliteRow map[string]any
+
+func (r sqliteRow) text(col string) string {
+	s, _ := r[col].(string)
+	return s
+}
+
+func (r sqliteRow) int(col string) int64 {
+	switch v := r[col].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// scan calls fn with every row of a table.
+func (db *sqliteDB) scan(table string, fn func(sqliteRow) error) error {
+	t, ok := db.tables[strings.ToLower(table)]
+	if !ok {
+		return fmt.Errorf("no table %s", table)
+	}
+	return db.walk(t.root, 0, func(rowid int64, rec []any) error {
+		row := make(sqliteRow, len(t.columns))
+		for i, col := range t.columns {
+			switch {
+			case i == t.rowid:
+				row[col] = rowid
+			case i < len(rec):
+				row[col] = rec[i]
+			}
+		}
+		return fn(row)
+	})
+}
+
+// walk calls fn with the rowid and record of every cell of the table
+// b-tree rooted at page n.
+func (db *sqliteDB) walk(n uint32, depth int, fn func(int64, []any) error) error {
+	if depth > maxDepth {
+		return errCorrupt
+	}
+	p, err := db.page(n)
+	if err != nil {
+		return err
+	}
+	hdr := 0
+	if n == 1 {
+		hdr = 100
+	}
+	if len(p) < hdr+12 {
+		return errCorrupt
+	}
+	typ := p[hdr]
+	cells := int(binary.BigEndian.Uint16(p[hdr+3:]))
+	ptrs := hdr + 8
+	if typ == pageInteriorTable {
+		ptrs = hdr + 12
+	}
+	if ptrs+2*cells > len(p) {
+		return errCorrupt
+	}
+	for i := range cells {
+		off := int(binary.BigEndian.Uint16(p[ptrs+2*i:]))
+		if off >= len(p) {
+			return errCorrupt
+		}
+		switch typ {
+		case pageInteriorTable:
+			if off+4 > len(p) {
+				return errCorrupt
+			}
+			if err := db.walk(binary.BigEndian.Uint32(p[off:]), depth+1, fn); err != nil {
+				return err
+			}
+		case pageLeafTable:
+			rowid, payload, err := db.leafCell(p, off)
+			if err != nil {
+				return err
+			}
+			rec, err := decodeRecord(payload)
+			if err != nil {
+				return err
+			}
+			if err := fn(rowid, rec); err != nil {
+				return err
+			}
+		default:
+			return errCorrupt
+		}
+	}
+	if typ == pageInteriorTable {
+		return db.walk(binary.BigEndian.Uint32(p[hdr+8:]), depth+1, fn)
+	}
+	return nil
+}
+
+// leafCell returns the rowid and payload of the table leaf cell at off in
+// page p, following its overflow pages.
+func (db *sqliteDB) leafCell(p []byte, off int) (int64, []byte, error) {
+	size, n := varint(p[off:])
+	off += n
+	rowid, n := varint(p[off:])
+	off += n
+	if n == 0 || size < 0 {
+		return 0, nil, errCorrupt
+	}
+
+	// How much of the payload is on the page itself.
+	total := int(size)
+	local := total
+	if maxLocal := db.usable - 35; total > maxLocal {
+		minLocal := (db.usable-12)*32/255 - 23
+		local = minLocal + (total-minLocal)%(db.usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if off+local > len(p) {
+		return 0, nil, errCorrupt
+	}
+	payload := append(make([]byte, 0, total), p[off:off+local]...)
+	if local == total {
+		return rowid, payload, nil
+	}
+	if off+local+4 > len(p) {
+		return 0, nil, errCorrupt
+	}
+	next := binary.BigEndian.Uint32(p[off+local:])
+	for len(payload) < total {
+		if next == 0 {
+			return 0, nil, errCorrupt
+		}
+		op, err := db.page(next)
+		if err != nil {
+			return 0, nil, err
+		}
+		next = binary.BigEndian.Uint32(op)
+		chunk := op[4:db.usable]
+		if rest := total - len(payload); len(chunk) > rest {
+			chunk = chunk[:rest]
+		}
+		payload = append(payload, chunk...)
+	}
+	return rowid, payload, nil
+}
+
+// varint decodes a SQLite variable-length integer, returning it and the
+// bytes read, or 0 bytes if b is too short.
+func varint(b []byte) (int64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return int64(v<<8 | uint64(b[i])), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return int64(v), i + 1
+		}
+	}
+	return 0, 0
+}
+
+// decodeRecord decodes the values of a record.
+func decodeRecord(b []byte) ([]any, error) {
+	hdrSize, n := varint(b)
+	if n == 0 || hdrSize < int64(n) || hdrSize > int64(len(b)) {
+		return nil, errCorrupt
+	}
+	var values []any
+	body := b[hdrSize:]
+	for h := b[n:hdrSize]; len(h) > 0; {
+		typ, n := varint(h)
+		if n == 0 {
+			return nil, errCorrupt
+		}
+		h = h[n:]
+		var size int
+		switch {
+		case typ >= 12:
+			size = int(typ-12) / 2
+		case typ >= 1 && typ <= 4:
+			size = int(typ)
+		case typ == 5:
+			size = 6
+		case typ == 6 || typ == 7:
+			size = 8
+		}
+		if size > len(body) {
+			return nil, errCorrupt
+		}
+		v := body[:size]
+		body = body[size:]
+		switch {
+		case typ == 0:
+			values = append(values, nil)
+		case typ <= 6:
+			// Big-endian two's complement of 1 to 8 bytes.
+			x := int64(int8(v[0]))
+			for _, c := range v[1:] {
+				x = x<<8 | int64(c)
+			}
+			values = append(values, x)
+		case typ == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case typ == 8, typ == 9:
+			values = append(values, typ-8)
+		case typ >= 12 && typ%2 == 0:
+			values = append(values, append([]byte(nil), v...))
+		case typ >= 13:
+			values = append(values, string(v))
+		default:
+			return nil, errCorrupt
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,115 @@
+package browser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The databases in testdata are made by testdata/generate.py.
+
+func TestSQLite_Scan(t *testing.T) {
+	db, err := openSQLite("testdata/chromium/Default/History")
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := map[int64]sqliteRow{}
+	require.NoError(t, db.scan("urls", func(r sqliteRow) error {
+		rows[r.int("id")] = r
+		return nil
+	}))
+
+	assert.Len(t, rows, 303, "rows spread over several pages are all read")
+	assert.Equal(t, sqliteRow{
+		"id":              int64(2),
+		"url":             "https://docs.example.com/rfc/caching",
+		"title":           "Caching RFC",
+		"visit_count":     int64(7),
+		"typed_count":     int64(0),
+		"last_visit_time": int64(13353933600000000),
+		"hidden":          int64(0),
+	}, rows[2])
+	assert.Equal(t, "Filler 399", rows[399].text("title"))
+
+	assert.EqualError(t, db.scan("visits", func(sqliteRow) error { return nil }), "no table visits")
+}
+
+func TestSQLite_OverflowPagesAndWriteAheadLog(t *testing.T) {
+	db, err := openSQLite("testdata/firefox/places.sqlite")
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := map[int64]sqliteRow{}
+	require.NoError(t, db.scan("moz_places", func(r sqliteRow) error {
+		rows[r.int("id")] = r
+		return nil
+	}))
+
+	assert.Equal(t, "https://example.com/search?q="+strings.Repeat("x", 6000), rows[5].text("url"))
+	assert.Equal(t, "A very long address", rows[5].text("title"))
+	assert.Nil(t, rows[3]["title"])
+	assert.Equal(t, int64(2), rows[2].int("visit_count"), "the log's update applies")
+	assert.Equal(t, "Only in the log", rows[7].text("title"))
+}
+
+func TestSQLite_WithoutTheLog(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile("testdata/firefox/places.sqlite")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "places.sqlite"), data, 0o644))
+
+	db, err := openSQLite(filepath.Join(dir, "places.sqlite"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows := map[int64]sqliteRow{}
+	require.NoError(t, db.scan("moz_places", func(r sqliteRow) error {
+		rows[r.int("id")] = r
+		return nil
+	}))
+	assert.Equal(t, int64(1), rows[2].int("visit_count"))
+	assert.NotContains(t, rows, int64(7))
+}
+
+func TestSQLite_TornLog(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"places.sqlite", "places.sqlite-wal"} {
+		data, err := os.ReadFile(filepath.Join("testdata/firefox", name))
+		require.NoError(t, err)
+		if name == "places.sqlite-wal" {
+			data[len(data)-1] ^= 0xff // the last frame, which commits, fails its checksum
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+
+	db, err := openSQLite(filepath.Join(dir, "places.sqlite"))
+	require.NoError(t, err)
+	defer db.Close()
+	var ids []int64
+	require.NoError(t, db.scan("moz_places", func(r sqliteRow) error {
+		ids = append(ids, r.int("id"))
+		return nil
+	}))
+	assert.NotContains(t, ids, int64(7), "the uncommitted transaction is ignored")
+}
+
+func TestOpenSQLite_NotADatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "History")
+	require.NoError(t, os.WriteFile(path, []byte("not a database"), 0o644))
+
+	_, err := openSQLite(path)
+	assert.EqualError(t, err, path+": not a SQLite database")
+}
+
+func TestParseColumns(t *testing.T) {
+	columns, rowid := parseColumns(`CREATE TABLE "t" (a TEXT, "b" INTEGER DEFAULT (1 + 2), id INTEGER PRIMARY KEY, c, UNIQUE (a, b))`)
+	assert.Equal(t, []string{"a", "b", "id", "c"}, columns)
+	assert.Equal(t, 2, rowid)
+
+	_, rowid = parseColumns(`CREATE TABLE t (key LONGVARCHAR NOT NULL UNIQUE PRIMARY KEY, value LONGVARCHAR)`)
+	assert.Equal(t, -1, rowid)
+}
@@ -0,0 +1,106 @@
+#!/usr/bin/env python3
+"""Regenerates the browser databases the tests read.
+
+Run from this directory. The Firefox database is left with a write-ahead
+log holding the last transaction, as a running Firefox leaves it; the
+tables are filled enough to need interior b-tree pages and overflow pages.
+"""
+import os
+import shutil
+import sqlite3
+import tempfile
+
+US = 1_000_000
+WEBKIT_EPOCH = 11644473600  # seconds from 1601-01-01 to 1970-01-01
+
+
+def unix_us(ts):
+    return ts * US
+
+
+def firefox():
+    tmp = tempfile.mkdtemp()
+    path = os.path.join(tmp, "places.sqlite")
+    db = sqlite3.connect(path)
+    db.execute("PRAGMA page_size = 4096")
+    db.execute("PRAGMA journal_mode = WAL")
+    db.execute("PRAGMA wal_autocheckpoint = 0")
+    db.executescript("""
+        CREATE TABLE moz_places (id INTEGER PRIMARY KEY, url LONGVARCHAR, title LONGVARCHAR, rev_host LONGVARCHAR,
+            visit_count INTEGER DEFAULT 0, hidden INTEGER DEFAULT 0 NOT NULL, typed INTEGER DEFAULT 0 NOT NULL,
+            frecency INTEGER DEFAULT -1 NOT NULL, last_visit_date INTEGER , guid TEXT,
+            foreign_count INTEGER DEFAULT 0 NOT NULL, url_hash INTEGER DEFAULT 0 NOT NULL , description TEXT,
+            preview_image_url TEXT, site_name TEXT, origin_id INTEGER REFERENCES moz_origins(id));
+        CREATE TABLE moz_bookmarks (id INTEGER PRIMARY KEY, type INTEGER, fk INTEGER DEFAULT NULL, parent INTEGER,
+            position INTEGER, title LONGVARCHAR, keyword_id INTEGER, folder_type TEXT, dateAdded INTEGER,
+            lastModified INTEGER, guid TEXT, syncStatus INTEGER NOT NULL DEFAULT 0,
+            syncChangeCounter INTEGER NOT NULL DEFAULT 1);
+        CREATE INDEX moz_places_url_hashindex ON moz_places (url_hash);
+    """)
+    places = [
+        (1, "https://go.dev/doc/effective_go", "Effective Go - The Go Programming Language", 5, 0, unix_us(1709373600)),  # 2024-03-02T10:00Z
+        (2, "https://news.example.com/sqlite-internals", "How SQLite stores data", 1, 0, unix_us(1709632800)),  # 2024-03-05T10:00Z
+        (3, "https://t.co/abc", None, 1, 1, unix_us(1709632800)),
+        (4, "place:sort=8&maxResults=10", None, 0, 0, None),
+        (5, "https://example.com/search?q=" + "x" * 6000, "A very long address", 1, 0, unix_us(1706745600)),  # 2024-02-01
+    ]
+    places += [(i, f"https://filler.example.com/page/{i}", f"Filler page {i}", 1, 0, unix_us(1672531200 + i)) for i in range(100, 700)]
+    db.executemany("INSERT INTO moz_places (id, url, title, visit_count, hidden, last_visit_date) VALUES (?, ?, ?, ?, ?, ?)", places)
+    added = unix_us(1704067200)  # 2024-01-01
+    db.executemany("INSERT INTO moz_bookmarks (id, type, fk, parent, position, title, dateAdded, lastModified, guid) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", [
+        (1, 2, None, 0, 0, "", added, added, "root________"),
+        (2, 2, None, 1, 0, "menu", added, added, "menu________"),
+        (3, 2, None, 1, 1, "toolbar", added, added, "toolbar_____"),
+        (4, 2, None, 1, 2, "tags", added, added, "tags________"),
+        (5, 2, None, 1, 3, "unfiled", added, added, "unfiled_____"),
+        (6, 2, None, 1, 4, "mobile", added, added, "mobile______"),
+        (7, 2, None, 3, 0, "Dev", added, added, "folderDev___"),
+        (8, 1, 1, 7, 0, "Effective Go", added, added, "bookmark1___"),
+        (9, 2, None, 4, 0, "golang", added, added, "tagGolang___"),
+        (10, 1, 1, 9, 0, None, added, added, "tagEntry1___"),
+        (11, 1, 4, 2, 0, "Most Visited", added, added, "smartQuery__"),
+        (12, 1, 6, 5, 0, "Unvisited reading", added, added, "bookmark2___"),
+    ])
+    db.execute("INSERT INTO moz_places (id, url, title, visit_count, last_visit_date) VALUES (6, 'https://blog.example.com/unvisited', 'Reading list item', 0, NULL)")
+    db.commit()
+    db.execute("PRAGMA wal_checkpoint(TRUNCATE)")
+
+    # The last transaction stays in the log.
+    db.execute("UPDATE moz_places SET visit_count = 2, last_visit_date = ? WHERE id = 2", (unix_us(1709719200),))  # 2024-03-06T10:00Z
+    db.execute("INSERT INTO moz_places (id, url, title, visit_count, last_visit_date) VALUES (7, 'https://wal.example.com/', 'Only in the log', 1, ?)", (unix_us(1709719200),))
+    db.commit()
+
+    shutil.copy(path, "firefox/places.sqlite")
+    shutil.copy(path + "-wal", "firefox/places.sqlite-wal")
+    db.close()
+    shutil.rmtree(tmp)
+
+
+def chromium():
+    path = "chromium/Default/History"
+    if os.path.exists(path):
+        os.remove(path)
+    db = sqlite3.connect(path)
+    db.executescript("""
+        CREATE TABLE meta(key LONGVARCHAR NOT NULL UNIQUE PRIMARY KEY, value LONGVARCHAR);
+        CREATE TABLE urls(id INTEGER PRIMARY KEY AUTOINCREMENT,url LONGVARCHAR,title LONGVARCHAR,
+            visit_count INTEGER DEFAULT 0 NOT NULL,typed_count INTEGER DEFAULT 0 NOT NULL,
+            last_visit_time INTEGER NOT NULL,hidden INTEGER DEFAULT 0 NOT NULL);
+    """)
+
+    def webkit(ts):
+        return (ts + WEBKIT_EPOCH) * US
+
+    rows = [
+        (1, "https://go.dev/blog/", "The Go Blog", 3, webkit(1709546400), 0),  # 2024-03-04T10:00Z
+        (2, "https://docs.example.com/rfc/caching", "Caching RFC", 7, webkit(1709460000), 0),  # 2024-03-03T10:00Z
+        (3, "https://accounts.example.com/redirect", "", 1, webkit(1709460000), 1),
+    ]
+    rows += [(i, f"https://filler.example.com/chrome/{i}", f"Filler {i}", 1, webkit(1672531200 + i), 0) for i in range(100, 400)]
+    db.executemany("INSERT INTO urls (id, url, title, visit_count, last_visit_time, hidden) VALUES (?, ?, ?, ?, ?, ?)", rows)
+    db.commit()
+    db.close()
+
+
+firefox()
+chromium()
@@ -1,6 +1,12 @@
 package connectors
 
-import "context"
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
 
 // Result represents a single search result from any connector.
 type Result struct {
@@ -8,10 +14,177 @@ type Result struct {
 	Snippet string
 	URL     string
 	Source  string
+
+	// ID is the stable, source-specific identifier of the item (e.g. a Drive
+	// file ID or Gmail message ID), usable for deep links and deduplication.
+	ID string `json:",omitempty"`
+	// CreatedAt and ModifiedAt are zero when the source does not report them.
+	CreatedAt  time.Time `json:",omitzero"`
+	ModifiedAt time.Time `json:",omitzero"`
+	// Author is the owner, author or sender of the item.
+	Author string `json:",omitempty"`
+	// MimeType is the content type of the item (e.g. "application/pdf").
+	MimeType string `json:",omitempty"`
+	// Score is the relevance score of the result; higher is more relevant.
+	Score float64 `json:",omitempty"`
+	// Metadata holds free-form, source-specific attributes.
+	Metadata map[string]string `json:",omitempty"`
+}
+
+// Request describes a single search against a connector.
+type Request struct {
+	// Query is in pkb query syntax; connectors parse it with query.Parse
+	// and translate it to their native syntax.
+	Query string
+	// Limit is the maximum number of results to return. Zero means the
+	// connector's default page size.
+	Limit int
+	// Cursor is an opaque continuation token returned as Page.NextCursor by
+	// a previous search. Empty requests the first page.
+	Cursor string
+}
+
+// Page is one page of results from a connector.
+type Page struct {
+	Results []Result
+	// NextCursor is non-empty when more results are available.
+	NextCursor string
+	// Warnings describe parts of the request the connector could not honor,
+	// such as query operators it has no equivalent for.
+	Warnings []string
+}
+
+// Explanation describes the native request a connector sends for a search.
+type Explanation struct {
+	// Query is the search query in the source's native syntax.
+	Query string
+	// Params are the other request parameters, such as page size and fields.
+	Params map[string]string
+}
+
+// Explainer is implemented by connectors that can describe their native
+// request for a search, to help debug unexpected results.
+type Explainer interface {
+	Explain(req Request) (Explanation, error)
 }
 
 // Connector is the interface that each data source implements.
 type Connector interface {
-	Search(ctx context.Context, query string) ([]Result, error)
+	Search(ctx context.Context, req Request) (Page, error)
 	Name() string
 }
+
+// TimeLimited is implemented by connectors whose searches have a time
+// limit, such as ones that run an external program. The search engine
+// abandons a search that overruns it, even one that ignores its context,
+// and reports that source as failed.
+type TimeLimited interface {
+	SearchTimeout() time.Duration
+}
+
+// Document is an item copied into the local index, with the full text that
+// is indexed beyond the result's title and snippet.
+type Document struct {
+	Result
+	Body string
+}
+
+// CrawlPage is one page of documents from a crawl.
+type CrawlPage struct {
+	Documents []Document
+	// NextCursor is non-empty when the crawl has more pages.
+	NextCursor string
+}
+
+// Crawler is implemented by connectors whose items can be copied into the
+// local index by pkb sync.
+type Crawler interface {
+	Connector
+	// Crawl returns one page of every item in the source, continuing from
+	// cursor ("" starts a new crawl). Cursors stay valid across restarts, so
+	// an interrupted crawl can resume.
+	Crawl(ctx context.Context, cursor string) (CrawlPage, error)
+}
+
+// ErrCursorExpired is returned by ChangeTracker.Changes when the source no
+// longer has history back to the cursor; the caller must crawl again.
+var ErrCursorExpired = errors.New("change cursor expired")
+
+// Change is one item added, modified or deleted at the source.
+type Change struct {
+	ID string
+	// Deleted is true when the item was removed, or is no longer one the
+	// crawler would return (e.g. it was moved to the trash).
+	Deleted bool
+	// Document is the item's current content when Deleted is false.
+	Document Document
+}
+
+// ChangePage is one page of changes.
+type ChangePage struct {
+	Changes []Change
+	// NextCursor continues the walk through changes when Done is false.
+	// When Done is true it is the cursor to pass on the next sync, covering
+	// changes made after this page.
+	NextCursor string
+	Done       bool
+}
+
+// ChangeTracker is implemented by crawlers whose source can list what
+// changed since a previous sync, so pkb sync need not re-crawl everything.
+type ChangeTracker interface {
+	Crawler
+	// StartCursor returns a cursor for changes made from now on. Taking it
+	// before a full crawl ensures changes made during the crawl are seen.
+	StartCursor(ctx context.Context) (string, error)
+	// Changes returns one page of changes since cursor. It returns an error
+	// wrapping ErrCursorExpired when cursor is too old.
+	Changes(ctx context.Context, cursor string) (ChangePage, error)
+}
+
+// ErrNotFound is returned by Viewer.View for an ID the source does not
+// have.
+var ErrNotFound = errors.New("not found")
+
+// View is an item as pkb serve shows it, for sources whose items have no
+// page of their own to link to, such as messages in a local mail archive.
+type View struct {
+	Title string
+	// Fields are labelled details shown above the body, in order.
+	Fields []ViewField
+	// Sections make up the body, such as a message's text or the turns of
+	// a conversation.
+	Sections []ViewSection
+}
+
+// ViewField is a labelled detail of a View, such as a message's sender.
+type ViewField struct {
+	Name  string
+	Value string
+}
+
+// ViewSection is part of a View's body.
+type ViewSection struct {
+	// Heading is optional, e.g. who wrote a turn and when.
+	Heading string
+	// Text is plain text; line breaks are kept.
+	Text string
+	// Anchor is optional; it names the section, so that a URL whose
+	// fragment is the anchor scrolls to it.
+	Anchor string
+}
+
+// Viewer is implemented by connectors whose results link to a view served
+// by pkb serve (see ViewURL).
+type Viewer interface {
+	Connector
+	// View returns the item with the given result ID, or an error wrapping
+	// ErrNotFound.
+	View(ctx context.Context, id string) (View, error)
+}
+
+// ViewURL returns the URL at which pkb serve, reached at base, shows the
+// item with the given ID from the named source.
+func ViewURL(base, source, id string) string {
+	return strings.TrimSuffix(base, "/") + "/view/" + url.PathEscape(source) + "/" + url.PathEscape(id)
+}
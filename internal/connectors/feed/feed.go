@@ -0,0 +1,474 @@
+// Package feed searches RSS and Atom feeds, such as engineering blogs and
+// changelogs. Feeds are fetched again when a search or a sync finds them
+// older than the refresh interval, and their entries are kept in a local
+// archive, so an entry stays searchable after it drops off the end of its
+// feed.
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+const (
+	defaultLimit = 20
+	// DefaultRefresh is how long a fetched feed is searched before it is
+	// fetched again.
+	DefaultRefresh = time.Hour
+	// mimeType is the MIME type of an Atom entry, which type:article
+	// selects. RSS items have it too.
+	mimeType = "application/atom+xml;type=entry"
+	// maxFeedSize bounds how much of a feed is read.
+	maxFeedSize = 10 << 20
+	// maxErrorBody bounds how much of an error response is quoted.
+	maxErrorBody = 200
+	// crawlPageSize is how many archived entries a crawl page holds.
+	crawlPageSize = 200
+)
+
+// Connector implements connectors.Connector for a set of feeds.
+type Connector struct {
+	urls       []string
+	httpClient *http.Client
+	name       string
+	indexDir   string
+	refresh    time.Duration
+	now        func() time.Time
+
+	// mu guards everything below it. It is not held while feeds are
+	// fetched.
+	mu     sync.Mutex
+	loaded bool
+	index  *index.Index
+	feeds  map[string]feedState
+	// fetching holds the feeds being fetched, which other refreshes leave
+	// alone.
+	fetching map[string]bool
+}
+
+// feedState is what was learned the last time a feed was fetched. It is
+// persisted next to the archive.
+type feedState struct {
+	Title   string `json:",omitempty"`
+	Fetched time.Time
+	// ETag and LastModified make the next fetch conditional, so an
+	// unchanged feed is not downloaded again.
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+	// Error is why the last fetch failed. It is reported with every
+	// search until a fetch succeeds.
+	Error string `json:",omitempty"`
+}
+
+// NewConnector creates a connector for the feeds at urls, fetched with
+// httpClient (http.DefaultClient if nil). Until WithIndexDir is called, the
+// archive lives in memory and holds only what the feeds list while the
+// process runs.
+func NewConnector(httpClient *http.Client, urls ...string) *Connector {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Connector{
+		urls:       urls,
+		httpClient: httpClient,
+		name:       "feed",
+		refresh:    DefaultRefresh,
+		now:        time.Now,
+		index:      index.New(),
+		feeds:      map[string]feedState{},
+		fetching:   map[string]bool{},
+	}
+}
+
+// WithName sets the name the connector reports and stamps on its results.
+// It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+// WithIndexDir keeps the archive in dir, named after the connector. It
+// returns c.
+func (c *Connector) WithIndexDir(dir string) *Connector {
+	c.indexDir = dir
+	return c
+}
+
+// WithRefresh sets how long a fetched feed is searched before it is fetched
+// again. It returns c.
+func (c *Connector) WithRefresh(d time.Duration) *Connector {
+	c.refresh = d
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the stemmed terms searched for and the feeds searched.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	return connectors.Explanation{
+		Query: strings.Join(index.Terms(parsed), " "),
+		Params: map[string]string{
+			"feeds":   strings.Join(c.urls, ","),
+			"refresh": c.refresh.String(),
+			"limit":   strconv.Itoa(limit(req)),
+		},
+	}, nil
+}
+
+func limit(req connectors.Request) int {
+	if req.Limit > 0 {
+		return req.Limit
+	}
+	return defaultLimit
+}
+
+// Search refreshes the feeds that are due and searches the archive. A
+// feed that cannot be fetched is reported as a warning, and what was
+// archived from it is still searched.
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	offset := 0
+	if req.Cursor != "" {
+		if offset, err = strconv.Atoi(req.Cursor); err != nil || offset < 0 {
+			return connectors.Page{}, fmt.Errorf("invalid feed cursor %q", req.Cursor)
+		}
+	}
+
+	warnings, err := c.update(ctx)
+	if err != nil {
+		return connectors.Page{}, fmt.Errorf("feed search: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	terms := index.Terms(parsed)
+	hits := c.index.Search(parsed)
+	end := min(offset+limit(req), len(hits))
+	results := []connectors.Result{}
+	for _, h := range hits[min(offset, end):end] {
+		r := h.Doc.Result
+		r.Snippet = index.Snippet(h.Doc.Body, terms)
+		results = append(results, r)
+	}
+
+	var next string
+	if end < len(hits) {
+		next = strconv.Itoa(end)
+	}
+	return connectors.Page{Results: results, NextCursor: next, Warnings: warnings}, nil
+}
+
+// Crawl refreshes the feeds that are due, as a search does, and lists
+// every archived entry, so that pkb sync, and pkb serve with a sync
+// interval, archive entries on a schedule rather than only when the feeds
+// are searched. A cursor is the offset of the next entry. A feed that
+// cannot be fetched does not fail the crawl; searches report it.
+func (c *Connector) Crawl(ctx context.Context, cursor string) (connectors.CrawlPage, error) {
+	offset := 0
+	if cursor == "" {
+		if _, err := c.update(ctx); err != nil {
+			return connectors.CrawlPage{}, fmt.Errorf("feed crawl: %w", err)
+		}
+	} else {
+		var err error
+		if offset, err = strconv.Atoi(cursor); err != nil || offset < 0 {
+			return connectors.CrawlPage{}, fmt.Errorf("feed crawl: invalid cursor %q", cursor)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return connectors.CrawlPage{}, fmt.Errorf("feed crawl: %w", err)
+	}
+	ids := c.index.IDs(c.name)
+	end := min(offset+crawlPageSize, len(ids))
+	var page connectors.CrawlPage
+	for _, id := range ids[min(offset, end):end] {
+		if d, ok := c.index.Get(c.name, id); ok {
+			page.Documents = append(page.Documents, d)
+		}
+	}
+	if end < len(ids) {
+		page.NextCursor = strconv.Itoa(end)
+	}
+	return page, nil
+}
+
+// load opens the persisted archive on first use and drops the entries of
+// feeds no longer configured. The caller must hold mu.
+func (c *Connector) load() error {
+	if c.loaded {
+		return nil
+	}
+	if c.indexDir != "" {
+		ix, err := index.Open(filepath.Join(c.indexDir, c.name+".gob"))
+		if err != nil {
+			return fmt.Errorf("open feed archive: %w", err)
+		}
+		data, err := os.ReadFile(c.statePath())
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("read feed state: %w", err)
+		}
+		feeds := map[string]feedState{}
+		if data != nil {
+			if err := json.Unmarshal(data, &feeds); err != nil {
+				return fmt.Errorf("read feed state %s: %w", c.statePath(), err)
+			}
+		}
+		c.index, c.feeds = ix, feeds
+	}
+	configured := map[string]bool{}
+	for _, u := range c.urls {
+		configured[u] = true
+	}
+	for u := range c.feeds {
+		if !configured[u] {
+			delete(c.feeds, u)
+		}
+	}
+	for _, id := range c.index.IDs(c.name) {
+		if d, _ := c.index.Get(c.name, id); !configured[d.Metadata["feed_url"]] {
+			c.index.Delete(c.name, id)
+		}
+	}
+	c.loaded = true
+	return nil
+}
+
+func (c *Connector) statePath() string {
+	return filepath.Join(c.indexDir, c.name+".json")
+}
+
+// save persists the archive and the state of the feeds. The caller must
+// hold mu.
+func (c *Connector) save() error {
+	if c.indexDir == "" {
+		return nil
+	}
+	if err := c.index.Save(); err != nil {
+		return fmt.Errorf("save feed archive: %w", err)
+	}
+	data, err := json.Marshal(c.feeds)
+	if err != nil {
+		return fmt.Errorf("save feed state: %w", err)
+	}
+	tmp := c.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("save feed state: %w", err)
+	}
+	if err := os.Rename(tmp, c.statePath()); err != nil {
+		return fmt.Errorf("save feed state: %w", err)
+	}
+	return nil
+}
+
+// fetched is the outcome of fetching one feed.
+type fetched struct {
+	url   string
+	state feedState
+	items []item
+	err   error
+}
+
+// update fetches the feeds last fetched longer than the refresh interval
+// ago, in parallel, and archives their entries. Feeds another update is
+// already fetching are left to it. It returns a warning for each feed
+// whose last fetch failed.
+func (c *Connector) update(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	if err := c.load(); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	now := c.now()
+	var due []string
+	prev := map[string]feedState{}
+	for _, u := range c.urls {
+		if f, ok := c.feeds[u]; !c.fetching[u] && (!ok || now.Sub(f.Fetched) >= c.refresh) {
+			due = append(due, u)
+			prev[u] = f
+			c.fetching[u] = true
+		}
+	}
+	c.mu.Unlock()
+
+	outcomes := make([]fetched, len(due))
+	var wg sync.WaitGroup
+	for i, u := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outcomes[i] = c.fetch(ctx, u, prev[u])
+		}()
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, u := range due {
+		delete(c.fetching, u)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, o := range outcomes {
+		state := o.state
+		state.Fetched = now
+		if o.err != nil {
+			state = c.feeds[o.url]
+			state.Fetched, state.Error = now, o.err.Error()
+		}
+		c.feeds[o.url] = state
+		for _, it := range o.items {
+			c.index.Put(c.document(o.url, state.Title, it))
+		}
+	}
+	if len(due) > 0 {
+		if err := c.save(); err != nil {
+			return nil, err
+		}
+	}
+
+	var warnings []string
+	for _, u := range c.urls {
+		if f := c.feeds[u]; f.Error != "" {
+			warnings = append(warnings, fmt.Sprintf("feed %s: %s", u, f.Error))
+		}
+	}
+	return warnings, nil
+}
+
+// fetch downloads and parses a feed, unless it is unchanged since prev was
+// fetched.
+func (c *Connector) fetch(ctx context.Context, feedURL string, prev feedState) fetched {
+	out := fetched{url: feedURL, state: prev}
+	out.state.Error = ""
+	base, err := url.Parse(feedURL)
+	if err != nil {
+		out.err = err
+		return out
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		out.err = err
+		return out
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/rdf+xml, application/xml;q=0.9, text/xml;q=0.9, */*;q=0.1")
+	if prev.ETag != "" {
+		req.Header.Set("If-None-Match", prev.ETag)
+	}
+	if prev.LastModified != "" {
+		req.Header.Set("If-Modified-Since", prev.LastModified)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		out.err = err
+		return out
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return out
+	case resp.StatusCode/100 != 2:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		out.err = fmt.Errorf("%s: %s", base.Host, resp.Status)
+		if m := strings.Join(strings.Fields(string(msg)), " "); m != "" {
+			out.err = fmt.Errorf("%w: %s", out.err, m)
+		}
+		return out
+	}
+
+	ch, err := parse(io.LimitReader(resp.Body, maxFeedSize), base)
+	if err != nil {
+		out.err = fmt.Errorf("parse: %w", err)
+		return out
+	}
+	out.items = ch.Items
+	out.state.Title = ch.Title
+	out.state.ETag = resp.Header.Get("ETag")
+	out.state.LastModified = resp.Header.Get("Last-Modified")
+	return out
+}
+
+// webURL reports whether s is an http or https address, the only links
+// results may carry: a feed could otherwise link to a javascript: URL.
+func webURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// document converts an entry to the form stored in the archive. Its ID is
+// the feed's address and the entry's ID. An entry without dates is dated
+// when it was first fetched, and one without a web link links to its
+// feed.
+func (c *Connector) document(feedURL, feedTitle string, it item) connectors.Document {
+	id := feedURL + " " + it.ID
+	r := connectors.Result{
+		Title:      it.Title,
+		URL:        it.Link,
+		Source:     c.name,
+		ID:         id,
+		CreatedAt:  it.Published,
+		ModifiedAt: it.Updated,
+		Author:     it.Author,
+		MimeType:   mimeType,
+		Metadata:   map[string]string{"feed_url": feedURL},
+	}
+	if r.Title == "" {
+		r.Title = "(Untitled)"
+	}
+	if !webURL(r.URL) {
+		r.URL = feedURL
+	}
+	if feedTitle != "" {
+		r.Metadata["feed"] = feedTitle
+	}
+	if !it.Published.IsZero() {
+		r.Metadata["published"] = it.Published.Format(time.RFC3339)
+	}
+	if !it.Updated.IsZero() {
+		r.Metadata["updated"] = it.Updated.Format(time.RFC3339)
+	}
+	if len(it.Categories) > 0 {
+		r.Metadata["categories"] = strings.Join(it.Categories, ", ")
+	}
+	if r.ModifiedAt.IsZero() {
+		r.ModifiedAt = r.CreatedAt
+	}
+	if r.ModifiedAt.IsZero() {
+		r.ModifiedAt = c.now().UTC()
+		if prev, ok := c.index.Get(c.name, id); ok {
+			r.ModifiedAt = prev.ModifiedAt
+		}
+		r.CreatedAt = r.ModifiedAt
+	}
+	return connectors.Document{Result: r, Body: it.Content}
+}
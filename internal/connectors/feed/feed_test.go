@@ -0,0 +1,350 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFeed serves an RSS feed whose items can be changed between fetches,
+// with an ETag that changes with them.
+type fakeFeed struct {
+	mu       sync.Mutex
+	items    []string
+	version  int
+	status   int
+	requests []*http.Request
+}
+
+func rssItem(guid, title, date, body string) string {
+	return fmt.Sprintf(`<item><guid>%s</guid><title>%s</title><link>/%s</link><pubDate>%s</pubDate><description>%s</description></item>`,
+		guid, title, guid, date, body)
+}
+
+func (f *fakeFeed) set(items ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items = items
+	f.version++
+}
+
+func (f *fakeFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r)
+	if f.status != 0 {
+		http.Error(w, "down for maintenance", f.status)
+		return
+	}
+	etag := fmt.Sprintf(`"v%d"`, f.version)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	fmt.Fprintf(w, `<rss version="2.0"><channel><title>Team blog</title>%s</channel></rss>`, strings.Join(f.items, ""))
+}
+
+// clock is a settable time for the connector's refresh interval.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestConnector(urls ...string) (*Connector, *clock) {
+	clk := &clock{t: time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)}
+	c := NewConnector(nil, urls...)
+	c.now = clk.now
+	return c, clk
+}
+
+func search(t *testing.T, c *Connector, q string) connectors.Page {
+	t.Helper()
+	page, err := c.Search(context.Background(), connectors.Request{Query: q})
+	require.NoError(t, err)
+	return page
+}
+
+func titles(page connectors.Page) []string {
+	var titles []string
+	for _, r := range page.Results {
+		titles = append(titles, r.Title)
+	}
+	return titles
+}
+
+func TestConnector_Name(t *testing.T) {
+	assert.Equal(t, "feed", NewConnector(nil).Name())
+	assert.Equal(t, "blogs", NewConnector(nil).WithName("blogs").Name())
+}
+
+func TestConnector_Search(t *testing.T) {
+	f := &fakeFeed{}
+	f.set(
+		rssItem("queue", "Scaling the queue", "Tue, 05 Mar 2024 09:30:00 +0000", "We moved the queue to partitions."),
+		rssItem("dns", "DNS postmortem", "Fri, 08 Mar 2024 10:00:00 +0000", "Resolvers timed out."),
+	)
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c, _ := newTestConnector(srv.URL + "/feed.xml")
+	c.WithName("blogs")
+
+	page := search(t, c, "partitions")
+
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, connectors.Result{
+		Title:      "Scaling the queue",
+		Snippet:    "We moved the queue to partitions.",
+		URL:        srv.URL + "/queue",
+		Source:     "blogs",
+		ID:         srv.URL + "/feed.xml queue",
+		CreatedAt:  time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC),
+		ModifiedAt: time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC),
+		MimeType:   "application/atom+xml;type=entry",
+		Metadata: map[string]string{
+			"feed":      "Team blog",
+			"feed_url":  srv.URL + "/feed.xml",
+			"published": "2024-03-05T09:30:00Z",
+		},
+	}, page.Results[0])
+	assert.Empty(t, page.Warnings)
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"type:article", []string{"DNS postmortem", "Scaling the queue"}},
+		{"after:2024-03-06", []string{"DNS postmortem"}},
+		{"title:queue", []string{"Scaling the queue"}},
+		{"type:email", nil},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			assert.Equal(t, tc.want, titles(search(t, c, tc.query)))
+		})
+	}
+}
+
+func TestConnector_Search_KeepsOldEntries(t *testing.T) {
+	f := &fakeFeed{}
+	f.set(rssItem("one", "First post", "Mon, 04 Mar 2024 09:00:00 +0000", "Hello"))
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	dir := t.TempDir()
+	c, clk := newTestConnector(srv.URL)
+	c.WithIndexDir(dir)
+
+	assert.Equal(t, []string{"First post"}, titles(search(t, c, "")))
+
+	f.set(rssItem("two", "Second post", "Tue, 05 Mar 2024 09:00:00 +0000", "Hello again"))
+	assert.Equal(t, []string{"First post"}, titles(search(t, c, "")), "the feed is not fetched again before the refresh interval")
+
+	clk.t = clk.t.Add(DefaultRefresh)
+	assert.Equal(t, []string{"Second post", "First post"}, titles(search(t, c, "")), "entries that dropped off the feed stay searchable")
+
+	reopened, _ := newTestConnector(srv.URL)
+	reopened.now = clk.now
+	reopened.WithIndexDir(dir)
+	assert.Equal(t, []string{"Second post", "First post"}, titles(search(t, reopened, "")))
+	assert.Len(t, f.requests, 2, "the archive and the time of the last fetch are persisted")
+}
+
+func TestConnector_Search_ConditionalFetch(t *testing.T) {
+	f := &fakeFeed{}
+	f.set(rssItem("one", "First post", "Mon, 04 Mar 2024 09:00:00 +0000", "Hello"))
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c, clk := newTestConnector(srv.URL)
+
+	search(t, c, "")
+	clk.t = clk.t.Add(2 * DefaultRefresh)
+	page := search(t, c, "")
+
+	require.Len(t, f.requests, 2)
+	assert.Equal(t, `"v1"`, f.requests[1].Header.Get("If-None-Match"))
+	assert.Equal(t, []string{"First post"}, titles(page), "an unchanged feed keeps its entries")
+	assert.Equal(t, "Team blog", page.Results[0].Metadata["feed"])
+}
+
+func TestConnector_Search_FailingFeeds(t *testing.T) {
+	f := &fakeFeed{}
+	f.set(rssItem("one", "First post", "Mon, 04 Mar 2024 09:00:00 +0000", "Hello"))
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	notFeed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>Moved</body></html>")
+	}))
+	defer notFeed.Close()
+	c, clk := newTestConnector(srv.URL, notFeed.URL)
+	search(t, c, "")
+
+	f.mu.Lock()
+	f.status = http.StatusServiceUnavailable
+	f.mu.Unlock()
+	clk.t = clk.t.Add(DefaultRefresh)
+	page := search(t, c, "")
+
+	assert.Equal(t, []string{"First post"}, titles(page), "the archive is searched while the feed is down")
+	host := strings.TrimPrefix(srv.URL, "http://")
+	assert.Equal(t, []string{
+		"feed " + srv.URL + ": " + host + ": 503 Service Unavailable: down for maintenance",
+		"feed " + notFeed.URL + ": parse: not an RSS or Atom feed: root element is <html>",
+	}, page.Warnings)
+
+	f.mu.Lock()
+	f.status = 0
+	f.mu.Unlock()
+	clk.t = clk.t.Add(DefaultRefresh)
+	assert.Len(t, search(t, c, "").Warnings, 1, "a feed that recovers is no longer reported")
+}
+
+func TestConnector_Search_DropsUnconfiguredFeeds(t *testing.T) {
+	a, b := &fakeFeed{}, &fakeFeed{}
+	a.set(rssItem("a", "From A", "Mon, 04 Mar 2024 09:00:00 +0000", "Hello"))
+	b.set(rssItem("b", "From B", "Mon, 04 Mar 2024 09:00:00 +0000", "Hello"))
+	srvA, srvB := httptest.NewServer(a), httptest.NewServer(b)
+	defer srvA.Close()
+	defer srvB.Close()
+	dir := t.TempDir()
+	c, _ := newTestConnector(srvA.URL, srvB.URL)
+	c.WithIndexDir(dir)
+	assert.ElementsMatch(t, []string{"From A", "From B"}, titles(search(t, c, "")))
+
+	c, _ = newTestConnector(srvA.URL)
+	c.WithIndexDir(dir)
+	assert.Equal(t, []string{"From A"}, titles(search(t, c, "")))
+}
+
+func TestConnector_Search_Paging(t *testing.T) {
+	f := &fakeFeed{}
+	var items []string
+	for i := range 25 {
+		items = append(items, rssItem(fmt.Sprint(i), fmt.Sprintf("Post %d", i), time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC).Format(time.RFC1123Z), "news"))
+	}
+	f.set(items...)
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c, _ := newTestConnector(srv.URL)
+
+	page := search(t, c, "news")
+	assert.Len(t, page.Results, 20)
+	assert.Equal(t, "20", page.NextCursor)
+
+	page, err := c.Search(context.Background(), connectors.Request{Query: "news", Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Len(t, page.Results, 5)
+	assert.Empty(t, page.NextCursor)
+
+	_, err = c.Search(context.Background(), connectors.Request{Query: "news", Cursor: "x"})
+	assert.EqualError(t, err, `invalid feed cursor "x"`)
+}
+
+func TestConnector_Search_NonWebLinks(t *testing.T) {
+	f := &fakeFeed{}
+	f.set(`<item><guid>x</guid><title>Click me</title><link>javascript:alert(1)</link></item>`)
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c, _ := newTestConnector(srv.URL + "/feed.xml")
+
+	page := search(t, c, "")
+
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, srv.URL+"/feed.xml", page.Results[0].URL, "only web links are kept")
+}
+
+func TestConnector_Search_DoesNotWaitForOtherFetches(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		fmt.Fprint(w, `<rss version="2.0"><channel><title>Slow</title></channel></rss>`)
+	}))
+	defer slow.Close()
+	c, _ := newTestConnector(slow.URL)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		search(t, c, "")
+	}()
+	<-entered
+	page := search(t, c, "")
+	close(release)
+	<-done
+
+	assert.Empty(t, page.Results)
+	assert.Empty(t, page.Warnings, "a feed being fetched is left to that fetch")
+}
+
+func TestConnector_Crawl(t *testing.T) {
+	f := &fakeFeed{}
+	f.set(rssItem("one", "First post", "Mon, 04 Mar 2024 09:00:00 +0000", "Hello"))
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c, clk := newTestConnector(srv.URL)
+
+	page, err := c.Crawl(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 1)
+	assert.Equal(t, "First post", page.Documents[0].Title)
+	assert.Equal(t, "Hello", page.Documents[0].Body)
+	assert.Empty(t, page.NextCursor)
+
+	f.set(rssItem("two", "Second post", "Tue, 05 Mar 2024 09:00:00 +0000", "Hello again"))
+	clk.t = clk.t.Add(DefaultRefresh)
+	page, err = c.Crawl(context.Background(), "")
+	require.NoError(t, err)
+	var got []string
+	for _, d := range page.Documents {
+		got = append(got, d.Title)
+	}
+	assert.ElementsMatch(t, []string{"First post", "Second post"}, got, "a crawl fetches the feeds that are due and lists the whole archive")
+	assert.Len(t, f.requests, 2)
+
+	_, err = c.Crawl(context.Background(), "x")
+	assert.EqualError(t, err, `feed crawl: invalid cursor "x"`)
+}
+
+func TestConnector_Crawl_Paging(t *testing.T) {
+	f := &fakeFeed{}
+	var items []string
+	for i := range crawlPageSize + 5 {
+		items = append(items, rssItem(fmt.Sprint(i), fmt.Sprintf("Post %d", i), "Mon, 04 Mar 2024 09:00:00 +0000", "news"))
+	}
+	f.set(items...)
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	c, _ := newTestConnector(srv.URL)
+
+	page, err := c.Crawl(context.Background(), "")
+	require.NoError(t, err)
+	assert.Len(t, page.Documents, crawlPageSize)
+	assert.Equal(t, fmt.Sprint(crawlPageSize), page.NextCursor)
+
+	page, err = c.Crawl(context.Background(), page.NextCursor)
+	require.NoError(t, err)
+	assert.Len(t, page.Documents, 5)
+	assert.Empty(t, page.NextCursor)
+	assert.Len(t, f.requests, 1, "only the first page refreshes the feeds")
+}
+
+func TestConnector_Explain(t *testing.T) {
+	c := NewConnector(nil, "https://a.example.com/feed", "https://b.example.com/atom").WithRefresh(30 * time.Minute)
+
+	exp, err := c.Explain(connectors.Request{Query: "scaling queues type:article"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "scale queue", exp.Query)
+	assert.Equal(t, map[string]string{
+		"feeds":   "https://a.example.com/feed,https://b.example.com/atom",
+		"refresh": "30m0s",
+		"limit":   "20",
+	}, exp.Params)
+}
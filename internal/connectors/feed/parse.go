@@ -0,0 +1,261 @@
+package feed
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/email"
+	"golang.org/x/net/html/charset"
+)
+
+// channel is a feed as parsed, in any of the formats.
+type channel struct {
+	Title string
+	Items []item
+}
+
+// item is an entry of a feed.
+type item struct {
+	// ID is the entry's GUID or Atom ID, or else its link or title.
+	ID         string
+	Title      string
+	Link       string
+	Author     string
+	Published  time.Time
+	Updated    time.Time
+	Categories []string
+	// Content is the text of the entry's full content, or else of its
+	// summary.
+	Content string
+}
+
+var errNotFeed = errors.New("not an RSS or Atom feed")
+
+// xmlFeed covers the root elements of the three formats: RSS 2.0's rss,
+// with the items in a channel; RSS 1.0's RDF, with them beside it; and
+// Atom's feed, with entries.
+type xmlFeed struct {
+	XMLName xml.Name
+	Channel struct {
+		Title xmlText   `xml:"title"`
+		Items []xmlItem `xml:"item"`
+	} `xml:"channel"`
+	Title   xmlText   `xml:"title"`
+	Items   []xmlItem `xml:"item"`
+	Entries []xmlItem `xml:"entry"`
+}
+
+type xmlItem struct {
+	Title       xmlText       `xml:"title"`
+	Links       []xmlLink     `xml:"link"`
+	GUID        string        `xml:"guid"`
+	ID          string        `xml:"id"`
+	About       string        `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Description string        `xml:"description"`
+	Encoded     string        `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Summary     xmlText       `xml:"summary"`
+	Content     xmlText       `xml:"content"`
+	PubDate     string        `xml:"pubDate"`
+	Published   string        `xml:"published"`
+	Updated     string        `xml:"updated"`
+	Date        string        `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Authors     []xmlAuthor   `xml:"author"`
+	Creators    []string      `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []xmlCategory `xml:"category"`
+}
+
+// xmlText is an Atom text construct, whose type says whether it holds
+// plain text, escaped HTML or inline XHTML. RSS elements decode to plain
+// text.
+type xmlText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// text returns the construct as plain text.
+func (t xmlText) text() string {
+	switch t.Type {
+	case "html":
+		return email.HTMLText(t.Text)
+	case "xhtml":
+		return email.HTMLText(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// xmlLink is an RSS link, which holds its address, or an Atom link, which
+// has it in href.
+type xmlLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Text string `xml:",chardata"`
+}
+
+// xmlAuthor is an RSS author, an address and perhaps a name, or an Atom
+// person.
+type xmlAuthor struct {
+	Name string `xml:"name"`
+	Text string `xml:",chardata"`
+}
+
+// xmlCategory is an RSS category, or an Atom one named by its term.
+type xmlCategory struct {
+	Term string `xml:"term,attr"`
+	Text string `xml:",chardata"`
+}
+
+// parse reads an RSS 2.0, RSS 1.0 or Atom document. Relative links are
+// resolved against base, the feed's address.
+func parse(r io.Reader, base *url.URL) (channel, error) {
+	d := xml.NewDecoder(r)
+	// Feeds in the wild are often not quite XML: HTML entities and stray
+	// ampersands are common.
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	d.CharsetReader = charset.NewReaderLabel
+	var f xmlFeed
+	if err := d.Decode(&f); err != nil {
+		return channel{}, err
+	}
+
+	var ch channel
+	var items []xmlItem
+	switch strings.ToLower(f.XMLName.Local) {
+	case "rss":
+		ch.Title, items = f.Channel.Title.text(), f.Channel.Items
+	case "rdf":
+		ch.Title, items = f.Channel.Title.text(), f.Items
+	case "feed":
+		ch.Title, items = f.Title.text(), f.Entries
+	default:
+		return channel{}, fmt.Errorf("%w: root element is <%s>", errNotFeed, f.XMLName.Local)
+	}
+	for _, x := range items {
+		ch.Items = append(ch.Items, x.item(base))
+	}
+	return ch, nil
+}
+
+func (x xmlItem) item(base *url.URL) item {
+	it := item{
+		Title:     x.Title.text(),
+		Link:      resolve(base, x.link()),
+		Published: firstDate(x.Published, x.PubDate, x.Date),
+		Updated:   parseDate(x.Updated),
+	}
+	it.ID = firstNonEmpty(strings.TrimSpace(x.GUID), strings.TrimSpace(x.ID), x.About, it.Link, it.Title)
+	if it.Published.IsZero() {
+		it.Published = it.Updated
+	}
+	switch {
+	case x.Encoded != "":
+		it.Content = email.HTMLText(x.Encoded)
+	case x.Content.Text != "" || x.Content.Inner != "":
+		it.Content = x.Content.text()
+	case x.Description != "":
+		it.Content = email.HTMLText(x.Description)
+	default:
+		it.Content = x.Summary.text()
+	}
+	var authors []string
+	for _, a := range x.Authors {
+		if name := firstNonEmpty(strings.TrimSpace(a.Name), strings.TrimSpace(a.Text)); name != "" {
+			authors = append(authors, name)
+		}
+	}
+	for _, c := range x.Creators {
+		if c = strings.TrimSpace(c); c != "" {
+			authors = append(authors, c)
+		}
+	}
+	it.Author = strings.Join(authors, ", ")
+	for _, c := range x.Categories {
+		if name := firstNonEmpty(strings.TrimSpace(c.Term), strings.TrimSpace(c.Text)); name != "" {
+			it.Categories = append(it.Categories, name)
+		}
+	}
+	return it
+}
+
+// link returns the address of the page the entry is about: an Atom
+// alternate link or, in RSS, the link's text.
+func (x xmlItem) link() string {
+	for _, l := range x.Links {
+		if l.Href != "" && (l.Rel == "" || l.Rel == "alternate") {
+			return strings.TrimSpace(l.Href)
+		}
+		if l.Href == "" && strings.TrimSpace(l.Text) != "" {
+			return strings.TrimSpace(l.Text)
+		}
+	}
+	return ""
+}
+
+func resolve(base *url.URL, ref string) string {
+	if ref == "" || base == nil {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// dateLayouts are the date formats found in feeds: RSS's RFC 822 dates,
+// with and without the weekday, seconds and two-digit days, and Atom's and
+// Dublin Core's RFC 3339 ones.
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 06 15:04:05 -0700",
+	"Mon, 2 Jan 06 15:04:05 MST",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	time.DateOnly,
+}
+
+// parseDate parses a date in any of dateLayouts, returning the zero time
+// for one it cannot read.
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+func firstDate(values ...string) time.Time {
+	for _, v := range values {
+		if t := parseDate(v); !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package feed
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testBase, _ = url.Parse("https://blog.example.com/feed.xml")
+
+const rss2 = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+  <title>Example Engineering</title>
+  <link>https://blog.example.com/</link>
+  <item>
+    <title>Scaling the &amp; queue</title>
+    <link>/posts/queue</link>
+    <guid isPermaLink="false">post-42</guid>
+    <pubDate>Tue, 5 Mar 2024 09:30:00 +0100</pubDate>
+    <dc:creator>Alice Example</dc:creator>
+    <category>infra</category>
+    <category>queues</category>
+    <description>Short summary</description>
+    <content:encoded><![CDATA[<p>We moved the <b>queue</b> to&nbsp;partitions.</p><p>It worked.</p>]]></content:encoded>
+  </item>
+  <item>
+    <title>No content</title>
+    <link>https://blog.example.com/posts/short</link>
+    <description>&lt;p&gt;Just a description&lt;/p&gt;</description>
+    <pubDate>Wed, 06 Mar 2024 10:00:00 GMT</pubDate>
+    <author>bob@example.com (Bob)</author>
+  </item>
+</channel>
+</rss>`
+
+func TestParse_RSS2(t *testing.T) {
+	ch, err := parse(strings.NewReader(rss2), testBase)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Example Engineering", ch.Title)
+	require.Len(t, ch.Items, 2)
+	assert.Equal(t, item{
+		ID:         "post-42",
+		Title:      "Scaling the & queue",
+		Link:       "https://blog.example.com/posts/queue",
+		Author:     "Alice Example",
+		Published:  time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC),
+		Categories: []string{"infra", "queues"},
+		Content:    "We moved the queue to partitions.\nIt worked.",
+	}, ch.Items[0])
+	assert.Equal(t, "https://blog.example.com/posts/short", ch.Items[1].ID, "the link stands in for a missing guid")
+	assert.Equal(t, "Just a description", ch.Items[1].Content)
+	assert.Equal(t, "bob@example.com (Bob)", ch.Items[1].Author)
+	assert.Equal(t, time.Date(2024, 3, 6, 10, 0, 0, 0, time.UTC), ch.Items[1].Published)
+}
+
+func TestParse_RSS1(t *testing.T) {
+	src := `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel rdf:about="https://changes.example.org/"><title>Changelog</title></channel>
+  <item rdf:about="https://changes.example.org/1.2">
+    <title>Release 1.2</title>
+    <link>https://changes.example.org/1.2</link>
+    <description>Adds exports.</description>
+    <dc:date>2024-02-01T12:00:00Z</dc:date>
+  </item>
+</rdf:RDF>`
+
+	ch, err := parse(strings.NewReader(src), testBase)
+
+	require.NoError(t, err)
+	assert.Equal(t, channel{Title: "Changelog", Items: []item{{
+		ID:        "https://changes.example.org/1.2",
+		Title:     "Release 1.2",
+		Link:      "https://changes.example.org/1.2",
+		Published: time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC),
+		Content:   "Adds exports.",
+	}}}, ch)
+}
+
+func TestParse_Atom(t *testing.T) {
+	src := `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title type="html">Ops &lt;b&gt;notes&lt;/b&gt;</title>
+  <entry>
+    <title>Postmortem: DNS</title>
+    <id>tag:ops.example.net,2024:1</id>
+    <link rel="self" href="https://ops.example.net/1.atom"/>
+    <link href="https://ops.example.net/1"/>
+    <published>2024-01-10T08:00:00-05:00</published>
+    <updated>2024-01-12T09:00:00Z</updated>
+    <author><name>Carol</name></author>
+    <category term="incident"/>
+    <summary>Summary only</summary>
+    <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Resolvers timed out.</p></div></content>
+  </entry>
+  <entry>
+    <title>Draft</title>
+    <id>tag:ops.example.net,2024:2</id>
+    <updated>2024-01-13T00:00:00Z</updated>
+    <summary type="html">&lt;p&gt;Only a summary&lt;/p&gt;</summary>
+  </entry>
+</feed>`
+
+	ch, err := parse(strings.NewReader(src), testBase)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Ops notes", ch.Title)
+	require.Len(t, ch.Items, 2)
+	assert.Equal(t, item{
+		ID:         "tag:ops.example.net,2024:1",
+		Title:      "Postmortem: DNS",
+		Link:       "https://ops.example.net/1",
+		Author:     "Carol",
+		Published:  time.Date(2024, 1, 10, 13, 0, 0, 0, time.UTC),
+		Updated:    time.Date(2024, 1, 12, 9, 0, 0, 0, time.UTC),
+		Categories: []string{"incident"},
+		Content:    "Resolvers timed out.",
+	}, ch.Items[0])
+	assert.Equal(t, "Only a summary", ch.Items[1].Content)
+	assert.Equal(t, ch.Items[1].Updated, ch.Items[1].Published, "entries without a publication date are dated by their update")
+}
+
+func TestParse_Charset(t *testing.T) {
+	src := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rss><channel><title>Caf\xe9</title></channel></rss>"
+
+	ch, err := parse(strings.NewReader(src), testBase)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Café", ch.Title)
+}
+
+func TestParse_NotAFeed(t *testing.T) {
+	_, err := parse(strings.NewReader("<html><body>Moved</body></html>"), testBase)
+	assert.EqualError(t, err, "not an RSS or Atom feed: root element is <html>")
+
+	_, err = parse(strings.NewReader(""), testBase)
+	assert.Error(t, err)
+}
+
+func TestParseDate(t *testing.T) {
+	for _, s := range []string{
+		"Tue, 05 Mar 2024 09:30:00 +0100",
+		"Tue, 5 Mar 2024 09:30:00 +0100",
+		"Tue, 5 Mar 2024 08:30:00 GMT",
+		"5 Mar 2024 09:30:00 +0100",
+		"Tue, 5 Mar 24 09:30:00 +0100",
+		"Tue, 5 Mar 2024 09:30 +0100",
+		"2024-03-05T09:30:00+01:00",
+		"2024-03-05T08:30:00.000Z",
+		"2024-03-05T08:30:00",
+	} {
+		assert.Equal(t, time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC), parseDate(s), s)
+	}
+	assert.Equal(t, time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), parseDate("2024-03-05"))
+	assert.True(t, parseDate("last Tuesday").IsZero())
+}
@@ -0,0 +1,212 @@
+package gcal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+	"golang.org/x/oauth2"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// ErrScopeNotGranted is wrapped by errors for calls the OAuth token may not
+// make because it predates Calendar support.
+var ErrScopeNotGranted = errors.New("the OAuth token does not grant Calendar access; run pkb auth to add it")
+
+// APIClient implements CalendarClient using the real Calendar API.
+type APIClient struct {
+	service *calendar.Service
+}
+
+// createCalendarService creates a Calendar API service. Overridden in
+// tests.
+var createCalendarService = func(ctx context.Context, opts ...option.ClientOption) (*calendar.Service, error) {
+	return calendar.NewService(ctx, opts...)
+}
+
+// NewAPIClient creates a real Calendar API client using the given OAuth2
+// token source.
+func NewAPIClient(ctx context.Context, tokenSource oauth2.TokenSource) (*APIClient, error) {
+	srv, err := createCalendarService(ctx, option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, fmt.Errorf("create calendar service: %w", err)
+	}
+	return &APIClient{service: srv}, nil
+}
+
+// buildEventsQuery translates a pkb query into events.list parameters.
+// Free text and from: become the q parameter, which matches organizers and
+// attendees as well as the event's text. Dates bound the event's time
+// rather than when it was edited: after:D finds events still going on or
+// starting from D, before:D those that started before it. Warnings list
+// the clauses that are ignored. ok is false when the query can never match
+// an event (e.g. type:pdf), so the API need not be called.
+func buildEventsQuery(q query.Query) (eq EventsQuery, warnings []string, ok bool) {
+	var terms []string
+	for _, c := range q.Clauses {
+		switch c.Field {
+		case query.FieldText, query.FieldFrom:
+			if c.Negated {
+				warnings = append(warnings, query.Unsupported(c))
+				continue
+			}
+			term := c.Value
+			if c.Phrase {
+				term = `"` + term + `"`
+			}
+			terms = append(terms, term)
+		case query.FieldAfter:
+			if d := c.Date(); d.After(eq.TimeMin) {
+				eq.TimeMin = d
+			}
+		case query.FieldBefore:
+			if d := c.Date(); eq.TimeMax.IsZero() || d.Before(eq.TimeMax) {
+				eq.TimeMax = d
+			}
+		case query.FieldType:
+			// Every Calendar result is an event, so type: either matches
+			// everything or nothing.
+			if query.MatchesMIMEType(c.Value, mimeTypeEvent) == c.Negated {
+				return EventsQuery{}, nil, false
+			}
+		case query.FieldTitle:
+			warnings = append(warnings, query.Unsupported(c))
+		}
+		// source: is resolved by the search engine.
+	}
+	eq.Query = strings.Join(terms, " ")
+	return eq, warnings, true
+}
+
+// singleEvents reports whether recurring events are expanded into their
+// instances. That is only done within a time range: otherwise a weekly
+// meeting would fill the results with its occurrences, and the recurring
+// event is listed once instead.
+func (eq EventsQuery) singleEvents() bool {
+	return !eq.TimeMin.IsZero() || !eq.TimeMax.IsZero()
+}
+
+// Page size bounds for events.list, which accepts up to 2500 events.
+const (
+	defaultMaxResults = 20
+	maxMaxResults     = 2500
+)
+
+// maxResults clamps a requested result limit to what events.list accepts,
+// using defaultMaxResults when no limit is given.
+func maxResults(limit int) int64 {
+	switch {
+	case limit <= 0:
+		return defaultMaxResults
+	case limit > maxMaxResults:
+		return maxMaxResults
+	}
+	return int64(limit)
+}
+
+func (c *APIClient) ListEvents(ctx context.Context, calendarID string, q EventsQuery) ([]Event, string, error) {
+	call := c.service.Events.List(calendarID).
+		MaxResults(maxResults(q.Limit)).
+		SingleEvents(q.singleEvents()).
+		Context(ctx)
+	if q.Query != "" {
+		call = call.Q(q.Query)
+	}
+	if q.singleEvents() {
+		call = call.OrderBy("startTime")
+	}
+	if !q.TimeMin.IsZero() {
+		call = call.TimeMin(q.TimeMin.Format(time.RFC3339))
+	}
+	if !q.TimeMax.IsZero() {
+		call = call.TimeMax(q.TimeMax.Format(time.RFC3339))
+	}
+	if q.PageToken != "" {
+		call = call.PageToken(q.PageToken)
+	}
+
+	resp, err := call.Do()
+	if err != nil {
+		if insufficientScope(err) {
+			return nil, "", fmt.Errorf("calendar events.list: %w", ErrScopeNotGranted)
+		}
+		return nil, "", fmt.Errorf("calendar events.list: %w", err)
+	}
+
+	events := make([]Event, 0, len(resp.Items))
+	for _, item := range resp.Items {
+		if item.Status == "cancelled" {
+			continue
+		}
+		events = append(events, toEvent(calendarID, item))
+	}
+	return events, resp.NextPageToken, nil
+}
+
+// insufficientScope reports whether err is Google refusing a call because
+// the token lacks the scope for it.
+func insufficientScope(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return false
+	}
+	for _, e := range apiErr.Errors {
+		if e.Reason == "insufficientPermissions" {
+			return true
+		}
+	}
+	return strings.Contains(apiErr.Message, "insufficient authentication scopes")
+}
+
+func toEvent(calendarID string, item *calendar.Event) Event {
+	e := Event{
+		ID:          item.Id,
+		CalendarID:  calendarID,
+		Summary:     item.Summary,
+		Description: item.Description,
+		Location:    item.Location,
+		HTMLLink:    item.HtmlLink,
+		MeetLink:    item.HangoutLink,
+		Created:     parseTime(item.Created),
+		Updated:     parseTime(item.Updated),
+	}
+	e.Start, e.AllDay = eventTime(item.Start)
+	e.End, _ = eventTime(item.End)
+	if item.Organizer != nil {
+		e.Organizer = item.Organizer.Email
+	}
+	for _, a := range item.Attendees {
+		if a.Resource {
+			continue // rooms are in Location
+		}
+		e.Attendees = append(e.Attendees, Attendee{Email: a.Email, Name: a.DisplayName, Response: a.ResponseStatus})
+	}
+	for _, a := range item.Attachments {
+		e.Attachments = append(e.Attachments, Attachment{Title: a.Title, FileURL: a.FileUrl})
+	}
+	return e
+}
+
+// eventTime returns the time of an event's start or end, and whether it is
+// a date rather than a time, as for all-day events.
+func eventTime(t *calendar.EventDateTime) (time.Time, bool) {
+	if t == nil {
+		return time.Time{}, false
+	}
+	if t.DateTime == "" && t.Date != "" {
+		d, _ := time.Parse(time.DateOnly, t.Date)
+		return d, true
+	}
+	return parseTime(t.DateTime), false
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
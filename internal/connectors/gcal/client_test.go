@@ -0,0 +1,215 @@
+package gcal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+func TestBuildEventsQuery_Operators(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    string
+		timeMin string
+		timeMax string
+	}{
+		{`budget "quarterly review"`, `budget "quarterly review"`, "", ""},
+		{`from:alice@example.com sync`, `alice@example.com sync`, "", ""},
+		{`type:event standup`, `standup`, "", ""},
+		{`-type:pdf standup`, `standup`, "", ""},
+		{`source:calendar standup`, `standup`, "", ""},
+		{`after:2024-03-01 before:2024-04-01`, ``, "2024-03-01", "2024-04-01"},
+		{`after:2024-03-01 after:2024-03-10 before:2024-05-01 before:2024-04-01`, ``, "2024-03-10", "2024-04-01"},
+	}
+	for _, tt := range tests {
+		q, err := query.Parse(tt.query)
+		require.NoError(t, err)
+		eq, warnings, ok := buildEventsQuery(q)
+		assert.True(t, ok, tt.query)
+		assert.Empty(t, warnings, tt.query)
+		assert.Equal(t, tt.want, eq.Query, tt.query)
+		assert.Equal(t, tt.timeMin, formatDate(eq.TimeMin), tt.query)
+		assert.Equal(t, tt.timeMax, formatDate(eq.TimeMax), tt.query)
+	}
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
+
+func TestBuildEventsQuery_Unsupported(t *testing.T) {
+	q, err := query.Parse(`standup -cancelled -from:bob title:weekly`)
+	require.NoError(t, err)
+	eq, warnings, ok := buildEventsQuery(q)
+	assert.True(t, ok)
+	assert.Equal(t, "standup", eq.Query)
+	assert.Len(t, warnings, 3)
+
+	for _, s := range []string{"type:pdf notes", "-type:event"} {
+		q, err := query.Parse(s)
+		require.NoError(t, err)
+		_, _, ok := buildEventsQuery(q)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestNewAPIClient_ServiceError(t *testing.T) {
+	orig := createCalendarService
+	createCalendarService = func(_ context.Context, _ ...option.ClientOption) (*calendar.Service, error) {
+		return nil, fmt.Errorf("service creation failed")
+	}
+	t.Cleanup(func() { createCalendarService = orig })
+
+	_, err := NewAPIClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"}))
+	assert.ErrorContains(t, err, "create calendar service")
+}
+
+// newTestClient returns an APIClient whose requests go to handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *APIClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client, err := NewAPIClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"}))
+	require.NoError(t, err)
+	client.service.BasePath = srv.URL + "/"
+	return client
+}
+
+func TestListEvents_Success(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/calendars/team@example.com/events", r.URL.Path)
+		assert.Equal(t, "planning", r.URL.Query().Get("q"))
+		assert.Equal(t, "5", r.URL.Query().Get("maxResults"))
+		assert.Equal(t, "false", r.URL.Query().Get("singleEvents"))
+		assert.Empty(t, r.URL.Query().Get("orderBy"))
+		assert.Equal(t, "tok-1", r.URL.Query().Get("pageToken"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"nextPageToken": "tok-2",
+			"items": [
+				{
+					"id": "ev1",
+					"status": "confirmed",
+					"htmlLink": "https://www.google.com/calendar/event?eid=ZXYx",
+					"created": "2024-02-20T10:00:00Z",
+					"updated": "2024-02-21T10:00:00Z",
+					"summary": "Q2 planning",
+					"description": "Agenda: budget, hiring",
+					"location": "Room 4",
+					"hangoutLink": "https://meet.google.com/abc-defg-hij",
+					"organizer": {"email": "alice@example.com"},
+					"start": {"dateTime": "2024-03-05T10:00:00+01:00"},
+					"end": {"dateTime": "2024-03-05T11:00:00+01:00"},
+					"attendees": [
+						{"email": "alice@example.com", "displayName": "Alice", "organizer": true, "responseStatus": "accepted"},
+						{"email": "bob@example.com", "responseStatus": "tentative"},
+						{"email": "room4@resource.calendar.google.com", "resource": true, "responseStatus": "accepted"}
+					],
+					"attachments": [
+						{"fileUrl": "https://docs.google.com/document/d/doc1", "title": "Q2 plan", "mimeType": "application/vnd.google-apps.document"}
+					]
+				},
+				{"id": "ev2", "status": "cancelled"},
+				{
+					"id": "ev3",
+					"summary": "Offsite",
+					"start": {"date": "2024-04-10"},
+					"end": {"date": "2024-04-12"}
+				}
+			]
+		}`)
+	})
+
+	events, next, err := client.ListEvents(context.Background(), "team@example.com", EventsQuery{Query: "planning", Limit: 5, PageToken: "tok-1"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "tok-2", next)
+	require.Len(t, events, 2)
+	cet := time.FixedZone("", 3600)
+	assert.Equal(t, Event{
+		ID:          "ev1",
+		CalendarID:  "team@example.com",
+		Summary:     "Q2 planning",
+		Description: "Agenda: budget, hiring",
+		Location:    "Room 4",
+		Start:       time.Date(2024, 3, 5, 10, 0, 0, 0, cet),
+		End:         time.Date(2024, 3, 5, 11, 0, 0, 0, cet),
+		Organizer:   "alice@example.com",
+		Attendees: []Attendee{
+			{Email: "alice@example.com", Name: "Alice", Response: "accepted"},
+			{Email: "bob@example.com", Response: "tentative"},
+		},
+		Attachments: []Attachment{{Title: "Q2 plan", FileURL: "https://docs.google.com/document/d/doc1"}},
+		HTMLLink:    "https://www.google.com/calendar/event?eid=ZXYx",
+		MeetLink:    "https://meet.google.com/abc-defg-hij",
+		Created:     time.Date(2024, 2, 20, 10, 0, 0, 0, time.UTC),
+		Updated:     time.Date(2024, 2, 21, 10, 0, 0, 0, time.UTC),
+	}, events[0])
+	assert.True(t, events[1].AllDay)
+	assert.Equal(t, time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC), events[1].Start)
+	assert.Equal(t, time.Date(2024, 4, 12, 0, 0, 0, 0, time.UTC), events[1].End)
+}
+
+func TestListEvents_TimeRangeExpandsRecurringEvents(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/calendars/primary/events", r.URL.Path)
+		assert.Empty(t, r.URL.Query().Get("q"))
+		assert.Equal(t, "true", r.URL.Query().Get("singleEvents"))
+		assert.Equal(t, "startTime", r.URL.Query().Get("orderBy"))
+		assert.Equal(t, "2024-03-01T00:00:00Z", r.URL.Query().Get("timeMin"))
+		assert.Equal(t, "2024-04-01T00:00:00Z", r.URL.Query().Get("timeMax"))
+		assert.Equal(t, "20", r.URL.Query().Get("maxResults"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"items": []}`)
+	})
+
+	events, next, err := client.ListEvents(context.Background(), "primary", EventsQuery{
+		TimeMin: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		TimeMax: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	assert.Empty(t, next)
+}
+
+func TestListEvents_InsufficientScope(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"error": {"code": 403, "message": "Request had insufficient authentication scopes.",
+			"errors": [{"message": "Insufficient Permission", "domain": "global", "reason": "insufficientPermissions"}]}}`)
+	})
+
+	_, _, err := client.ListEvents(context.Background(), "primary", EventsQuery{Query: "x"})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrScopeNotGranted))
+	assert.Contains(t, err.Error(), "run pkb auth")
+}
+
+func TestListEvents_APIError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": {"code": 404, "message": "Not Found"}}`)
+	})
+
+	_, _, err := client.ListEvents(context.Background(), "nobody@example.com", EventsQuery{Query: "x"})
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, ErrScopeNotGranted))
+	assert.Contains(t, err.Error(), "calendar events.list")
+	assert.Contains(t, err.Error(), "Not Found")
+}
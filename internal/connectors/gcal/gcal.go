@@ -0,0 +1,303 @@
+// Package gcal searches Google Calendar events with the Calendar API, using
+// the same OAuth token as Drive and Gmail.
+package gcal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+// mimeTypeEvent is the MIME type of every Calendar result.
+const mimeTypeEvent = "text/calendar"
+
+// primaryCalendar is the calendar searched when none are configured.
+const primaryCalendar = "primary"
+
+// Event is a Google Calendar event.
+type Event struct {
+	ID          string
+	CalendarID  string
+	Summary     string
+	Description string
+	Location    string
+	// Start and End bound the event. For all-day events they are dates at
+	// midnight UTC and End is exclusive, as in the API.
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Organizer   string
+	Attendees   []Attendee
+	Attachments []Attachment
+	HTMLLink    string
+	// MeetLink is the event's Google Meet link, if it has one.
+	MeetLink string
+	Created  time.Time
+	Updated  time.Time
+}
+
+// Attendee is a guest of an event.
+type Attendee struct {
+	Email string
+	Name  string
+	// Response is "needsAction", "declined", "tentative" or "accepted".
+	Response string
+}
+
+// Attachment is a file attached to an event, usually a Drive document.
+type Attachment struct {
+	Title   string
+	FileURL string
+}
+
+// EventsQuery is one page of an events.list call.
+type EventsQuery struct {
+	// Query is free text matched against the summary, description,
+	// location, attendees and organizer.
+	Query string
+	// TimeMin and TimeMax, when set, restrict results to events that end
+	// after TimeMin and start before TimeMax.
+	TimeMin   time.Time
+	TimeMax   time.Time
+	Limit     int
+	PageToken string
+}
+
+// CalendarClient abstracts the Calendar API for testability.
+type CalendarClient interface {
+	// ListEvents returns one page of a calendar's events matching q and the
+	// token for the next page ("" when there are no more). Cancelled
+	// events are left out.
+	ListEvents(ctx context.Context, calendarID string, q EventsQuery) ([]Event, string, error)
+}
+
+// Connector implements connectors.Connector for Google Calendar.
+type Connector struct {
+	client    CalendarClient
+	name      string
+	calendars []string
+}
+
+// NewConnector creates a Calendar connector with the given client. It
+// searches the user's primary calendar.
+func NewConnector(client CalendarClient) *Connector {
+	return &Connector{client: client, name: "google-calendar", calendars: []string{primaryCalendar}}
+}
+
+// WithName sets the name the connector reports and stamps on its results,
+// so several accounts can be configured side by side. It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+// WithCalendars sets the IDs of the calendars searched, e.g. "primary" or
+// a shared calendar's address. It returns c.
+func (c *Connector) WithCalendars(ids ...string) *Connector {
+	if len(ids) > 0 {
+		c.calendars = ids
+	}
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the events.list query and parameters Search would send
+// to each calendar.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	eq, _, ok := buildEventsQuery(parsed)
+	if !ok {
+		return connectors.Explanation{Params: map[string]string{
+			"skipped": "type: filter cannot match a calendar event; the API is not called",
+		}}, nil
+	}
+	params := map[string]string{
+		"calendars":    strings.Join(c.calendars, ","),
+		"maxResults":   strconv.FormatInt(maxResults(req.Limit), 10),
+		"singleEvents": strconv.FormatBool(eq.singleEvents()),
+	}
+	if eq.singleEvents() {
+		params["orderBy"] = "startTime"
+	}
+	if !eq.TimeMin.IsZero() {
+		params["timeMin"] = eq.TimeMin.Format(time.RFC3339)
+	}
+	if !eq.TimeMax.IsZero() {
+		params["timeMax"] = eq.TimeMax.Format(time.RFC3339)
+	}
+	return connectors.Explanation{Query: eq.Query, Params: params}, nil
+}
+
+// Search lists the matching events of every calendar. A calendar that
+// fails is reported as a warning unless they all do.
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	eq, warnings, ok := buildEventsQuery(parsed)
+	if !ok {
+		return connectors.Page{Results: []connectors.Result{}}, nil
+	}
+	eq.Limit = req.Limit
+	tokens, err := c.decodeCursor(req.Cursor)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+
+	terms := index.Terms(parsed)
+	results := []connectors.Result{}
+	next := make([]string, len(c.calendars))
+	more, failed, searched := false, 0, 0
+	for i, cal := range c.calendars {
+		if req.Cursor != "" && tokens[i] == "" {
+			continue // this calendar has no more pages
+		}
+		searched++
+		eq.PageToken = tokens[i]
+		events, token, err := c.client.ListEvents(ctx, cal, eq)
+		if err != nil {
+			failed++
+			warnings = append(warnings, fmt.Sprintf("calendar %s: %v", cal, err))
+			continue
+		}
+		for _, e := range events {
+			results = append(results, c.toResult(e, terms))
+		}
+		next[i] = token
+		more = more || token != ""
+	}
+	if failed > 0 && failed == searched {
+		return connectors.Page{}, fmt.Errorf("google calendar search: %s", strings.Join(warnings[len(warnings)-failed:], "; "))
+	}
+
+	page := connectors.Page{Results: results, Warnings: warnings}
+	if more {
+		page.NextCursor = encodeCursor(next)
+	}
+	return page, nil
+}
+
+// A cursor holds the next page token of each calendar, in order; calendars
+// with no more pages have "".
+func encodeCursor(tokens []string) string {
+	data, _ := json.Marshal(tokens)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (c *Connector) decodeCursor(cursor string) ([]string, error) {
+	tokens := make([]string, len(c.calendars))
+	if cursor == "" {
+		return tokens, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &tokens)
+	}
+	if err != nil || len(tokens) != len(c.calendars) {
+		return nil, fmt.Errorf("invalid google calendar cursor %q", cursor)
+	}
+	return tokens, nil
+}
+
+func (c *Connector) toResult(e Event, terms []string) connectors.Result {
+	r := connectors.Result{
+		Title:      e.Summary,
+		Snippet:    snippet(e, terms),
+		URL:        e.HTMLLink,
+		Source:     c.name,
+		ID:         e.ID,
+		CreatedAt:  e.Created,
+		ModifiedAt: e.Updated,
+		Author:     e.Organizer,
+		MimeType:   mimeTypeEvent,
+		Metadata: map[string]string{
+			"calendar": e.CalendarID,
+			"start":    e.Start.Format(time.RFC3339),
+			"end":      e.End.Format(time.RFC3339),
+		},
+	}
+	if r.Title == "" {
+		r.Title = "(No title)"
+	}
+	if e.AllDay {
+		r.Metadata["all_day"] = "true"
+		r.Metadata["start"] = e.Start.Format(time.DateOnly)
+		r.Metadata["end"] = e.End.Format(time.DateOnly)
+	}
+	if e.Location != "" {
+		r.Metadata["location"] = e.Location
+	}
+	if len(e.Attendees) > 0 {
+		guests := make([]string, len(e.Attendees))
+		for i, a := range e.Attendees {
+			guests[i] = a.Email
+			if a.Name != "" {
+				guests[i] = a.Name + " <" + a.Email + ">"
+			}
+		}
+		r.Metadata["attendees"] = strings.Join(guests, ", ")
+	}
+	if len(e.Attachments) > 0 {
+		titles := make([]string, len(e.Attachments))
+		urls := make([]string, len(e.Attachments))
+		for i, a := range e.Attachments {
+			titles[i], urls[i] = a.Title, a.FileURL
+		}
+		r.Metadata["attachments"] = strings.Join(titles, ", ")
+		r.Metadata["attachment_urls"] = strings.Join(urls, " ")
+	}
+	if e.MeetLink != "" {
+		r.Metadata["meet"] = e.MeetLink
+	}
+	return r
+}
+
+// snippet describes when and where an event is, followed by the part of
+// its description that mentions the query.
+func snippet(e Event, terms []string) string {
+	parts := []string{timeRange(e)}
+	if e.Location != "" {
+		parts = append(parts, e.Location)
+	}
+	if e.Description != "" {
+		parts = append(parts, index.Snippet(e.Description, terms))
+	}
+	return strings.Join(parts, " · ")
+}
+
+const (
+	dayLayout  = "Mon 2 Jan 2006"
+	timeLayout = "15:04"
+)
+
+// timeRange formats when an event takes place, e.g. "Tue 5 Mar 2024,
+// 10:00–11:00", in the event's own time zone.
+func timeRange(e Event) string {
+	if e.AllDay {
+		last := e.End.AddDate(0, 0, -1)
+		if !last.After(e.Start) {
+			return e.Start.Format(dayLayout)
+		}
+		return e.Start.Format(dayLayout) + " – " + last.Format(dayLayout)
+	}
+	start := e.Start.Format(dayLayout + ", " + timeLayout)
+	if e.Start.Format(time.DateOnly) == e.End.Format(time.DateOnly) {
+		return start + "–" + e.End.Format(timeLayout)
+	}
+	return start + " – " + e.End.Format(dayLayout+", "+timeLayout)
+}
@@ -0,0 +1,189 @@
+package gcal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockCalendarClient implements CalendarClient for testing.
+type MockCalendarClient struct {
+	mock.Mock
+}
+
+func (m *MockCalendarClient) ListEvents(ctx context.Context, calendarID string, q EventsQuery) ([]Event, string, error) {
+	args := m.Called(ctx, calendarID, q)
+	return args.Get(0).([]Event), args.String(1), args.Error(2)
+}
+
+var planning = Event{
+	ID:          "ev1",
+	CalendarID:  "primary",
+	Summary:     "Q2 planning",
+	Description: "Agenda: go through the budget, then hiring for the platform team.",
+	Location:    "Room 4",
+	Start:       time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC),
+	End:         time.Date(2024, 3, 5, 11, 30, 0, 0, time.UTC),
+	Organizer:   "alice@example.com",
+	Attendees: []Attendee{
+		{Email: "alice@example.com", Name: "Alice", Response: "accepted"},
+		{Email: "bob@example.com", Response: "tentative"},
+	},
+	Attachments: []Attachment{{Title: "Q2 plan", FileURL: "https://docs.google.com/document/d/doc1"}},
+	HTMLLink:    "https://www.google.com/calendar/event?eid=ZXYx",
+	MeetLink:    "https://meet.google.com/abc-defg-hij",
+	Created:     time.Date(2024, 2, 20, 10, 0, 0, 0, time.UTC),
+	Updated:     time.Date(2024, 2, 21, 10, 0, 0, 0, time.UTC),
+}
+
+func TestConnector_Name(t *testing.T) {
+	assert.Equal(t, "google-calendar", NewConnector(nil).Name())
+	assert.Equal(t, "work-calendar", NewConnector(nil).WithName("work-calendar").Name())
+}
+
+func TestConnector_Search_ReturnsResults(t *testing.T) {
+	mockClient := new(MockCalendarClient)
+	mockClient.On("ListEvents", mock.Anything, "primary", EventsQuery{Query: "hiring", Limit: 5}).Return([]Event{planning}, "", nil)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "hiring", Limit: 5})
+
+	require.NoError(t, err)
+	assert.Empty(t, page.NextCursor)
+	require.Len(t, page.Results, 1)
+	r := page.Results[0]
+	assert.Equal(t, "Q2 planning", r.Title)
+	assert.Equal(t, "Tue 5 Mar 2024, 10:00–11:30 · Room 4 · Agenda: go through the budget, then hiring for the platform team.", r.Snippet)
+	assert.Equal(t, planning.HTMLLink, r.URL)
+	assert.Equal(t, "google-calendar", r.Source)
+	assert.Equal(t, "ev1", r.ID)
+	assert.Equal(t, "alice@example.com", r.Author)
+	assert.Equal(t, planning.Created, r.CreatedAt)
+	assert.Equal(t, planning.Updated, r.ModifiedAt)
+	assert.Equal(t, "text/calendar", r.MimeType)
+	assert.Equal(t, map[string]string{
+		"calendar":        "primary",
+		"start":           "2024-03-05T10:00:00Z",
+		"end":             "2024-03-05T11:30:00Z",
+		"location":        "Room 4",
+		"attendees":       "Alice <alice@example.com>, bob@example.com",
+		"attachments":     "Q2 plan",
+		"attachment_urls": "https://docs.google.com/document/d/doc1",
+		"meet":            "https://meet.google.com/abc-defg-hij",
+	}, r.Metadata)
+	mockClient.AssertExpectations(t)
+}
+
+func TestConnector_Search_AllDayEvent(t *testing.T) {
+	offsite := Event{
+		ID:     "ev2",
+		Start:  time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC),
+		End:    time.Date(2024, 4, 12, 0, 0, 0, 0, time.UTC),
+		AllDay: true,
+	}
+	holiday := Event{
+		ID:     "ev3",
+		Start:  time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		End:    time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+		AllDay: true,
+	}
+	mockClient := new(MockCalendarClient)
+	mockClient.On("ListEvents", mock.Anything, "primary", mock.Anything).Return([]Event{offsite, holiday}, "", nil)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "offsite"})
+
+	require.NoError(t, err)
+	require.Len(t, page.Results, 2)
+	assert.Equal(t, "(No title)", page.Results[0].Title)
+	assert.Equal(t, "Wed 10 Apr 2024 – Thu 11 Apr 2024", page.Results[0].Snippet)
+	assert.Equal(t, map[string]string{"calendar": "", "start": "2024-04-10", "end": "2024-04-12", "all_day": "true"}, page.Results[0].Metadata)
+	assert.Equal(t, "Wed 1 May 2024", page.Results[1].Snippet)
+}
+
+func TestTimeRange_SpansDays(t *testing.T) {
+	e := Event{Start: time.Date(2024, 3, 5, 22, 0, 0, 0, time.UTC), End: time.Date(2024, 3, 6, 2, 0, 0, 0, time.UTC)}
+	assert.Equal(t, "Tue 5 Mar 2024, 22:00 – Wed 6 Mar 2024, 02:00", timeRange(e))
+}
+
+func TestConnector_Search_SeveralCalendarsAndPaging(t *testing.T) {
+	mockClient := new(MockCalendarClient)
+	mockClient.On("ListEvents", mock.Anything, "primary", EventsQuery{Query: "sync"}).Return([]Event{{ID: "a"}}, "p2", nil).Once()
+	mockClient.On("ListEvents", mock.Anything, "team@example.com", EventsQuery{Query: "sync"}).Return([]Event{{ID: "b"}}, "", nil).Once()
+	c := NewConnector(mockClient).WithCalendars("primary", "team@example.com")
+
+	page, err := c.Search(context.Background(), connectors.Request{Query: "sync"})
+	require.NoError(t, err)
+	require.Len(t, page.Results, 2)
+	require.NotEmpty(t, page.NextCursor)
+
+	// Only the calendar with more pages is asked again.
+	mockClient.On("ListEvents", mock.Anything, "primary", EventsQuery{Query: "sync", PageToken: "p2"}).Return([]Event{{ID: "c"}}, "", nil).Once()
+	page, err = c.Search(context.Background(), connectors.Request{Query: "sync", Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "c", page.Results[0].ID)
+	assert.Empty(t, page.NextCursor)
+	mockClient.AssertExpectations(t)
+
+	_, err = c.Search(context.Background(), connectors.Request{Query: "sync", Cursor: "garbage"})
+	assert.ErrorContains(t, err, "invalid google calendar cursor")
+}
+
+func TestConnector_Search_FailingCalendarIsAWarning(t *testing.T) {
+	mockClient := new(MockCalendarClient)
+	mockClient.On("ListEvents", mock.Anything, "primary", mock.Anything).Return([]Event{{ID: "a"}}, "", nil)
+	mockClient.On("ListEvents", mock.Anything, "gone@example.com", mock.Anything).Return([]Event{}, "", errors.New("calendar events.list: Not Found"))
+
+	page, err := NewConnector(mockClient).WithCalendars("primary", "gone@example.com").Search(context.Background(), connectors.Request{Query: "x"})
+
+	require.NoError(t, err)
+	assert.Len(t, page.Results, 1)
+	assert.Equal(t, []string{"calendar gone@example.com: calendar events.list: Not Found"}, page.Warnings)
+}
+
+func TestConnector_Search_Error(t *testing.T) {
+	mockClient := new(MockCalendarClient)
+	mockClient.On("ListEvents", mock.Anything, "primary", mock.Anything).Return([]Event{}, "", ErrScopeNotGranted)
+
+	_, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "x title:y"})
+
+	assert.EqualError(t, err, "google calendar search: calendar primary: "+ErrScopeNotGranted.Error())
+}
+
+func TestConnector_Search_TypeThatCannotMatch(t *testing.T) {
+	mockClient := new(MockCalendarClient)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "type:pdf budget"})
+
+	require.NoError(t, err)
+	assert.Empty(t, page.Results)
+	mockClient.AssertNotCalled(t, "ListEvents", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestConnector_Explain(t *testing.T) {
+	c := NewConnector(nil).WithCalendars("primary", "team@example.com")
+
+	exp, err := c.Explain(connectors.Request{Query: "standup from:bob@example.com after:2024-03-01"})
+	require.NoError(t, err)
+	assert.Equal(t, "standup bob@example.com", exp.Query)
+	assert.Equal(t, map[string]string{
+		"calendars":    "primary,team@example.com",
+		"maxResults":   "20",
+		"singleEvents": "true",
+		"orderBy":      "startTime",
+		"timeMin":      "2024-03-01T00:00:00Z",
+	}, exp.Params)
+
+	exp, err = c.Explain(connectors.Request{Query: "standup"})
+	require.NoError(t, err)
+	assert.Equal(t, "false", exp.Params["singleEvents"])
+
+	exp, err = c.Explain(connectors.Request{Query: "type:pdf"})
+	require.NoError(t, err)
+	assert.Contains(t, exp.Params["skipped"], "the API is not called")
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+	"golang.org/x/oauth2"
 	drive "google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
-	"golang.org/x/oauth2"
 )
 
 // APIClient implements DriveClient using the real Google Drive API.
@@ -29,37 +32,175 @@ func NewAPIClient(ctx context.Context, tokenSource oauth2.TokenSource) (*APIClie
 	return &APIClient{service: srv}, nil
 }
 
-// buildSearchQuery constructs a Drive API query string, escaping single quotes
-// in user input to prevent query injection.
-func buildSearchQuery(query string) string {
-	escaped := strings.ReplaceAll(query, `\`, `\\`)
-	escaped = strings.ReplaceAll(escaped, `'`, `\'`)
-	return fmt.Sprintf("fullText contains '%s' and trashed = false", escaped)
+// buildSearchQuery translates a pkb query into a Drive files.list q string,
+// escaping single quotes in user input to prevent query injection. Free-text
+// words become a single fullText clause; operators Drive cannot express are
+// returned as warnings and left out.
+func buildSearchQuery(q query.Query) (string, []string) {
+	var words, clauses, warnings []string
+	for _, c := range q.Clauses {
+		var clause string
+		switch c.Field {
+		case query.FieldText:
+			if !c.Phrase && !c.Negated {
+				words = append(words, c.Value)
+				continue
+			}
+			value := c.Value
+			if c.Phrase {
+				value = `"` + value + `"`
+			}
+			clause = fmt.Sprintf("fullText contains '%s'", escapeQuery(value))
+		case query.FieldTitle:
+			clause = fmt.Sprintf("name contains '%s'", escapeQuery(c.Value))
+		case query.FieldType:
+			clause = mimeTypeClause(query.MIMETypes(c.Value))
+		case query.FieldFrom:
+			// Drive can only match owners by email address.
+			if !strings.Contains(c.Value, "@") {
+				warnings = append(warnings, query.Unsupported(c))
+				continue
+			}
+			clause = fmt.Sprintf("'%s' in owners", escapeQuery(c.Value))
+		case query.FieldBefore:
+			clause = fmt.Sprintf("modifiedTime < '%s'", c.Date().Format(time.RFC3339))
+		case query.FieldAfter:
+			clause = fmt.Sprintf("modifiedTime >= '%s'", c.Date().Format(time.RFC3339))
+		default:
+			// source: is resolved by the search engine.
+			continue
+		}
+		if c.Negated {
+			clause = "not " + clause
+		}
+		clauses = append(clauses, clause)
+	}
+	if len(words) > 0 {
+		text := fmt.Sprintf("fullText contains '%s'", escapeQuery(strings.Join(words, " ")))
+		clauses = append([]string{text}, clauses...)
+	}
+	clauses = append(clauses, "trashed = false")
+	return strings.Join(clauses, " and "), warnings
+}
+
+// mimeTypeClause matches any of the given MIME types; entries ending in "/"
+// are prefixes.
+func mimeTypeClause(mimeTypes []string) string {
+	terms := make([]string, len(mimeTypes))
+	for i, m := range mimeTypes {
+		if strings.HasSuffix(m, "/") {
+			terms[i] = fmt.Sprintf("mimeType contains '%s'", m)
+		} else {
+			terms[i] = fmt.Sprintf("mimeType = '%s'", m)
+		}
+	}
+	return "(" + strings.Join(terms, " or ") + ")"
+}
+
+// escapeQuery escapes backslashes and single quotes for use inside a
+// quoted Drive query value.
+func escapeQuery(s string) string {
+	escaped := strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(escaped, `'`, `\'`)
+}
+
+// searchFields selects the file fields returned by files.list.
+const searchFields = "nextPageToken, files(id, name, mimeType, webViewLink, description, createdTime, modifiedTime, owners(displayName, emailAddress))"
+
+// Page size bounds for files.list. Drive rejects page sizes above 1000.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// pageSize clamps a requested result limit to what files.list accepts,
+// using defaultPageSize when no limit is given.
+func pageSize(limit int) int64 {
+	switch {
+	case limit <= 0:
+		return defaultPageSize
+	case limit > maxPageSize:
+		return maxPageSize
+	}
+	return int64(limit)
 }
 
-func (c *APIClient) SearchFiles(ctx context.Context, query string) ([]DriveFile, error) {
-	q := buildSearchQuery(query)
+func (c *APIClient) SearchFiles(ctx context.Context, req connectors.Request) ([]DriveFile, string, error) {
 	call := c.service.Files.List().
-		Q(q).
-		Fields("files(id, name, mimeType, webViewLink, description)").
-		PageSize(50).
+		Q(req.Query).
+		Fields(searchFields).
+		PageSize(pageSize(req.Limit)).
 		Context(ctx)
+	if req.Cursor != "" {
+		call = call.PageToken(req.Cursor)
+	}
 
 	resp, err := call.Do()
 	if err != nil {
-		return nil, fmt.Errorf("drive files.list: %w", err)
+		return nil, "", fmt.Errorf("drive files.list: %w", err)
 	}
 
 	files := make([]DriveFile, len(resp.Files))
 	for i, f := range resp.Files {
-		files[i] = DriveFile{
-			ID:          f.Id,
-			Name:        f.Name,
-			MimeType:    f.MimeType,
-			WebViewLink: f.WebViewLink,
-			Description: f.Description,
+		files[i] = toDriveFile(f)
+	}
+
+	return files, resp.NextPageToken, nil
+}
+
+// changeFields selects the changes.list fields turned into FileChanges.
+const changeFields = "nextPageToken, newStartPageToken, changes(fileId, removed, file(id, name, mimeType, webViewLink, description, createdTime, modifiedTime, trashed, owners(displayName, emailAddress)))"
+
+func (c *APIClient) StartPageToken(ctx context.Context) (string, error) {
+	resp, err := c.service.Changes.GetStartPageToken().Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("drive changes.getStartPageToken: %w", err)
+	}
+	return resp.StartPageToken, nil
+}
+
+func (c *APIClient) ListChanges(ctx context.Context, pageToken string) (ChangeList, error) {
+	resp, err := c.service.Changes.List(pageToken).
+		Fields(changeFields).
+		PageSize(maxPageSize).
+		IncludeRemoved(true).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return ChangeList{}, fmt.Errorf("drive changes.list: %w", err)
+	}
+
+	list := ChangeList{NextPageToken: resp.NextPageToken, NewStartPageToken: resp.NewStartPageToken}
+	for _, ch := range resp.Changes {
+		if ch.FileId == "" {
+			continue // a change to a shared drive itself, not a file
+		}
+		fc := FileChange{FileID: ch.FileId, Removed: ch.Removed || ch.File == nil || ch.File.Trashed}
+		if !fc.Removed {
+			fc.File = toDriveFile(ch.File)
 		}
+		list.Changes = append(list.Changes, fc)
 	}
+	return list, nil
+}
 
-	return files, nil
+// toDriveFile converts an API file into a DriveFile. Unparseable timestamps
+// are left zero rather than failing the whole search.
+func toDriveFile(f *drive.File) DriveFile {
+	df := DriveFile{
+		ID:          f.Id,
+		Name:        f.Name,
+		MimeType:    f.MimeType,
+		WebViewLink: f.WebViewLink,
+		Description: f.Description,
+	}
+	df.CreatedTime, _ = time.Parse(time.RFC3339, f.CreatedTime)
+	df.ModifiedTime, _ = time.Parse(time.RFC3339, f.ModifiedTime)
+	if len(f.Owners) > 0 {
+		df.Owner = f.Owners[0].DisplayName
+		if df.Owner == "" {
+			df.Owner = f.Owners[0].EmailAddress
+		}
+	}
+	return df
 }
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
@@ -14,23 +18,30 @@ import (
 	"google.golang.org/api/option"
 )
 
+func mustParse(t *testing.T, s string) query.Query {
+	t.Helper()
+	q, err := query.Parse(s)
+	require.NoError(t, err)
+	return q
+}
+
 func TestBuildSearchQuery_EscapesSingleQuotes(t *testing.T) {
-	got := buildSearchQuery("it's a test")
+	got, _ := buildSearchQuery(mustParse(t, "it's a test"))
 	assert.Equal(t, "fullText contains 'it\\'s a test' and trashed = false", got)
 }
 
 func TestBuildSearchQuery_NoSpecialChars(t *testing.T) {
-	got := buildSearchQuery("simple query")
+	got, _ := buildSearchQuery(mustParse(t, "simple query"))
 	assert.Equal(t, "fullText contains 'simple query' and trashed = false", got)
 }
 
 func TestBuildSearchQuery_MultipleQuotes(t *testing.T) {
-	got := buildSearchQuery("it's Bob's file")
+	got, _ := buildSearchQuery(mustParse(t, "it's Bob's file"))
 	assert.Equal(t, "fullText contains 'it\\'s Bob\\'s file' and trashed = false", got)
 }
 
 func TestBuildSearchQuery_BackslashBeforeQuote(t *testing.T) {
-	got := buildSearchQuery("test\\'already")
+	got, _ := buildSearchQuery(mustParse(t, "test\\'already"))
 	assert.Equal(t, "fullText contains 'test\\\\\\'already' and trashed = false", got)
 }
 
@@ -67,7 +78,7 @@ func TestSearchFiles_Success(t *testing.T) {
 	require.NoError(t, err)
 	client.service.BasePath = srv.URL
 
-	files, err := client.SearchFiles(context.Background(), "test")
+	files, _, err := client.SearchFiles(context.Background(), connectors.Request{Query: "test"})
 	require.NoError(t, err)
 	require.Len(t, files, 1)
 	assert.Equal(t, "1", files[0].ID)
@@ -77,6 +88,57 @@ func TestSearchFiles_Success(t *testing.T) {
 	assert.Equal(t, "A test document", files[0].Description)
 }
 
+func TestSearchFiles_ParsesMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.URL.Query().Get("fields"), "modifiedTime")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"files":[{"id":"1","name":"a.md","createdTime":"2024-01-02T03:04:05Z","modifiedTime":"2024-02-03T04:05:06.789Z","owners":[{"displayName":"Alice","emailAddress":"alice@example.com"}]},{"id":"2","name":"b.md","modifiedTime":"garbage","owners":[{"emailAddress":"bob@example.com"}]}]}`)
+	}))
+	defer srv.Close()
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"})
+	client, err := NewAPIClient(context.Background(), ts)
+	require.NoError(t, err)
+	client.service.BasePath = srv.URL
+
+	files, _, err := client.SearchFiles(context.Background(), connectors.Request{Query: "test"})
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), files[0].CreatedTime)
+	assert.Equal(t, time.Date(2024, 2, 3, 4, 5, 6, 789000000, time.UTC), files[0].ModifiedTime)
+	assert.Equal(t, "Alice", files[0].Owner)
+	assert.True(t, files[1].ModifiedTime.IsZero(), "unparseable timestamps are left zero")
+	assert.Equal(t, "bob@example.com", files[1].Owner, "falls back to email when display name is missing")
+}
+
+func TestSearchFiles_Pagination(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "10", r.URL.Query().Get("pageSize"))
+		assert.Equal(t, "page-2", r.URL.Query().Get("pageToken"))
+		assert.Contains(t, r.URL.Query().Get("fields"), "nextPageToken")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"nextPageToken":"page-3","files":[{"id":"1","name":"a.md"}]}`)
+	}))
+	defer srv.Close()
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"})
+	client, err := NewAPIClient(context.Background(), ts)
+	require.NoError(t, err)
+	client.service.BasePath = srv.URL
+
+	files, next, err := client.SearchFiles(context.Background(), connectors.Request{Query: "test", Limit: 10, Cursor: "page-2"})
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "page-3", next)
+}
+
+func TestPageSize(t *testing.T) {
+	assert.Equal(t, int64(defaultPageSize), pageSize(0))
+	assert.Equal(t, int64(defaultPageSize), pageSize(-5))
+	assert.Equal(t, int64(25), pageSize(25))
+	assert.Equal(t, int64(maxPageSize), pageSize(5000))
+}
+
 func TestSearchFiles_APIError(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -88,7 +150,73 @@ func TestSearchFiles_APIError(t *testing.T) {
 	require.NoError(t, err)
 	client.service.BasePath = srv.URL
 
-	_, err = client.SearchFiles(context.Background(), "test")
+	_, _, err = client.SearchFiles(context.Background(), connectors.Request{Query: "test"})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "drive files.list")
 }
+
+func TestStartPageToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/changes/startPageToken"), r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"startPageToken":"100"}`)
+	}))
+	defer srv.Close()
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"})
+	client, err := NewAPIClient(context.Background(), ts)
+	require.NoError(t, err)
+	client.service.BasePath = srv.URL
+
+	token, err := client.StartPageToken(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "100", token)
+}
+
+func TestListChanges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/changes"), r.URL.Path)
+		assert.Equal(t, "100", r.URL.Query().Get("pageToken"))
+		assert.Equal(t, "true", r.URL.Query().Get("includeRemoved"))
+		assert.Contains(t, r.URL.Query().Get("fields"), "newStartPageToken")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"newStartPageToken":"150","changes":[
+			{"fileId":"f1","file":{"id":"f1","name":"plan.md","description":"notes","modifiedTime":"2024-02-03T04:05:06Z"}},
+			{"fileId":"f2","removed":true},
+			{"fileId":"f3","file":{"id":"f3","name":"old.md","trashed":true}},
+			{"driveId":"d1"}
+		]}`)
+	}))
+	defer srv.Close()
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"})
+	client, err := NewAPIClient(context.Background(), ts)
+	require.NoError(t, err)
+	client.service.BasePath = srv.URL
+
+	list, err := client.ListChanges(context.Background(), "100")
+	require.NoError(t, err)
+	assert.Equal(t, "150", list.NewStartPageToken)
+	assert.Empty(t, list.NextPageToken)
+	require.Len(t, list.Changes, 3, "shared drive changes are skipped")
+	assert.Equal(t, "plan.md", list.Changes[0].File.Name)
+	assert.Equal(t, time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC), list.Changes[0].File.ModifiedTime)
+	assert.False(t, list.Changes[0].Removed)
+	assert.Equal(t, FileChange{FileID: "f2", Removed: true}, list.Changes[1])
+	assert.Equal(t, FileChange{FileID: "f3", Removed: true}, list.Changes[2], "trashed files count as removed")
+}
+
+func TestListChanges_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"})
+	client, err := NewAPIClient(context.Background(), ts)
+	require.NoError(t, err)
+	client.service.BasePath = srv.URL
+
+	_, err = client.ListChanges(context.Background(), "100")
+	assert.ErrorContains(t, err, "drive changes.list")
+}
@@ -1,55 +1,180 @@
 package gdrive
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
 )
 
 // DriveFile represents a file returned from the Google Drive API.
 type DriveFile struct {
-	ID          string
-	Name        string
-	MimeType    string
-	WebViewLink string
-	Description string
+	ID           string
+	Name         string
+	MimeType     string
+	WebViewLink  string
+	Description  string
+	CreatedTime  time.Time
+	ModifiedTime time.Time
+	// Owner is the display name (or email address) of the file's first owner.
+	Owner string
+}
+
+// FileChange is one entry of the Drive changes feed.
+type FileChange struct {
+	FileID string
+	// Removed is true when the file was deleted, trashed or is no longer
+	// accessible; File is only set when it is false.
+	Removed bool
+	File    DriveFile
+}
+
+// ChangeList is one page of the Drive changes feed.
+type ChangeList struct {
+	Changes []FileChange
+	// NextPageToken is set when more changes remain. On the last page
+	// NewStartPageToken is set instead, for listing later changes.
+	NextPageToken     string
+	NewStartPageToken string
 }
 
 // DriveClient abstracts the Google Drive API for testability.
 type DriveClient interface {
-	SearchFiles(ctx context.Context, query string) ([]DriveFile, error)
+	// SearchFiles returns one page of matching files and the token for the
+	// next page ("" when there are no more). req.Query is a native Drive
+	// query, as built by buildSearchQuery.
+	SearchFiles(ctx context.Context, req connectors.Request) ([]DriveFile, string, error)
+	// StartPageToken returns the changes page token for changes made from
+	// now on.
+	StartPageToken(ctx context.Context) (string, error)
+	// ListChanges returns one page of file changes since pageToken.
+	ListChanges(ctx context.Context, pageToken string) (ChangeList, error)
 }
 
 // Connector implements connectors.Connector for Google Drive.
 type Connector struct {
 	client DriveClient
+	name   string
 }
 
 // NewConnector creates a Google Drive connector with the given client.
 func NewConnector(client DriveClient) *Connector {
-	return &Connector{client: client}
+	return &Connector{client: client, name: "google-drive"}
+}
+
+// WithName sets the name the connector reports and stamps on its results,
+// so several accounts can be configured side by side. It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
 }
 
 func (c *Connector) Name() string {
-	return "google-drive"
+	return c.name
+}
+
+// Explain reports the files.list query and parameters Search would send.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	native, _ := buildSearchQuery(parsed)
+	params := map[string]string{
+		"pageSize": strconv.FormatInt(pageSize(req.Limit), 10),
+		"fields":   searchFields,
+	}
+	if req.Cursor != "" {
+		params["pageToken"] = req.Cursor
+	}
+	return connectors.Explanation{Query: native, Params: params}, nil
 }
 
-func (c *Connector) Search(ctx context.Context, query string) ([]connectors.Result, error) {
-	files, err := c.client.SearchFiles(ctx, query)
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
 	if err != nil {
-		return nil, fmt.Errorf("google drive search: %w", err)
+		return connectors.Page{}, err
+	}
+	native, warnings := buildSearchQuery(parsed)
+	req.Query = native
+
+	files, next, err := c.client.SearchFiles(ctx, req)
+	if err != nil {
+		return connectors.Page{}, fmt.Errorf("google drive search: %w", err)
 	}
 
 	results := make([]connectors.Result, len(files))
 	for i, f := range files {
-		results[i] = connectors.Result{
-			Title:   f.Name,
-			URL:     f.WebViewLink,
-			Source:  "google-drive",
-			Snippet: f.Description,
+		results[i] = c.toResult(f)
+	}
+
+	return connectors.Page{Results: results, NextCursor: next, Warnings: warnings}, nil
+}
+
+// crawlQuery selects every file Crawl copies into the local index.
+const crawlQuery = "trashed = false"
+
+// Crawl lists every file that is not in the trash, maxPageSize at a time.
+// Drive only exposes a file's description without downloading it, so that
+// is what is indexed as the body.
+func (c *Connector) Crawl(ctx context.Context, cursor string) (connectors.CrawlPage, error) {
+	files, next, err := c.client.SearchFiles(ctx, connectors.Request{Query: crawlQuery, Limit: maxPageSize, Cursor: cursor})
+	if err != nil {
+		return connectors.CrawlPage{}, fmt.Errorf("google drive crawl: %w", err)
+	}
+	docs := make([]connectors.Document, len(files))
+	for i, f := range files {
+		docs[i] = connectors.Document{Result: c.toResult(f), Body: f.Description}
+	}
+	return connectors.CrawlPage{Documents: docs, NextCursor: next}, nil
+}
+
+// StartCursor returns a Drive changes page token for changes made from
+// now on.
+func (c *Connector) StartCursor(ctx context.Context) (string, error) {
+	token, err := c.client.StartPageToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("google drive changes: %w", err)
+	}
+	return token, nil
+}
+
+// Changes lists files added, modified, trashed or deleted since cursor, a
+// Drive changes page token.
+func (c *Connector) Changes(ctx context.Context, cursor string) (connectors.ChangePage, error) {
+	list, err := c.client.ListChanges(ctx, cursor)
+	if err != nil {
+		return connectors.ChangePage{}, fmt.Errorf("google drive changes: %w", err)
+	}
+	page := connectors.ChangePage{NextCursor: list.NextPageToken}
+	for _, fc := range list.Changes {
+		ch := connectors.Change{ID: fc.FileID, Deleted: fc.Removed}
+		if !fc.Removed {
+			ch.Document = connectors.Document{Result: c.toResult(fc.File), Body: fc.File.Description}
 		}
+		page.Changes = append(page.Changes, ch)
+	}
+	if page.NextCursor == "" {
+		page.Done = true
+		page.NextCursor = cmp.Or(list.NewStartPageToken, cursor)
 	}
+	return page, nil
+}
 
-	return results, nil
+func (c *Connector) toResult(f DriveFile) connectors.Result {
+	return connectors.Result{
+		Title:      f.Name,
+		URL:        f.WebViewLink,
+		Source:     c.name,
+		Snippet:    f.Description,
+		ID:         f.ID,
+		CreatedAt:  f.CreatedTime,
+		ModifiedAt: f.ModifiedTime,
+		Author:     f.Owner,
+		MimeType:   f.MimeType,
+	}
 }
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -15,9 +18,19 @@ type MockDriveClient struct {
 	mock.Mock
 }
 
-func (m *MockDriveClient) SearchFiles(ctx context.Context, query string) ([]DriveFile, error) {
-	args := m.Called(ctx, query)
-	return args.Get(0).([]DriveFile), args.Error(1)
+func (m *MockDriveClient) SearchFiles(ctx context.Context, req connectors.Request) ([]DriveFile, string, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).([]DriveFile), args.String(1), args.Error(2)
+}
+
+func (m *MockDriveClient) StartPageToken(ctx context.Context) (string, error) {
+	args := m.Called(ctx)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockDriveClient) ListChanges(ctx context.Context, pageToken string) (ChangeList, error) {
+	args := m.Called(ctx, pageToken)
+	return args.Get(0).(ChangeList), args.Error(1)
 }
 
 func TestConnector_Name(t *testing.T) {
@@ -25,48 +38,186 @@ func TestConnector_Name(t *testing.T) {
 	assert.Equal(t, "google-drive", c.Name())
 }
 
+func TestConnector_WithName(t *testing.T) {
+	mockClient := new(MockDriveClient)
+	mockClient.On("SearchFiles", mock.Anything, mock.Anything).Return([]DriveFile{{ID: "abc123", Name: "Notes.md"}}, "", nil)
+
+	c := NewConnector(mockClient).WithName("work-drive")
+	page, err := c.Search(context.Background(), connectors.Request{Query: "notes"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "work-drive", c.Name())
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "work-drive", page.Results[0].Source)
+}
+
 func TestConnector_Search_ReturnsResults(t *testing.T) {
 	mockClient := new(MockDriveClient)
-	mockClient.On("SearchFiles", mock.Anything, "test query").Return([]DriveFile{
+	mockClient.On("SearchFiles", mock.Anything, connectors.Request{Query: "fullText contains 'test query' and trashed = false"}).Return([]DriveFile{
 		{ID: "abc123", Name: "Meeting Notes.md", MimeType: "text/markdown", WebViewLink: "https://drive.google.com/file/d/abc123/view", Description: "Weekly meeting notes"},
 		{ID: "def456", Name: "Project Plan.docx", MimeType: "application/vnd.google-apps.document", WebViewLink: "https://drive.google.com/file/d/def456/view", Description: "Q1 project plan"},
-	}, nil)
+	}, "", nil)
+
+	c := NewConnector(mockClient)
+	page, err := c.Search(context.Background(), connectors.Request{Query: "test query"})
+
+	require.NoError(t, err)
+	assert.Len(t, page.Results, 2)
+	assert.Equal(t, "Meeting Notes.md", page.Results[0].Title)
+	assert.Equal(t, "https://drive.google.com/file/d/abc123/view", page.Results[0].URL)
+	assert.Equal(t, "google-drive", page.Results[0].Source)
+	assert.Equal(t, "Weekly meeting notes", page.Results[0].Snippet)
+	assert.Equal(t, "Project Plan.docx", page.Results[1].Title)
+	assert.Equal(t, "Q1 project plan", page.Results[1].Snippet)
+	mockClient.AssertExpectations(t)
+}
+
+func TestConnector_Search_MapsMetadata(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	modified := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	mockClient := new(MockDriveClient)
+	mockClient.On("SearchFiles", mock.Anything, connectors.Request{Query: "fullText contains 'q' and trashed = false"}).Return([]DriveFile{
+		{ID: "abc123", Name: "Notes.md", MimeType: "text/markdown", CreatedTime: created, ModifiedTime: modified, Owner: "Alice"},
+	}, "", nil)
+
+	c := NewConnector(mockClient)
+	page, err := c.Search(context.Background(), connectors.Request{Query: "q"})
+
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "abc123", page.Results[0].ID)
+	assert.Equal(t, "text/markdown", page.Results[0].MimeType)
+	assert.Equal(t, created, page.Results[0].CreatedAt)
+	assert.Equal(t, modified, page.Results[0].ModifiedAt)
+	assert.Equal(t, "Alice", page.Results[0].Author)
+}
+
+func TestConnector_Search_PassesPagination(t *testing.T) {
+	req := connectors.Request{Query: "q", Limit: 10, Cursor: "tok-1"}
+	native := connectors.Request{Query: "fullText contains 'q' and trashed = false", Limit: 10, Cursor: "tok-1"}
+	mockClient := new(MockDriveClient)
+	mockClient.On("SearchFiles", mock.Anything, native).Return([]DriveFile{{ID: "x"}}, "tok-2", nil)
 
 	c := NewConnector(mockClient)
-	results, err := c.Search(context.Background(), "test query")
+	page, err := c.Search(context.Background(), req)
 
 	require.NoError(t, err)
-	assert.Len(t, results, 2)
-	assert.Equal(t, "Meeting Notes.md", results[0].Title)
-	assert.Equal(t, "https://drive.google.com/file/d/abc123/view", results[0].URL)
-	assert.Equal(t, "google-drive", results[0].Source)
-	assert.Equal(t, "Weekly meeting notes", results[0].Snippet)
-	assert.Equal(t, "Project Plan.docx", results[1].Title)
-	assert.Equal(t, "Q1 project plan", results[1].Snippet)
+	assert.Len(t, page.Results, 1)
+	assert.Equal(t, "tok-2", page.NextCursor)
 	mockClient.AssertExpectations(t)
 }
 
 func TestConnector_Search_HandlesEmpty(t *testing.T) {
 	mockClient := new(MockDriveClient)
-	mockClient.On("SearchFiles", mock.Anything, "nothing").Return([]DriveFile{}, nil)
+	mockClient.On("SearchFiles", mock.Anything, connectors.Request{Query: "fullText contains 'nothing' and trashed = false"}).Return([]DriveFile{}, "", nil)
 
 	c := NewConnector(mockClient)
-	results, err := c.Search(context.Background(), "nothing")
+	page, err := c.Search(context.Background(), connectors.Request{Query: "nothing"})
 
 	require.NoError(t, err)
-	assert.Empty(t, results)
+	assert.Empty(t, page.Results)
 	mockClient.AssertExpectations(t)
 }
 
 func TestConnector_Search_HandlesError(t *testing.T) {
 	mockClient := new(MockDriveClient)
-	mockClient.On("SearchFiles", mock.Anything, "fail").Return([]DriveFile(nil), errors.New("API rate limit"))
+	mockClient.On("SearchFiles", mock.Anything, connectors.Request{Query: "fullText contains 'fail' and trashed = false"}).Return([]DriveFile(nil), "", errors.New("API rate limit"))
 
 	c := NewConnector(mockClient)
-	results, err := c.Search(context.Background(), "fail")
+	page, err := c.Search(context.Background(), connectors.Request{Query: "fail"})
 
 	assert.Error(t, err)
-	assert.Nil(t, results)
+	assert.Empty(t, page)
 	assert.Contains(t, err.Error(), "API rate limit")
 	mockClient.AssertExpectations(t)
 }
+
+func TestConnector_Search_ReportsUnsupportedOperators(t *testing.T) {
+	mockClient := new(MockDriveClient)
+	mockClient.On("SearchFiles", mock.Anything, connectors.Request{Query: "fullText contains 'notes' and trashed = false"}).Return([]DriveFile{}, "", nil)
+
+	c := NewConnector(mockClient)
+	page, err := c.Search(context.Background(), connectors.Request{Query: "notes from:bob"})
+
+	require.NoError(t, err)
+	require.Len(t, page.Warnings, 1)
+	assert.Contains(t, page.Warnings[0], "from:bob")
+}
+
+func TestConnector_Search_InvalidQuery(t *testing.T) {
+	c := NewConnector(new(MockDriveClient))
+	_, err := c.Search(context.Background(), connectors.Request{Query: `"unterminated`})
+	assert.ErrorIs(t, err, query.ErrSyntax)
+}
+
+func TestConnector_Explain(t *testing.T) {
+	c := NewConnector(nil)
+	exp, err := c.Explain(connectors.Request{Query: "notes type:pdf", Limit: 10, Cursor: "tok"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "fullText contains 'notes' and (mimeType = 'application/pdf') and trashed = false", exp.Query)
+	assert.Equal(t, map[string]string{"pageSize": "10", "fields": searchFields, "pageToken": "tok"}, exp.Params)
+}
+
+func TestConnector_Crawl(t *testing.T) {
+	mockClient := new(MockDriveClient)
+	mockClient.On("SearchFiles", mock.Anything, connectors.Request{Query: crawlQuery, Limit: maxPageSize, Cursor: "tok"}).Return([]DriveFile{
+		{ID: "f1", Name: "Plan", Description: "the plan", WebViewLink: "https://drive.google.com/f1"},
+	}, "tok-2", nil)
+
+	c := NewConnector(mockClient)
+	page, err := c.Crawl(context.Background(), "tok")
+
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 1)
+	assert.Equal(t, "Plan", page.Documents[0].Title)
+	assert.Equal(t, "google-drive", page.Documents[0].Source)
+	assert.Equal(t, "the plan", page.Documents[0].Body)
+	assert.Equal(t, "tok-2", page.NextCursor)
+	mockClient.AssertExpectations(t)
+}
+
+func TestConnector_Crawl_HandlesError(t *testing.T) {
+	mockClient := new(MockDriveClient)
+	mockClient.On("SearchFiles", mock.Anything, mock.Anything).Return([]DriveFile(nil), "", errors.New("quota"))
+
+	_, err := NewConnector(mockClient).Crawl(context.Background(), "")
+	assert.ErrorContains(t, err, "google drive crawl")
+}
+
+func TestConnector_StartCursor(t *testing.T) {
+	mockClient := new(MockDriveClient)
+	mockClient.On("StartPageToken", mock.Anything).Return("100", nil)
+
+	cursor, err := NewConnector(mockClient).StartCursor(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "100", cursor)
+}
+
+func TestConnector_Changes(t *testing.T) {
+	mockClient := new(MockDriveClient)
+	mockClient.On("ListChanges", mock.Anything, "100").Return(ChangeList{
+		Changes: []FileChange{
+			{FileID: "f1", File: DriveFile{ID: "f1", Name: "Plan", Description: "the plan"}},
+			{FileID: "f2", Removed: true},
+		},
+		NextPageToken: "101",
+	}, nil)
+	mockClient.On("ListChanges", mock.Anything, "101").Return(ChangeList{NewStartPageToken: "150"}, nil)
+	c := NewConnector(mockClient)
+
+	page, err := c.Changes(context.Background(), "100")
+	require.NoError(t, err)
+	assert.False(t, page.Done)
+	assert.Equal(t, "101", page.NextCursor)
+	require.Len(t, page.Changes, 2)
+	assert.Equal(t, "Plan", page.Changes[0].Document.Title)
+	assert.Equal(t, "the plan", page.Changes[0].Document.Body)
+	assert.Equal(t, connectors.Change{ID: "f2", Deleted: true}, page.Changes[1])
+
+	page, err = c.Changes(context.Background(), "101")
+	require.NoError(t, err)
+	assert.True(t, page.Done)
+	assert.Equal(t, "150", page.NextCursor, "the last page carries the cursor for the next sync")
+	mockClient.AssertExpectations(t)
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
@@ -53,7 +54,7 @@ func TestIntegration_GDrive_SearchReturnsResults(t *testing.T) {
 
 	// Search for something likely to exist in any Google Drive
 	// The Obsidian vault mirror should have markdown files
-	results, err := client.SearchFiles(context.Background(), "md")
+	results, _, err := client.SearchFiles(context.Background(), connectors.Request{Query: "fullText contains 'md' and trashed = false"})
 
 	require.NoError(t, err)
 	assert.NotEmpty(t, results, "Expected at least one result from Google Drive")
@@ -71,12 +72,12 @@ func TestIntegration_GDrive_ConnectorEndToEnd(t *testing.T) {
 
 	assert.Equal(t, "google-drive", connector.Name())
 
-	results, err := connector.Search(context.Background(), "md")
+	page, err := connector.Search(context.Background(), connectors.Request{Query: "md"})
 	require.NoError(t, err)
-	assert.NotEmpty(t, results, "Expected search results from connector")
+	assert.NotEmpty(t, page.Results, "Expected search results from connector")
 
 	// Verify connector results have expected fields
-	for _, r := range results {
+	for _, r := range page.Results {
 		assert.NotEmpty(t, r.Title)
 		assert.Equal(t, "google-drive", r.Source)
 	}
@@ -86,7 +87,7 @@ func TestIntegration_GDrive_EmptyQueryReturnsResults(t *testing.T) {
 	client := setupIntegrationClient(t)
 
 	// Even a broad search should return something
-	results, err := client.SearchFiles(context.Background(), "the")
+	results, _, err := client.SearchFiles(context.Background(), connectors.Request{Query: "fullText contains 'the' and trashed = false"})
 	require.NoError(t, err)
 	assert.NotEmpty(t, results)
 }
@@ -10,8 +10,16 @@ import (
 	"golang.org/x/oauth2"
 )
 
-// SaveToken writes an OAuth2 token to a file as JSON.
-// It creates the parent directory if it does not exist.
+// storedToken is the token file's layout: the token plus the scopes it
+// was granted, which the token endpoint reports alongside it but
+// oauth2.Token does not keep as a field.
+type storedToken struct {
+	*oauth2.Token
+	Scope string `json:"scope,omitempty"`
+}
+
+// SaveToken writes an OAuth2 token to a file as JSON, with its granted
+// scopes. It creates the parent directory if it does not exist.
 func SaveToken(path string, token *oauth2.Token) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
 		return fmt.Errorf("create token directory: %w", err)
@@ -26,7 +34,8 @@ func SaveToken(path string, token *oauth2.Token) error {
 // encodeAndClose writes a token as JSON and closes the writer,
 // surfacing both encode and close errors.
 func encodeAndClose(wc io.WriteCloser, token *oauth2.Token) error {
-	err := json.NewEncoder(wc).Encode(token)
+	scope, _ := token.Extra("scope").(string)
+	err := json.NewEncoder(wc).Encode(storedToken{Token: token, Scope: scope})
 	if closeErr := wc.Close(); closeErr != nil && err == nil {
 		err = closeErr
 	}
@@ -36,7 +45,8 @@ func encodeAndClose(wc io.WriteCloser, token *oauth2.Token) error {
 	return nil
 }
 
-// LoadToken reads an OAuth2 token from a JSON file.
+// LoadToken reads an OAuth2 token from a JSON file. The granted scopes,
+// when the file records them, are available as tok.Extra("scope").
 func LoadToken(path string) (*oauth2.Token, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -44,10 +54,15 @@ func LoadToken(path string) (*oauth2.Token, error) {
 	}
 	defer f.Close()
 
-	var tok oauth2.Token
-	if err := json.NewDecoder(f).Decode(&tok); err != nil {
+	var st storedToken
+	if err := json.NewDecoder(f).Decode(&st); err != nil {
 		return nil, fmt.Errorf("decode token: %w", err)
 	}
-
-	return &tok, nil
+	if st.Token == nil {
+		st.Token = &oauth2.Token{}
+	}
+	if st.Scope != "" {
+		return st.Token.WithExtra(map[string]any{"scope": st.Scope}), nil
+	}
+	return st.Token, nil
 }
@@ -32,6 +32,31 @@ func TestSaveAndLoadToken(t *testing.T) {
 	assert.Equal(t, "Bearer", loaded.TokenType)
 }
 
+func TestSaveAndLoadToken_KeepsGrantedScopes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	tok := (&oauth2.Token{AccessToken: "a", RefreshToken: "r"}).WithExtra(map[string]any{
+		"scope": "https://www.googleapis.com/auth/drive.readonly https://www.googleapis.com/auth/gmail.readonly",
+	})
+
+	require.NoError(t, SaveToken(path, tok))
+	loaded, err := LoadToken(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, "r", loaded.RefreshToken)
+	assert.Equal(t, "https://www.googleapis.com/auth/drive.readonly https://www.googleapis.com/auth/gmail.readonly", loaded.Extra("scope"))
+}
+
+func TestLoadToken_WithoutScopes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"access_token":"a","token_type":"Bearer","refresh_token":"r"}`), 0600))
+
+	loaded, err := LoadToken(path)
+
+	require.NoError(t, err)
+	assert.Equal(t, "a", loaded.AccessToken)
+	assert.Nil(t, loaded.Extra("scope"))
+}
+
 func TestLoadToken_FileNotFound(t *testing.T) {
 	_, err := LoadToken("/nonexistent/token.json")
 	assert.Error(t, err)
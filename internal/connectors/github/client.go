@@ -0,0 +1,459 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultBaseURL is the GitHub REST API endpoint.
+const defaultBaseURL = "https://api.github.com/"
+
+// apiVersion is the X-GitHub-Api-Version header sent with REST requests;
+// the response shapes decoded here are those of this version.
+const apiVersion = "2022-11-28"
+
+// Page size bounds. The search APIs return up to 100 results per page.
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// Rate limit resources, as GitHub names them in X-RateLimit-Resource. Each
+// has its own budget: searches are limited to a few dozen a minute.
+const (
+	resourceSearch     = "search"
+	resourceCodeSearch = "code_search"
+	resourceGraphQL    = "graphql"
+)
+
+// ErrRateLimited is wrapped by errors for requests GitHub refused, or
+// would refuse, because too many were made.
+var ErrRateLimited = errors.New("github rate limit exceeded")
+
+// APIClient implements GitHubClient over the GitHub REST and GraphQL APIs
+// with a personal access token. Classic tokens need the repo scope to find
+// private repositories; fine-grained tokens need read access to issues,
+// pull requests, discussions and contents as wanted.
+type APIClient struct {
+	baseURL    string
+	graphQLURL string
+	token      string
+	httpClient *http.Client
+
+	// mu guards exhausted, the time each exhausted rate limit resource
+	// resets. Requests are not sent before then.
+	mu        sync.Mutex
+	exhausted map[string]time.Time
+}
+
+// NewAPIClient creates a GitHub API client authenticating with token. A
+// nil httpClient uses http.DefaultClient.
+func NewAPIClient(token string, httpClient *http.Client) *APIClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	c := &APIClient{token: token, httpClient: httpClient, exhausted: map[string]time.Time{}}
+	return c.WithBaseURL(defaultBaseURL)
+}
+
+// WithBaseURL points the client at a GitHub Enterprise Server's REST API,
+// such as https://github.example.com/api/v3/. It returns c.
+func (c *APIClient) WithBaseURL(base string) *APIClient {
+	c.baseURL = strings.TrimSuffix(base, "/") + "/"
+	// github.com serves GraphQL at /graphql; Enterprise Server at
+	// /api/graphql, beside /api/v3.
+	if root, ok := strings.CutSuffix(c.baseURL, "/v3/"); ok {
+		c.graphQLURL = root + "/graphql"
+	} else {
+		c.graphQLURL = c.baseURL + "graphql"
+	}
+	return c
+}
+
+// perPage clamps a requested result limit to what the API accepts, using
+// defaultPerPage when no limit is given.
+func perPage(limit int) int {
+	switch {
+	case limit <= 0:
+		return defaultPerPage
+	case limit > maxPerPage:
+		return maxPerPage
+	}
+	return limit
+}
+
+// issue is an issue or pull request in a search response.
+type issue struct {
+	Number        int    `json:"number"`
+	Title         string `json:"title"`
+	Body          string `json:"body"`
+	HTMLURL       string `json:"html_url"`
+	State         string `json:"state"`
+	RepositoryURL string `json:"repository_url"`
+	User          struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Comments    int       `json:"comments"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	PullRequest *struct {
+		MergedAt *time.Time `json:"merged_at"`
+	} `json:"pull_request"`
+}
+
+func (is issue) toItem() Item {
+	item := Item{
+		Number:      is.Number,
+		Title:       is.Title,
+		Body:        is.Body,
+		URL:         is.HTMLURL,
+		State:       is.State,
+		Author:      is.User.Login,
+		Comments:    is.Comments,
+		CreatedAt:   is.CreatedAt,
+		UpdatedAt:   is.UpdatedAt,
+		PullRequest: is.PullRequest != nil,
+	}
+	// repository_url is https://api.github.com/repos/{owner}/{name}.
+	if _, repo, ok := strings.Cut(is.RepositoryURL, "/repos/"); ok {
+		item.Repository = repo
+	}
+	if is.PullRequest != nil && is.PullRequest.MergedAt != nil {
+		item.State = "merged"
+	}
+	for _, l := range is.Labels {
+		item.Labels = append(item.Labels, l.Name)
+	}
+	return item
+}
+
+// SearchIssues calls the issues search, which finds issues and pull
+// requests. Its pages are numbered, so the cursor is the next page number.
+func (c *APIClient) SearchIssues(ctx context.Context, req SearchRequest) ([]Item, string, error) {
+	var resp struct {
+		Items []issue `json:"items"`
+	}
+	next, err := c.search(ctx, "search/issues", resourceSearch, req, "application/vnd.github+json", &resp)
+	if err != nil {
+		return nil, "", err
+	}
+	items := make([]Item, 0, len(resp.Items))
+	for _, is := range resp.Items {
+		items = append(items, is.toItem())
+	}
+	return items, next, nil
+}
+
+// SearchCode calls the code search. Files come with the fragments that
+// matched as their body.
+func (c *APIClient) SearchCode(ctx context.Context, req SearchRequest) ([]Item, string, error) {
+	var resp struct {
+		Items []struct {
+			Path       string `json:"path"`
+			HTMLURL    string `json:"html_url"`
+			Repository struct {
+				FullName string `json:"full_name"`
+			} `json:"repository"`
+			TextMatches []struct {
+				Fragment string `json:"fragment"`
+			} `json:"text_matches"`
+		} `json:"items"`
+	}
+	next, err := c.search(ctx, "search/code", resourceCodeSearch, req, "application/vnd.github.text-match+json", &resp)
+	if err != nil {
+		return nil, "", err
+	}
+	items := make([]Item, 0, len(resp.Items))
+	for _, f := range resp.Items {
+		var fragments []string
+		for _, m := range f.TextMatches {
+			fragments = append(fragments, m.Fragment)
+		}
+		items = append(items, Item{
+			Repository: f.Repository.FullName,
+			Path:       f.Path,
+			URL:        f.HTMLURL,
+			Body:       strings.Join(fragments, " … "),
+		})
+	}
+	return items, next, nil
+}
+
+// search calls a REST search endpoint and decodes the response into out.
+// It returns the next page number, if the Link header has one.
+func (c *APIClient) search(ctx context.Context, endpoint, resource string, req SearchRequest, accept string, out any) (string, error) {
+	page := 1
+	if req.Cursor != "" {
+		n, err := strconv.Atoi(req.Cursor)
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("github %s: invalid cursor %q", endpoint, req.Cursor)
+		}
+		page = n
+	}
+	params := url.Values{
+		"q":        {req.Query},
+		"per_page": {strconv.Itoa(perPage(req.PerPage))},
+		"page":     {strconv.Itoa(page)},
+	}
+	header, err := c.do(ctx, http.MethodGet, c.baseURL+endpoint+"?"+params.Encode(), resource, accept, nil, out)
+	if err != nil {
+		return "", fmt.Errorf("github %s: %w", endpoint, err)
+	}
+	if strings.Contains(header.Get("Link"), `rel="next"`) {
+		return strconv.Itoa(page + 1), nil
+	}
+	return "", nil
+}
+
+// discussionsQuery finds discussions with the GraphQL search, which unlike
+// the REST search covers them.
+const discussionsQuery = `query($q: String!, $first: Int!, $after: String) {
+  search(query: $q, type: DISCUSSION, first: $first, after: $after) {
+    pageInfo { hasNextPage endCursor }
+    nodes {
+      ... on Discussion {
+        number title bodyText url closed isAnswered createdAt updatedAt
+        author { login }
+        repository { nameWithOwner }
+        labels(first: 10) { nodes { name } }
+        comments { totalCount }
+      }
+    }
+  }
+}`
+
+// SearchDiscussions searches discussions over GraphQL. The cursor is
+// GraphQL's end cursor.
+func (c *APIClient) SearchDiscussions(ctx context.Context, req SearchRequest) ([]Item, string, error) {
+	vars := map[string]any{"q": req.Query, "first": perPage(req.PerPage)}
+	if req.Cursor != "" {
+		vars["after"] = req.Cursor
+	}
+	var resp struct {
+		Data struct {
+			Search struct {
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+				Nodes []struct {
+					Number     int       `json:"number"`
+					Title      string    `json:"title"`
+					BodyText   string    `json:"bodyText"`
+					URL        string    `json:"url"`
+					Closed     bool      `json:"closed"`
+					IsAnswered bool      `json:"isAnswered"`
+					CreatedAt  time.Time `json:"createdAt"`
+					UpdatedAt  time.Time `json:"updatedAt"`
+					Author     struct {
+						Login string `json:"login"`
+					} `json:"author"`
+					Repository struct {
+						NameWithOwner string `json:"nameWithOwner"`
+					} `json:"repository"`
+					Labels struct {
+						Nodes []struct {
+							Name string `json:"name"`
+						} `json:"nodes"`
+					} `json:"labels"`
+					Comments struct {
+						TotalCount int `json:"totalCount"`
+					} `json:"comments"`
+				} `json:"nodes"`
+			} `json:"search"`
+		} `json:"data"`
+		Errors []struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	body := map[string]any{"query": discussionsQuery, "variables": vars}
+	_, err := c.do(ctx, http.MethodPost, c.graphQLURL, resourceGraphQL, "application/json", body, &resp)
+	if err == nil && len(resp.Errors) > 0 {
+		// GraphQL reports most failures with HTTP 200.
+		err = errors.New(resp.Errors[0].Message)
+		if resp.Errors[0].Type == "RATE_LIMITED" {
+			err = c.rateLimited(resourceGraphQL)
+		}
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("github graphql: %w", err)
+	}
+
+	search := resp.Data.Search
+	items := make([]Item, 0, len(search.Nodes))
+	for _, n := range search.Nodes {
+		if n.URL == "" {
+			continue // a node of another type
+		}
+		item := Item{
+			Repository: n.Repository.NameWithOwner,
+			Number:     n.Number,
+			Discussion: true,
+			Title:      n.Title,
+			Body:       n.BodyText,
+			URL:        n.URL,
+			State:      "open",
+			Author:     n.Author.Login,
+			Comments:   n.Comments.TotalCount,
+			CreatedAt:  n.CreatedAt,
+			UpdatedAt:  n.UpdatedAt,
+		}
+		switch {
+		case n.IsAnswered:
+			item.State = "answered"
+		case n.Closed:
+			item.State = "closed"
+		}
+		for _, l := range n.Labels.Nodes {
+			item.Labels = append(item.Labels, l.Name)
+		}
+		items = append(items, item)
+	}
+	var next string
+	if search.PageInfo.HasNextPage {
+		next = search.PageInfo.EndCursor
+	}
+	return items, next, nil
+}
+
+// do sends a request and decodes the JSON response into out, returning
+// the response's header. A non-nil body is sent as JSON. Requests for a
+// resource whose rate limit is exhausted fail without being sent.
+func (c *APIClient) do(ctx context.Context, method, u, resource, accept string, body, out any) (http.Header, error) {
+	if err := c.checkRateLimit(resource); err != nil {
+		return nil, err
+	}
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", accept)
+	req.Header.Set("X-GitHub-Api-Version", apiVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	c.recordRateLimit(resource, resp.Header)
+
+	// GitHub answers 403 or 429 when a limit is exceeded: the primary one
+	// when no requests remain, a secondary one (for bursts) otherwise.
+	if resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusForbidden && (resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != "") {
+		return nil, c.rateLimited(resource)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Errors carry a message, and validation errors details.
+		var apiErr struct {
+			Message string `json:"message"`
+			Errors  []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Message != "" {
+			msg := apiErr.Message
+			for _, e := range apiErr.Errors {
+				if e.Message != "" {
+					msg += ": " + e.Message
+				}
+			}
+			return nil, fmt.Errorf("%s: %s", resp.Status, msg)
+		}
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return resp.Header, nil
+}
+
+// recordRateLimit notes when a resource's rate limit resets if a response
+// says no requests remain, or when to retry if it says to wait, as
+// responses refused by a secondary limit do.
+func (c *APIClient) recordRateLimit(resource string, header http.Header) {
+	if wait, ok := retryAfter(header.Get("Retry-After")); ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.exhausted[resource] = time.Now().Add(wait)
+		return
+	}
+	if header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	if r := header.Get("X-RateLimit-Resource"); r != "" {
+		resource = r
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exhausted[resource] = time.Unix(reset, 0)
+}
+
+// retryAfter parses a Retry-After header, a number of seconds or an HTTP
+// date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
+
+// checkRateLimit fails if resource's rate limit is exhausted.
+func (c *APIClient) checkRateLimit(resource string) error {
+	c.mu.Lock()
+	reset, ok := c.exhausted[resource]
+	c.mu.Unlock()
+	if !ok || !time.Now().Before(reset) {
+		return nil
+	}
+	return fmt.Errorf("%w, retry after %ds", ErrRateLimited, retrySeconds(time.Until(reset)))
+}
+
+// rateLimited returns the error for a response refused by a rate limit,
+// with the wait recorded from the response when it gave one.
+func (c *APIClient) rateLimited(resource string) error {
+	if err := c.checkRateLimit(resource); err != nil {
+		return err
+	}
+	return ErrRateLimited
+}
+
+// retrySeconds rounds a wait up to whole seconds.
+func retrySeconds(d time.Duration) int {
+	return max(int((d+time.Second-1)/time.Second), 1)
+}
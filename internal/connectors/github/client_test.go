@@ -0,0 +1,254 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient returns an APIClient whose requests go to handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *APIClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return NewAPIClient("ghp_test", srv.Client()).WithBaseURL(srv.URL)
+}
+
+func TestNewAPIClient_WithBaseURL(t *testing.T) {
+	c := NewAPIClient("ghp_test", nil)
+	assert.Equal(t, "https://api.github.com/", c.baseURL)
+	assert.Equal(t, "https://api.github.com/graphql", c.graphQLURL)
+
+	c.WithBaseURL("https://github.example.com/api/v3")
+	assert.Equal(t, "https://github.example.com/api/v3/", c.baseURL)
+	assert.Equal(t, "https://github.example.com/api/graphql", c.graphQLURL)
+}
+
+func TestSearchIssues_Success(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/search/issues", r.URL.Path)
+		assert.Equal(t, "Bearer ghp_test", r.Header.Get("Authorization"))
+		assert.Equal(t, apiVersion, r.Header.Get("X-GitHub-Api-Version"))
+		assert.Equal(t, "cache author:alice", r.URL.Query().Get("q"))
+		assert.Equal(t, "5", r.URL.Query().Get("per_page"))
+		assert.Equal(t, "2", r.URL.Query().Get("page"))
+		w.Header().Set("Link", `<https://api.github.com/search/issues?q=x&page=3>; rel="next", <https://api.github.com/search/issues?q=x&page=9>; rel="last"`)
+		fmt.Fprint(w, `{"total_count": 2, "items": [
+			{"number": 12, "title": "Cache eviction", "body": "Entries never expire.", "state": "open",
+			 "html_url": "https://github.com/acme/api/issues/12", "repository_url": "https://api.github.com/repos/acme/api",
+			 "user": {"login": "alice"}, "labels": [{"name": "bug"}, {"name": "p1"}], "comments": 3,
+			 "created_at": "2024-03-01T09:00:00Z", "updated_at": "2024-03-02T10:00:00Z"},
+			{"number": 13, "title": "Add cache", "state": "closed", "html_url": "https://github.com/acme/api/pull/13",
+			 "repository_url": "https://api.github.com/repos/acme/api", "user": {"login": "alice"},
+			 "created_at": "2024-03-03T09:00:00Z", "updated_at": "2024-03-04T10:00:00Z",
+			 "pull_request": {"merged_at": "2024-03-04T10:00:00Z"}}
+		]}`)
+	})
+
+	items, next, err := c.SearchIssues(context.Background(), SearchRequest{Query: "cache author:alice", PerPage: 5, Cursor: "2"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "3", next)
+	require.Len(t, items, 2)
+	assert.Equal(t, Item{
+		Repository: "acme/api",
+		Number:     12,
+		Title:      "Cache eviction",
+		Body:       "Entries never expire.",
+		URL:        "https://github.com/acme/api/issues/12",
+		State:      "open",
+		Author:     "alice",
+		Labels:     []string{"bug", "p1"},
+		Comments:   3,
+		CreatedAt:  time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		UpdatedAt:  time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC),
+	}, items[0])
+	assert.True(t, items[1].PullRequest)
+	assert.Equal(t, "merged", items[1].State)
+}
+
+func TestSearchIssues_LastPage(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "20", r.URL.Query().Get("per_page"))
+		assert.Equal(t, "1", r.URL.Query().Get("page"))
+		fmt.Fprint(w, `{"items": []}`)
+	})
+
+	items, next, err := c.SearchIssues(context.Background(), SearchRequest{Query: "x"})
+	require.NoError(t, err)
+	assert.Empty(t, items)
+	assert.Empty(t, next)
+
+	_, _, err = c.SearchIssues(context.Background(), SearchRequest{Query: "x", Cursor: "zero"})
+	assert.EqualError(t, err, `github search/issues: invalid cursor "zero"`)
+}
+
+func TestSearchIssues_APIError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"message": "Validation Failed", "errors": [{"message": "The listed users cannot be searched"}]}`)
+	})
+
+	_, _, err := c.SearchIssues(context.Background(), SearchRequest{Query: "author:nobody"})
+	assert.EqualError(t, err, "github search/issues: 422 Unprocessable Entity: Validation Failed: The listed users cannot be searched")
+}
+
+func TestSearchIssues_RateLimited(t *testing.T) {
+	reset := time.Now().Add(90 * time.Second).Unix()
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		w.Header().Set("X-RateLimit-Resource", "search")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "API rate limit exceeded"}`)
+	})
+
+	_, _, err := c.SearchIssues(context.Background(), SearchRequest{Query: "x"})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.Regexp(t, `retry after (89|90)s$`, err.Error())
+
+	_, _, err = c.SearchIssues(context.Background(), SearchRequest{Query: "x"})
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.Equal(t, 1, calls, "no requests are sent until the limit resets")
+}
+
+func TestSearchIssues_SecondaryRateLimit(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "25")
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "You have exceeded a secondary rate limit"}`)
+	})
+
+	_, _, err := c.SearchIssues(context.Background(), SearchRequest{Query: "x"})
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.EqualError(t, err, "github search/issues: github rate limit exceeded, retry after 60s")
+}
+
+func TestSearchIssues_RetryAfter(t *testing.T) {
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, _, err := c.SearchIssues(context.Background(), SearchRequest{Query: "x"})
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	_, _, err = c.SearchIssues(context.Background(), SearchRequest{Query: "x"})
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.Regexp(t, `retry after (29|30)s$`, err.Error())
+	assert.Equal(t, 1, calls, "no requests are sent until the wait is over")
+}
+
+func TestSearchIssues_RateLimitedWithoutWait(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, _, err := c.SearchIssues(context.Background(), SearchRequest{Query: "x"})
+	assert.EqualError(t, err, "github search/issues: github rate limit exceeded")
+}
+
+func TestSearchIssues_LastRequestBeforeTheLimit(t *testing.T) {
+	reset := time.Now().Add(time.Minute).Unix()
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		fmt.Fprint(w, `{"items": []}`)
+	})
+
+	_, _, err := c.SearchIssues(context.Background(), SearchRequest{Query: "x"})
+	require.NoError(t, err)
+	_, _, err = c.SearchIssues(context.Background(), SearchRequest{Query: "x"})
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	_, _, err = c.SearchCode(context.Background(), SearchRequest{Query: "x"})
+	require.NoError(t, err, "code search has its own limit")
+	assert.Equal(t, 2, calls)
+}
+
+func TestSearchCode_Success(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/search/code", r.URL.Path)
+		assert.Equal(t, "application/vnd.github.text-match+json", r.Header.Get("Accept"))
+		assert.Equal(t, "evict repo:acme/api", r.URL.Query().Get("q"))
+		fmt.Fprint(w, `{"items": [{"name": "cache.go", "path": "internal/cache/cache.go",
+			"html_url": "https://github.com/acme/api/blob/abc/internal/cache/cache.go",
+			"repository": {"full_name": "acme/api"},
+			"text_matches": [{"fragment": "func evict()"}, {"fragment": "// evict old entries"}]}]}`)
+	})
+
+	items, next, err := c.SearchCode(context.Background(), SearchRequest{Query: "evict repo:acme/api"})
+
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	assert.Equal(t, []Item{{
+		Repository: "acme/api",
+		Path:       "internal/cache/cache.go",
+		URL:        "https://github.com/acme/api/blob/abc/internal/cache/cache.go",
+		Body:       "func evict() … // evict old entries",
+	}}, items)
+}
+
+func TestSearchDiscussions_Success(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/graphql", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+		var req struct {
+			Query     string         `json:"query"`
+			Variables map[string]any `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Contains(t, req.Query, "type: DISCUSSION")
+		assert.Equal(t, map[string]any{"q": "roadmap", "first": float64(20), "after": "Y3Vyc29yOjE="}, req.Variables)
+		fmt.Fprint(w, `{"data": {"search": {"pageInfo": {"hasNextPage": true, "endCursor": "Y3Vyc29yOjI="}, "nodes": [
+			{"number": 7, "title": "2025 roadmap", "bodyText": "What should we build?", "url": "https://github.com/acme/api/discussions/7",
+			 "closed": false, "isAnswered": true, "createdAt": "2024-03-01T09:00:00Z", "updatedAt": "2024-03-02T10:00:00Z",
+			 "author": {"login": "bob"}, "repository": {"nameWithOwner": "acme/api"},
+			 "labels": {"nodes": [{"name": "planning"}]}, "comments": {"totalCount": 4}},
+			{}
+		]}}}`)
+	})
+
+	items, next, err := c.SearchDiscussions(context.Background(), SearchRequest{Query: "roadmap", Cursor: "Y3Vyc29yOjE="})
+
+	require.NoError(t, err)
+	assert.Equal(t, "Y3Vyc29yOjI=", next)
+	assert.Equal(t, []Item{{
+		Repository: "acme/api",
+		Number:     7,
+		Discussion: true,
+		Title:      "2025 roadmap",
+		Body:       "What should we build?",
+		URL:        "https://github.com/acme/api/discussions/7",
+		State:      "answered",
+		Author:     "bob",
+		Labels:     []string{"planning"},
+		Comments:   4,
+		CreatedAt:  time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		UpdatedAt:  time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC),
+	}}, items)
+}
+
+func TestSearchDiscussions_GraphQLError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"errors": [{"type": "INSUFFICIENT_SCOPES", "message": "Your token has not been granted the required scopes"}]}`)
+	})
+
+	_, _, err := c.SearchDiscussions(context.Background(), SearchRequest{Query: "roadmap"})
+	assert.EqualError(t, err, "github graphql: Your token has not been granted the required scopes")
+}
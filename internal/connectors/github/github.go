@@ -0,0 +1,382 @@
+// Package github searches GitHub issues, pull requests, discussions and
+// code with a personal access token, using GitHub's search APIs.
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+// MIME types of GitHub results. type:issue, type:pr and type:discussion
+// select the first three; code is text.
+const (
+	mimeTypeIssue       = "application/vnd.github.issue"
+	mimeTypePullRequest = "application/vnd.github.pull-request"
+	mimeTypeDiscussion  = "application/vnd.github.discussion"
+	mimeTypeCode        = "text/plain"
+)
+
+// Kinds of search, each its own API call.
+const (
+	KindIssues      = "issues"
+	KindCode        = "code"
+	KindDiscussions = "discussions"
+)
+
+// Kinds lists the kinds of search, in the order results are returned.
+var Kinds = []string{KindIssues, KindCode, KindDiscussions}
+
+// kindMIMETypes are the MIME types of each kind's results.
+var kindMIMETypes = map[string][]string{
+	KindIssues:      {mimeTypeIssue, mimeTypePullRequest},
+	KindCode:        {mimeTypeCode},
+	KindDiscussions: {mimeTypeDiscussion},
+}
+
+// Item is an issue, pull request, discussion or file found by a search.
+type Item struct {
+	// Repository is the owner/name of the item's repository.
+	Repository string
+	// Number is the issue, pull request or discussion number; it is zero
+	// for files.
+	Number int
+	// PullRequest is true for pull requests, which the issues search
+	// returns alongside issues.
+	PullRequest bool
+	Discussion  bool
+	Title       string
+	// Body is the item's text: an issue's description, or the fragments
+	// of a file that matched.
+	Body string
+	URL  string
+	// State is "open", "closed", "merged" (pull requests) or "answered"
+	// (discussions). It is empty for files.
+	State     string
+	Author    string
+	Labels    []string
+	Comments  int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Path is a file's path in its repository.
+	Path string
+}
+
+// SearchRequest is one call to a search API.
+type SearchRequest struct {
+	// Query is in GitHub's search syntax.
+	Query   string
+	PerPage int
+	// Cursor is "" for the first page, and otherwise the cursor the
+	// previous page returned.
+	Cursor string
+}
+
+// GitHubClient abstracts the GitHub API for testability. Each method
+// returns one page of results and the cursor for the next ("" when there
+// are no more).
+type GitHubClient interface {
+	SearchIssues(ctx context.Context, req SearchRequest) ([]Item, string, error)
+	SearchCode(ctx context.Context, req SearchRequest) ([]Item, string, error)
+	SearchDiscussions(ctx context.Context, req SearchRequest) ([]Item, string, error)
+}
+
+// Connector implements connectors.Connector for GitHub.
+type Connector struct {
+	client GitHubClient
+	name   string
+	kinds  []string
+	// scope holds the repo: and org: qualifiers added to every search.
+	scope []string
+}
+
+// NewConnector creates a GitHub connector with the given client. It
+// searches issues and pull requests until WithKinds says otherwise.
+func NewConnector(client GitHubClient) *Connector {
+	return &Connector{client: client, name: "github", kinds: []string{KindIssues}}
+}
+
+// WithName sets the name the connector reports and stamps on its results.
+// It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+// WithKinds sets the kinds of search to run, from Kinds. It returns c.
+func (c *Connector) WithKinds(kinds ...string) *Connector {
+	c.kinds = nil
+	for _, k := range Kinds {
+		for _, want := range kinds {
+			if want == k {
+				c.kinds = append(c.kinds, k)
+				break
+			}
+		}
+	}
+	return c
+}
+
+// WithRepos limits searches to the given owner/name repositories, and
+// WithOrgs to the repositories of the given users or organizations; the
+// two combine as alternatives. They return c.
+func (c *Connector) WithRepos(repos ...string) *Connector {
+	for _, r := range repos {
+		c.scope = append(c.scope, "repo:"+r)
+	}
+	return c
+}
+
+func (c *Connector) WithOrgs(orgs ...string) *Connector {
+	for _, o := range orgs {
+		c.scope = append(c.scope, "org:"+o)
+	}
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the search query sent for each kind of search.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	exp := connectors.Explanation{Params: map[string]string{"per_page": strconv.Itoa(perPage(req.Limit))}}
+	for _, kind := range c.kinds {
+		native, _, ok := c.buildSearchQuery(parsed, kind)
+		if !ok {
+			exp.Params[kind] = "skipped: the query cannot match " + kind
+			continue
+		}
+		if exp.Query == "" {
+			exp.Query = native
+		}
+		exp.Params[kind] = native
+	}
+	return exp, nil
+}
+
+// Search runs each configured kind of search. A kind that fails is
+// reported as a warning unless they all do.
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	cursors, err := c.decodeCursor(req.Cursor)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+
+	terms := index.Terms(parsed)
+	results := []connectors.Result{}
+	var warnings, failures []string
+	next := make([]string, len(c.kinds))
+	more, searched := false, 0
+	for i, kind := range c.kinds {
+		if req.Cursor != "" && cursors[i] == "" {
+			continue // this kind has no more pages
+		}
+		native, w, ok := c.buildSearchQuery(parsed, kind)
+		if !ok {
+			continue
+		}
+		warnings = append(warnings, w...)
+		searched++
+		sr := SearchRequest{Query: native, PerPage: perPage(req.Limit), Cursor: cursors[i]}
+		var items []Item
+		switch kind {
+		case KindIssues:
+			items, next[i], err = c.client.SearchIssues(ctx, sr)
+		case KindCode:
+			items, next[i], err = c.client.SearchCode(ctx, sr)
+		case KindDiscussions:
+			items, next[i], err = c.client.SearchDiscussions(ctx, sr)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", kind, err))
+			continue
+		}
+		for _, item := range items {
+			results = append(results, c.toResult(item, terms))
+		}
+		more = more || next[i] != ""
+	}
+	if len(failures) > 0 && len(failures) == searched {
+		return connectors.Page{}, fmt.Errorf("github search: %s", strings.Join(failures, "; "))
+	}
+
+	page := connectors.Page{Results: results, Warnings: append(uniq(warnings), failures...)}
+	if more {
+		page.NextCursor = encodeCursor(next)
+	}
+	return page, nil
+}
+
+// uniq drops repeated warnings, which each kind of search reports again.
+func uniq(warnings []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, w := range warnings {
+		if !seen[w] {
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// A cursor holds the next page cursor of each kind of search, in order;
+// kinds with no more pages have "".
+func encodeCursor(cursors []string) string {
+	data, _ := json.Marshal(cursors)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (c *Connector) decodeCursor(cursor string) ([]string, error) {
+	cursors := make([]string, len(c.kinds))
+	if cursor == "" {
+		return cursors, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &cursors)
+	}
+	if err != nil || len(cursors) != len(c.kinds) {
+		return nil, fmt.Errorf("invalid github cursor %q", cursor)
+	}
+	return cursors, nil
+}
+
+// buildSearchQuery translates a pkb query into GitHub search syntax for
+// one kind of search. Warnings list the clauses that are ignored. ok is
+// false when the kind's results cannot match the query: code search
+// cannot filter by author, date or title, so such queries skip it.
+func (c *Connector) buildSearchQuery(q query.Query, kind string) (native string, warnings []string, ok bool) {
+	var terms, titles, qualifiers []string
+	mimeTypes := map[string]bool{}
+	for _, m := range kindMIMETypes[kind] {
+		mimeTypes[m] = true
+	}
+	for _, cl := range q.Clauses {
+		value := cl.Value
+		if cl.Phrase || strings.ContainsAny(value, " \t") {
+			value = `"` + value + `"`
+		}
+		switch cl.Field {
+		case query.FieldText:
+			switch {
+			case !cl.Negated:
+				terms = append(terms, value)
+			case kind == KindCode:
+				warnings = append(warnings, query.Unsupported(cl))
+			default:
+				qualifiers = append(qualifiers, "NOT "+value)
+			}
+		case query.FieldTitle:
+			if kind == KindCode {
+				return "", nil, false
+			}
+			if cl.Negated {
+				warnings = append(warnings, query.Unsupported(cl))
+				continue
+			}
+			titles = append(titles, value)
+		case query.FieldFrom:
+			if kind == KindCode {
+				return "", nil, false
+			}
+			qualifier := "author:" + value
+			if cl.Negated {
+				qualifier = "-" + qualifier
+			}
+			qualifiers = append(qualifiers, qualifier)
+		case query.FieldAfter, query.FieldBefore:
+			if kind == KindCode {
+				return "", nil, false
+			}
+			if cl.Field == query.FieldAfter {
+				qualifiers = append(qualifiers, "updated:>="+cl.Value)
+			} else {
+				qualifiers = append(qualifiers, "updated:<"+cl.Value)
+			}
+		case query.FieldType:
+			// Drop the result types the clause rules out.
+			for m := range mimeTypes {
+				if query.MatchesMIMEType(cl.Value, m) == cl.Negated {
+					delete(mimeTypes, m)
+				}
+			}
+		}
+		// source: is resolved by the search engine.
+	}
+	if len(mimeTypes) == 0 {
+		return "", nil, false
+	}
+	if kind == KindIssues && len(mimeTypes) == 1 {
+		if mimeTypes[mimeTypeIssue] {
+			qualifiers = append(qualifiers, "is:issue")
+		} else {
+			qualifiers = append(qualifiers, "is:pr")
+		}
+	}
+	// in:title applies to every word, so title: clauses are only exact
+	// without other free text.
+	if len(titles) > 0 {
+		if len(terms) == 0 {
+			terms, qualifiers = titles, append(qualifiers, "in:title")
+		} else {
+			terms = append(terms, titles...)
+			warnings = append(warnings, "title: also matched bodies and comments, since the query has other words")
+		}
+	}
+	if kind == KindCode && len(terms) == 0 {
+		return "", nil, false // code search needs words to look for
+	}
+	return strings.Join(append(append(terms, qualifiers...), c.scope...), " "), warnings, true
+}
+
+func (c *Connector) toResult(item Item, terms []string) connectors.Result {
+	r := connectors.Result{
+		Title:      item.Title,
+		Snippet:    index.Snippet(item.Body, terms),
+		URL:        item.URL,
+		Source:     c.name,
+		ID:         fmt.Sprintf("%s#%d", item.Repository, item.Number),
+		CreatedAt:  item.CreatedAt,
+		ModifiedAt: item.UpdatedAt,
+		Author:     item.Author,
+		MimeType:   mimeTypeIssue,
+		Metadata:   map[string]string{"repository": item.Repository},
+	}
+	switch {
+	case item.Path != "":
+		r.Title = item.Path
+		r.ID = item.Repository + ":" + item.Path
+		r.MimeType = mimeTypeCode
+		r.Metadata["path"] = item.Path
+		return r
+	case item.PullRequest:
+		r.MimeType = mimeTypePullRequest
+	case item.Discussion:
+		r.MimeType = mimeTypeDiscussion
+	}
+	r.Metadata["number"] = strconv.Itoa(item.Number)
+	r.Metadata["state"] = item.State
+	r.Metadata["comments"] = strconv.Itoa(item.Comments)
+	if len(item.Labels) > 0 {
+		r.Metadata["labels"] = strings.Join(item.Labels, ", ")
+	}
+	return r
+}
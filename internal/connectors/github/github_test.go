@@ -0,0 +1,218 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockGitHubClient implements GitHubClient for testing.
+type MockGitHubClient struct {
+	mock.Mock
+}
+
+func (m *MockGitHubClient) SearchIssues(ctx context.Context, req SearchRequest) ([]Item, string, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).([]Item), args.String(1), args.Error(2)
+}
+
+func (m *MockGitHubClient) SearchCode(ctx context.Context, req SearchRequest) ([]Item, string, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).([]Item), args.String(1), args.Error(2)
+}
+
+func (m *MockGitHubClient) SearchDiscussions(ctx context.Context, req SearchRequest) ([]Item, string, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).([]Item), args.String(1), args.Error(2)
+}
+
+var (
+	cacheIssue = Item{
+		Repository: "acme/api",
+		Number:     12,
+		Title:      "Cache eviction",
+		Body:       "Entries in the cache never expire, so memory grows without bound.",
+		URL:        "https://github.com/acme/api/issues/12",
+		State:      "open",
+		Author:     "alice",
+		Labels:     []string{"bug", "p1"},
+		Comments:   3,
+		CreatedAt:  time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		UpdatedAt:  time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC),
+	}
+	cachePR = Item{
+		Repository:  "acme/api",
+		Number:      13,
+		PullRequest: true,
+		Title:       "Expire cache entries",
+		URL:         "https://github.com/acme/api/pull/13",
+		State:       "merged",
+		Author:      "bob",
+	}
+	cacheFile = Item{
+		Repository: "acme/api",
+		Path:       "internal/cache/cache.go",
+		URL:        "https://github.com/acme/api/blob/abc/internal/cache/cache.go",
+		Body:       "func evict()",
+	}
+)
+
+func TestConnector_Name(t *testing.T) {
+	assert.Equal(t, "github", NewConnector(nil).Name())
+	assert.Equal(t, "work-github", NewConnector(nil).WithName("work-github").Name())
+}
+
+func TestBuildSearchQuery(t *testing.T) {
+	c := NewConnector(nil).WithRepos("acme/api").WithOrgs("acme-labs")
+	tests := []struct {
+		query  string
+		kind   string
+		want   string
+		warned bool
+	}{
+		{`cache "memory leak" -flaky`, KindIssues, `cache "memory leak" NOT flaky repo:acme/api org:acme-labs`, false},
+		{`cache from:alice -from:bot after:2024-01-01 before:2024-02-01`, KindIssues,
+			`cache author:alice -author:bot updated:>=2024-01-01 updated:<2024-02-01 repo:acme/api org:acme-labs`, false},
+		{`cache type:pr`, KindIssues, `cache is:pr repo:acme/api org:acme-labs`, false},
+		{`cache -type:pr`, KindIssues, `cache is:issue repo:acme/api org:acme-labs`, false},
+		{`title:"cache eviction"`, KindIssues, `"cache eviction" in:title repo:acme/api org:acme-labs`, false},
+		{`cache title:eviction`, KindDiscussions, `cache eviction repo:acme/api org:acme-labs`, true},
+		{`source:github evict -test`, KindCode, `evict repo:acme/api org:acme-labs`, true},
+		{`evict type:text`, KindCode, `evict repo:acme/api org:acme-labs`, false},
+	}
+	for _, tt := range tests {
+		q, err := query.Parse(tt.query)
+		require.NoError(t, err)
+		got, warnings, ok := c.buildSearchQuery(q, tt.kind)
+		assert.True(t, ok, tt.query)
+		assert.Equal(t, tt.want, got, tt.query)
+		assert.Equal(t, tt.warned, len(warnings) > 0, tt.query)
+	}
+}
+
+func TestBuildSearchQuery_KindsThatCannotMatch(t *testing.T) {
+	c := NewConnector(nil)
+	for _, tt := range []struct{ query, kind string }{
+		{"type:pdf cache", KindIssues},
+		{"type:discussion cache", KindIssues},
+		{"type:issue cache", KindDiscussions},
+		{"type:issue cache", KindCode},
+		{"cache from:alice", KindCode},
+		{"cache after:2024-01-01", KindCode},
+		{"title:cache", KindCode},
+		{"-cache", KindCode},
+	} {
+		q, err := query.Parse(tt.query)
+		require.NoError(t, err)
+		_, _, ok := c.buildSearchQuery(q, tt.kind)
+		assert.False(t, ok, "%s (%s)", tt.query, tt.kind)
+	}
+}
+
+func TestConnector_Search_ReturnsResults(t *testing.T) {
+	mockClient := new(MockGitHubClient)
+	mockClient.On("SearchIssues", mock.Anything, SearchRequest{Query: "cache repo:acme/api", PerPage: 5}).
+		Return([]Item{cacheIssue, cachePR}, "2", nil)
+
+	page, err := NewConnector(mockClient).WithName("gh").WithRepos("acme/api").Search(context.Background(), connectors.Request{Query: "cache", Limit: 5})
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, page.NextCursor)
+	assert.Empty(t, page.Warnings)
+	require.Len(t, page.Results, 2)
+	assert.Equal(t, connectors.Result{
+		Title:      "Cache eviction",
+		Snippet:    "Entries in the cache never expire, so memory grows without bound.",
+		URL:        "https://github.com/acme/api/issues/12",
+		Source:     "gh",
+		ID:         "acme/api#12",
+		CreatedAt:  cacheIssue.CreatedAt,
+		ModifiedAt: cacheIssue.UpdatedAt,
+		Author:     "alice",
+		MimeType:   "application/vnd.github.issue",
+		Metadata: map[string]string{
+			"repository": "acme/api",
+			"number":     "12",
+			"state":      "open",
+			"comments":   "3",
+			"labels":     "bug, p1",
+		},
+	}, page.Results[0])
+	assert.Equal(t, "application/vnd.github.pull-request", page.Results[1].MimeType)
+	assert.Equal(t, "merged", page.Results[1].Metadata["state"])
+
+	mockClient.On("SearchIssues", mock.Anything, SearchRequest{Query: "cache repo:acme/api", PerPage: 5, Cursor: "2"}).
+		Return([]Item{}, "", nil)
+	page, err = NewConnector(mockClient).WithRepos("acme/api").Search(context.Background(), connectors.Request{Query: "cache", Limit: 5, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestConnector_Search_AllKinds(t *testing.T) {
+	mockClient := new(MockGitHubClient)
+	mockClient.On("SearchIssues", mock.Anything, mock.Anything).Return([]Item{cacheIssue}, "", nil)
+	mockClient.On("SearchCode", mock.Anything, mock.Anything).Return([]Item{cacheFile}, "2", nil).Once()
+	mockClient.On("SearchDiscussions", mock.Anything, mock.Anything).Return([]Item{}, "", errors.New("github graphql: forbidden"))
+	c := NewConnector(mockClient).WithKinds(KindDiscussions, KindCode, KindIssues)
+
+	page, err := c.Search(context.Background(), connectors.Request{Query: "cache"})
+
+	require.NoError(t, err)
+	require.Len(t, page.Results, 2)
+	file := page.Results[1]
+	assert.Equal(t, "internal/cache/cache.go", file.Title)
+	assert.Equal(t, "acme/api:internal/cache/cache.go", file.ID)
+	assert.Equal(t, "text/plain", file.MimeType)
+	assert.Equal(t, map[string]string{"repository": "acme/api", "path": "internal/cache/cache.go"}, file.Metadata)
+	assert.Equal(t, []string{"discussions: github graphql: forbidden"}, page.Warnings)
+
+	// Only code search has another page.
+	mockClient.On("SearchCode", mock.Anything, SearchRequest{Query: "cache", PerPage: 20, Cursor: "2"}).Return([]Item{}, "", nil)
+	page, err = c.Search(context.Background(), connectors.Request{Query: "cache", Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Empty(t, page.NextCursor)
+	mockClient.AssertNumberOfCalls(t, "SearchIssues", 1)
+}
+
+func TestConnector_Search_Errors(t *testing.T) {
+	mockClient := new(MockGitHubClient)
+	mockClient.On("SearchIssues", mock.Anything, mock.Anything).Return([]Item{}, "", errors.New("github search/issues: 401 Unauthorized: Bad credentials"))
+	c := NewConnector(mockClient)
+
+	_, err := c.Search(context.Background(), connectors.Request{Query: "cache"})
+	assert.EqualError(t, err, "github search: issues: github search/issues: 401 Unauthorized: Bad credentials")
+
+	_, err = c.Search(context.Background(), connectors.Request{Query: "cache", Cursor: "bogus"})
+	assert.EqualError(t, err, `invalid github cursor "bogus"`)
+}
+
+func TestConnector_Search_QueryThatCannotMatch(t *testing.T) {
+	mockClient := new(MockGitHubClient)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "type:pdf cache"})
+
+	require.NoError(t, err)
+	assert.Empty(t, page.Results)
+	mockClient.AssertNotCalled(t, "SearchIssues", mock.Anything, mock.Anything)
+}
+
+func TestConnector_Explain(t *testing.T) {
+	c := NewConnector(nil).WithKinds(KindIssues, KindCode).WithOrgs("acme")
+
+	exp, err := c.Explain(connectors.Request{Query: "cache from:alice", Limit: 10})
+
+	require.NoError(t, err)
+	assert.Equal(t, "cache author:alice org:acme", exp.Query)
+	assert.Equal(t, map[string]string{
+		"per_page": "10",
+		"issues":   "cache author:alice org:acme",
+		"code":     "skipped: the query cannot match code",
+	}, exp.Params)
+}
@@ -2,10 +2,19 @@ package gmail
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
 	"golang.org/x/oauth2"
 	gm "google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -28,45 +37,252 @@ func NewAPIClient(ctx context.Context, tokenSource oauth2.TokenSource) (*APIClie
 	return &APIClient{service: srv}, nil
 }
 
-func (c *APIClient) SearchMessages(ctx context.Context, query string) ([]Message, error) {
+// buildSearchQuery translates a pkb query into Gmail search operators;
+// every pkb operator has a Gmail equivalent. ok is false when the query can
+// never match a message (e.g. type:pdf), so the API need not be called.
+func buildSearchQuery(q query.Query) (native string, ok bool) {
+	var terms []string
+	for _, c := range q.Clauses {
+		var term string
+		switch c.Field {
+		case query.FieldText:
+			term = quoteTerm(c)
+		case query.FieldTitle:
+			term = "subject:" + quoteTerm(c)
+		case query.FieldFrom:
+			term = "from:" + quoteTerm(c)
+		case query.FieldBefore, query.FieldAfter:
+			term = string(c.Field) + ":" + c.Date().Format("2006/01/02")
+		case query.FieldType:
+			// Every Gmail result is a message, so type: either matches
+			// everything or nothing.
+			if query.MatchesMIMEType(c.Value, mimeTypeMessage) == c.Negated {
+				return "", false
+			}
+			continue
+		default:
+			// source: is resolved by the search engine.
+			continue
+		}
+		if c.Negated {
+			term = "-" + term
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " "), true
+}
+
+// quoteTerm renders a clause value, keeping phrases quoted.
+func quoteTerm(c query.Clause) string {
+	if c.Phrase {
+		return `"` + c.Value + `"`
+	}
+	return c.Value
+}
+
+// metadataHeaders are the headers fetched for each matching message.
+var metadataHeaders = []string{"Subject", "From", "Date"}
+
+// Page size bounds for messages.list. Gmail rejects maxResults above 500.
+const (
+	defaultMaxResults = 20
+	maxMaxResults     = 500
+)
+
+// maxResults clamps a requested result limit to what messages.list accepts,
+// using defaultMaxResults when no limit is given.
+func maxResults(limit int) int64 {
+	switch {
+	case limit <= 0:
+		return defaultMaxResults
+	case limit > maxMaxResults:
+		return maxMaxResults
+	}
+	return int64(limit)
+}
+
+func (c *APIClient) SearchMessages(ctx context.Context, req connectors.Request) ([]Message, string, error) {
+	return c.listMessages(ctx, req.Query, req.Cursor, req.Limit, false)
+}
+
+// ListMessages returns one page of every message in the mailbox. Unlike
+// SearchMessages it fails when a message cannot be fetched, since a
+// crawl that skipped it would never come back for it.
+func (c *APIClient) ListMessages(ctx context.Context, pageToken string, limit int) ([]Message, string, error) {
+	return c.listMessages(ctx, "", pageToken, limit, true)
+}
+
+// listMessages lists one page of messages matching q and fetches each
+// one's metadata. Messages deleted since the listing are always skipped;
+// with strict, any other messages.get error fails the page, otherwise
+// the message is skipped.
+func (c *APIClient) listMessages(ctx context.Context, q, pageToken string, limit int, strict bool) ([]Message, string, error) {
 	call := c.service.Users.Messages.List("me").
-		Q(query).
-		MaxResults(20).
+		Q(q).
+		MaxResults(maxResults(limit)).
 		Context(ctx)
+	if pageToken != "" {
+		call = call.PageToken(pageToken)
+	}
 
 	resp, err := call.Do()
 	if err != nil {
-		return nil, fmt.Errorf("gmail messages.list: %w", err)
+		return nil, "", fmt.Errorf("gmail messages.list: %w", err)
 	}
 
 	messages := make([]Message, 0, len(resp.Messages))
 	for _, m := range resp.Messages {
-		msg, err := c.service.Users.Messages.Get("me", m.Id).
-			Format("metadata").
-			MetadataHeaders("Subject", "From").
-			Context(ctx).
-			Do()
-		if err != nil {
-			continue // skip individual message errors
+		msg, err := c.getMessage(ctx, m.Id, m.ThreadId)
+		var apiErr *googleapi.Error
+		switch {
+		case err == nil:
+			messages = append(messages, msg)
+		case errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound:
+			// Deleted since the listing.
+		case strict:
+			return nil, "", fmt.Errorf("gmail messages.get %s: %w", m.Id, err)
 		}
+	}
+
+	return messages, resp.NextPageToken, nil
+}
 
-		var subject, from string
-		for _, h := range msg.Payload.Headers {
-			switch h.Name {
-			case "Subject":
-				subject = h.Value
-			case "From":
-				from = h.Value
+// getMessage fetches a message's metadata.
+func (c *APIClient) getMessage(ctx context.Context, id, threadID string) (Message, error) {
+	msg, err := c.service.Users.Messages.Get("me", id).
+		Format("metadata").
+		MetadataHeaders(metadataHeaders...).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return Message{}, err
+	}
+
+	var subject, from, date string
+	for _, h := range msg.Payload.Headers {
+		switch h.Name {
+		case "Subject":
+			subject = h.Value
+		case "From":
+			from = h.Value
+		case "Date":
+			date = h.Value
+		}
+	}
+
+	return Message{
+		ID:       id,
+		ThreadID: threadID,
+		Subject:  subject,
+		Snippet:  msg.Snippet,
+		From:     from,
+		Date:     messageDate(date, msg.InternalDate),
+	}, nil
+}
+
+func (c *APIClient) StartHistoryID(ctx context.Context) (uint64, error) {
+	profile, err := c.service.Users.GetProfile("me").Context(ctx).Do()
+	if err != nil {
+		return 0, fmt.Errorf("gmail users.getProfile: %w", err)
+	}
+	return profile.HistoryId, nil
+}
+
+// hiddenLabels are the labels of messages that messages.list leaves out by
+// default, and so Crawl never indexes.
+var hiddenLabels = []string{"SPAM", "TRASH"}
+
+func hidden(labelIDs []string) bool {
+	for _, l := range labelIDs {
+		if slices.Contains(hiddenLabels, l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *APIClient) History(ctx context.Context, startHistoryID uint64, pageToken string) (HistoryPage, error) {
+	call := c.service.Users.History.List("me").
+		StartHistoryId(startHistoryID).
+		HistoryTypes("messageAdded", "messageDeleted", "labelAdded", "labelRemoved").
+		MaxResults(maxMaxResults).
+		Context(ctx)
+	if pageToken != "" {
+		call = call.PageToken(pageToken)
+	}
+	resp, err := call.Do()
+	if err != nil {
+		// Gmail keeps about a week of history and answers 404 for older IDs.
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return HistoryPage{}, fmt.Errorf("gmail history.list: %w: %w", connectors.ErrCursorExpired, err)
+		}
+		return HistoryPage{}, fmt.Errorf("gmail history.list: %w", err)
+	}
+
+	// Reduce the records to each message's final state, in the order the
+	// messages first appear.
+	var order []string
+	deleted := map[string]bool{}
+	threads := map[string]string{}
+	note := func(m *gm.Message, del bool) {
+		if _, ok := deleted[m.Id]; !ok {
+			order = append(order, m.Id)
+		}
+		deleted[m.Id] = del
+		threads[m.Id] = m.ThreadId
+	}
+	for _, h := range resp.History {
+		for _, a := range h.MessagesAdded {
+			note(a.Message, hidden(a.Message.LabelIds))
+		}
+		for _, d := range h.MessagesDeleted {
+			note(d.Message, true)
+		}
+		for _, l := range h.LabelsAdded {
+			if hidden(l.LabelIds) {
+				note(l.Message, true)
+			}
+		}
+		for _, l := range h.LabelsRemoved {
+			if hidden(l.LabelIds) {
+				note(l.Message, hidden(l.Message.LabelIds))
 			}
 		}
+	}
 
-		messages = append(messages, Message{
-			ID:      m.Id,
-			Subject: subject,
-			Snippet: msg.Snippet,
-			From:    from,
-		})
+	page := HistoryPage{NextPageToken: resp.NextPageToken, HistoryID: resp.HistoryId}
+	for _, id := range order {
+		if deleted[id] {
+			page.Changes = append(page.Changes, MessageChange{ID: id, Deleted: true})
+			continue
+		}
+		msg, err := c.getMessage(ctx, id, threads[id])
+		var apiErr *googleapi.Error
+		switch {
+		case errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound:
+			// Deleted again since this history record.
+			page.Changes = append(page.Changes, MessageChange{ID: id, Deleted: true})
+		case err != nil:
+			// Unlike search, a skipped message would be lost for good once
+			// the cursor moves past it, so fail and let the sync retry.
+			return HistoryPage{}, fmt.Errorf("gmail messages.get %s: %w", id, err)
+		default:
+			page.Changes = append(page.Changes, MessageChange{ID: id, Message: msg})
+		}
 	}
+	return page, nil
+}
 
-	return messages, nil
+// messageDate parses the Date header, falling back to Gmail's internal
+// receive timestamp (milliseconds since the epoch) when the header is
+// missing or malformed.
+func messageDate(header string, internalDate int64) time.Time {
+	if t, err := mail.ParseDate(header); err == nil {
+		return t
+	}
+	if internalDate > 0 {
+		return time.UnixMilli(internalDate).UTC()
+	}
+	return time.Time{}
 }
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
@@ -14,6 +18,38 @@ import (
 	"google.golang.org/api/option"
 )
 
+func TestBuildSearchQuery_Operators(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`budget "exact phrase" -draft`, `budget "exact phrase" -draft`},
+		{`title:"Q1 plan" -title:old`, `subject:"Q1 plan" -subject:old`},
+		{`from:alice -from:"Bob Smith"`, `from:alice -from:"Bob Smith"`},
+		{`after:2024-01-01 before:2024-02-01`, `after:2024/01/01 before:2024/02/01`},
+		{`type:email notes`, `notes`},
+		{`-type:pdf notes`, `notes`},
+		{`source:gmail notes`, `notes`},
+		{`has:attachment`, `has:attachment`},
+	}
+	for _, tt := range tests {
+		q, err := query.Parse(tt.query)
+		require.NoError(t, err)
+		got, ok := buildSearchQuery(q)
+		assert.True(t, ok, tt.query)
+		assert.Equal(t, tt.want, got, tt.query)
+	}
+}
+
+func TestBuildSearchQuery_TypeThatCannotMatch(t *testing.T) {
+	for _, s := range []string{"type:pdf notes", "-type:email"} {
+		q, err := query.Parse(s)
+		require.NoError(t, err)
+		_, ok := buildSearchQuery(q)
+		assert.False(t, ok, s)
+	}
+}
+
 func TestNewAPIClient_Success(t *testing.T) {
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"})
 	client, err := NewAPIClient(context.Background(), ts)
@@ -55,7 +91,7 @@ func TestSearchMessages_Success(t *testing.T) {
 	require.NoError(t, err)
 	client.service.BasePath = srv.URL
 
-	messages, err := client.SearchMessages(context.Background(), "test")
+	messages, _, err := client.SearchMessages(context.Background(), connectors.Request{Query: "test"})
 	require.NoError(t, err)
 	require.Len(t, messages, 1)
 	assert.Equal(t, "msg1", messages[0].ID)
@@ -64,6 +100,70 @@ func TestSearchMessages_Success(t *testing.T) {
 	assert.Equal(t, "sender@example.com", messages[0].From)
 }
 
+func TestSearchMessages_ParsesDateAndThread(t *testing.T) {
+	callCount := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if callCount == 0 {
+			fmt.Fprint(w, `{"messages":[{"id":"msg1","threadId":"t1"},{"id":"msg2","threadId":"t2"}]}`)
+			callCount++
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/msg1") {
+			assert.Contains(t, r.URL.Query()["metadataHeaders"], "Date")
+			fmt.Fprint(w, `{"id":"msg1","payload":{"headers":[{"name":"Date","value":"Tue, 2 Jan 2024 03:04:05 +0000"}]}}`)
+			return
+		}
+		// No Date header: falls back to internalDate.
+		fmt.Fprint(w, `{"id":"msg2","internalDate":"1704164645000","payload":{"headers":[]}}`)
+	}))
+	defer srv.Close()
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"})
+	client, err := NewAPIClient(context.Background(), ts)
+	require.NoError(t, err)
+	client.service.BasePath = srv.URL
+
+	messages, _, err := client.SearchMessages(context.Background(), connectors.Request{Query: "test"})
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, "t1", messages[0].ThreadID)
+	assert.True(t, want.Equal(messages[0].Date))
+	assert.Equal(t, "t2", messages[1].ThreadID)
+	assert.True(t, want.Equal(messages[1].Date))
+}
+
+func TestSearchMessages_Pagination(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/messages") {
+			assert.Equal(t, "5", r.URL.Query().Get("maxResults"))
+			assert.Equal(t, "page-2", r.URL.Query().Get("pageToken"))
+			fmt.Fprint(w, `{"nextPageToken":"page-3","messages":[{"id":"msg1","threadId":"t1"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"msg1","payload":{"headers":[]}}`)
+	}))
+	defer srv.Close()
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"})
+	client, err := NewAPIClient(context.Background(), ts)
+	require.NoError(t, err)
+	client.service.BasePath = srv.URL
+
+	messages, next, err := client.SearchMessages(context.Background(), connectors.Request{Query: "test", Limit: 5, Cursor: "page-2"})
+	require.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "page-3", next)
+}
+
+func TestMaxResults(t *testing.T) {
+	assert.Equal(t, int64(defaultMaxResults), maxResults(0))
+	assert.Equal(t, int64(7), maxResults(7))
+	assert.Equal(t, int64(maxMaxResults), maxResults(10000))
+}
+
 func TestSearchMessages_ListError(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -75,7 +175,7 @@ func TestSearchMessages_ListError(t *testing.T) {
 	require.NoError(t, err)
 	client.service.BasePath = srv.URL
 
-	_, err = client.SearchMessages(context.Background(), "test")
+	_, _, err = client.SearchMessages(context.Background(), connectors.Request{Query: "test"})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "gmail messages.list")
 }
@@ -98,7 +198,120 @@ func TestSearchMessages_GetError_SkipsMessage(t *testing.T) {
 	require.NoError(t, err)
 	client.service.BasePath = srv.URL
 
-	messages, err := client.SearchMessages(context.Background(), "test")
+	messages, _, err := client.SearchMessages(context.Background(), connectors.Request{Query: "test"})
 	require.NoError(t, err)
 	assert.Empty(t, messages, "should skip messages that fail to fetch")
 }
+
+func TestListMessages_GetError_FailsPage(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/messages"):
+			fmt.Fprint(w, `{"messages":[{"id":"gone","threadId":"t1"},{"id":"busy","threadId":"t2"}],"nextPageToken":"p2"}`)
+		case strings.HasSuffix(r.URL.Path, "/gone"):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+
+	_, _, err := client.ListMessages(context.Background(), "", 100)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "gmail messages.get busy")
+}
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *APIClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test"})
+	client, err := NewAPIClient(context.Background(), ts)
+	require.NoError(t, err)
+	client.service.BasePath = srv.URL
+	return client
+}
+
+func TestStartHistoryID(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/users/me/profile"), r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"emailAddress":"me@example.com","historyId":"4242"}`)
+	})
+
+	id, err := client.StartHistoryID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4242), id)
+}
+
+func TestHistory(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/users/me/history"):
+			assert.Equal(t, "100", r.URL.Query().Get("startHistoryId"))
+			assert.Equal(t, "p2", r.URL.Query().Get("pageToken"))
+			assert.ElementsMatch(t, []string{"messageAdded", "messageDeleted", "labelAdded", "labelRemoved"}, r.URL.Query()["historyTypes"])
+			fmt.Fprint(w, `{"historyId":"180","nextPageToken":"p3","history":[
+				{"id":"101","messagesAdded":[{"message":{"id":"new","threadId":"t1","labelIds":["INBOX"]}}]},
+				{"id":"102","messagesAdded":[{"message":{"id":"spam","threadId":"t2","labelIds":["SPAM"]}}]},
+				{"id":"103","messagesDeleted":[{"message":{"id":"gone","threadId":"t3"}}]},
+				{"id":"104","labelsAdded":[{"message":{"id":"binned","threadId":"t4","labelIds":["TRASH"]},"labelIds":["TRASH"]}]},
+				{"id":"105","labelsRemoved":[{"message":{"id":"restored","threadId":"t5","labelIds":["INBOX"]},"labelIds":["TRASH"]}]},
+				{"id":"106","labelsAdded":[{"message":{"id":"starred","threadId":"t6","labelIds":["STARRED"]},"labelIds":["STARRED"]}]},
+				{"id":"107","messagesAdded":[{"message":{"id":"vanished","threadId":"t7"}}]},
+				{"id":"108","messagesDeleted":[{"message":{"id":"new","threadId":"t1"}}]},
+				{"id":"109","messagesAdded":[{"message":{"id":"new","threadId":"t1"}}]}
+			]}`)
+		case strings.HasSuffix(r.URL.Path, "/messages/new"):
+			fmt.Fprint(w, `{"id":"new","snippet":"hi","payload":{"headers":[{"name":"Subject","value":"Hello"}]}}`)
+		case strings.HasSuffix(r.URL.Path, "/messages/restored"):
+			fmt.Fprint(w, `{"id":"restored","payload":{"headers":[{"name":"Subject","value":"Back"}]}}`)
+		case strings.HasSuffix(r.URL.Path, "/messages/vanished"):
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":404,"message":"Not Found"}}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	})
+
+	page, err := client.History(context.Background(), 100, "p2")
+	require.NoError(t, err)
+	assert.Equal(t, "p3", page.NextPageToken)
+	assert.Equal(t, uint64(180), page.HistoryID)
+	assert.Equal(t, []MessageChange{
+		{ID: "new", Message: Message{ID: "new", ThreadID: "t1", Subject: "Hello", Snippet: "hi"}},
+		{ID: "spam", Deleted: true},
+		{ID: "gone", Deleted: true},
+		{ID: "binned", Deleted: true},
+		{ID: "restored", Message: Message{ID: "restored", ThreadID: "t5", Subject: "Back"}},
+		{ID: "vanished", Deleted: true},
+	}, page.Changes, "label changes other than spam and trash are ignored; the last record per message wins")
+}
+
+func TestHistory_ExpiredStartID(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"code":404,"message":"Requested entity was not found."}}`)
+	})
+
+	_, err := client.History(context.Background(), 1, "")
+	assert.ErrorIs(t, err, connectors.ErrCursorExpired)
+}
+
+func TestHistory_GetErrorFailsThePage(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/history") {
+			fmt.Fprint(w, `{"historyId":"2","history":[{"id":"2","messagesAdded":[{"message":{"id":"m1"}}]}]}`)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	_, err := client.History(context.Background(), 1, "")
+	assert.ErrorContains(t, err, "gmail messages.get m1")
+	assert.NotErrorIs(t, err, connectors.ErrCursorExpired)
+}
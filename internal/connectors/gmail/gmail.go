@@ -3,52 +3,205 @@ package gmail
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
 )
 
+// mimeTypeMessage is the MIME type of every Gmail result.
+const mimeTypeMessage = "message/rfc822"
+
 // Message represents an email message returned from the Gmail API.
 type Message struct {
-	ID      string
-	Subject string
-	Snippet string
-	From    string
+	ID       string
+	ThreadID string
+	Subject  string
+	Snippet  string
+	From     string
+	Date     time.Time
+}
+
+// MessageChange is a message that entered or left the mailbox Crawl sees.
+type MessageChange struct {
+	ID string
+	// Deleted is true when the message was deleted or moved to spam or the
+	// trash; Message is only set when it is false.
+	Deleted bool
+	Message Message
+}
+
+// HistoryPage is one page of mailbox history.
+type HistoryPage struct {
+	Changes []MessageChange
+	// NextPageToken is set when more history remains.
+	NextPageToken string
+	// HistoryID is the mailbox's current history ID.
+	HistoryID uint64
 }
 
 // GmailClient abstracts the Gmail API for testability.
 type GmailClient interface {
-	SearchMessages(ctx context.Context, query string) ([]Message, error)
+	// SearchMessages returns one page of matching messages and the token for
+	// the next page ("" when there are no more). req.Query uses Gmail search
+	// operators, as built by buildSearchQuery.
+	SearchMessages(ctx context.Context, req connectors.Request) ([]Message, string, error)
+	// ListMessages returns one page of every message in the mailbox. It
+	// fails rather than skip a message that cannot be fetched.
+	ListMessages(ctx context.Context, pageToken string, limit int) ([]Message, string, error)
+	// StartHistoryID returns the mailbox's current history ID.
+	StartHistoryID(ctx context.Context) (uint64, error)
+	// History returns one page of message changes after startHistoryID.
+	// Errors wrap connectors.ErrCursorExpired when the ID is too old.
+	History(ctx context.Context, startHistoryID uint64, pageToken string) (HistoryPage, error)
 }
 
 // Connector implements connectors.Connector for Gmail.
 type Connector struct {
 	client GmailClient
+	name   string
 }
 
 // NewConnector creates a Gmail connector with the given client.
 func NewConnector(client GmailClient) *Connector {
-	return &Connector{client: client}
+	return &Connector{client: client, name: "gmail"}
+}
+
+// WithName sets the name the connector reports and stamps on its results,
+// so several accounts can be configured side by side. It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
 }
 
 func (c *Connector) Name() string {
-	return "gmail"
+	return c.name
+}
+
+// Explain reports the messages.list query and parameters Search would send.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	native, ok := buildSearchQuery(parsed)
+	if !ok {
+		return connectors.Explanation{Params: map[string]string{
+			"skipped": "type: filter cannot match an email message; the API is not called",
+		}}, nil
+	}
+	params := map[string]string{
+		"maxResults":      strconv.FormatInt(maxResults(req.Limit), 10),
+		"format":          "metadata",
+		"metadataHeaders": strings.Join(metadataHeaders, ","),
+	}
+	if req.Cursor != "" {
+		params["pageToken"] = req.Cursor
+	}
+	return connectors.Explanation{Query: native, Params: params}, nil
 }
 
-func (c *Connector) Search(ctx context.Context, query string) ([]connectors.Result, error) {
-	messages, err := c.client.SearchMessages(ctx, query)
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
 	if err != nil {
-		return nil, fmt.Errorf("gmail search: %w", err)
+		return connectors.Page{}, err
+	}
+	native, ok := buildSearchQuery(parsed)
+	if !ok {
+		return connectors.Page{Results: []connectors.Result{}}, nil
+	}
+	req.Query = native
+
+	messages, next, err := c.client.SearchMessages(ctx, req)
+	if err != nil {
+		return connectors.Page{}, fmt.Errorf("gmail search: %w", err)
 	}
 
 	results := make([]connectors.Result, len(messages))
 	for i, m := range messages {
-		results[i] = connectors.Result{
-			Title:   m.Subject,
-			Snippet: m.Snippet,
-			URL:     fmt.Sprintf("https://mail.google.com/mail/u/0/#inbox/%s", m.ID),
-			Source:  "gmail",
+		results[i] = c.toResult(m)
+	}
+
+	return connectors.Page{Results: results, NextCursor: next}, nil
+}
+
+// crawlPageSize is the messages.list page size used by Crawl. Each message
+// costs a further messages.get call, so pages are kept moderate.
+const crawlPageSize = 100
+
+// Crawl lists every message in the mailbox. Only metadata is fetched, so
+// the message snippet is indexed as the body.
+func (c *Connector) Crawl(ctx context.Context, cursor string) (connectors.CrawlPage, error) {
+	messages, next, err := c.client.ListMessages(ctx, cursor, crawlPageSize)
+	if err != nil {
+		return connectors.CrawlPage{}, fmt.Errorf("gmail crawl: %w", err)
+	}
+	docs := make([]connectors.Document, len(messages))
+	for i, m := range messages {
+		docs[i] = connectors.Document{Result: c.toResult(m), Body: m.Snippet}
+	}
+	return connectors.CrawlPage{Documents: docs, NextCursor: next}, nil
+}
+
+// StartCursor returns the mailbox's current history ID as a cursor.
+func (c *Connector) StartCursor(ctx context.Context) (string, error) {
+	id, err := c.client.StartHistoryID(ctx)
+	if err != nil {
+		return "", fmt.Errorf("gmail history: %w", err)
+	}
+	return strconv.FormatUint(id, 10), nil
+}
+
+// Changes lists messages added or removed since cursor. A cursor is a
+// history ID, optionally followed by ":" and a history.list page token
+// while a walk through several pages is under way.
+func (c *Connector) Changes(ctx context.Context, cursor string) (connectors.ChangePage, error) {
+	idStr, pageToken, _ := strings.Cut(cursor, ":")
+	start, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return connectors.ChangePage{}, fmt.Errorf("gmail history: invalid cursor %q: %w", cursor, connectors.ErrCursorExpired)
+	}
+	hist, err := c.client.History(ctx, start, pageToken)
+	if err != nil {
+		return connectors.ChangePage{}, fmt.Errorf("gmail history: %w", err)
+	}
+
+	var page connectors.ChangePage
+	for _, mc := range hist.Changes {
+		ch := connectors.Change{ID: mc.ID, Deleted: mc.Deleted}
+		if !mc.Deleted {
+			ch.Document = connectors.Document{Result: c.toResult(mc.Message), Body: mc.Message.Snippet}
 		}
+		page.Changes = append(page.Changes, ch)
 	}
+	if hist.NextPageToken != "" {
+		page.NextCursor = idStr + ":" + hist.NextPageToken
+		return page, nil
+	}
+	page.Done = true
+	page.NextCursor = idStr
+	if hist.HistoryID > start {
+		page.NextCursor = strconv.FormatUint(hist.HistoryID, 10)
+	}
+	return page, nil
+}
 
-	return results, nil
+func (c *Connector) toResult(m Message) connectors.Result {
+	r := connectors.Result{
+		Title:      m.Subject,
+		Snippet:    m.Snippet,
+		URL:        fmt.Sprintf("https://mail.google.com/mail/u/0/#inbox/%s", m.ID),
+		Source:     c.name,
+		ID:         m.ID,
+		CreatedAt:  m.Date,
+		ModifiedAt: m.Date,
+		Author:     m.From,
+		MimeType:   mimeTypeMessage,
+	}
+	if m.ThreadID != "" {
+		r.Metadata = map[string]string{"threadId": m.ThreadID}
+	}
+	return r
 }
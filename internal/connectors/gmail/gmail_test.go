@@ -3,8 +3,11 @@ package gmail
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -15,9 +18,24 @@ type MockGmailClient struct {
 	mock.Mock
 }
 
-func (m *MockGmailClient) SearchMessages(ctx context.Context, query string) ([]Message, error) {
-	args := m.Called(ctx, query)
-	return args.Get(0).([]Message), args.Error(1)
+func (m *MockGmailClient) SearchMessages(ctx context.Context, req connectors.Request) ([]Message, string, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).([]Message), args.String(1), args.Error(2)
+}
+
+func (m *MockGmailClient) ListMessages(ctx context.Context, pageToken string, limit int) ([]Message, string, error) {
+	args := m.Called(ctx, pageToken, limit)
+	return args.Get(0).([]Message), args.String(1), args.Error(2)
+}
+
+func (m *MockGmailClient) StartHistoryID(ctx context.Context) (uint64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(uint64), args.Error(1)
+}
+
+func (m *MockGmailClient) History(ctx context.Context, startHistoryID uint64, pageToken string) (HistoryPage, error) {
+	args := m.Called(ctx, startHistoryID, pageToken)
+	return args.Get(0).(HistoryPage), args.Error(1)
 }
 
 func TestConnector_Name(t *testing.T) {
@@ -25,47 +43,203 @@ func TestConnector_Name(t *testing.T) {
 	assert.Equal(t, "gmail", c.Name())
 }
 
+func TestConnector_WithName(t *testing.T) {
+	mockClient := new(MockGmailClient)
+	mockClient.On("SearchMessages", mock.Anything, mock.Anything).Return([]Message{{ID: "m1", Subject: "Hello"}}, "", nil)
+
+	c := NewConnector(mockClient).WithName("work-mail")
+	page, err := c.Search(context.Background(), connectors.Request{Query: "hello"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "work-mail", c.Name())
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "work-mail", page.Results[0].Source)
+}
+
 func TestConnector_Search_ReturnsResults(t *testing.T) {
 	mockClient := new(MockGmailClient)
-	mockClient.On("SearchMessages", mock.Anything, "test query").Return([]Message{
+	mockClient.On("SearchMessages", mock.Anything, connectors.Request{Query: "test query"}).Return([]Message{
 		{ID: "abc123", Subject: "Meeting Notes", Snippet: "Discussion about Q4 planning", From: "alice@example.com"},
 		{ID: "def456", Subject: "Project Update", Snippet: "Sprint review summary", From: "bob@example.com"},
-	}, nil)
+	}, "", nil)
 
 	c := NewConnector(mockClient)
-	results, err := c.Search(context.Background(), "test query")
+	page, err := c.Search(context.Background(), connectors.Request{Query: "test query"})
 
 	require.NoError(t, err)
-	assert.Len(t, results, 2)
-	assert.Equal(t, "Meeting Notes", results[0].Title)
-	assert.Equal(t, "Discussion about Q4 planning", results[0].Snippet)
-	assert.Contains(t, results[0].URL, "abc123")
-	assert.Equal(t, "gmail", results[0].Source)
-	assert.Equal(t, "Project Update", results[1].Title)
+	assert.Len(t, page.Results, 2)
+	assert.Equal(t, "Meeting Notes", page.Results[0].Title)
+	assert.Equal(t, "Discussion about Q4 planning", page.Results[0].Snippet)
+	assert.Contains(t, page.Results[0].URL, "abc123")
+	assert.Equal(t, "gmail", page.Results[0].Source)
+	assert.Equal(t, "Project Update", page.Results[1].Title)
+	mockClient.AssertExpectations(t)
+}
+
+func TestConnector_Search_MapsMetadata(t *testing.T) {
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mockClient := new(MockGmailClient)
+	mockClient.On("SearchMessages", mock.Anything, connectors.Request{Query: "q"}).Return([]Message{
+		{ID: "abc123", ThreadID: "thread9", Subject: "Hi", From: "alice@example.com", Date: date},
+	}, "", nil)
+
+	c := NewConnector(mockClient)
+	page, err := c.Search(context.Background(), connectors.Request{Query: "q"})
+
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "abc123", page.Results[0].ID)
+	assert.Equal(t, "alice@example.com", page.Results[0].Author)
+	assert.Equal(t, date, page.Results[0].CreatedAt)
+	assert.Equal(t, date, page.Results[0].ModifiedAt)
+	assert.Equal(t, "message/rfc822", page.Results[0].MimeType)
+	assert.Equal(t, "thread9", page.Results[0].Metadata["threadId"])
+}
+
+func TestConnector_Search_PassesPagination(t *testing.T) {
+	req := connectors.Request{Query: "q", Limit: 10, Cursor: "tok-1"}
+	mockClient := new(MockGmailClient)
+	mockClient.On("SearchMessages", mock.Anything, req).Return([]Message{{ID: "x"}}, "tok-2", nil)
+
+	c := NewConnector(mockClient)
+	page, err := c.Search(context.Background(), req)
+
+	require.NoError(t, err)
+	assert.Len(t, page.Results, 1)
+	assert.Equal(t, "tok-2", page.NextCursor)
 	mockClient.AssertExpectations(t)
 }
 
 func TestConnector_Search_HandlesEmpty(t *testing.T) {
 	mockClient := new(MockGmailClient)
-	mockClient.On("SearchMessages", mock.Anything, "nothing").Return([]Message{}, nil)
+	mockClient.On("SearchMessages", mock.Anything, connectors.Request{Query: "nothing"}).Return([]Message{}, "", nil)
 
 	c := NewConnector(mockClient)
-	results, err := c.Search(context.Background(), "nothing")
+	page, err := c.Search(context.Background(), connectors.Request{Query: "nothing"})
 
 	require.NoError(t, err)
-	assert.Empty(t, results)
+	assert.Empty(t, page.Results)
 	mockClient.AssertExpectations(t)
 }
 
 func TestConnector_Search_HandlesError(t *testing.T) {
 	mockClient := new(MockGmailClient)
-	mockClient.On("SearchMessages", mock.Anything, "fail").Return([]Message(nil), errors.New("API rate limit"))
+	mockClient.On("SearchMessages", mock.Anything, connectors.Request{Query: "fail"}).Return([]Message(nil), "", errors.New("API rate limit"))
 
 	c := NewConnector(mockClient)
-	results, err := c.Search(context.Background(), "fail")
+	page, err := c.Search(context.Background(), connectors.Request{Query: "fail"})
 
 	assert.Error(t, err)
-	assert.Nil(t, results)
+	assert.Empty(t, page)
 	assert.Contains(t, err.Error(), "API rate limit")
 	mockClient.AssertExpectations(t)
 }
+
+func TestConnector_Search_TranslatesOperators(t *testing.T) {
+	mockClient := new(MockGmailClient)
+	mockClient.On("SearchMessages", mock.Anything, connectors.Request{Query: "subject:budget after:2024/01/01"}).Return([]Message{}, "", nil)
+
+	c := NewConnector(mockClient)
+	_, err := c.Search(context.Background(), connectors.Request{Query: "title:budget after:2024-01-01"})
+
+	require.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func TestConnector_Search_SkipsAPIWhenTypeCannotMatch(t *testing.T) {
+	mockClient := new(MockGmailClient)
+
+	c := NewConnector(mockClient)
+	page, err := c.Search(context.Background(), connectors.Request{Query: "type:pdf budget"})
+
+	require.NoError(t, err)
+	assert.Empty(t, page.Results)
+	mockClient.AssertNotCalled(t, "SearchMessages", mock.Anything, mock.Anything)
+}
+
+func TestConnector_Explain(t *testing.T) {
+	c := NewConnector(nil)
+	exp, err := c.Explain(connectors.Request{Query: "title:budget"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "subject:budget", exp.Query)
+	assert.Equal(t, map[string]string{"maxResults": "20", "format": "metadata", "metadataHeaders": "Subject,From,Date"}, exp.Params)
+}
+
+func TestConnector_Explain_Skipped(t *testing.T) {
+	c := NewConnector(nil)
+	exp, err := c.Explain(connectors.Request{Query: "type:pdf"})
+
+	require.NoError(t, err)
+	assert.Empty(t, exp.Query)
+	assert.Contains(t, exp.Params["skipped"], "type:")
+}
+
+func TestConnector_Crawl(t *testing.T) {
+	mockClient := new(MockGmailClient)
+	mockClient.On("ListMessages", mock.Anything, "", crawlPageSize).Return([]Message{
+		{ID: "m1", ThreadID: "t1", Subject: "Hello", Snippet: "hi there", From: "alice@example.com"},
+	}, "tok-2", nil)
+
+	c := NewConnector(mockClient)
+	page, err := c.Crawl(context.Background(), "")
+
+	require.NoError(t, err)
+	require.Len(t, page.Documents, 1)
+	doc := page.Documents[0]
+	assert.Equal(t, "Hello", doc.Title)
+	assert.Equal(t, "hi there", doc.Body)
+	assert.Equal(t, "t1", doc.Metadata["threadId"])
+	assert.Equal(t, "tok-2", page.NextCursor)
+	mockClient.AssertExpectations(t)
+}
+
+func TestConnector_StartCursor(t *testing.T) {
+	mockClient := new(MockGmailClient)
+	mockClient.On("StartHistoryID", mock.Anything).Return(uint64(4242), nil)
+
+	cursor, err := NewConnector(mockClient).StartCursor(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "4242", cursor)
+}
+
+func TestConnector_Changes(t *testing.T) {
+	mockClient := new(MockGmailClient)
+	mockClient.On("History", mock.Anything, uint64(100), "").Return(HistoryPage{
+		Changes: []MessageChange{
+			{ID: "m1", Message: Message{ID: "m1", Subject: "New", Snippet: "hello"}},
+			{ID: "m2", Deleted: true},
+		},
+		NextPageToken: "p2",
+		HistoryID:     180,
+	}, nil)
+	mockClient.On("History", mock.Anything, uint64(100), "p2").Return(HistoryPage{HistoryID: 180}, nil)
+	c := NewConnector(mockClient)
+
+	page, err := c.Changes(context.Background(), "100")
+	require.NoError(t, err)
+	assert.False(t, page.Done)
+	assert.Equal(t, "100:p2", page.NextCursor, "later pages keep the start ID")
+	require.Len(t, page.Changes, 2)
+	assert.Equal(t, "New", page.Changes[0].Document.Title)
+	assert.Equal(t, "hello", page.Changes[0].Document.Body)
+	assert.Equal(t, connectors.Change{ID: "m2", Deleted: true}, page.Changes[1])
+
+	page, err = c.Changes(context.Background(), page.NextCursor)
+	require.NoError(t, err)
+	assert.True(t, page.Done)
+	assert.Equal(t, "180", page.NextCursor)
+	mockClient.AssertExpectations(t)
+}
+
+func TestConnector_Changes_Expired(t *testing.T) {
+	mockClient := new(MockGmailClient)
+	mockClient.On("History", mock.Anything, uint64(1), "").Return(HistoryPage{}, fmt.Errorf("gmail history.list: %w", connectors.ErrCursorExpired))
+	c := NewConnector(mockClient)
+
+	_, err := c.Changes(context.Background(), "1")
+	assert.ErrorIs(t, err, connectors.ErrCursorExpired)
+
+	_, err = c.Changes(context.Background(), "garbage")
+	assert.ErrorIs(t, err, connectors.ErrCursorExpired, "an unreadable cursor forces a full crawl")
+}
@@ -0,0 +1,443 @@
+// Package httpjson searches any HTTP API that answers with JSON, as
+// described in configuration rather than code: a Spec says how to build
+// the request and where each result field is found in the response.
+package httpjson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+const (
+	defaultQueryParam = "q"
+	defaultLimit      = 20
+	// maxResponseSize bounds how much of a response is read.
+	maxResponseSize = 10 << 20
+	// maxErrorBody bounds how much of an error response is quoted.
+	maxErrorBody = 200
+)
+
+// Result fields a Spec can map.
+const (
+	FieldTitle   = "title"
+	FieldURL     = "url"
+	FieldSnippet = "snippet"
+	FieldID      = "id"
+	FieldDate    = "date"
+	FieldCreated = "created"
+	FieldAuthor  = "author"
+	FieldType    = "type"
+)
+
+// Fields lists the result fields a Spec can map, in documentation order.
+var Fields = []string{FieldTitle, FieldURL, FieldSnippet, FieldID, FieldDate, FieldCreated, FieldAuthor, FieldType}
+
+// Spec describes a search API.
+//
+// In URL and Body, the placeholders {query}, {limit} and {cursor} stand
+// for the search's free text, page size and continuation cursor, escaped
+// for a URL and for the inside of a JSON string respectively.
+//
+// Result fields, metadata and NextCursor are expressions: a JSONPath-style
+// path such as $.items[0].name, or text with paths in braces such as
+// https://wiki.example.com/pages/{$.id}. A path selecting several values
+// yields them joined with commas.
+type Spec struct {
+	// URL is the search endpoint.
+	URL string
+	// Method is GET (the default) or POST.
+	Method string
+	// Body is the request body, sent as JSON.
+	Body string
+	// QueryParam is the URL parameter the free text is sent in when
+	// neither URL nor Body has a {query} placeholder. It defaults to "q".
+	QueryParam string
+	// LimitParam and CursorParam, when set, are URL parameters the page
+	// size and cursor are sent in.
+	LimitParam  string
+	CursorParam string
+	// Headers are sent with every request.
+	Headers map[string]string
+	// Token, when set, is sent as a bearer token; otherwise Username and
+	// Password, when set, are sent with basic authentication.
+	Token    string
+	Username string
+	Password string
+
+	// Results is the path to the list of results in the response.
+	Results string
+	// Fields maps result fields (see Fields) to expressions evaluated
+	// against each result. title and url are required. date and created
+	// may select RFC 3339 times, dates, or Unix times in seconds or
+	// milliseconds.
+	Fields map[string]string
+	// Metadata maps result metadata keys to expressions.
+	Metadata map[string]string
+	// NextCursor is the expression, evaluated against the response, for
+	// the cursor of the next page. Without it there is only one page.
+	NextCursor string
+}
+
+// Connector implements connectors.Connector for a Spec.
+type Connector struct {
+	spec       Spec
+	name       string
+	httpClient *http.Client
+
+	results    path
+	fields     map[string]expr
+	metadata   map[string]expr
+	nextCursor expr
+}
+
+// NewConnector creates a connector for spec, reporting the first problem
+// with it. A nil httpClient uses http.DefaultClient.
+func NewConnector(spec Spec, httpClient *http.Client) (*Connector, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if spec.Method == "" {
+		spec.Method = http.MethodGet
+	}
+	spec.Method = strings.ToUpper(spec.Method)
+	if spec.Method != http.MethodGet && spec.Method != http.MethodPost {
+		return nil, fmt.Errorf("method is %q, want GET or POST", spec.Method)
+	}
+	if spec.QueryParam == "" {
+		spec.QueryParam = defaultQueryParam
+	}
+	if u, err := url.Parse(expand(spec.URL, "", 0, "", url.QueryEscape)); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("url %q is not an absolute URL", spec.URL)
+	}
+
+	c := &Connector{spec: spec, name: "http-json", httpClient: httpClient, fields: map[string]expr{}, metadata: map[string]expr{}}
+	var err error
+	if c.results, err = parsePath(spec.Results); err != nil {
+		return nil, fmt.Errorf("results: %w", err)
+	}
+	for _, f := range []string{FieldTitle, FieldURL} {
+		if spec.Fields[f] == "" {
+			return nil, fmt.Errorf("the %s field is required", f)
+		}
+	}
+	for f, s := range spec.Fields {
+		if !isField(f) {
+			return nil, fmt.Errorf("unknown field %q, want one of %s", f, strings.Join(Fields, ", "))
+		}
+		if c.fields[f], err = parseExpr(s); err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+	}
+	for k, s := range spec.Metadata {
+		if c.metadata[k], err = parseExpr(s); err != nil {
+			return nil, fmt.Errorf("metadata %s: %w", k, err)
+		}
+	}
+	if spec.NextCursor != "" {
+		if c.nextCursor, err = parseExpr(spec.NextCursor); err != nil {
+			return nil, fmt.Errorf("next cursor: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func isField(f string) bool {
+	for _, name := range Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WithName sets the name the connector reports and stamps on its results.
+// It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the free text sent and the request URL.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	text, _ := searchText(parsed)
+	params := map[string]string{"method": c.spec.Method, "url": c.requestURL(text, limit(req), req.Cursor)}
+	return connectors.Explanation{Query: text, Params: params}, nil
+}
+
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	text, warnings := searchText(parsed)
+	doc, err := c.fetch(ctx, text, limit(req), req.Cursor)
+	if err != nil {
+		return connectors.Page{}, fmt.Errorf("%s search: %w", c.name, err)
+	}
+
+	// A path to the list selects the list; one with a wildcard, its items.
+	items := c.results.eval(doc)
+	if len(items) == 1 {
+		if list, ok := items[0].([]any); ok {
+			items = list
+		}
+	}
+	results := make([]connectors.Result, 0, len(items))
+	for _, item := range items {
+		results = append(results, c.toResult(item))
+	}
+	return connectors.Page{Results: results, NextCursor: c.nextCursor.eval(doc), Warnings: warnings}, nil
+}
+
+func limit(req connectors.Request) int {
+	if req.Limit > 0 {
+		return req.Limit
+	}
+	return defaultLimit
+}
+
+// searchText returns the free text of q, with phrases quoted, and warnings
+// for the clauses a generic API cannot be asked for.
+func searchText(q query.Query) (string, []string) {
+	var parts, warnings []string
+	for _, c := range q.Clauses {
+		switch {
+		case c.Field == query.FieldSource:
+			// Resolved by the search engine.
+		case c.Field == query.FieldText && !c.Negated && c.Phrase:
+			parts = append(parts, `"`+c.Value+`"`)
+		case c.Field == query.FieldText && !c.Negated:
+			parts = append(parts, c.Value)
+		default:
+			warnings = append(warnings, query.Unsupported(c))
+		}
+	}
+	return strings.Join(parts, " "), warnings
+}
+
+// requestURL returns the URL searched for text.
+func (c *Connector) requestURL(text string, limit int, cursor string) string {
+	raw := expand(c.spec.URL, text, limit, cursor, queryEscape)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	params := u.Query()
+	if !strings.Contains(c.spec.URL, "{query}") && !strings.Contains(c.spec.Body, "{query}") {
+		params.Set(c.spec.QueryParam, text)
+	}
+	if c.spec.LimitParam != "" {
+		params.Set(c.spec.LimitParam, strconv.Itoa(limit))
+	}
+	if c.spec.CursorParam != "" && cursor != "" {
+		params.Set(c.spec.CursorParam, cursor)
+	}
+	u.RawQuery = params.Encode()
+	return u.String()
+}
+
+// fetch sends the search request and decodes the response.
+func (c *Connector) fetch(ctx context.Context, text string, limit int, cursor string) (any, error) {
+	var body io.Reader
+	if c.spec.Body != "" {
+		body = strings.NewReader(expand(c.spec.Body, text, limit, cursor, jsonEscape))
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, c.spec.Method, c.requestURL(text, limit, cursor), body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range c.spec.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	switch {
+	case c.spec.Token != "":
+		httpReq.Header.Set("Authorization", "Bearer "+c.spec.Token)
+	case c.spec.Username != "" || c.spec.Password != "":
+		httpReq.SetBasicAuth(c.spec.Username, c.spec.Password)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	host := httpReq.URL.Host
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		err := fmt.Errorf("%s: %s", host, resp.Status)
+		if retry := resp.Header.Get("Retry-After"); resp.StatusCode == http.StatusTooManyRequests && retry != "" {
+			err = fmt.Errorf("%w, retry after %ss", err, retry)
+		}
+		if m := strings.Join(strings.Fields(string(msg)), " "); m != "" {
+			err = fmt.Errorf("%w: %s", err, m)
+		}
+		return nil, err
+	}
+
+	dec := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: decode response: %w", host, err)
+	}
+	return doc, nil
+}
+
+// toResult maps one item of the response's results.
+func (c *Connector) toResult(item any) connectors.Result {
+	r := connectors.Result{
+		Title:      c.fields[FieldTitle].eval(item),
+		URL:        c.fields[FieldURL].eval(item),
+		Snippet:    strings.Join(strings.Fields(c.fields[FieldSnippet].eval(item)), " "),
+		Source:     c.name,
+		ID:         c.fields[FieldID].eval(item),
+		ModifiedAt: c.fields[FieldDate].time(item),
+		CreatedAt:  c.fields[FieldCreated].time(item),
+		Author:     c.fields[FieldAuthor].eval(item),
+		MimeType:   c.fields[FieldType].eval(item),
+	}
+	for k, e := range c.metadata {
+		if v := e.eval(item); v != "" {
+			if r.Metadata == nil {
+				r.Metadata = map[string]string{}
+			}
+			r.Metadata[k] = v
+		}
+	}
+	return r
+}
+
+// expand replaces the placeholders of a URL or body template, escaping the
+// values with escape.
+func expand(tmpl, text string, limit int, cursor string, escape func(string) string) string {
+	return strings.NewReplacer(
+		"{query}", escape(text),
+		"{limit}", strconv.Itoa(limit),
+		"{cursor}", escape(cursor),
+	).Replace(tmpl)
+}
+
+// queryEscape escapes s for any part of a URL: unlike url.QueryEscape, it
+// escapes spaces as %20, since a + means a space only in query strings.
+func queryEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// jsonEscape escapes s for the inside of a JSON string.
+func jsonEscape(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
+// expr is a compiled expression: literal text and the paths between it.
+// literals has one more element than paths.
+type expr struct {
+	literals []string
+	paths    []path
+}
+
+// parseExpr compiles s, a path or text with paths in braces.
+func parseExpr(s string) (expr, error) {
+	if strings.HasPrefix(s, "$") {
+		p, err := parsePath(s)
+		return expr{literals: []string{"", ""}, paths: []path{p}}, err
+	}
+	var e expr
+	for {
+		start := strings.Index(s, "{$")
+		if start < 0 {
+			e.literals = append(e.literals, s)
+			return e, nil
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return expr{}, fmt.Errorf("%q has an unclosed {", s)
+		}
+		p, err := parsePath(s[start+1 : start+end])
+		if err != nil {
+			return expr{}, err
+		}
+		e.literals = append(e.literals, s[:start])
+		e.paths = append(e.paths, p)
+		s = s[start+end+1:]
+	}
+}
+
+// eval returns the text of e for v. The zero expr yields "".
+func (e expr) eval(v any) string {
+	if len(e.literals) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, p := range e.paths {
+		b.WriteString(e.literals[i])
+		var parts []string
+		for _, value := range p.eval(v) {
+			if s := text(value); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		b.WriteString(strings.Join(parts, ", "))
+	}
+	b.WriteString(e.literals[len(e.literals)-1])
+	return b.String()
+}
+
+// dateLayouts are the textual date formats time accepts.
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", time.DateOnly}
+
+// time returns the time e selects in v, or the zero time. Numbers are Unix
+// times, in milliseconds when too large to be in seconds.
+func (e expr) time(v any) time.Time {
+	if len(e.paths) == 1 && e.literals[0] == "" && e.literals[1] == "" {
+		if values := e.paths[0].eval(v); len(values) > 0 {
+			if n, ok := values[0].(json.Number); ok {
+				if f, err := n.Float64(); err == nil {
+					return unixTime(f)
+				}
+			}
+		}
+	}
+	s := e.eval(v)
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return unixTime(f)
+	}
+	return time.Time{}
+}
+
+func unixTime(f float64) time.Time {
+	if f > 1e11 {
+		return time.UnixMilli(int64(f)).UTC()
+	}
+	return time.Unix(int64(f), 0).UTC()
+}
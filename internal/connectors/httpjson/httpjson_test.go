@@ -0,0 +1,206 @@
+package httpjson
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const searchResponse = `{
+	"hits": [
+		{"id": 7, "title": "Q2 budget", "body": "The  Q2\nbudget is final.", "updated": "2024-03-02T10:00:00Z",
+		 "created": 1709283600, "user": {"name": "Alice"}, "space": "ENG"},
+		{"id": 8, "title": "Hiring plan", "updated": "2024-02-01", "created": 1706745600000}
+	],
+	"next": "abc"
+}`
+
+func testSpec(url string) Spec {
+	return Spec{
+		URL:     url + "/api/search",
+		Results: "$.hits",
+		Fields: map[string]string{
+			FieldTitle:   "$.title",
+			FieldURL:     "https://wiki.example.com/pages/{$.id}",
+			FieldSnippet: "$.body",
+			FieldID:      "$.id",
+			FieldDate:    "$.updated",
+			FieldCreated: "$.created",
+			FieldAuthor:  "$.user.name",
+			FieldType:    "text/html",
+		},
+		Metadata:   map[string]string{"space": "$.space"},
+		NextCursor: "$.next",
+	}
+}
+
+func newTestConnector(t *testing.T, spec Spec) *Connector {
+	t.Helper()
+	c, err := NewConnector(spec, nil)
+	require.NoError(t, err)
+	return c
+}
+
+func TestConnector_Name(t *testing.T) {
+	c := newTestConnector(t, testSpec("https://wiki.example.com"))
+	assert.Equal(t, "http-json", c.Name())
+	assert.Equal(t, "wiki", c.WithName("wiki").Name())
+}
+
+func TestConnector_Search(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		_, _ = io.WriteString(w, searchResponse)
+	}))
+	defer srv.Close()
+	spec := testSpec(srv.URL)
+	spec.LimitParam = "size"
+	spec.Headers = map[string]string{"X-Team": "eng"}
+	spec.Token = "secret"
+
+	page, err := newTestConnector(t, spec).WithName("wiki").Search(context.Background(), connectors.Request{Query: `budget "next year" -draft`, Limit: 5})
+
+	require.NoError(t, err)
+	assert.Equal(t, "/api/search", got.URL.Path)
+	assert.Equal(t, `budget "next year"`, got.URL.Query().Get("q"))
+	assert.Equal(t, "5", got.URL.Query().Get("size"))
+	assert.Equal(t, "eng", got.Header.Get("X-Team"))
+	assert.Equal(t, "Bearer secret", got.Header.Get("Authorization"))
+
+	assert.Equal(t, "abc", page.NextCursor)
+	assert.Len(t, page.Warnings, 1)
+	require.Len(t, page.Results, 2)
+	assert.Equal(t, connectors.Result{
+		Title:      "Q2 budget",
+		URL:        "https://wiki.example.com/pages/7",
+		Snippet:    "The Q2 budget is final.",
+		Source:     "wiki",
+		ID:         "7",
+		ModifiedAt: time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC),
+		CreatedAt:  time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		Author:     "Alice",
+		MimeType:   "text/html",
+		Metadata:   map[string]string{"space": "ENG"},
+	}, page.Results[0])
+
+	r := page.Results[1]
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), r.ModifiedAt)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), r.CreatedAt, "large numbers are milliseconds")
+	assert.Empty(t, r.Snippet)
+	assert.Nil(t, r.Metadata)
+}
+
+func TestConnector_Search_Templates(t *testing.T) {
+	var got *http.Request
+	var body map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		_, _ = io.WriteString(w, `{"data": {"results": [{"name": "a"}, {"name": "b"}]}}`)
+	}))
+	defer srv.Close()
+	spec := Spec{
+		URL:      srv.URL + "/search/{query}?page={cursor}",
+		Method:   "post",
+		Body:     `{"text": "{query}", "size": {limit}}`,
+		Username: "alice",
+		Password: "pw",
+		Results:  "$.data.results[*]",
+		Fields:   map[string]string{FieldTitle: "$.name", FieldURL: "https://example.com/{$.name}"},
+	}
+
+	page, err := newTestConnector(t, spec).Search(context.Background(), connectors.Request{Query: `say "hi" there`, Cursor: "2"})
+
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPost, got.Method)
+	assert.Equal(t, `/search/say "hi" there`, got.URL.Path)
+	assert.Equal(t, "2", got.URL.Query().Get("page"))
+	assert.False(t, got.URL.Query().Has("q"), "the query is in the URL already")
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	user, pass, _ := got.BasicAuth()
+	assert.Equal(t, "alice", user)
+	assert.Equal(t, "pw", pass)
+	assert.Equal(t, map[string]any{"text": `say "hi" there`, "size": float64(20)}, body)
+
+	require.Len(t, page.Results, 2)
+	assert.Equal(t, "https://example.com/b", page.Results[1].URL)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestConnector_Search_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		header map[string]string
+		body   string
+		want   string
+	}{
+		{"status", http.StatusUnauthorized, nil, `{"error": "bad token"}`, `401 Unauthorized: {"error": "bad token"}`},
+		{"rate limited", http.StatusTooManyRequests, map[string]string{"Retry-After": "30"}, "", "429 Too Many Requests, retry after 30s"},
+		{"not json", http.StatusOK, nil, "<html>", "decode response"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tc.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tc.status)
+				_, _ = io.WriteString(w, tc.body)
+			}))
+			defer srv.Close()
+
+			_, err := newTestConnector(t, testSpec(srv.URL)).Search(context.Background(), connectors.Request{Query: "budget"})
+
+			assert.ErrorContains(t, err, "http-json search: "+srv.Listener.Addr().String()+": ")
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestConnector_Explain(t *testing.T) {
+	spec := testSpec("https://wiki.example.com")
+	spec.CursorParam = "after"
+	spec.Token = "secret"
+
+	exp, err := newTestConnector(t, spec).Explain(connectors.Request{Query: "budget from:alice", Cursor: "abc"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "budget", exp.Query)
+	assert.Equal(t, map[string]string{
+		"method": "GET",
+		"url":    "https://wiki.example.com/api/search?after=abc&q=budget",
+	}, exp.Params)
+}
+
+func TestNewConnector_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		edit func(*Spec)
+		want string
+	}{
+		{"relative url", func(s *Spec) { s.URL = "/api/search" }, `url "/api/search" is not an absolute URL`},
+		{"method", func(s *Spec) { s.Method = "PUT" }, `method is "PUT", want GET or POST`},
+		{"results", func(s *Spec) { s.Results = "hits" }, `results: path "hits" does not start with $`},
+		{"title", func(s *Spec) { delete(s.Fields, FieldTitle) }, "the title field is required"},
+		{"unknown field", func(s *Spec) { s.Fields["score"] = "$.score" }, `unknown field "score"`},
+		{"field path", func(s *Spec) { s.Fields[FieldURL] = "https://x/{$.id" }, `url: "https://x/{$.id" has an unclosed {`},
+		{"metadata", func(s *Spec) { s.Metadata["space"] = "$.[" }, "metadata space: "},
+		{"next cursor", func(s *Spec) { s.NextCursor = "$next" }, "next cursor: "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := testSpec("https://wiki.example.com")
+			tc.edit(&spec)
+			_, err := NewConnector(spec, nil)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
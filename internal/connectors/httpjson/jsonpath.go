@@ -0,0 +1,130 @@
+package httpjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// step is one step of a path: a member name, an array index, or a
+// wildcard over every element or member.
+type step struct {
+	name     string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// path is a compiled JSONPath-style expression. The supported subset is
+// the root $, members as .name or ['name'], array indexes as [0] (negative
+// ones count from the end) and wildcards as [*] or .*.
+type path []step
+
+// parsePath compiles expr.
+func parsePath(expr string) (path, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("path %q does not start with $", expr)
+	}
+	var p path
+	rest := expr[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".*"):
+			p = append(p, step{wildcard: true})
+			rest = rest[2:]
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return nil, fmt.Errorf("path %q has an empty member name", expr)
+			}
+			p = append(p, step{name: name})
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q has an unclosed [", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			switch {
+			case inner == "*":
+				p = append(p, step{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				p = append(p, step{name: inner[1 : len(inner)-1]})
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("path %q: [%s] is not an index, a quoted name or *", expr, inner)
+				}
+				p = append(p, step{index: i, isIndex: true})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("path %q: unexpected %q", expr, rest)
+		}
+	}
+	return p, nil
+}
+
+// eval returns the values p selects in v, a document decoded with
+// json.Decoder.UseNumber. Missing members and out-of-range indexes select
+// nothing.
+func (p path) eval(v any) []any {
+	values := []any{v}
+	for _, s := range p {
+		var next []any
+		for _, v := range values {
+			switch v := v.(type) {
+			case map[string]any:
+				if s.wildcard {
+					for _, m := range v {
+						next = append(next, m)
+					}
+				} else if m, ok := v[s.name]; ok && !s.isIndex {
+					next = append(next, m)
+				}
+			case []any:
+				switch {
+				case s.wildcard:
+					next = append(next, v...)
+				case s.isIndex:
+					i := s.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// text converts a selected value to the text of a result field. Arrays
+// are joined with commas; objects and null are empty.
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		var parts []string
+		for _, e := range v {
+			if s := text(e); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+	return ""
+}
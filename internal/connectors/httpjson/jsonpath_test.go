@@ -0,0 +1,63 @@
+package httpjson
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	require.NoError(t, dec.Decode(&v))
+	return v
+}
+
+func TestPath_Eval(t *testing.T) {
+	doc := decode(t, `{
+		"data": {"items": [
+			{"name": "a", "tags": ["x", "y"], "n": 1, "ok": true},
+			{"name": "b", "tags": [], "n": 2.5, "odd key": "z"}
+		]},
+		"total": 2
+	}`)
+
+	for _, tc := range []struct {
+		expr string
+		want []string
+	}{
+		{"$.total", []string{"2"}},
+		{"$.data.items[0].name", []string{"a"}},
+		{"$.data.items[-1].name", []string{"b"}},
+		{"$.data.items[5].name", nil},
+		{"$.data.items[*].name", []string{"a", "b"}},
+		{"$.data.items.*.n", []string{"1", "2.5"}},
+		{"$['data'][\"items\"][1]['odd key']", []string{"z"}},
+		{"$.data.items[0].tags", []string{"x, y"}},
+		{"$.data.items[0].ok", []string{"true"}},
+		{"$.data.missing", nil},
+		{"$.total.name", nil},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			p, err := parsePath(tc.expr)
+			require.NoError(t, err)
+			var got []string
+			for _, v := range p.eval(doc) {
+				got = append(got, text(v))
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParsePath_Errors(t *testing.T) {
+	for _, expr := range []string{"data.items", "$.", "$.items[0", "$.items[first]", "$items"} {
+		_, err := parsePath(expr)
+		assert.Error(t, err, expr)
+	}
+}
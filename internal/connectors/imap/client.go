@@ -0,0 +1,438 @@
+package imap
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/email"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+// Security is how the connection to the server is protected.
+type Security string
+
+const (
+	// SecurityTLS connects with TLS from the start, usually on port 993.
+	SecurityTLS Security = "tls"
+	// SecurityStartTLS upgrades a plain connection with STARTTLS, usually
+	// on port 143.
+	SecurityStartTLS Security = "starttls"
+	// SecurityNone sends everything, the password included, in the clear.
+	// It is only meant for servers on the same machine.
+	SecurityNone Security = "none"
+)
+
+// ParseSecurity parses a security setting; "" means SecurityTLS.
+func ParseSecurity(s string) (Security, error) {
+	switch sec := Security(strings.ToLower(s)); sec {
+	case "":
+		return SecurityTLS, nil
+	case SecurityTLS, SecurityStartTLS, SecurityNone:
+		return sec, nil
+	}
+	return "", fmt.Errorf("unknown security %q, want tls, starttls or none", s)
+}
+
+// Account is an IMAP account.
+type Account struct {
+	Host string
+	// Port defaults to 993 with SecurityTLS and 143 otherwise.
+	Port     int
+	Username string
+	Password string
+	Security Security
+}
+
+func (a Account) addr() string {
+	port := a.Port
+	if port == 0 {
+		port = 143
+		if a.Security == SecurityTLS {
+			port = 993
+		}
+	}
+	return net.JoinHostPort(a.Host, strconv.Itoa(port))
+}
+
+// APIClient implements MailClient over IMAP, with one connection per
+// search.
+type APIClient struct {
+	account Account
+	// tlsConfig is used for TLS and STARTTLS; nil means the system's root
+	// certificates. Overridden in tests.
+	tlsConfig *tls.Config
+}
+
+// NewAPIClient creates a client for the given account.
+func NewAPIClient(account Account) *APIClient {
+	return &APIClient{account: account}
+}
+
+// buildSearchCriteria translates a pkb query into IMAP SEARCH keys; every
+// pkb operator has an IMAP equivalent. Free text is matched anywhere in a
+// message, title: in its subject and from: in its sender, as substrings
+// regardless of case. ok is false when the query can never match a message
+// (e.g. type:pdf), so the server need not be contacted.
+func buildSearchCriteria(q query.Query) (criteria []Criterion, ok bool) {
+	for _, c := range q.Clauses {
+		var cr Criterion
+		switch c.Field {
+		case query.FieldText:
+			cr = Criterion{Key: "TEXT", Value: c.Value}
+		case query.FieldTitle:
+			cr = Criterion{Key: "SUBJECT", Value: c.Value}
+		case query.FieldFrom:
+			cr = Criterion{Key: "FROM", Value: c.Value}
+		case query.FieldAfter:
+			cr = Criterion{Key: "SINCE", Value: c.Date().Format(dateLayout)}
+		case query.FieldBefore:
+			cr = Criterion{Key: "BEFORE", Value: c.Date().Format(dateLayout)}
+		case query.FieldType:
+			// Every IMAP result is a message, so type: either matches
+			// everything or nothing.
+			if query.MatchesMIMEType(c.Value, mimeTypeMessage) == c.Negated {
+				return nil, false
+			}
+			continue
+		default:
+			// source: is resolved by the search engine.
+			continue
+		}
+		cr.Not = c.Negated
+		criteria = append(criteria, cr)
+	}
+	return criteria, true
+}
+
+// dateLayout is the layout of dates in IMAP SEARCH keys.
+const dateLayout = "2-Jan-2006"
+
+// isDateKey reports whether key takes a date rather than a string.
+func isDateKey(key string) bool {
+	return key == "SINCE" || key == "BEFORE"
+}
+
+// String renders c as it appears in a SEARCH command, with its value
+// quoted.
+func (c Criterion) String() string {
+	s := c.Key + " "
+	if isDateKey(c.Key) {
+		s += c.Value
+	} else {
+		s += quote(c.Value)
+	}
+	if c.Not {
+		s = "NOT " + s
+	}
+	return s
+}
+
+// formatCriteria renders criteria as the program of a SEARCH command.
+// Deleted messages awaiting expunge are always left out.
+func formatCriteria(criteria []Criterion) string {
+	parts := []string{"UNDELETED"}
+	for _, c := range criteria {
+		parts = append(parts, c.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// needsUTF8 reports whether the criteria hold text beyond ASCII, which
+// servers only accept once CHARSET UTF-8 is given.
+func needsUTF8(criteria []Criterion) bool {
+	for _, c := range criteria {
+		if !quotable(c.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Page size bounds. Each result costs a fetch of its envelope and preview,
+// so pages are kept small.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageSize clamps a requested result limit, using defaultPageSize when no
+// limit is given.
+func pageSize(limit int) int {
+	switch {
+	case limit <= 0:
+		return defaultPageSize
+	case limit > maxPageSize:
+		return maxPageSize
+	}
+	return limit
+}
+
+// previewBytes is how much of each message body is fetched to make its
+// preview.
+const previewBytes = 4096
+
+// fetchItems are the message data fetched for each result: the envelope
+// for the headers shown, and the start of the body with the headers needed
+// to decode it for the preview.
+var fetchItems = fmt.Sprintf("(UID INTERNALDATE ENVELOPE BODY.PEEK[HEADER.FIELDS (CONTENT-TYPE CONTENT-TRANSFER-ENCODING)] BODY.PEEK[TEXT]<0.%d>)", previewBytes)
+
+func (c *APIClient) Search(ctx context.Context, req SearchRequest) ([]Message, bool, error) {
+	cfg := c.tlsConfig
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	cfg = cfg.Clone()
+	cfg.ServerName = c.account.Host
+
+	var nc net.Conn
+	var err error
+	if c.account.Security == SecurityTLS {
+		nc, err = (&tls.Dialer{Config: cfg}).DialContext(ctx, "tcp", c.account.addr())
+	} else {
+		nc, err = (&net.Dialer{}).DialContext(ctx, "tcp", c.account.addr())
+	}
+	if err != nil {
+		return nil, false, c.fail(ctx, err)
+	}
+	defer nc.Close()
+	// Cancelling ctx interrupts whatever read or write is under way.
+	stop := context.AfterFunc(ctx, func() { nc.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	conn, err := c.login(ctx, newConn(nc), cfg)
+	if err != nil {
+		return nil, false, c.fail(ctx, err)
+	}
+	messages, more, err := c.search(conn, req)
+	if err != nil {
+		return nil, false, c.fail(ctx, err)
+	}
+	_ = conn.command(nil, atom("LOGOUT"))
+	return messages, more, nil
+}
+
+// fail returns the error for a search that failed with err, preferring the
+// context's error when it was cancelled.
+func (c *APIClient) fail(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return fmt.Errorf("imap %s: %w", c.account.Host, err)
+}
+
+// login reads the server's greeting, negotiates STARTTLS if the account
+// uses it and logs in. It returns the connection to use from then on.
+func (c *APIClient) login(ctx context.Context, conn *conn, cfg *tls.Config) (*conn, error) {
+	greeting, err := conn.readResponse()
+	if err != nil {
+		return nil, fmt.Errorf("read greeting: %w", err)
+	}
+	switch greeting.status {
+	case "OK", "PREAUTH":
+	default:
+		return nil, fmt.Errorf("server refused the connection: %s %s", greeting.status, greeting.text)
+	}
+
+	if c.account.Security == SecurityStartTLS {
+		if err := conn.command(nil, atom("STARTTLS")); err != nil {
+			return nil, err
+		}
+		tc := tls.Client(conn.nc, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return nil, fmt.Errorf("STARTTLS: %w", err)
+		}
+		// A PREAUTH greeting sent in the clear is not trusted.
+		conn, greeting.status = newConn(tc), "OK"
+	}
+
+	if greeting.status != "PREAUTH" {
+		if err := conn.command(nil, atom("LOGIN"), c.account.Username, c.account.Password); err != nil {
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// search finds the matching messages in the mailbox and fetches a page of
+// them, newest first.
+func (c *APIClient) search(conn *conn, req SearchRequest) ([]Message, bool, error) {
+	var uidValidity string
+	err := conn.command(func(resp response) error {
+		if code, ok := strings.CutPrefix(resp.text, "[UIDVALIDITY "); ok {
+			uidValidity, _, _ = strings.Cut(code, "]")
+		}
+		return nil
+	}, atom("EXAMINE"), encodeMailbox(req.Mailbox))
+	if err != nil {
+		return nil, false, err
+	}
+
+	args := []any{atom("UID"), atom("SEARCH")}
+	if needsUTF8(req.Criteria) {
+		args = append(args, atom("CHARSET"), atom("UTF-8"))
+	}
+	args = append(args, atom("UNDELETED"))
+	for _, cr := range req.Criteria {
+		if cr.Not {
+			args = append(args, atom("NOT"))
+		}
+		args = append(args, atom(cr.Key))
+		if isDateKey(cr.Key) {
+			args = append(args, atom(cr.Value))
+		} else {
+			args = append(args, cr.Value)
+		}
+	}
+	var uids []uint32
+	err = conn.command(func(resp response) error {
+		if len(resp.fields) == 0 || !strings.EqualFold(str(resp.fields[0]), "SEARCH") {
+			return nil
+		}
+		for _, f := range resp.fields[1:] {
+			if uid, err := strconv.ParseUint(str(f), 10, 32); err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Higher UIDs were added later, so the newest messages come first.
+	slices.Sort(uids)
+	slices.Reverse(uids)
+	if req.BeforeUID > 0 {
+		i := 0
+		for i < len(uids) && uids[i] >= req.BeforeUID {
+			i++
+		}
+		uids = uids[i:]
+	}
+	limit := pageSize(req.Limit)
+	more := len(uids) > limit
+	uids = uids[:min(limit, len(uids))]
+	if len(uids) == 0 {
+		return []Message{}, false, nil
+	}
+
+	set := make([]string, len(uids))
+	for i, uid := range uids {
+		set[i] = strconv.FormatUint(uint64(uid), 10)
+	}
+	fetched := make(map[uint32]Message, len(uids))
+	err = conn.command(func(resp response) error {
+		if len(resp.fields) < 3 || !strings.EqualFold(str(resp.fields[1]), "FETCH") {
+			return nil
+		}
+		items, _ := resp.fields[2].([]any)
+		m := c.toMessage(req.Mailbox, uidValidity, items)
+		if m.UID != 0 {
+			fetched[m.UID] = m
+		}
+		return nil
+	}, atom("UID"), atom("FETCH"), atom(strings.Join(set, ",")), atom(fetchItems))
+	if err != nil {
+		return nil, false, err
+	}
+
+	messages := make([]Message, 0, len(uids))
+	for _, uid := range uids {
+		// Messages expunged since the search are missing.
+		if m, ok := fetched[uid]; ok {
+			messages = append(messages, m)
+		}
+	}
+	return messages, more, nil
+}
+
+// toMessage decodes the data items of a FETCH response.
+func (c *APIClient) toMessage(mailbox, uidValidity string, items []any) Message {
+	m := Message{Mailbox: mailbox}
+	var internalDate time.Time
+	var header, body string
+	for i := 0; i+1 < len(items); i += 2 {
+		key, value := strings.ToUpper(str(items[i])), items[i+1]
+		switch {
+		case key == "UID":
+			uid, _ := strconv.ParseUint(str(value), 10, 32)
+			m.UID = uint32(uid)
+		case key == "INTERNALDATE":
+			internalDate, _ = time.Parse(internalDateLayout, str(value))
+		case key == "ENVELOPE":
+			env, _ := value.([]any)
+			applyEnvelope(&m, env)
+		case strings.HasPrefix(key, "BODY[HEADER"):
+			header = str(value)
+		case strings.HasPrefix(key, "BODY[TEXT]"):
+			body = str(value)
+		}
+	}
+	if m.Date.IsZero() {
+		m.Date = internalDate
+	}
+	if !strings.HasSuffix(header, "\r\n\r\n") {
+		header += "\r\n"
+	}
+	if parsed, err := email.Parse(strings.NewReader(header + body)); err == nil {
+		m.Preview = parsed.Text
+	}
+	m.URL = c.messageURL(mailbox, uidValidity, m.UID)
+	return m
+}
+
+// internalDateLayout is the layout of INTERNALDATE values.
+const internalDateLayout = "_2-Jan-2006 15:04:05 -0700"
+
+// applyEnvelope sets the headers of m from an ENVELOPE: date, subject,
+// from, sender, reply-to, to, cc, bcc, in-reply-to and message-id.
+func applyEnvelope(m *Message, env []any) {
+	if len(env) < 10 {
+		return
+	}
+	m.Date, _ = mail.ParseDate(str(env[0]))
+	m.Subject = email.DecodeHeader(str(env[1]))
+	if from := addresses(env[2]); len(from) > 0 {
+		m.From = from[0]
+	}
+	m.To = strings.Join(addresses(env[5]), ", ")
+	m.MessageID = strings.Trim(str(env[9]), "<>")
+}
+
+// addresses formats an envelope address list, whose addresses are lists of
+// name, route, mailbox and host.
+func addresses(v any) []string {
+	list, _ := v.([]any)
+	var out []string
+	for _, a := range list {
+		parts, _ := a.([]any)
+		if len(parts) < 4 || parts[3] == nil {
+			continue // group syntax markers have no host
+		}
+		out = append(out, email.FormatAddress(email.DecodeHeader(str(parts[0])), str(parts[2])+"@"+str(parts[3])))
+	}
+	return out
+}
+
+// messageURL returns the IMAP URL of a message (RFC 5092).
+func (c *APIClient) messageURL(mailbox, uidValidity string, uid uint32) string {
+	u := "imap://" + url.User(c.account.Username).String() + "@" + c.account.addr() + "/" + url.PathEscape(encodeMailbox(mailbox))
+	if uidValidity != "" {
+		u += ";UIDVALIDITY=" + uidValidity
+	}
+	return u + "/;UID=" + strconv.FormatUint(uint64(uid), 10)
+}
+
+// str returns a response field as a string; NIL and lists are "".
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,672 @@
+package imap
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"net"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSearchCriteria_Operators(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`budget`, `UNDELETED TEXT "budget"`},
+		{`"quarterly review" -draft`, `UNDELETED TEXT "quarterly review" NOT TEXT "draft"`},
+		{`title:invoice from:alice@example.com`, `UNDELETED SUBJECT "invoice" FROM "alice@example.com"`},
+		{`-from:bob`, `UNDELETED NOT FROM "bob"`},
+		{`after:2024-03-01 before:2024-04-01`, `UNDELETED SINCE 1-Mar-2024 BEFORE 1-Apr-2024`},
+		{`type:email source:work budget`, `UNDELETED TEXT "budget"`},
+		{`-type:pdf`, `UNDELETED`},
+		{`say:"hi"`, `UNDELETED TEXT "say:\"hi\""`},
+	}
+	for _, tt := range tests {
+		q, err := query.Parse(tt.query)
+		require.NoError(t, err, tt.query)
+		criteria, ok := buildSearchCriteria(q)
+		assert.True(t, ok, tt.query)
+		assert.Equal(t, tt.want, formatCriteria(criteria), tt.query)
+	}
+
+	for _, s := range []string{"type:pdf notes", "-type:email"} {
+		q, err := query.Parse(s)
+		require.NoError(t, err)
+		_, ok := buildSearchCriteria(q)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestEncodeMailbox(t *testing.T) {
+	assert.Equal(t, "INBOX", encodeMailbox("INBOX"))
+	assert.Equal(t, "Entw&APw-rfe", encodeMailbox("Entwürfe"))
+	assert.Equal(t, "Tom &- Jerry", encodeMailbox("Tom & Jerry"))
+	// The example from RFC 3501.
+	assert.Equal(t, "~peter/mail/&U,BTFw-/&ZeVnLIqe-", encodeMailbox("~peter/mail/台北/日本語"))
+}
+
+func TestParseSecurity(t *testing.T) {
+	for in, want := range map[string]Security{"": SecurityTLS, "TLS": SecurityTLS, "starttls": SecurityStartTLS, "none": SecurityNone} {
+		got, err := ParseSecurity(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := ParseSecurity("ssl")
+	assert.ErrorContains(t, err, `unknown security "ssl"`)
+}
+
+// crlf converts a message written with \n line endings to the \r\n of the
+// wire.
+func crlf(s string) string {
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+var testMessages = []fakeMessage{
+	{uid: 3, received: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC), raw: crlf(`From: Alice Example <alice@example.com>
+To: me@example.com, Bob <bob@example.com>
+Subject: Q2 budget
+Date: Fri, 01 Mar 2024 09:00:00 +0000
+Message-ID: <budget-1@example.com>
+Content-Type: text/plain; charset=utf-8
+
+Hi, the budget for Q2 is attached.
+`)},
+	{uid: 7, received: time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC), raw: crlf(`From: =?ISO-8859-1?Q?Andr=E9?= <andre@example.com>
+To: me@example.com
+Subject: =?ISO-8859-1?Q?R=E9sum=E9_du_budget?=
+Date: Sun, 10 Mar 2024 09:00:00 +0000
+Message-ID: <budget-2@example.com>
+Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+Le budget du caf=E9 est pr=EAt.
+`)},
+	{uid: 9, received: time.Date(2024, 3, 20, 9, 0, 0, 0, time.UTC), raw: crlf(`From: carol@example.com
+Subject: Budget review
+Date: Wed, 20 Mar 2024 09:00:00 +0000
+Content-Type: multipart/alternative; boundary="b1"
+
+--b1
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: base64
+
+VGhlIGJ1ZGdldCByZXZpZXcgaXMgb24gRnJpZGF5Lg==
+--b1
+Content-Type: text/html; charset=utf-8
+
+<p>The <b>budget</b> review is on Friday.</p>
+--b1--
+`)},
+	{uid: 12, received: time.Date(2024, 3, 25, 9, 0, 0, 0, time.UTC), raw: crlf(`From: dave@example.com
+Subject: Lunch
+Date: Mon, 25 Mar 2024 09:00:00 +0000
+Message-ID: <lunch@example.com>
+
+Pizza?
+`)},
+	{uid: 14, deleted: true, received: time.Date(2024, 3, 26, 9, 0, 0, 0, time.UTC), raw: crlf(`From: eve@example.com
+Subject: Old budget
+Message-ID: <deleted@example.com>
+
+Deleted.
+`)},
+}
+
+func TestSearch_TLS(t *testing.T) {
+	srv := startFakeServer(t, SecurityTLS)
+	client := srv.client(SecurityTLS)
+
+	messages, more, err := client.Search(context.Background(), SearchRequest{
+		Mailbox:  "INBOX",
+		Criteria: []Criterion{{Key: "TEXT", Value: "budget"}},
+	})
+
+	require.NoError(t, err)
+	assert.False(t, more)
+	require.Len(t, messages, 3)
+	assert.Equal(t, []uint32{9, 7, 3}, []uint32{messages[0].UID, messages[1].UID, messages[2].UID})
+	assert.True(t, messages[2].Date.Equal(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)))
+	messages[2].Date = time.Time{}
+	assert.Equal(t, Message{
+		UID:       3,
+		Mailbox:   "INBOX",
+		MessageID: "budget-1@example.com",
+		Subject:   "Q2 budget",
+		From:      "Alice Example <alice@example.com>",
+		To:        "me@example.com, Bob <bob@example.com>",
+		Preview:   "Hi, the budget for Q2 is attached.",
+		URL:       "imap://me%40example.com@" + srv.addr + "/INBOX;UIDVALIDITY=42/;UID=3",
+	}, messages[2])
+
+	// Encoded headers, quoted-printable and a legacy charset are decoded.
+	assert.Equal(t, "Résumé du budget", messages[1].Subject)
+	assert.Equal(t, "André <andre@example.com>", messages[1].From)
+	assert.Equal(t, "Le budget du café est prêt.", messages[1].Preview)
+
+	// The plain part of a multipart message is preferred, and a message
+	// without a Message-ID still has a URL.
+	assert.Equal(t, "The budget review is on Friday.", messages[0].Preview)
+	assert.Empty(t, messages[0].MessageID)
+	assert.True(t, strings.HasSuffix(messages[0].URL, ";UID=9"))
+
+	assert.Equal(t, []string{
+		`LOGIN "me@example.com" "s3cret"`,
+		`EXAMINE "INBOX"`,
+		`UID SEARCH UNDELETED TEXT "budget"`,
+		`UID FETCH 9,7,3 ` + fetchItems,
+		`LOGOUT`,
+	}, srv.commands())
+}
+
+func TestSearch_StartTLS(t *testing.T) {
+	srv := startFakeServer(t, SecurityStartTLS)
+
+	messages, _, err := srv.client(SecurityStartTLS).Search(context.Background(), SearchRequest{Mailbox: "INBOX"})
+
+	require.NoError(t, err)
+	assert.Len(t, messages, 4)
+	assert.Equal(t, `STARTTLS`, srv.commands()[0])
+	assert.True(t, srv.loggedInOverTLS(), "LOGIN was sent in the clear")
+}
+
+func TestSearch_PagesByUID(t *testing.T) {
+	srv := startFakeServer(t, SecurityTLS)
+	client := srv.client(SecurityTLS)
+
+	messages, more, err := client.Search(context.Background(), SearchRequest{Mailbox: "INBOX", Limit: 2})
+	require.NoError(t, err)
+	assert.True(t, more)
+	require.Len(t, messages, 2)
+	assert.Equal(t, uint32(12), messages[0].UID)
+	assert.Equal(t, uint32(9), messages[1].UID)
+
+	messages, more, err = client.Search(context.Background(), SearchRequest{Mailbox: "INBOX", Limit: 2, BeforeUID: 9})
+	require.NoError(t, err)
+	assert.False(t, more)
+	require.Len(t, messages, 2)
+	assert.Equal(t, uint32(7), messages[0].UID)
+	assert.Equal(t, uint32(3), messages[1].UID)
+}
+
+func TestSearch_NonASCIIIsSentAsLiteral(t *testing.T) {
+	srv := startFakeServer(t, SecurityTLS)
+
+	messages, _, err := srv.client(SecurityTLS).Search(context.Background(), SearchRequest{
+		Mailbox:  "INBOX",
+		Criteria: []Criterion{{Key: "SUBJECT", Value: "Résumé"}, {Key: "SINCE", Value: "1-Mar-2024"}},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, uint32(7), messages[0].UID)
+	assert.Contains(t, srv.commands(), `UID SEARCH CHARSET UTF-8 UNDELETED SUBJECT {literal "Résumé"} SINCE 1-Mar-2024`)
+}
+
+func TestSearch_NoMatches(t *testing.T) {
+	srv := startFakeServer(t, SecurityTLS)
+
+	messages, more, err := srv.client(SecurityTLS).Search(context.Background(), SearchRequest{
+		Mailbox:  "INBOX",
+		Criteria: []Criterion{{Key: "FROM", Value: "nobody"}},
+	})
+
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+	assert.False(t, more)
+	assert.NotContains(t, strings.Join(srv.commands(), "\n"), "FETCH")
+}
+
+func TestSearch_LoginFails(t *testing.T) {
+	srv := startFakeServer(t, SecurityTLS)
+	client := srv.client(SecurityTLS)
+	client.account.Password = "wrong"
+
+	_, _, err := client.Search(context.Background(), SearchRequest{Mailbox: "INBOX"})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "imap 127.0.0.1: LOGIN: NO [AUTHENTICATIONFAILED] Invalid credentials")
+	assert.NotContains(t, err.Error(), "wrong")
+}
+
+func TestSearch_UnknownMailbox(t *testing.T) {
+	srv := startFakeServer(t, SecurityTLS)
+
+	_, _, err := srv.client(SecurityTLS).Search(context.Background(), SearchRequest{Mailbox: "Archive"})
+
+	assert.ErrorContains(t, err, "EXAMINE: NO Mailbox does not exist")
+}
+
+func TestSearch_UntrustedCertificate(t *testing.T) {
+	srv := startFakeServer(t, SecurityTLS)
+	client := srv.client(SecurityTLS)
+	client.tlsConfig = nil
+
+	_, _, err := client.Search(context.Background(), SearchRequest{Mailbox: "INBOX"})
+
+	assert.ErrorContains(t, err, "certificate")
+}
+
+func TestSearch_ContextCancelled(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	// The server accepts but never greets.
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			<-done
+			c.Close()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	client := NewAPIClient(Account{Host: host, Port: p, Security: SecurityNone})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = client.Search(ctx, SearchRequest{Mailbox: "INBOX"})
+
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+}
+
+// fakeMessage is a message in the fake server's INBOX.
+type fakeMessage struct {
+	uid      uint32
+	raw      string
+	received time.Time
+	deleted  bool
+}
+
+// fakeServer is an in-process IMAP server with one account and an INBOX
+// holding testMessages. It understands just the commands APIClient sends.
+type fakeServer struct {
+	t        *testing.T
+	addr     string
+	security Security
+	tls      *tls.Config
+	roots    *x509.CertPool
+
+	mu       sync.Mutex
+	received []string
+	tlsLogin bool
+}
+
+func startFakeServer(t *testing.T, security Security) *fakeServer {
+	t.Helper()
+	cert, roots := testCertificate(t)
+	s := &fakeServer{t: t, security: security, tls: &tls.Config{Certificates: []tls.Certificate{cert}}, roots: roots}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	s.addr = ln.Addr().String()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+// client returns a client for the fake server's account that trusts its
+// certificate.
+func (s *fakeServer) client(security Security) *APIClient {
+	host, port, _ := net.SplitHostPort(s.addr)
+	p, _ := strconv.Atoi(port)
+	c := NewAPIClient(Account{Host: host, Port: p, Username: "me@example.com", Password: "s3cret", Security: security})
+	c.tlsConfig = &tls.Config{RootCAs: s.roots}
+	return c
+}
+
+func (s *fakeServer) commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.received)
+}
+
+func (s *fakeServer) loggedInOverTLS() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tlsLogin
+}
+
+func (s *fakeServer) serve(nc net.Conn) {
+	defer func() { nc.Close() }()
+	isTLS := false
+	if s.security == SecurityTLS {
+		nc = tls.Server(nc, s.tls)
+		isTLS = true
+	}
+	r, w := bufio.NewReader(nc), bufio.NewWriter(nc)
+	reply := func(format string, args ...any) {
+		fmt.Fprintf(w, format+"\r\n", args...)
+		w.Flush()
+	}
+	reply("* OK fake IMAP server ready")
+	for {
+		args, err := readCommand(r, w)
+		if err != nil || len(args) < 2 {
+			return
+		}
+		tag, cmd := args[0], strings.ToUpper(args[1])
+		s.mu.Lock()
+		s.received = append(s.received, strings.Join(quoteArgs(args[1:]), " "))
+		s.mu.Unlock()
+
+		switch cmd {
+		case "STARTTLS":
+			reply("%s OK Begin TLS negotiation now", tag)
+			nc = tls.Server(nc, s.tls)
+			r, w = bufio.NewReader(nc), bufio.NewWriter(nc)
+			isTLS = true
+		case "LOGIN":
+			if len(args) != 4 || args[2] != "me@example.com" || args[3] != "s3cret" {
+				reply("%s NO [AUTHENTICATIONFAILED] Invalid credentials", tag)
+				continue
+			}
+			s.mu.Lock()
+			s.tlsLogin = isTLS
+			s.mu.Unlock()
+			reply("%s OK LOGIN completed", tag)
+		case "EXAMINE":
+			if len(args) != 3 || args[2] != "INBOX" {
+				reply("%s NO Mailbox does not exist", tag)
+				continue
+			}
+			reply("* %d EXISTS", len(testMessages))
+			reply("* OK [UIDVALIDITY 42] UIDs valid")
+			reply("* FLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft)")
+			reply("%s OK [READ-ONLY] EXAMINE completed", tag)
+		case "UID":
+			switch strings.ToUpper(args[2]) {
+			case "SEARCH":
+				var uids []string
+				for _, m := range testMessages {
+					if m.matches(args[3:]) {
+						uids = append(uids, strconv.FormatUint(uint64(m.uid), 10))
+					}
+				}
+				reply("* SEARCH %s", strings.Join(uids, " "))
+				reply("%s OK SEARCH completed", tag)
+			case "FETCH":
+				for i, m := range testMessages {
+					if slices.Contains(strings.Split(args[3], ","), strconv.FormatUint(uint64(m.uid), 10)) {
+						reply("* %d FETCH %s", i+1, m.fetchData())
+					}
+				}
+				reply("%s OK FETCH completed", tag)
+			}
+		case "LOGOUT":
+			reply("* BYE logging out")
+			reply("%s OK LOGOUT completed", tag)
+			return
+		default:
+			reply("%s BAD unknown command", tag)
+		}
+	}
+}
+
+// literalSuffix matches the literal a command line ends with.
+var literalSuffix = regexp.MustCompile(`\{(\d+)\}$`)
+
+// readCommand reads a command's arguments, asking for its literals.
+// Literals are marked by wrapping them as {literal "..."}.
+func readCommand(r *bufio.Reader, w *bufio.Writer) ([]string, error) {
+	var args []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		m := literalSuffix.FindStringSubmatch(line)
+		if m == nil {
+			return append(args, splitArgs(line)...), nil
+		}
+		args = append(args, splitArgs(strings.TrimSuffix(line, m[0]))...)
+		n, _ := strconv.Atoi(m[1])
+		w.WriteString("+ Ready for literal data\r\n")
+		w.Flush()
+		lit := make([]byte, n)
+		if _, err := io.ReadFull(r, lit); err != nil {
+			return nil, err
+		}
+		args = append(args, "\x00"+string(lit))
+	}
+}
+
+// splitArgs splits a command line at spaces outside quotes, brackets and
+// parentheses, unquoting quoted strings.
+func splitArgs(line string) []string {
+	var args []string
+	var cur strings.Builder
+	inQuote, depth, quoted := false, 0, false
+	flush := func() {
+		if cur.Len() > 0 || quoted {
+			args = append(args, cur.String())
+		}
+		cur.Reset()
+		quoted = false
+	}
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case inQuote && ch == '\\' && i+1 < len(line):
+			i++
+			cur.WriteByte(line[i])
+		case ch == '"' && depth == 0:
+			inQuote, quoted = !inQuote, true
+		case inQuote:
+			cur.WriteByte(ch)
+		case ch == '(' || ch == '[':
+			depth++
+			cur.WriteByte(ch)
+		case ch == ')' || ch == ']':
+			depth--
+			cur.WriteByte(ch)
+		case ch == ' ' && depth == 0:
+			flush()
+		default:
+			cur.WriteByte(ch)
+		}
+	}
+	flush()
+	return args
+}
+
+// quoteArgs renders arguments for recording: strings that were quoted or
+// sent as literals are shown as such, other arguments as they are.
+func quoteArgs(args []string) []string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		switch {
+		case strings.HasPrefix(a, "\x00"):
+			out[i] = fmt.Sprintf("{literal %q}", a[1:])
+		case isAtomArg(a):
+			out[i] = a
+		default:
+			out[i] = quote(a)
+		}
+	}
+	return out
+}
+
+// isAtomArg guesses whether an argument was sent as an atom: command
+// names, search keys, dates, UID sets and fetch items.
+func isAtomArg(a string) bool {
+	if strings.HasPrefix(a, "(") {
+		return true
+	}
+	switch a {
+	case "LOGIN", "EXAMINE", "UID", "SEARCH", "FETCH", "LOGOUT", "STARTTLS", "CHARSET", "UTF-8",
+		"UNDELETED", "NOT", "TEXT", "SUBJECT", "FROM", "SINCE", "BEFORE":
+		return true
+	}
+	return regexp.MustCompile(`^(\d+-[A-Z][a-z]{2}-\d{4}|[\d,]+)$`).MatchString(a)
+}
+
+// matches evaluates a SEARCH program against m.
+func (m fakeMessage) matches(keys []string) bool {
+	msg, err := mail.ReadMessage(strings.NewReader(m.raw))
+	if err != nil {
+		panic(err)
+	}
+	contains := func(s, sub string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(strings.TrimPrefix(sub, "\x00")))
+	}
+	decoded := func(header string) string {
+		d, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get(header))
+		return d
+	}
+	for i := 0; i < len(keys); i++ {
+		not := false
+		if keys[i] == "CHARSET" {
+			i++
+			continue
+		}
+		if keys[i] == "NOT" {
+			not = true
+			i++
+		}
+		var ok bool
+		switch keys[i] {
+		case "UNDELETED":
+			ok = !m.deleted
+		case "TEXT":
+			i++
+			ok = contains(m.raw, keys[i]) || contains(decoded("Subject"), keys[i])
+		case "SUBJECT":
+			i++
+			ok = contains(decoded("Subject"), keys[i])
+		case "FROM":
+			i++
+			ok = contains(decoded("From"), keys[i])
+		case "SINCE", "BEFORE":
+			i++
+			d, err := time.Parse(dateLayout, keys[i])
+			if err != nil {
+				panic(err)
+			}
+			ok = !m.received.Before(d)
+			if keys[i-1] == "BEFORE" {
+				ok = m.received.Before(d)
+			}
+		default:
+			panic("unexpected search key " + keys[i])
+		}
+		if ok == not {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchData renders the FETCH data items APIClient asks for.
+func (m fakeMessage) fetchData() string {
+	msg, err := mail.ReadMessage(strings.NewReader(m.raw))
+	if err != nil {
+		panic(err)
+	}
+	h := msg.Header
+	body, _ := io.ReadAll(msg.Body)
+	if len(body) > previewBytes {
+		body = body[:previewBytes]
+	}
+	var fields strings.Builder
+	for _, k := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if v := h.Get(k); v != "" {
+			fmt.Fprintf(&fields, "%s: %s\r\n", k, v)
+		}
+	}
+	fields.WriteString("\r\n")
+
+	envelope := fmt.Sprintf("(%s %s %s NIL NIL %s NIL NIL NIL %s)",
+		imapString(h.Get("Date")), imapString(h.Get("Subject")),
+		imapAddresses(h.Get("From")), imapAddresses(h.Get("To")), imapString(h.Get("Message-Id")))
+	return fmt.Sprintf("(UID %d INTERNALDATE %q ENVELOPE %s BODY[HEADER.FIELDS (CONTENT-TYPE CONTENT-TRANSFER-ENCODING)] %s BODY[TEXT]<0> %s)",
+		m.uid, m.received.Format(internalDateLayout), envelope, imapLiteral(fields.String()), imapLiteral(string(body)))
+}
+
+func imapString(s string) string {
+	if s == "" {
+		return "NIL"
+	}
+	return quote(s)
+}
+
+func imapLiteral(s string) string {
+	return fmt.Sprintf("{%d}\r\n%s", len(s), s)
+}
+
+// imapAddresses renders an address header as an envelope address list,
+// keeping display names encoded as they are in the header.
+func imapAddresses(header string) string {
+	if header == "" {
+		return "NIL"
+	}
+	var b strings.Builder
+	b.WriteString("(")
+	for _, a := range strings.Split(header, ",") {
+		a = strings.TrimSpace(a)
+		name, addr := "", a
+		if i := strings.LastIndex(a, "<"); i >= 0 {
+			name, addr = strings.TrimSpace(a[:i]), strings.Trim(a[i:], "<>")
+		}
+		local, host, _ := strings.Cut(addr, "@")
+		fmt.Fprintf(&b, "(%s NIL %s %s)", imapString(name), imapString(local), imapString(host))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and a
+// pool that trusts it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake imap"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, roots
+}
@@ -0,0 +1,188 @@
+// Package imap searches a mailbox on any IMAP server with the server's own
+// SEARCH command, so nothing has to be downloaded or indexed first.
+package imap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+// mimeTypeMessage is the MIME type of every IMAP result.
+const mimeTypeMessage = "message/rfc822"
+
+// defaultMailbox is the mailbox searched when none is configured.
+const defaultMailbox = "INBOX"
+
+// Message is a message found on the server.
+type Message struct {
+	UID     uint32
+	Mailbox string
+	// MessageID is the Message-ID header without its angle brackets; some
+	// messages have none.
+	MessageID string
+	Subject   string
+	From      string
+	To        string
+	// Date is when the message was sent, or else when the server received
+	// it.
+	Date time.Time
+	// Preview is the plain text of the start of the body.
+	Preview string
+	// URL is the message's IMAP URL (RFC 5092).
+	URL string
+}
+
+// Criterion is one IMAP SEARCH key. All of a search's keys must match.
+type Criterion struct {
+	// Key is TEXT, SUBJECT, FROM, SINCE or BEFORE.
+	Key string
+	// Value is the string searched for, or a date for SINCE and BEFORE.
+	Value string
+	Not   bool
+}
+
+// SearchRequest is one page of a search.
+type SearchRequest struct {
+	Mailbox  string
+	Criteria []Criterion
+	Limit    int
+	// BeforeUID, when set, continues a search with the messages older than
+	// the one with this UID.
+	BeforeUID uint32
+}
+
+// MailClient abstracts an IMAP server for testability.
+type MailClient interface {
+	// Search returns one page of the messages matching req, newest first,
+	// and whether more match.
+	Search(ctx context.Context, req SearchRequest) ([]Message, bool, error)
+}
+
+// Connector implements connectors.Connector for an IMAP mailbox.
+type Connector struct {
+	client  MailClient
+	name    string
+	mailbox string
+}
+
+// NewConnector creates an IMAP connector with the given client. It searches
+// the INBOX.
+func NewConnector(client MailClient) *Connector {
+	return &Connector{client: client, name: "imap", mailbox: defaultMailbox}
+}
+
+// WithName sets the name the connector reports and stamps on its results,
+// so several accounts can be configured side by side. It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+// WithMailbox sets the mailbox searched, e.g. "Archive". It returns c.
+func (c *Connector) WithMailbox(mailbox string) *Connector {
+	if mailbox != "" {
+		c.mailbox = mailbox
+	}
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the SEARCH program Search would send and how much of
+// each message it fetches.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	criteria, ok := buildSearchCriteria(parsed)
+	if !ok {
+		return connectors.Explanation{Params: map[string]string{
+			"skipped": "type: filter cannot match an email message; the server is not contacted",
+		}}, nil
+	}
+	params := map[string]string{
+		"mailbox": c.mailbox,
+		"limit":   strconv.Itoa(pageSize(req.Limit)),
+		"fetch":   fetchItems,
+	}
+	if needsUTF8(criteria) {
+		params["charset"] = "UTF-8"
+	}
+	return connectors.Explanation{Query: formatCriteria(criteria), Params: params}, nil
+}
+
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	criteria, ok := buildSearchCriteria(parsed)
+	if !ok {
+		return connectors.Page{Results: []connectors.Result{}}, nil
+	}
+	sr := SearchRequest{Mailbox: c.mailbox, Criteria: criteria, Limit: req.Limit}
+	if req.Cursor != "" {
+		before, err := strconv.ParseUint(req.Cursor, 10, 32)
+		if err != nil || before == 0 {
+			return connectors.Page{}, fmt.Errorf("invalid imap cursor %q", req.Cursor)
+		}
+		sr.BeforeUID = uint32(before)
+	}
+
+	messages, more, err := c.client.Search(ctx, sr)
+	if err != nil {
+		return connectors.Page{}, fmt.Errorf("imap search: %w", err)
+	}
+
+	terms := index.Terms(parsed)
+	results := make([]connectors.Result, len(messages))
+	for i, m := range messages {
+		results[i] = c.toResult(m, terms)
+	}
+	page := connectors.Page{Results: results}
+	if more && len(messages) > 0 {
+		// The cursor is the UID of the oldest message returned, so mail
+		// arriving between pages does not shift them.
+		page.NextCursor = strconv.FormatUint(uint64(messages[len(messages)-1].UID), 10)
+	}
+	return page, nil
+}
+
+func (c *Connector) toResult(m Message, terms []string) connectors.Result {
+	r := connectors.Result{
+		Title:      m.Subject,
+		Snippet:    index.Snippet(m.Preview, terms),
+		URL:        m.URL,
+		Source:     c.name,
+		ID:         m.MessageID,
+		CreatedAt:  m.Date,
+		ModifiedAt: m.Date,
+		Author:     m.From,
+		MimeType:   mimeTypeMessage,
+		Metadata: map[string]string{
+			"mailbox": m.Mailbox,
+			"uid":     strconv.FormatUint(uint64(m.UID), 10),
+		},
+	}
+	if r.Title == "" {
+		r.Title = "(No subject)"
+	}
+	if m.MessageID != "" {
+		r.Metadata["message_id"] = m.MessageID
+	} else {
+		r.ID = m.URL
+	}
+	if m.To != "" {
+		r.Metadata["to"] = m.To
+	}
+	return r
+}
@@ -0,0 +1,143 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockMailClient implements MailClient for testing.
+type MockMailClient struct {
+	mock.Mock
+}
+
+func (m *MockMailClient) Search(ctx context.Context, req SearchRequest) ([]Message, bool, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).([]Message), args.Bool(1), args.Error(2)
+}
+
+var budget = Message{
+	UID:       3,
+	Mailbox:   "INBOX",
+	MessageID: "budget-1@example.com",
+	Subject:   "Q2 budget",
+	From:      "Alice <alice@example.com>",
+	To:        "me@example.com",
+	Date:      time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+	Preview:   "Hi,\n\nthe budget for Q2 is attached.",
+	URL:       "imap://me%40example.com@imap.example.com:993/INBOX;UIDVALIDITY=42/;UID=3",
+}
+
+func TestConnector_Name(t *testing.T) {
+	assert.Equal(t, "imap", NewConnector(nil).Name())
+	assert.Equal(t, "work-mail", NewConnector(nil).WithName("work-mail").Name())
+}
+
+func TestConnector_Search_ReturnsResults(t *testing.T) {
+	mockClient := new(MockMailClient)
+	mockClient.On("Search", mock.Anything, SearchRequest{
+		Mailbox:  "INBOX",
+		Criteria: []Criterion{{Key: "TEXT", Value: "budget"}, {Key: "FROM", Value: "alice"}},
+		Limit:    5,
+	}).Return([]Message{budget}, false, nil)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "budget from:alice", Limit: 5})
+
+	require.NoError(t, err)
+	assert.Empty(t, page.NextCursor)
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, connectors.Result{
+		Title:      "Q2 budget",
+		Snippet:    "Hi, the budget for Q2 is attached.",
+		URL:        budget.URL,
+		Source:     "imap",
+		ID:         "budget-1@example.com",
+		CreatedAt:  budget.Date,
+		ModifiedAt: budget.Date,
+		Author:     "Alice <alice@example.com>",
+		MimeType:   "message/rfc822",
+		Metadata: map[string]string{
+			"mailbox":    "INBOX",
+			"uid":        "3",
+			"message_id": "budget-1@example.com",
+			"to":         "me@example.com",
+		},
+	}, page.Results[0])
+	mockClient.AssertExpectations(t)
+}
+
+func TestConnector_Search_MessageWithoutIDOrSubject(t *testing.T) {
+	mockClient := new(MockMailClient)
+	mockClient.On("Search", mock.Anything, mock.Anything).Return([]Message{{UID: 9, Mailbox: "Archive", URL: "imap://u@h:993/Archive/;UID=9"}}, false, nil)
+
+	page, err := NewConnector(mockClient).WithMailbox("Archive").Search(context.Background(), connectors.Request{Query: "x"})
+
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "(No subject)", page.Results[0].Title)
+	assert.Equal(t, "imap://u@h:993/Archive/;UID=9", page.Results[0].ID)
+	assert.Equal(t, map[string]string{"mailbox": "Archive", "uid": "9"}, page.Results[0].Metadata)
+	assert.Equal(t, "Archive", mockClient.Calls[0].Arguments[1].(SearchRequest).Mailbox)
+}
+
+func TestConnector_Search_Paging(t *testing.T) {
+	mockClient := new(MockMailClient)
+	mockClient.On("Search", mock.Anything, SearchRequest{Mailbox: "INBOX", Limit: 2}).Return([]Message{{UID: 12}, {UID: 9}}, true, nil).Once()
+	mockClient.On("Search", mock.Anything, SearchRequest{Mailbox: "INBOX", Limit: 2, BeforeUID: 9}).Return([]Message{{UID: 7}}, false, nil).Once()
+	c := NewConnector(mockClient)
+
+	page, err := c.Search(context.Background(), connectors.Request{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "9", page.NextCursor)
+
+	page, err = c.Search(context.Background(), connectors.Request{Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Len(t, page.Results, 1)
+	assert.Empty(t, page.NextCursor)
+	mockClient.AssertExpectations(t)
+
+	_, err = c.Search(context.Background(), connectors.Request{Cursor: "garbage"})
+	assert.ErrorContains(t, err, "invalid imap cursor")
+}
+
+func TestConnector_Search_Error(t *testing.T) {
+	mockClient := new(MockMailClient)
+	mockClient.On("Search", mock.Anything, mock.Anything).Return([]Message{}, false, errors.New("imap imap.example.com: LOGIN: NO Invalid credentials"))
+
+	_, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "x"})
+
+	assert.EqualError(t, err, "imap search: imap imap.example.com: LOGIN: NO Invalid credentials")
+}
+
+func TestConnector_Search_TypeThatCannotMatch(t *testing.T) {
+	mockClient := new(MockMailClient)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "type:pdf budget"})
+
+	require.NoError(t, err)
+	assert.Empty(t, page.Results)
+	mockClient.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+}
+
+func TestConnector_Explain(t *testing.T) {
+	c := NewConnector(nil).WithMailbox("Archive")
+
+	exp, err := c.Explain(connectors.Request{Query: "budget -from:bob after:2024-03-01"})
+	require.NoError(t, err)
+	assert.Equal(t, `UNDELETED TEXT "budget" NOT FROM "bob" SINCE 1-Mar-2024`, exp.Query)
+	assert.Equal(t, map[string]string{"mailbox": "Archive", "limit": "20", "fetch": fetchItems}, exp.Params)
+
+	exp, err = c.Explain(connectors.Request{Query: "café"})
+	require.NoError(t, err)
+	assert.Equal(t, "UTF-8", exp.Params["charset"])
+
+	exp, err = c.Explain(connectors.Request{Query: "type:pdf"})
+	require.NoError(t, err)
+	assert.Contains(t, exp.Params["skipped"], "the server is not contacted")
+}
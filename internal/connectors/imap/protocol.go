@@ -0,0 +1,387 @@
+package imap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// This file implements the part of the IMAP4rev1 wire protocol (RFC 3501)
+// the connector needs: sending commands, with literals for strings that
+// cannot be quoted, and reading responses into nested fields.
+
+// maxLiteral bounds the size of a literal the server may send, so a broken
+// or hostile server cannot exhaust memory.
+const maxLiteral = 16 << 20
+
+// An atom is a command argument sent as it is, such as a command name or a
+// date. Other strings are quoted, or sent as literals.
+type atom string
+
+// response is one line the server sent, with any literals read inline.
+type response struct {
+	// tag is "*" for untagged responses, "+" for continuation requests and
+	// otherwise the tag of the command it completes.
+	tag string
+	// status is "OK", "NO", "BAD", "BYE" or "PREAUTH" for status
+	// responses, and "" for data responses.
+	status string
+	// text is the human-readable text of a status response or
+	// continuation request, including any response code.
+	text string
+	// fields are the fields of a data response after its tag: atoms,
+	// numbers and strings as string, NIL as nil and lists as []any.
+	fields []any
+}
+
+// conn is a connection to an IMAP server.
+type conn struct {
+	nc  net.Conn
+	r   *bufio.Reader
+	w   *bufio.Writer
+	tag int
+}
+
+func newConn(nc net.Conn) *conn {
+	return &conn{nc: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+}
+
+// command sends a command and reads responses until the server completes
+// it, passing untagged responses to untagged if it is not nil. It returns
+// an error when the server answers anything but OK.
+func (c *conn) command(untagged func(response) error, args ...any) error {
+	c.tag++
+	tag := "A" + strconv.Itoa(c.tag)
+	name := fmt.Sprint(args[0])
+	if name == "UID" && len(args) > 1 {
+		name += " " + fmt.Sprint(args[1])
+	}
+
+	if _, err := c.w.WriteString(tag); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		c.w.WriteByte(' ')
+		switch a := arg.(type) {
+		case atom:
+			c.w.WriteString(string(a))
+		case string:
+			if quotable(a) {
+				c.w.WriteString(quote(a))
+				continue
+			}
+			// A literal is sent once the server asks for it.
+			fmt.Fprintf(c.w, "{%d}\r\n", len(a))
+			if err := c.w.Flush(); err != nil {
+				return err
+			}
+			if err := c.awaitContinuation(name, untagged); err != nil {
+				return err
+			}
+			c.w.WriteString(a)
+		default:
+			panic(fmt.Sprintf("imap: unsupported argument type %T", arg))
+		}
+	}
+	c.w.WriteString("\r\n")
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return err
+		}
+		switch resp.tag {
+		case tag:
+			if resp.status != "OK" {
+				return fmt.Errorf("%s: %s %s", name, resp.status, resp.text)
+			}
+			return nil
+		case "*":
+			if err := c.handleUntagged(resp, untagged); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// awaitContinuation reads responses until the server asks for the rest of
+// a command, or refuses it.
+func (c *conn) awaitContinuation(name string, untagged func(response) error) error {
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return err
+		}
+		switch resp.tag {
+		case "+":
+			return nil
+		case "*":
+			if err := c.handleUntagged(resp, untagged); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: %s %s", name, resp.status, resp.text)
+		}
+	}
+}
+
+func (c *conn) handleUntagged(resp response, untagged func(response) error) error {
+	if resp.status == "BYE" {
+		return fmt.Errorf("server closed the connection: %s", resp.text)
+	}
+	if untagged == nil {
+		return nil
+	}
+	return untagged(resp)
+}
+
+// quotable reports whether s can be sent as a quoted string: quoted
+// strings may only hold 7-bit characters other than CR and LF.
+func quotable(s string) bool {
+	if len(s) > 1000 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0 || s[i] == '\r' || s[i] == '\n' || s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// statuses are the status response types.
+var statuses = map[string]bool{"OK": true, "NO": true, "BAD": true, "BYE": true, "PREAUTH": true}
+
+// readResponse reads the next response line.
+func (c *conn) readResponse() (response, error) {
+	var resp response
+	tag, err := c.readAtom()
+	if err != nil {
+		return resp, err
+	}
+	resp.tag = tag
+	if tag == "+" {
+		resp.text, err = c.readText()
+		return resp, err
+	}
+	if err := c.expect(' '); err != nil {
+		return resp, err
+	}
+
+	// A status response is its type followed by free text.
+	if b, err := c.r.Peek(1); err == nil && b[0] != '(' && b[0] != '"' && b[0] != '{' {
+		word, err := c.readAtom()
+		if err != nil {
+			return resp, err
+		}
+		if statuses[strings.ToUpper(word)] {
+			resp.status = strings.ToUpper(word)
+			resp.text, err = c.readText()
+			return resp, err
+		}
+		resp.fields = append(resp.fields, word)
+	}
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return resp, err
+		}
+		switch b {
+		case '\r':
+			return resp, c.expect('\n')
+		case '\n':
+			return resp, nil
+		case ' ':
+			continue
+		}
+		c.r.UnreadByte()
+		field, err := c.readField()
+		if err != nil {
+			return resp, err
+		}
+		resp.fields = append(resp.fields, field)
+	}
+}
+
+// readField reads a list, quoted string, literal, NIL or atom.
+func (c *conn) readField() (any, error) {
+	b, err := c.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch b {
+	case '(':
+		list := []any{}
+		for {
+			b, err := c.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			switch b {
+			case ')':
+				return list, nil
+			case ' ':
+				continue
+			}
+			c.r.UnreadByte()
+			field, err := c.readField()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, field)
+		}
+	case '"':
+		return c.readQuoted()
+	case '{':
+		return c.readLiteral()
+	}
+	c.r.UnreadByte()
+	a, err := c.readAtom()
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(a, "NIL") {
+		return nil, nil
+	}
+	return a, nil
+}
+
+// readAtom reads an atom. Square brackets may enclose spaces and
+// parentheses, as in BODY[HEADER.FIELDS (SUBJECT)] or a response code.
+func (c *conn) readAtom() (string, error) {
+	var b strings.Builder
+	depth := 0
+	for {
+		ch, err := c.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case ch == '[':
+			depth++
+		case ch == ']' && depth > 0:
+			depth--
+		case depth == 0 && (ch == ' ' || ch == '(' || ch == ')' || ch == '\r' || ch == '\n'):
+			c.r.UnreadByte()
+			if b.Len() == 0 {
+				return "", fmt.Errorf("imap: unexpected %q in response", ch)
+			}
+			return b.String(), nil
+		}
+		b.WriteByte(ch)
+	}
+}
+
+func (c *conn) readQuoted() (string, error) {
+	var b strings.Builder
+	for {
+		ch, err := c.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch ch {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if ch, err = c.r.ReadByte(); err != nil {
+				return "", err
+			}
+		case '\r', '\n':
+			return "", errors.New("imap: unterminated quoted string in response")
+		}
+		b.WriteByte(ch)
+	}
+}
+
+func (c *conn) readLiteral() (string, error) {
+	s, err := c.r.ReadString('}')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(s, "}"))
+	if err != nil || n < 0 || n > maxLiteral {
+		return "", fmt.Errorf("imap: invalid literal size {%s in response", s)
+	}
+	if err := c.expect('\r'); err != nil {
+		return "", err
+	}
+	if err := c.expect('\n'); err != nil {
+		return "", err
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// readText reads the rest of the line.
+func (c *conn) readText() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func (c *conn) expect(want byte) error {
+	b, err := c.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b != want {
+		return fmt.Errorf("imap: got %q in response, want %q", b, want)
+	}
+	return nil
+}
+
+// mailboxEncoding is the base64 variant of modified UTF-7.
+var mailboxEncoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+// encodeMailbox encodes a mailbox name in the modified UTF-7 IMAP uses for
+// names that are not plain ASCII (RFC 3501 section 5.1.3).
+func encodeMailbox(name string) string {
+	var b strings.Builder
+	var pending []rune
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		units := utf16.Encode(pending)
+		buf := make([]byte, 0, 2*len(units))
+		for _, u := range units {
+			buf = append(buf, byte(u>>8), byte(u))
+		}
+		b.WriteByte('&')
+		b.WriteString(mailboxEncoding.EncodeToString(buf))
+		b.WriteByte('-')
+		pending = pending[:0]
+	}
+	for _, r := range name {
+		if r >= 0x20 && r <= 0x7e {
+			flush()
+			if r == '&' {
+				b.WriteString("&-")
+			} else {
+				b.WriteRune(r)
+			}
+			continue
+		}
+		pending = append(pending, r)
+	}
+	flush()
+	return b.String()
+}
@@ -0,0 +1,517 @@
+// Package mailarchive searches mail kept on the local filesystem in mbox
+// files and Maildir directories, such as archives exported from a mail
+// client or synced by a tool like mbsync. Messages are indexed locally and
+// the index is brought up to date before each search by re-reading only
+// the files that changed. Results link to a view of the message served by
+// pkb serve.
+package mailarchive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/email"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+const (
+	defaultLimit = 20
+	mimeType     = "message/rfc822"
+	// dateLayout is how message dates are shown in a view.
+	dateLayout = "Mon, 2 Jan 2006 15:04 -0700"
+)
+
+// Connector implements connectors.Connector and connectors.Viewer for a set
+// of mbox files and Maildir directories.
+//
+// Each configured path may be an mbox file, a Maildir (a directory with
+// cur and new subdirectories), or a directory that is searched for both,
+// such as a Thunderbird profile's Mail folder or a tree of Maildir++
+// folders.
+type Connector struct {
+	paths    []string
+	baseURL  string
+	name     string
+	indexDir string
+
+	// mu serializes scans and guards everything below it.
+	mu     sync.Mutex
+	loaded bool
+	index  *index.Index
+	files  map[string]fileState
+}
+
+// fileState is the version of a file that was indexed and the messages
+// read from it. It is persisted next to the index.
+type fileState struct {
+	ModTime time.Time
+	Size    int64
+	// IDs is empty for files that turned out not to hold mail.
+	IDs []string `json:",omitempty"`
+}
+
+// NewConnector creates a connector for the mail under paths. Results link
+// to message views served by pkb serve at baseURL. Until WithIndexDir is
+// called, the index lives in memory and every new process reads all the
+// mail again.
+func NewConnector(baseURL string, paths ...string) *Connector {
+	return &Connector{
+		paths:   paths,
+		baseURL: baseURL,
+		name:    "mail-archive",
+		index:   index.New(),
+		files:   map[string]fileState{},
+	}
+}
+
+// WithName sets the name the connector reports and stamps on its results.
+// It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+// WithIndexDir keeps the index in dir, named after the connector, so that
+// only mail added or changed since the last search is read. It returns c.
+func (c *Connector) WithIndexDir(dir string) *Connector {
+	c.indexDir = dir
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the stemmed terms searched for and the paths searched.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	return connectors.Explanation{
+		Query:  strings.Join(index.Terms(parsed), " "),
+		Params: map[string]string{"paths": strings.Join(c.paths, ","), "limit": strconv.Itoa(limit)},
+	}, nil
+}
+
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	offset := 0
+	if req.Cursor != "" {
+		if offset, err = strconv.Atoi(req.Cursor); err != nil || offset < 0 {
+			return connectors.Page{}, fmt.Errorf("invalid mail archive cursor %q", req.Cursor)
+		}
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	warnings, err := c.update(ctx)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+
+	terms := index.Terms(parsed)
+	hits := c.index.Search(parsed)
+	end := min(offset+limit, len(hits))
+	results := []connectors.Result{}
+	for _, h := range hits[min(offset, end):end] {
+		r := h.Doc.Result
+		r.Snippet = index.Snippet(h.Doc.Body, terms)
+		results = append(results, r)
+	}
+
+	var next string
+	if end < len(hits) {
+		next = strconv.Itoa(end)
+	}
+	return connectors.Page{Results: results, NextCursor: next, Warnings: warnings}, nil
+}
+
+// View reads the message with the given result ID from its file.
+func (c *Connector) View(ctx context.Context, id string) (connectors.View, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Maildir messages are renamed as their flags change, so the index
+	// must be current to know where the message is.
+	if _, err := c.update(ctx); err != nil {
+		return connectors.View{}, err
+	}
+	d, ok := c.index.Get(c.name, id)
+	if !ok {
+		return connectors.View{}, fmt.Errorf("message %s: %w", id, connectors.ErrNotFound)
+	}
+	raw, err := readMessage(d.Metadata["path"], d.Metadata["offset"])
+	if errors.Is(err, fs.ErrNotExist) {
+		return connectors.View{}, fmt.Errorf("message %s: %w", id, connectors.ErrNotFound)
+	}
+	if err != nil {
+		return connectors.View{}, fmt.Errorf("read message %s: %w", id, err)
+	}
+	m, err := email.Parse(bytes.NewReader(raw))
+	if err != nil {
+		return connectors.View{}, fmt.Errorf("read message %s: %w", id, err)
+	}
+
+	v := connectors.View{Title: title(m)}
+	for _, f := range []connectors.ViewField{
+		{Name: "From", Value: m.From},
+		{Name: "To", Value: m.To},
+		{Name: "Cc", Value: m.Cc},
+		{Name: "Date", Value: formatDate(m.Date)},
+		{Name: "Attachments", Value: strings.Join(m.Attachments, ", ")},
+	} {
+		if f.Value != "" {
+			v.Fields = append(v.Fields, f)
+		}
+	}
+	v.Sections = []connectors.ViewSection{{Text: m.Text}}
+	return v, nil
+}
+
+// readMessage returns the raw message stored at path: the whole file for
+// a Maildir message, or the message starting at offset for an mbox file.
+func readMessage(path, offset string) ([]byte, error) {
+	if offset == "" {
+		return os.ReadFile(path)
+	}
+	off, err := strconv.ParseInt(offset, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid offset %q", offset)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var raw []byte
+	err = readMbox(f, off, func(_ int64, msg []byte) error {
+		raw = msg
+		return errStop
+	})
+	if errors.Is(err, errNotMbox) {
+		// The file was rewritten since it was indexed.
+		return nil, fmt.Errorf("%s changed: %w", path, fs.ErrNotExist)
+	}
+	return raw, err
+}
+
+// load opens the persisted index on first use. The caller must hold mu.
+func (c *Connector) load() error {
+	if c.loaded || c.indexDir == "" {
+		c.loaded = true
+		return nil
+	}
+	ix, err := index.Open(filepath.Join(c.indexDir, c.name+".gob"))
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(c.statePath())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read mail archive state: %w", err)
+	}
+	files := map[string]fileState{}
+	if data != nil {
+		if err := json.Unmarshal(data, &files); err != nil {
+			return fmt.Errorf("read mail archive state %s: %w", c.statePath(), err)
+		}
+	}
+	c.index, c.files, c.loaded = ix, files, true
+	return nil
+}
+
+func (c *Connector) statePath() string {
+	return filepath.Join(c.indexDir, c.name+".json")
+}
+
+// save persists the index and the state of the files it was built from.
+// The caller must hold mu.
+func (c *Connector) save() error {
+	if c.indexDir == "" {
+		return nil
+	}
+	if err := c.index.Save(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c.files)
+	if err != nil {
+		return fmt.Errorf("save mail archive state: %w", err)
+	}
+	tmp := c.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("save mail archive state: %w", err)
+	}
+	if err := os.Rename(tmp, c.statePath()); err != nil {
+		return fmt.Errorf("save mail archive state: %w", err)
+	}
+	return nil
+}
+
+// update brings the index up to date with the files under the configured
+// paths: new and modified files are (re)indexed and messages no longer in
+// any file are removed. Paths and files that cannot be read are skipped
+// and reported as warnings. The caller must hold mu.
+func (c *Connector) update(ctx context.Context) ([]string, error) {
+	if err := c.load(); err != nil {
+		return nil, fmt.Errorf("open mail archive index: %w", err)
+	}
+	s := &scan{c: c, ctx: ctx, files: map[string]fileState{}, maildirs: map[string]bool{}}
+	for _, root := range c.paths {
+		if err := s.walk(root); err != nil {
+			return nil, err
+		}
+	}
+	for path := range c.files {
+		if _, ok := s.files[path]; !ok {
+			s.changed = true
+		}
+	}
+	c.files = s.files
+	if !s.changed {
+		return s.warnings, nil
+	}
+
+	live := map[string]bool{}
+	for _, f := range c.files {
+		for _, id := range f.IDs {
+			live[id] = true
+		}
+	}
+	for _, id := range c.index.IDs(c.name) {
+		if !live[id] {
+			c.index.Delete(c.name, id)
+		}
+	}
+	if err := c.save(); err != nil {
+		return nil, fmt.Errorf("save mail archive index: %w", err)
+	}
+	return s.warnings, nil
+}
+
+// scan is the state of one update.
+type scan struct {
+	c        *Connector
+	ctx      context.Context
+	files    map[string]fileState
+	maildirs map[string]bool
+	warnings []string
+	changed  bool
+}
+
+func (s *scan) warn(path string, err error) {
+	s.warnings = append(s.warnings, fmt.Sprintf("skipped %s: %v", path, err))
+}
+
+// walk indexes the mail under root.
+func (s *scan) walk(root string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		s.warn(root, err)
+		return nil
+	}
+	if !info.IsDir() {
+		return s.file(root, info, false)
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			s.warn(path, err)
+			return nil
+		}
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		dir := filepath.Dir(path)
+		if d.IsDir() {
+			// Messages being delivered are not complete yet.
+			if d.Name() == "tmp" && s.isMaildir(dir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Skip index files, lock files and other hidden entries.
+		if strings.HasPrefix(d.Name(), ".") || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			s.warn(path, err)
+			return nil
+		}
+		base := filepath.Base(dir)
+		return s.file(path, info, (base == "cur" || base == "new") && s.isMaildir(filepath.Dir(dir)))
+	})
+}
+
+// isMaildir reports whether dir has the cur and new subdirectories of a
+// Maildir.
+func (s *scan) isMaildir(dir string) bool {
+	is, ok := s.maildirs[dir]
+	if !ok {
+		cur, err1 := os.Stat(filepath.Join(dir, "cur"))
+		nw, err2 := os.Stat(filepath.Join(dir, "new"))
+		is = err1 == nil && err2 == nil && cur.IsDir() && nw.IsDir()
+		s.maildirs[dir] = is
+	}
+	return is
+}
+
+// file indexes the file at path, unless it is unchanged since it was last
+// indexed. Files in a Maildir hold one message; others are read as mbox
+// files when they are one.
+func (s *scan) file(path string, info fs.FileInfo, inMaildir bool) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	c := s.c
+	if f, ok := c.files[path]; ok && f.ModTime.Equal(info.ModTime()) && f.Size == info.Size() {
+		s.files[path] = f
+		return nil
+	}
+
+	var docs []connectors.Document
+	var err error
+	if inMaildir {
+		docs, err = c.readMaildirMessage(path, info)
+	} else {
+		docs, err = c.readMbox(s.ctx, path)
+	}
+	if errors.Is(err, errNotMbox) {
+		err = nil
+	}
+	if err != nil {
+		s.warn(path, err)
+		return nil
+	}
+	f := fileState{ModTime: info.ModTime(), Size: info.Size()}
+	for _, d := range docs {
+		f.IDs = append(f.IDs, d.ID)
+	}
+	c.index.Put(docs...)
+	s.files[path] = f
+	s.changed = true
+	return nil
+}
+
+// readMaildirMessage reads the Maildir message at path. Its ID is the
+// Maildir and the message's unique name, which stays the same when the
+// flags after the ":" in its file name change.
+func (c *Connector) readMaildirMessage(path string, info fs.FileInfo) ([]connectors.Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := email.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	maildir := filepath.Dir(filepath.Dir(path))
+	unique, _, _ := strings.Cut(filepath.Base(path), ":")
+	d := c.document(filepath.ToSlash(filepath.Join(maildir, unique)), mailboxName(maildir), m)
+	d.Metadata["path"] = path
+	if d.ModifiedAt.IsZero() {
+		d.ModifiedAt = info.ModTime()
+	}
+	return []connectors.Document{d}, nil
+}
+
+// readMbox reads every message of the mbox file at path. A message's ID is
+// the file's path and the message's offset in it. Messages that cannot be
+// parsed are skipped.
+func (c *Connector) readMbox(ctx context.Context, path string) ([]connectors.Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mailbox := mailboxName(path)
+	var docs []connectors.Document
+	err = readMbox(f, 0, func(offset int64, raw []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		m, err := email.Parse(bytes.NewReader(raw))
+		if err != nil {
+			return nil
+		}
+		off := strconv.FormatInt(offset, 10)
+		d := c.document(filepath.ToSlash(path)+"#"+off, mailbox, m)
+		d.Metadata["path"] = path
+		d.Metadata["offset"] = off
+		docs = append(docs, d)
+		return nil
+	})
+	return docs, err
+}
+
+// document converts a message to the form stored in the index.
+func (c *Connector) document(id, mailbox string, m email.Message) connectors.Document {
+	r := connectors.Result{
+		Title:      title(m),
+		URL:        connectors.ViewURL(c.baseURL, c.name, id),
+		Source:     c.name,
+		ID:         id,
+		CreatedAt:  m.Date,
+		ModifiedAt: m.Date,
+		Author:     m.From,
+		MimeType:   mimeType,
+		Metadata:   map[string]string{"mailbox": mailbox},
+	}
+	if m.MessageID != "" {
+		r.Metadata["message_id"] = m.MessageID
+	}
+	if m.To != "" {
+		r.Metadata["to"] = m.To
+	}
+	if len(m.Attachments) > 0 {
+		r.Metadata["attachments"] = strings.Join(m.Attachments, ", ")
+	}
+	return connectors.Document{Result: r, Body: m.Text}
+}
+
+// mailboxName names the mailbox stored at path: an mbox file's name
+// without its extension, or a Maildir's directory name without the
+// leading dot of Maildir++ folders.
+func mailboxName(path string) string {
+	name := strings.TrimPrefix(filepath.Base(path), ".")
+	return strings.TrimSuffix(name, ".mbox")
+}
+
+func title(m email.Message) string {
+	if m.Subject == "" {
+		return "(No subject)"
+	}
+	return m.Subject
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(dateLayout)
+}
@@ -0,0 +1,265 @@
+package mailarchive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const baseURL = "http://localhost:8080"
+
+// writeFile writes a file under root, creating folders.
+func writeFile(t *testing.T, root, rel, src string) string {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(src), 0o644))
+	return path
+}
+
+const archiveMbox = `From alice@example.com Fri Mar  1 09:00:00 2024
+From: Alice Example <alice@example.com>
+To: me@example.com
+Subject: Q2 budget
+Date: Fri, 01 Mar 2024 09:00:00 +0000
+Message-ID: <budget-1@example.com>
+Content-Type: multipart/mixed; boundary=b
+
+--b
+Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+The budget for the caf=E9 is attached.
+>From now on, send receipts.
+--b
+Content-Type: application/pdf
+Content-Disposition: attachment; filename=budget.pdf
+
+%PDF
+--b--
+
+From bob@example.com Sat Mar  2 10:00:00 2024
+From: Bob <bob@example.com>
+Subject: Lunch
+Date: Sat, 02 Mar 2024 10:00:00 +0000
+
+Lunch at noon?
+`
+
+// newTestArchive writes an mbox file and a Maildir++ tree under a temporary
+// directory and returns its path.
+func newTestArchive(t *testing.T) string {
+	root := t.TempDir()
+	writeFile(t, root, "Archive.mbox", archiveMbox)
+	writeFile(t, root, "Maildir/cur/1709290800.M1P1.host:2,S", "From: Carol <carol@example.com>\n"+
+		"Subject: =?utf-8?q?Offsite_in_K=C3=B6ln?=\nDate: Sat, 02 Mar 2024 12:00:00 +0000\n\nThe offsite budget is approved.\n")
+	writeFile(t, root, "Maildir/.Sent/new/1709300000.M2P2.host", "From: me@example.com\nSubject: Re: Lunch\n\nSounds good.\n")
+	writeFile(t, root, "Maildir/.Sent/tmp/1709300001.M3P3.host", "Subject: Draft budget\n\nStill being delivered.\n")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "Maildir", "new"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "Maildir", ".Sent", "cur"), 0o755))
+	writeFile(t, root, "Maildir/dovecot.index", "budget")
+	writeFile(t, root, "notes.txt", "budget")
+	return root
+}
+
+func search(t *testing.T, c *Connector, q string) connectors.Page {
+	t.Helper()
+	page, err := c.Search(context.Background(), connectors.Request{Query: q})
+	require.NoError(t, err)
+	return page
+}
+
+func titles(page connectors.Page) []string {
+	var titles []string
+	for _, r := range page.Results {
+		titles = append(titles, r.Title)
+	}
+	return titles
+}
+
+func TestConnector_Name(t *testing.T) {
+	assert.Equal(t, "mail-archive", NewConnector(baseURL).Name())
+	assert.Equal(t, "old-mail", NewConnector(baseURL).WithName("old-mail").Name())
+}
+
+func TestConnector_Search(t *testing.T) {
+	root := newTestArchive(t)
+	c := NewConnector(baseURL, root)
+
+	page := search(t, c, "budget")
+	assert.ElementsMatch(t, []string{"Q2 budget", "Offsite in Köln"}, titles(page), "tmp and non-mail files are skipped")
+	assert.Empty(t, page.Warnings)
+
+	page = search(t, c, "café")
+	require.Len(t, page.Results, 1)
+	r := page.Results[0]
+	mbox := filepath.Join(root, "Archive.mbox")
+	id := filepath.ToSlash(mbox) + "#0"
+	assert.Equal(t, connectors.Result{
+		Title:      "Q2 budget",
+		Snippet:    "The budget for the café is attached. From now on, send receipts.",
+		URL:        connectors.ViewURL(baseURL, "mail-archive", id),
+		Source:     "mail-archive",
+		ID:         id,
+		CreatedAt:  time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		ModifiedAt: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		Author:     "Alice Example <alice@example.com>",
+		MimeType:   "message/rfc822",
+		Metadata: map[string]string{
+			"mailbox":     "Archive",
+			"path":        mbox,
+			"offset":      "0",
+			"message_id":  "budget-1@example.com",
+			"to":          "me@example.com",
+			"attachments": "budget.pdf",
+		},
+	}, normalizeDates(r))
+
+	page = search(t, c, "from:carol")
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, filepath.ToSlash(filepath.Join(root, "Maildir", "1709290800.M1P1.host")), page.Results[0].ID)
+	assert.Equal(t, "Maildir", page.Results[0].Metadata["mailbox"])
+
+	page = search(t, c, "sounds")
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "Sent", page.Results[0].Metadata["mailbox"])
+	assert.False(t, page.Results[0].ModifiedAt.IsZero(), "messages without a date use the file's")
+}
+
+// normalizeDates returns r with its dates in UTC, for comparison.
+func normalizeDates(r connectors.Result) connectors.Result {
+	r.CreatedAt, r.ModifiedAt = r.CreatedAt.UTC(), r.ModifiedAt.UTC()
+	return r
+}
+
+func TestConnector_Search_PicksUpChanges(t *testing.T) {
+	root := newTestArchive(t)
+	c := NewConnector(baseURL, root)
+	require.Len(t, search(t, c, "budget").Results, 2)
+
+	// Reading a Maildir message renames it without changing its ID.
+	cur := filepath.Join(root, "Maildir", "cur")
+	require.NoError(t, os.Rename(filepath.Join(cur, "1709290800.M1P1.host:2,S"), filepath.Join(cur, "1709290800.M1P1.host:2,RS")))
+	writeFile(t, root, "Maildir/new/1709400000.M4P4.host", "Subject: Budget v2\n\nNew numbers.\n")
+	require.NoError(t, os.Remove(filepath.Join(root, "Archive.mbox")))
+
+	page := search(t, c, "budget")
+	assert.ElementsMatch(t, []string{"Offsite in Köln", "Budget v2"}, titles(page))
+	assert.Equal(t, filepath.Join(cur, "1709290800.M1P1.host:2,RS"), page.Results[slices.Index(titles(page), "Offsite in Köln")].Metadata["path"])
+}
+
+func TestConnector_Search_PersistsIndex(t *testing.T) {
+	root := newTestArchive(t)
+	dir := filepath.Join(t.TempDir(), "mail-archive")
+	require.Len(t, search(t, NewConnector(baseURL, root).WithIndexDir(dir).WithName("old"), "budget").Results, 2)
+	assert.FileExists(t, filepath.Join(dir, "old.gob"))
+	assert.FileExists(t, filepath.Join(dir, "old.json"))
+
+	// A new connector reuses the index and does not read unchanged files:
+	// an edit that keeps the file's size and modification time goes
+	// unnoticed.
+	mbox := filepath.Join(root, "Archive.mbox")
+	info, err := os.Stat(mbox)
+	require.NoError(t, err)
+	writeFile(t, root, "Archive.mbox", strings.Replace(archiveMbox, "Lunch at noon?", "Lunch at one??", 1))
+	require.NoError(t, os.Chtimes(mbox, info.ModTime(), info.ModTime()))
+	c := NewConnector(baseURL, root).WithIndexDir(dir).WithName("old")
+	assert.Len(t, search(t, c, "budget").Results, 2)
+	assert.Empty(t, search(t, c, "one").Results)
+}
+
+func TestConnector_Search_Paging(t *testing.T) {
+	c := NewConnector(baseURL, newTestArchive(t))
+
+	page, err := c.Search(context.Background(), connectors.Request{Limit: 3})
+	require.NoError(t, err)
+	assert.Len(t, page.Results, 3)
+	assert.Equal(t, "3", page.NextCursor)
+
+	page, err = c.Search(context.Background(), connectors.Request{Limit: 3, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Len(t, page.Results, 1)
+	assert.Empty(t, page.NextCursor)
+
+	_, err = c.Search(context.Background(), connectors.Request{Cursor: "garbage"})
+	assert.ErrorContains(t, err, "invalid mail archive cursor")
+}
+
+func TestConnector_Search_MissingPathIsAWarning(t *testing.T) {
+	root := newTestArchive(t)
+	c := NewConnector(baseURL, filepath.Join(root, "missing.mbox"), filepath.Join(root, "Archive.mbox"))
+
+	page := search(t, c, "lunch")
+
+	assert.Len(t, page.Results, 1)
+	require.Len(t, page.Warnings, 1)
+	assert.Contains(t, page.Warnings[0], "missing.mbox")
+}
+
+func TestConnector_Search_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewConnector(baseURL, newTestArchive(t)).Search(ctx, connectors.Request{Query: "budget"})
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestConnector_View(t *testing.T) {
+	root := newTestArchive(t)
+	c := NewConnector(baseURL, root)
+	page := search(t, c, "lunch -from:me")
+	require.Len(t, page.Results, 1)
+
+	v, err := c.View(context.Background(), filepath.ToSlash(filepath.Join(root, "Archive.mbox"))+"#0")
+	require.NoError(t, err)
+	assert.Equal(t, connectors.View{
+		Title: "Q2 budget",
+		Fields: []connectors.ViewField{
+			{Name: "From", Value: "Alice Example <alice@example.com>"},
+			{Name: "To", Value: "me@example.com"},
+			{Name: "Date", Value: "Fri, 1 Mar 2024 09:00 +0000"},
+			{Name: "Attachments", Value: "budget.pdf"},
+		},
+		Sections: []connectors.ViewSection{{Text: "The budget for the café is attached.\nFrom now on, send receipts."}},
+	}, v)
+
+	v, err = c.View(context.Background(), page.Results[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Lunch", v.Title)
+	assert.Equal(t, "Lunch at noon?", v.Sections[0].Text)
+}
+
+func TestConnector_View_NotFound(t *testing.T) {
+	root := newTestArchive(t)
+	c := NewConnector(baseURL, root)
+
+	_, err := c.View(context.Background(), filepath.ToSlash(filepath.Join(root, "Archive.mbox"))+"#1")
+	assert.ErrorIs(t, err, connectors.ErrNotFound)
+
+	// Only indexed messages can be viewed, not any file.
+	_, err = c.View(context.Background(), filepath.ToSlash(filepath.Join(root, "notes.txt")))
+	assert.ErrorIs(t, err, connectors.ErrNotFound)
+}
+
+func TestConnector_Explain(t *testing.T) {
+	exp, err := NewConnector(baseURL, "/mail/a.mbox", "/mail/Maildir").Explain(connectors.Request{Query: "budgets from:alice"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "budget", exp.Query)
+	assert.Equal(t, map[string]string{"paths": "/mail/a.mbox,/mail/Maildir", "limit": "20"}, exp.Params)
+}
+
+func TestMailboxName(t *testing.T) {
+	assert.Equal(t, "Archive", mailboxName("/mail/Archive.mbox"))
+	assert.Equal(t, "Inbox", mailboxName("/thunderbird/Mail/Local Folders/Inbox"))
+	assert.Equal(t, "Sent", mailboxName("/home/me/Maildir/.Sent"))
+}
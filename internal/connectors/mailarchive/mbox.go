@@ -0,0 +1,78 @@
+package mailarchive
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// errStop is returned by a readMbox callback to stop reading early.
+var errStop = errors.New("stop")
+
+// errNotMbox is returned by readMbox for input that does not start with a
+// "From " separator line.
+var errNotMbox = errors.New("not an mbox file")
+
+// readMbox calls fn with each message of the mbox read from r and the
+// offset of the "From " line that starts it, counting from base, r's
+// offset in its file. A "From " line only starts a new message at the
+// start of the input or after a blank line, and lines escaped as ">From "
+// are unescaped (both the mboxo and mboxrd conventions). Reading stops at
+// the first error from fn; errStop stops it without an error.
+func readMbox(r io.Reader, base int64, fn func(offset int64, raw []byte) error) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	if head, err := br.Peek(5); err != nil || string(head) != "From " {
+		return errNotMbox
+	}
+
+	var msg bytes.Buffer
+	start, pos := int64(-1), base
+	blank := true
+	flush := func() error {
+		if start < 0 {
+			return nil
+		}
+		err := fn(start, msg.Bytes())
+		msg.Reset()
+		return err
+	}
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case blank && bytes.HasPrefix(line, []byte("From ")):
+				if err := flush(); err != nil {
+					return stopped(err)
+				}
+				start = pos
+			case isEscapedFrom(line):
+				msg.Write(line[1:])
+			default:
+				msg.Write(line)
+			}
+			blank = len(bytes.TrimRight(line, "\r\n")) == 0
+			pos += int64(len(line))
+		}
+		if err == io.EOF {
+			return stopped(flush())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// isEscapedFrom reports whether line is a "From " line escaped with one or
+// more ">".
+func isEscapedFrom(line []byte) bool {
+	rest := bytes.TrimLeft(line, ">")
+	return len(rest) < len(line) && bytes.HasPrefix(rest, []byte("From "))
+}
+
+func stopped(err error) error {
+	if errors.Is(err, errStop) {
+		return nil
+	}
+	return err
+}
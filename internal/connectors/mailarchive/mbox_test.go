@@ -0,0 +1,65 @@
+package mailarchive
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mboxMessage struct {
+	offset int64
+	raw    string
+}
+
+func readAll(t *testing.T, mbox string) []mboxMessage {
+	t.Helper()
+	var msgs []mboxMessage
+	err := readMbox(strings.NewReader(mbox), 0, func(offset int64, raw []byte) error {
+		msgs = append(msgs, mboxMessage{offset, string(raw)})
+		return nil
+	})
+	require.NoError(t, err)
+	return msgs
+}
+
+func TestReadMbox(t *testing.T) {
+	mbox := "From alice@example.com Fri Mar  1 09:00:00 2024\n" +
+		"Subject: One\n\nFirst body.\nFrom the start, a line that is not a separator.\n>From escaped.\n>>From twice.\n\n" +
+		"From bob@example.com Sat Mar  2 10:00:00 2024\n" +
+		"Subject: Two\n\nSecond body.\n"
+
+	msgs := readAll(t, mbox)
+
+	require.Len(t, msgs, 2)
+	assert.Equal(t, mboxMessage{0, "Subject: One\n\nFirst body.\nFrom the start, a line that is not a separator.\nFrom escaped.\n>From twice.\n\n"}, msgs[0])
+	assert.Equal(t, int64(strings.Index(mbox, "From bob")), msgs[1].offset)
+	assert.Equal(t, "Subject: Two\n\nSecond body.\n", msgs[1].raw)
+}
+
+func TestReadMbox_CRLFAndNoTrailingNewline(t *testing.T) {
+	msgs := readAll(t, "From a\r\nSubject: One\r\n\r\nBody\r\n\r\nFrom b\r\nSubject: Two\r\n\r\nEnd")
+
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "Subject: Two\r\n\r\nEnd", msgs[1].raw)
+}
+
+func TestReadMbox_Stop(t *testing.T) {
+	calls := 0
+	err := readMbox(strings.NewReader("From a\n\nOne\n\nFrom b\n\nTwo\n"), 100, func(offset int64, _ []byte) error {
+		calls++
+		assert.Equal(t, int64(100), offset)
+		return errStop
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestReadMbox_NotMbox(t *testing.T) {
+	err := readMbox(strings.NewReader("Subject: not an mbox\n"), 0, func(int64, []byte) error { return nil })
+	assert.ErrorIs(t, err, errNotMbox)
+
+	err = readMbox(strings.NewReader(""), 0, func(int64, []byte) error { return nil })
+	assert.ErrorIs(t, err, errNotMbox)
+}
@@ -0,0 +1,306 @@
+package notion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+// defaultBaseURL is the Notion API endpoint.
+const defaultBaseURL = "https://api.notion.com/v1/"
+
+// apiVersion is the Notion-Version header sent with every request; the
+// response shapes decoded here are those of this version.
+const apiVersion = "2022-06-28"
+
+// Page size bounds. Both search and block children accept up to 100 items
+// per request.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// ErrRateLimited is wrapped by errors for requests Notion refused because
+// too many were made.
+var ErrRateLimited = errors.New("notion rate limit exceeded")
+
+// APIClient implements NotionClient over the Notion API with an internal
+// integration token. Only pages and databases shared with the integration
+// are visible.
+type APIClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewAPIClient creates a Notion API client authenticating with token. A
+// nil httpClient uses http.DefaultClient.
+func NewAPIClient(token string, httpClient *http.Client) *APIClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &APIClient{baseURL: defaultBaseURL, token: token, httpClient: httpClient}
+}
+
+// buildSearchRequest translates a pkb query into a search request.
+// Notion matches the query against titles only, so the positive free text
+// and title: clauses make up the query. after: and before: are applied to
+// the results by the connector; warnings list the clauses that are
+// ignored. ok is false when a type: clause excludes both pages and
+// databases, so the API need not be called.
+func buildSearchRequest(q query.Query) (req SearchRequest, warnings []string, ok bool) {
+	var terms []string
+	objects := map[string]bool{objectPage: true, objectDatabase: true}
+	for _, c := range q.Clauses {
+		switch c.Field {
+		case query.FieldText, query.FieldTitle:
+			if c.Negated {
+				warnings = append(warnings, query.Unsupported(c))
+				continue
+			}
+			terms = append(terms, c.Value)
+		case query.FieldType:
+			// Drop the object types the clause rules out.
+			for obj, mime := range map[string]string{objectPage: mimeTypePage, objectDatabase: mimeTypeDatabase} {
+				if query.MatchesMIMEType(c.Value, mime) == c.Negated {
+					objects[obj] = false
+				}
+			}
+		case query.FieldFrom:
+			warnings = append(warnings, query.Unsupported(c))
+		}
+		// source: is resolved by the search engine; dates by the connector.
+	}
+	switch {
+	case !objects[objectPage] && !objects[objectDatabase]:
+		return SearchRequest{}, nil, false
+	case !objects[objectDatabase]:
+		req.Object = objectPage
+	case !objects[objectPage]:
+		req.Object = objectDatabase
+	}
+	req.Query = strings.Join(terms, " ")
+	return req, warnings, true
+}
+
+// pageSize clamps a requested result limit to what the API accepts, using
+// defaultPageSize when no limit is given.
+func pageSize(limit int) int {
+	switch {
+	case limit <= 0:
+		return defaultPageSize
+	case limit > maxPageSize:
+		return maxPageSize
+	}
+	return limit
+}
+
+// do sends a request to the API and decodes the JSON response into out. A
+// nil body sends a GET; otherwise body is POSTed as JSON. Errors name the
+// endpoint called.
+func (c *APIClient) do(ctx context.Context, path string, body any, out any) error {
+	err := c.send(ctx, path, body, out)
+	if err != nil {
+		endpoint, _, _ := strings.Cut(path, "?")
+		return fmt.Errorf("notion %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+// send does the work of do.
+func (c *APIClient) send(ctx context.Context, path string, body any, out any) error {
+	method := http.MethodGet
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		method = http.MethodPost
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Notion-Version", apiVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retry := resp.Header.Get("Retry-After")
+		if retry == "" {
+			retry = "?"
+		}
+		return fmt.Errorf("%w, retry after %ss", ErrRateLimited, retry)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Errors carry a code such as "unauthorized" and a message.
+		var apiErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Code != "" {
+			return fmt.Errorf("%s: %s", apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// richText is a Notion rich text array; only its plain text is used.
+type richText []struct {
+	PlainText string `json:"plain_text"`
+}
+
+func (rt richText) String() string {
+	var b strings.Builder
+	for _, t := range rt {
+		b.WriteString(t.PlainText)
+	}
+	return b.String()
+}
+
+// property is a page property value. Exactly one property of every page
+// has type "title", but its name is whatever the parent database's schema
+// calls it ("Name", "Task", ...); pages outside databases call it "title".
+type property struct {
+	Type  string   `json:"type"`
+	Title richText `json:"title"`
+}
+
+// searchObject is a page or database in a search response.
+type searchObject struct {
+	Object         string    `json:"object"`
+	ID             string    `json:"id"`
+	URL            string    `json:"url"`
+	CreatedTime    time.Time `json:"created_time"`
+	LastEditedTime time.Time `json:"last_edited_time"`
+	Archived       bool      `json:"archived"`
+	InTrash        bool      `json:"in_trash"`
+	// Properties are decoded by title, as a database's hold its schema
+	// rather than values.
+	Properties map[string]json.RawMessage `json:"properties"`
+	// Title and Description are only set on databases.
+	Title       richText `json:"title"`
+	Description richText `json:"description"`
+}
+
+// title returns the object's title: a database's own title, or the value
+// of a page's title property.
+func (o searchObject) title() string {
+	if o.Object == objectDatabase {
+		return o.Title.String()
+	}
+	for _, raw := range o.Properties {
+		var p property
+		if json.Unmarshal(raw, &p) == nil && p.Type == "title" {
+			return p.Title.String()
+		}
+	}
+	return ""
+}
+
+// Search calls the search endpoint.
+func (c *APIClient) Search(ctx context.Context, req SearchRequest) ([]Page, string, error) {
+	body := map[string]any{"page_size": pageSize(req.PageSize)}
+	if req.Query != "" {
+		body["query"] = req.Query
+	}
+	if req.Object != "" {
+		body["filter"] = map[string]string{"property": "object", "value": req.Object}
+	}
+	if req.Cursor != "" {
+		body["start_cursor"] = req.Cursor
+	}
+	var resp struct {
+		Results    []searchObject `json:"results"`
+		HasMore    bool           `json:"has_more"`
+		NextCursor string         `json:"next_cursor"`
+	}
+	if err := c.do(ctx, "search", body, &resp); err != nil {
+		return nil, "", err
+	}
+
+	pages := make([]Page, len(resp.Results))
+	for i, o := range resp.Results {
+		pages[i] = Page{
+			ID:             o.ID,
+			Object:         o.Object,
+			Title:          o.title(),
+			URL:            o.URL,
+			Description:    o.Description.String(),
+			CreatedTime:    o.CreatedTime,
+			LastEditedTime: o.LastEditedTime,
+			Archived:       o.Archived || o.InTrash,
+		}
+	}
+	var next string
+	if resp.HasMore {
+		next = resp.NextCursor
+	}
+	return pages, next, nil
+}
+
+// PageText reads the first page of a page's top-level blocks. Nested
+// blocks, such as the contents of toggles, are not fetched.
+func (c *APIClient) PageText(ctx context.Context, pageID string) (string, error) {
+	path := "blocks/" + url.PathEscape(pageID) + "/children?page_size=" + strconv.Itoa(maxPageSize)
+	var resp struct {
+		Results []map[string]json.RawMessage `json:"results"`
+	}
+	if err := c.do(ctx, path, nil, &resp); err != nil {
+		return "", err
+	}
+
+	var lines []string
+	for _, b := range resp.Results {
+		if text := blockText(b); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// blockText returns the plain text of a block. A block holds its content
+// under a key named after its type, e.g. {"type": "paragraph",
+// "paragraph": {"rich_text": [...]}}; blocks without text, such as
+// dividers and images, return "".
+func blockText(b map[string]json.RawMessage) string {
+	var typ string
+	if err := json.Unmarshal(b["type"], &typ); err != nil {
+		return ""
+	}
+	var content struct {
+		RichText richText `json:"rich_text"`
+		// Title is set on child_page and child_database blocks.
+		Title string `json:"title"`
+	}
+	if err := json.Unmarshal(b[typ], &content); err != nil {
+		return ""
+	}
+	if text := content.RichText.String(); text != "" {
+		return text
+	}
+	return content.Title
+}
@@ -0,0 +1,201 @@
+package notion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient returns an APIClient whose requests go to handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *APIClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c := NewAPIClient("secret_test", srv.Client())
+	c.baseURL = srv.URL + "/"
+	return c
+}
+
+// searchResponse is a search response with a page in a database whose
+// title property is called "Task", a standalone page, and a database.
+const searchResponse = `{
+  "object": "list",
+  "results": [
+    {
+      "object": "page",
+      "id": "11111111-aaaa",
+      "created_time": "2024-01-10T09:00:00.000Z",
+      "last_edited_time": "2024-03-05T16:30:00.000Z",
+      "archived": false,
+      "url": "https://www.notion.so/Write-onboarding-guide-11111111aaaa",
+      "parent": {"type": "database_id", "database_id": "22222222-bbbb"},
+      "properties": {
+        "Status": {"id": "a1", "type": "select", "select": {"name": "Doing"}},
+        "Task": {"id": "title", "type": "title", "title": [
+          {"type": "text", "plain_text": "Write "},
+          {"type": "text", "plain_text": "onboarding guide"}
+        ]}
+      }
+    },
+    {
+      "object": "page",
+      "id": "33333333-cccc",
+      "created_time": "2024-02-01T00:00:00.000Z",
+      "last_edited_time": "2024-02-02T00:00:00.000Z",
+      "in_trash": true,
+      "url": "https://www.notion.so/Old-33333333cccc",
+      "parent": {"type": "workspace", "workspace": true},
+      "properties": {"title": {"id": "title", "type": "title", "title": [{"plain_text": "Old onboarding"}]}}
+    },
+    {
+      "object": "database",
+      "id": "22222222-bbbb",
+      "created_time": "2023-06-01T00:00:00.000Z",
+      "last_edited_time": "2024-02-01T00:00:00.000Z",
+      "url": "https://www.notion.so/22222222bbbb",
+      "title": [{"plain_text": "Onboarding tasks"}],
+      "description": [{"plain_text": "What new starters do first"}],
+      "properties": {"Task": {"id": "title", "name": "Task", "type": "title", "title": {}}}
+    }
+  ],
+  "next_cursor": "cursor-2",
+  "has_more": true
+}`
+
+func TestSearch_Success(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/search", r.URL.Path)
+		assert.Equal(t, "Bearer secret_test", r.Header.Get("Authorization"))
+		assert.Equal(t, apiVersion, r.Header.Get("Notion-Version"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]any{
+			"query":        "onboarding",
+			"page_size":    float64(10),
+			"filter":       map[string]any{"property": "object", "value": "page"},
+			"start_cursor": "cursor-1",
+		}, body)
+		fmt.Fprint(w, searchResponse)
+	})
+
+	pages, next, err := c.Search(context.Background(), SearchRequest{Query: "onboarding", Object: "page", PageSize: 10, Cursor: "cursor-1"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "cursor-2", next)
+	assert.Equal(t, []Page{
+		{
+			ID:             "11111111-aaaa",
+			Object:         "page",
+			Title:          "Write onboarding guide",
+			URL:            "https://www.notion.so/Write-onboarding-guide-11111111aaaa",
+			CreatedTime:    time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC),
+			LastEditedTime: time.Date(2024, 3, 5, 16, 30, 0, 0, time.UTC),
+		},
+		{
+			ID:             "33333333-cccc",
+			Object:         "page",
+			Title:          "Old onboarding",
+			URL:            "https://www.notion.so/Old-33333333cccc",
+			CreatedTime:    time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			LastEditedTime: time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC),
+			Archived:       true,
+		},
+		{
+			ID:             "22222222-bbbb",
+			Object:         "database",
+			Title:          "Onboarding tasks",
+			URL:            "https://www.notion.so/22222222bbbb",
+			Description:    "What new starters do first",
+			CreatedTime:    time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+			LastEditedTime: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}, pages)
+}
+
+func TestSearch_LastPageAndDefaults(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]any{"page_size": float64(defaultPageSize)}, body)
+		fmt.Fprint(w, `{"object":"list","results":[],"next_cursor":null,"has_more":false}`)
+	})
+
+	pages, next, err := c.Search(context.Background(), SearchRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, pages)
+	assert.Empty(t, next)
+}
+
+func TestSearch_APIError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"object":"error","status":401,"code":"unauthorized","message":"API token is invalid."}`)
+	})
+
+	_, _, err := c.Search(context.Background(), SearchRequest{Query: "x"})
+	assert.EqualError(t, err, "notion search: unauthorized: API token is invalid.")
+}
+
+func TestSearch_HTTPError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	_, _, err := c.Search(context.Background(), SearchRequest{Query: "x"})
+	assert.ErrorContains(t, err, "notion search: unexpected status 502")
+}
+
+func TestSearch_RateLimited(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"object":"error","status":429,"code":"rate_limited","message":"slow down"}`)
+	})
+
+	_, _, err := c.Search(context.Background(), SearchRequest{Query: "x"})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.EqualError(t, err, "notion search: notion rate limit exceeded, retry after 2s")
+}
+
+func TestPageText(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/blocks/11111111-aaaa/children", r.URL.Path)
+		assert.Equal(t, "100", r.URL.Query().Get("page_size"))
+		assert.Equal(t, apiVersion, r.Header.Get("Notion-Version"))
+		fmt.Fprint(w, `{"object":"list","results":[
+			{"object":"block","type":"heading_1","heading_1":{"rich_text":[{"plain_text":"Welcome"}]}},
+			{"object":"block","type":"paragraph","paragraph":{"rich_text":[{"plain_text":"Read the "},{"plain_text":"handbook","href":"https://example.com"}]}},
+			{"object":"block","type":"divider","divider":{}},
+			{"object":"block","type":"to_do","to_do":{"rich_text":[{"plain_text":"Set up laptop"}],"checked":false}},
+			{"object":"block","type":"child_page","child_page":{"title":"FAQ"}},
+			{"object":"block","type":"image","image":{"type":"external","external":{"url":"https://example.com/a.png"}}}
+		],"has_more":false}`)
+	})
+
+	text, err := c.PageText(context.Background(), "11111111-aaaa")
+
+	require.NoError(t, err)
+	assert.Equal(t, "Welcome\nRead the handbook\nSet up laptop\nFAQ", text)
+}
+
+func TestPageText_Error(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"object":"error","status":404,"code":"object_not_found","message":"Could not find block."}`)
+	})
+
+	_, err := c.PageText(context.Background(), "missing")
+	assert.EqualError(t, err, "notion blocks/missing/children: object_not_found: Could not find block.")
+}
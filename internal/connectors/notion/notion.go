@@ -0,0 +1,192 @@
+// Package notion searches the pages and databases shared with a Notion
+// integration, using the Notion API's search endpoint.
+package notion
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+// MIME types of Notion results. type:doc matches pages and type:sheet
+// databases.
+const (
+	mimeTypePage     = "application/vnd.notion.page"
+	mimeTypeDatabase = "application/vnd.notion.database"
+)
+
+// Object types, as Notion names them.
+const (
+	objectPage     = "page"
+	objectDatabase = "database"
+)
+
+// Page is a Notion page or database returned by the search endpoint.
+type Page struct {
+	ID string
+	// Object is "page" or "database".
+	Object string
+	// Title is read from the page's title property, whatever its name in
+	// the parent database's schema.
+	Title string
+	URL   string
+	// Description is a database's description; it is empty for pages.
+	Description    string
+	CreatedTime    time.Time
+	LastEditedTime time.Time
+	Archived       bool
+}
+
+// SearchRequest is one call to the search endpoint.
+type SearchRequest struct {
+	// Query is matched against titles.
+	Query string
+	// Object restricts results to "page" or "database"; empty allows both.
+	Object   string
+	PageSize int
+	Cursor   string
+}
+
+// NotionClient abstracts the Notion API for testability.
+type NotionClient interface {
+	// Search returns one page of pages and databases whose titles match
+	// req.Query, and the cursor for the next page ("" when there are no
+	// more).
+	Search(ctx context.Context, req SearchRequest) ([]Page, string, error)
+	// PageText returns the plain text of a page's top-level blocks, one
+	// block per line.
+	PageText(ctx context.Context, pageID string) (string, error)
+}
+
+// Connector implements connectors.Connector for Notion.
+type Connector struct {
+	client NotionClient
+	name   string
+}
+
+// NewConnector creates a Notion connector with the given client.
+func NewConnector(client NotionClient) *Connector {
+	return &Connector{client: client, name: "notion"}
+}
+
+// WithName sets the name the connector reports and stamps on its results,
+// so several workspaces can be configured side by side. It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the search request Search would send.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	sq, _, ok := buildSearchRequest(parsed)
+	if !ok {
+		return connectors.Explanation{Params: map[string]string{
+			"skipped": "type: filter cannot match a Notion page or database; the API is not called",
+		}}, nil
+	}
+	params := map[string]string{"page_size": strconv.Itoa(pageSize(req.Limit))}
+	if sq.Object != "" {
+		params["filter"] = "object=" + sq.Object
+	}
+	if req.Cursor != "" {
+		params["start_cursor"] = req.Cursor
+	}
+	return connectors.Explanation{Query: sq.Query, Params: params}, nil
+}
+
+// Search finds pages and databases by title. Snippets come from each
+// page's text, around the first query word it mentions. If page text
+// cannot be read the results are returned without snippets and a warning.
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	sq, warnings, ok := buildSearchRequest(parsed)
+	if !ok {
+		return connectors.Page{Results: []connectors.Result{}}, nil
+	}
+	sq.PageSize = pageSize(req.Limit)
+	sq.Cursor = req.Cursor
+
+	pages, next, err := c.client.Search(ctx, sq)
+	if err != nil {
+		return connectors.Page{}, fmt.Errorf("notion search: %w", err)
+	}
+
+	terms := index.Terms(parsed)
+	results := []connectors.Result{}
+	snippets := true
+	for _, p := range pages {
+		if p.Archived || !inDateRange(parsed, p.LastEditedTime) {
+			continue
+		}
+		r := c.toResult(p)
+		text := p.Description
+		if p.Object == objectPage && snippets {
+			// Each page costs a request and Notion allows about three a
+			// second, so stop after the first failure.
+			if text, err = c.client.PageText(ctx, p.ID); err != nil {
+				warnings = append(warnings, fmt.Sprintf("page text unavailable, snippets omitted: %v", err))
+				snippets = false
+			}
+		}
+		r.Snippet = index.Snippet(text, terms)
+		results = append(results, r)
+	}
+	return connectors.Page{Results: results, NextCursor: next, Warnings: warnings}, nil
+}
+
+func (c *Connector) toResult(p Page) connectors.Result {
+	r := connectors.Result{
+		Title:      p.Title,
+		URL:        p.URL,
+		Source:     c.name,
+		ID:         p.ID,
+		CreatedAt:  p.CreatedTime,
+		ModifiedAt: p.LastEditedTime,
+		MimeType:   mimeTypePage,
+		Metadata:   map[string]string{"object": p.Object},
+	}
+	if p.Object == objectDatabase {
+		r.MimeType = mimeTypeDatabase
+	}
+	if r.Title == "" {
+		r.Title = "Untitled"
+	}
+	return r
+}
+
+// inDateRange reports whether a page last edited at t satisfies q's
+// after: and before: clauses. The search endpoint cannot filter by date,
+// so results are filtered here.
+func inDateRange(q query.Query, t time.Time) bool {
+	for _, cl := range q.Clauses {
+		var in bool
+		switch cl.Field {
+		case query.FieldAfter:
+			in = !t.Before(cl.Date())
+		case query.FieldBefore:
+			in = t.Before(cl.Date())
+		default:
+			continue
+		}
+		if in == cl.Negated {
+			return false
+		}
+	}
+	return true
+}
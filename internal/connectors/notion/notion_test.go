@@ -0,0 +1,177 @@
+package notion
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockNotionClient implements NotionClient for testing.
+type MockNotionClient struct {
+	mock.Mock
+}
+
+func (m *MockNotionClient) Search(ctx context.Context, req SearchRequest) ([]Page, string, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).([]Page), args.String(1), args.Error(2)
+}
+
+func (m *MockNotionClient) PageText(ctx context.Context, pageID string) (string, error) {
+	args := m.Called(ctx, pageID)
+	return args.String(0), args.Error(1)
+}
+
+var (
+	onboarding = Page{
+		ID:             "11111111-aaaa",
+		Object:         "page",
+		Title:          "Engineering onboarding",
+		URL:            "https://www.notion.so/Engineering-onboarding-11111111aaaa",
+		CreatedTime:    time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC),
+		LastEditedTime: time.Date(2024, 3, 5, 16, 30, 0, 0, time.UTC),
+	}
+	roadmap = Page{
+		ID:             "22222222-bbbb",
+		Object:         "database",
+		Title:          "Roadmap",
+		URL:            "https://www.notion.so/22222222bbbb",
+		Description:    "Everything the team plans to ship this year",
+		CreatedTime:    time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+		LastEditedTime: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+)
+
+func TestConnector_Name(t *testing.T) {
+	assert.Equal(t, "notion", NewConnector(nil).Name())
+	assert.Equal(t, "team-wiki", NewConnector(nil).WithName("team-wiki").Name())
+}
+
+func TestConnector_Search_ReturnsResults(t *testing.T) {
+	mockClient := new(MockNotionClient)
+	mockClient.On("Search", mock.Anything, SearchRequest{Query: "onboarding", PageSize: 5}).
+		Return([]Page{onboarding, roadmap}, "cursor-2", nil)
+	mockClient.On("PageText", mock.Anything, "11111111-aaaa").
+		Return("Welcome!\nDuring onboarding you will set up your laptop and meet the team.", nil)
+
+	page, err := NewConnector(mockClient).WithName("wiki").Search(context.Background(), connectors.Request{Query: "onboarding", Limit: 5})
+
+	require.NoError(t, err)
+	assert.Equal(t, "cursor-2", page.NextCursor)
+	assert.Empty(t, page.Warnings)
+	require.Len(t, page.Results, 2)
+
+	r := page.Results[0]
+	assert.Equal(t, "Engineering onboarding", r.Title)
+	assert.Contains(t, r.Snippet, "During onboarding you will set up your laptop")
+	assert.Equal(t, onboarding.URL, r.URL)
+	assert.Equal(t, "wiki", r.Source)
+	assert.Equal(t, "11111111-aaaa", r.ID)
+	assert.Equal(t, onboarding.CreatedTime, r.CreatedAt)
+	assert.Equal(t, onboarding.LastEditedTime, r.ModifiedAt)
+	assert.Equal(t, "application/vnd.notion.page", r.MimeType)
+	assert.Equal(t, map[string]string{"object": "page"}, r.Metadata)
+
+	db := page.Results[1]
+	assert.Equal(t, "Roadmap", db.Title)
+	assert.Equal(t, "Everything the team plans to ship this year", db.Snippet)
+	assert.Equal(t, "application/vnd.notion.database", db.MimeType)
+	mockClient.AssertExpectations(t)
+}
+
+func TestConnector_Search_PageTextErrorOmitsSnippets(t *testing.T) {
+	second := onboarding
+	second.ID = "33333333-cccc"
+	mockClient := new(MockNotionClient)
+	mockClient.On("Search", mock.Anything, mock.Anything).Return([]Page{onboarding, second}, "", nil)
+	mockClient.On("PageText", mock.Anything, "11111111-aaaa").Return("", errors.New("notion blocks/11111111-aaaa/children: notion rate limit exceeded, retry after 1s")).Once()
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "onboarding"})
+
+	require.NoError(t, err)
+	require.Len(t, page.Results, 2)
+	assert.Empty(t, page.Results[0].Snippet)
+	assert.Empty(t, page.Results[1].Snippet)
+	assert.Equal(t, []string{"page text unavailable, snippets omitted: notion blocks/11111111-aaaa/children: notion rate limit exceeded, retry after 1s"}, page.Warnings)
+	mockClient.AssertNumberOfCalls(t, "PageText", 1)
+}
+
+func TestConnector_Search_FiltersByLastEdited(t *testing.T) {
+	mockClient := new(MockNotionClient)
+	mockClient.On("Search", mock.Anything, SearchRequest{Query: "plan", PageSize: defaultPageSize}).Return([]Page{onboarding, roadmap}, "", nil)
+	mockClient.On("PageText", mock.Anything, onboarding.ID).Return("", nil)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "plan after:2024-03-01 before:2024-03-06"})
+
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "Engineering onboarding", page.Results[0].Title)
+}
+
+func TestConnector_Search_SkipsArchivedAndUntitled(t *testing.T) {
+	archived := onboarding
+	archived.Archived = true
+	untitled := roadmap
+	untitled.Title = ""
+	mockClient := new(MockNotionClient)
+	mockClient.On("Search", mock.Anything, mock.Anything).Return([]Page{archived, untitled}, "", nil)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: ""})
+
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "Untitled", page.Results[0].Title)
+}
+
+func TestConnector_Search_TypeFilters(t *testing.T) {
+	mockClient := new(MockNotionClient)
+	mockClient.On("Search", mock.Anything, SearchRequest{Query: "roadmap", Object: "database", PageSize: defaultPageSize}).Return([]Page{}, "", nil)
+
+	_, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "type:sheet roadmap"})
+	require.NoError(t, err)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "type:pdf roadmap"})
+	require.NoError(t, err)
+	assert.Empty(t, page.Results)
+	mockClient.AssertNumberOfCalls(t, "Search", 1)
+}
+
+func TestConnector_Search_ReportsUnsupportedOperators(t *testing.T) {
+	mockClient := new(MockNotionClient)
+	mockClient.On("Search", mock.Anything, SearchRequest{Query: "plan Q1", PageSize: defaultPageSize}).Return([]Page{}, "", nil)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "plan title:Q1 -draft from:alice"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-draft is not supported by this source and was ignored",
+		"from:alice is not supported by this source and was ignored",
+	}, page.Warnings)
+}
+
+func TestConnector_Search_Error(t *testing.T) {
+	mockClient := new(MockNotionClient)
+	mockClient.On("Search", mock.Anything, mock.Anything).Return([]Page{}, "", errors.New("notion search: unauthorized: API token is invalid."))
+
+	_, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "x"})
+
+	assert.EqualError(t, err, "notion search: notion search: unauthorized: API token is invalid.")
+}
+
+func TestConnector_Explain(t *testing.T) {
+	c := NewConnector(nil)
+
+	exp, err := c.Explain(connectors.Request{Query: "type:doc onboarding after:2024-01-01", Limit: 500, Cursor: "abc"})
+	require.NoError(t, err)
+	assert.Equal(t, "onboarding", exp.Query)
+	assert.Equal(t, map[string]string{"page_size": "100", "filter": "object=page", "start_cursor": "abc"}, exp.Params)
+
+	exp, err = c.Explain(connectors.Request{Query: "type:video"})
+	require.NoError(t, err)
+	assert.Contains(t, exp.Params["skipped"], "the API is not called")
+}
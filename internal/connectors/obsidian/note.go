@@ -0,0 +1,284 @@
+package obsidian
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// note is a parsed Markdown note.
+type note struct {
+	title   string
+	aliases []string
+	// tags are lower case without the leading #, from the frontmatter and
+	// the text.
+	tags []string
+	// links are the targets of the note's [[wikilinks]], without headings
+	// or aliases.
+	links    []string
+	author   string
+	created  time.Time
+	modified time.Time
+	sections []section
+}
+
+// section is the text under one heading, with wikilinks rendered as their
+// display text.
+type section struct {
+	// heading is the path of headings leading to the section, e.g.
+	// "Plan › Budget"; it is empty before the first heading.
+	heading string
+	text    string
+}
+
+// body returns the note's searchable text.
+func (n note) body() string {
+	parts := slices.Clone(n.aliases)
+	for _, s := range n.sections {
+		if s.heading != "" {
+			parts = append(parts, s.heading)
+		}
+		parts = append(parts, s.text)
+	}
+	for _, t := range n.tags {
+		parts = append(parts, "#"+t)
+	}
+	return strings.Join(parts, "\n")
+}
+
+var (
+	headingRE = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	// Obsidian tags may contain letters, digits, _, - and / for nesting,
+	// but not only digits.
+	tagRE      = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]*[\p{L}_/-][\p{L}\p{N}_/-]*)`)
+	wikilinkRE = regexp.MustCompile(`!?\[\[([^\]|#^]*)([#^][^\]|]*)?(?:\|([^\]]*))?\]\]`)
+)
+
+// parseNote parses a note's source. name is the file name without its
+// extension, used as the title when the note has no other.
+func parseNote(name string, src string) note {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	fm, text := splitFrontmatter(src)
+
+	n := note{
+		title:   first(fm["title"]),
+		aliases: fm["aliases"],
+		author:  first(fm["author"]),
+	}
+	n.aliases = append(n.aliases, fm["alias"]...)
+	n.created = parseDate(first(fm["created"], fm["date"]))
+	n.modified = parseDate(first(fm["modified"], fm["updated"]))
+	for _, v := range append(fm["tags"], fm["tag"]...) {
+		for _, t := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+			n.addTag(t)
+		}
+	}
+
+	var (
+		headings []string // by level - 1
+		cur      section
+		lines    []string
+		fence    string
+	)
+	flush := func() {
+		cur.text = strings.TrimSpace(strings.Join(lines, "\n"))
+		if cur.text != "" || cur.heading != "" {
+			n.sections = append(n.sections, cur)
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			lines = append(lines, line)
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			lines = append(lines, line)
+			continue
+		}
+
+		line = n.renderLinks(line)
+		for _, m := range tagRE.FindAllStringSubmatch(line, -1) {
+			n.addTag(m[1])
+		}
+		if m := headingRE.FindStringSubmatch(line); m != nil {
+			flush()
+			level := len(m[1])
+			headings = append(headings[:min(level-1, len(headings))], m[2])
+			cur = section{heading: strings.Join(headings, " › ")}
+			if level == 1 && n.title == "" {
+				n.title = m[2]
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+
+	if n.title == "" {
+		n.title = name
+	}
+	slices.Sort(n.tags)
+	return n
+}
+
+// renderLinks replaces the wikilinks in line with their display text and
+// records their targets.
+func (n *note) renderLinks(line string) string {
+	return wikilinkRE.ReplaceAllStringFunc(line, func(link string) string {
+		m := wikilinkRE.FindStringSubmatch(link)
+		target := strings.TrimSpace(m[1])
+		if target != "" && !slices.Contains(n.links, target) {
+			n.links = append(n.links, target)
+		}
+		if alias := strings.TrimSpace(m[3]); alias != "" {
+			return alias
+		}
+		if target == "" {
+			// A link to a heading in the same note, like [[#Budget]].
+			return strings.TrimLeft(m[2], "#^")
+		}
+		return target
+	})
+}
+
+func (n *note) addTag(t string) {
+	t = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(t), "#"))
+	if t != "" && !slices.Contains(n.tags, t) {
+		n.tags = append(n.tags, t)
+	}
+}
+
+// hasTag reports whether the note has tag or a tag nested under it, so
+// #project matches #project/alpha.
+func (n note) hasTag(tag string) bool {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	for _, t := range n.tags {
+		if t == tag || strings.HasPrefix(t, tag+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// linksTo reports whether the note links to the note named target.
+func (n note) linksTo(target string) bool {
+	for _, l := range n.links {
+		// A link may include folders: [[Projects/Budget]] links to Budget.
+		if strings.EqualFold(l, target) || strings.EqualFold(l[strings.LastIndex(l, "/")+1:], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitFrontmatter separates a leading YAML frontmatter block from the
+// rest of src.
+func splitFrontmatter(src string) (map[string][]string, string) {
+	if !strings.HasPrefix(src, "---\n") {
+		return nil, src
+	}
+	rest := src[len("---\n"):]
+	var fmLines []string
+	for i := 0; i < len(rest); {
+		end := strings.IndexByte(rest[i:], '\n')
+		if end < 0 {
+			end = len(rest) - i
+		}
+		line := rest[i : i+end]
+		next := min(i+end+1, len(rest))
+		if t := strings.TrimRight(line, " \t"); t == "---" || t == "..." {
+			return parseFrontmatter(fmLines), rest[next:]
+		}
+		fmLines = append(fmLines, line)
+		i = next
+	}
+	// Unterminated: not frontmatter after all.
+	return nil, src
+}
+
+// parseFrontmatter reads the subset of YAML that notes use in practice:
+// "key: value", "key: [a, b]" and "key:" followed by "- item" lines. Keys
+// are lower-cased; nested mappings are ignored.
+func parseFrontmatter(lines []string) map[string][]string {
+	fm := map[string][]string{}
+	var key string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		case strings.HasPrefix(trimmed, "- "):
+			if key != "" {
+				fm[key] = append(fm[key], unquote(trimmed[2:]))
+			}
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			key = ""
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+		switch {
+		case v == "":
+			fm[key] = nil
+		case strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]"):
+			for _, item := range strings.Split(v[1:len(v)-1], ",") {
+				if item = unquote(item); item != "" {
+					fm[key] = append(fm[key], item)
+				}
+			}
+		default:
+			fm[key] = []string{unquote(v)}
+		}
+	}
+	return fm
+}
+
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	return s
+}
+
+// first returns the first value of the first non-empty list.
+func first(lists ...[]string) string {
+	for _, l := range lists {
+		if len(l) > 0 {
+			return l[0]
+		}
+	}
+	return ""
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.DateOnly,
+}
+
+// parseDate parses a frontmatter date, returning the zero time when s is
+// not one.
+func parseDate(s string) time.Time {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
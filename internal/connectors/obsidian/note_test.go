@@ -0,0 +1,70 @@
+package obsidian
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNote_Frontmatter(t *testing.T) {
+	n := parseNote("file-name", `---
+title: "Quarterly budget"
+aliases: [Budget, 'Q1 numbers']
+tags:
+  - finance
+  - "#Planning/2024"
+author: Alice
+created: 2024-01-02
+updated: 2024-02-03T04:05:06Z
+nested:
+  key: ignored
+---
+Body text.
+`)
+	assert.Equal(t, "Quarterly budget", n.title)
+	assert.Equal(t, []string{"Budget", "Q1 numbers"}, n.aliases)
+	assert.Equal(t, []string{"finance", "planning/2024"}, n.tags)
+	assert.Equal(t, "Alice", n.author)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), n.created)
+	assert.Equal(t, time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC), n.modified)
+	require.Len(t, n.sections, 1)
+	assert.Equal(t, "Body text.", n.sections[0].text)
+}
+
+func TestParseNote_TitleFallsBackToHeadingThenFileName(t *testing.T) {
+	assert.Equal(t, "Heading", parseNote("file", "intro\n# Heading\ntext").title)
+	assert.Equal(t, "file", parseNote("file", "## Not a title\ntext").title)
+	assert.Equal(t, "file", parseNote("file", "---\nunterminated: yes\n").title, "unterminated frontmatter is text")
+}
+
+func TestParseNote_Sections(t *testing.T) {
+	n := parseNote("plan", "intro\n# Plan\n## Budget\nnumbers\n### Q1\nmore\n## Hiring\npeople\n")
+	assert.Equal(t, []section{
+		{heading: "", text: "intro"},
+		{heading: "Plan", text: ""},
+		{heading: "Plan › Budget", text: "numbers"},
+		{heading: "Plan › Budget › Q1", text: "more"},
+		{heading: "Plan › Hiring", text: "people"},
+	}, n.sections)
+}
+
+func TestParseNote_TagsAndWikilinks(t *testing.T) {
+	n := parseNote("n", "See [[Projects/Budget|the budget]] and [[Hiring#Plan]], ![[diagram.png]] and [[#Local]].\n"+
+		"Tagged #work and #work/q1, not #123 or a#b.\n"+
+		"```\n#not-a-tag [[Not a link]]\n# not a heading\n```\n")
+
+	assert.Equal(t, []string{"work", "work/q1"}, n.tags)
+	assert.Equal(t, []string{"Projects/Budget", "Hiring", "diagram.png"}, n.links)
+	require.Len(t, n.sections, 1)
+	assert.Contains(t, n.sections[0].text, "See the budget and Hiring, diagram.png and Local.")
+	assert.Contains(t, n.sections[0].text, "[[Not a link]]", "code blocks are left alone")
+
+	assert.True(t, n.hasTag("work"))
+	assert.True(t, n.hasTag("#Work/Q1"))
+	assert.False(t, n.hasTag("wor"))
+	assert.True(t, n.linksTo("budget"))
+	assert.True(t, n.linksTo("Projects/Budget"))
+	assert.False(t, n.linksTo("Projects"))
+}
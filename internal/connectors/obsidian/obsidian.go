@@ -0,0 +1,452 @@
+// Package obsidian searches an Obsidian vault, or any directory of Markdown
+// notes, on the local filesystem. Notes are indexed in memory and the
+// index is brought up to date before each search by re-reading only the
+// files that changed, so results are never behind the vault. Attachments
+// such as PDFs and Word documents can be indexed too, by their extracted
+// text.
+package obsidian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/extract"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+const (
+	defaultLimit = 20
+	mimeType     = "text/markdown"
+)
+
+// Connector implements connectors.Connector for a vault directory.
+//
+// Besides the pkb query language, it understands two vault-specific
+// operators, written as free text: tag:project (or #project), which
+// matches notes tagged project or a tag nested under it, and link:Budget,
+// which matches notes with a [[Budget]] wikilink.
+type Connector struct {
+	root      string
+	vault     string
+	fileURLs  bool
+	name      string
+	extractor *extract.Extractor
+
+	// mu serializes scans and guards files.
+	mu    sync.Mutex
+	index *index.Index
+	files map[string]*file
+}
+
+// file is an indexed note or attachment and the file version it was read
+// from.
+type file struct {
+	modTime time.Time
+	size    int64
+	note    note
+	// mimeType and metadata are an attachment's, whose extracted text is
+	// its note's only section.
+	mimeType string
+	metadata map[string]string
+	// err is why an attachment could not be extracted. It is kept, and
+	// reported on each scan, so the file is not read again until it
+	// changes.
+	err error
+}
+
+// NewConnector creates a connector for the vault at root. Results link to
+// the note in Obsidian, in the vault named after root's base name.
+func NewConnector(root string) *Connector {
+	return &Connector{
+		root:  root,
+		vault: filepath.Base(root),
+		name:  "obsidian",
+		index: index.New(),
+		files: map[string]*file{},
+	}
+}
+
+// WithName sets the name the connector reports and stamps on its results.
+// It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+// WithVault sets the vault name used in obsidian:// URLs, for vaults whose
+// name in Obsidian differs from their directory name. It returns c.
+func (c *Connector) WithVault(vault string) *Connector {
+	c.vault = vault
+	return c
+}
+
+// WithFileURLs makes results link to the file with a file:// URL instead
+// of opening it in Obsidian, for Markdown folders that are not vaults. It
+// returns c.
+func (c *Connector) WithFileURLs() *Connector {
+	c.fileURLs = true
+	return c
+}
+
+// WithAttachments indexes the vault's other files that x can extract,
+// such as PDFs, Word documents and saved web pages, besides its notes.
+// They are searched by their text, title and author, and have no tags or
+// links. It returns c.
+func (c *Connector) WithAttachments(x *extract.Extractor) *Connector {
+	c.extractor = x
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the stemmed terms searched for and the vault-specific
+// filters.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	rest, f := splitFilters(parsed)
+	params := map[string]string{"path": c.root}
+	if len(f.tags) > 0 {
+		params["tags"] = strings.Join(f.tags, ",")
+	}
+	if len(f.links) > 0 {
+		params["links"] = strings.Join(f.links, ",")
+	}
+	return connectors.Explanation{Query: strings.Join(index.Terms(rest), " "), Params: params}, nil
+}
+
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	offset := 0
+	if req.Cursor != "" {
+		if offset, err = strconv.Atoi(req.Cursor); err != nil || offset < 0 {
+			return connectors.Page{}, fmt.Errorf("invalid obsidian cursor %q", req.Cursor)
+		}
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	warnings, err := c.scan(ctx)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+
+	rest, f := splitFilters(parsed)
+	terms := index.Terms(rest)
+	var hits []index.Hit
+	for _, h := range c.index.Search(rest) {
+		if f.match(c.files[h.Doc.ID].note) {
+			hits = append(hits, h)
+		}
+	}
+
+	end := min(offset+limit, len(hits))
+	results := []connectors.Result{}
+	for _, h := range hits[min(offset, end):end] {
+		r := h.Doc.Result
+		heading, text := bestSection(c.files[r.ID].note, terms)
+		r.Snippet = index.Snippet(text, terms)
+		if heading != "" {
+			r.Snippet = heading + ": " + r.Snippet
+			r.Metadata = maps.Clone(r.Metadata)
+			r.Metadata["heading"] = heading
+		}
+		results = append(results, r)
+	}
+
+	var next string
+	if end < len(hits) {
+		next = strconv.Itoa(end)
+	}
+	return connectors.Page{Results: results, NextCursor: next, Warnings: warnings}, nil
+}
+
+// scan brings the index up to date with the vault: new and modified notes
+// are (re)indexed and deleted ones removed. Notes that cannot be read are
+// skipped and reported as warnings. The caller must hold mu.
+func (c *Connector) scan(ctx context.Context) ([]string, error) {
+	seen := map[string]bool{}
+	var warnings []string
+	err := filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == c.root {
+				return err
+			}
+			warnings = append(warnings, fmt.Sprintf("skipped %s: %v", path, err))
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		// Skip .obsidian, .trash, .git and other hidden entries.
+		if path != c.root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !isMarkdown(d.Name()) && !c.isAttachment(d.Name()) {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(c.root, path)
+		id := filepath.ToSlash(rel)
+		info, err := d.Info()
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("skipped %s: %v", id, err))
+			return nil
+		}
+		seen[id] = true
+		if f, ok := c.files[id]; ok && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+			if f.err != nil {
+				warnings = append(warnings, fmt.Sprintf("skipped %s: %v", id, f.err))
+			}
+			return nil
+		}
+		if !isMarkdown(d.Name()) {
+			f := c.readAttachment(path, info)
+			c.files[id] = f
+			if f.err != nil {
+				warnings = append(warnings, fmt.Sprintf("skipped %s: %v", id, f.err))
+				c.index.Delete(c.name, id)
+				return nil
+			}
+			c.index.Put(c.document(id, f))
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("skipped %s: %v", id, err))
+			delete(seen, id)
+			return nil
+		}
+		f := &file{modTime: info.ModTime(), size: info.Size()}
+		f.note = parseNote(strings.TrimSuffix(d.Name(), filepath.Ext(d.Name())), string(src))
+		c.files[id] = f
+		c.index.Put(c.document(id, f))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan vault %s: %w", c.root, err)
+	}
+
+	for id := range c.files {
+		if !seen[id] {
+			delete(c.files, id)
+			c.index.Delete(c.name, id)
+		}
+	}
+	return warnings, nil
+}
+
+// isAttachment reports whether a file other than a note is indexed, from
+// its name.
+func (c *Connector) isAttachment(name string) bool {
+	return c.extractor != nil && c.extractor.Supports(extract.TypeByName(name))
+}
+
+// readAttachment extracts an attachment's text into a note of a single
+// section, titled as the document titles itself or else by its file name.
+func (c *Connector) readAttachment(path string, info fs.FileInfo) *file {
+	f := &file{modTime: info.ModTime(), size: info.Size()}
+	doc, err := c.extractor.File(path)
+	if err != nil {
+		// The warning names the file already.
+		var fileErr *extract.FileError
+		if errors.As(err, &fileErr) {
+			err = fileErr.Err
+		}
+		f.err = err
+		return f
+	}
+	f.mimeType = doc.MimeType
+	f.metadata = doc.Metadata
+	f.note = note{
+		title:    doc.Title,
+		author:   doc.Author,
+		created:  doc.Created,
+		modified: doc.Modified,
+		sections: []section{{text: doc.Text}},
+	}
+	if f.note.title == "" {
+		f.note.title = info.Name()
+	}
+	return f
+}
+
+// document converts an indexed note or attachment to the form stored in
+// the index.
+func (c *Connector) document(id string, f *file) connectors.Document {
+	n := f.note
+	r := connectors.Result{
+		Title:      n.title,
+		URL:        c.noteURL(id),
+		Source:     c.name,
+		ID:         id,
+		CreatedAt:  n.created,
+		ModifiedAt: n.modified,
+		Author:     n.author,
+		MimeType:   mimeType,
+		Metadata:   map[string]string{"path": id},
+	}
+	if f.mimeType != "" {
+		r.MimeType = f.mimeType
+		for k, v := range f.metadata {
+			if k != "path" {
+				r.Metadata[k] = v
+			}
+		}
+	}
+	if r.ModifiedAt.IsZero() {
+		r.ModifiedAt = f.modTime
+	}
+	if len(n.tags) > 0 {
+		r.Metadata["tags"] = strings.Join(n.tags, ",")
+	}
+	if len(n.links) > 0 {
+		r.Metadata["links"] = strings.Join(n.links, ",")
+	}
+	return connectors.Document{Result: r, Body: n.body()}
+}
+
+// noteURL returns the link for the note with the given vault-relative
+// path.
+func (c *Connector) noteURL(id string) string {
+	if c.fileURLs {
+		abs, err := filepath.Abs(filepath.Join(c.root, filepath.FromSlash(id)))
+		if err != nil {
+			abs = filepath.Join(c.root, filepath.FromSlash(id))
+		}
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+	}
+	// Obsidian decodes its parameters like encodeURIComponent, which
+	// escapes spaces as %20 rather than +. It opens notes by their name
+	// without the extension and other files by their full name.
+	file := id
+	if isMarkdown(id) {
+		file = strings.TrimSuffix(id, filepath.Ext(id))
+	}
+	return "obsidian://open?vault=" + escape(c.vault) + "&file=" + escape(file)
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func isMarkdown(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// filters are the vault-specific operators of a query.
+type filters struct {
+	tags     []string
+	links    []string
+	negTags  []string
+	negLinks []string
+}
+
+// splitFilters removes the tag:, #tag and link: words from q's free text
+// and returns them separately.
+func splitFilters(q query.Query) (query.Query, filters) {
+	var rest query.Query
+	var f filters
+	for _, cl := range q.Clauses {
+		if cl.Field != query.FieldText || cl.Phrase {
+			rest.Clauses = append(rest.Clauses, cl)
+			continue
+		}
+		var tag, link string
+		switch {
+		case strings.HasPrefix(cl.Value, "tag:"):
+			tag = strings.TrimPrefix(cl.Value, "tag:")
+		case strings.HasPrefix(cl.Value, "#") && len(cl.Value) > 1:
+			tag = cl.Value[1:]
+		case strings.HasPrefix(cl.Value, "link:"):
+			link = strings.TrimPrefix(cl.Value, "link:")
+		}
+		switch {
+		case tag != "" && cl.Negated:
+			f.negTags = append(f.negTags, tag)
+		case tag != "":
+			f.tags = append(f.tags, tag)
+		case link != "" && cl.Negated:
+			f.negLinks = append(f.negLinks, link)
+		case link != "":
+			f.links = append(f.links, link)
+		default:
+			rest.Clauses = append(rest.Clauses, cl)
+		}
+	}
+	return rest, f
+}
+
+// match reports whether n satisfies every filter.
+func (f filters) match(n note) bool {
+	for _, t := range f.tags {
+		if !n.hasTag(t) {
+			return false
+		}
+	}
+	for _, t := range f.negTags {
+		if n.hasTag(t) {
+			return false
+		}
+	}
+	for _, l := range f.links {
+		if !n.linksTo(l) {
+			return false
+		}
+	}
+	for _, l := range f.negLinks {
+		if n.linksTo(l) {
+			return false
+		}
+	}
+	return true
+}
+
+// bestSection returns the heading and text of the first section that
+// mentions one of terms, or of the first section when none does.
+func bestSection(n note, terms []string) (heading, text string) {
+	for _, s := range n.sections {
+		if index.FirstMatch(s.text, terms) >= 0 {
+			return s.heading, s.text
+		}
+	}
+	for _, s := range n.sections {
+		if index.FirstMatch(s.heading, terms) >= 0 {
+			return s.heading, s.text
+		}
+	}
+	if len(n.sections) > 0 {
+		return n.sections[0].heading, n.sections[0].text
+	}
+	return "", ""
+}
@@ -0,0 +1,180 @@
+package obsidian
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/extract"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeNote writes a note into the vault at root, creating folders.
+func writeNote(t *testing.T, root, rel, src string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(src), 0o644))
+}
+
+func newTestVault(t *testing.T) string {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "My Vault")
+	writeNote(t, root, "Projects/Budget plan.md", "---\ntags: [finance]\nauthor: Alice\n---\n"+
+		"# Budget plan\nOverview of the year.\n## Q1\nHire two engineers. See [[Hiring]].\n")
+	writeNote(t, root, "Hiring.md", "# Hiring\nInterview loop for engineers. #work/recruiting\n")
+	writeNote(t, root, "Daily/2024-01-02.md", "Met with Bob about [[Budget plan|the budget]].\n")
+	writeNote(t, root, ".obsidian/workspace.md", "engineers")
+	writeNote(t, root, "image.png", "engineers")
+	return root
+}
+
+func search(t *testing.T, c *Connector, q string) connectors.Page {
+	t.Helper()
+	page, err := c.Search(context.Background(), connectors.Request{Query: q})
+	require.NoError(t, err)
+	return page
+}
+
+func ids(page connectors.Page) []string {
+	var ids []string
+	for _, r := range page.Results {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestConnector_Name(t *testing.T) {
+	assert.Equal(t, "obsidian", NewConnector("vault").Name())
+	assert.Equal(t, "notes", NewConnector("vault").WithName("notes").Name())
+}
+
+func TestConnector_Search(t *testing.T) {
+	root := newTestVault(t)
+	c := NewConnector(root)
+
+	page := search(t, c, "engineers")
+	assert.ElementsMatch(t, []string{"Projects/Budget plan.md", "Hiring.md"}, ids(page), "hidden folders and other files are skipped")
+
+	page = search(t, c, "two engineers")
+	require.Len(t, page.Results, 1)
+	r := page.Results[0]
+	assert.Equal(t, "Budget plan", r.Title)
+	assert.Equal(t, "obsidian", r.Source)
+	assert.Equal(t, "Budget plan › Q1: Hire two engineers. See Hiring.", r.Snippet, "snippets name their heading")
+	assert.Equal(t, "obsidian://open?vault=My%20Vault&file=Projects%2FBudget%20plan", r.URL)
+	assert.Equal(t, "Alice", r.Author)
+	assert.Equal(t, "text/markdown", r.MimeType)
+	assert.False(t, r.ModifiedAt.IsZero(), "falls back to the file's modification time")
+	assert.Equal(t, map[string]string{"path": "Projects/Budget plan.md", "tags": "finance", "links": "Hiring", "heading": "Budget plan › Q1"}, r.Metadata)
+}
+
+func TestConnector_Search_QueryOperators(t *testing.T) {
+	c := NewConnector(newTestVault(t))
+
+	assert.Equal(t, []string{"Projects/Budget plan.md"}, ids(search(t, c, "from:alice")))
+	assert.Equal(t, []string{"Hiring.md"}, ids(search(t, c, "title:hiring")))
+	assert.Equal(t, []string{"Hiring.md"}, ids(search(t, c, "engineers -finance")))
+	assert.Equal(t, []string{"Daily/2024-01-02.md"}, ids(search(t, c, `"met with bob"`)))
+	assert.Len(t, search(t, c, "type:text").Results, 3)
+	assert.Empty(t, search(t, c, "type:pdf").Results)
+}
+
+func TestConnector_Search_TagsAndLinks(t *testing.T) {
+	c := NewConnector(newTestVault(t))
+
+	assert.Equal(t, []string{"Projects/Budget plan.md"}, ids(search(t, c, "tag:finance")))
+	assert.Equal(t, []string{"Hiring.md"}, ids(search(t, c, "#work")), "nested tags match their parent")
+	assert.Equal(t, []string{"Hiring.md"}, ids(search(t, c, "engineers -tag:finance")))
+	assert.Equal(t, []string{"Projects/Budget plan.md"}, ids(search(t, c, "link:hiring")))
+	assert.Empty(t, ids(search(t, c, "link:hiring interview")), "free text still applies")
+	assert.Equal(t, []string{"Daily/2024-01-02.md"}, ids(search(t, c, "budget -link:hiring")))
+}
+
+func TestConnector_Search_SeesVaultChanges(t *testing.T) {
+	root := newTestVault(t)
+	c := NewConnector(root)
+	require.Len(t, search(t, c, "engineers").Results, 2)
+
+	writeNote(t, root, "New.md", "More engineers needed.")
+	hiring := filepath.Join(root, "Hiring.md")
+	require.NoError(t, os.WriteFile(hiring, []byte("# Hiring\nOn hold."), 0o644))
+	// Make the change visible even on filesystems with coarse timestamps.
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(hiring, later, later))
+	require.NoError(t, os.Remove(filepath.Join(root, "Projects", "Budget plan.md")))
+
+	assert.Equal(t, []string{"New.md"}, ids(search(t, c, "engineers")))
+	assert.Equal(t, []string{"Hiring.md"}, ids(search(t, c, "hold")))
+}
+
+func TestConnector_Search_Pages(t *testing.T) {
+	c := NewConnector(newTestVault(t))
+
+	first, err := c.Search(context.Background(), connectors.Request{Query: "engineers", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, first.Results, 1)
+	require.Equal(t, "1", first.NextCursor)
+
+	second, err := c.Search(context.Background(), connectors.Request{Query: "engineers", Limit: 1, Cursor: first.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, second.Results, 1)
+	assert.Empty(t, second.NextCursor)
+	assert.NotEqual(t, first.Results[0].ID, second.Results[0].ID)
+
+	_, err = c.Search(context.Background(), connectors.Request{Query: "engineers", Cursor: "x"})
+	assert.ErrorContains(t, err, "invalid obsidian cursor")
+}
+
+func TestConnector_Search_FileURLs(t *testing.T) {
+	root := newTestVault(t)
+	page := search(t, NewConnector(root).WithFileURLs(), "interview")
+	require.Len(t, page.Results, 1)
+	assert.True(t, strings.HasPrefix(page.Results[0].URL, "file:///"), page.Results[0].URL)
+	assert.True(t, strings.HasSuffix(page.Results[0].URL, "/My%20Vault/Hiring.md"), page.Results[0].URL)
+
+	page = search(t, NewConnector(root).WithVault("Work"), "interview")
+	assert.Equal(t, "obsidian://open?vault=Work&file=Hiring", page.Results[0].URL)
+}
+
+func TestConnector_Search_Attachments(t *testing.T) {
+	root := newTestVault(t)
+	writeNote(t, root, "Clippings/offsite.html", `<html><head><title>Engineering offsite</title>
+<meta name="description" content="Agenda"></head><body><p>Agenda for the engineers offsite.</p></body></html>`)
+	writeNote(t, root, "Scans/receipt.pdf", "%PDF-1.4\n")
+	c := NewConnector(root).WithAttachments(extract.New())
+
+	page := search(t, c, "engineers")
+	assert.ElementsMatch(t, []string{"Projects/Budget plan.md", "Hiring.md", "Clippings/offsite.html"}, ids(page))
+	assert.Equal(t, []string{"skipped Scans/receipt.pdf: not a PDF file: no objects"}, page.Warnings)
+
+	page = search(t, c, "offsite")
+	require.Len(t, page.Results, 1)
+	r := page.Results[0]
+	assert.Equal(t, "Engineering offsite", r.Title)
+	assert.Equal(t, "text/html", r.MimeType)
+	assert.Equal(t, "Agenda for the engineers offsite.", r.Snippet)
+	assert.Equal(t, "obsidian://open?vault=My%20Vault&file=Clippings%2Foffsite.html", r.URL, "attachments open by their full name")
+	assert.Equal(t, map[string]string{"path": "Clippings/offsite.html", "description": "Agenda"}, r.Metadata)
+	assert.Equal(t, []string{"skipped Scans/receipt.pdf: not a PDF file: no objects"}, page.Warnings, "failures are reported until the file changes")
+
+	assert.Empty(t, search(t, c, "tag:finance offsite").Results, "attachments have no tags")
+	assert.Empty(t, search(t, NewConnector(root), "offsite").Results, "attachments are only indexed when asked")
+}
+
+func TestConnector_Search_MissingVault(t *testing.T) {
+	_, err := NewConnector(filepath.Join(t.TempDir(), "missing")).Search(context.Background(), connectors.Request{Query: "x"})
+	assert.ErrorContains(t, err, "scan vault")
+}
+
+func TestConnector_Explain(t *testing.T) {
+	exp, err := NewConnector("/vault").Explain(connectors.Request{Query: "planning tag:work link:Hiring"})
+	require.NoError(t, err)
+	assert.Equal(t, "plan", exp.Query)
+	assert.Equal(t, map[string]string{"path": "/vault", "tags": "work", "links": "Hiring"}, exp.Params)
+}
@@ -0,0 +1,415 @@
+// Package plugin runs connectors written as separate programs, in any
+// language. pkb starts the program and exchanges JSON messages with it, one
+// per line, over its standard input and output, as documented in
+// docs/plugin-protocol.md. The program keeps running between searches; if
+// it exits, or is stopped because a request timed out, searches in flight
+// fail and the next one starts it again.
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+)
+
+// DefaultTimeout bounds each search and the handshake unless WithTimeout
+// sets another limit.
+const DefaultTimeout = 10 * time.Second
+
+// maxLine bounds the length of a message from a plugin.
+const maxLine = 16 << 20
+
+// Connector implements connectors.Connector by running a plugin program.
+type Connector struct {
+	command string
+	args    []string
+	name    string
+	timeout time.Duration
+
+	nextID atomic.Int64
+	// mu guards proc, the running plugin, if any, and starting, the
+	// plugin being started, if any.
+	mu       sync.Mutex
+	proc     *process
+	starting *startup
+}
+
+// startup is the outcome of starting a plugin, shared by the requests
+// that wait for it. done is closed once p or err is set.
+type startup struct {
+	done chan struct{}
+	p    *process
+	err  error
+}
+
+// NewConnector creates a connector that runs command with args. The
+// program is started on first use.
+func NewConnector(command string, args ...string) *Connector {
+	return &Connector{command: command, args: args, name: "plugin", timeout: DefaultTimeout}
+}
+
+// WithName sets the name the connector reports and stamps on its results.
+// It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+// WithTimeout sets how long a search, or starting the plugin, may take.
+// It returns c.
+func (c *Connector) WithTimeout(d time.Duration) *Connector {
+	c.timeout = d
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// SearchTimeout implements connectors.TimeLimited, so that the search
+// engine gives up on a plugin that hangs.
+func (c *Connector) SearchTimeout() time.Duration {
+	return c.timeout
+}
+
+// Explain reports the plugin's own explanation when it has the explain
+// capability, and which program runs the search.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	p, err := c.process(ctx)
+	if err != nil {
+		return connectors.Explanation{}, fmt.Errorf("plugin explain: %w", err)
+	}
+	params := map[string]string{"command": c.command, "plugin": p.hello.Name}
+	if !slices.Contains(p.hello.Capabilities, capExplain) {
+		return connectors.Explanation{Params: params}, nil
+	}
+	reply, err := c.call(ctx, p, message{Type: typeExplain, Query: req.Query, Limit: req.Limit, Cursor: req.Cursor}, typeExplanation)
+	if err != nil {
+		return connectors.Explanation{}, fmt.Errorf("plugin explain: %w", err)
+	}
+	for k, v := range reply.Params {
+		params[k] = v
+	}
+	return connectors.Explanation{Query: reply.Query, Params: params}, nil
+}
+
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	p, err := c.process(ctx)
+	if err != nil {
+		return connectors.Page{}, fmt.Errorf("plugin search: %w", err)
+	}
+	reply, err := c.call(ctx, p, message{Type: typeSearch, Query: req.Query, Limit: req.Limit, Cursor: req.Cursor}, typeResults)
+	if err != nil {
+		return connectors.Page{}, fmt.Errorf("plugin search: %w", err)
+	}
+	results := make([]connectors.Result, 0, len(reply.Results))
+	for _, r := range reply.Results {
+		results = append(results, r.toResult(c.name))
+	}
+	return connectors.Page{Results: results, NextCursor: reply.NextCursor, Warnings: reply.Warnings}, nil
+}
+
+// Close stops the plugin, if it is running. A later search starts it
+// again.
+func (c *Connector) Close() error {
+	c.mu.Lock()
+	p := c.proc
+	c.proc = nil
+	c.mu.Unlock()
+	if p == nil {
+		return nil
+	}
+	p.stop()
+	return nil
+}
+
+// call sends a request to p and waits for its reply, which must be of type
+// want. When ctx is cancelled first, the plugin is told to cancel the
+// request. When ctx times out, the plugin is stopped instead, since one
+// that has stopped replying would make every later request time out too.
+func (c *Connector) call(ctx context.Context, p *process, req message, want string) (message, error) {
+	req.ID = c.nextID.Add(1)
+	ch, err := p.register(req.ID)
+	if err != nil {
+		return message{}, err
+	}
+	if err := p.send(req); err != nil {
+		p.unregister(req.ID)
+		return message{}, err
+	}
+	select {
+	case reply := <-ch:
+		switch reply.Type {
+		case want:
+			return reply, nil
+		case typeError:
+			return message{}, errors.New(reply.Message)
+		default:
+			return message{}, fmt.Errorf("plugin replied with a %q message, want %q", reply.Type, want)
+		}
+	case <-p.done:
+		return message{}, p.err
+	case <-ctx.Done():
+		p.unregister(req.ID)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			c.retire(p)
+		} else {
+			_ = p.send(message{Type: typeCancel, ID: req.ID})
+		}
+		return message{}, ctx.Err()
+	}
+}
+
+// retire stops p in the background, so that the next request starts the
+// plugin again.
+func (c *Connector) retire(p *process) {
+	c.mu.Lock()
+	if c.proc == p {
+		c.proc = nil
+	}
+	c.mu.Unlock()
+	go p.stop()
+}
+
+// process returns the running plugin, starting it if it is not running.
+// Requests that arrive while it starts wait for the same start.
+func (c *Connector) process(ctx context.Context) (*process, error) {
+	c.mu.Lock()
+	if c.proc != nil {
+		select {
+		case <-c.proc.done:
+			c.proc = nil
+		default:
+			p := c.proc
+			c.mu.Unlock()
+			return p, nil
+		}
+	}
+	if s := c.starting; s != nil {
+		c.mu.Unlock()
+		select {
+		case <-s.done:
+			return s.p, s.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	s := &startup{done: make(chan struct{})}
+	c.starting = s
+	c.mu.Unlock()
+
+	s.p, s.err = start(ctx, c.timeout, c.command, c.args)
+
+	c.mu.Lock()
+	c.starting = nil
+	c.proc = s.p
+	c.mu.Unlock()
+	close(s.done)
+	return s.p, s.err
+}
+
+// process is a running plugin.
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *tail
+	// hello is the plugin's handshake.
+	hello message
+
+	// wmu serializes writes to stdin.
+	wmu sync.Mutex
+
+	mu sync.Mutex
+	// pending maps the IDs of requests awaiting a reply to where the reply
+	// is delivered.
+	pending map[int64]chan message
+	// done is closed once the plugin has exited, after err is set.
+	done chan struct{}
+	err  error
+}
+
+// start starts a plugin and completes the handshake, waiting at most
+// timeout for the plugin's hello.
+func start(ctx context.Context, timeout time.Duration, command string, args []string) (*process, error) {
+	cmd := exec.Command(command, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("start %s: %w", command, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("start %s: %w", command, err)
+	}
+	p := &process{cmd: cmd, stdin: stdin, stderr: &tail{}, pending: map[int64]chan message{}, done: make(chan struct{})}
+	cmd.Stderr = p.stderr
+	// Don't wait forever for output from programs the plugin left running.
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", command, err)
+	}
+	go p.read(stdout)
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	hello, err := p.handshake(ctx)
+	if err != nil {
+		p.stop()
+		return nil, fmt.Errorf("%s: handshake: %w", command, err)
+	}
+	p.hello = hello
+	return p, nil
+}
+
+// handshake exchanges hello messages with the plugin.
+func (p *process) handshake(ctx context.Context) (message, error) {
+	ch, err := p.register(0)
+	if err != nil {
+		return message{}, err
+	}
+	if err := p.send(message{Type: typeHello, Protocol: protocolVersion}); err != nil {
+		return message{}, err
+	}
+	var hello message
+	select {
+	case hello = <-ch:
+	case <-p.done:
+		return message{}, p.err
+	case <-ctx.Done():
+		return message{}, fmt.Errorf("no hello from the plugin: %w", ctx.Err())
+	}
+	switch {
+	case hello.Type == typeError:
+		return message{}, errors.New(hello.Message)
+	case hello.Type != typeHello:
+		return message{}, fmt.Errorf("plugin sent a %q message, want %q", hello.Type, typeHello)
+	case hello.Protocol != protocolVersion:
+		return message{}, fmt.Errorf("plugin speaks protocol version %d, want %d", hello.Protocol, protocolVersion)
+	case !slices.Contains(hello.Capabilities, capSearch):
+		return message{}, fmt.Errorf("plugin %s does not have the %q capability", hello.Name, capSearch)
+	}
+	return hello, nil
+}
+
+// register returns the channel the reply to request id will be delivered
+// on, or the plugin's exit error when it is no longer running.
+func (p *process) register(id int64) (chan message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.done:
+		return nil, p.err
+	default:
+	}
+	ch := make(chan message, 1)
+	p.pending[id] = ch
+	return ch, nil
+}
+
+func (p *process) unregister(id int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending, id)
+}
+
+// send writes m to the plugin as one line.
+func (p *process) send(m message) error {
+	line, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+	if _, err := p.stdin.Write(append(line, '\n')); err != nil {
+		// The plugin exited or closed its input; report why if it's known.
+		select {
+		case <-p.done:
+			return p.err
+		default:
+			return fmt.Errorf("write to plugin: %w", err)
+		}
+	}
+	return nil
+}
+
+// read delivers each message from the plugin to the request awaiting it
+// until the plugin exits. Replies to requests no longer awaited, such as
+// cancelled ones, are dropped. A line that is not a message is a protocol
+// violation, and the plugin is killed.
+func (p *process) read(stdout io.Reader) {
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLine)
+	var protoErr error
+	for sc.Scan() {
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		var m message
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			protoErr = fmt.Errorf("plugin sent an invalid message: %w", err)
+			break
+		}
+		if m.Type == typeHello {
+			m.ID = 0
+		}
+		p.mu.Lock()
+		ch, ok := p.pending[m.ID]
+		delete(p.pending, m.ID)
+		p.mu.Unlock()
+		if ok {
+			ch <- m
+		}
+	}
+	if protoErr == nil && sc.Err() != nil {
+		protoErr = fmt.Errorf("read from plugin: %w", sc.Err())
+	}
+	if protoErr != nil {
+		_ = p.cmd.Process.Kill()
+		// Drain the output so Wait can return.
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+	waitErr := p.cmd.Wait()
+
+	err := protoErr
+	if err == nil {
+		err = errors.New("plugin exited")
+		if waitErr != nil {
+			err = fmt.Errorf("plugin exited: %w", waitErr)
+		}
+		if stderr := p.stderr.String(); stderr != "" {
+			err = fmt.Errorf("%w: %s", err, stderr)
+		}
+	}
+	p.mu.Lock()
+	p.err = err
+	p.pending = map[int64]chan message{}
+	close(p.done)
+	p.mu.Unlock()
+}
+
+// stop closes the plugin's input, which asks it to exit, and kills it if
+// it has not exited shortly after.
+func (p *process) stop() {
+	_ = p.stdin.Close()
+	select {
+	case <-p.done:
+	case <-time.After(time.Second):
+		_ = p.cmd.Process.Kill()
+		<-p.done
+	}
+}
@@ -0,0 +1,260 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The test binary doubles as the plugin: run with PKB_TEST_PLUGIN set, it
+// behaves as the plugin named by the variable instead of running tests.
+func TestMain(m *testing.M) {
+	if mode := os.Getenv("PKB_TEST_PLUGIN"); mode != "" {
+		os.Exit(runTestPlugin(mode))
+	}
+	os.Exit(m.Run())
+}
+
+// runTestPlugin is a plugin for the tests. In "ok" mode it answers
+// searches by query:
+//
+//   - "slow" never gets a reply, until cancelled;
+//   - "cancelled" lists the IDs of the cancelled requests;
+//   - "fail" gets an error;
+//   - "crash" makes the plugin exit with status 3;
+//   - "pid" reports the plugin's process ID;
+//   - anything else gets two results, and a cursor to a second page.
+//
+// The other modes break the handshake.
+func runTestPlugin(mode string) int {
+	in := bufio.NewScanner(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	if !in.Scan() {
+		return 1
+	}
+	switch mode {
+	case "not-json":
+		fmt.Println("Usage: plugin [options]")
+	case "old":
+		_ = enc.Encode(message{Type: typeHello, Protocol: 0, Name: "old", Capabilities: []string{capSearch}})
+	case "refuse":
+		_ = enc.Encode(message{Type: typeError, Message: "missing API token"})
+	case "silent":
+	case "ok":
+		_ = enc.Encode(message{Type: typeHello, Protocol: protocolVersion, Name: "test", Capabilities: []string{capSearch, capExplain}})
+	}
+	if mode != "ok" {
+		for in.Scan() {
+		}
+		return 0
+	}
+
+	var cancelled []result
+	for in.Scan() {
+		var req message
+		if err := json.Unmarshal(in.Bytes(), &req); err != nil {
+			fmt.Fprintln(os.Stderr, "bad request:", err)
+			return 2
+		}
+		switch req.Type {
+		case typeCancel:
+			cancelled = append(cancelled, result{Title: strconv.FormatInt(req.ID, 10)})
+		case typeExplain:
+			_ = enc.Encode(message{Type: typeExplanation, ID: req.ID, Query: "native " + req.Query, Params: map[string]string{"index": "main"}})
+		case typeSearch:
+			switch req.Query {
+			case "slow":
+			case "cancelled":
+				_ = enc.Encode(message{Type: typeResults, ID: req.ID, Results: cancelled})
+			case "fail":
+				_ = enc.Encode(message{Type: typeError, ID: req.ID, Message: "backend unavailable"})
+			case "crash":
+				fmt.Fprintln(os.Stderr, "starting search")
+				fmt.Fprintln(os.Stderr, "panic: index corrupt")
+				return 3
+			case "pid":
+				_ = enc.Encode(message{Type: typeResults, ID: req.ID, Results: []result{{Title: strconv.Itoa(os.Getpid())}}})
+			default:
+				reply := message{Type: typeResults, ID: req.ID, Warnings: []string{"title: ignored"}}
+				if req.Cursor == "" {
+					reply.NextCursor = "page-2"
+				}
+				for i := range 2 {
+					reply.Results = append(reply.Results, result{
+						Title:      fmt.Sprintf("%s %d (%s)", req.Query, i+1, req.Cursor),
+						URL:        fmt.Sprintf("https://example.com/%d", i+1),
+						ID:         strconv.Itoa(i + 1),
+						ModifiedAt: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+						Metadata:   map[string]string{"limit": strconv.Itoa(req.Limit)},
+					})
+				}
+				_ = enc.Encode(reply)
+			}
+		}
+	}
+	return 0
+}
+
+func newTestConnector(t *testing.T, mode string) *Connector {
+	t.Helper()
+	t.Setenv("PKB_TEST_PLUGIN", mode)
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	c := NewConnector(exe).WithName("wiki")
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func search(t *testing.T, c *Connector, q string) connectors.Page {
+	t.Helper()
+	page, err := c.Search(context.Background(), connectors.Request{Query: q})
+	require.NoError(t, err)
+	return page
+}
+
+func TestConnector_Name(t *testing.T) {
+	assert.Equal(t, "plugin", NewConnector("pkb-wiki").Name())
+	assert.Equal(t, "wiki", NewConnector("pkb-wiki").WithName("wiki").Name())
+	assert.Equal(t, DefaultTimeout, NewConnector("pkb-wiki").SearchTimeout())
+	assert.Equal(t, time.Second, NewConnector("pkb-wiki").WithTimeout(time.Second).SearchTimeout())
+}
+
+func TestConnector_Search(t *testing.T) {
+	c := newTestConnector(t, "ok")
+
+	page, err := c.Search(context.Background(), connectors.Request{Query: "budget", Limit: 5})
+
+	require.NoError(t, err)
+	assert.Equal(t, "page-2", page.NextCursor)
+	assert.Equal(t, []string{"title: ignored"}, page.Warnings)
+	require.Len(t, page.Results, 2)
+	assert.Equal(t, connectors.Result{
+		Title:      "budget 1 ()",
+		URL:        "https://example.com/1",
+		Source:     "wiki",
+		ID:         "1",
+		ModifiedAt: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		Metadata:   map[string]string{"limit": "5"},
+	}, page.Results[0])
+
+	page, err = c.Search(context.Background(), connectors.Request{Query: "budget", Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, "budget 1 (page-2)", page.Results[0].Title)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestConnector_Search_KeepsThePluginRunning(t *testing.T) {
+	c := newTestConnector(t, "ok")
+
+	pid := search(t, c, "pid").Results[0].Title
+	_, err := c.Search(context.Background(), connectors.Request{Query: "fail"})
+	assert.EqualError(t, err, "plugin search: backend unavailable")
+	assert.Equal(t, pid, search(t, c, "pid").Results[0].Title, "errors don't restart the plugin")
+}
+
+func TestConnector_Search_Crash(t *testing.T) {
+	c := newTestConnector(t, "ok")
+	pid := search(t, c, "pid").Results[0].Title
+
+	_, err := c.Search(context.Background(), connectors.Request{Query: "crash"})
+
+	assert.EqualError(t, err, "plugin search: plugin exited: exit status 3: starting search; panic: index corrupt")
+	assert.NotEqual(t, pid, search(t, c, "pid").Results[0].Title, "the next search starts the plugin again")
+}
+
+func TestConnector_Search_Cancel(t *testing.T) {
+	c := newTestConnector(t, "ok")
+	search(t, c, "warm up")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := c.Search(ctx, connectors.Request{Query: "slow"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Equal(t, []string{"2"}, titles(search(t, c, "cancelled")), "the plugin is told which request was cancelled")
+}
+
+func TestConnector_Search_Timeout(t *testing.T) {
+	c := newTestConnector(t, "ok")
+	pid := search(t, c, "pid").Results[0].Title
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.Search(ctx, connectors.Request{Query: "slow"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.NotEqual(t, pid, search(t, c, "pid").Results[0].Title, "a plugin that stops replying is replaced")
+}
+
+func titles(page connectors.Page) []string {
+	var titles []string
+	for _, r := range page.Results {
+		titles = append(titles, r.Title)
+	}
+	return titles
+}
+
+func TestConnector_Search_HandshakeFailures(t *testing.T) {
+	for _, tc := range []struct {
+		mode string
+		want string
+	}{
+		{"not-json", "handshake: plugin sent an invalid message"},
+		{"old", "handshake: plugin speaks protocol version 0, want 1"},
+		{"refuse", "handshake: missing API token"},
+		{"silent", "handshake: no hello from the plugin: context deadline exceeded"},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			c := newTestConnector(t, tc.mode).WithTimeout(200 * time.Millisecond)
+			_, err := c.Search(context.Background(), connectors.Request{Query: "budget"})
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestConnector_Search_MissingProgram(t *testing.T) {
+	_, err := NewConnector("/nonexistent/pkb-plugin").Search(context.Background(), connectors.Request{Query: "budget"})
+
+	assert.ErrorContains(t, err, "plugin search: start /nonexistent/pkb-plugin:")
+}
+
+func TestConnector_Explain(t *testing.T) {
+	c := newTestConnector(t, "ok")
+
+	exp, err := c.Explain(connectors.Request{Query: "budget"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "native budget", exp.Query)
+	assert.Equal(t, "test", exp.Params["plugin"])
+	assert.Equal(t, "main", exp.Params["index"])
+	assert.Equal(t, c.command, exp.Params["command"])
+}
+
+func TestConnector_Close(t *testing.T) {
+	c := newTestConnector(t, "ok")
+	pid := search(t, c, "pid").Results[0].Title
+
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Close())
+
+	assert.NotEqual(t, pid, search(t, c, "pid").Results[0].Title)
+}
+
+func TestTail(t *testing.T) {
+	var tl tail
+	for i := range 7 {
+		fmt.Fprintf(&tl, "line %d\n\n", i)
+	}
+	fmt.Fprint(&tl, "partial")
+
+	assert.Equal(t, "line 3; line 4; line 5; line 6; partial", tl.String())
+}
@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+)
+
+// protocolVersion is the version of the protocol pkb speaks, exchanged in
+// the handshake. See docs/plugin-protocol.md.
+const protocolVersion = 1
+
+// Message types.
+const (
+	typeHello       = "hello"
+	typeSearch      = "search"
+	typeResults     = "results"
+	typeExplain     = "explain"
+	typeExplanation = "explanation"
+	typeError       = "error"
+	typeCancel      = "cancel"
+)
+
+// Capabilities a plugin can declare in its handshake.
+const (
+	capSearch  = "search"
+	capExplain = "explain"
+)
+
+// message is one line of the protocol, in either direction. Type selects
+// which of the other fields are used.
+type message struct {
+	Type string `json:"type"`
+	// ID pairs a request with its reply. The handshake has none.
+	ID int64 `json:"id,omitempty"`
+
+	// hello
+	Protocol     int      `json:"protocol,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// search and explain; explanation also sets Query.
+	Query  string `json:"query,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+
+	// results
+	Results    []result `json:"results,omitempty"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+
+	// explanation
+	Params map[string]string `json:"params,omitempty"`
+
+	// error
+	Message string `json:"message,omitempty"`
+}
+
+// result is a search result as plugins send it.
+type result struct {
+	Title      string            `json:"title"`
+	Snippet    string            `json:"snippet,omitempty"`
+	URL        string            `json:"url"`
+	ID         string            `json:"id,omitempty"`
+	CreatedAt  time.Time         `json:"created_at,omitzero"`
+	ModifiedAt time.Time         `json:"modified_at,omitzero"`
+	Author     string            `json:"author,omitempty"`
+	MimeType   string            `json:"mime_type,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+func (r result) toResult(source string) connectors.Result {
+	return connectors.Result{
+		Title:      r.Title,
+		Snippet:    r.Snippet,
+		URL:        r.URL,
+		Source:     source,
+		ID:         r.ID,
+		CreatedAt:  r.CreatedAt,
+		ModifiedAt: r.ModifiedAt,
+		Author:     r.Author,
+		MimeType:   r.MimeType,
+		Metadata:   r.Metadata,
+	}
+}
+
+const (
+	// tailLines is how many of a plugin's last stderr lines are kept, to
+	// explain why it failed.
+	tailLines = 5
+	// maxTailLine bounds each kept line.
+	maxTailLine = 500
+)
+
+// tail is an io.Writer that keeps the last lines written to it.
+type tail struct {
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+}
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, b := range p {
+		if b != '\n' {
+			if len(t.partial) < maxTailLine {
+				t.partial = append(t.partial, b)
+			}
+			continue
+		}
+		t.add(string(t.partial))
+		t.partial = t.partial[:0]
+	}
+	return len(p), nil
+}
+
+// add keeps a non-blank line. The caller must hold mu.
+func (t *tail) add(line string) {
+	if line = strings.TrimSpace(line); line == "" {
+		return
+	}
+	t.lines = append(t.lines, line)
+	if len(t.lines) > tailLines {
+		t.lines = t.lines[len(t.lines)-tailLines:]
+	}
+}
+
+// String returns the kept lines joined into one.
+func (t *tail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := t.lines
+	if p := strings.TrimSpace(string(t.partial)); p != "" {
+		lines = append(lines[:len(lines):len(lines)], p)
+	}
+	return strings.Join(lines[max(0, len(lines)-tailLines):], "; ")
+}
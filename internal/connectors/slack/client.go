@@ -0,0 +1,357 @@
+package slack
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+// defaultBaseURL is the Slack Web API endpoint.
+const defaultBaseURL = "https://slack.com/api/"
+
+// Page size bounds. search.messages accepts up to 100 matches per page;
+// conversations.history recommends no more than 200 messages.
+const (
+	defaultSearchCount = 20
+	maxSearchCount     = 100
+	historyLimit       = 200
+)
+
+// ErrRateLimited is wrapped by errors for requests Slack refused because
+// too many were made.
+var ErrRateLimited = errors.New("slack rate limit exceeded")
+
+// APIClient implements SlackClient over the Slack Web API with a user or
+// bot token. search.messages needs a user token with the search:read
+// scope; conversations.history needs channels:history (and groups:history
+// for private channels).
+type APIClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+
+	// mu guards the caches below, which save a lookup per message when
+	// reading channel history.
+	mu       sync.Mutex
+	teamURL  string
+	users    map[string]string
+	channels map[string]string
+}
+
+// NewAPIClient creates a Slack API client authenticating with token. A nil
+// httpClient uses http.DefaultClient.
+func NewAPIClient(token string, httpClient *http.Client) *APIClient {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &APIClient{
+		baseURL:    defaultBaseURL,
+		token:      token,
+		httpClient: httpClient,
+		users:      map[string]string{},
+		channels:   map[string]string{},
+	}
+}
+
+// buildSearchQuery translates a pkb query into Slack search modifiers.
+// Warnings list the clauses Slack cannot express. ok is false when the
+// query can never match a message (e.g. type:pdf), so the API need not be
+// called.
+func buildSearchQuery(q query.Query) (native string, warnings []string, ok bool) {
+	var terms []string
+	for _, c := range q.Clauses {
+		var term string
+		switch c.Field {
+		case query.FieldText:
+			term = c.Value
+			if c.Phrase {
+				term = `"` + term + `"`
+			}
+			if c.Negated {
+				term = "-" + term
+			}
+		case query.FieldFrom:
+			if c.Negated {
+				warnings = append(warnings, query.Unsupported(c))
+				continue
+			}
+			term = "from:" + c.Value
+			if !strings.HasPrefix(c.Value, "@") && !strings.HasPrefix(c.Value, "<") {
+				term = "from:@" + c.Value
+			}
+		case query.FieldBefore:
+			// Both are exclusive in Slack, so after: moves back a day to
+			// include the date itself, as pkb's after: does.
+			term = "before:" + c.Value
+		case query.FieldAfter:
+			term = "after:" + c.Date().AddDate(0, 0, -1).Format("2006-01-02")
+		case query.FieldType:
+			// Every Slack result is a message, so type: either matches
+			// everything or nothing.
+			if query.MatchesMIMEType(c.Value, mimeTypeMessage) == c.Negated {
+				return "", nil, false
+			}
+			continue
+		case query.FieldTitle:
+			warnings = append(warnings, query.Unsupported(c))
+			continue
+		default:
+			// source: is resolved by the search engine.
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " "), warnings, true
+}
+
+// searchCount clamps a requested result limit to what search.messages
+// accepts, using defaultSearchCount when no limit is given.
+func searchCount(limit int) int {
+	switch {
+	case limit <= 0:
+		return defaultSearchCount
+	case limit > maxSearchCount:
+		return maxSearchCount
+	}
+	return limit
+}
+
+// call invokes a Web API method and decodes its response into out. Slack
+// reports most failures with HTTP 200 and "ok": false.
+func (c *APIClient) call(ctx context.Context, method string, params url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+method+"?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("slack %s: %w", method, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("slack %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retry := resp.Header.Get("Retry-After")
+		if retry == "" {
+			retry = "?"
+		}
+		return fmt.Errorf("slack %s: %w, retry after %ss", method, ErrRateLimited, retry)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack %s: unexpected status %s", method, resp.Status)
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("slack %s: decode response: %w", method, err)
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("slack %s: decode response: %w", method, err)
+	}
+	if !status.OK {
+		return fmt.Errorf("slack %s: %s", method, status.Error)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("slack %s: decode response: %w", method, err)
+	}
+	return nil
+}
+
+// SearchMessages calls search.messages. Its pages are numbered, so the
+// cursor is the next page number.
+func (c *APIClient) SearchMessages(ctx context.Context, req connectors.Request) ([]Message, string, error) {
+	page := 1
+	if req.Cursor != "" {
+		n, err := strconv.Atoi(req.Cursor)
+		if err != nil || n < 1 {
+			return nil, "", fmt.Errorf("slack search.messages: invalid cursor %q", req.Cursor)
+		}
+		page = n
+	}
+	params := url.Values{
+		"query":     {req.Query},
+		"count":     {strconv.Itoa(searchCount(req.Limit))},
+		"page":      {strconv.Itoa(page)},
+		"sort":      {"score"},
+		"highlight": {"false"},
+	}
+	var resp struct {
+		Messages struct {
+			Matches []struct {
+				TS        string `json:"ts"`
+				Text      string `json:"text"`
+				User      string `json:"user"`
+				Username  string `json:"username"`
+				Permalink string `json:"permalink"`
+				Channel   struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"channel"`
+			} `json:"matches"`
+			Paging struct {
+				Page  int `json:"page"`
+				Pages int `json:"pages"`
+			} `json:"paging"`
+		} `json:"messages"`
+	}
+	if err := c.call(ctx, "search.messages", params, &resp); err != nil {
+		return nil, "", err
+	}
+
+	messages := make([]Message, len(resp.Messages.Matches))
+	for i, m := range resp.Messages.Matches {
+		messages[i] = Message{
+			ChannelID:   m.Channel.ID,
+			ChannelName: m.Channel.Name,
+			User:        m.User,
+			Username:    m.Username,
+			Text:        m.Text,
+			TS:          m.TS,
+			Permalink:   m.Permalink,
+		}
+	}
+	var next string
+	if p := resp.Messages.Paging; p.Page < p.Pages {
+		next = strconv.Itoa(p.Page + 1)
+	}
+	return messages, next, nil
+}
+
+// History calls conversations.history. Authors and the channel name are
+// looked up once each and cached, and permalinks are built from the
+// workspace URL.
+func (c *APIClient) History(ctx context.Context, channelID, cursor string) ([]Message, string, error) {
+	params := url.Values{"channel": {channelID}, "limit": {strconv.Itoa(historyLimit)}}
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+	var resp struct {
+		Messages []struct {
+			Type     string `json:"type"`
+			Subtype  string `json:"subtype"`
+			TS       string `json:"ts"`
+			Text     string `json:"text"`
+			User     string `json:"user"`
+			Username string `json:"username"`
+		} `json:"messages"`
+		HasMore          bool `json:"has_more"`
+		ResponseMetadata struct {
+			NextCursor string `json:"next_cursor"`
+		} `json:"response_metadata"`
+	}
+	if err := c.call(ctx, "conversations.history", params, &resp); err != nil {
+		return nil, "", err
+	}
+
+	teamURL, err := c.workspaceURL(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	channelName := c.channelName(ctx, channelID)
+	var messages []Message
+	for _, m := range resp.Messages {
+		// Skip joins, topic changes and other housekeeping.
+		if m.Type != "message" || (m.Subtype != "" && m.Subtype != "bot_message" && m.Subtype != "thread_broadcast") {
+			continue
+		}
+		msg := Message{
+			ChannelID:   channelID,
+			ChannelName: channelName,
+			User:        m.User,
+			Username:    m.Username,
+			Text:        m.Text,
+			TS:          m.TS,
+			Permalink:   teamURL + "archives/" + channelID + "/p" + strings.Replace(m.TS, ".", "", 1),
+		}
+		if msg.Username == "" && msg.User != "" {
+			msg.Username = c.userName(ctx, msg.User)
+		}
+		messages = append(messages, msg)
+	}
+	var next string
+	if resp.HasMore {
+		next = resp.ResponseMetadata.NextCursor
+	}
+	return messages, next, nil
+}
+
+// workspaceURL returns the workspace's URL, e.g.
+// "https://example.slack.com/", from auth.test.
+func (c *APIClient) workspaceURL(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.teamURL != "" {
+		return c.teamURL, nil
+	}
+	var resp struct {
+		URL string `json:"url"`
+	}
+	if err := c.call(ctx, "auth.test", url.Values{}, &resp); err != nil {
+		return "", err
+	}
+	c.teamURL = resp.URL
+	if !strings.HasSuffix(c.teamURL, "/") {
+		c.teamURL += "/"
+	}
+	return c.teamURL, nil
+}
+
+// channelName returns a channel's name from conversations.info, or "" if
+// the token may not look it up.
+func (c *APIClient) channelName(ctx context.Context, id string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name, ok := c.channels[id]; ok {
+		return name
+	}
+	var resp struct {
+		Channel struct {
+			Name string `json:"name"`
+		} `json:"channel"`
+	}
+	// A failure is cached too: without the channels:read scope every
+	// lookup would fail the same way.
+	_ = c.call(ctx, "conversations.info", url.Values{"channel": {id}}, &resp)
+	c.channels[id] = resp.Channel.Name
+	return resp.Channel.Name
+}
+
+// userName returns a user's display name from users.info, falling back to
+// their real name, their username and, if the token may not look them up,
+// their ID.
+func (c *APIClient) userName(ctx context.Context, id string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name, ok := c.users[id]; ok {
+		return name
+	}
+	var resp struct {
+		User struct {
+			Name    string `json:"name"`
+			Profile struct {
+				DisplayName string `json:"display_name"`
+				RealName    string `json:"real_name"`
+			} `json:"profile"`
+		} `json:"user"`
+	}
+	// As in channelName, a failure is cached.
+	_ = c.call(ctx, "users.info", url.Values{"user": {id}}, &resp)
+	u := resp.User
+	name := cmp.Or(u.Profile.DisplayName, u.Profile.RealName, u.Name, id)
+	c.users[id] = name
+	return name
+}
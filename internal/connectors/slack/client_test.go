@@ -0,0 +1,218 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient returns an APIClient whose requests go to handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *APIClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c := NewAPIClient("xoxp-test", srv.Client())
+	c.baseURL = srv.URL + "/"
+	return c
+}
+
+func TestBuildSearchQuery_Operators(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`budget "exact phrase" -draft`, `budget "exact phrase" -draft`},
+		{`from:alice from:@bob`, `from:@alice from:@bob`},
+		{`after:2024-03-01 before:2024-04-01`, `after:2024-02-29 before:2024-04-01`},
+		{`type:message notes`, `notes`},
+		{`-type:pdf notes`, `notes`},
+		{`source:slack in:#eng notes`, `in:#eng notes`},
+	}
+	for _, tt := range tests {
+		q, err := query.Parse(tt.query)
+		require.NoError(t, err)
+		got, warnings, ok := buildSearchQuery(q)
+		assert.True(t, ok, tt.query)
+		assert.Empty(t, warnings, tt.query)
+		assert.Equal(t, tt.want, got, tt.query)
+	}
+}
+
+func TestBuildSearchQuery_Unsupported(t *testing.T) {
+	q, err := query.Parse(`plan -from:alice title:x`)
+	require.NoError(t, err)
+	got, warnings, ok := buildSearchQuery(q)
+	assert.True(t, ok)
+	assert.Equal(t, "plan", got)
+	assert.Len(t, warnings, 2)
+
+	for _, s := range []string{"type:pdf notes", "-type:message"} {
+		q, err := query.Parse(s)
+		require.NoError(t, err)
+		_, _, ok := buildSearchQuery(q)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestSearchMessages_Success(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/search.messages", r.URL.Path)
+		assert.Equal(t, "Bearer xoxp-test", r.Header.Get("Authorization"))
+		assert.Equal(t, "ship from:@alice", r.URL.Query().Get("query"))
+		assert.Equal(t, "5", r.URL.Query().Get("count"))
+		assert.Equal(t, "2", r.URL.Query().Get("page"))
+		fmt.Fprint(w, `{"ok":true,"messages":{"matches":[{
+			"ts":"1700000000.000200","text":"shipping Friday","user":"U1","username":"alice",
+			"permalink":"https://example.slack.com/archives/C1/p1700000000000200",
+			"channel":{"id":"C1","name":"eng"}}],
+			"paging":{"count":5,"total":11,"page":2,"pages":3}}}`)
+	})
+
+	messages, next, err := c.SearchMessages(context.Background(), connectors.Request{Query: "ship from:@alice", Limit: 5, Cursor: "2"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "3", next)
+	assert.Equal(t, []Message{{
+		ChannelID:   "C1",
+		ChannelName: "eng",
+		User:        "U1",
+		Username:    "alice",
+		Text:        "shipping Friday",
+		TS:          "1700000000.000200",
+		Permalink:   "https://example.slack.com/archives/C1/p1700000000000200",
+	}}, messages)
+}
+
+func TestSearchMessages_LastPage(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "20", r.URL.Query().Get("count"))
+		assert.Equal(t, "1", r.URL.Query().Get("page"))
+		fmt.Fprint(w, `{"ok":true,"messages":{"matches":[],"paging":{"page":1,"pages":1}}}`)
+	})
+
+	messages, next, err := c.SearchMessages(context.Background(), connectors.Request{Query: "x"})
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+	assert.Empty(t, next)
+
+	_, _, err = c.SearchMessages(context.Background(), connectors.Request{Query: "x", Cursor: "zero"})
+	assert.ErrorContains(t, err, "invalid cursor")
+}
+
+func TestSearchMessages_APIError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok":false,"error":"not_allowed_token_type"}`)
+	})
+
+	_, _, err := c.SearchMessages(context.Background(), connectors.Request{Query: "x"})
+	assert.EqualError(t, err, "slack search.messages: not_allowed_token_type")
+}
+
+func TestSearchMessages_RateLimited(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	_, _, err := c.SearchMessages(context.Background(), connectors.Request{Query: "x"})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.Contains(t, err.Error(), "retry after 30s")
+}
+
+func TestSearchMessages_HTTPError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	_, _, err := c.SearchMessages(context.Background(), connectors.Request{Query: "x"})
+	assert.ErrorContains(t, err, "unexpected status 502")
+}
+
+func TestHistory(t *testing.T) {
+	calls := map[string]int{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Path]++
+		switch r.URL.Path {
+		case "/conversations.history":
+			assert.Equal(t, "C1", r.URL.Query().Get("channel"))
+			assert.Equal(t, "200", r.URL.Query().Get("limit"))
+			if r.URL.Query().Get("cursor") == "" {
+				fmt.Fprint(w, `{"ok":true,"messages":[
+					{"type":"message","ts":"1700000000.000200","text":"first","user":"U1"},
+					{"type":"message","subtype":"channel_join","ts":"1700000000.000100","text":"joined","user":"U2"},
+					{"type":"message","subtype":"bot_message","ts":"1700000000.000050","text":"deployed","username":"ci"}
+				],"has_more":true,"response_metadata":{"next_cursor":"bmV4dA=="}}`)
+				return
+			}
+			assert.Equal(t, "bmV4dA==", r.URL.Query().Get("cursor"))
+			fmt.Fprint(w, `{"ok":true,"messages":[{"type":"message","ts":"1600000000.000000","text":"older","user":"U1"}],"has_more":false}`)
+		case "/auth.test":
+			fmt.Fprint(w, `{"ok":true,"url":"https://example.slack.com/"}`)
+		case "/conversations.info":
+			fmt.Fprint(w, `{"ok":true,"channel":{"id":"C1","name":"eng"}}`)
+		case "/users.info":
+			assert.Equal(t, "U1", r.URL.Query().Get("user"))
+			fmt.Fprint(w, `{"ok":true,"user":{"name":"alice","profile":{"display_name":"","real_name":"Alice A"}}}`)
+		default:
+			t.Errorf("unexpected call to %s", r.URL.Path)
+		}
+	})
+
+	messages, next, err := c.History(context.Background(), "C1", "")
+	require.NoError(t, err)
+	assert.Equal(t, "bmV4dA==", next)
+	assert.Equal(t, []Message{
+		{ChannelID: "C1", ChannelName: "eng", User: "U1", Username: "Alice A", Text: "first", TS: "1700000000.000200",
+			Permalink: "https://example.slack.com/archives/C1/p1700000000000200"},
+		{ChannelID: "C1", ChannelName: "eng", Username: "ci", Text: "deployed", TS: "1700000000.000050",
+			Permalink: "https://example.slack.com/archives/C1/p1700000000000050"},
+	}, messages)
+
+	messages, next, err = c.History(context.Background(), "C1", "bmV4dA==")
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Alice A", messages[0].Username)
+
+	assert.Equal(t, 1, calls["/auth.test"], "workspace URL is cached")
+	assert.Equal(t, 1, calls["/conversations.info"], "channel names are cached")
+	assert.Equal(t, 1, calls["/users.info"], "user names are cached")
+}
+
+func TestHistory_LookupsWithoutScopeFallBackToIDs(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/conversations.history":
+			fmt.Fprint(w, `{"ok":true,"messages":[{"type":"message","ts":"1.0","text":"hi","user":"U1"}]}`)
+		case "/auth.test":
+			fmt.Fprint(w, `{"ok":true,"url":"https://example.slack.com"}`)
+		default:
+			fmt.Fprint(w, `{"ok":false,"error":"missing_scope"}`)
+		}
+	})
+
+	messages, _, err := c.History(context.Background(), "C1", "")
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "U1", messages[0].Username)
+	assert.Empty(t, messages[0].ChannelName)
+	assert.Equal(t, "https://example.slack.com/archives/C1/p10", messages[0].Permalink)
+}
+
+func TestHistory_APIError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok":false,"error":"channel_not_found"}`)
+	})
+
+	_, _, err := c.History(context.Background(), "C404", "")
+	assert.EqualError(t, err, "slack conversations.history: channel_not_found")
+}
@@ -0,0 +1,250 @@
+// Package slack searches Slack messages with the Web API, and copies the
+// history of chosen channels into the local index.
+package slack
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+// mimeTypeMessage is the MIME type of every Slack result.
+const mimeTypeMessage = "application/vnd.slack.message"
+
+// titleLen is the length, in runes, a message's first line is cut to for
+// its result title.
+const titleLen = 80
+
+// Message is a Slack message returned by the Web API.
+type Message struct {
+	ChannelID   string
+	ChannelName string
+	// User is the author's user ID and Username their display name, when
+	// known.
+	User     string
+	Username string
+	// Text is in Slack's mrkdwn format.
+	Text string
+	// TS is the message timestamp, which is also its ID within the channel.
+	TS        string
+	Permalink string
+}
+
+// Time returns the time the message was posted, from its timestamp.
+func (m Message) Time() time.Time {
+	sec, frac, _ := strings.Cut(m.TS, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	frac = (frac + "000000")[:6]
+	us, _ := strconv.ParseInt(frac, 10, 64)
+	return time.Unix(s, us*1000).UTC()
+}
+
+// SlackClient abstracts the Slack Web API for testability.
+type SlackClient interface {
+	// SearchMessages returns one page of messages matching req.Query, in
+	// Slack search syntax as built by buildSearchQuery, and the cursor for
+	// the next page ("" when there are no more).
+	SearchMessages(ctx context.Context, req connectors.Request) ([]Message, string, error)
+	// History returns one page of a channel's messages, newest first, and
+	// the cursor for the next page ("" when there are no more).
+	History(ctx context.Context, channelID, cursor string) ([]Message, string, error)
+}
+
+// Connector implements connectors.Connector for Slack.
+type Connector struct {
+	client   SlackClient
+	name     string
+	channels []string
+}
+
+// NewConnector creates a Slack connector with the given client.
+func NewConnector(client SlackClient) *Connector {
+	return &Connector{client: client, name: "slack"}
+}
+
+// WithName sets the name the connector reports and stamps on its results,
+// so several workspaces can be configured side by side. It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+// WithChannels sets the IDs of the channels Crawl copies into the local
+// index. It returns c.
+func (c *Connector) WithChannels(ids ...string) *Connector {
+	c.channels = ids
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the search.messages query and parameters Search would
+// send.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	native, _, ok := buildSearchQuery(parsed)
+	if !ok {
+		return connectors.Explanation{Params: map[string]string{
+			"skipped": "type: filter cannot match a Slack message; the API is not called",
+		}}, nil
+	}
+	params := map[string]string{
+		"count":     strconv.Itoa(searchCount(req.Limit)),
+		"sort":      "score",
+		"highlight": "false",
+	}
+	if req.Cursor != "" {
+		params["page"] = req.Cursor
+	}
+	return connectors.Explanation{Query: native, Params: params}, nil
+}
+
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	native, warnings, ok := buildSearchQuery(parsed)
+	if !ok {
+		return connectors.Page{Results: []connectors.Result{}}, nil
+	}
+	req.Query = native
+
+	messages, next, err := c.client.SearchMessages(ctx, req)
+	if err != nil {
+		return connectors.Page{}, fmt.Errorf("slack search: %w", err)
+	}
+
+	results := make([]connectors.Result, len(messages))
+	for i, m := range messages {
+		results[i] = c.toResult(m)
+	}
+	return connectors.Page{Results: results, NextCursor: next, Warnings: warnings}, nil
+}
+
+// Crawl walks the history of the channels set with WithChannels, one page
+// at a time. A cursor is the index of the channel being read, optionally
+// followed by ":" and that channel's history cursor. Without channels
+// there is nothing to crawl.
+func (c *Connector) Crawl(ctx context.Context, cursor string) (connectors.CrawlPage, error) {
+	i := 0
+	var channelCursor string
+	if cursor != "" {
+		idx, rest, _ := strings.Cut(cursor, ":")
+		n, err := strconv.Atoi(idx)
+		if err != nil || n < 0 {
+			return connectors.CrawlPage{}, fmt.Errorf("slack crawl: invalid cursor %q", cursor)
+		}
+		i, channelCursor = n, rest
+	}
+	if i >= len(c.channels) {
+		return connectors.CrawlPage{}, nil
+	}
+
+	messages, next, err := c.client.History(ctx, c.channels[i], channelCursor)
+	if err != nil {
+		return connectors.CrawlPage{}, fmt.Errorf("slack crawl %s: %w", c.channels[i], err)
+	}
+	docs := make([]connectors.Document, 0, len(messages))
+	for _, m := range messages {
+		r := c.toResult(m)
+		docs = append(docs, connectors.Document{Result: r, Body: r.Snippet})
+	}
+
+	page := connectors.CrawlPage{Documents: docs}
+	switch {
+	case next != "":
+		page.NextCursor = strconv.Itoa(i) + ":" + next
+	case i+1 < len(c.channels):
+		page.NextCursor = strconv.Itoa(i + 1)
+	}
+	return page, nil
+}
+
+func (c *Connector) toResult(m Message) connectors.Result {
+	text := plainText(m.Text)
+	posted := m.Time()
+	r := connectors.Result{
+		Title:      title(text),
+		Snippet:    text,
+		URL:        m.Permalink,
+		Source:     c.name,
+		ID:         m.ChannelID + "/" + m.TS,
+		CreatedAt:  posted,
+		ModifiedAt: posted,
+		Author:     m.Username,
+		MimeType:   mimeTypeMessage,
+		Metadata:   map[string]string{"channel_id": m.ChannelID, "ts": m.TS},
+	}
+	if r.Author == "" {
+		r.Author = m.User
+	}
+	if m.ChannelName != "" {
+		r.Metadata["channel"] = m.ChannelName
+	}
+	if m.User != "" {
+		r.Metadata["user_id"] = m.User
+	}
+	return r
+}
+
+// title returns the first line of text, shortened to titleLen runes.
+func title(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	line = strings.TrimSpace(line)
+	if utf8.RuneCountInString(line) <= titleLen {
+		return line
+	}
+	rs := []rune(line)
+	return strings.TrimSpace(string(rs[:titleLen-1])) + "…"
+}
+
+// entityRE matches Slack's <...> escapes for mentions, channels and links.
+var entityRE = regexp.MustCompile(`<([^<>]*)>`)
+
+// plainText converts Slack mrkdwn to plain text: mentions and channel
+// references become @name and #name, links their label or URL, and HTML
+// entities are decoded.
+func plainText(s string) string {
+	s = entityRE.ReplaceAllStringFunc(s, func(e string) string {
+		target, label, hasLabel := strings.Cut(e[1:len(e)-1], "|")
+		switch {
+		case strings.HasPrefix(target, "@"):
+			if hasLabel {
+				return "@" + strings.TrimPrefix(label, "@")
+			}
+			return target
+		case strings.HasPrefix(target, "#"):
+			if hasLabel {
+				return "#" + label
+			}
+			return target
+		case strings.HasPrefix(target, "!"):
+			// Special mentions such as <!here> or <!subteam^ID|@team>.
+			if hasLabel {
+				return label
+			}
+			return "@" + strings.TrimPrefix(target, "!")
+		case hasLabel:
+			return label
+		}
+		return target
+	})
+	return strings.TrimSpace(html.UnescapeString(s))
+}
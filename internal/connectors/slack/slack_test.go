@@ -0,0 +1,161 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockSlackClient implements SlackClient for testing.
+type MockSlackClient struct {
+	mock.Mock
+}
+
+func (m *MockSlackClient) SearchMessages(ctx context.Context, req connectors.Request) ([]Message, string, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).([]Message), args.String(1), args.Error(2)
+}
+
+func (m *MockSlackClient) History(ctx context.Context, channelID, cursor string) ([]Message, string, error) {
+	args := m.Called(ctx, channelID, cursor)
+	return args.Get(0).([]Message), args.String(1), args.Error(2)
+}
+
+var decision = Message{
+	ChannelID:   "C1",
+	ChannelName: "eng",
+	User:        "U1",
+	Username:    "alice",
+	Text:        "We decided to ship <https://example.com/plan|the plan> on Friday &amp; tell <@U2|bob>\nDetails in thread",
+	TS:          "1700000000.000200",
+	Permalink:   "https://example.slack.com/archives/C1/p1700000000000200",
+}
+
+func TestConnector_Name(t *testing.T) {
+	assert.Equal(t, "slack", NewConnector(nil).Name())
+	assert.Equal(t, "work-slack", NewConnector(nil).WithName("work-slack").Name())
+}
+
+func TestConnector_Search_ReturnsResults(t *testing.T) {
+	mockClient := new(MockSlackClient)
+	mockClient.On("SearchMessages", mock.Anything, connectors.Request{Query: "ship from:@alice", Limit: 5}).Return([]Message{decision}, "2", nil)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "ship from:alice", Limit: 5})
+
+	require.NoError(t, err)
+	assert.Equal(t, "2", page.NextCursor)
+	require.Len(t, page.Results, 1)
+	r := page.Results[0]
+	assert.Equal(t, "We decided to ship the plan on Friday & tell @bob", r.Title)
+	assert.Equal(t, "We decided to ship the plan on Friday & tell @bob\nDetails in thread", r.Snippet)
+	assert.Equal(t, decision.Permalink, r.URL)
+	assert.Equal(t, "slack", r.Source)
+	assert.Equal(t, "C1/1700000000.000200", r.ID)
+	assert.Equal(t, "alice", r.Author)
+	assert.Equal(t, time.Date(2023, 11, 14, 22, 13, 20, 200000, time.UTC), r.CreatedAt)
+	assert.Equal(t, r.CreatedAt, r.ModifiedAt)
+	assert.Equal(t, "application/vnd.slack.message", r.MimeType)
+	assert.Equal(t, map[string]string{"channel": "eng", "channel_id": "C1", "ts": "1700000000.000200", "user_id": "U1"}, r.Metadata)
+	mockClient.AssertExpectations(t)
+}
+
+func TestConnector_Search_ReportsUnsupportedOperators(t *testing.T) {
+	mockClient := new(MockSlackClient)
+	mockClient.On("SearchMessages", mock.Anything, connectors.Request{Query: "plan"}).Return([]Message{}, "", nil)
+
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "plan title:roadmap"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"title:roadmap is not supported by this source and was ignored"}, page.Warnings)
+}
+
+func TestConnector_Search_TypeThatCannotMatch(t *testing.T) {
+	mockClient := new(MockSlackClient)
+	page, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "plan type:pdf"})
+
+	require.NoError(t, err)
+	assert.Empty(t, page.Results)
+	mockClient.AssertNotCalled(t, "SearchMessages", mock.Anything, mock.Anything)
+}
+
+func TestConnector_Search_HandlesError(t *testing.T) {
+	mockClient := new(MockSlackClient)
+	mockClient.On("SearchMessages", mock.Anything, mock.Anything).Return([]Message{}, "", errors.New("invalid_auth"))
+
+	_, err := NewConnector(mockClient).Search(context.Background(), connectors.Request{Query: "plan"})
+	assert.EqualError(t, err, "slack search: invalid_auth")
+}
+
+func TestConnector_Explain(t *testing.T) {
+	exp, err := NewConnector(nil).Explain(connectors.Request{Query: `"ship it" after:2024-03-01`, Cursor: "3"})
+	require.NoError(t, err)
+	assert.Equal(t, `"ship it" after:2024-02-29`, exp.Query)
+	assert.Equal(t, map[string]string{"count": "20", "sort": "score", "highlight": "false", "page": "3"}, exp.Params)
+}
+
+func TestConnector_Crawl_WalksEachChannel(t *testing.T) {
+	mockClient := new(MockSlackClient)
+	mockClient.On("History", mock.Anything, "C1", "").Return([]Message{decision}, "next1", nil)
+	mockClient.On("History", mock.Anything, "C1", "next1").Return([]Message{}, "", nil)
+	mockClient.On("History", mock.Anything, "C2", "").Return([]Message{{ChannelID: "C2", TS: "1.0", Text: "hi"}}, "", nil)
+	c := NewConnector(mockClient).WithChannels("C1", "C2")
+
+	var ids []string
+	cursor := ""
+	for {
+		page, err := c.Crawl(context.Background(), cursor)
+		require.NoError(t, err)
+		for _, d := range page.Documents {
+			ids = append(ids, d.ID)
+			assert.Equal(t, d.Snippet, d.Body)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"C1/1700000000.000200", "C2/1.0"}, ids)
+	mockClient.AssertExpectations(t)
+}
+
+func TestConnector_Crawl_WithoutChannels(t *testing.T) {
+	page, err := NewConnector(new(MockSlackClient)).Crawl(context.Background(), "")
+	require.NoError(t, err)
+	assert.Empty(t, page.Documents)
+	assert.Empty(t, page.NextCursor)
+
+	_, err = NewConnector(nil).Crawl(context.Background(), "x")
+	assert.ErrorContains(t, err, "invalid cursor")
+}
+
+func TestPlainText(t *testing.T) {
+	tests := map[string]string{
+		"<@U123>":               "@U123",
+		"<@U123|alice>":         "@alice",
+		"<#C123|general>":       "#general",
+		"<!here> look":          "@here look",
+		"<!subteam^S1|@eng>":    "@eng",
+		"<https://example.com>": "https://example.com",
+		"<mailto:a@b.c|a@b.c>":  "a@b.c",
+		"a &lt;b&gt; &amp; c":   "a <b> & c",
+		"  padded  ":            "padded",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, plainText(in), in)
+	}
+}
+
+func TestTitle_TruncatesLongFirstLine(t *testing.T) {
+	got := title(strings.Repeat("word ", 30) + "\nsecond line")
+	assert.Equal(t, titleLen, utf8.RuneCountInString(got))
+	assert.True(t, strings.HasSuffix(got, "…"))
+	assert.Equal(t, "short", title("short\nsecond"))
+}
@@ -0,0 +1,25 @@
+package corpus
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// OpenArchive opens a ZIP file, or the directory it was extracted to, for
+// an importer to read. close releases the file.
+func OpenArchive(path string) (fsys fs.FS, close func() error, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		return os.DirFS(path), func() error { return nil }, nil
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return zr, zr.Close, nil
+}
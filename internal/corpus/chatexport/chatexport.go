@@ -0,0 +1,382 @@
+// Package chatexport reads the conversations.json file in the data exports
+// of ChatGPT and Claude. Both hold a list of conversations: ChatGPT's keep
+// their messages as a tree of edits and regenerations, of which the branch
+// last shown is read, and Claude's as a list.
+package chatexport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus"
+)
+
+// Kind names the format in imports and connector types.
+const Kind = "chat-export"
+
+const (
+	mimeTypeMessage = "application/vnd.pkb.chat-message"
+	// exportFile is the file of conversations in an export.
+	exportFile = "conversations.json"
+	// dateLayout is how message times are shown on conversation pages.
+	dateLayout = "Mon, 2 Jan 2006 15:04 MST"
+	// untitled is the title of conversations that were never named.
+	untitled = "Untitled conversation"
+)
+
+// conversation is a conversation of either export. ChatGPT's have a mapping
+// of messages by ID; Claude's have a list of chat messages.
+type conversation struct {
+	// ChatGPT
+	ID             string          `json:"id"`
+	ConversationID string          `json:"conversation_id"`
+	Title          string          `json:"title"`
+	CreateTime     float64         `json:"create_time"`
+	UpdateTime     float64         `json:"update_time"`
+	Mapping        map[string]node `json:"mapping"`
+	CurrentNode    string          `json:"current_node"`
+	// Claude
+	UUID         string        `json:"uuid"`
+	Name         string        `json:"name"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	ChatMessages []chatMessage `json:"chat_messages"`
+}
+
+// node is a message in a ChatGPT conversation's tree.
+type node struct {
+	ID      string        `json:"id"`
+	Parent  string        `json:"parent"`
+	Message *chatGPTEntry `json:"message"`
+}
+
+type chatGPTEntry struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime float64 `json:"create_time"`
+	Content    struct {
+		ContentType string `json:"content_type"`
+		// Parts are strings for text, and objects for images and
+		// other attachments.
+		Parts []any  `json:"parts"`
+		Text  string `json:"text"`
+	} `json:"content"`
+	Metadata struct {
+		ModelSlug string `json:"model_slug"`
+		Hidden    bool   `json:"is_visually_hidden_from_conversation"`
+	} `json:"metadata"`
+}
+
+type chatMessage struct {
+	UUID      string    `json:"uuid"`
+	Sender    string    `json:"sender"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+	Content   []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Attachments []struct {
+		FileName string `json:"file_name"`
+	} `json:"attachments"`
+	Files []struct {
+		FileName string `json:"file_name"`
+	} `json:"files"`
+}
+
+// turn is a message of either export.
+type turn struct {
+	role   string
+	text   string
+	posted time.Time
+	model  string
+}
+
+// Read reads the export at path: its conversations.json file, the ZIP file
+// it came in or the directory that was extracted to. Each conversation
+// becomes an item, with its ID as the item's ID and an entry per message.
+func Read(path string) (*corpus.Corpus, error) {
+	data, err := readExport(path)
+	if err != nil {
+		return nil, err
+	}
+	var conversations []conversation
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return nil, fmt.Errorf("%s: not a ChatGPT or Claude export: %w", path, err)
+	}
+	items := make([]corpus.Item, 0, len(conversations))
+	seen := map[string]bool{}
+	for i, conv := range conversations {
+		item, ok := convert(conv)
+		if !ok {
+			return nil, fmt.Errorf("%s: conversation %d: not a ChatGPT or Claude conversation", path, i+1)
+		}
+		if seen[item.ID] {
+			continue
+		}
+		seen[item.ID] = true
+		items = append(items, item)
+	}
+	return &corpus.Corpus{Info: corpus.Info{Kind: Kind, Origin: path}, Items: items}, nil
+}
+
+// readExport returns the contents of the conversations.json file name, or
+// of the one at the top of the archive or directory name or of a folder in
+// it.
+func readExport(name string) ([]byte, error) {
+	if info, err := os.Stat(name); err == nil && !info.IsDir() && strings.EqualFold(filepath.Ext(name), ".json") {
+		return os.ReadFile(name)
+	}
+	fsys, closeArchive, err := corpus.OpenArchive(name)
+	if err != nil {
+		return nil, err
+	}
+	defer closeArchive()
+	data, err := fs.ReadFile(fsys, exportFile)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return data, err
+	}
+	matches, err := fs.Glob(fsys, path.Join("*", exportFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) != 1 {
+		return nil, fmt.Errorf("%s: not a ChatGPT or Claude export: no %s", name, exportFile)
+	}
+	return fs.ReadFile(fsys, matches[0])
+}
+
+// convert converts a conversation of either export, reporting false if it
+// is neither.
+func convert(conv conversation) (corpus.Item, bool) {
+	var (
+		id, title, assistant, link string
+		created, updated           time.Time
+		turns                      []turn
+	)
+	switch {
+	case conv.Mapping != nil:
+		id = firstNonEmpty(conv.ConversationID, conv.ID)
+		title, assistant = conv.Title, "ChatGPT"
+		created, updated = unixTime(conv.CreateTime), unixTime(conv.UpdateTime)
+		turns = chatGPTTurns(conv)
+		link = "https://chatgpt.com/c/" + id
+	case conv.UUID != "":
+		id, title, assistant = conv.UUID, conv.Name, "Claude"
+		created, updated = conv.CreatedAt.UTC(), conv.UpdatedAt.UTC()
+		turns = claudeTurns(conv)
+		link = "https://claude.ai/chat/" + id
+	default:
+		return corpus.Item{}, false
+	}
+	if id == "" {
+		return corpus.Item{}, false
+	}
+	if title = strings.TrimSpace(title); title == "" {
+		title = untitled
+	}
+
+	item := corpus.Item{ID: strings.ReplaceAll(id, "#", "%23"), Title: title}
+	models := map[string]bool{}
+	for i, t := range turns {
+		speaker := speakerName(t.role, assistant)
+		posted := t.posted
+		if posted.IsZero() {
+			posted = created
+		}
+		heading := speaker
+		if !posted.IsZero() {
+			heading += " · " + posted.Format(dateLayout)
+		}
+		e := corpus.Entry{
+			Anchor:     "m" + strconv.Itoa(i+1),
+			Heading:    heading,
+			Text:       t.text,
+			Author:     speaker,
+			CreatedAt:  posted,
+			ModifiedAt: posted,
+			MimeType:   mimeTypeMessage,
+			Metadata:   map[string]string{"conversation": title, "role": t.role, "assistant": assistant},
+		}
+		if t.model != "" {
+			e.Metadata["model"] = t.model
+			models[t.model] = true
+		}
+		item.Entries = append(item.Entries, e)
+	}
+
+	var modelList []string
+	for m := range models {
+		modelList = append(modelList, m)
+	}
+	sort.Strings(modelList)
+	for _, f := range []connectors.ViewField{
+		{Name: "Assistant", Value: assistant},
+		{Name: "Model", Value: strings.Join(modelList, ", ")},
+		{Name: "Started", Value: formatTime(created)},
+		{Name: "Updated", Value: formatTime(updated)},
+		{Name: "Messages", Value: strconv.Itoa(len(turns))},
+		{Name: "Original", Value: link},
+	} {
+		if f.Value != "" {
+			item.Fields = append(item.Fields, f)
+		}
+	}
+	return item, true
+}
+
+// chatGPTTurns returns the messages of the branch of a ChatGPT
+// conversation that was shown last, by walking up from its current node.
+// System messages and those hidden from the conversation are left out.
+func chatGPTTurns(conv conversation) []turn {
+	current := conv.CurrentNode
+	if _, ok := conv.Mapping[current]; !ok {
+		current = lastLeaf(conv.Mapping)
+	}
+	var turns []turn
+	seen := map[string]bool{}
+	for id := current; id != "" && !seen[id]; id = conv.Mapping[id].Parent {
+		seen[id] = true
+		m := conv.Mapping[id].Message
+		if m == nil || m.Author.Role == "system" || m.Metadata.Hidden {
+			continue
+		}
+		var parts []string
+		for _, p := range m.Content.Parts {
+			if s, ok := p.(string); ok && strings.TrimSpace(s) != "" {
+				parts = append(parts, s)
+			}
+		}
+		text := strings.TrimSpace(strings.Join(parts, "\n"))
+		if text == "" {
+			text = strings.TrimSpace(m.Content.Text)
+		}
+		if text == "" {
+			continue
+		}
+		turns = append(turns, turn{role: m.Author.Role, text: text, posted: unixTime(m.CreateTime), model: m.Metadata.ModelSlug})
+	}
+	for i, j := 0, len(turns)-1; i < j; i, j = i+1, j-1 {
+		turns[i], turns[j] = turns[j], turns[i]
+	}
+	return turns
+}
+
+// lastLeaf returns the most recent message with no replies, for
+// conversations exported without their current node.
+func lastLeaf(mapping map[string]node) string {
+	parents := map[string]bool{}
+	for _, n := range mapping {
+		parents[n.Parent] = true
+	}
+	var leaf string
+	latest := math.Inf(-1)
+	for id, n := range mapping {
+		if parents[id] || n.Message == nil {
+			continue
+		}
+		if t := n.Message.CreateTime; t > latest || (t == latest && id > leaf) {
+			leaf, latest = id, t
+		}
+	}
+	return leaf
+}
+
+// claudeTurns returns the messages of a Claude conversation, with the
+// names of the files attached to them.
+func claudeTurns(conv conversation) []turn {
+	var turns []turn
+	for _, m := range conv.ChatMessages {
+		var parts []string
+		for _, c := range m.Content {
+			if c.Type == "text" && strings.TrimSpace(c.Text) != "" {
+				parts = append(parts, c.Text)
+			}
+		}
+		text := strings.TrimSpace(strings.Join(parts, "\n"))
+		if text == "" {
+			text = strings.TrimSpace(m.Text)
+		}
+		var files []string
+		for _, f := range m.Attachments {
+			files = append(files, f.FileName)
+		}
+		for _, f := range m.Files {
+			files = append(files, f.FileName)
+		}
+		if files = nonEmpty(files); len(files) > 0 {
+			text = strings.TrimSpace(text + "\nFiles: " + strings.Join(files, ", "))
+		}
+		if text == "" {
+			continue
+		}
+		role := m.Sender
+		if role == "human" {
+			role = "user"
+		}
+		turns = append(turns, turn{role: role, text: text, posted: m.CreatedAt.UTC()})
+	}
+	return turns
+}
+
+// speakerName is how a message's author is shown: You for the user, the
+// assistant's name for its replies.
+func speakerName(role, assistant string) string {
+	switch role {
+	case "user":
+		return "You"
+	case "assistant":
+		return assistant
+	case "tool":
+		return "Tool"
+	}
+	return role
+}
+
+// unixTime converts an export's seconds since the epoch, with a fraction.
+// Zero, as for a missing time, stays the zero time.
+func unixTime(secs float64) time.Time {
+	if secs <= 0 {
+		return time.Time{}
+	}
+	whole, frac := math.Modf(secs)
+	return time.Unix(int64(whole), int64(frac*1e9)).UTC().Truncate(time.Millisecond)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(dateLayout)
+}
+
+func nonEmpty(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package chatexport
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chatGPTExport is a ChatGPT conversation whose last answer was
+// regenerated: the branch shown last ends at node "a2".
+const chatGPTExport = `[{
+	"title": "Postgres vacuum tuning",
+	"create_time": 1709630400.5,
+	"update_time": 1709634000.0,
+	"conversation_id": "6a1f0c2e-1111-4c1e-9b1a-0d4f5e6a7b8c",
+	"current_node": "a2",
+	"mapping": {
+		"root": {"id": "root", "parent": null, "message": null},
+		"sys": {"id": "sys", "parent": "root", "message": {"author": {"role": "system"}, "content": {"content_type": "text", "parts": [""]}}},
+		"u1": {"id": "u1", "parent": "sys", "message": {"author": {"role": "user"}, "create_time": 1709630401.0,
+			"content": {"content_type": "multimodal_text", "parts": [{"content_type": "image_asset_pointer"}, "Why is autovacuum so slow on our events table?"]}}},
+		"a1": {"id": "a1", "parent": "u1", "message": {"author": {"role": "assistant"}, "create_time": 1709630410.0,
+			"content": {"content_type": "text", "parts": ["An answer that was regenerated."]}, "metadata": {"model_slug": "gpt-4"}}},
+		"ctx": {"id": "ctx", "parent": "u1", "message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["hidden context"]},
+			"metadata": {"is_visually_hidden_from_conversation": true}}},
+		"a2": {"id": "a2", "parent": "ctx", "message": {"author": {"role": "assistant"}, "create_time": 1709630420.0,
+			"content": {"content_type": "text", "parts": ["Raise autovacuum_vacuum_cost_limit so it does more work per round."]}, "metadata": {"model_slug": "gpt-4o"}}}
+	}
+}]`
+
+const claudeExport = `[{
+	"uuid": "0b7c9d2e-2222-4f7a-8e3b-5c6d7e8f9a0b",
+	"name": "",
+	"created_at": "2024-03-06T10:00:00.000000Z",
+	"updated_at": "2024-03-06T10:05:00.000000Z",
+	"chat_messages": [
+		{"uuid": "m1", "sender": "human", "text": "Summarise the attached RFC", "created_at": "2024-03-06T10:00:00Z",
+		 "content": [{"type": "text", "text": "Summarise the attached RFC"}], "attachments": [{"file_name": "rfc-42.md"}], "files": []},
+		{"uuid": "m2", "sender": "assistant", "text": "", "created_at": "2024-03-06T10:00:30Z",
+		 "content": [{"type": "thinking", "thinking": "..."}, {"type": "text", "text": "The RFC proposes sharding the events table by month."}]},
+		{"uuid": "m3", "sender": "assistant", "text": "", "created_at": "2024-03-06T10:01:00Z", "content": []}
+	]
+}]`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestRead_ChatGPT(t *testing.T) {
+	c, err := Read(writeFile(t, "conversations.json", chatGPTExport))
+
+	require.NoError(t, err)
+	assert.Equal(t, Kind, c.Kind)
+	require.Len(t, c.Items, 1)
+	it := c.Items[0]
+	assert.Equal(t, "6a1f0c2e-1111-4c1e-9b1a-0d4f5e6a7b8c", it.ID)
+	assert.Equal(t, "Postgres vacuum tuning", it.Title)
+	assert.Equal(t, []connectors.ViewField{
+		{Name: "Assistant", Value: "ChatGPT"},
+		{Name: "Model", Value: "gpt-4o"},
+		{Name: "Started", Value: "Tue, 5 Mar 2024 09:20 UTC"},
+		{Name: "Updated", Value: "Tue, 5 Mar 2024 10:20 UTC"},
+		{Name: "Messages", Value: "2"},
+		{Name: "Original", Value: "https://chatgpt.com/c/6a1f0c2e-1111-4c1e-9b1a-0d4f5e6a7b8c"},
+	}, it.Fields)
+	require.Len(t, it.Entries, 2, "the system message, hidden message and earlier answer are left out")
+	assert.Equal(t, corpus.Entry{
+		Anchor:     "m1",
+		Heading:    "You · Tue, 5 Mar 2024 09:20 UTC",
+		Text:       "Why is autovacuum so slow on our events table?",
+		Author:     "You",
+		CreatedAt:  time.Date(2024, 3, 5, 9, 20, 1, 0, time.UTC),
+		ModifiedAt: time.Date(2024, 3, 5, 9, 20, 1, 0, time.UTC),
+		MimeType:   "application/vnd.pkb.chat-message",
+		Metadata:   map[string]string{"conversation": "Postgres vacuum tuning", "role": "user", "assistant": "ChatGPT"},
+	}, it.Entries[0])
+	assert.Equal(t, "m2", it.Entries[1].Anchor)
+	assert.Equal(t, "ChatGPT", it.Entries[1].Author)
+	assert.Equal(t, "Raise autovacuum_vacuum_cost_limit so it does more work per round.", it.Entries[1].Text)
+	assert.Equal(t, "gpt-4o", it.Entries[1].Metadata["model"])
+}
+
+func TestRead_ChatGPTWithoutCurrentNode(t *testing.T) {
+	c, err := Read(writeFile(t, "conversations.json", `[{"id": "c1", "title": "T", "mapping": {
+		"u1": {"id": "u1", "message": {"author": {"role": "user"}, "create_time": 1, "content": {"parts": ["question"]}}},
+		"a1": {"id": "a1", "parent": "u1", "message": {"author": {"role": "assistant"}, "create_time": 2, "content": {"parts": ["first"]}}},
+		"a2": {"id": "a2", "parent": "u1", "message": {"author": {"role": "assistant"}, "create_time": 3, "content": {"parts": ["second"]}}}
+	}}]`))
+
+	require.NoError(t, err)
+	require.Len(t, c.Items[0].Entries, 2)
+	assert.Equal(t, "second", c.Items[0].Entries[1].Text, "the latest branch is read")
+}
+
+func TestRead_Claude(t *testing.T) {
+	c, err := Read(writeFile(t, "conversations.json", claudeExport))
+
+	require.NoError(t, err)
+	require.Len(t, c.Items, 1)
+	it := c.Items[0]
+	assert.Equal(t, "0b7c9d2e-2222-4f7a-8e3b-5c6d7e8f9a0b", it.ID)
+	assert.Equal(t, "Untitled conversation", it.Title)
+	assert.Equal(t, []connectors.ViewField{
+		{Name: "Assistant", Value: "Claude"},
+		{Name: "Started", Value: "Wed, 6 Mar 2024 10:00 UTC"},
+		{Name: "Updated", Value: "Wed, 6 Mar 2024 10:05 UTC"},
+		{Name: "Messages", Value: "2"},
+		{Name: "Original", Value: "https://claude.ai/chat/0b7c9d2e-2222-4f7a-8e3b-5c6d7e8f9a0b"},
+	}, it.Fields)
+	require.Len(t, it.Entries, 2, "empty messages are left out")
+	assert.Equal(t, "Summarise the attached RFC\nFiles: rfc-42.md", it.Entries[0].Text)
+	assert.Equal(t, "user", it.Entries[0].Metadata["role"])
+	assert.Equal(t, "Claude · Wed, 6 Mar 2024 10:00 UTC", it.Entries[1].Heading)
+	assert.Equal(t, "The RFC proposes sharding the events table by month.", it.Entries[1].Text)
+	assert.Equal(t, time.Date(2024, 3, 6, 10, 0, 30, 0, time.UTC), it.Entries[1].CreatedAt)
+}
+
+func TestRead_Zip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{"data-2024-03-07/conversations.json": claudeExport, "data-2024-03-07/users.json": `[]`} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	c, err := Read(path)
+
+	require.NoError(t, err)
+	require.Len(t, c.Items, 1)
+	assert.Len(t, c.Items[0].Entries, 2)
+}
+
+func TestRead_NotAnExport(t *testing.T) {
+	_, err := Read(writeFile(t, "conversations.json", `{"conversations": []}`))
+	assert.ErrorContains(t, err, "not a ChatGPT or Claude export: json: cannot unmarshal object")
+
+	_, err = Read(writeFile(t, "conversations.json", `[{"messages": []}]`))
+	assert.ErrorContains(t, err, "conversation 1: not a ChatGPT or Claude conversation")
+
+	dir := t.TempDir()
+	_, err = Read(dir)
+	assert.EqualError(t, err, dir+": not a ChatGPT or Claude export: no conversations.json")
+}
@@ -0,0 +1,167 @@
+package corpus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+const defaultLimit = 20
+
+// Connector implements connectors.Connector and connectors.Viewer for an
+// import. An import saved again while the connector is in use, by pkb
+// import in another process, is read again.
+type Connector struct {
+	dir     string
+	corpus  string
+	baseURL string
+	name    string
+
+	// mu guards everything below it.
+	mu      sync.Mutex
+	index   *index.Index
+	items   map[string]Item
+	version time.Time
+}
+
+// NewConnector creates a connector for the import called name in dir.
+// Results link to item pages served by pkb serve at baseURL.
+func NewConnector(dir, name, baseURL string) *Connector {
+	return &Connector{dir: dir, corpus: name, baseURL: baseURL, name: name}
+}
+
+// WithName sets the name the connector reports and stamps on its results,
+// which defaults to the import's. It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the stemmed terms searched for and the import searched.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	return connectors.Explanation{
+		Query:  strings.Join(index.Terms(parsed), " "),
+		Params: map[string]string{"import": c.corpus, "limit": strconv.Itoa(limit)},
+	}, nil
+}
+
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	offset := 0
+	if req.Cursor != "" {
+		if offset, err = strconv.Atoi(req.Cursor); err != nil || offset < 0 {
+			return connectors.Page{}, fmt.Errorf("invalid import cursor %q", req.Cursor)
+		}
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	ix, err := c.openIndex()
+	if err != nil {
+		return connectors.Page{}, err
+	}
+
+	terms := index.Terms(parsed)
+	hits := ix.Search(parsed)
+	end := min(offset+limit, len(hits))
+	results := []connectors.Result{}
+	for _, h := range hits[min(offset, end):end] {
+		r := h.Doc.Result
+		r.Source = c.name
+		r.Snippet = index.Snippet(h.Doc.Body, terms)
+		if r.URL == "" {
+			item, anchor, _ := strings.Cut(r.ID, "#")
+			r.URL = connectors.ViewURL(c.baseURL, c.name, item)
+			if anchor != "" {
+				r.URL += "#" + anchor
+			}
+		}
+		results = append(results, r)
+	}
+
+	var next string
+	if end < len(hits) {
+		next = strconv.Itoa(end)
+	}
+	return connectors.Page{Results: results, NextCursor: next}, nil
+}
+
+// openIndex opens the import's index on first use, and reads it again if
+// the import was saved since.
+func (c *Connector) openIndex() (*index.Index, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.index == nil {
+		path := indexPath(c.dir, c.corpus)
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("import %s: %w", c.corpus, err)
+		}
+		ix, err := index.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		c.index = ix
+		return ix, nil
+	}
+	return c.index, c.index.Refresh()
+}
+
+// View returns the item with the given ID, with a section per entry.
+func (c *Connector) View(_ context.Context, id string) (connectors.View, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, err := os.Stat(corpusPath(c.dir, c.corpus))
+	if errors.Is(err, fs.ErrNotExist) {
+		return connectors.View{}, fmt.Errorf("import %s: %w", c.corpus, connectors.ErrNotFound)
+	}
+	if err != nil {
+		return connectors.View{}, err
+	}
+	if c.items == nil || !info.ModTime().Equal(c.version) {
+		corpus, err := Load(c.dir, c.corpus)
+		if err != nil {
+			return connectors.View{}, err
+		}
+		c.items = make(map[string]Item, len(corpus.Items))
+		for _, it := range corpus.Items {
+			c.items[it.ID] = it
+		}
+		c.version = info.ModTime()
+	}
+
+	it, ok := c.items[id]
+	if !ok {
+		return connectors.View{}, fmt.Errorf("item %s: %w", id, connectors.ErrNotFound)
+	}
+	v := connectors.View{Title: it.Title, Fields: it.Fields}
+	for _, e := range it.Entries {
+		v.Sections = append(v.Sections, connectors.ViewSection{Heading: e.Heading, Text: e.Text, Anchor: e.Anchor})
+	}
+	return v, nil
+}
@@ -0,0 +1,237 @@
+// Package corpus keeps content imported from export archives, such as a
+// Slack workspace export, so it stays searchable after the source is gone.
+//
+// An import is saved as a corpus of items, such as channels or pages, each
+// made of entries, such as messages, in the order they are read. Entries
+// are indexed for search when the corpus is saved; the corpus connector
+// searches them and serves each item as a page of pkb serve, with a
+// section per entry.
+package corpus
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+)
+
+// Info describes an import.
+type Info struct {
+	// Kind names the format imported, such as slack-export.
+	Kind string
+	// Origin is the archive the corpus was imported from.
+	Origin   string
+	Imported time.Time
+}
+
+// Corpus is the content of an import.
+type Corpus struct {
+	Info
+	Items []Item
+}
+
+// Item is a page of the corpus, such as a channel or a document.
+type Item struct {
+	// ID identifies the item in its corpus. It must not contain "#".
+	ID     string
+	Title  string
+	Fields []connectors.ViewField
+	// Entries are the parts of the item found by searches. An item with
+	// a single entry, such as a page, is searched whole.
+	Entries []Entry
+}
+
+// Entry is a searchable part of an item, such as a message.
+type Entry struct {
+	// Anchor identifies the entry in its item and is the fragment of the
+	// URL a result links to. It may be empty when the item has one entry.
+	Anchor string
+	// Heading and Text are the entry's section of the item's page.
+	Heading string
+	Text    string
+	// The rest describe the entry's search results, which link to the
+	// entry on its item's page unless URL is set.
+	URL        string
+	Title      string
+	Author     string
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	MimeType   string
+	Metadata   map[string]string
+	// Unlisted entries are shown on their item's page but not searched,
+	// as when they repeat another item.
+	Unlisted bool
+}
+
+// Len returns the number of entries in c.
+func (c *Corpus) Len() int {
+	n := 0
+	for _, it := range c.Items {
+		n += len(it.Entries)
+	}
+	return n
+}
+
+// nameRE matches the names imports can be saved under, which are also the
+// names of their sources.
+var nameRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidName reports whether name can name an import.
+func ValidName(name string) bool {
+	return nameRE.MatchString(name)
+}
+
+func corpusPath(dir, name string) string {
+	return filepath.Join(dir, name+".gob")
+}
+
+func indexPath(dir, name string) string {
+	return filepath.Join(dir, name+".index")
+}
+
+// Save stores c in dir as the import called name, with an index of its
+// entries, replacing any earlier import of that name.
+func Save(dir, name string, c *Corpus) error {
+	if !ValidName(name) {
+		return fmt.Errorf("invalid import name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	ix, err := index.Open(indexPath(dir, name))
+	if err != nil {
+		return err
+	}
+	for _, id := range ix.IDs(name) {
+		ix.Delete(name, id)
+	}
+	seen := map[string]bool{}
+	for _, it := range c.Items {
+		if it.ID == "" || strings.Contains(it.ID, "#") {
+			return fmt.Errorf("invalid item ID %q", it.ID)
+		}
+		if seen[it.ID] {
+			return fmt.Errorf("duplicate item ID %q", it.ID)
+		}
+		seen[it.ID] = true
+		for _, e := range it.Entries {
+			if !e.Unlisted {
+				ix.Put(document(name, it, e))
+			}
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("save import: %w", err)
+	}
+	f, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("save import: %w", err)
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+	// The Info comes first, so ReadInfo need not decode the items.
+	enc := gob.NewEncoder(f)
+	if err := enc.Encode(c.Info); err != nil {
+		f.Close()
+		return fmt.Errorf("save import: %w", err)
+	}
+	if err := enc.Encode(c.Items); err != nil {
+		f.Close()
+		return fmt.Errorf("save import: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("save import: %w", err)
+	}
+	if err := ix.Save(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), corpusPath(dir, name)); err != nil {
+		return fmt.Errorf("save import: %w", err)
+	}
+	return nil
+}
+
+// document converts an entry to the form stored in the index. Its ID is
+// the item's ID and the entry's anchor, joined by "#".
+func document(source string, it Item, e Entry) connectors.Document {
+	id := it.ID
+	if e.Anchor != "" {
+		id += "#" + e.Anchor
+	}
+	title := e.Title
+	if title == "" {
+		title = it.Title
+	}
+	return connectors.Document{
+		Result: connectors.Result{
+			Title:      title,
+			URL:        e.URL,
+			Source:     source,
+			ID:         id,
+			CreatedAt:  e.CreatedAt,
+			ModifiedAt: e.ModifiedAt,
+			Author:     e.Author,
+			MimeType:   e.MimeType,
+			Metadata:   e.Metadata,
+		},
+		Body: e.Text,
+	}
+}
+
+// ReadInfo reads the description of the import called name in dir. It
+// returns an error wrapping fs.ErrNotExist when there is none.
+func ReadInfo(dir, name string) (Info, error) {
+	f, err := os.Open(corpusPath(dir, name))
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+	var info Info
+	if err := gob.NewDecoder(f).Decode(&info); err != nil {
+		return Info{}, fmt.Errorf("read import %s: %w", f.Name(), err)
+	}
+	return info, nil
+}
+
+// Load reads the import called name in dir.
+func Load(dir, name string) (*Corpus, error) {
+	f, err := os.Open(corpusPath(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := gob.NewDecoder(f)
+	var c Corpus
+	if err := dec.Decode(&c.Info); err != nil {
+		return nil, fmt.Errorf("read import %s: %w", f.Name(), err)
+	}
+	if err := dec.Decode(&c.Items); err != nil {
+		return nil, fmt.Errorf("read import %s: %w", f.Name(), err)
+	}
+	return &c, nil
+}
+
+// List returns the names of the imports in dir, sorted.
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".gob"); ok && !e.IsDir() && ValidName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
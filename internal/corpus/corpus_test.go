@@ -0,0 +1,181 @@
+package corpus
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const baseURL = "http://localhost:8080"
+
+var posted = time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC)
+
+func testCorpus() *Corpus {
+	return &Corpus{
+		Info: Info{Kind: "slack-export", Origin: "/exports/acme.zip", Imported: posted},
+		Items: []Item{
+			{
+				ID:     "general",
+				Title:  "#general",
+				Fields: []connectors.ViewField{{Name: "Topic", Value: "Company news"}},
+				Entries: []Entry{
+					{Anchor: "p1", Heading: "Alice · 5 Mar", Text: "The offsite is in Lyon this year.", Title: "The offsite is in Lyon", Author: "Alice",
+						CreatedAt: posted, ModifiedAt: posted, MimeType: "application/vnd.slack.message", Metadata: map[string]string{"channel": "general"}},
+					{Anchor: "p2", Heading: "Bob · 5 Mar", Text: "Booked the train.", Author: "Bob", CreatedAt: posted.Add(time.Hour), ModifiedAt: posted.Add(time.Hour)},
+					{Anchor: "p3", Heading: "Bob · 5 Mar", Text: "Lyon hotel list", Unlisted: true},
+				},
+			},
+			{ID: "handbook", Title: "Handbook", Entries: []Entry{{Text: "Expenses are filed monthly."}}},
+			{ID: "bookmark", Title: "Travel policy", Entries: []Entry{{Text: "Rules for reimbursing flights", URL: "https://example.com/travel"}}},
+		},
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, Save(dir, "acme", testCorpus()))
+
+	c, err := Load(dir, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, testCorpus(), c)
+	assert.Equal(t, 5, c.Len())
+
+	info, err := ReadInfo(dir, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, testCorpus().Info, info)
+
+	names, err := List(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme"}, names)
+}
+
+func TestSave_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.EqualError(t, Save(dir, "../acme", testCorpus()), `invalid import name "../acme": use letters, digits, '.', '_' and '-'`)
+	assert.EqualError(t, Save(dir, "acme", &Corpus{Items: []Item{{ID: "a#b"}}}), `invalid item ID "a#b"`)
+	assert.EqualError(t, Save(dir, "acme", &Corpus{Items: []Item{{ID: "a"}, {ID: "a"}}}), `duplicate item ID "a"`)
+	names, err := List(dir)
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestReadInfo_Missing(t *testing.T) {
+	_, err := ReadInfo(t.TempDir(), "acme")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	names, err := List(filepath.Join(t.TempDir(), "imports"))
+	require.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestConnector_Search(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, Save(dir, "acme", testCorpus()))
+	c := NewConnector(dir, "acme", baseURL).WithName("old-slack")
+
+	page, err := c.Search(context.Background(), connectors.Request{Query: "lyon"})
+
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1, "unlisted entries are not searched")
+	assert.Equal(t, connectors.Result{
+		Title:      "The offsite is in Lyon",
+		Snippet:    "The offsite is in Lyon this year.",
+		URL:        baseURL + "/view/old-slack/general#p1",
+		Source:     "old-slack",
+		ID:         "general#p1",
+		CreatedAt:  posted,
+		ModifiedAt: posted,
+		Author:     "Alice",
+		MimeType:   "application/vnd.slack.message",
+		Metadata:   map[string]string{"channel": "general"},
+	}, page.Results[0])
+
+	page, err = c.Search(context.Background(), connectors.Request{Query: "expenses"})
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "Handbook", page.Results[0].Title, "entries without a title take their item's")
+	assert.Equal(t, baseURL+"/view/old-slack/handbook", page.Results[0].URL)
+
+	page, err = c.Search(context.Background(), connectors.Request{Query: "reimbursing"})
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "https://example.com/travel", page.Results[0].URL, "entries with a URL link to it")
+}
+
+func TestConnector_Search_Reimported(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, Save(dir, "acme", testCorpus()))
+	c := NewConnector(dir, "acme", baseURL)
+	page, err := c.Search(context.Background(), connectors.Request{Query: "train"})
+	require.NoError(t, err)
+	assert.Len(t, page.Results, 1)
+
+	// Index files are told apart by modification time and size.
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, Save(dir, "acme", &Corpus{Items: []Item{{ID: "x", Title: "Only item", Entries: []Entry{{Text: "Nothing else"}}}}}))
+
+	page, err = c.Search(context.Background(), connectors.Request{Query: "train"})
+	require.NoError(t, err)
+	assert.Empty(t, page.Results)
+	v, err := c.View(context.Background(), "x")
+	require.NoError(t, err)
+	assert.Equal(t, "Only item", v.Title)
+}
+
+func TestConnector_Search_Paging(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, Save(dir, "acme", testCorpus()))
+	c := NewConnector(dir, "acme", baseURL)
+
+	page, err := c.Search(context.Background(), connectors.Request{Query: "", Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, page.Results, 2)
+	assert.Equal(t, "2", page.NextCursor)
+
+	_, err = c.Search(context.Background(), connectors.Request{Cursor: "x"})
+	assert.EqualError(t, err, `invalid import cursor "x"`)
+}
+
+func TestConnector_Search_Missing(t *testing.T) {
+	_, err := NewConnector(t.TempDir(), "acme", baseURL).Search(context.Background(), connectors.Request{Query: "lyon"})
+	assert.ErrorContains(t, err, "import acme: stat ")
+}
+
+func TestConnector_View(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, Save(dir, "acme", testCorpus()))
+	c := NewConnector(dir, "acme", baseURL)
+
+	v, err := c.View(context.Background(), "general")
+
+	require.NoError(t, err)
+	assert.Equal(t, connectors.View{
+		Title:  "#general",
+		Fields: []connectors.ViewField{{Name: "Topic", Value: "Company news"}},
+		Sections: []connectors.ViewSection{
+			{Heading: "Alice · 5 Mar", Text: "The offsite is in Lyon this year.", Anchor: "p1"},
+			{Heading: "Bob · 5 Mar", Text: "Booked the train.", Anchor: "p2"},
+			{Heading: "Bob · 5 Mar", Text: "Lyon hotel list", Anchor: "p3"},
+		},
+	}, v)
+
+	_, err = c.View(context.Background(), "random")
+	assert.ErrorIs(t, err, connectors.ErrNotFound)
+	_, err = NewConnector(dir, "other", baseURL).View(context.Background(), "general")
+	assert.ErrorIs(t, err, connectors.ErrNotFound)
+}
+
+func TestConnector_Explain(t *testing.T) {
+	exp, err := NewConnector(t.TempDir(), "acme", baseURL).Explain(connectors.Request{Query: "offsite plans"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "offsit plan", exp.Query)
+	assert.Equal(t, map[string]string{"import": "acme", "limit": "20"}, exp.Params)
+}
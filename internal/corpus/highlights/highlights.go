@@ -0,0 +1,348 @@
+// Package highlights reads book highlights and read-later lists: the My
+// Clippings.txt file Kindles keep, and the HTML and CSV exports of Pocket
+// and Instapaper. Each book or article becomes an item whose entries are
+// its highlights and notes, so results are found through the document they
+// come from and link to a page of all its highlights.
+package highlights
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus"
+)
+
+// Kind names the format in imports and connector types.
+const Kind = "highlights"
+
+const (
+	mimeTypeHighlight = "application/vnd.pkb.highlight"
+	// mimeTypeArticle is the type of a saved article's own entry, which
+	// is searched as a bookmark.
+	mimeTypeArticle = "text/uri-list"
+	// dateLayout is how dates are shown on document pages.
+	dateLayout = "Mon, 2 Jan 2006 15:04"
+)
+
+// document is a book or article, with its highlights.
+type document struct {
+	id     string
+	title  string
+	author string
+	// source names where the document was read, such as Kindle or Pocket.
+	source string
+	// url, folder, tags and saved describe saved articles.
+	url    string
+	folder string
+	tags   []string
+	saved  time.Time
+
+	highlights []highlight
+}
+
+// highlight is a highlight, note or bookmark in a document.
+type highlight struct {
+	// kind is highlight or note.
+	kind     string
+	text     string
+	page     string
+	location span
+	added    time.Time
+}
+
+// span is a range of Kindle locations. The zero span is unknown.
+type span struct {
+	start, end int
+}
+
+func (s span) String() string {
+	switch {
+	case s.start == 0:
+		return ""
+	case s.end == s.start:
+		return strconv.Itoa(s.start)
+	}
+	return strconv.Itoa(s.start) + "-" + strconv.Itoa(s.end)
+}
+
+// overlaps reports whether s and o share a location, or either is unknown.
+func (s span) overlaps(o span) bool {
+	return s.start == 0 || o.start == 0 || (s.start <= o.end && o.start <= s.end)
+}
+
+// add adds h to d unless it repeats one d has. Kindles add a clipping each
+// time a highlight is changed, so a highlight whose text contains, or is
+// contained in, another at an overlapping location of the same document
+// replaces it, keeping the longer text and the later date.
+func (d *document) add(h highlight) {
+	for i, old := range d.highlights {
+		if old.kind != h.kind || !old.location.overlaps(h.location) {
+			continue
+		}
+		if !strings.Contains(old.text, h.text) && !strings.Contains(h.text, old.text) {
+			continue
+		}
+		if len(h.text) > len(old.text) {
+			old.text, old.page, old.location = h.text, h.page, h.location
+		}
+		if h.added.After(old.added) {
+			old.added = h.added
+		}
+		d.highlights[i] = old
+		return
+	}
+	d.highlights = append(d.highlights, h)
+}
+
+// collection gathers the documents read from one or more files, in the
+// order they are first seen.
+type collection struct {
+	docs  []*document
+	byKey map[string]*document
+}
+
+// document returns the document with the given key, adding it with
+// newDoc's result if there is none yet.
+func (c *collection) document(key string, newDoc func() *document) *document {
+	if d, ok := c.byKey[key]; ok {
+		return d
+	}
+	if c.byKey == nil {
+		c.byKey = map[string]*document{}
+	}
+	d := newDoc()
+	d.id = docID(key)
+	c.byKey[key] = d
+	c.docs = append(c.docs, d)
+	return d
+}
+
+// docID derives a stable item ID from a document's key.
+func docID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Read reads path: a My Clippings.txt file, a Pocket or Instapaper HTML
+// or CSV export, or a ZIP file or directory holding any of those.
+func Read(path string) (*corpus.Corpus, error) {
+	var c collection
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() && !strings.EqualFold(filepath.Ext(path), ".zip") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.readFile(filepath.Base(path), data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	} else if err := c.readArchive(path); err != nil {
+		return nil, err
+	}
+	return &corpus.Corpus{Info: corpus.Info{Kind: Kind, Origin: path}, Items: c.items()}, nil
+}
+
+// readArchive reads every file of a known format in a ZIP file or
+// directory, and fails if there is none.
+func (c *collection) readArchive(name string) error {
+	fsys, closeArchive, err := corpus.OpenArchive(name)
+	if err != nil {
+		return err
+	}
+	defer closeArchive()
+	found := false
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || format(p) == nil {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		if !recognized(p, data) {
+			return nil
+		}
+		found = true
+		if err := c.readFile(p, data); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if !found {
+		return fmt.Errorf("%s: no Kindle clippings, Pocket or Instapaper export found", name)
+	}
+	return nil
+}
+
+// format returns the reader for a file, by its extension, or nil.
+func format(name string) func(*collection, []byte) error {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".txt":
+		return (*collection).readClippings
+	case ".html", ".htm":
+		return (*collection).readReadLaterHTML
+	case ".csv":
+		return (*collection).readReadLaterCSV
+	}
+	return nil
+}
+
+// recognized reports whether a file in an archive looks like one of the
+// formats, so that other files with the same extensions are skipped.
+func recognized(name string, data []byte) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".txt":
+		return bytes.Contains(data, []byte(clippingSeparator))
+	case ".csv":
+		_, err := csvFormat(data)
+		return err == nil
+	}
+	return readLaterSource(data) != ""
+}
+
+func (c *collection) readFile(name string, data []byte) error {
+	read := format(name)
+	if read == nil {
+		return fmt.Errorf("unknown format: want My Clippings.txt, or a Pocket or Instapaper .html or .csv export")
+	}
+	return read(c, data)
+}
+
+// items converts the documents read.
+func (c *collection) items() []corpus.Item {
+	items := make([]corpus.Item, 0, len(c.docs))
+	for _, d := range c.docs {
+		items = append(items, d.item())
+	}
+	return items
+}
+
+func (d *document) item() corpus.Item {
+	it := corpus.Item{ID: d.id, Title: d.title}
+	var last time.Time
+	for _, h := range d.highlights {
+		if h.added.After(last) {
+			last = h.added
+		}
+	}
+	for _, f := range []connectors.ViewField{
+		{Name: "Author", Value: d.author},
+		{Name: "URL", Value: d.url},
+		{Name: "Source", Value: d.source},
+		{Name: "Folder", Value: d.folder},
+		{Name: "Tags", Value: strings.Join(d.tags, ", ")},
+		{Name: "Saved", Value: formatTime(d.saved)},
+		{Name: "Highlights", Value: countOrEmpty(len(d.highlights))},
+		{Name: "Last highlighted", Value: formatTime(last)},
+	} {
+		if f.Value != "" {
+			it.Fields = append(it.Fields, f)
+		}
+	}
+
+	if d.url != "" {
+		// A saved article is found by its title and tags, and its result
+		// links to the article.
+		text := d.url
+		if len(d.tags) > 0 {
+			text += "\nTags: " + strings.Join(d.tags, ", ")
+		}
+		e := corpus.Entry{
+			Heading:    "Saved" + prefixed(" · ", formatTime(d.saved)),
+			Text:       text,
+			URL:        d.url,
+			Author:     d.author,
+			CreatedAt:  d.saved,
+			ModifiedAt: d.saved,
+			MimeType:   mimeTypeArticle,
+			Metadata:   d.metadata(),
+		}
+		if d.folder != "" {
+			e.Metadata["folder"] = d.folder
+		}
+		if len(d.tags) > 0 {
+			e.Metadata["tags"] = strings.Join(d.tags, ",")
+		}
+		it.Entries = append(it.Entries, e)
+	}
+	for i, h := range d.highlights {
+		added := h.added
+		if added.IsZero() {
+			added = d.saved
+		}
+		heading := strings.ToUpper(h.kind[:1]) + h.kind[1:]
+		if h.page != "" {
+			heading += " · page " + h.page
+		}
+		if loc := h.location.String(); loc != "" {
+			heading += " · location " + loc
+		}
+		heading += prefixed(" · ", formatTime(added))
+		e := corpus.Entry{
+			Anchor:     "h" + strconv.Itoa(i+1),
+			Heading:    heading,
+			Text:       h.text,
+			Author:     d.author,
+			CreatedAt:  added,
+			ModifiedAt: added,
+			MimeType:   mimeTypeHighlight,
+			Metadata:   d.metadata(),
+		}
+		e.Metadata["kind"] = h.kind
+		if h.page != "" {
+			e.Metadata["page"] = h.page
+		}
+		if loc := h.location.String(); loc != "" {
+			e.Metadata["location"] = loc
+		}
+		it.Entries = append(it.Entries, e)
+	}
+	return it
+}
+
+// metadata describes the document on each of its entries' results.
+func (d *document) metadata() map[string]string {
+	md := map[string]string{"document": d.title, "source": d.source}
+	if d.url != "" {
+		md["url"] = d.url
+	}
+	return md
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(dateLayout)
+}
+
+func countOrEmpty(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// prefixed returns s after prefix, or "" if s is empty.
+func prefixed(prefix, s string) string {
+	if s == "" {
+		return ""
+	}
+	return prefix + s
+}
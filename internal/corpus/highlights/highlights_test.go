@@ -0,0 +1,214 @@
+package highlights
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clippings has a highlight that was extended (so Kindle clipped it twice),
+// a clipping repeated verbatim, a note, a bookmark and, from an older
+// Kindle, a highlight in another book.
+const clippings = "\ufeffThe Pragmatic Programmer (Hunt, Andrew;Thomas, David)\r\n" +
+	"- Your Highlight on page 12 | Location 180-181 | Added on Tuesday, March 5, 2024 9:30:15 AM\r\n\r\n" +
+	"Care about your craft.\r\n" +
+	"==========\r\n" +
+	"\ufeffThe Pragmatic Programmer (Hunt, Andrew;Thomas, David)\r\n" +
+	"- Your Highlight on page 12 | Location 180-182 | Added on Tuesday, March 5, 2024 9:31:00 AM\r\n\r\n" +
+	"Care about your craft. Think about your work.\r\n" +
+	"==========\r\n" +
+	"\ufeffThe Pragmatic Programmer (Hunt, Andrew;Thomas, David)\r\n" +
+	"- Your Note on page 12 | Location 182 | Added on Tuesday, March 5, 2024 9:32:00 AM\r\n\r\n" +
+	"Quote this in the onboarding doc\r\n" +
+	"==========\r\n" +
+	"\ufeffThe Pragmatic Programmer (Hunt, Andrew;Thomas, David)\r\n" +
+	"- Your Note on page 12 | Location 182 | Added on Tuesday, March 5, 2024 9:32:00 AM\r\n\r\n" +
+	"Quote this in the onboarding doc\r\n" +
+	"==========\r\n" +
+	"\ufeffThe Pragmatic Programmer (Hunt, Andrew;Thomas, David)\r\n" +
+	"- Your Bookmark on page 40 | Location 610 | Added on Wednesday, March 6, 2024 8:00:00 PM\r\n\r\n\r\n" +
+	"==========\r\n" +
+	"Thinking, Fast and Slow (Daniel Kahneman)\r\n" +
+	"- Highlight Loc. 1020-24  | Added on Sunday, 12 May 2013 21:05:00\r\n\r\n" +
+	"Nothing in life is as important as you think it is, while you are thinking about it.\r\n" +
+	"==========\r\n"
+
+const pocketHTML = `<!DOCTYPE html>
+<html><head><title>Pocket Export</title></head><body>
+<h1>Unread</h1>
+<ul>
+<li><a href="https://example.com/postgres-vacuum" time_added="1709630400" tags="databases,ops">Tuning Postgres autovacuum</a></li>
+</ul>
+<h1>Read Archive</h1>
+<ul>
+<li><a href="https://example.com/go-errors" time_added="1709716800" tags="">Working with errors in Go</a></li>
+</ul>
+</body></html>`
+
+const instapaperCSV = "URL,Title,Selection,Folder,Timestamp\n" +
+	"https://EXAMPLE.com/postgres-vacuum/,Tuning Postgres autovacuum,Raise the cost limit before adding workers.,Archive,1709800000\n" +
+	"https://example.com/queues,Queues don't fix overload,,Unread,1709900000\n"
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestRead_Clippings(t *testing.T) {
+	c, err := Read(writeFile(t, "My Clippings.txt", clippings))
+
+	require.NoError(t, err)
+	assert.Equal(t, Kind, c.Kind)
+	require.Len(t, c.Items, 2)
+
+	book := c.Items[0]
+	assert.Equal(t, "The Pragmatic Programmer", book.Title)
+	assert.Equal(t, []connectors.ViewField{
+		{Name: "Author", Value: "Hunt, Andrew;Thomas, David"},
+		{Name: "Source", Value: "Kindle"},
+		{Name: "Highlights", Value: "2"},
+		{Name: "Last highlighted", Value: "Tue, 5 Mar 2024 09:32"},
+	}, book.Fields)
+	require.Len(t, book.Entries, 2, "the extended highlight and the repeated note are kept once, the bookmark not at all")
+	added := time.Date(2024, 3, 5, 9, 31, 0, 0, time.Local)
+	assert.Equal(t, corpus.Entry{
+		Anchor:     "h1",
+		Heading:    "Highlight · page 12 · location 180-182 · Tue, 5 Mar 2024 09:31",
+		Text:       "Care about your craft. Think about your work.",
+		Author:     "Hunt, Andrew;Thomas, David",
+		CreatedAt:  added,
+		ModifiedAt: added,
+		MimeType:   "application/vnd.pkb.highlight",
+		Metadata: map[string]string{
+			"document": "The Pragmatic Programmer", "source": "Kindle", "kind": "highlight", "page": "12", "location": "180-182",
+		},
+	}, book.Entries[0])
+	assert.Equal(t, "Note · page 12 · location 182 · Tue, 5 Mar 2024 09:32", book.Entries[1].Heading)
+	assert.Equal(t, "Quote this in the onboarding doc", book.Entries[1].Text)
+
+	old := c.Items[1]
+	assert.Equal(t, "Thinking, Fast and Slow", old.Title)
+	require.Len(t, old.Entries, 1)
+	assert.Equal(t, "1020-1024", old.Entries[0].Metadata["location"])
+	assert.Equal(t, time.Date(2013, 5, 12, 21, 5, 0, 0, time.Local), old.Entries[0].CreatedAt)
+	assert.NotEqual(t, book.ID, old.ID)
+}
+
+func TestRead_PocketHTML(t *testing.T) {
+	c, err := Read(writeFile(t, "ril_export.html", pocketHTML))
+
+	require.NoError(t, err)
+	require.Len(t, c.Items, 2)
+	it := c.Items[0]
+	assert.Equal(t, "Tuning Postgres autovacuum", it.Title)
+	assert.Equal(t, []connectors.ViewField{
+		{Name: "URL", Value: "https://example.com/postgres-vacuum"},
+		{Name: "Source", Value: "Pocket"},
+		{Name: "Folder", Value: "Unread"},
+		{Name: "Tags", Value: "databases, ops"},
+		{Name: "Saved", Value: "Tue, 5 Mar 2024 09:20"},
+	}, it.Fields)
+	require.Len(t, it.Entries, 1)
+	saved := time.Date(2024, 3, 5, 9, 20, 0, 0, time.UTC)
+	assert.Equal(t, corpus.Entry{
+		Heading:    "Saved · Tue, 5 Mar 2024 09:20",
+		Text:       "https://example.com/postgres-vacuum\nTags: databases, ops",
+		URL:        "https://example.com/postgres-vacuum",
+		CreatedAt:  saved,
+		ModifiedAt: saved,
+		MimeType:   "text/uri-list",
+		Metadata: map[string]string{
+			"document": "Tuning Postgres autovacuum", "source": "Pocket", "url": "https://example.com/postgres-vacuum",
+			"folder": "Unread", "tags": "databases,ops",
+		},
+	}, it.Entries[0])
+	assert.Equal(t, "Read Archive", c.Items[1].Fields[2].Value)
+}
+
+func TestRead_PocketCSV(t *testing.T) {
+	c, err := Read(writeFile(t, "part_000000.csv", "title,url,time_added,tags,status\n"+
+		"Tuning Postgres autovacuum,https://example.com/postgres-vacuum,1709630400,databases|ops,unread\n"))
+
+	require.NoError(t, err)
+	require.Len(t, c.Items, 1)
+	assert.Equal(t, "databases,ops", c.Items[0].Entries[0].Metadata["tags"])
+	assert.Equal(t, "unread", c.Items[0].Entries[0].Metadata["folder"])
+}
+
+func TestRead_ArchiveMergesArticles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exports.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{
+		"pocket/ril_export.html":       pocketHTML,
+		"instapaper/instapaper.csv":    instapaperCSV,
+		"kindle/My Clippings.txt":      clippings,
+		"kindle/README.txt":            "Copied from the Kindle's documents folder.",
+		"instapaper/reading-stats.csv": "day,minutes\n2024-03-05,20\n",
+	} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	c, err := Read(path)
+
+	require.NoError(t, err)
+	titles := make([]string, len(c.Items))
+	for i, it := range c.Items {
+		titles[i] = it.Title
+	}
+	assert.ElementsMatch(t, []string{
+		"Queues don't fix overload", "The Pragmatic Programmer", "Thinking, Fast and Slow",
+		"Tuning Postgres autovacuum", "Working with errors in Go",
+	}, titles, "an article saved in both services is read once")
+	for _, it := range c.Items {
+		if it.Title != "Tuning Postgres autovacuum" {
+			continue
+		}
+		require.Len(t, it.Entries, 2)
+		assert.Equal(t, "h1", it.Entries[1].Anchor)
+		assert.Equal(t, "Raise the cost limit before adding workers.", it.Entries[1].Text)
+		assert.Equal(t, "https://EXAMPLE.com/postgres-vacuum/", it.Entries[1].Metadata["url"], "as first read, from Instapaper")
+		assert.Equal(t, "", it.Entries[1].URL, "highlights link to their document's page")
+	}
+}
+
+func TestRead_Unrecognized(t *testing.T) {
+	_, err := Read(writeFile(t, "notes.txt", "just some notes"))
+	assert.ErrorContains(t, err, "not a Kindle clippings file")
+
+	_, err = Read(writeFile(t, "export.html", "<html><a href='https://example.com'>x</a></html>"))
+	assert.ErrorContains(t, err, "not a Pocket or Instapaper export")
+
+	_, err = Read(writeFile(t, "stats.csv", "day,minutes\n"))
+	assert.ErrorContains(t, err, "not a Pocket or Instapaper export: unknown columns day, minutes")
+
+	_, err = Read(writeFile(t, "export.json", "{}"))
+	assert.ErrorContains(t, err, "unknown format")
+
+	dir := t.TempDir()
+	_, err = Read(dir)
+	assert.EqualError(t, err, dir+": no Kindle clippings, Pocket or Instapaper export found")
+}
+
+func TestParseSpan(t *testing.T) {
+	assert.Equal(t, span{180, 182}, parseSpan("180", "182"))
+	assert.Equal(t, span{1020, 1024}, parseSpan("1020", "24"))
+	assert.Equal(t, span{610, 610}, parseSpan("610", ""))
+	assert.True(t, span{180, 182}.overlaps(span{182, 190}))
+	assert.False(t, span{180, 182}.overlaps(span{183, 190}))
+}
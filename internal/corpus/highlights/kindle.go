@@ -0,0 +1,117 @@
+package highlights
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clippingSeparator ends each clipping in My Clippings.txt.
+const clippingSeparator = "=========="
+
+var (
+	// authorRE splits a clipping's first line into the book's title and,
+	// in the last parentheses, its author.
+	authorRE = regexp.MustCompile(`^(.*\S)\s*\(([^()]*)\)$`)
+	pageRE   = regexp.MustCompile(`(?i)\bpage (\S+)`)
+	// locationRE matches locations as current Kindles write them
+	// ("Location 180-182") and as older ones did ("Loc. 180-82").
+	locationRE = regexp.MustCompile(`(?i)\b(?:location|loc\.) (\d+)(?:-(\d+))?`)
+)
+
+// addedLayouts are the formats of a clipping's "Added on" date, in the
+// US and UK styles of current and older Kindles. Kindles write the local
+// time, without a zone.
+var addedLayouts = []string{
+	"Monday, January 2, 2006 3:04:05 PM",
+	"Monday, January 2, 2006, 03:04 PM",
+	"Monday, January 2, 2006 3:04 PM",
+	"Monday, 2 January 2006 15:04:05",
+	"Monday, 2 January 2006 15:04",
+}
+
+// readClippings reads a Kindle's My Clippings.txt. Each clipping is the
+// book's title and author, a line describing the clipping, a blank line
+// and the clipped text, followed by a line of "=". Bookmarks, which have
+// no text, are left out.
+func (c *collection) readClippings(data []byte) error {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if !strings.Contains(text, clippingSeparator) {
+		return errors.New("not a Kindle clippings file: no " + clippingSeparator + " separators")
+	}
+	for _, clip := range strings.Split(text, clippingSeparator) {
+		lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(clip, "\ufeff", "")), "\n")
+		if len(lines) < 2 || !strings.HasPrefix(lines[1], "- ") {
+			continue
+		}
+		kind, page, location, added := parseClippingInfo(lines[1])
+		body := strings.TrimSpace(strings.Join(lines[2:], "\n"))
+		if kind == "" || body == "" {
+			continue
+		}
+		title, author := strings.TrimSpace(lines[0]), ""
+		if m := authorRE.FindStringSubmatch(title); m != nil {
+			title, author = m[1], strings.TrimSpace(m[2])
+		}
+		d := c.document("kindle\x00"+title+"\x00"+author, func() *document {
+			return &document{title: title, author: author, source: "Kindle"}
+		})
+		d.add(highlight{kind: kind, text: body, page: page, location: location, added: added})
+	}
+	return nil
+}
+
+// parseClippingInfo reads the line describing a clipping, such as
+// "- Your Highlight on page 12 | Location 180-182 | Added on Tuesday,
+// March 5, 2024 9:30:15 AM". Its kind is "" for bookmarks and other
+// clippings without text.
+func parseClippingInfo(line string) (kind, page string, location span, added time.Time) {
+	for i, part := range strings.Split(strings.TrimPrefix(line, "- "), "|") {
+		part = strings.TrimSpace(part)
+		if i == 0 {
+			switch lower := strings.ToLower(part); {
+			case strings.Contains(lower, "highlight"):
+				kind = "highlight"
+			case strings.Contains(lower, "note"):
+				kind = "note"
+			}
+		}
+		if m := pageRE.FindStringSubmatch(part); m != nil {
+			page = m[1]
+		}
+		if m := locationRE.FindStringSubmatch(part); m != nil {
+			location = parseSpan(m[1], m[2])
+		}
+		if date, ok := strings.CutPrefix(part, "Added on "); ok {
+			added = parseAdded(date)
+		}
+	}
+	return kind, page, location, added
+}
+
+// parseSpan converts a range of locations. Older Kindles shorten the end
+// to the digits that differ from the start, as in 180-82.
+func parseSpan(start, end string) span {
+	if end == "" {
+		end = start
+	} else if len(end) < len(start) {
+		end = start[:len(start)-len(end)] + end
+	}
+	s, _ := strconv.Atoi(start)
+	e, _ := strconv.Atoi(end)
+	if e < s {
+		e = s
+	}
+	return span{s, e}
+}
+
+func parseAdded(s string) time.Time {
+	for _, layout := range addedLayouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(s), time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
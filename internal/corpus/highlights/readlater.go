@@ -0,0 +1,235 @@
+package highlights
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// readLaterSource names the service an HTML export comes from, or returns
+// "" if it is neither Pocket's, whose links carry when they were added,
+// nor Instapaper's, which says so in its title.
+func readLaterSource(data []byte) string {
+	switch {
+	case bytes.Contains(data, []byte("time_added=")):
+		return "Pocket"
+	case bytes.Contains(bytes.ToLower(data), []byte("<title>instapaper")):
+		return "Instapaper"
+	}
+	return ""
+}
+
+// readReadLaterHTML reads the HTML export of Pocket or Instapaper: a
+// heading per folder, such as Unread or Archive, followed by a list of
+// links to the articles in it.
+func (c *collection) readReadLaterHTML(data []byte) error {
+	source := readLaterSource(data)
+	if source == "" {
+		return errors.New("not a Pocket or Instapaper export")
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	var folder string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.H1, atom.H2:
+				folder = strings.TrimSpace(nodeText(n))
+				return
+			case atom.A:
+				a := article{source: source, folder: folder, title: strings.TrimSpace(nodeText(n))}
+				for _, attr := range n.Attr {
+					switch attr.Key {
+					case "href":
+						a.url = attr.Val
+					case "time_added":
+						a.saved = unixTime(attr.Val)
+					case "tags":
+						a.tags = splitTags(attr.Val, ",")
+					}
+				}
+				c.addArticle(a)
+				return
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return nil
+}
+
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(nodeText(child))
+	}
+	return b.String()
+}
+
+var bom = []byte("\ufeff")
+
+// csvColumns are the columns of the CSV exports, by service: Pocket's
+// title, url, time_added, tags and status, and Instapaper's URL, Title,
+// Selection, Folder and Timestamp.
+var csvColumns = map[string][]string{
+	"Pocket":     {"title", "url", "time_added"},
+	"Instapaper": {"url", "title", "selection", "folder", "timestamp"},
+}
+
+// csvFormat returns the service a CSV export comes from, by its header.
+func csvFormat(data []byte) (string, error) {
+	header, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, bom))).Read()
+	if err != nil {
+		return "", err
+	}
+	cols := columns(header)
+	for _, source := range []string{"Pocket", "Instapaper"} {
+		matches := true
+		for _, name := range csvColumns[source] {
+			if _, ok := cols[name]; !ok {
+				matches = false
+			}
+		}
+		if matches {
+			return source, nil
+		}
+	}
+	return "", errors.New("not a Pocket or Instapaper export: unknown columns " + strings.Join(header, ", "))
+}
+
+// columns maps the lower-cased names in a CSV header to their positions.
+func columns(header []string) map[string]int {
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	return cols
+}
+
+// readReadLaterCSV reads the CSV export of Pocket or Instapaper. An
+// Instapaper row's selection, the text highlighted when the article was
+// saved, becomes its highlight.
+func (c *collection) readReadLaterCSV(data []byte) error {
+	source, err := csvFormat(data)
+	if err != nil {
+		return err
+	}
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, bom)))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	cols := columns(records[0])
+	for line, row := range records[1:] {
+		get := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		a := article{source: source, title: get("title"), url: get("url")}
+		if a.url == "" {
+			return fmt.Errorf("line %d: no URL", line+2)
+		}
+		switch source {
+		case "Pocket":
+			a.saved = unixTime(get("time_added"))
+			a.tags = splitTags(get("tags"), "|")
+			a.folder = get("status")
+		case "Instapaper":
+			a.saved = unixTime(get("timestamp"))
+			a.tags = splitTags(strings.Trim(get("tags"), "[]"), ",")
+			a.folder = get("folder")
+			a.selection = get("selection")
+		}
+		c.addArticle(a)
+	}
+	return nil
+}
+
+// article is an article in a read-later export.
+type article struct {
+	source, title, url, folder string
+	tags                       []string
+	saved                      time.Time
+	selection                  string
+}
+
+// addArticle adds an article, once per URL across the files read.
+func (c *collection) addArticle(a article) {
+	if a.url == "" {
+		return
+	}
+	d := c.document("article\x00"+normalizeURL(a.url), func() *document {
+		return &document{source: a.source, url: a.url}
+	})
+	if d.title == "" || d.title == d.url {
+		d.title = a.title
+	}
+	if d.title == "" {
+		d.title = a.url
+	}
+	if d.folder == "" {
+		d.folder = a.folder
+	}
+	for _, tag := range a.tags {
+		if !slices.Contains(d.tags, tag) {
+			d.tags = append(d.tags, tag)
+		}
+	}
+	if d.saved.IsZero() || (!a.saved.IsZero() && a.saved.Before(d.saved)) {
+		d.saved = a.saved
+	}
+	if a.selection != "" {
+		d.add(highlight{kind: "highlight", text: a.selection, added: a.saved})
+	}
+}
+
+// normalizeURL makes the URLs of an article saved twice compare equal.
+func normalizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return strings.TrimSuffix(u.String(), "/")
+}
+
+// unixTime converts seconds since the epoch, or returns the zero time.
+func unixTime(s string) time.Time {
+	secs, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || secs <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0).UTC()
+}
+
+func splitTags(s, sep string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, sep) {
+		if tag = strings.Trim(strings.TrimSpace(tag), `"`); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
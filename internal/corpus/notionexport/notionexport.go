@@ -0,0 +1,358 @@
+// Package notionexport reads the archives made by Notion's "Markdown &
+// CSV" export. Every page is a Markdown file and every database a CSV
+// file, named after its title and its ID, 32 hex digits, with the pages
+// inside a page or database in a folder named the same way. Large exports
+// come as a ZIP of ZIP parts.
+package notionexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus"
+)
+
+// Kind names the format in imports and connector types.
+const Kind = "notion-export"
+
+const (
+	mimeTypePage     = "application/vnd.notion.page"
+	mimeTypeDatabase = "application/vnd.notion.database"
+)
+
+// nameRE splits an exported file or folder name into the title and the
+// ID. Databases are exported twice, as the rows of their default view
+// and, in files ending in _all, as all their rows.
+var nameRE = regexp.MustCompile(`^(.*?) ?([0-9a-f]{32})(_all)?(\.md|\.csv)?$`)
+
+// exportDirRE matches the folder an export is zipped in.
+var exportDirRE = regexp.MustCompile(`^Export-[0-9a-f-]+$`)
+
+// splitName returns the title and ID in a file or folder name, and
+// whether it is the _all variant of a database. Names without an ID are
+// their own title.
+func splitName(name string) (title, id string, all bool) {
+	m := nameRE.FindStringSubmatch(name)
+	if m == nil {
+		return strings.TrimSuffix(strings.TrimSuffix(name, ".md"), ".csv"), "", false
+	}
+	return m[1], m[2], m[3] != ""
+}
+
+// file is a page or database found in an export.
+type file struct {
+	fsys    fs.FS
+	path    string
+	title   string
+	id      string
+	parents []string
+	modTime time.Time
+}
+
+// Read reads the export at path, a ZIP file or the directory it was
+// extracted to. Each page and database becomes an item, with its Notion
+// ID as the item's ID. A page is searched whole; a database's rows are
+// searched one by one, except those exported as pages of their own.
+func Read(path string) (*corpus.Corpus, error) {
+	fsys, closeArchive, err := corpus.OpenArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeArchive()
+	var pages, databases []file
+	if err := walk(fsys, &pages, &databases); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(pages) == 0 && len(databases) == 0 {
+		return nil, fmt.Errorf("%s: not a Notion export: no Markdown or CSV files", path)
+	}
+
+	// Rows of a database are also exported as pages in its folder when
+	// they have content, so the database's copy of them is only shown.
+	dbFolders := map[string]bool{}
+	for _, d := range databases {
+		dbFolders[d.folder()] = true
+	}
+	rowPages := map[string]bool{}
+	var items []corpus.Item
+	seen := map[string]bool{}
+	for _, p := range pages {
+		item, err := readPage(p, dbFolders[strings.Join(p.parents, "/")])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if seen[item.ID] {
+			continue
+		}
+		seen[item.ID] = true
+		rowPages[strings.Join(p.parents, "/")+"/"+p.title] = true
+		items = append(items, item)
+	}
+	for _, d := range databases {
+		item, err := readDatabase(d, rowPages)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if seen[item.ID] {
+			continue
+		}
+		seen[item.ID] = true
+		items = append(items, item)
+	}
+	return &corpus.Corpus{Info: corpus.Info{Kind: Kind, Origin: path}, Items: items}, nil
+}
+
+// walk collects the pages and databases of an export, looking inside the
+// ZIP parts of a large one. Of a database exported twice, only the _all
+// file is kept.
+func walk(fsys fs.FS, pages, databases *[]file) error {
+	all := map[string]bool{}
+	var csvs []file
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := d.Name()
+		switch strings.ToLower(path.Ext(name)) {
+		case ".zip":
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+			return walk(zr, pages, databases)
+		case ".md", ".csv":
+		default:
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		title, id, isAll := splitName(name)
+		f := file{fsys: fsys, path: p, title: title, id: id, parents: parents(p), modTime: info.ModTime().UTC()}
+		if path.Ext(name) == ".md" {
+			*pages = append(*pages, f)
+			return nil
+		}
+		if isAll {
+			all[id] = true
+		}
+		csvs = append(csvs, f)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, f := range csvs {
+		if _, _, isAll := splitName(path.Base(f.path)); f.id == "" || isAll || !all[f.id] {
+			*databases = append(*databases, f)
+		}
+	}
+	return nil
+}
+
+// parents returns the titles of the folders leading to a file, leaving
+// out the folder the export was zipped in.
+func parents(p string) []string {
+	var titles []string
+	for _, dir := range strings.Split(path.Dir(p), "/") {
+		if dir == "." || exportDirRE.MatchString(dir) {
+			continue
+		}
+		title, _, _ := splitName(dir)
+		titles = append(titles, title)
+	}
+	return titles
+}
+
+// folder is the path of the folder holding the pages inside f, by title.
+func (f file) folder() string {
+	return strings.Join(append(f.parents[:len(f.parents):len(f.parents)], f.title), "/")
+}
+
+func (f file) itemID() string {
+	if f.id != "" {
+		return f.id
+	}
+	return strings.ReplaceAll(f.path, "#", "%23")
+}
+
+func (f file) fields() []connectors.ViewField {
+	if len(f.parents) == 0 {
+		return nil
+	}
+	return []connectors.ViewField{{Name: "Path", Value: strings.Join(f.parents, " / ")}}
+}
+
+func (f file) metadata() map[string]string {
+	md := map[string]string{}
+	if len(f.parents) > 0 {
+		md["path"] = strings.Join(f.parents, " / ")
+	}
+	return md
+}
+
+// propertyRE matches a line of the property list Notion writes under the
+// title of a database row.
+var propertyRE = regexp.MustCompile(`^([^:\n]{1,50}): (.*)$`)
+
+// readPage reads a Markdown page: its title is its first heading, followed
+// by the properties of the row when the page is a row of a database.
+// Properties are searched with the page's text.
+func readPage(f file, isRow bool) (corpus.Item, error) {
+	data, err := fs.ReadFile(f.fsys, f.path)
+	if err != nil {
+		return corpus.Item{}, err
+	}
+	lines := strings.Split(strings.ReplaceAll(strings.TrimPrefix(string(data), "\ufeff"), "\r\n", "\n"), "\n")
+	title := f.title
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "# ") {
+		title = strings.TrimSpace(lines[0][2:])
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	var properties []connectors.ViewField
+	for isRow && len(lines) > 0 {
+		m := propertyRE.FindStringSubmatch(lines[0])
+		if m == nil {
+			break
+		}
+		properties = append(properties, connectors.ViewField{Name: m[1], Value: m[2]})
+		lines = lines[1:]
+	}
+
+	e := corpus.Entry{
+		Text:       plainText(strings.Join(lines, "\n")),
+		Title:      title,
+		CreatedAt:  f.modTime,
+		ModifiedAt: f.modTime,
+		MimeType:   mimeTypePage,
+		Metadata:   f.metadata(),
+	}
+	for _, p := range properties {
+		switch strings.ToLower(p.Name) {
+		case "created", "created time":
+			if t := parseDate(p.Value); !t.IsZero() {
+				e.CreatedAt = t
+			}
+		case "last edited time", "updated":
+			if t := parseDate(p.Value); !t.IsZero() {
+				e.ModifiedAt = t
+			}
+		case "created by", "author":
+			e.Author = p.Value
+		}
+	}
+	if len(properties) > 0 {
+		e.Text = strings.TrimSpace(formatFields(properties) + "\n\n" + e.Text)
+	}
+	return corpus.Item{
+		ID:      f.itemID(),
+		Title:   title,
+		Fields:  f.fields(),
+		Entries: []corpus.Entry{e},
+	}, nil
+}
+
+// readDatabase reads a CSV database, whose first column is the rows'
+// titles. Rows exported as pages of their own, listed in rowPages by
+// their path, are left unlisted.
+func readDatabase(f file, rowPages map[string]bool) (corpus.Item, error) {
+	data, err := fs.ReadFile(f.fsys, f.path)
+	if err != nil {
+		return corpus.Item{}, err
+	}
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return corpus.Item{}, fmt.Errorf("%s: %w", f.path, err)
+	}
+	item := corpus.Item{ID: f.itemID(), Title: f.title, Fields: f.fields()}
+	if len(records) == 0 {
+		return item, nil
+	}
+	header, rows := records[0], records[1:]
+	item.Fields = append(item.Fields, connectors.ViewField{Name: "Rows", Value: strconv.Itoa(len(rows))})
+	for i, row := range rows {
+		var title string
+		var cells []connectors.ViewField
+		for j, v := range row {
+			switch {
+			case j == 0:
+				title = v
+			case j < len(header) && v != "":
+				cells = append(cells, connectors.ViewField{Name: header[j], Value: v})
+			}
+		}
+		e := corpus.Entry{
+			Anchor:     "row-" + strconv.Itoa(i+1),
+			Heading:    title,
+			Text:       formatFields(cells),
+			Title:      title,
+			CreatedAt:  f.modTime,
+			ModifiedAt: f.modTime,
+			MimeType:   mimeTypeDatabase,
+			Metadata:   f.metadata(),
+			Unlisted:   rowPages[f.folder()+"/"+title],
+		}
+		e.Metadata["database"] = f.title
+		if e.Title == "" {
+			e.Title = "Untitled"
+		}
+		item.Entries = append(item.Entries, e)
+	}
+	return item, nil
+}
+
+func formatFields(fields []connectors.ViewField) string {
+	lines := make([]string, len(fields))
+	for i, f := range fields {
+		lines[i] = f.Name + ": " + f.Value
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	imageRE = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	linkRE  = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+)
+
+// plainText drops images from Markdown and replaces links with their
+// text, which is all of them a search can match.
+func plainText(s string) string {
+	s = imageRE.ReplaceAllString(s, "")
+	return strings.TrimSpace(linkRE.ReplaceAllString(s, "$1"))
+}
+
+// dateLayouts are the formats of Notion's date properties.
+var dateLayouts = []string{
+	"January 2, 2006 3:04 PM",
+	"January 2, 2006",
+	"2006/01/02 15:04",
+	"2006-01-02",
+}
+
+func parseDate(s string) time.Time {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,155 @@
+package notionexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	projectsID = "0123456789abcdef0123456789abcdef"
+	tasksID    = "11111111111111111111111111111111"
+	specID     = "22222222222222222222222222222222"
+)
+
+// exportFiles is a small Notion export, by path: a page holding a
+// database, one of whose rows has a page of its own.
+var exportFiles = map[string]string{
+	"Export-3f2a9c1e-77b0-4d1b-9a51-0c6d2f0e8b11/Projects " + projectsID + ".md": "# Projects\n\n" +
+		"Everything we are building this year. See [the roadmap](https://example.com/roadmap).\n\n" +
+		"![Diagram](Projects%20" + projectsID + "/diagram.png)\n",
+	"Export-3f2a9c1e-77b0-4d1b-9a51-0c6d2f0e8b11/Projects " + projectsID + "/Tasks " + tasksID + ".csv": "\ufeffName,Status\nWrite spec,Done\n",
+	"Export-3f2a9c1e-77b0-4d1b-9a51-0c6d2f0e8b11/Projects " + projectsID + "/Tasks " + tasksID + "_all.csv": "\ufeffName,Status,Owner\r\n" +
+		"Write spec,Done,Alice\r\nReview budget,In progress,\r\n",
+	"Export-3f2a9c1e-77b0-4d1b-9a51-0c6d2f0e8b11/Projects " + projectsID + "/Tasks " + tasksID + "/Write spec " + specID + ".md": "# Write spec\n\n" +
+		"Status: Done\nCreated by: Alice\nCreated: March 5, 2024 9:30 AM\n\n" +
+		"The spec covers the import formats.\n",
+}
+
+func writeExport(t *testing.T, dir string) {
+	t.Helper()
+	for name, content := range exportFiles {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0700))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+	}
+}
+
+func zipFiles(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func itemByID(t *testing.T, c *corpus.Corpus, id string) corpus.Item {
+	t.Helper()
+	for _, it := range c.Items {
+		if it.ID == id {
+			return it
+		}
+	}
+	require.Failf(t, "item not found", "no item %q", id)
+	return corpus.Item{}
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	writeExport(t, dir)
+
+	c, err := Read(dir)
+
+	require.NoError(t, err)
+	assert.Equal(t, Kind, c.Kind)
+	require.Len(t, c.Items, 3, "the database is read once, from its _all file")
+
+	projects := itemByID(t, c, projectsID)
+	assert.Equal(t, "Projects", projects.Title)
+	assert.Empty(t, projects.Fields)
+	require.Len(t, projects.Entries, 1)
+	assert.Equal(t, "Everything we are building this year. See the roadmap.", projects.Entries[0].Text)
+	assert.Equal(t, "application/vnd.notion.page", projects.Entries[0].MimeType)
+
+	spec := itemByID(t, c, specID)
+	assert.Equal(t, "Write spec", spec.Title)
+	assert.Equal(t, []connectors.ViewField{{Name: "Path", Value: "Projects / Tasks"}}, spec.Fields)
+	require.Len(t, spec.Entries, 1)
+	e := spec.Entries[0]
+	assert.Equal(t, "Status: Done\nCreated by: Alice\nCreated: March 5, 2024 9:30 AM\n\nThe spec covers the import formats.", e.Text)
+	assert.Equal(t, "Alice", e.Author)
+	assert.Equal(t, "2024-03-05T09:30:00Z", e.CreatedAt.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, map[string]string{"path": "Projects / Tasks"}, e.Metadata)
+
+	tasks := itemByID(t, c, tasksID)
+	assert.Equal(t, "Tasks", tasks.Title)
+	assert.Equal(t, []connectors.ViewField{{Name: "Path", Value: "Projects"}, {Name: "Rows", Value: "2"}}, tasks.Fields)
+	require.Len(t, tasks.Entries, 2)
+	assert.Equal(t, "row-1", tasks.Entries[0].Anchor)
+	assert.Equal(t, "Status: Done\nOwner: Alice", tasks.Entries[0].Text)
+	assert.True(t, tasks.Entries[0].Unlisted, "rows with a page of their own are searched as that page")
+	assert.Equal(t, "Review budget", tasks.Entries[1].Title)
+	assert.Equal(t, "Status: In progress", tasks.Entries[1].Text)
+	assert.Equal(t, map[string]string{"path": "Projects", "database": "Tasks"}, tasks.Entries[1].Metadata)
+	assert.False(t, tasks.Entries[1].Unlisted)
+}
+
+func TestRead_PagesNotRows(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "Notes "+projectsID+".md")
+	require.NoError(t, os.WriteFile(page, []byte("# Notes\n\nOwner: Bob\nMore text\n"), 0600))
+
+	c, err := Read(dir)
+
+	require.NoError(t, err)
+	require.Len(t, c.Items, 1)
+	assert.Equal(t, "Owner: Bob\nMore text", c.Items[0].Entries[0].Text, "only rows have properties")
+	assert.Empty(t, c.Items[0].Entries[0].Author)
+}
+
+func TestRead_NestedZip(t *testing.T) {
+	files := map[string][]byte{}
+	for name, content := range exportFiles {
+		files[name] = []byte(content)
+	}
+	path := filepath.Join(t.TempDir(), "export.zip")
+	require.NoError(t, os.WriteFile(path, zipFiles(t, map[string][]byte{
+		"Export-Part-1.zip": zipFiles(t, files),
+	}), 0600))
+
+	c, err := Read(path)
+
+	require.NoError(t, err)
+	assert.Len(t, c.Items, 3)
+	assert.Equal(t, "Write spec", itemByID(t, c, specID).Title)
+}
+
+func TestRead_NotAnExport(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0600))
+
+	_, err := Read(dir)
+
+	assert.EqualError(t, err, dir+": not a Notion export: no Markdown or CSV files")
+}
+
+func TestSplitName(t *testing.T) {
+	title, id, all := splitName("Tasks " + tasksID + "_all.csv")
+	assert.Equal(t, []any{"Tasks", tasksID, true}, []any{title, id, all})
+
+	title, id, all = splitName("Meeting notes.md")
+	assert.Equal(t, []any{"Meeting notes", "", false}, []any{title, id, all})
+}
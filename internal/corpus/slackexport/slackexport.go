@@ -0,0 +1,393 @@
+// Package slackexport reads the archives made by Slack's workspace export:
+// a ZIP of users.json, channels.json (with groups.json, dms.json and
+// mpims.json in exports that include private conversations) and a folder
+// per conversation, holding a JSON file of its messages for each day.
+package slackexport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus"
+)
+
+// Kind names the format in imports and connector types.
+const Kind = "slack-export"
+
+const (
+	mimeTypeMessage = "application/vnd.slack.message"
+	// titleLen is the length, in runes, a message's first line is cut to
+	// for its result's title.
+	titleLen = 80
+	// dateLayout is how message times are shown on channel pages.
+	dateLayout = "Mon, 2 Jan 2006 15:04 MST"
+)
+
+// skippedSubtypes are the messages Slack posts for members joining and
+// leaving, which are left out.
+var skippedSubtypes = map[string]bool{
+	"channel_join": true, "channel_leave": true,
+	"group_join": true, "group_leave": true,
+}
+
+type user struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name"`
+	Profile  struct {
+		DisplayName string `json:"display_name"`
+		RealName    string `json:"real_name"`
+	} `json:"profile"`
+}
+
+// displayName is how Slack shows the user: their display name, or else
+// their full name or handle.
+func (u user) displayName() string {
+	for _, name := range []string{u.Profile.DisplayName, u.Profile.RealName, u.RealName, u.Name} {
+		if name != "" {
+			return name
+		}
+	}
+	return u.ID
+}
+
+type conversation struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Created int64    `json:"created"`
+	Members []string `json:"members"`
+	Topic   struct {
+		Value string `json:"value"`
+	} `json:"topic"`
+	Purpose struct {
+		Value string `json:"value"`
+	} `json:"purpose"`
+}
+
+type message struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	User        string `json:"user"`
+	Username    string `json:"username"`
+	Text        string `json:"text"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts"`
+	UserProfile struct {
+		DisplayName string `json:"display_name"`
+		RealName    string `json:"real_name"`
+	} `json:"user_profile"`
+	Files []struct {
+		Name  string `json:"name"`
+		Title string `json:"title"`
+	} `json:"files"`
+}
+
+// Read reads the export at path, a ZIP file or the directory it was
+// extracted to. Each conversation becomes an item, with the conversation's
+// folder name as its ID and an entry per message.
+func Read(path string) (*corpus.Corpus, error) {
+	fsys, closeArchive, err := corpus.OpenArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeArchive()
+	root, err := findRoot(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	items, err := read(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &corpus.Corpus{Info: corpus.Info{Kind: Kind, Origin: path}, Items: items}, nil
+}
+
+// findRoot returns the directory holding channels.json: the top of the
+// archive or, when it was zipped with its enclosing folder, that folder.
+func findRoot(fsys fs.FS) (fs.FS, error) {
+	if _, err := fs.Stat(fsys, "channels.json"); err == nil {
+		return fsys, nil
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if _, err := fs.Stat(fsys, path.Join(e.Name(), "channels.json")); e.IsDir() && err == nil {
+			return fs.Sub(fsys, e.Name())
+		}
+	}
+	return nil, errors.New("not a Slack export: no channels.json")
+}
+
+// export is what the lists at the top of an export say about the
+// workspace.
+type export struct {
+	users    map[string]string
+	channels map[string]string
+}
+
+func read(fsys fs.FS) ([]corpus.Item, error) {
+	var users []user
+	if err := readJSON(fsys, "users.json", &users); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	x := export{users: map[string]string{}, channels: map[string]string{}}
+	for _, u := range users {
+		x.users[u.ID] = u.displayName()
+	}
+
+	// Channels and private channels have folders named after them;
+	// direct and group messages have folders named after their ID and
+	// their generated name respectively.
+	type list struct {
+		file  string
+		title func(conversation) string
+		dir   func(conversation) string
+	}
+	byName := func(c conversation) string { return c.Name }
+	lists := []list{
+		{"channels.json", func(c conversation) string { return "#" + c.Name }, byName},
+		{"groups.json", func(c conversation) string { return "#" + c.Name }, byName},
+		{"mpims.json", func(c conversation) string { return "Group message with " + x.names(c.Members) }, byName},
+		{"dms.json", func(c conversation) string { return "Direct messages with " + x.names(c.Members) }, func(c conversation) string { return c.ID }},
+	}
+	var conversations []folder
+	for _, l := range lists {
+		var cs []conversation
+		if err := readJSON(fsys, l.file, &cs); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, c := range cs {
+			x.channels[c.ID] = c.Name
+			conversations = append(conversations, folder{c, l.title(c), l.dir(c)})
+		}
+	}
+
+	var items []corpus.Item
+	for _, c := range conversations {
+		entries, err := x.messages(fsys, c)
+		if err != nil {
+			return nil, err
+		}
+		item := corpus.Item{ID: c.dir, Title: c.title, Entries: entries}
+		for _, f := range []connectors.ViewField{
+			{Name: "Topic", Value: x.plainText(c.Topic.Value)},
+			{Name: "Purpose", Value: x.plainText(c.Purpose.Value)},
+			{Name: "Created", Value: formatTime(time.Unix(c.Created, 0))},
+		} {
+			if f.Value != "" {
+				item.Fields = append(item.Fields, f)
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// names lists the display names of users.
+func (x export) names(ids []string) string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if name, ok := x.users[id]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, id)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// folder is a conversation in an export and the folder of its messages.
+type folder struct {
+	conversation
+	title, dir string
+}
+
+// messages reads a conversation's folder of daily files, oldest first.
+func (x export) messages(fsys fs.FS, c folder) ([]corpus.Entry, error) {
+	files, err := fs.Glob(fsys, path.Join(globEscape(c.dir), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var entries []corpus.Entry
+	for _, file := range files {
+		var day []message
+		if err := readJSON(fsys, file, &day); err != nil {
+			return nil, err
+		}
+		sort.SliceStable(day, func(i, j int) bool { return tsTime(day[i].TS).Before(tsTime(day[j].TS)) })
+		for _, m := range day {
+			if m.Type != "message" || skippedSubtypes[m.Subtype] || m.TS == "" {
+				continue
+			}
+			if e, ok := x.entry(m, c); ok {
+				entries = append(entries, e)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// entry converts a message. Its anchor is its timestamp without the dot,
+// prefixed with "p", as in Slack's own permalinks.
+func (x export) entry(m message, c folder) (corpus.Entry, bool) {
+	text := x.plainText(m.Text)
+	var files []string
+	for _, f := range m.Files {
+		if name := firstNonEmpty(f.Title, f.Name); name != "" {
+			files = append(files, name)
+		}
+	}
+	if len(files) > 0 {
+		text = strings.TrimSpace(text + "\nFiles: " + strings.Join(files, ", "))
+	}
+	if text == "" {
+		return corpus.Entry{}, false
+	}
+	author := firstNonEmpty(x.users[m.User], m.UserProfile.DisplayName, m.UserProfile.RealName, m.Username, m.User)
+	posted := tsTime(m.TS)
+	heading := author + " · " + formatTime(posted)
+	e := corpus.Entry{
+		Anchor:     "p" + strings.ReplaceAll(m.TS, ".", ""),
+		Text:       text,
+		Title:      title(text),
+		Author:     author,
+		CreatedAt:  posted,
+		ModifiedAt: posted,
+		MimeType:   mimeTypeMessage,
+		Metadata:   map[string]string{"channel_id": c.ID, "ts": m.TS},
+	}
+	if c.Name != "" {
+		e.Metadata["channel"] = c.Name
+	}
+	if m.User != "" {
+		e.Metadata["user_id"] = m.User
+	}
+	if m.ThreadTS != "" && m.ThreadTS != m.TS {
+		e.Metadata["thread_ts"] = m.ThreadTS
+		heading += " · reply in thread"
+	}
+	e.Heading = heading
+	return e, true
+}
+
+func readJSON(fsys fs.FS, name string, v any) error {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// globEscape escapes the characters fs.Glob treats specially.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// tsTime converts a Slack timestamp, seconds since the epoch with a
+// fraction that makes it unique in its channel.
+func tsTime(ts string) time.Time {
+	secs, frac, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	var us int64
+	if frac != "" {
+		us, _ = strconv.ParseInt((frac + "000000")[:6], 10, 64)
+	}
+	return time.Unix(s, us*1000).UTC()
+}
+
+func formatTime(t time.Time) string {
+	if t.Unix() <= 0 {
+		return ""
+	}
+	return t.UTC().Format(dateLayout)
+}
+
+// title returns the first line of text, shortened to titleLen runes.
+func title(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	line = strings.TrimSpace(line)
+	if utf8.RuneCountInString(line) <= titleLen {
+		return line
+	}
+	rs := []rune(line)
+	return strings.TrimSpace(string(rs[:titleLen-1])) + "…"
+}
+
+// entityRE matches Slack's <...> escapes for mentions, channels and links.
+var entityRE = regexp.MustCompile(`<([^<>]*)>`)
+
+// plainText converts Slack mrkdwn to plain text: mentions and channel
+// references become @name and #name, using the export's lists for those
+// that carry only an ID, links become their label or URL, and HTML
+// entities are decoded.
+func (x export) plainText(s string) string {
+	s = entityRE.ReplaceAllStringFunc(s, func(e string) string {
+		target, label, hasLabel := strings.Cut(e[1:len(e)-1], "|")
+		switch {
+		case strings.HasPrefix(target, "@"):
+			if hasLabel {
+				return "@" + strings.TrimPrefix(label, "@")
+			}
+			if name, ok := x.users[target[1:]]; ok {
+				return "@" + name
+			}
+			return target
+		case strings.HasPrefix(target, "#"):
+			if hasLabel {
+				return "#" + label
+			}
+			if name, ok := x.channels[target[1:]]; ok {
+				return "#" + name
+			}
+			return target
+		case strings.HasPrefix(target, "!"):
+			// Special mentions such as <!here> or <!subteam^ID|@team>.
+			if hasLabel {
+				return label
+			}
+			return "@" + strings.TrimPrefix(target, "!")
+		case hasLabel:
+			return label
+		}
+		return target
+	})
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package slackexport
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/corpus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportFiles is a small workspace export, by path.
+var exportFiles = map[string]string{
+	"users.json": `[
+		{"id": "U1", "name": "alice", "profile": {"display_name": "Alice", "real_name": "Alice Martin"}},
+		{"id": "U2", "name": "bob", "real_name": "Bob Stone"}
+	]`,
+	"channels.json": `[
+		{"id": "C1", "name": "general", "created": 1700000000, "members": ["U1", "U2"],
+		 "topic": {"value": "Company news"}, "purpose": {"value": ""}}
+	]`,
+	"dms.json": `[{"id": "D1", "members": ["U1", "U2"]}]`,
+	"general/2024-03-05.json": `[
+		{"type": "message", "subtype": "channel_join", "user": "U2", "text": "<@U2> has joined the channel", "ts": "1709630000.000100"},
+		{"type": "message", "user": "U2", "text": "Booked the train, thanks <@U1>", "ts": "1709631000.000200", "thread_ts": "1709630400.000100"},
+		{"type": "message", "user": "U1", "text": "The offsite is in Lyon this year &amp; it's in <#C1> too\nDetails to follow", "ts": "1709630400.000100", "thread_ts": "1709630400.000100",
+		 "files": [{"name": "agenda.pdf", "title": "Agenda"}]}
+	]`,
+	"general/2024-03-06.json": `[
+		{"type": "message", "username": "deploybot", "subtype": "bot_message", "text": "Deployed <https://example.com/r/42|release 42>", "ts": "1709720000.000000"}
+	]`,
+	"D1/2024-03-07.json": `[{"type": "message", "user": "U1", "text": "Lunch?", "ts": "1709800000.000000"}]`,
+}
+
+func writeExport(t *testing.T, dir string) {
+	t.Helper()
+	for name, content := range exportFiles {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0700))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+	}
+}
+
+func writeZip(t *testing.T, prefix string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for name, content := range exportFiles {
+		w, err := zw.Create(prefix + name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+	return path
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	writeExport(t, dir)
+
+	c, err := Read(dir)
+
+	require.NoError(t, err)
+	assert.Equal(t, Kind, c.Kind)
+	require.Len(t, c.Items, 2)
+
+	general := c.Items[0]
+	assert.Equal(t, "general", general.ID)
+	assert.Equal(t, "#general", general.Title)
+	assert.Equal(t, []connectors.ViewField{
+		{Name: "Topic", Value: "Company news"},
+		{Name: "Created", Value: "Tue, 14 Nov 2023 22:13 UTC"},
+	}, general.Fields)
+	require.Len(t, general.Entries, 3, "join messages are left out")
+	assert.Equal(t, corpus.Entry{
+		Anchor:     "p1709630400000100",
+		Heading:    "Alice · Tue, 5 Mar 2024 09:20 UTC",
+		Text:       "The offsite is in Lyon this year & it's in #general too\nDetails to follow\nFiles: Agenda",
+		Title:      "The offsite is in Lyon this year & it's in #general too",
+		Author:     "Alice",
+		CreatedAt:  time.Date(2024, 3, 5, 9, 20, 0, 100000, time.UTC),
+		ModifiedAt: time.Date(2024, 3, 5, 9, 20, 0, 100000, time.UTC),
+		MimeType:   "application/vnd.slack.message",
+		Metadata:   map[string]string{"channel_id": "C1", "channel": "general", "ts": "1709630400.000100", "user_id": "U1"},
+	}, general.Entries[0], "messages are ordered by time")
+	assert.Equal(t, "Bob Stone · Tue, 5 Mar 2024 09:30 UTC · reply in thread", general.Entries[1].Heading)
+	assert.Equal(t, "Booked the train, thanks @Alice", general.Entries[1].Text)
+	assert.Equal(t, "1709630400.000100", general.Entries[1].Metadata["thread_ts"])
+	assert.Equal(t, "deploybot", general.Entries[2].Author)
+	assert.Equal(t, "Deployed release 42", general.Entries[2].Text)
+
+	dm := c.Items[1]
+	assert.Equal(t, "D1", dm.ID)
+	assert.Equal(t, "Direct messages with Alice, Bob Stone", dm.Title)
+	require.Len(t, dm.Entries, 1)
+	assert.Equal(t, "Lunch?", dm.Entries[0].Text)
+}
+
+func TestRead_Zip(t *testing.T) {
+	for _, prefix := range []string{"", "Acme Slack export Mar 1 2024 - Mar 7 2024/"} {
+		c, err := Read(writeZip(t, prefix))
+
+		require.NoError(t, err, prefix)
+		require.Len(t, c.Items, 2, prefix)
+		assert.Len(t, c.Items[0].Entries, 3, prefix)
+	}
+}
+
+func TestRead_NotAnExport(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0600))
+
+	_, err := Read(dir)
+	assert.EqualError(t, err, dir+": not a Slack export: no channels.json")
+
+	_, err = Read(filepath.Join(dir, "notes.txt"))
+	assert.ErrorContains(t, err, "notes.txt: zip: not a valid zip file")
+}
+
+func TestTitle(t *testing.T) {
+	long := "The quarterly planning meeting has been moved to the large room on the third floor next Tuesday"
+	assert.Equal(t, "The quarterly planning meeting has been moved to the large room on the third fl…", title(long))
+	assert.Equal(t, "First line", title("First line\nSecond line"))
+}
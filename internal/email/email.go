@@ -0,0 +1,275 @@
+// Package email decodes Internet mail messages into the text pkb searches
+// and shows. It handles headers encoded as in RFC 2047, multipart bodies,
+// the quoted-printable and base64 transfer encodings, and legacy charsets.
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Message is a decoded message.
+type Message struct {
+	// MessageID is the Message-ID header without its angle brackets.
+	MessageID string
+	Subject   string
+	// From and To are formatted as by FormatAddress, To as a
+	// comma-separated list.
+	From string
+	To   string
+	Cc   string
+	// Date is zero when the Date header is missing or malformed.
+	Date time.Time
+	// Text is the body as plain text: its text/plain part, or else the
+	// text of its text/html part. Attachments are left out.
+	Text string
+	// Attachments are the file names of the attachments.
+	Attachments []string
+}
+
+// maxDepth bounds how deeply multipart bodies are descended into.
+const maxDepth = 10
+
+// Parse reads a message. A body that is cut short, as when only the start
+// of a message was fetched, yields the text read before the cut.
+func Parse(r io.Reader) (Message, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return Message{}, fmt.Errorf("read message: %w", err)
+	}
+	h := msg.Header
+	m := Message{
+		MessageID: strings.Trim(strings.TrimSpace(h.Get("Message-Id")), "<>"),
+		Subject:   DecodeHeader(h.Get("Subject")),
+		From:      decodeAddresses(h.Get("From")),
+		To:        decodeAddresses(h.Get("To")),
+		Cc:        decodeAddresses(h.Get("Cc")),
+	}
+	m.Date, _ = mail.ParseDate(h.Get("Date"))
+	var b body
+	b.walk(h.Get("Content-Type"), h.Get("Content-Transfer-Encoding"), msg.Body, 0)
+	m.Text, m.Attachments = b.plain, b.attachments
+	if strings.TrimSpace(b.plain) == "" {
+		m.Text = b.html
+	}
+	m.Text = strings.TrimSpace(m.Text)
+	return m, nil
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// DecodeHeader decodes the RFC 2047 encoded words in a header value. Values
+// that cannot be decoded are returned as they are.
+func DecodeHeader(s string) string {
+	d, err := wordDecoder.DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return d
+}
+
+// FormatAddress formats a mailbox as "Name <address>", or as the bare
+// address when it has no display name.
+func FormatAddress(name, address string) string {
+	if name == "" || name == address {
+		return address
+	}
+	return name + " <" + address + ">"
+}
+
+// decodeAddresses formats an address list header, falling back to its
+// decoded text when it does not parse.
+func decodeAddresses(s string) string {
+	if s == "" {
+		return ""
+	}
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	list, err := parser.ParseList(s)
+	if err != nil {
+		return DecodeHeader(s)
+	}
+	formatted := make([]string, len(list))
+	for i, a := range list {
+		formatted[i] = FormatAddress(a.Name, a.Address)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// body collects the text and attachments of a message body.
+type body struct {
+	plain, html string
+	attachments []string
+}
+
+// walk reads a body or body part with the given headers. Only the first
+// text/plain and text/html parts are kept.
+func (b *body) walk(contentType, transferEncoding string, r io.Reader, depth int) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// RFC 2045 defaults bodies without a usable Content-Type to plain
+		// text.
+		mediaType, params = "text/plain", nil
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		if depth >= maxDepth || params["boundary"] == "" {
+			return
+		}
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				return // the end, or a body cut short
+			}
+			if name, ok := attachment(part.Header.Get("Content-Disposition"), part.Header.Get("Content-Type")); ok {
+				b.attachments = append(b.attachments, name)
+				continue
+			}
+			b.walk(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part, depth+1)
+		}
+	case mediaType == "text/plain":
+		if b.plain == "" {
+			b.plain = decodeBody(transferEncoding, params["charset"], r)
+		}
+	case mediaType == "text/html":
+		if b.html == "" {
+			b.html = HTMLText(decodeBody(transferEncoding, params["charset"], r))
+		}
+	}
+}
+
+// attachment reports whether a part with the given headers is an
+// attachment rather than part of the message text, and its file name.
+// Parts that are not text or multipart count as attachments, such as an
+// inline image or a forwarded message.
+func attachment(disposition, contentType string) (string, bool) {
+	d, dparams, _ := mime.ParseMediaType(disposition)
+	mediaType, cparams, err := mime.ParseMediaType(contentType)
+	name := dparams["filename"]
+	if name == "" {
+		name = cparams["name"]
+	}
+	name = DecodeHeader(name)
+	if d == "attachment" || (err == nil && !strings.HasPrefix(mediaType, "text/") && !strings.HasPrefix(mediaType, "multipart/")) {
+		if name == "" {
+			name = "(unnamed " + mediaType + ")"
+			if mediaType == "" {
+				name = "(unnamed)"
+			}
+		}
+		return name, true
+	}
+	return "", false
+}
+
+// decodeBody undoes a part's transfer encoding and converts it from charset
+// to UTF-8. What was decoded before an error is kept.
+func decodeBody(transferEncoding, charset string, body io.Reader) string {
+	switch strings.ToLower(strings.TrimSpace(transferEncoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	data, _ := io.ReadAll(body)
+	return normalizeNewlines(Decode(charset, data))
+}
+
+// Decode converts text in the named charset to UTF-8. Unknown charsets are
+// treated as UTF-8, with invalid bytes replaced.
+func Decode(charset string, data []byte) string {
+	if r, err := charsetReader(charset, bytes.NewReader(data)); err == nil {
+		if d, err := io.ReadAll(r); err == nil {
+			data = d
+		}
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return strings.ToValidUTF8(string(data), "�")
+}
+
+var errUnknownCharset = errors.New("unknown charset")
+
+// charsetReader converts input from charset to UTF-8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", errUnknownCharset, charset)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+// blockElements end a line of text when they open or close.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "br": true, "div": true,
+	"dd": true, "dt": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "hr": true, "li": true, "p": true, "pre": true,
+	"section": true, "table": true, "td": true, "th": true, "tr": true,
+}
+
+// HTMLText returns the text of an HTML document, with a line break for
+// each block element. Scripts, styles and the head are left out.
+func HTMLText(s string) string {
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	skip := 0
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return collapseBlankLines(b.String())
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			switch tag {
+			case "script", "style", "head", "title":
+				switch tt {
+				case html.StartTagToken:
+					skip++
+				case html.EndTagToken:
+					skip = max(skip-1, 0)
+				}
+			}
+			if blockElements[tag] {
+				b.WriteByte('\n')
+			}
+		}
+	}
+}
+
+// collapseBlankLines trims each line and drops empty ones.
+func collapseBlankLines(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
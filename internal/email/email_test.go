@@ -0,0 +1,156 @@
+package email
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parse parses a message written with \n line endings.
+func parse(t *testing.T, raw string) Message {
+	t.Helper()
+	m, err := Parse(strings.NewReader(strings.ReplaceAll(raw, "\n", "\r\n")))
+	require.NoError(t, err)
+	return m
+}
+
+func TestParse_PlainText(t *testing.T) {
+	m := parse(t, `From: Alice Example <alice@example.com>
+To: bob@example.com, "Carol C." <carol@example.com>
+Subject: Q2 budget
+Date: Fri, 01 Mar 2024 09:00:00 +0100
+Message-ID: <budget-1@example.com>
+
+Hi Bob,
+
+the budget is attached.
+`)
+
+	assert.Equal(t, "budget-1@example.com", m.MessageID)
+	assert.Equal(t, "Q2 budget", m.Subject)
+	assert.Equal(t, "Alice Example <alice@example.com>", m.From)
+	assert.Equal(t, "bob@example.com, Carol C. <carol@example.com>", m.To)
+	assert.True(t, m.Date.Equal(time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "Hi Bob,\n\nthe budget is attached.", m.Text)
+}
+
+func TestParse_EncodingsAndCharsets(t *testing.T) {
+	m := parse(t, `From: =?ISO-8859-1?Q?Andr=E9?= <andre@example.com>
+Subject: =?windows-1252?Q?=93Caf=E9=94?= =?UTF-8?B?4oCUIG1lbnU=?=
+Content-Type: text/plain; charset="windows-1252"
+Content-Transfer-Encoding: quoted-printable
+
+Le menu du caf=E9 co=FBte 5 =80, avec une tr=E8s longue ligne qui est coup=
+=E9e.
+`)
+
+	assert.Equal(t, "André <andre@example.com>", m.From)
+	assert.Equal(t, "“Café”— menu", m.Subject)
+	assert.Equal(t, "Le menu du café coûte 5 €, avec une très longue ligne qui est coupée.", m.Text)
+}
+
+func TestParse_MultipartPrefersPlainText(t *testing.T) {
+	m := parse(t, `Subject: Report
+Content-Type: multipart/mixed; boundary=outer
+
+--outer
+Content-Type: multipart/alternative; boundary=inner
+
+--inner
+Content-Type: text/html; charset=utf-8
+
+<p>The <b>HTML</b> version</p>
+--inner
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: base64
+
+VGhlIHBsYWluIHZlcnNpb24=
+--inner--
+--outer
+Content-Type: text/plain
+Content-Disposition: attachment; filename=notes.txt
+
+Attached notes.
+--outer--
+`)
+
+	assert.Equal(t, "The plain version", m.Text)
+	assert.Equal(t, []string{"notes.txt"}, m.Attachments)
+}
+
+func TestParse_Attachments(t *testing.T) {
+	m := parse(t, `Subject: Photos
+Cc: =?utf-8?q?J=C3=BCrgen?= <j@example.com>
+Content-Type: multipart/mixed; boundary=b
+
+--b
+Content-Type: text/plain
+
+See attached.
+--b
+Content-Type: image/png; name="=?utf-8?q?B=C3=BCro.png?="
+Content-Disposition: inline
+Content-Transfer-Encoding: base64
+
+iVBORw0KGgo=
+--b
+Content-Type: message/rfc822
+
+Subject: Forwarded
+
+Hello.
+--b--
+`)
+
+	assert.Equal(t, "See attached.", m.Text)
+	assert.Equal(t, "Jürgen <j@example.com>", m.Cc)
+	assert.Equal(t, []string{"Büro.png", "(unnamed message/rfc822)"}, m.Attachments)
+}
+
+func TestParse_HTMLOnly(t *testing.T) {
+	m := parse(t, `Subject: Newsletter
+Content-Type: text/html; charset=utf-8
+
+<html><head><title>Newsletter</title><style>p { color: red }</style></head>
+<body><h1>Issue 4</h1><p>Hello &amp; welcome,<br>reader.</p><script>track()</script></body></html>
+`)
+
+	assert.Equal(t, "Issue 4\nHello & welcome,\nreader.", m.Text)
+}
+
+func TestParse_TruncatedBody(t *testing.T) {
+	// Only the start of the message was fetched: the base64 part and the
+	// multipart body end early.
+	m := parse(t, `Subject: Long
+Content-Type: multipart/alternative; boundary=b
+
+--b
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: base64
+
+VGhlIHN0YXJ0IG9mIGEgdmVyeSBsb25nIG1lc3NhZ2Ugd2hpY2ggZ29lcyBvbg`)
+
+	assert.Equal(t, "The start of a very long message which goes o", m.Text)
+}
+
+func TestParse_NoHeaders(t *testing.T) {
+	_, err := Parse(strings.NewReader("not a message"))
+	assert.ErrorContains(t, err, "read message")
+}
+
+func TestDecodeHeader(t *testing.T) {
+	assert.Equal(t, "Grüße aus Köln", DecodeHeader("=?utf-8?q?Gr=C3=BC=C3=9Fe_aus_K=C3=B6ln?="))
+	assert.Equal(t, "Привет", DecodeHeader("=?koi8-r?B?8NLJ18XU?="))
+	assert.Equal(t, "plain", DecodeHeader("plain"))
+	// Unknown charsets are left encoded rather than garbled.
+	assert.Equal(t, "=?x-unknown?Q?abc?=", DecodeHeader("=?x-unknown?Q?abc?="))
+}
+
+func TestDecode(t *testing.T) {
+	assert.Equal(t, "café", Decode("ISO-8859-1", []byte("caf\xe9")))
+	assert.Equal(t, "café", Decode("", []byte("café")))
+	assert.Equal(t, "caf�", Decode("x-unknown", []byte("caf\xe9")))
+}
@@ -0,0 +1,247 @@
+// Package extract turns files such as PDFs, Word and OpenDocument text
+// documents and saved web pages into plain text for indexing, along with
+// their title and other metadata.
+//
+// An Extractor picks the extractor registered for a file's MIME type,
+// which is told from the file's name or, failing that, its contents. It
+// refuses files above a size limit, and its errors name the file, so
+// callers reading many files can report each failure and carry on.
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultMaxSize is the largest file an Extractor reads unless told
+// otherwise.
+const DefaultMaxSize = 32 << 20
+
+// MIME types of the formats extracted by default.
+const (
+	TypePDF  = "application/pdf"
+	TypeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	TypeODT  = "application/vnd.oasis.opendocument.text"
+	TypeHTML = "text/html"
+	TypeText = "text/plain"
+)
+
+var (
+	// ErrUnsupported is returned for files of a type no extractor is
+	// registered for.
+	ErrUnsupported = errors.New("unsupported file type")
+	// ErrTooLarge is returned for files above the size limit.
+	ErrTooLarge = errors.New("file too large")
+)
+
+// Document is what is extracted from a file.
+type Document struct {
+	// MimeType is the type the file was read as.
+	MimeType string
+	// Title is the title the document gives itself, if any.
+	Title    string
+	Author   string
+	Created  time.Time
+	Modified time.Time
+	// Metadata holds other details, such as a PDF's page count, by
+	// lower-case name.
+	Metadata map[string]string
+	// Text is the document's text, with a line per paragraph.
+	Text string
+}
+
+// Func extracts a document from the contents of a file.
+type Func func(data []byte) (Document, error)
+
+// FileError reports a file that could not be extracted.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Extractor extracts text with the Func registered for each MIME type.
+// It is safe for concurrent use once registration is done.
+type Extractor struct {
+	funcs   map[string]Func
+	maxSize int64
+}
+
+// New returns an Extractor for PDF, DOCX, ODT, HTML and plain text files,
+// limited to DefaultMaxSize.
+func New() *Extractor {
+	x := &Extractor{funcs: map[string]Func{}, maxSize: DefaultMaxSize}
+	x.Register(TypePDF, PDF)
+	x.Register(TypeDOCX, DOCX)
+	x.Register(TypeODT, ODT)
+	x.Register(TypeHTML, HTML)
+	x.Register("application/xhtml+xml", HTML)
+	x.Register(TypeText, Text)
+	x.Register("text/markdown", Text)
+	x.Register("text/csv", Text)
+	return x
+}
+
+// Register sets the Func used for files of mimeType, replacing any
+// registered before.
+func (x *Extractor) Register(mimeType string, f Func) {
+	x.funcs[mimeType] = f
+}
+
+// WithMaxSize sets the size above which files are refused with
+// ErrTooLarge. It returns x.
+func (x *Extractor) WithMaxSize(n int64) *Extractor {
+	x.maxSize = n
+	return x
+}
+
+// Types returns the MIME types x can extract, sorted.
+func (x *Extractor) Types() []string {
+	types := make([]string, 0, len(x.funcs))
+	for t := range x.funcs {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Supports reports whether x has an extractor for mimeType.
+func (x *Extractor) Supports(mimeType string) bool {
+	_, ok := x.funcs[mimeType]
+	return ok
+}
+
+// Extract extracts a document of the given MIME type from data.
+func (x *Extractor) Extract(mimeType string, data []byte) (Document, error) {
+	f, ok := x.funcs[mimeType]
+	if !ok {
+		return Document{}, fmt.Errorf("%w %s", ErrUnsupported, mimeType)
+	}
+	if int64(len(data)) > x.maxSize {
+		return Document{}, fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, len(data), x.maxSize)
+	}
+	doc, err := f(data)
+	if err != nil {
+		return Document{}, err
+	}
+	doc.MimeType = mimeType
+	return doc, nil
+}
+
+// File extracts the file at path, read as the type its name or contents
+// show. Errors are *FileError values naming path.
+func (x *Extractor) File(path string) (Document, error) {
+	doc, err := x.file(path)
+	if err != nil {
+		return Document{}, &FileError{Path: path, Err: err}
+	}
+	return doc, nil
+}
+
+func (x *Extractor) file(path string) (Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Document{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Document{}, err
+	}
+	if info.Size() > x.maxSize {
+		return Document{}, fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, info.Size(), x.maxSize)
+	}
+	// The limit also stops files that grow while they are read.
+	data, err := io.ReadAll(io.LimitReader(f, x.maxSize+1))
+	if err != nil {
+		return Document{}, err
+	}
+	return x.Extract(TypeOf(path, data), data)
+}
+
+// extensions maps file name extensions to the MIME types of the formats
+// extracted by default, which system MIME tables do not all know.
+var extensions = map[string]string{
+	".pdf":      TypePDF,
+	".docx":     TypeDOCX,
+	".odt":      TypeODT,
+	".html":     TypeHTML,
+	".htm":      TypeHTML,
+	".xhtml":    "application/xhtml+xml",
+	".txt":      TypeText,
+	".text":     TypeText,
+	".log":      TypeText,
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".csv":      "text/csv",
+}
+
+// TypeOf returns the MIME type of a file, without parameters, from its
+// name's extension or, for unknown extensions, its contents.
+func TypeOf(name string, data []byte) string {
+	if t := TypeByName(name); t != "" {
+		return t
+	}
+	return sniff(data)
+}
+
+// TypeByName returns the MIME type of a file, without parameters, from
+// its name's extension, or "" for unknown extensions. Callers choosing
+// files to read can use it to pass over others without opening them.
+func TypeByName(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := extensions[ext]; ok {
+		return t
+	}
+	return stripParams(mime.TypeByExtension(ext))
+}
+
+// sniff tells a file's type from its contents, looking inside ZIP files
+// for the parts that mark Word and OpenDocument files.
+func sniff(data []byte) string {
+	t := stripParams(http.DetectContentType(data))
+	if t != "application/zip" {
+		return t
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return t
+	}
+	for _, f := range zr.File {
+		switch f.Name {
+		case "word/document.xml":
+			return TypeDOCX
+		case "mimetype":
+			if rc, err := f.Open(); err == nil {
+				b, _ := io.ReadAll(io.LimitReader(rc, 100))
+				rc.Close()
+				return strings.TrimSpace(string(b))
+			}
+		}
+	}
+	return t
+}
+
+func stripParams(t string) string {
+	if mt, _, err := mime.ParseMediaType(t); err == nil {
+		return mt
+	}
+	return t
+}
@@ -0,0 +1,224 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// zipData builds a ZIP file of the given names and contents, in order.
+func zipData(t *testing.T, parts ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(parts); i += 2 {
+		w, err := zw.Create(parts[i])
+		require.NoError(t, err)
+		_, err = w.Write([]byte(parts[i+1]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func docxData(t *testing.T) []byte {
+	return zipData(t,
+		"[Content_Types].xml", `<?xml version="1.0"?><Types/>`,
+		"word/document.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:body>
+<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>Travel policy</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Book trains </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>at least</w:t></w:r><w:r><w:t xml:space="preserve"> a week ahead.</w:t></w:r></w:p>
+<w:p><w:r><w:t>Claims:</w:t></w:r><w:r><w:tab/><w:t>within 30 days</w:t><w:br/><w:t>with receipts</w:t></w:r><w:r><w:delText>by post</w:delText></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Class</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Standard</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+</w:body>
+</w:document>`,
+		"docProps/core.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<dc:title>Travel policy 2024</dc:title><dc:creator>Grace Hopper</dc:creator><cp:lastModifiedBy>Alan Turing</cp:lastModifiedBy>
+<cp:keywords>travel, expenses</cp:keywords>
+<dcterms:created xsi:type="dcterms:W3CDTF">2024-03-05T09:30:00Z</dcterms:created>
+<dcterms:modified xsi:type="dcterms:W3CDTF">2024-04-01T12:00:00Z</dcterms:modified>
+</cp:coreProperties>`,
+		"docProps/app.xml", `<?xml version="1.0"?><Properties><Pages>2</Pages></Properties>`,
+	)
+}
+
+func odtData(t *testing.T) []byte {
+	return zipData(t,
+		"mimetype", TypeODT,
+		"content.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0">
+<office:body><office:text>
+<text:h text:outline-level="1">Meeting notes</text:h>
+<text:p>Agreed to<text:s text:c="2"/>move the launch<text:note><text:note-citation>1</text:note-citation><text:note-body><text:p>Pending legal.</text:p></text:note-body></text:note>.</text:p>
+<text:list><text:list-item><text:p>Ship in May<text:line-break/>after the audit</text:p></text:list-item></text:list>
+<office:annotation><text:p>Hidden comment</text:p></office:annotation>
+<table:table><table:table-row><table:table-cell><text:p>Room</text:p></table:table-cell><table:table-cell><text:p>Capacity</text:p></table:table-cell></table:table-row></table:table>
+</office:text></office:body>
+</office:document-content>`,
+		"meta.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-meta xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:meta="urn:oasis:names:tc:opendocument:xmlns:meta:1.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<office:meta><dc:title>Launch meeting</dc:title><meta:initial-creator>Katherine Johnson</meta:initial-creator><dc:creator>Dorothy Vaughan</dc:creator>
+<meta:creation-date>2024-05-02T10:00:00</meta:creation-date><dc:date>2024-05-03T16:30:00.123</dc:date>
+<meta:document-statistic meta:page-count="1" meta:word-count="17"/></office:meta>
+</office:document-meta>`,
+	)
+}
+
+func TestTypeOf(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"report.PDF", nil, TypePDF},
+		{"notes.md", nil, "text/markdown"},
+		{"page.htm", nil, TypeHTML},
+		{"policy.docx", nil, TypeDOCX},
+		{"scan", []byte("%PDF-1.7\n"), TypePDF},
+		{"download", docxData(t), TypeDOCX},
+		{"download", odtData(t), TypeODT},
+		{"saved", []byte("<!DOCTYPE html><html><body>Hi</body></html>"), TypeHTML},
+		{"README", []byte("just some words"), TypeText},
+	} {
+		assert.Equal(t, tc.want, TypeOf(tc.name, tc.data), tc.name)
+	}
+}
+
+func TestExtractor_File(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+		return path
+	}
+	x := New()
+
+	doc, err := x.File(write("policy.docx", docxData(t)))
+	require.NoError(t, err)
+	assert.Equal(t, TypeDOCX, doc.MimeType)
+	assert.Equal(t, "Travel policy 2024", doc.Title)
+	assert.Equal(t, "Grace Hopper", doc.Author)
+	assert.Equal(t, time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC), doc.Created)
+	assert.Equal(t, time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC), doc.Modified)
+	assert.Equal(t, map[string]string{"last_modified_by": "Alan Turing", "keywords": "travel, expenses", "pages": "2"}, doc.Metadata)
+	assert.Equal(t, "Travel policy\nBook trains at least a week ahead.\nClaims:\twithin 30 days\nwith receipts\nClass\tStandard", doc.Text)
+
+	doc, err = x.File(write("meeting.odt", odtData(t)))
+	require.NoError(t, err)
+	assert.Equal(t, TypeODT, doc.MimeType)
+	assert.Equal(t, "Launch meeting", doc.Title)
+	assert.Equal(t, "Katherine Johnson", doc.Author)
+	assert.Equal(t, time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC), doc.Created)
+	assert.Equal(t, time.Date(2024, 5, 3, 16, 30, 0, 123e6, time.UTC), doc.Modified)
+	assert.Equal(t, map[string]string{"pages": "1", "words": "17"}, doc.Metadata)
+	assert.Equal(t, "Meeting notes\nAgreed to  move the launch.\nShip in May\nafter the audit\nRoom\tCapacity", doc.Text)
+
+	doc, err = x.File(write("notes.txt", []byte("first line  \r\n\r\n\r\n\r\nsecond line\r\n")))
+	require.NoError(t, err)
+	assert.Equal(t, Document{MimeType: TypeText, Text: "first line\n\nsecond line"}, doc)
+}
+
+func TestExtractor_Errors(t *testing.T) {
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big.txt")
+	require.NoError(t, os.WriteFile(big, bytes.Repeat([]byte("a"), 100), 0o600))
+	image := filepath.Join(dir, "photo.png")
+	require.NoError(t, os.WriteFile(image, []byte("\x89PNG\r\n\x1a\n"), 0o600))
+	broken := filepath.Join(dir, "broken.docx")
+	require.NoError(t, os.WriteFile(broken, []byte("not a zip"), 0o600))
+
+	x := New().WithMaxSize(50)
+	for _, tc := range []struct {
+		path string
+		want error
+	}{
+		{big, ErrTooLarge},
+		{image, ErrUnsupported},
+		{filepath.Join(dir, "missing.pdf"), os.ErrNotExist},
+		{broken, nil},
+	} {
+		_, err := x.File(tc.path)
+		require.Error(t, err, tc.path)
+		var fileErr *FileError
+		require.True(t, errors.As(err, &fileErr), tc.path)
+		assert.Equal(t, tc.path, fileErr.Path)
+		assert.Contains(t, err.Error(), tc.path)
+		if tc.want != nil {
+			assert.ErrorIs(t, err, tc.want, tc.path)
+		}
+	}
+
+	_, err := x.Extract(TypeText, bytes.Repeat([]byte("a"), 51))
+	assert.ErrorIs(t, err, ErrTooLarge)
+	_, err = x.Extract("image/png", nil)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestExtractor_Register(t *testing.T) {
+	x := New()
+	assert.False(t, x.Supports("text/x-org"))
+	x.Register("text/x-org", func(data []byte) (Document, error) {
+		return Document{Title: "Org", Text: string(data)}, nil
+	})
+	assert.True(t, x.Supports("text/x-org"))
+	assert.Contains(t, x.Types(), "text/x-org")
+
+	doc, err := x.Extract("text/x-org", []byte("* TODO"))
+	require.NoError(t, err)
+	assert.Equal(t, Document{MimeType: "text/x-org", Title: "Org", Text: "* TODO"}, doc)
+}
+
+func TestText_Encodings(t *testing.T) {
+	for name, tc := range map[string]struct {
+		data []byte
+		want string
+	}{
+		"utf-8 with BOM": {[]byte("\ufeffcafé"), "café"},
+		"utf-16le":       {[]byte{0xFF, 0xFE, 'c', 0, 'a', 0, 'f', 0, 0xE9, 0}, "café"},
+		"utf-16be":       {[]byte{0xFE, 0xFF, 0, 'c', 0, 'a', 0, 'f', 0, 0xE9}, "café"},
+		"windows-1252":   {[]byte("caf\xe9 \x93quoted\x94"), "café “quoted”"},
+	} {
+		doc, err := Text(tc.data)
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.want, doc.Text, name)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	page := []byte(`<!DOCTYPE html>
+<html lang="fr"><head>
+<meta charset="iso-8859-1">
+<title>  Le caf` + "\xe9" + `
+  du coin </title>
+<meta name="author" content="Marie Curie">
+<meta name="description" content="Where to get coffee">
+<meta property="article:published_time" content="2024-06-01T08:00:00+02:00">
+<style>body { color: red }</style>
+<script>var tracking = true;</script>
+</head><body>
+<h1>Ignored heading</h1>
+<p>Open from <b>7am</b>.</p>
+</body></html>`)
+	doc, err := HTML(page)
+	require.NoError(t, err)
+	assert.Equal(t, "Le café du coin", doc.Title)
+	assert.Equal(t, "Marie Curie", doc.Author)
+	assert.Equal(t, time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC), doc.Created)
+	assert.Equal(t, map[string]string{"description": "Where to get coffee", "language": "fr"}, doc.Metadata)
+	assert.Contains(t, doc.Text, "Open from 7am.")
+	assert.NotContains(t, doc.Text, "tracking")
+	assert.NotContains(t, doc.Text, "color")
+
+	doc, err = HTML([]byte(`<html><body><h1>Only a heading</h1><p>Body</p></body></html>`))
+	require.NoError(t, err)
+	assert.Equal(t, "Only a heading", doc.Title)
+}
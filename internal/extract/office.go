@@ -0,0 +1,274 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxPartSize bounds the decompressed size of a part of a DOCX or ODT
+// file, which a small file can inflate far beyond its own size.
+const maxPartSize = 256 << 20
+
+// DOCX extracts a Word document: the text of its paragraphs and tables,
+// and the title, author, dates and other properties of docProps/core.xml
+// and docProps/app.xml.
+func DOCX(data []byte) (Document, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Document{}, fmt.Errorf("not a Word document: %w", err)
+	}
+	body, err := readPart(zr, "word/document.xml")
+	if err != nil {
+		return Document{}, fmt.Errorf("not a Word document: %w", err)
+	}
+	text, err := xmlText(body, docxBreaks)
+	if err != nil {
+		return Document{}, fmt.Errorf("word/document.xml: %w", err)
+	}
+	doc := Document{Metadata: map[string]string{}, Text: text}
+	if core, err := readPart(zr, "docProps/core.xml"); err == nil {
+		readProperties(&doc, core)
+	}
+	if app, err := readPart(zr, "docProps/app.xml"); err == nil {
+		readProperties(&doc, app)
+	}
+	return doc, nil
+}
+
+// docxBreaks says how WordprocessingML elements break text: paragraphs
+// and table rows end a line, breaks start one, tabs and cells become tabs.
+// Only text elements count, which leaves out deleted text and field codes.
+var docxBreaks = breaks{
+	text:    map[string]bool{"t": true},
+	endLine: map[string]bool{"p": true, "tr": true},
+	newline: map[string]bool{"br": true, "cr": true},
+	tab:     map[string]bool{"tab": true},
+	endTab:  map[string]bool{"tc": true},
+}
+
+// ODT extracts an OpenDocument text document: the text of its paragraphs,
+// headings, lists and tables, and the title, author, dates and statistics
+// of meta.xml.
+func ODT(data []byte) (Document, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Document{}, fmt.Errorf("not an OpenDocument file: %w", err)
+	}
+	body, err := readPart(zr, "content.xml")
+	if err != nil {
+		return Document{}, fmt.Errorf("not an OpenDocument file: %w", err)
+	}
+	text, err := xmlText(body, odtBreaks)
+	if err != nil {
+		return Document{}, fmt.Errorf("content.xml: %w", err)
+	}
+	doc := Document{Metadata: map[string]string{}, Text: text}
+	if m, err := readPart(zr, "meta.xml"); err == nil {
+		readProperties(&doc, m)
+	}
+	return doc, nil
+}
+
+// odtBreaks says how OpenDocument elements break text. Paragraphs and
+// headings hold the text, in which white space is collapsed as in HTML;
+// notes, comments and tracked deletions are left out, as they are from
+// Word documents.
+var odtBreaks = breaks{
+	text:     map[string]bool{"p": true, "h": true},
+	collapse: true,
+	skip:     map[string]bool{"note": true, "annotation": true, "tracked-changes": true},
+	endLine:  map[string]bool{"p": true, "h": true, "table-row": true},
+	newline:  map[string]bool{"line-break": true},
+	tab:      map[string]bool{"tab": true},
+	endTab:   map[string]bool{"table-cell": true},
+	spaces:   "s",
+}
+
+func readPart(zr *zip.Reader, name string) ([]byte, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxPartSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPartSize {
+		return nil, fmt.Errorf("%s: %w: over %d bytes uncompressed", name, ErrTooLarge, maxPartSize)
+	}
+	return data, nil
+}
+
+// breaks describes the elements of a document format by local name.
+type breaks struct {
+	// text lists the elements whose character data is text. With
+	// collapse, runs of white space in it are a single space.
+	text     map[string]bool
+	collapse bool
+	// skip lists elements left out with their content.
+	skip map[string]bool
+	// endLine elements end a line when they close; newline and tab
+	// elements insert a line break or tab; endTab elements insert a tab
+	// when they close.
+	endLine, newline, tab, endTab map[string]bool
+	// spaces names the element standing for runs of spaces, with their
+	// number in its c attribute.
+	spaces string
+}
+
+// xmlText returns the text of an XML document with the given breaks.
+func xmlText(data []byte, br breaks) (string, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var b bytes.Buffer
+	var inText, skip int
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if skip > 0 || br.skip[name] {
+				skip++
+				continue
+			}
+			if br.text[name] {
+				inText++
+			}
+			switch {
+			case br.newline[name]:
+				b.WriteByte('\n')
+			case br.tab[name]:
+				b.WriteByte('\t')
+			case name == br.spaces && br.spaces != "":
+				n := 1
+				for _, a := range t.Attr {
+					if a.Name.Local == "c" {
+						fmt.Sscan(a.Value, &n)
+					}
+				}
+				b.WriteString(strings.Repeat(" ", min(max(n, 1), 1000)))
+			}
+		case xml.EndElement:
+			name := t.Name.Local
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if br.text[name] {
+				inText--
+			}
+			switch {
+			case br.endLine[name]:
+				b.WriteByte('\n')
+			case br.endTab[name]:
+				// A cell's last paragraph ends with the cell.
+				if bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+					b.Truncate(b.Len() - 1)
+				}
+				b.WriteByte('\t')
+			}
+		case xml.CharData:
+			if skip == 0 && inText > 0 {
+				if br.collapse {
+					t = spaceRE.ReplaceAll(t, []byte(" "))
+				}
+				b.Write(t)
+			}
+		}
+	}
+	return normalizeText(strings.ReplaceAll(b.String(), "\t\n", "\n")), nil
+}
+
+// readProperties reads the document properties of docProps/core.xml,
+// docProps/app.xml or an OpenDocument meta.xml, which share Dublin Core
+// names.
+func readProperties(doc *Document, data []byte) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var name string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name = t.Name.Local
+			if name == "document-statistic" {
+				for _, a := range t.Attr {
+					switch a.Name.Local {
+					case "page-count":
+						doc.Metadata["pages"] = a.Value
+					case "word-count":
+						doc.Metadata["words"] = a.Value
+					}
+				}
+			}
+		case xml.EndElement:
+			name = ""
+		case xml.CharData:
+			value := strings.TrimSpace(string(t))
+			if value == "" {
+				continue
+			}
+			switch name {
+			case "title":
+				doc.Title = value
+			case "creator", "initial-creator":
+				if doc.Author == "" || name == "initial-creator" {
+					doc.Author = value
+				}
+			case "lastModifiedBy":
+				doc.Metadata["last_modified_by"] = value
+			case "subject":
+				doc.Metadata["subject"] = value
+			case "keywords", "keyword":
+				if k := doc.Metadata["keywords"]; k != "" {
+					value = k + ", " + value
+				}
+				doc.Metadata["keywords"] = value
+			case "description":
+				doc.Metadata["description"] = value
+			case "language":
+				doc.Metadata["language"] = value
+			case "created", "creation-date":
+				doc.Created = parseISOTime(value)
+			case "modified", "date":
+				doc.Modified = parseISOTime(value)
+			case "Pages":
+				doc.Metadata["pages"] = value
+			case "Words":
+				doc.Metadata["words"] = value
+			}
+		}
+	}
+}
+
+// isoLayouts are the forms of the W3C dates in document properties and
+// meta elements.
+var isoLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func parseISOTime(s string) time.Time {
+	for _, layout := range isoLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,647 @@
+package extract
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// PDF extracts a PDF's text, page by page, and the title, author, dates,
+// subject and keywords of its document information dictionary.
+//
+// Text is read through each font's ToUnicode map or, for fonts without
+// one, its standard encoding, which covers files from word processors,
+// browsers and TeX. Pages that are scanned images of text have none, and
+// encrypted files are refused.
+func PDF(data []byte) (Document, error) {
+	f, err := parsePDF(data)
+	if err != nil {
+		return Document{}, err
+	}
+	if _, ok := f.trailer["Encrypt"]; ok {
+		return Document{}, errors.New("encrypted PDFs are not supported")
+	}
+	pages := f.pages()
+	var texts []string
+	for _, page := range pages {
+		if text := f.pageText(page); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	doc := Document{
+		Metadata: map[string]string{"pages": strconv.Itoa(len(pages))},
+		Text:     normalizeText(strings.Join(texts, "\n\n")),
+	}
+	if doc.Text == "" {
+		return Document{}, errors.New("no text found: the pages may be scanned images")
+	}
+	f.readInfo(&doc)
+	return doc, nil
+}
+
+// pdfFile is a parsed PDF: its objects by number and its trailer.
+type pdfFile struct {
+	objects map[int]any
+	trailer pdfDict
+	fonts   map[pdfRef]*pdfFont
+}
+
+// objRE matches the start of an indirect object.
+var objRE = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// parsePDF reads every object in data. Rather than trusting the
+// cross-reference table, which is often wrong in files that were edited
+// or repaired, it scans for objects, letting later definitions replace
+// earlier ones as incremental updates do, and then reads the objects
+// compressed into object streams.
+func parsePDF(data []byte) (*pdfFile, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, errors.New("not a PDF file")
+	}
+	f := &pdfFile{objects: map[int]any{}, trailer: pdfDict{}, fonts: map[pdfRef]*pdfFont{}}
+	end := 0
+	for _, m := range objRE.FindAllSubmatchIndex(data, -1) {
+		// Skip matches inside the streams of objects already read.
+		if m[0] < end {
+			continue
+		}
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		l := &lexer{data: data, pos: m[1]}
+		obj, err := l.object()
+		if err != nil {
+			continue
+		}
+		if dict, ok := obj.(pdfDict); ok {
+			if s := l.stream(dict); s != nil {
+				obj = s
+				// Cross-reference streams stand in for the trailer.
+				if dict["Type"] == pdfName("XRef") {
+					maps.Copy(f.trailer, dict)
+				}
+			}
+		}
+		f.objects[num] = obj
+		end = l.pos
+	}
+	for i := 0; ; {
+		n := bytes.Index(data[i:], []byte("trailer"))
+		if n < 0 {
+			break
+		}
+		l := &lexer{data: data, pos: i + n + len("trailer")}
+		if v, err := l.token(); err == nil {
+			if dict, ok := v.(pdfDict); ok {
+				maps.Copy(f.trailer, dict)
+			}
+		}
+		i += n + len("trailer")
+	}
+	for _, num := range slices.Sorted(maps.Keys(f.objects)) {
+		if s, ok := f.objects[num].(*pdfStream); ok && s.dict["Type"] == pdfName("ObjStm") {
+			f.readObjectStream(s)
+		}
+	}
+	if len(f.objects) == 0 {
+		return nil, errors.New("not a PDF file: no objects")
+	}
+	return f, nil
+}
+
+// readObjectStream adds the objects compressed into s, a list of object
+// numbers and offsets followed by the objects, unless they are defined
+// outside it.
+func (f *pdfFile) readObjectStream(s *pdfStream) {
+	data, err := f.decode(s)
+	if err != nil {
+		return
+	}
+	n, _ := f.number(s.dict["N"])
+	first, _ := f.number(s.dict["First"])
+	header := &lexer{data: data}
+	for range int(n) {
+		num, err1 := header.token()
+		off, err2 := header.token()
+		if err1 != nil || err2 != nil {
+			return
+		}
+		num1, ok1 := num.(float64)
+		off1, ok2 := off.(float64)
+		if !ok1 || !ok2 {
+			return
+		}
+		if _, ok := f.objects[int(num1)]; ok {
+			continue
+		}
+		pos := int(first) + int(off1)
+		if pos < 0 || pos >= len(data) {
+			continue
+		}
+		l := &lexer{data: data, pos: pos}
+		if obj, err := l.object(); err == nil {
+			f.objects[int(num1)] = obj
+		}
+	}
+}
+
+// resolve follows references to the object they refer to.
+func (f *pdfFile) resolve(v any) any {
+	for range 32 {
+		r, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = f.objects[r.num]
+	}
+	return nil
+}
+
+// dict returns the dictionary v is or refers to, or a stream's
+// dictionary.
+func (f *pdfFile) dict(v any) pdfDict {
+	switch v := f.resolve(v).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+func (f *pdfFile) array(v any) pdfArray {
+	a, _ := f.resolve(v).(pdfArray)
+	return a
+}
+
+func (f *pdfFile) number(v any) (float64, bool) {
+	n, ok := f.resolve(v).(float64)
+	return n, ok
+}
+
+// decode returns a stream's data with its filters undone. Streams of
+// images, compressed other than with Flate, or with predictors, which
+// only images and cross-reference streams use, are not decoded.
+func (f *pdfFile) decode(s *pdfStream) ([]byte, error) {
+	var filters, params pdfArray
+	switch v := f.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters, params = pdfArray{v}, pdfArray{f.resolve(s.dict["DecodeParms"])}
+	case pdfArray:
+		filters, params = v, f.array(s.dict["DecodeParms"])
+	}
+	data := s.data
+	for i, filter := range filters {
+		if i < len(params) {
+			if p, ok := f.number(f.dict(params[i])["Predictor"]); ok && p > 1 {
+				return nil, fmt.Errorf("unsupported predictor %v", p)
+			}
+		}
+		var err error
+		switch name, _ := f.resolve(filter).(pdfName); name {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data)
+		case "ASCIIHexDecode", "AHx":
+			data, err = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filter, err)
+		}
+	}
+	return data, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		// Some writers leave out the zlib header.
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, maxPartSize+1))
+	if len(out) > maxPartSize {
+		return nil, fmt.Errorf("%w: stream over %d bytes uncompressed", ErrTooLarge, maxPartSize)
+	}
+	// Streams cut short or with a bad checksum are common, and what was
+	// inflated before the error is usable.
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	digits := make([]byte, 0, len(data))
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	_, err := hex.Decode(out, digits)
+	return out, err
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	src := make([]byte, 0, len(data))
+	for _, c := range bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~")) {
+		if !isSpace(c) {
+			src = append(src, c)
+		}
+	}
+	if i := bytes.Index(src, []byte("~>")); i >= 0 {
+		src = src[:i]
+	}
+	// Each z stands for four zero bytes.
+	out := make([]byte, 4*len(src)+4)
+	n, _, err := ascii85.Decode(out, src, true)
+	return out[:n], err
+}
+
+// readInfo reads the document information dictionary into doc.
+func (f *pdfFile) readInfo(doc *Document) {
+	info := f.dict(f.trailer["Info"])
+	doc.Title = f.text(info["Title"])
+	doc.Author = f.text(info["Author"])
+	doc.Created = pdfDate(f.text(info["CreationDate"]))
+	doc.Modified = pdfDate(f.text(info["ModDate"]))
+	for key, name := range map[pdfName]string{"Subject": "subject", "Keywords": "keywords"} {
+		if s := f.text(info[key]); s != "" {
+			doc.Metadata[name] = s
+		}
+	}
+}
+
+// text decodes a text string: UTF-16 after a byte order mark, UTF-8
+// after one, and otherwise PDFDocEncoding, which agrees with Latin-1
+// but for a few punctuation marks.
+func (f *pdfFile) text(v any) string {
+	s, ok := f.resolve(v).(pdfString)
+	if !ok {
+		return ""
+	}
+	switch {
+	case bytes.HasPrefix(s, []byte{0xFE, 0xFF}):
+		return strings.TrimSpace(utf16BE(s[2:]))
+	case bytes.HasPrefix(s, []byte{0xEF, 0xBB, 0xBF}):
+		return strings.TrimSpace(string(s[3:]))
+	}
+	runes := make([]rune, len(s))
+	for i, c := range s {
+		runes[i] = rune(c)
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+func utf16BE(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// pdfDateRE matches a PDF date, D:YYYYMMDDHHmmSSOHH'mm', of which all
+// but the year may be left out.
+var pdfDateRE = regexp.MustCompile(`^(?:D:)?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?(?:([Zz+-])(\d{2})?'?(\d{2})?)?`)
+
+func pdfDate(s string) time.Time {
+	m := pdfDateRE.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return time.Time{}
+	}
+	n := func(i, def int) int {
+		if v, err := strconv.Atoi(m[i]); err == nil {
+			return v
+		}
+		return def
+	}
+	offset := (n(8, 0)*60 + n(9, 0)) * 60
+	if m[7] == "-" {
+		offset = -offset
+	}
+	t := time.Date(n(1, 0), time.Month(n(2, 1)), n(3, 1), n(4, 0), n(5, 0), n(6, 0), 0, time.FixedZone("", offset))
+	return t.UTC()
+}
+
+// The objects of a PDF file besides numbers (float64), booleans and
+// null (nil).
+type (
+	pdfName    string
+	pdfString  []byte
+	pdfDict    map[pdfName]any
+	pdfArray   []any
+	pdfKeyword string
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		data []byte
+	}
+)
+
+var errSyntax = errors.New("PDF syntax error")
+
+// lexer reads PDF objects, and the operators between them in content
+// streams.
+type lexer struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case isSpace(c):
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+// object reads the next object, including references, which look like
+// two numbers to token.
+func (l *lexer) object() (any, error) {
+	v, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	if num, ok := v.(float64); ok && isIndex(num) {
+		save := l.pos
+		if gen, err := l.token(); err == nil {
+			if gen, ok := gen.(float64); ok && isIndex(gen) {
+				if r, err := l.token(); err == nil && r == pdfKeyword("R") {
+					return pdfRef{int(num), int(gen)}, nil
+				}
+			}
+		}
+		l.pos = save
+	}
+	return v, nil
+}
+
+func isIndex(n float64) bool {
+	return n >= 0 && n == math.Trunc(n) && n < math.MaxInt32
+}
+
+// token reads the next object, other than a reference, or keyword. It
+// returns io.EOF at the end of the data, and otherwise always advances,
+// so callers may skip past errors.
+func (l *lexer) token() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+	c := l.data[l.pos]
+	l.pos++
+	switch c {
+	case '/':
+		return l.name(), nil
+	case '(':
+		return l.literal(), nil
+	case '<':
+		if l.pos < len(l.data) && l.data[l.pos] == '<' {
+			l.pos++
+			return l.dict()
+		}
+		return l.hex(), nil
+	case '>':
+		if l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+			return pdfKeyword(">>"), nil
+		}
+		return nil, errSyntax
+	case '[':
+		return l.array()
+	case ']', '{', '}', ')':
+		return pdfKeyword(string(c)), nil
+	}
+	start := l.pos - 1
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if c == '+' || c == '-' || c == '.' || ('0' <= c && c <= '9') {
+		n, _ := strconv.ParseFloat(word, 64)
+		return n, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+func (l *lexer) name() pdfName {
+	var b []byte
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '#' && l.pos+2 <= len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos:l.pos+2]), 16, 8); err == nil {
+				c = byte(v)
+				l.pos += 2
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfName(b)
+}
+
+// literal reads a string in parentheses, which may nest, after the
+// opening one.
+func (l *lexer) literal() pdfString {
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return b
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// A backslash at the end of a line continues the string.
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				v := int(c - '0')
+				for i := 0; i < 2 && l.pos < len(l.data) && '0' <= l.data[l.pos] && l.data[l.pos] <= '7'; i++ {
+					v = v*8 + int(l.data[l.pos]-'0')
+					l.pos++
+				}
+				c = byte(v)
+			}
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+func (l *lexer) hex() pdfString {
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		end = len(l.data) - l.pos
+	}
+	s, _ := asciiHexDecode(l.data[l.pos : l.pos+end])
+	l.pos = min(l.pos+end+1, len(l.data))
+	return s
+}
+
+// maxDepth bounds the nesting of arrays and dictionaries.
+const maxDepth = 64
+
+func (l *lexer) dict() (any, error) {
+	if l.depth++; l.depth > maxDepth {
+		return nil, errSyntax
+	}
+	defer func() { l.depth-- }()
+	d := pdfDict{}
+	for {
+		k, err := l.token()
+		if err != nil {
+			return nil, err
+		}
+		if k == pdfKeyword(">>") {
+			return d, nil
+		}
+		key, ok := k.(pdfName)
+		if !ok {
+			return nil, errSyntax
+		}
+		v, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		if v == pdfKeyword(">>") {
+			return d, nil
+		}
+		d[key] = v
+	}
+}
+
+func (l *lexer) array() (any, error) {
+	if l.depth++; l.depth > maxDepth {
+		return nil, errSyntax
+	}
+	defer func() { l.depth-- }()
+	var a pdfArray
+	for {
+		v, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		if v == pdfKeyword("]") {
+			return a, nil
+		}
+		a = append(a, v)
+	}
+}
+
+// stream reads the stream following dict, if there is one. Its end is
+// found from its Length when that is given directly and right, and
+// otherwise by looking for endstream.
+func (l *lexer) stream(dict pdfDict) *pdfStream {
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		return nil
+	}
+	l.pos += len("stream")
+	if bytes.HasPrefix(l.data[l.pos:], []byte("\r\n")) {
+		l.pos += 2
+	} else if l.pos < len(l.data) && (l.data[l.pos] == '\n' || l.data[l.pos] == '\r') {
+		l.pos++
+	}
+	start := l.pos
+	if n, ok := dict["Length"].(float64); ok && n >= 0 && start+int(n) <= len(l.data) {
+		end := start + int(n)
+		rest := bytes.TrimLeft(l.data[end:], "\x00\t\n\f\r ")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = len(l.data) - len(rest) + len("endstream")
+			return &pdfStream{dict: dict, data: l.data[start:end]}
+		}
+	}
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		l.pos = len(l.data)
+		return &pdfStream{dict: dict, data: l.data[start:]}
+	}
+	l.pos = start + end + len("endstream")
+	data := l.data[start : start+end]
+	if bytes.HasSuffix(data, []byte("\r\n")) {
+		data = data[:len(data)-2]
+	} else if bytes.HasSuffix(data, []byte("\n")) || bytes.HasSuffix(data, []byte("\r")) {
+		data = data[:len(data)-1]
+	}
+	return &pdfStream{dict: dict, data: data}
+}
@@ -0,0 +1,138 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildPDF writes a PDF of the given objects, numbered from 1, with a
+// cross-reference table and the given trailer entries.
+func buildPDF(trailer string, objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+	return b.Bytes()
+}
+
+// stream returns a stream object of data with the given dictionary
+// entries.
+func stream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(t *testing.T, data string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	_, err := zw.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return b.Bytes()
+}
+
+func TestPDF(t *testing.T) {
+	// The second page uses a composite font, known only through its
+	// ToUnicode map, which is kept in an object stream.
+	toUnicode := deflate(t, `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0003> <00E9>
+<0004> <0020>
+endbfchar
+1 beginbfrange
+<0001> <0002> <0048>
+endbfrange
+endcmap
+end end`)
+	objStm := "11 0 << /Type /Font /Subtype /Type0 /BaseFont /Sans /Encoding /Identity-H /ToUnicode 10 0 R >>"
+	pdf := buildPDF("/Root 1 0 R /Info 8 0 R",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [4 0 R 3 0 R] /Count 2 /Resources << /Font << /F1 5 0 R /F2 11 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [6 0 R] >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding << /Differences [150 /endash] >> >>",
+		stream("", []byte(`BT /F1 12 Tf 14 TL 72 720 Td (Quarterly \(draft\) report) Tj
+0 -14 Td [(Sales gr) -15 (ew) -300 (by 4) 20 (%)] TJ
+T* (Caf\351 \226 menu) Tj ET
+% a comment
+BI /W 1 /H 1 /CS /G /BPC 8 ID `+"\x00"+` EI
+BT /F1 12 Tf 72 600 Td <4E657874> Tj ET`)),
+		stream("/Filter /FlateDecode", deflate(t, "BT /F2 10 Tf 1 0 0 1 72 720 Tm <0001000200040003> Tj ET")),
+		"<< /Title (Quarterly report) /Author <FEFF004100640061> /Subject (Finance) /CreationDate (D:20240305093015+01'00') /ModDate (D:2024) >>",
+		stream("/Type /ObjStm /N 1 /First 5 /Filter /FlateDecode", deflate(t, objStm)),
+		stream("/Filter /FlateDecode", toUnicode),
+	)
+
+	doc, err := PDF(pdf)
+	require.NoError(t, err)
+	assert.Equal(t, "Quarterly report", doc.Title)
+	assert.Equal(t, "Ada", doc.Author)
+	assert.Equal(t, time.Date(2024, 3, 5, 8, 30, 15, 0, time.UTC), doc.Created)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), doc.Modified)
+	assert.Equal(t, map[string]string{"pages": "2", "subject": "Finance"}, doc.Metadata)
+	assert.Equal(t, "Quarterly (draft) report\nSales grew by 4%\nCafé – menu\nNext\n\nHI é", doc.Text)
+}
+
+func TestPDF_Errors(t *testing.T) {
+	page := func(content string) []string {
+		return []string{
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+			stream("", []byte(content)),
+		}
+	}
+	for name, tc := range map[string]struct {
+		data []byte
+		want string
+	}{
+		"not a PDF": {[]byte("<html></html>"), "not a PDF file"},
+		"encrypted": {
+			buildPDF("/Root 1 0 R /Encrypt 5 0 R", append(page("BT (secret) Tj ET"), "<< /Filter /Standard /V 2 >>")...),
+			"encrypted",
+		},
+		"scanned": {
+			buildPDF("/Root 1 0 R", page("q 612 0 0 792 0 0 cm /Im0 Do Q")...),
+			"no text found",
+		},
+	} {
+		_, err := PDF(tc.data)
+		assert.ErrorContains(t, err, tc.want, name)
+	}
+}
+
+func TestPDF_WithoutPageTree(t *testing.T) {
+	// A damaged file whose catalog is missing still has its pages read,
+	// in object order, and streams whose Length is wrong are read to
+	// endstream.
+	pdf := buildPDF("",
+		"<< /Type /Page /Contents 2 0 R >>",
+		"<< /Length 999 >>\nstream\nBT (First) Tj ET\nendstream",
+		"<< /Type /Page /Contents 4 0 R >>",
+		stream("/Filter /ASCIIHexDecode", []byte("42542028536563 6f6e6429 20546a204554>")),
+	)
+	doc, err := PDF(pdf)
+	require.NoError(t, err)
+	assert.Equal(t, "First\n\nSecond", doc.Text)
+	assert.Equal(t, "2", doc.Metadata["pages"])
+}
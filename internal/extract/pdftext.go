@@ -0,0 +1,554 @@
+package extract
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// pdfPage is a page and the resources, such as fonts, it uses, which
+// may be inherited from the page tree above it.
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages returns the pages in the order of the document's page tree or,
+// if it has none that can be read, of their object numbers.
+func (f *pdfFile) pages() []pdfPage {
+	var pages []pdfPage
+	seen := map[pdfRef]bool{}
+	var walk func(v any, resources pdfDict, depth int)
+	walk = func(v any, resources pdfDict, depth int) {
+		if r, ok := v.(pdfRef); ok {
+			if seen[r] {
+				return
+			}
+			seen[r] = true
+		}
+		node := f.dict(v)
+		if node == nil || depth > maxDepth {
+			return
+		}
+		if res := f.dict(node["Resources"]); res != nil {
+			resources = res
+		}
+		if kids, ok := f.resolve(node["Kids"]).(pdfArray); ok || node["Type"] == pdfName("Pages") {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{dict: node, resources: resources})
+	}
+	root := f.dict(f.trailer["Root"])
+	nums := slices.Sorted(maps.Keys(f.objects))
+	if root == nil {
+		for _, num := range nums {
+			if d := f.dict(f.objects[num]); d["Type"] == pdfName("Catalog") {
+				root = d
+				break
+			}
+		}
+	}
+	if root != nil {
+		walk(root["Pages"], nil, 0)
+	}
+	if len(pages) == 0 {
+		for _, num := range nums {
+			if d, ok := f.objects[num].(pdfDict); ok && d["Type"] == pdfName("Page") {
+				pages = append(pages, pdfPage{dict: d, resources: f.dict(d["Resources"])})
+			}
+		}
+	}
+	return pages
+}
+
+// pageText returns the text shown on a page.
+func (f *pdfFile) pageText(p pdfPage) string {
+	var content [][]byte
+	switch v := f.resolve(p.dict["Contents"]).(type) {
+	case *pdfStream:
+		content = append(content, f.streamData(v))
+	case pdfArray:
+		for _, s := range v {
+			if s, ok := f.resolve(s).(*pdfStream); ok {
+				content = append(content, f.streamData(s))
+			}
+		}
+	}
+	w := &textWriter{f: f}
+	w.run(bytes.Join(content, []byte("\n")), p.resources, 0)
+	return w.b.String()
+}
+
+// streamData returns a stream's decoded data, or nothing if it cannot be
+// decoded.
+func (f *pdfFile) streamData(s *pdfStream) []byte {
+	data, err := f.decode(s)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// textWriter collects the text shown by content streams. It follows the
+// text position only as far as telling when text starts a new line or
+// is moved along the same one, which it takes for the space between
+// words.
+type textWriter struct {
+	f *pdfFile
+	b strings.Builder
+	// x and y are the start of the current line, and leading the
+	// distance between lines.
+	x, y, leading float64
+	// shownY is the line text was last shown on, and moved records a
+	// move since.
+	shownY float64
+	moved  bool
+}
+
+// maxFormDepth bounds the nesting of form XObjects, which content
+// streams draw like images and may hold text.
+const maxFormDepth = 8
+
+func (w *textWriter) run(content []byte, resources pdfDict, depth int) {
+	fonts := w.f.dict(resources["Font"])
+	xobjects := w.f.dict(resources["XObject"])
+	var font *pdfFont
+	var operands []any
+	l := &lexer{data: content}
+	for {
+		v, err := l.object()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			operands = operands[:0]
+			continue
+		}
+		op, ok := v.(pdfKeyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+		num := func(i int) float64 {
+			n, _ := operands[len(operands)-i].(float64)
+			return n
+		}
+		switch n := len(operands); op {
+		case "BT":
+			w.moveTo(0, 0)
+		case "Tf":
+			if n >= 2 {
+				name, _ := operands[n-2].(pdfName)
+				font = w.f.font(fonts[name])
+			}
+		case "TL":
+			if n >= 1 {
+				w.leading = num(1)
+			}
+		case "Td", "TD":
+			if n >= 2 {
+				w.moveTo(w.x+num(2), w.y+num(1))
+				if op == "TD" {
+					w.leading = -num(1)
+				}
+			}
+		case "Tm":
+			if n >= 6 {
+				w.moveTo(num(2), num(1))
+			}
+		case "T*":
+			w.moveTo(w.x, w.y-w.leading)
+		case "Tj", "'", `"`:
+			if op != "Tj" {
+				w.moveTo(w.x, w.y-w.leading)
+			}
+			if n >= 1 {
+				if s, ok := operands[n-1].(pdfString); ok {
+					w.show(font, s)
+				}
+			}
+		case "TJ":
+			if n >= 1 {
+				a, _ := operands[n-1].(pdfArray)
+				for _, item := range a {
+					switch item := item.(type) {
+					case pdfString:
+						w.show(font, item)
+					case float64:
+						// A move right of more than a fifth of the font
+						// size, in thousandths, separates words.
+						if item < -200 {
+							w.moved = true
+						}
+					}
+				}
+			}
+		case "Do":
+			if n >= 1 && depth < maxFormDepth {
+				name, _ := operands[n-1].(pdfName)
+				if form, ok := w.f.resolve(xobjects[name]).(*pdfStream); ok && form.dict["Subtype"] == pdfName("Form") {
+					res := w.f.dict(form.dict["Resources"])
+					if res == nil {
+						res = resources
+					}
+					w.run(w.f.streamData(form), res, depth+1)
+				}
+			}
+		case "BI":
+			l.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+func (w *textWriter) moveTo(x, y float64) {
+	w.x, w.y = x, y
+	w.moved = true
+}
+
+// show writes the text of s, after a line break or space if the text
+// position moved since text was last shown.
+func (w *textWriter) show(font *pdfFont, s pdfString) {
+	text := font.decode(s)
+	if text == "" {
+		return
+	}
+	if w.b.Len() > 0 {
+		last := w.b.String()[w.b.Len()-1]
+		switch {
+		case math.Abs(w.y-w.shownY) > 0.01:
+			if last != '\n' {
+				w.b.WriteByte('\n')
+			}
+		case w.moved && last != ' ' && last != '\n' && !strings.HasPrefix(text, " "):
+			w.b.WriteByte(' ')
+		}
+	}
+	w.b.WriteString(text)
+	w.shownY = w.y
+	w.moved = false
+}
+
+// skipInlineImage skips an inline image's parameters and data, which
+// end with EI.
+func (l *lexer) skipInlineImage() {
+	for {
+		v, err := l.token()
+		if err == io.EOF {
+			return
+		}
+		if v == pdfKeyword("ID") {
+			break
+		}
+	}
+	for i := l.pos + 1; i+2 <= len(l.data); i++ {
+		if l.data[i] == 'E' && l.data[i+1] == 'I' && isSpace(l.data[i-1]) &&
+			(i+2 == len(l.data) || isSpace(l.data[i+2])) {
+			l.pos = i + 2
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
+
+// pdfFont decodes the strings shown in a font to text.
+type pdfFont struct {
+	toUnicode *cmap
+	// codeLen is the length of codes when toUnicode does not give it:
+	// two bytes for composite fonts, one for simple ones.
+	codeLen int
+	// encoding maps the codes of simple fonts to characters.
+	encoding *[256]rune
+}
+
+// font returns the font v refers to, reading it once per document.
+func (f *pdfFile) font(v any) *pdfFont {
+	r, isRef := v.(pdfRef)
+	if ft, ok := f.fonts[r]; isRef && ok {
+		return ft
+	}
+	d := f.dict(v)
+	if d == nil {
+		return nil
+	}
+	ft := &pdfFont{codeLen: 1}
+	if s, ok := f.resolve(d["ToUnicode"]).(*pdfStream); ok {
+		if data, err := f.decode(s); err == nil {
+			ft.toUnicode = parseCMap(data)
+		}
+	}
+	if d["Subtype"] == pdfName("Type0") {
+		ft.codeLen = 2
+	} else {
+		ft.encoding = f.encoding(d["Encoding"])
+	}
+	if isRef {
+		f.fonts[r] = ft
+	}
+	return ft
+}
+
+var (
+	winAnsiEncoding  = encodingTable(charmap.Windows1252)
+	macRomanEncoding = encodingTable(charmap.Macintosh)
+)
+
+func encodingTable(cm *charmap.Charmap) *[256]rune {
+	var t [256]rune
+	for i := 0x20; i < 256; i++ {
+		if r := cm.DecodeByte(byte(i)); r != '\ufffd' {
+			t[i] = r
+		}
+	}
+	return &t
+}
+
+// encoding returns a simple font's encoding: a named one, or one with
+// differences from a named one. Fonts without one, whose encoding is
+// built into them, are read as WinAnsiEncoding, which most follow.
+func (f *pdfFile) encoding(v any) *[256]rune {
+	named := func(v any) *[256]rune {
+		if f.resolve(v) == pdfName("MacRomanEncoding") {
+			return macRomanEncoding
+		}
+		return winAnsiEncoding
+	}
+	d := f.dict(v)
+	if d == nil {
+		return named(v)
+	}
+	t := *named(d["BaseEncoding"])
+	code := 0
+	for _, item := range f.array(d["Differences"]) {
+		switch item := f.resolve(item).(type) {
+		case float64:
+			code = int(item)
+		case pdfName:
+			if 0 <= code && code < 256 {
+				if r := glyphRune(string(item)); r != 0 {
+					t[code] = r
+				}
+			}
+			code++
+		}
+	}
+	return &t
+}
+
+// glyphNames maps the names of glyphs outside the letters and digits to
+// their characters, for the punctuation encoding differences commonly
+// name.
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quotesingle": '\'', "parenleft": '(',
+	"parenright": ')', "asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-',
+	"period": '.', "slash": '/', "colon": ':', "semicolon": ';', "less": '<',
+	"equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[',
+	"backslash": '\\', "bracketright": ']', "asciicircum": '^', "underscore": '_',
+	"grave": '`', "braceleft": '{', "bar": '|', "braceright": '}', "asciitilde": '~',
+	"quoteleft": '‘', "quoteright": '’', "quotedblleft": '“', "quotedblright": '”',
+	"endash": '–', "emdash": '—', "bullet": '•', "ellipsis": '…', "fi": 'ﬁ', "fl": 'ﬂ',
+	"zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5',
+	"six": '6', "seven": '7', "eight": '8', "nine": '9',
+}
+
+// glyphRune returns the character a glyph name stands for: a letter
+// named by itself, a named punctuation mark, or a character named by its
+// code point, as in uni00E9.
+func glyphRune(name string) rune {
+	if len(name) == 1 && ('a' <= name[0] && name[0] <= 'z' || 'A' <= name[0] && name[0] <= 'Z') {
+		return rune(name[0])
+	}
+	if r, ok := glyphNames[name]; ok {
+		return r
+	}
+	for _, prefix := range []string{"uni", "u"} {
+		if hex, ok := strings.CutPrefix(name, prefix); ok && len(hex) >= 4 && len(hex) <= 6 {
+			if n, err := strconv.ParseUint(hex, 16, 32); err == nil {
+				return rune(n)
+			}
+		}
+	}
+	return 0
+}
+
+// decode returns the text of a string shown in ft. Codes neither the
+// font's ToUnicode map nor its encoding map to a character are left out.
+// Without a font, strings are read as WinAnsiEncoding.
+func (ft *pdfFont) decode(s pdfString) string {
+	if ft == nil {
+		ft = &pdfFont{codeLen: 1, encoding: winAnsiEncoding}
+	}
+	var b strings.Builder
+	for len(s) > 0 {
+		n := min(ft.codeLen, len(s))
+		if ft.toUnicode != nil {
+			n = ft.toUnicode.codeLength(s, n)
+		}
+		code := s[:n]
+		s = s[n:]
+		if ft.toUnicode != nil {
+			if text, ok := ft.toUnicode.lookup(code); ok {
+				b.WriteString(text)
+				continue
+			}
+		}
+		if n == 1 && ft.encoding != nil {
+			if r := ft.encoding[code[0]]; r != 0 {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		if r < ' ' && r != '\t' {
+			return -1
+		}
+		return r
+	}, b.String())
+}
+
+// cmap is a ToUnicode CMap, mapping character codes of one or more
+// bytes to text.
+type cmap struct {
+	// space holds the ranges of valid codes, which give their lengths.
+	space  []codeRange
+	chars  map[string]string
+	ranges []cmapRange
+}
+
+type codeRange struct{ lo, hi []byte }
+
+// cmapRange maps a range of codes to consecutive characters from
+// first, or to the strings of dst in turn.
+type cmapRange struct {
+	codeRange
+	first []rune
+	dst   []string
+}
+
+// parseCMap reads the code space and the bfchar and bfrange mappings of
+// a CMap, a PostScript program of which nothing else is needed.
+func parseCMap(data []byte) *cmap {
+	c := &cmap{chars: map[string]string{}}
+	l := &lexer{data: data}
+	var operands []any
+	for {
+		v, err := l.token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue
+		}
+		op, ok := v.(pdfKeyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 {
+					c.space = append(c.space, codeRange{lo, hi})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					c.chars[string(src)] = utf16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 {
+					continue
+				}
+				r := cmapRange{codeRange: codeRange{lo, hi}}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					r.first = []rune(utf16BE(dst))
+				case pdfArray:
+					for _, d := range dst {
+						s, _ := d.(pdfString)
+						r.dst = append(r.dst, utf16BE(s))
+					}
+				}
+				c.ranges = append(c.ranges, r)
+			}
+		}
+		operands = operands[:0]
+	}
+	slices.SortStableFunc(c.space, func(a, b codeRange) int { return len(a.lo) - len(b.lo) })
+	return c
+}
+
+// codeLength returns the length of the code at the start of s: the
+// shortest the code space allows, or def if it says nothing.
+func (c *cmap) codeLength(s []byte, def int) int {
+	for _, r := range c.space {
+		if len(r.lo) <= len(s) && r.contains(s[:len(r.lo)]) {
+			return len(r.lo)
+		}
+	}
+	return def
+}
+
+// contains reports whether code is in r, comparing byte by byte as code
+// spaces do.
+func (r codeRange) contains(code []byte) bool {
+	if len(code) != len(r.lo) {
+		return false
+	}
+	for i, b := range code {
+		if b < r.lo[i] || b > r.hi[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cmap) lookup(code []byte) (string, bool) {
+	if text, ok := c.chars[string(code)]; ok {
+		return text, true
+	}
+	for _, r := range c.ranges {
+		if len(code) != len(r.lo) || bytes.Compare(code, r.lo) < 0 || bytes.Compare(code, r.hi) > 0 {
+			continue
+		}
+		offset := codeValue(code) - codeValue(r.lo)
+		switch {
+		case r.dst != nil:
+			if offset < len(r.dst) {
+				return r.dst[offset], true
+			}
+		case len(r.first) > 0:
+			runes := slices.Clone(r.first)
+			runes[len(runes)-1] += rune(offset)
+			return string(runes), true
+		}
+	}
+	return "", false
+}
+
+func codeValue(code []byte) int {
+	v := 0
+	for _, b := range code {
+		v = v<<8 | int(b)
+	}
+	return v
+}
@@ -0,0 +1,158 @@
+package extract
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/email"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Text extracts a plain text file. UTF-8 and UTF-16 files with a byte
+// order mark are decoded as such, and other files that are not valid
+// UTF-8 as Windows-1252, the usual encoding of older text files.
+func Text(data []byte) (Document, error) {
+	return Document{Text: normalizeText(decodeText(data))}, nil
+}
+
+func decodeText(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		data = data[3:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		dec := unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder()
+		if out, err := dec.Bytes(data); err == nil {
+			return string(out)
+		}
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return email.Decode("windows-1252", data)
+}
+
+// normalizeText converts line endings, trims trailing spaces and keeps at
+// most one blank line between paragraphs.
+func normalizeText(s string) string {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+	lines := strings.Split(s, "\n")
+	out := lines[:0]
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\f\v\u00a0")
+		if line == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// HTML extracts a web page: its text without scripts and styles, the
+// title from its title element or first heading, and the author,
+// description, keywords and publication time from its meta elements. The
+// page is decoded from the charset it declares, or else guessed.
+func HTML(data []byte) (Document, error) {
+	enc, _, _ := charset.DetermineEncoding(data, "text/html")
+	if decoded, err := enc.NewDecoder().Bytes(data); err == nil {
+		data = decoded
+	}
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return Document{}, err
+	}
+	doc := Document{Metadata: map[string]string{}, Text: email.HTMLText(string(data))}
+	var heading string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "title":
+				if doc.Title == "" {
+					doc.Title = collapseSpace(nodeText(n))
+				}
+			case "h1":
+				if heading == "" {
+					heading = collapseSpace(nodeText(n))
+				}
+			case "meta":
+				meta(&doc, attr(n, "name")+attr(n, "property"), attr(n, "content"))
+			case "html":
+				if lang := attr(n, "lang"); lang != "" {
+					doc.Metadata["language"] = lang
+				}
+			case "script", "style":
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	if doc.Title == "" {
+		doc.Title = heading
+	}
+	return doc, nil
+}
+
+// meta records a meta element's content.
+func meta(doc *Document, name, content string) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+	switch strings.ToLower(name) {
+	case "author", "article:author":
+		doc.Author = content
+	case "description", "og:description":
+		if doc.Metadata["description"] == "" {
+			doc.Metadata["description"] = content
+		}
+	case "keywords":
+		doc.Metadata["keywords"] = content
+	case "og:title":
+		if doc.Title == "" {
+			doc.Title = content
+		}
+	case "article:published_time", "date", "dcterms.created":
+		doc.Created = parseISOTime(content)
+	case "article:modified_time", "dcterms.modified":
+		doc.Modified = parseISOTime(content)
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(nodeText(c))
+	}
+	return b.String()
+}
+
+var spaceRE = regexp.MustCompile(`\s+`)
+
+func collapseSpace(s string) string {
+	return strings.TrimSpace(spaceRE.ReplaceAllString(s, " "))
+}
@@ -0,0 +1,38 @@
+package index
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopwords are common English words too frequent to be worth indexing.
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "such": true, "that": true, "the": true,
+	"their": true, "then": true, "there": true, "these": true, "they": true,
+	"this": true, "to": true, "was": true, "will": true, "with": true,
+}
+
+// words lowercases s and splits it into letter/digit runs.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// analyze turns text into index terms: lowercased words with stopwords
+// removed, reduced to their stems. Duplicates are kept so callers can count
+// term frequencies.
+func analyze(s string) []string {
+	ws := words(s)
+	terms := ws[:0]
+	for _, w := range ws {
+		if stopwords[w] {
+			continue
+		}
+		terms = append(terms, stem(w))
+	}
+	return terms
+}
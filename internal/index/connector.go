@@ -0,0 +1,172 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+// defaultLimit is the page size when a request sets no limit.
+const defaultLimit = 20
+
+// Snippet shape: about snippetLen bytes, starting up to snippetLead bytes
+// before the first matching word.
+const (
+	snippetLen  = 200
+	snippetLead = 60
+)
+
+// Connector implements connectors.Connector over the local index, so
+// synced documents are searchable offline. Results keep the Source of the
+// connector they were synced from.
+type Connector struct {
+	index *Index
+	name  string
+}
+
+// NewConnector creates a connector that searches ix.
+func NewConnector(ix *Index) *Connector {
+	return &Connector{index: ix, name: "index"}
+}
+
+// WithName sets the name the connector reports. It returns c.
+func (c *Connector) WithName(name string) *Connector {
+	c.name = name
+	return c
+}
+
+func (c *Connector) Name() string {
+	return c.name
+}
+
+// Explain reports the stemmed terms looked up in the index.
+func (c *Connector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Explanation{}, err
+	}
+	return connectors.Explanation{
+		Query: strings.Join(Terms(parsed), " "),
+		Params: map[string]string{
+			"path":      c.index.Path(),
+			"documents": strconv.Itoa(c.index.Len()),
+		},
+	}, nil
+}
+
+func (c *Connector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return connectors.Page{}, err
+	}
+	offset := 0
+	if req.Cursor != "" {
+		if offset, err = strconv.Atoi(req.Cursor); err != nil || offset < 0 {
+			return connectors.Page{}, fmt.Errorf("invalid index cursor %q", req.Cursor)
+		}
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if err := c.index.Refresh(); err != nil {
+		return connectors.Page{}, err
+	}
+
+	hits := c.index.Search(parsed)
+	terms := Terms(parsed)
+	end := min(offset+limit, len(hits))
+	results := []connectors.Result{}
+	for _, h := range hits[min(offset, end):end] {
+		r := h.Doc.Result
+		if h.Doc.Body != "" {
+			r.Snippet = Snippet(h.Doc.Body, terms)
+		}
+		results = append(results, r)
+	}
+
+	var next string
+	if end < len(hits) {
+		next = strconv.Itoa(end)
+	}
+	return connectors.Page{Results: results, NextCursor: next}, nil
+}
+
+// Snippet returns the part of body around the first word whose stem is one
+// of terms (see Terms), or the start of body when none is, with whitespace
+// collapsed.
+func Snippet(body string, terms []string) string {
+	body = strings.Join(strings.Fields(body), " ")
+	if len(body) <= snippetLen {
+		return body
+	}
+	match := max(FirstMatch(body, terms), 0)
+
+	// Start at a word boundary shortly before the match and end at one
+	// about snippetLen later.
+	from := max(match-snippetLead, 0)
+	if from > 0 {
+		if sp := strings.IndexByte(body[from:match], ' '); sp >= 0 {
+			from += sp + 1
+		} else {
+			from = match
+		}
+	}
+	to := min(from+snippetLen, len(body))
+	if to < len(body) {
+		if sp := strings.LastIndexByte(body[from:to], ' '); sp > 0 {
+			to = from + sp
+		}
+		for to > from && !utf8.RuneStart(body[to]) {
+			to--
+		}
+	}
+
+	s := body[from:to]
+	if from > 0 {
+		s = "…" + s
+	}
+	if to < len(body) {
+		s += "…"
+	}
+	return s
+}
+
+// FirstMatch returns the byte offset in text of the first word whose stem
+// is one of terms, or -1 if there is none.
+func FirstMatch(text string, terms []string) int {
+	want := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		want[t] = true
+	}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !isWordRune(r) {
+			i += size
+			continue
+		}
+		j := i
+		for j < len(text) {
+			r, size := utf8.DecodeRuneInString(text[j:])
+			if !isWordRune(r) {
+				break
+			}
+			j += size
+		}
+		if want[stem(strings.ToLower(text[i:j]))] {
+			return i
+		}
+		i = j
+	}
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,74 @@
+package index
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnector_Name(t *testing.T) {
+	assert.Equal(t, "index", NewConnector(nil).Name())
+}
+
+func TestConnector_Search_KeepsOriginalSource(t *testing.T) {
+	ix := newTestIndex(t)
+	ix.Put(doc("gmail", "1", "Budget", "numbers for the budget"))
+
+	page, err := NewConnector(ix).Search(context.Background(), connectors.Request{Query: "budget"})
+	require.NoError(t, err)
+	require.Len(t, page.Results, 1)
+	assert.Equal(t, "gmail", page.Results[0].Source)
+	assert.Equal(t, "numbers for the budget", page.Results[0].Snippet)
+}
+
+func TestConnector_Search_Pages(t *testing.T) {
+	ix := newTestIndex(t)
+	ix.Put(doc("gmail", "1", "a", "budget"), doc("gmail", "2", "b", "budget"), doc("gmail", "3", "c", "budget"))
+	c := NewConnector(ix)
+
+	first, err := c.Search(context.Background(), connectors.Request{Query: "budget", Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, first.Results, 2)
+	assert.Equal(t, "2", first.NextCursor)
+
+	second, err := c.Search(context.Background(), connectors.Request{Query: "budget", Limit: 2, Cursor: first.NextCursor})
+	require.NoError(t, err)
+	assert.Len(t, second.Results, 1)
+	assert.Empty(t, second.NextCursor)
+
+	_, err = c.Search(context.Background(), connectors.Request{Query: "budget", Cursor: "x"})
+	assert.ErrorContains(t, err, "invalid index cursor")
+}
+
+func TestConnector_Explain(t *testing.T) {
+	ix := newTestIndex(t)
+	ix.Put(doc("gmail", "1", "", ""))
+
+	exp, err := NewConnector(ix).Explain(connectors.Request{Query: "Planning the budgets type:pdf"})
+	require.NoError(t, err)
+	assert.Equal(t, "plan budget", exp.Query)
+	assert.Equal(t, "1", exp.Params["documents"])
+	assert.Equal(t, ix.Path(), exp.Params["path"])
+}
+
+func TestSnippet(t *testing.T) {
+	body := strings.Repeat("filler words here ", 20) + "the budgeting\nmeeting is on Monday " + strings.Repeat("more text follows ", 20)
+
+	s := Snippet(body, []string{"budget"})
+	assert.True(t, strings.HasPrefix(s, "…"), s)
+	assert.True(t, strings.HasSuffix(s, "…"), s)
+	assert.Contains(t, s, "the budgeting meeting is on Monday")
+	assert.LessOrEqual(t, len(s), snippetLen+2*len("…"))
+
+	assert.True(t, strings.HasPrefix(Snippet(body, []string{"absent"}), "filler words"))
+	assert.Equal(t, "short text", Snippet("short \n text", nil), "whitespace is collapsed")
+}
+
+func TestFirstMatch(t *testing.T) {
+	assert.Equal(t, 4, FirstMatch("the Budgeting plan", []string{"budget"}))
+	assert.Equal(t, -1, FirstMatch("nothing here", []string{"budget"}))
+}
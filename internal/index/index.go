@@ -0,0 +1,442 @@
+// Package index is pkb's offline full-text index. Documents copied from
+// connectors by pkb sync are stored in an inverted index of stemmed terms,
+// persisted to a single file, and ranked with BM25.
+package index
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+)
+
+// BM25 parameters, at the values commonly used as defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// titleWeight is how many times a term in a document's title counts
+// compared with the same term in its body.
+const titleWeight = 3
+
+// formatVersion is bumped whenever the on-disk layout changes.
+const formatVersion = 1
+
+// Index is an inverted index of documents. It is safe for concurrent use.
+type Index struct {
+	path string
+
+	mu   sync.RWMutex
+	data indexData
+	// modTime and size identify the file version data was loaded from or
+	// saved to, so Refresh can tell when another process rewrote it.
+	modTime time.Time
+	size    int64
+}
+
+// indexData is the persisted form of an Index.
+type indexData struct {
+	Version int
+	// Docs maps document keys (see key) to the stored documents.
+	Docs map[string]*entry
+	// Postings maps each term to the documents containing it and the
+	// term's weighted frequency in each.
+	Postings map[string]map[string]int
+	// TotalLen is the sum of every document's length, for BM25's average.
+	TotalLen int
+}
+
+type entry struct {
+	Doc connectors.Document
+	// Len is the document's weighted term count.
+	Len int
+}
+
+// Hit is a document matching a search.
+type Hit struct {
+	Doc   connectors.Document
+	Score float64
+}
+
+// Open loads the index stored at path. A missing file yields an empty
+// index that Save will create.
+func Open(path string) (*Index, error) {
+	ix := &Index{path: path, data: newIndexData()}
+	if err := ix.load(); err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+// New creates an empty index that lives only in memory, for connectors
+// that index their source themselves. Save fails on it.
+func New() *Index {
+	return &Index{data: newIndexData()}
+}
+
+func newIndexData() indexData {
+	return indexData{Version: formatVersion, Docs: map[string]*entry{}, Postings: map[string]map[string]int{}}
+}
+
+// Path returns the file the index is stored in, or "" for an index made by
+// New.
+func (ix *Index) Path() string {
+	return ix.path
+}
+
+// Len returns the number of documents in the index.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.data.Docs)
+}
+
+// load replaces the in-memory index with the file's contents. The caller
+// must not hold mu.
+func (ix *Index) load() error {
+	f, err := os.Open(ix.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open index: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("open index: %w", err)
+	}
+	var data indexData
+	if err := gob.NewDecoder(f).Decode(&data); err != nil {
+		return fmt.Errorf("read index %s: %w", ix.path, err)
+	}
+	if data.Version != formatVersion {
+		return fmt.Errorf("index %s has format version %d, want %d: delete it and run pkb sync again", ix.path, data.Version, formatVersion)
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.data = data
+	ix.modTime, ix.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// Refresh reloads the index if its file was rewritten since it was loaded
+// or saved, for example by a pkb sync running in another process.
+func (ix *Index) Refresh() error {
+	if ix.path == "" {
+		return nil
+	}
+	info, err := os.Stat(ix.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open index: %w", err)
+	}
+	ix.mu.RLock()
+	unchanged := info.ModTime().Equal(ix.modTime) && info.Size() == ix.size
+	ix.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	return ix.load()
+}
+
+// Save writes the index to its file, replacing it atomically so readers
+// never see a partial index.
+func (ix *Index) Save() error {
+	if ix.path == "" {
+		return errors.New("save index: the index is in memory only")
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	dir := filepath.Dir(ix.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("create index directory: %w", err)
+	}
+	// CreateTemp creates the file with mode 0600.
+	f, err := os.CreateTemp(dir, filepath.Base(ix.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("save index: %w", err)
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+
+	if err := gob.NewEncoder(f).Encode(&ix.data); err != nil {
+		f.Close()
+		return fmt.Errorf("save index: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("save index: %w", err)
+	}
+	if err := os.Rename(f.Name(), ix.path); err != nil {
+		return fmt.Errorf("save index: %w", err)
+	}
+	if info, err := os.Stat(ix.path); err == nil {
+		ix.modTime, ix.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// key identifies a document across sources.
+func key(source, id string) string {
+	return source + "\x00" + id
+}
+
+// Put adds documents to the index, replacing any with the same Source and
+// ID. Changes are kept in memory until Save.
+func (ix *Index) Put(docs ...connectors.Document) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for _, d := range docs {
+		k := key(d.Source, d.ID)
+		ix.remove(k)
+		tf := termFreqs(d)
+		n := 0
+		for term, f := range tf {
+			postings := ix.data.Postings[term]
+			if postings == nil {
+				postings = map[string]int{}
+				ix.data.Postings[term] = postings
+			}
+			postings[k] = f
+			n += f
+		}
+		ix.data.Docs[k] = &entry{Doc: d, Len: n}
+		ix.data.TotalLen += n
+	}
+}
+
+// Delete removes a document, reporting whether it was present.
+func (ix *Index) Delete(source, id string) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.remove(key(source, id))
+}
+
+// remove deletes the document with key k. The caller must hold mu.
+func (ix *Index) remove(k string) bool {
+	e, ok := ix.data.Docs[k]
+	if !ok {
+		return false
+	}
+	for term := range termFreqs(e.Doc) {
+		postings := ix.data.Postings[term]
+		delete(postings, k)
+		if len(postings) == 0 {
+			delete(ix.data.Postings, term)
+		}
+	}
+	ix.data.TotalLen -= e.Len
+	delete(ix.data.Docs, k)
+	return true
+}
+
+// Get returns the document with the given source and ID.
+func (ix *Index) Get(source, id string) (connectors.Document, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	e, ok := ix.data.Docs[key(source, id)]
+	if !ok {
+		return connectors.Document{}, false
+	}
+	return e.Doc, true
+}
+
+// IDs returns the IDs of the documents from source, sorted.
+func (ix *Index) IDs(source string) []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var ids []string
+	for _, e := range ix.data.Docs {
+		if e.Doc.Source == source {
+			ids = append(ids, e.Doc.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// termFreqs counts the weighted frequency of each term in d.
+func termFreqs(d connectors.Document) map[string]int {
+	tf := map[string]int{}
+	for _, t := range analyze(d.Title) {
+		tf[t] += titleWeight
+	}
+	for _, t := range analyze(d.Body) {
+		tf[t]++
+	}
+	return tf
+}
+
+// Search returns the documents matching every clause of q, best first.
+// Free-text words and phrases are required and scored with BM25; the
+// other operators filter. source: clauses are ignored, since the search
+// engine already applied them when choosing to query the index. Without
+// free text, matches are ordered newest first.
+func (ix *Index) Search(q query.Query) []Hit {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	terms := Terms(q)
+	var keys []string
+	if len(terms) > 0 {
+		// Walk the rarest term's postings and check the others.
+		rarest := terms[0]
+		for _, t := range terms[1:] {
+			if len(ix.data.Postings[t]) < len(ix.data.Postings[rarest]) {
+				rarest = t
+			}
+		}
+		for k := range ix.data.Postings[rarest] {
+			if ix.hasAll(k, terms) {
+				keys = append(keys, k)
+			}
+		}
+	} else {
+		for k := range ix.data.Docs {
+			keys = append(keys, k)
+		}
+	}
+
+	hits := []Hit{}
+	for _, k := range keys {
+		e := ix.data.Docs[k]
+		if !ix.matches(k, e.Doc, q) {
+			continue
+		}
+		hits = append(hits, Hit{Doc: e.Doc, Score: ix.bm25(k, e.Len, terms)})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.Doc.ModifiedAt.Equal(b.Doc.ModifiedAt) {
+			return a.Doc.ModifiedAt.After(b.Doc.ModifiedAt)
+		}
+		return key(a.Doc.Source, a.Doc.ID) < key(b.Doc.Source, b.Doc.ID)
+	})
+	return hits
+}
+
+// Terms returns the distinct stemmed terms of q's positive free text, as
+// Search requires and scores them.
+func Terms(q query.Query) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, c := range q.Clauses {
+		if c.Field != query.FieldText || c.Negated {
+			continue
+		}
+		for _, t := range analyze(c.Value) {
+			if !seen[t] {
+				seen[t] = true
+				terms = append(terms, t)
+			}
+		}
+	}
+	return terms
+}
+
+// hasAll reports whether the document with key k contains every term. The
+// caller must hold mu.
+func (ix *Index) hasAll(k string, terms []string) bool {
+	for _, t := range terms {
+		if _, ok := ix.data.Postings[t][k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matches applies q's clauses other than positive free-text words, which
+// Search has already checked against the postings. The caller must hold mu.
+func (ix *Index) matches(k string, d connectors.Document, q query.Query) bool {
+	for _, c := range q.Clauses {
+		var ok bool
+		switch c.Field {
+		case query.FieldText:
+			if c.Phrase {
+				ok = containsPhrase(d.Title+"\n"+d.Body, c.Value)
+			} else if terms := analyze(c.Value); len(terms) > 0 {
+				ok = ix.hasAll(k, terms)
+			} else {
+				continue // only stopwords
+			}
+		case query.FieldTitle:
+			if c.Phrase {
+				ok = containsPhrase(d.Title, c.Value)
+			} else if terms := analyze(c.Value); len(terms) > 0 {
+				ok = containsTerms(analyze(d.Title), terms)
+			} else {
+				continue
+			}
+		case query.FieldFrom:
+			ok = strings.Contains(strings.ToLower(d.Author), strings.ToLower(c.Value))
+		case query.FieldType:
+			ok = query.MatchesMIMEType(c.Value, d.MimeType)
+		case query.FieldBefore:
+			ok = !d.ModifiedAt.IsZero() && d.ModifiedAt.Before(c.Date())
+		case query.FieldAfter:
+			ok = !d.ModifiedAt.IsZero() && !d.ModifiedAt.Before(c.Date())
+		default:
+			continue
+		}
+		if ok == c.Negated {
+			return false
+		}
+	}
+	return true
+}
+
+// containsPhrase reports whether the words of phrase appear consecutively
+// in text, ignoring case and punctuation.
+func containsPhrase(text, phrase string) bool {
+	want := " " + strings.Join(words(phrase), " ") + " "
+	return strings.Contains(" "+strings.Join(words(text), " ")+" ", want)
+}
+
+func containsTerms(have, want []string) bool {
+	set := make(map[string]bool, len(have))
+	for _, t := range have {
+		set[t] = true
+	}
+	for _, t := range want {
+		if !set[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// bm25 scores the document with key k and length n against terms. The
+// caller must hold mu.
+func (ix *Index) bm25(k string, n int, terms []string) float64 {
+	docs := float64(len(ix.data.Docs))
+	avgLen := float64(ix.data.TotalLen) / docs
+	var score float64
+	for _, t := range terms {
+		postings := ix.data.Postings[t]
+		tf := float64(postings[k])
+		if tf == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (docs-df+0.5)/(df+0.5))
+		score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(n)/avgLen))
+	}
+	return score
+}
@@ -0,0 +1,186 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func doc(source, id, title, body string) connectors.Document {
+	return connectors.Document{Result: connectors.Result{Source: source, ID: id, Title: title}, Body: body}
+}
+
+func mustParse(t *testing.T, s string) query.Query {
+	t.Helper()
+	q, err := query.Parse(s)
+	require.NoError(t, err)
+	return q
+}
+
+func hitIDs(hits []Hit) []string {
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.Doc.ID
+	}
+	return ids
+}
+
+func newTestIndex(t *testing.T) *Index {
+	t.Helper()
+	ix, err := Open(filepath.Join(t.TempDir(), "index.gob"))
+	require.NoError(t, err)
+	return ix
+}
+
+func TestIndex_SearchStemsAndRanksWithBM25(t *testing.T) {
+	ix := newTestIndex(t)
+	ix.Put(
+		doc("gmail", "1", "Lunch", "we could talk about the budget over lunch"),
+		doc("google-drive", "2", "Budget planning", "budgets for the next quarter and how we planned them"),
+		doc("google-drive", "3", "Holiday photos", "beach"),
+	)
+
+	hits := ix.Search(mustParse(t, "budgeting"))
+	assert.Equal(t, []string{"2", "1"}, hitIDs(hits), "title matches outrank body matches")
+	assert.Greater(t, hits[0].Score, hits[1].Score)
+
+	assert.Equal(t, []string{"2"}, hitIDs(ix.Search(mustParse(t, "budget plans"))), "every term is required")
+	assert.Empty(t, ix.Search(mustParse(t, "invoice")))
+}
+
+func TestIndex_SearchOperators(t *testing.T) {
+	ix := newTestIndex(t)
+	jan := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	a := doc("gmail", "a", "Budget review", "the quarterly budget review meeting")
+	a.Author, a.MimeType, a.ModifiedAt = "Alice <alice@example.com>", "message/rfc822", jan
+	b := doc("google-drive", "b", "Notes", "review of the budget")
+	b.Author, b.MimeType, b.ModifiedAt = "Bob", "application/pdf", mar
+	ix.Put(a, b)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`"budget review"`, []string{"a"}},
+		{`budget -"budget review"`, []string{"b"}},
+		{"budget -quarterly", []string{"b"}},
+		{"title:review", []string{"a"}},
+		{`-title:"budget review"`, []string{"b"}},
+		{"from:alice", []string{"a"}},
+		{"type:pdf", []string{"b"}},
+		{"-type:pdf", []string{"a"}},
+		{"before:2024-02-01", []string{"a"}},
+		{"after:2024-02-01", []string{"b"}},
+		{"budget source:gmail", []string{"a", "b"}},
+		{"budget -the", []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.ElementsMatch(t, tt.want, hitIDs(ix.Search(mustParse(t, tt.query))))
+		})
+	}
+}
+
+func TestIndex_SearchWithoutTextOrdersNewestFirst(t *testing.T) {
+	ix := newTestIndex(t)
+	old := doc("gmail", "old", "Old", "")
+	old.ModifiedAt = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := doc("gmail", "new", "New", "")
+	recent.ModifiedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ix.Put(old, recent)
+
+	assert.Equal(t, []string{"new", "old"}, hitIDs(ix.Search(mustParse(t, "source:gmail"))))
+}
+
+func TestIndex_PutReplacesAndDeleteRemoves(t *testing.T) {
+	ix := newTestIndex(t)
+	ix.Put(doc("gmail", "1", "Old subject", "apples"))
+	ix.Put(doc("gmail", "1", "New subject", "oranges"))
+
+	assert.Equal(t, 1, ix.Len())
+	assert.Empty(t, ix.Search(mustParse(t, "apples")))
+	assert.Len(t, ix.Search(mustParse(t, "oranges")), 1)
+
+	assert.True(t, ix.Delete("gmail", "1"))
+	assert.False(t, ix.Delete("gmail", "1"))
+	assert.Zero(t, ix.Len())
+	assert.Empty(t, ix.data.Postings, "postings of deleted documents are dropped")
+	assert.Zero(t, ix.data.TotalLen)
+}
+
+func TestIndex_IDs(t *testing.T) {
+	ix := newTestIndex(t)
+	ix.Put(doc("gmail", "b", "", ""), doc("gmail", "a", "", ""), doc("google-drive", "c", "", ""))
+	assert.Equal(t, []string{"a", "b"}, ix.IDs("gmail"))
+}
+
+func TestIndex_Get(t *testing.T) {
+	ix := newTestIndex(t)
+	ix.Put(doc("gmail", "1", "Budget", "apples"))
+
+	d, ok := ix.Get("gmail", "1")
+	assert.True(t, ok)
+	assert.Equal(t, doc("gmail", "1", "Budget", "apples"), d)
+	_, ok = ix.Get("google-drive", "1")
+	assert.False(t, ok)
+}
+
+func TestIndex_SaveAndOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "index.gob")
+	ix, err := Open(path)
+	require.NoError(t, err)
+	d := doc("gmail", "1", "Budget", "numbers")
+	d.ModifiedAt = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	d.Metadata = map[string]string{"threadId": "t1"}
+	ix.Put(d)
+	require.NoError(t, ix.Save())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	reopened, err := Open(path)
+	require.NoError(t, err)
+	hits := reopened.Search(mustParse(t, "budget"))
+	require.Len(t, hits, 1)
+	assert.Equal(t, d, hits[0].Doc)
+}
+
+func TestIndex_OpenCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.gob")
+	require.NoError(t, os.WriteFile(path, []byte("not gob"), 0600))
+
+	_, err := Open(path)
+	assert.ErrorContains(t, err, "read index")
+}
+
+func TestIndex_RefreshPicksUpOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.gob")
+	reader, err := Open(path)
+	require.NoError(t, err)
+	require.NoError(t, reader.Refresh(), "a missing file is an empty index")
+
+	writer, err := Open(path)
+	require.NoError(t, err)
+	writer.Put(doc("gmail", "1", "Budget", ""))
+	require.NoError(t, writer.Save())
+
+	require.NoError(t, reader.Refresh())
+	assert.Equal(t, 1, reader.Len())
+}
+
+func TestIndex_NewIsInMemory(t *testing.T) {
+	ix := New()
+	ix.Put(doc("vault", "a.md", "Budget", "numbers"))
+
+	assert.Equal(t, []string{"a.md"}, hitIDs(ix.Search(mustParse(t, "budget"))))
+	assert.NoError(t, ix.Refresh())
+	assert.Error(t, ix.Save())
+}
@@ -0,0 +1,48 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStem(t *testing.T) {
+	// Examples from Porter's paper and reference vocabulary.
+	tests := map[string]string{
+		"caresses":        "caress",
+		"ponies":          "poni",
+		"cats":            "cat",
+		"feed":            "feed",
+		"agreed":          "agre",
+		"plastered":       "plaster",
+		"motoring":        "motor",
+		"sing":            "sing",
+		"conflated":       "conflat",
+		"troubled":        "troubl",
+		"sized":           "size",
+		"hopping":         "hop",
+		"falling":         "fall",
+		"filing":          "file",
+		"happy":           "happi",
+		"relational":      "relat",
+		"generalizations": "gener",
+		"running":         "run",
+		"runs":            "run",
+		"connection":      "connect",
+		"connections":     "connect",
+		"adjustable":      "adjust",
+		"controll":        "control",
+		"rate":            "rate",
+		"as":              "as",
+		"café":            "café",
+		"2024":            "2024",
+	}
+	for word, want := range tests {
+		assert.Equal(t, want, stem(word), word)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	assert.Equal(t, []string{"quarterli", "budget", "plan", "budget"}, analyze("The Quarterly budgets, and PLANNING the budget"))
+	assert.Empty(t, analyze("the and of"))
+}
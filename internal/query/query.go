@@ -0,0 +1,299 @@
+// Package query parses the pkb search language into a small AST that each
+// connector translates to its own native query syntax.
+//
+// A query is a sequence of whitespace-separated clauses, all of which must
+// match:
+//
+//	word             free text
+//	"exact phrase"   free text that must appear verbatim
+//	-word            exclusion; any clause may be negated with a leading -
+//	source:gmail     only search the named connector
+//	type:pdf         document type (see Types)
+//	from:alice       author or sender
+//	before:2024-01-31, after:2024-01-01
+//	                 modification date, YYYY-MM-DD or YYYY/MM/DD
+//	title:budget     word or quoted phrase in the title
+//
+// Unknown prefixes such as has:attachment are kept as free text, so
+// connector-native operators still pass through to connectors that
+// understand them.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrSyntax is wrapped by every error returned from Parse.
+var ErrSyntax = errors.New("invalid query")
+
+// Field identifies what a clause matches against.
+type Field string
+
+const (
+	// FieldText is free text; it has no prefix.
+	FieldText   Field = ""
+	FieldSource Field = "source"
+	FieldType   Field = "type"
+	FieldFrom   Field = "from"
+	FieldBefore Field = "before"
+	FieldAfter  Field = "after"
+	FieldTitle  Field = "title"
+)
+
+var fields = map[string]Field{
+	"source": FieldSource,
+	"type":   FieldType,
+	"from":   FieldFrom,
+	"before": FieldBefore,
+	"after":  FieldAfter,
+	"title":  FieldTitle,
+}
+
+// Clause is one term of a query.
+type Clause struct {
+	Field Field
+	// Value is the clause's argument without quotes. Dates are normalized to
+	// YYYY-MM-DD and types to lower case.
+	Value string
+	// Phrase is true when Value was quoted.
+	Phrase bool
+	// Negated is true when the clause was prefixed with -.
+	Negated bool
+}
+
+// String renders the clause in pkb syntax.
+func (c Clause) String() string {
+	var b strings.Builder
+	if c.Negated {
+		b.WriteByte('-')
+	}
+	if c.Field != FieldText {
+		b.WriteString(string(c.Field) + ":")
+	}
+	if c.Phrase {
+		b.WriteString(`"` + c.Value + `"`)
+	} else {
+		b.WriteString(c.Value)
+	}
+	return b.String()
+}
+
+// Date returns the date of a before: or after: clause, at midnight UTC.
+func (c Clause) Date() time.Time {
+	t, _ := time.Parse(time.DateOnly, c.Value)
+	return t
+}
+
+// Query is a parsed search: a conjunction of clauses.
+type Query struct {
+	Clauses []Clause
+}
+
+// String renders the query in canonical pkb syntax.
+func (q Query) String() string {
+	parts := make([]string, len(q.Clauses))
+	for i, c := range q.Clauses {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+// Text returns the positive free-text words and phrases, joined by spaces.
+// It is what relevance scoring should compare results against.
+func (q Query) Text() string {
+	var parts []string
+	for _, c := range q.Clauses {
+		if c.Field == FieldText && !c.Negated {
+			parts = append(parts, c.Value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Parse parses s. Errors wrap ErrSyntax.
+func Parse(s string) (Query, error) {
+	var q Query
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		if unicode.IsSpace(rs[i]) {
+			i++
+			continue
+		}
+		c, next, err := parseClause(rs, i)
+		if err != nil {
+			return Query{}, err
+		}
+		if c.Field != FieldText || c.Value != "" {
+			// An empty phrase ("") matches everything; drop it.
+			q.Clauses = append(q.Clauses, c)
+		}
+		i = next
+	}
+	return q, nil
+}
+
+// parseClause parses the clause starting at rs[i] and returns it with the
+// index just past it.
+func parseClause(rs []rune, i int) (Clause, int, error) {
+	var c Clause
+	start := i
+	if rs[i] == '-' && i+1 < len(rs) && !unicode.IsSpace(rs[i+1]) {
+		c.Negated = true
+		i++
+	}
+
+	// A known field name followed by a colon.
+	if j := indexRune(rs[i:], ':'); j > 0 {
+		if f, ok := fields[strings.ToLower(string(rs[i:i+j]))]; ok {
+			c.Field = f
+			i += j + 1
+		}
+	}
+
+	if i < len(rs) && rs[i] == '"' {
+		end := slices.Index(rs[i+1:], '"')
+		if end < 0 {
+			return Clause{}, 0, fmt.Errorf("%w: unterminated quote at %q", ErrSyntax, string(rs[start:]))
+		}
+		c.Value = string(rs[i+1 : i+1+end])
+		c.Phrase = true
+		i += end + 2
+	} else {
+		j := i
+		for j < len(rs) && !unicode.IsSpace(rs[j]) {
+			j++
+		}
+		c.Value = string(rs[i:j])
+		i = j
+	}
+
+	if err := normalize(&c); err != nil {
+		return Clause{}, 0, err
+	}
+	return c, i, nil
+}
+
+// normalize validates operator values and puts them in canonical form.
+func normalize(c *Clause) error {
+	if c.Field != FieldText && c.Value == "" {
+		return fmt.Errorf("%w: missing value for %s:", ErrSyntax, c.Field)
+	}
+	switch c.Field {
+	case FieldBefore, FieldAfter:
+		if c.Negated {
+			return fmt.Errorf("%w: %s: cannot be negated", ErrSyntax, c.Field)
+		}
+		t, err := parseDate(c.Value)
+		if err != nil {
+			return fmt.Errorf("%w: %s:%s: want a date like 2024-01-31", ErrSyntax, c.Field, c.Value)
+		}
+		c.Value = t.Format(time.DateOnly)
+		c.Phrase = false
+	case FieldType:
+		c.Value = strings.ToLower(c.Value)
+		if _, ok := types[c.Value]; !ok {
+			return fmt.Errorf("%w: unknown type:%s (want %s)", ErrSyntax, c.Value, strings.Join(Types(), ", "))
+		}
+		c.Phrase = false
+	}
+	return nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		t, err = time.Parse("2006/01/02", s)
+	}
+	return t, err
+}
+
+// indexRune returns the index of r in the current word of rs, or -1 if the
+// word ends first.
+func indexRune(rs []rune, r rune) int {
+	for i, x := range rs {
+		if x == r {
+			return i
+		}
+		if unicode.IsSpace(x) {
+			return -1
+		}
+	}
+	return -1
+}
+
+// types maps type: values to the MIME types they cover. An entry ending in
+// "/" covers every MIME type with that prefix.
+var types = map[string][]string{
+	"doc": {
+		"application/vnd.google-apps.document",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/msword",
+		"application/vnd.oasis.opendocument.text",
+		"application/vnd.notion.page",
+	},
+	"sheet": {
+		"application/vnd.google-apps.spreadsheet",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.ms-excel",
+		"text/csv",
+		"application/vnd.notion.database",
+	},
+	"slides": {
+		"application/vnd.google-apps.presentation",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"application/vnd.ms-powerpoint",
+	},
+	"pdf":        {"application/pdf"},
+	"folder":     {"application/vnd.google-apps.folder"},
+	"image":      {"image/"},
+	"video":      {"video/"},
+	"audio":      {"audio/"},
+	"text":       {"text/plain", "text/markdown"},
+	"email":      {"message/rfc822"},
+	"message":    {"message/rfc822", "application/vnd.slack.message", "application/vnd.pkb.chat-message"},
+	"event":      {"text/calendar"},
+	"bookmark":   {"text/uri-list"},
+	"issue":      {"application/vnd.github.issue"},
+	"pr":         {"application/vnd.github.pull-request"},
+	"discussion": {"application/vnd.github.discussion"},
+	"article":    {"application/atom+xml;type=entry"},
+	"highlight":  {"application/vnd.pkb.highlight"},
+}
+
+// Types returns the supported type: values, sorted.
+func Types() []string {
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MIMETypes returns the MIME types covered by a type: value. Entries ending
+// in "/" are prefixes.
+func MIMETypes(typ string) []string {
+	return types[typ]
+}
+
+// MatchesMIMEType reports whether mimeType is covered by a type: value.
+func MatchesMIMEType(typ, mimeType string) bool {
+	for _, m := range types[typ] {
+		if m == mimeType || (strings.HasSuffix(m, "/") && strings.HasPrefix(mimeType, m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unsupported formats the warning a connector reports for a clause it
+// cannot express and therefore ignored.
+func Unsupported(c Clause) string {
+	return fmt.Sprintf("%s is not supported by this source and was ignored", c)
+}
@@ -0,0 +1,93 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Clauses(t *testing.T) {
+	q, err := Parse(`budget "Q1 plan" -draft source:gmail -source:slack type:PDF from:"Alice Smith" after:2024/01/02 before:2024-03-01 title:notes`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Clause{
+		{Field: FieldText, Value: "budget"},
+		{Field: FieldText, Value: "Q1 plan", Phrase: true},
+		{Field: FieldText, Value: "draft", Negated: true},
+		{Field: FieldSource, Value: "gmail"},
+		{Field: FieldSource, Value: "slack", Negated: true},
+		{Field: FieldType, Value: "pdf"},
+		{Field: FieldFrom, Value: "Alice Smith", Phrase: true},
+		{Field: FieldAfter, Value: "2024-01-02"},
+		{Field: FieldBefore, Value: "2024-03-01"},
+		{Field: FieldTitle, Value: "notes"},
+	}, q.Clauses)
+}
+
+func TestParse_UnknownOperatorIsText(t *testing.T) {
+	q, err := Parse("has:attachment https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []Clause{
+		{Field: FieldText, Value: "has:attachment"},
+		{Field: FieldText, Value: "https://example.com"},
+	}, q.Clauses)
+}
+
+func TestParse_EdgeCases(t *testing.T) {
+	q, err := Parse(`  a  -  "" b  `)
+	require.NoError(t, err)
+	assert.Equal(t, []Clause{
+		{Field: FieldText, Value: "a"},
+		{Field: FieldText, Value: "-"},
+		{Field: FieldText, Value: "b"},
+	}, q.Clauses)
+
+	q, err = Parse("")
+	require.NoError(t, err)
+	assert.Empty(t, q.Clauses)
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, s := range []string{
+		`"unterminated`,
+		`title:`,
+		`before:yesterday`,
+		`-after:2024-01-01`,
+		`type:spaceship`,
+	} {
+		_, err := Parse(s)
+		assert.ErrorIs(t, err, ErrSyntax, s)
+	}
+}
+
+func TestQuery_StringRoundTrips(t *testing.T) {
+	in := `budget "Q1 plan" -draft -title:"old notes" after:2024-01-02`
+	q, err := Parse(in)
+	require.NoError(t, err)
+	assert.Equal(t, in, q.String())
+
+	again, err := Parse(q.String())
+	require.NoError(t, err)
+	assert.Equal(t, q, again)
+}
+
+func TestQuery_Text(t *testing.T) {
+	q, err := Parse(`budget "Q1 plan" -draft title:notes`)
+	require.NoError(t, err)
+	assert.Equal(t, "budget Q1 plan", q.Text())
+}
+
+func TestClause_Date(t *testing.T) {
+	q, err := Parse("before:2024/03/01")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), q.Clauses[0].Date())
+}
+
+func TestMatchesMIMEType(t *testing.T) {
+	assert.True(t, MatchesMIMEType("pdf", "application/pdf"))
+	assert.True(t, MatchesMIMEType("image", "image/png"))
+	assert.False(t, MatchesMIMEType("image", "application/pdf"))
+	assert.False(t, MatchesMIMEType("unknown", "application/pdf"))
+}
@@ -0,0 +1,120 @@
+// Package registry builds connectors from configuration. Each connector
+// type registers a Factory under its type name, and Build creates the
+// configured instances of those types.
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/config"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+)
+
+// Factory creates the connector for one configured instance. The returned
+// connector's Name must be inst.Name. Errors should say which setting is
+// wrong and how to fix it.
+type Factory func(ctx context.Context, inst config.ConnectorConfig) (connectors.Connector, error)
+
+// Registry maps connector types to their factories.
+type Registry struct {
+	factories map[string]Factory
+}
+
+// New creates an empty registry.
+func New() *Registry {
+	return &Registry{factories: map[string]Factory{}}
+}
+
+// Register adds the factory for typ. Registering a type twice is a
+// programming error and panics.
+func (r *Registry) Register(typ string, f Factory) {
+	if _, ok := r.factories[typ]; ok {
+		panic(fmt.Sprintf("registry: connector type %q registered twice", typ))
+	}
+	r.factories[typ] = f
+}
+
+// Types returns the registered connector types, sorted.
+func (r *Registry) Types() []string {
+	types := make([]string, 0, len(r.factories))
+	for t := range r.factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Instance is a configured connector instance and the outcome of building
+// it.
+type Instance struct {
+	Config config.ConnectorConfig
+	// Connector is nil when the instance is disabled or failed to build.
+	Connector connectors.Connector
+	// Err is why the instance failed to build. Unlike the error returned by
+	// Build, it does not repeat the instance's name and type.
+	Err error
+}
+
+// Build creates every enabled instance, in order. The returned error joins
+// the errors of every instance that failed; the instances are returned
+// either way, so callers can show which ones work.
+func (r *Registry) Build(ctx context.Context, insts []config.ConnectorConfig) ([]Instance, error) {
+	out := make([]Instance, len(insts))
+	names := map[string]bool{}
+	var errs []error
+	for i, inst := range insts {
+		out[i] = Instance{Config: inst}
+		if !inst.IsEnabled() {
+			continue
+		}
+		c, err := r.build(ctx, inst, names)
+		if err != nil {
+			out[i].Err = err
+			errs = append(errs, fmt.Errorf("connector %q (type %q): %w", inst.Name, inst.Type, err))
+			continue
+		}
+		out[i].Connector = c
+	}
+	return out, errors.Join(errs...)
+}
+
+func (r *Registry) build(ctx context.Context, inst config.ConnectorConfig, names map[string]bool) (connectors.Connector, error) {
+	switch {
+	case inst.Type == "":
+		return nil, errors.New("missing type")
+	case inst.Name == "":
+		return nil, errors.New("missing name")
+	case names[inst.Name]:
+		return nil, errors.New("another enabled instance has the same name")
+	}
+	names[inst.Name] = true
+
+	f, ok := r.factories[inst.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown type (available: %s)", strings.Join(r.Types(), ", "))
+	}
+	c, err := f(ctx, inst)
+	if err != nil {
+		return nil, err
+	}
+	if c.Name() != inst.Name {
+		return nil, fmt.Errorf("factory returned a connector named %q", c.Name())
+	}
+	return c, nil
+}
+
+// Connectors returns the connectors of the instances that were built, in
+// order.
+func Connectors(insts []Instance) []connectors.Connector {
+	var cs []connectors.Connector
+	for _, inst := range insts {
+		if inst.Connector != nil {
+			cs = append(cs, inst.Connector)
+		}
+	}
+	return cs
+}
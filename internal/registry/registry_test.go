@@ -0,0 +1,93 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/config"
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type namedConnector struct{ name string }
+
+func (c namedConnector) Name() string { return c.name }
+
+func (c namedConnector) Search(context.Context, connectors.Request) (connectors.Page, error) {
+	return connectors.Page{}, nil
+}
+
+func newTestRegistry() *Registry {
+	r := New()
+	r.Register("echo", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		return namedConnector{name: inst.Name}, nil
+	})
+	r.Register("needs-token", func(_ context.Context, inst config.ConnectorConfig) (connectors.Connector, error) {
+		if inst.Setting("token", "") == "" {
+			return nil, errors.New("settings.token is required")
+		}
+		return namedConnector{name: inst.Name}, nil
+	})
+	return r
+}
+
+func disabled() *bool {
+	b := false
+	return &b
+}
+
+func TestRegistry_Types(t *testing.T) {
+	assert.Equal(t, []string{"echo", "needs-token"}, newTestRegistry().Types())
+}
+
+func TestRegistry_RegisterTwicePanics(t *testing.T) {
+	r := newTestRegistry()
+	assert.Panics(t, func() { r.Register("echo", nil) })
+}
+
+func TestRegistry_Build(t *testing.T) {
+	insts, err := newTestRegistry().Build(context.Background(), []config.ConnectorConfig{
+		{Name: "a", Type: "echo"},
+		{Name: "b", Type: "echo", Enabled: disabled()},
+		{Name: "c", Type: "needs-token", Settings: map[string]string{"token": "t"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, insts, 3)
+	assert.Nil(t, insts[1].Connector, "disabled instances are not built")
+	assert.NoError(t, insts[1].Err)
+
+	cs := Connectors(insts)
+	require.Len(t, cs, 2)
+	assert.Equal(t, "a", cs[0].Name())
+	assert.Equal(t, "c", cs[1].Name())
+}
+
+func TestRegistry_Build_ReportsEveryMisconfiguredInstance(t *testing.T) {
+	insts, err := newTestRegistry().Build(context.Background(), []config.ConnectorConfig{
+		{Name: "ok", Type: "echo"},
+		{Name: "typo", Type: "ecko"},
+		{Name: "ok", Type: "echo"},
+		{Name: "bare", Type: "needs-token"},
+		{Name: "untyped"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `connector "typo" (type "ecko"): unknown type (available: echo, needs-token)`)
+	assert.Contains(t, err.Error(), `connector "ok" (type "echo"): another enabled instance has the same name`)
+	assert.Contains(t, err.Error(), `connector "bare" (type "needs-token"): settings.token is required`)
+	assert.Contains(t, err.Error(), `connector "untyped" (type ""): missing type`)
+
+	assert.NotNil(t, insts[0].Connector, "healthy instances are still built")
+	assert.EqualError(t, insts[3].Err, "settings.token is required")
+	assert.Len(t, Connectors(insts), 1)
+}
+
+func TestRegistry_Build_FactoryMustUseInstanceName(t *testing.T) {
+	r := New()
+	r.Register("fixed", func(context.Context, config.ConnectorConfig) (connectors.Connector, error) {
+		return namedConnector{name: "fixed"}, nil
+	})
+	_, err := r.Build(context.Background(), []config.ConnectorConfig{{Name: "mine", Type: "fixed"}})
+	assert.ErrorContains(t, err, `factory returned a connector named "fixed"`)
+}
@@ -0,0 +1,36 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor packs per-connector continuation tokens into a single opaque
+// cursor. Connectors without a token are exhausted and omitted; an empty map
+// encodes to "" (no more results).
+func encodeCursor(tokens map[string]string) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+	// json.Marshal sorts map keys, so equal token sets encode identically.
+	b, _ := json.Marshal(tokens)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor unpacks a cursor produced by encodeCursor.
+func decodeCursor(cursor string) (map[string]string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	var tokens map[string]string
+	if err := json.Unmarshal(b, &tokens); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return tokens, nil
+}
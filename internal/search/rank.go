@@ -0,0 +1,170 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+)
+
+// SortOrder selects how aggregated results are ordered.
+type SortOrder string
+
+const (
+	// SortRelevance orders by fused relevance score (the default).
+	SortRelevance SortOrder = "relevance"
+	// SortDate orders newest first by ModifiedAt; undated results go last.
+	SortDate SortOrder = "date"
+	// SortSource groups results by source name, by relevance within a source.
+	SortSource SortOrder = "source"
+)
+
+// ErrInvalidSort is returned by ParseSort for an unknown sort order.
+var ErrInvalidSort = errors.New("invalid sort")
+
+// ParseSort converts a user-supplied sort name into a SortOrder. An empty
+// string selects SortRelevance.
+func ParseSort(s string) (SortOrder, error) {
+	switch SortOrder(s) {
+	case "", SortRelevance:
+		return SortRelevance, nil
+	case SortDate, SortSource:
+		return SortOrder(s), nil
+	}
+	return "", fmt.Errorf("%w: %q (want relevance, date or source)", ErrInvalidSort, s)
+}
+
+const (
+	// rrfK dampens the advantage of top-ranked items in reciprocal rank
+	// fusion; 60 is the value from the original RRF paper.
+	rrfK = 60
+	// lexicalWeight scales the lexical score so that a result whose title
+	// and snippet contain every query term gains about as much as being
+	// ranked first by its connector.
+	lexicalWeight = 1.0 / (rrfK + 1)
+)
+
+// rank merges per-connector result lists, each in the connector's own
+// relevance order, into one list. Every result is scored with reciprocal
+// rank fusion plus a lexical re-score of its title and snippet against the
+// query, and Result.Score is set. A result returned by several connectors
+// (the same Source and ID, as when the local index and the live source
+// both find an item) appears once, with the RRF contributions summed; the
+// copy from the connector whose name sorts first is kept. The output is
+// then ordered by order, with ties broken deterministically so the same
+// inputs always produce the same ordering regardless of which connector
+// answered first.
+func rank(query string, lists map[string][]connectors.Result, order SortOrder) []connectors.Result {
+	terms := tokenize(query)
+
+	names := make([]string, 0, len(lists))
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	merged := []connectors.Result{}
+	seen := map[string]int{}
+	for _, name := range names {
+		for i, r := range lists[name] {
+			rrf := 1.0 / float64(rrfK+i+1)
+			if r.ID != "" {
+				k := r.Source + "\x00" + r.ID
+				if j, ok := seen[k]; ok {
+					merged[j].Score += rrf
+					continue
+				}
+				seen[k] = len(merged)
+			}
+			r.Score = rrf + lexicalWeight*lexicalScore(terms, r)
+			merged = append(merged, r)
+		}
+	}
+
+	SortResults(merged, order)
+	return merged
+}
+
+// SortResults orders results already scored by the engine. Clients merging
+// streamed batches use it to keep the order the final Response would have.
+func SortResults(results []connectors.Result, order SortOrder) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch order {
+		case SortDate:
+			if !a.ModifiedAt.Equal(b.ModifiedAt) {
+				return a.ModifiedAt.After(b.ModifiedAt)
+			}
+		case SortSource:
+			if a.Source != b.Source {
+				return a.Source < b.Source
+			}
+		}
+		return lessByRelevance(a, b)
+	})
+}
+
+// lessByRelevance orders by descending score, then by source, ID, title and
+// URL so that equal scores never depend on arrival order.
+func lessByRelevance(a, b connectors.Result) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	if a.Source != b.Source {
+		return a.Source < b.Source
+	}
+	if a.ID != b.ID {
+		return a.ID < b.ID
+	}
+	if a.Title != b.Title {
+		return a.Title < b.Title
+	}
+	return a.URL < b.URL
+}
+
+// lexicalScore returns the fraction of query terms found in the result, in
+// [0, 1]. Title matches count twice as much as snippet matches.
+func lexicalScore(terms []string, r connectors.Result) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+	title := termSet(r.Title)
+	snippet := termSet(r.Snippet)
+	var hits float64
+	for _, t := range terms {
+		if title[t] {
+			hits += 2
+		}
+		if snippet[t] {
+			hits++
+		}
+	}
+	return hits / float64(3*len(terms))
+}
+
+// tokenize lowercases s and splits it into unique letter/digit runs.
+func tokenize(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(fields))
+	terms := fields[:0]
+	for _, f := range fields {
+		if !seen[f] {
+			seen[f] = true
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+func termSet(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, t := range tokenize(s) {
+		set[t] = true
+	}
+	return set
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func titles(results []connectors.Result) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.Title
+	}
+	return out
+}
+
+func TestRank_InterleavesByConnectorRank(t *testing.T) {
+	lists := map[string][]connectors.Result{
+		"gdrive": {{Title: "D1", Source: "gdrive"}, {Title: "D2", Source: "gdrive"}},
+		"gmail":  {{Title: "M1", Source: "gmail"}, {Title: "M2", Source: "gmail"}},
+	}
+	got := rank("unrelated", lists, SortRelevance)
+	// Equal RRF scores at each rank are tie-broken by source name.
+	assert.Equal(t, []string{"D1", "M1", "D2", "M2"}, titles(got))
+}
+
+func TestRank_LexicalMatchBoostsResult(t *testing.T) {
+	lists := map[string][]connectors.Result{
+		"gdrive": {{Title: "Unrelated", Source: "gdrive"}, {Title: "Quarterly planning notes", Source: "gdrive"}},
+	}
+	got := rank("planning notes", lists, SortRelevance)
+	assert.Equal(t, "Quarterly planning notes", got[0].Title)
+	assert.Greater(t, got[0].Score, got[1].Score)
+}
+
+func TestRank_IsDeterministic(t *testing.T) {
+	lists := map[string][]connectors.Result{
+		"a": {{Title: "X", Source: "a", ID: "2"}, {Title: "Y", Source: "a", ID: "1"}},
+		"b": {{Title: "X", Source: "b", ID: "2"}},
+		"c": {{Title: "Z", Source: "c"}},
+	}
+	first := rank("q", lists, SortRelevance)
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, first, rank("q", lists, SortRelevance))
+	}
+}
+
+func TestRank_MergesDuplicatesAcrossConnectors(t *testing.T) {
+	lists := map[string][]connectors.Result{
+		"gmail": {{Title: "Live", Source: "gmail", ID: "m1", Snippet: "live"}, {Title: "Other", Source: "gmail", ID: "m2"}},
+		"index": {{Title: "Indexed", Source: "gmail", ID: "m2"}, {Title: "Indexed", Source: "gmail", ID: "m1", Snippet: "indexed"}},
+	}
+	got := rank("unrelated", lists, SortRelevance)
+	require.Len(t, got, 2)
+	// Each item ranks first in one list and second in the other, so their
+	// summed scores tie.
+	assert.InDelta(t, got[0].Score, got[1].Score, 1e-12)
+	assert.Equal(t, []string{"Live", "Other"}, titles(got), "the copy from the first connector by name is kept")
+}
+
+func TestRank_SortByDate(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	lists := map[string][]connectors.Result{
+		"a": {{Title: "Old", Source: "a", ModifiedAt: day(1)}, {Title: "Undated", Source: "a"}},
+		"b": {{Title: "New", Source: "b", ModifiedAt: day(9)}},
+	}
+	got := rank("q", lists, SortDate)
+	assert.Equal(t, []string{"New", "Old", "Undated"}, titles(got))
+}
+
+func TestRank_SortBySource(t *testing.T) {
+	lists := map[string][]connectors.Result{
+		"zeta":  {{Title: "Z1", Source: "zeta"}},
+		"alpha": {{Title: "A1", Source: "alpha"}, {Title: "A2", Source: "alpha"}},
+	}
+	got := rank("q", lists, SortSource)
+	assert.Equal(t, []string{"A1", "A2", "Z1"}, titles(got))
+}
+
+func TestLexicalScore(t *testing.T) {
+	terms := tokenize("Budget Review")
+	assert.Equal(t, 1.0, lexicalScore(terms, connectors.Result{Title: "budget review", Snippet: "the budget review"}))
+	assert.InDelta(t, 2.0/6, lexicalScore(terms, connectors.Result{Title: "Budget"}), 1e-9)
+	assert.Zero(t, lexicalScore(nil, connectors.Result{Title: "anything"}))
+}
+
+func TestParseSort(t *testing.T) {
+	for in, want := range map[string]SortOrder{"": SortRelevance, "relevance": SortRelevance, "date": SortDate, "source": SortSource} {
+		got, err := ParseSort(in)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseSort("random")
+	assert.ErrorIs(t, err, ErrInvalidSort)
+}
@@ -3,9 +3,11 @@ package search
 import (
 	"context"
 	"fmt"
-	"sync"
+	"sort"
+	"time"
 
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
 )
 
 // Engine fans out search queries to multiple connectors concurrently.
@@ -18,58 +20,269 @@ func New(cs ...connectors.Connector) *Engine {
 	return &Engine{connectors: cs}
 }
 
-// Search queries all connectors concurrently and aggregates results.
-// If some connectors fail, results from healthy ones are still returned.
-// Returns an error only if ALL connectors fail.
+// Request describes a search across connectors.
+type Request struct {
+	// Query is in pkb query syntax (see package query). source: clauses
+	// narrow the connectors searched, in addition to Sources.
+	Query string
+	// Sources limits the search to the named connectors. Nil or empty means
+	// all connectors.
+	Sources []string
+	// Limit is the page size requested from each connector. Zero means each
+	// connector's default.
+	Limit int
+	// Cursor is the NextCursor of a previous Response. When set, only
+	// connectors that still have more results are queried.
+	Cursor string
+	// Sort orders the aggregated results. Empty means SortRelevance.
+	Sort SortOrder
+	// Explain asks each connector that implements connectors.Explainer for
+	// its native request, reported in SourceStatus.NativeQuery and Params.
+	// When set, a failure of every connector is reported in Response.Sources
+	// instead of as an error.
+	Explain bool
+	// OnStart, if set, is called with the names of the connectors about to
+	// be queried, before any of them is searched.
+	OnStart func(sources []string)
+	// OnBatch, if set, is called with each connector's results as soon as
+	// that connector finishes, in completion order. Calls are serialized and
+	// all happen before Execute returns.
+	OnBatch func(Batch)
+}
+
+// Batch is one connector's contribution to a streamed search.
+type Batch struct {
+	Source string
+	// Results holds the connector's page, ranked by the request's
+	// SortOrder among themselves only. The final Response ranks all
+	// connectors' results together after removing duplicates across
+	// sources, so its scores and order differ.
+	Results []connectors.Result
+	Status  SourceStatus
+}
+
+// Response is the aggregated result of a search.
+type Response struct {
+	Results []connectors.Result
+	// NextCursor is an opaque token for fetching the next page, or "" when
+	// every connector is exhausted.
+	NextCursor string
+	// Sources reports the outcome of each connector queried, sorted by name.
+	Sources []SourceStatus
+}
+
+// SourceStatus reports how one connector fared in a search.
+type SourceStatus struct {
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+	// Error is the connector's error message when OK is false.
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Count      int    `json:"count"`
+	// Warnings lists parts of the query the connector ignored.
+	Warnings []string `json:"warnings,omitempty"`
+	// NativeQuery and Params describe the connector's native request; they
+	// are only set when Request.Explain is.
+	NativeQuery string            `json:"native_query,omitempty"`
+	Params      map[string]string `json:"params,omitempty"`
+}
+
+// Failed returns the statuses of connectors that returned an error.
+func (r *Response) Failed() []SourceStatus {
+	var failed []SourceStatus
+	for _, s := range r.Sources {
+		if !s.OK {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
+
+// Search queries all connectors concurrently and aggregates results in
+// relevance order. If some connectors fail, results from healthy ones are
+// still returned. Returns an error only if ALL connectors fail.
 func (e *Engine) Search(ctx context.Context, query string) ([]connectors.Result, error) {
-	if len(e.connectors) == 0 {
-		return []connectors.Result{}, nil
+	resp, err := e.Execute(ctx, Request{Query: query})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// SearchWithSources queries only the named connectors. If sources is nil or
+// empty, all connectors are queried (same as Search).
+func (e *Engine) SearchWithSources(ctx context.Context, query string, sources []string) ([]connectors.Result, error) {
+	resp, err := e.Execute(ctx, Request{Query: query, Sources: sources})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// Execute runs a paged search. Each selected connector is asked for one
+// page; the pages are merged and ordered by rank, and their continuation
+// tokens are combined into Response.NextCursor. Partial failures are
+// tolerated as in Search and reported per connector in Response.Sources.
+// A malformed cursor returns an error wrapping ErrInvalidCursor, and a
+// malformed query one wrapping query.ErrSyntax. Set req.OnStart and
+// req.OnBatch to receive results incrementally.
+func (e *Engine) Execute(ctx context.Context, req Request) (*Response, error) {
+	parsed, err := query.Parse(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	cs := filterBySourceClauses(e.selectConnectors(req.Sources), parsed)
+
+	var tokens map[string]string
+	if req.Cursor != "" {
+		if tokens, err = decodeCursor(req.Cursor); err != nil {
+			return nil, err
+		}
+		// Continuing a search: connectors without a token are exhausted.
+		var pending []connectors.Connector
+		for _, c := range cs {
+			if _, ok := tokens[c.Name()]; ok {
+				pending = append(pending, c)
+			}
+		}
+		cs = pending
+	}
+
+	if req.OnStart != nil {
+		names := make([]string, len(cs))
+		for i, c := range cs {
+			names[i] = c.Name()
+		}
+		req.OnStart(names)
+	}
+
+	if len(cs) == 0 {
+		return &Response{Results: []connectors.Result{}}, nil
 	}
 
 	type result struct {
-		results []connectors.Result
+		page    connectors.Page
 		err     error
 		name    string
+		elapsed time.Duration
+		explain *connectors.Explanation
 	}
 
-	ch := make(chan result, len(e.connectors))
-	var wg sync.WaitGroup
-
-	for _, c := range e.connectors {
-		wg.Add(1)
+	ch := make(chan result, len(cs))
+	for _, c := range cs {
 		go func(c connectors.Connector) {
-			defer wg.Done()
-			res, err := c.Search(ctx, query)
-			ch <- result{results: res, err: err, name: c.Name()}
+			creq := connectors.Request{
+				Query:  req.Query,
+				Limit:  req.Limit,
+				Cursor: tokens[c.Name()],
+			}
+			var explain *connectors.Explanation
+			if ex, ok := c.(connectors.Explainer); ok && req.Explain {
+				exp, err := ex.Explain(creq)
+				if err != nil {
+					exp = connectors.Explanation{Params: map[string]string{"explain_error": err.Error()}}
+				}
+				explain = &exp
+			}
+			start := time.Now()
+			page, err := searchIsolated(ctx, c, creq)
+			ch <- result{page: page, err: err, name: c.Name(), elapsed: time.Since(start), explain: explain}
 		}(c)
 	}
 
-	wg.Wait()
-	close(ch)
-
-	var all []connectors.Result
+	lists := make(map[string][]connectors.Result, len(cs))
+	next := map[string]string{}
+	statuses := make([]SourceStatus, 0, len(cs))
 	var errs []error
 
-	for r := range ch {
+	// Collect in completion order so each batch can be streamed as soon as
+	// its connector finishes rather than after the slowest one.
+	for range cs {
+		r := <-ch
+		status := SourceStatus{Name: r.name, OK: r.err == nil, DurationMS: r.elapsed.Milliseconds()}
+		if r.explain != nil {
+			status.NativeQuery = r.explain.Query
+			status.Params = r.explain.Params
+		}
 		if r.err != nil {
+			status.Error = r.err.Error()
 			errs = append(errs, fmt.Errorf("%s: %w", r.name, r.err))
-			continue
+		} else {
+			status.Count = len(r.page.Results)
+			status.Warnings = r.page.Warnings
+			lists[r.name] = r.page.Results
+			if r.page.NextCursor != "" {
+				next[r.name] = r.page.NextCursor
+			}
+		}
+		statuses = append(statuses, status)
+		if req.OnBatch != nil {
+			batch := Batch{Source: r.name, Status: status, Results: []connectors.Result{}}
+			if r.err == nil {
+				batch.Results = rank(parsed.Text(), map[string][]connectors.Result{r.name: r.page.Results}, req.Sort)
+			}
+			req.OnBatch(batch)
 		}
-		all = append(all, r.results...)
 	}
 
-	if len(errs) == len(e.connectors) {
+	if len(errs) == len(cs) && !req.Explain {
 		return nil, fmt.Errorf("all connectors failed: %v", errs)
 	}
 
-	return all, nil
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return &Response{
+		Results:    rank(parsed.Text(), lists, req.Sort),
+		NextCursor: encodeCursor(next),
+		Sources:    statuses,
+	}, nil
 }
 
-// SearchWithSources queries only the named connectors. If sources is nil or
-// empty, all connectors are queried (same as Search).
-func (e *Engine) SearchWithSources(ctx context.Context, query string, sources []string) ([]connectors.Result, error) {
+// searchIsolated runs c.Search so that a connector that panics, or that
+// overruns the limit of a connectors.TimeLimited, fails on its own instead
+// of crashing or stalling the whole search.
+func searchIsolated(ctx context.Context, c connectors.Connector, req connectors.Request) (connectors.Page, error) {
+	type outcome struct {
+		page connectors.Page
+		err  error
+	}
+	var limit time.Duration
+	if tl, ok := c.(connectors.TimeLimited); ok {
+		limit = tl.SearchTimeout()
+	}
+	var timeout <-chan time.Time
+	if limit > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+		timer := time.NewTimer(limit)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// Buffered, so an abandoned search does not block forever on sending.
+	ch := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				ch <- outcome{err: fmt.Errorf("connector panicked: %v", r)}
+			}
+		}()
+		page, err := c.Search(ctx, req)
+		ch <- outcome{page, err}
+	}()
+	select {
+	case o := <-ch:
+		return o.page, o.err
+	case <-timeout:
+		return connectors.Page{}, fmt.Errorf("timed out after %s", limit)
+	}
+}
+
+// selectConnectors returns the connectors named in sources, or all
+// connectors when sources is empty.
+func (e *Engine) selectConnectors(sources []string) []connectors.Connector {
 	if len(sources) == 0 {
-		return e.Search(ctx, query)
+		return e.connectors
 	}
 
 	allowed := make(map[string]bool, len(sources))
@@ -83,9 +296,36 @@ func (e *Engine) SearchWithSources(ctx context.Context, query string, sources []
 			filtered = append(filtered, c)
 		}
 	}
+	return filtered
+}
+
+// filterBySourceClauses applies the query's source: clauses: connectors must
+// match one of the positive clauses, if any, and none of the negated ones.
+func filterBySourceClauses(cs []connectors.Connector, q query.Query) []connectors.Connector {
+	include := map[string]bool{}
+	exclude := map[string]bool{}
+	for _, c := range q.Clauses {
+		if c.Field != query.FieldSource {
+			continue
+		}
+		if c.Negated {
+			exclude[c.Value] = true
+		} else {
+			include[c.Value] = true
+		}
+	}
+	if len(include) == 0 && len(exclude) == 0 {
+		return cs
+	}
 
-	sub := &Engine{connectors: filtered}
-	return sub.Search(ctx, query)
+	var filtered []connectors.Connector
+	for _, c := range cs {
+		if exclude[c.Name()] || (len(include) > 0 && !include[c.Name()]) {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+	return filtered
 }
 
 // ConnectorNames returns the names of all registered connectors.
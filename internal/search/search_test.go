@@ -3,9 +3,13 @@ package search
 import (
 	"context"
 	"errors"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -16,9 +20,9 @@ type MockConnector struct {
 	mock.Mock
 }
 
-func (m *MockConnector) Search(ctx context.Context, query string) ([]connectors.Result, error) {
-	args := m.Called(ctx, query)
-	return args.Get(0).([]connectors.Result), args.Error(1)
+func (m *MockConnector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	args := m.Called(ctx, req.Query)
+	return connectors.Page{Results: args.Get(0).([]connectors.Result)}, args.Error(1)
 }
 
 func (m *MockConnector) Name() string {
@@ -179,3 +183,350 @@ func TestEngine_ConnectorNames_Empty(t *testing.T) {
 	names := engine.ConnectorNames()
 	assert.Empty(t, names)
 }
+
+// pagedConnector serves canned pages keyed by cursor and records requests.
+type pagedConnector struct {
+	name  string
+	pages map[string]connectors.Page
+	mu    sync.Mutex
+	reqs  []connectors.Request
+}
+
+func (p *pagedConnector) Name() string { return p.name }
+
+func (p *pagedConnector) Search(_ context.Context, req connectors.Request) (connectors.Page, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reqs = append(p.reqs, req)
+	return p.pages[req.Cursor], nil
+}
+
+func TestEngine_Execute_CombinesCursors(t *testing.T) {
+	drive := &pagedConnector{name: "gdrive", pages: map[string]connectors.Page{
+		"":   {Results: []connectors.Result{{Title: "D1"}}, NextCursor: "d2"},
+		"d2": {Results: []connectors.Result{{Title: "D2"}}},
+	}}
+	mail := &pagedConnector{name: "gmail", pages: map[string]connectors.Page{
+		"": {Results: []connectors.Result{{Title: "M1"}}},
+	}}
+	engine := New(drive, mail)
+
+	first, err := engine.Execute(context.Background(), Request{Query: "q", Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, first.Results, 2)
+	require.NotEmpty(t, first.NextCursor)
+	assert.Equal(t, 1, drive.reqs[0].Limit)
+
+	// Only gdrive has more results, so only gdrive is queried for page 2.
+	second, err := engine.Execute(context.Background(), Request{Query: "q", Limit: 1, Cursor: first.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, second.Results, 1)
+	assert.Equal(t, "D2", second.Results[0].Title)
+	assert.Empty(t, second.NextCursor)
+	assert.Equal(t, "d2", drive.reqs[1].Cursor)
+	assert.Len(t, mail.reqs, 1)
+}
+
+func TestEngine_Execute_InvalidCursor(t *testing.T) {
+	engine := New(&pagedConnector{name: "gdrive"})
+	_, err := engine.Execute(context.Background(), Request{Query: "q", Cursor: "!!not-a-cursor"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestCursor_RoundTrip(t *testing.T) {
+	assert.Empty(t, encodeCursor(nil))
+	tokens := map[string]string{"gdrive": "a", "gmail": "b"}
+	got, err := decodeCursor(encodeCursor(tokens))
+	require.NoError(t, err)
+	assert.Equal(t, tokens, got)
+}
+
+func TestEngine_Execute_RanksResults(t *testing.T) {
+	drive := &pagedConnector{name: "gdrive", pages: map[string]connectors.Page{
+		"": {Results: []connectors.Result{{Title: "Other", Source: "gdrive"}, {Title: "Roadmap", Source: "gdrive"}}},
+	}}
+	engine := New(drive)
+	resp, err := engine.Execute(context.Background(), Request{Query: "roadmap"})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 2)
+	assert.Equal(t, "Roadmap", resp.Results[0].Title)
+	assert.NotZero(t, resp.Results[0].Score)
+}
+
+func TestEngine_Execute_ReportsSourceStatuses(t *testing.T) {
+	mock1 := new(MockConnector)
+	mock2 := new(MockConnector)
+
+	mock1.On("Search", mock.Anything, "test").Return([]connectors.Result{
+		{Title: "A"}, {Title: "B"},
+	}, nil)
+	mock1.On("Name").Return("zeta")
+
+	mock2.On("Search", mock.Anything, "test").Return([]connectors.Result(nil), errors.New("connection refused"))
+	mock2.On("Name").Return("alpha")
+
+	resp, err := New(mock1, mock2).Execute(context.Background(), Request{Query: "test"})
+	require.NoError(t, err)
+
+	require.Len(t, resp.Sources, 2)
+	assert.Equal(t, "alpha", resp.Sources[0].Name, "statuses are sorted by name")
+	assert.False(t, resp.Sources[0].OK)
+	assert.Equal(t, "connection refused", resp.Sources[0].Error)
+	assert.Zero(t, resp.Sources[0].Count)
+
+	assert.Equal(t, "zeta", resp.Sources[1].Name)
+	assert.True(t, resp.Sources[1].OK)
+	assert.Empty(t, resp.Sources[1].Error)
+	assert.Equal(t, 2, resp.Sources[1].Count)
+
+	assert.Equal(t, resp.Sources[:1], resp.Failed())
+}
+
+func TestEngine_Execute_StatusesOnlyForQueriedSources(t *testing.T) {
+	mock1 := new(MockConnector)
+	mock1.On("Search", mock.Anything, "test").Return([]connectors.Result{}, nil)
+	mock1.On("Name").Return("mock1")
+	mock2 := new(MockConnector)
+	mock2.On("Name").Return("mock2")
+
+	resp, err := New(mock1, mock2).Execute(context.Background(), Request{Query: "test", Sources: []string{"mock1"}})
+	require.NoError(t, err)
+	require.Len(t, resp.Sources, 1)
+	assert.Equal(t, "mock1", resp.Sources[0].Name)
+	assert.Empty(t, resp.Failed())
+}
+
+// gatedConnector blocks until release is closed, to simulate a slow source.
+type gatedConnector struct {
+	name    string
+	release chan struct{}
+	results []connectors.Result
+}
+
+func (g *gatedConnector) Name() string { return g.name }
+
+func (g *gatedConnector) Search(ctx context.Context, _ connectors.Request) (connectors.Page, error) {
+	select {
+	case <-g.release:
+		return connectors.Page{Results: g.results}, nil
+	case <-ctx.Done():
+		return connectors.Page{}, ctx.Err()
+	}
+}
+
+func TestEngine_Execute_StreamsBatchesBeforeSlowConnector(t *testing.T) {
+	fast := &gatedConnector{name: "fast", release: make(chan struct{}), results: []connectors.Result{{Title: "Quick"}}}
+	slow := &gatedConnector{name: "slow", release: make(chan struct{}), results: []connectors.Result{{Title: "Late"}}}
+	close(fast.release)
+
+	var started []string
+	batches := make(chan Batch, 2)
+	req := Request{
+		Query:   "q",
+		OnStart: func(sources []string) { started = sources },
+		OnBatch: func(b Batch) {
+			batches <- b
+			if b.Source == "fast" {
+				// The slow connector is still blocked, so this batch was
+				// delivered without waiting for it.
+				close(slow.release)
+			}
+		},
+	}
+
+	resp, err := New(fast, slow).Execute(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fast", "slow"}, started)
+
+	first, second := <-batches, <-batches
+	assert.Equal(t, "fast", first.Source)
+	assert.Equal(t, "Quick", first.Results[0].Title)
+	assert.True(t, first.Status.OK)
+	assert.Positive(t, first.Results[0].Score)
+	assert.Equal(t, "slow", second.Source)
+	assert.Len(t, resp.Results, 2)
+}
+
+func TestEngine_Execute_StreamsFailedBatch(t *testing.T) {
+	ok := new(MockConnector)
+	ok.On("Search", mock.Anything, "test").Return([]connectors.Result{{Title: "A"}}, nil)
+	ok.On("Name").Return("ok")
+	bad := new(MockConnector)
+	bad.On("Search", mock.Anything, "test").Return([]connectors.Result(nil), errors.New("boom"))
+	bad.On("Name").Return("bad")
+
+	var batches []Batch
+	_, err := New(ok, bad).Execute(context.Background(), Request{
+		Query:   "test",
+		OnBatch: func(b Batch) { batches = append(batches, b) },
+	})
+	require.NoError(t, err)
+	require.Len(t, batches, 2)
+	for _, b := range batches {
+		if b.Source == "bad" {
+			assert.False(t, b.Status.OK)
+			assert.Equal(t, "boom", b.Status.Error)
+			assert.Empty(t, b.Results)
+		}
+	}
+}
+
+func TestSortResults_MatchesEngineOrder(t *testing.T) {
+	results := []connectors.Result{
+		{Title: "low", Source: "a", Score: 0.1},
+		{Title: "high", Source: "b", Score: 0.9},
+	}
+	SortResults(results, SortRelevance)
+	assert.Equal(t, "high", results[0].Title)
+}
+
+func TestEngine_Execute_SourceClausesSelectConnectors(t *testing.T) {
+	newConn := func(name string) *pagedConnector {
+		return &pagedConnector{name: name, pages: map[string]connectors.Page{"": {Results: []connectors.Result{{Title: name}}}}}
+	}
+	a, b, c := newConn("a"), newConn("b"), newConn("c")
+	engine := New(a, b, c)
+
+	resp, err := engine.Execute(context.Background(), Request{Query: "notes source:a source:b"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, sourceNames(resp))
+
+	resp, err = engine.Execute(context.Background(), Request{Query: "notes -source:b"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "c"}, sourceNames(resp))
+
+	resp, err = engine.Execute(context.Background(), Request{Query: "notes source:a", Sources: []string{"b"}})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Sources, "source: narrows the Sources filter rather than widening it")
+}
+
+func TestEngine_Execute_InvalidQuery(t *testing.T) {
+	_, err := New().Execute(context.Background(), Request{Query: `"unterminated`})
+	assert.ErrorIs(t, err, query.ErrSyntax)
+}
+
+func TestEngine_Execute_ReportsWarnings(t *testing.T) {
+	conn := &pagedConnector{name: "a", pages: map[string]connectors.Page{"": {Warnings: []string{"from:x ignored"}}}}
+	resp, err := New(conn).Execute(context.Background(), Request{Query: "from:x"})
+	require.NoError(t, err)
+	require.Len(t, resp.Sources, 1)
+	assert.Equal(t, []string{"from:x ignored"}, resp.Sources[0].Warnings)
+}
+
+func TestEngine_Execute_ScoresAgainstFreeText(t *testing.T) {
+	conn := &pagedConnector{name: "a", pages: map[string]connectors.Page{"": {Results: []connectors.Result{
+		{Title: "source notes"},
+		{Title: "budget"},
+	}}}}
+	resp, err := New(conn).Execute(context.Background(), Request{Query: "budget source:a"})
+	require.NoError(t, err)
+	assert.Equal(t, "budget", resp.Results[0].Title, "operators must not count as search terms")
+}
+
+func sourceNames(resp *Response) []string {
+	names := make([]string, len(resp.Sources))
+	for i, s := range resp.Sources {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// explainingConnector is a pagedConnector that also implements
+// connectors.Explainer.
+type explainingConnector struct {
+	pagedConnector
+	err error
+}
+
+func (e *explainingConnector) Explain(req connectors.Request) (connectors.Explanation, error) {
+	return connectors.Explanation{Query: "native(" + req.Query + ")", Params: map[string]string{"limit": strconv.Itoa(req.Limit)}}, nil
+}
+
+func (e *explainingConnector) Search(ctx context.Context, req connectors.Request) (connectors.Page, error) {
+	if e.err != nil {
+		return connectors.Page{}, e.err
+	}
+	return e.pagedConnector.Search(ctx, req)
+}
+
+func TestEngine_Execute_Explain(t *testing.T) {
+	conn := &explainingConnector{pagedConnector: pagedConnector{name: "a", pages: map[string]connectors.Page{"": {Results: []connectors.Result{{Title: "x"}}}}}}
+	plain := &pagedConnector{name: "b"}
+	engine := New(conn, plain)
+
+	resp, err := engine.Execute(context.Background(), Request{Query: "notes", Limit: 5, Explain: true})
+	require.NoError(t, err)
+	require.Len(t, resp.Sources, 2)
+	assert.Equal(t, "native(notes)", resp.Sources[0].NativeQuery)
+	assert.Equal(t, map[string]string{"limit": "5"}, resp.Sources[0].Params)
+	assert.Equal(t, 1, resp.Sources[0].Count)
+	assert.Empty(t, resp.Sources[1].NativeQuery, "connectors without Explain report no native query")
+
+	resp, err = engine.Execute(context.Background(), Request{Query: "notes"})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Sources[0].NativeQuery, "normal searches are unchanged")
+}
+
+func TestEngine_Execute_ExplainReportsTotalFailure(t *testing.T) {
+	conn := &explainingConnector{pagedConnector: pagedConnector{name: "a"}, err: errors.New("quota exceeded")}
+
+	resp, err := New(conn).Execute(context.Background(), Request{Query: "notes", Explain: true})
+	require.NoError(t, err)
+	require.Len(t, resp.Sources, 1)
+	assert.False(t, resp.Sources[0].OK)
+	assert.Equal(t, "quota exceeded", resp.Sources[0].Error)
+	assert.Equal(t, "native(notes)", resp.Sources[0].NativeQuery)
+}
+
+// stuckConnector ignores its context and never returns until released.
+type stuckConnector struct {
+	release chan struct{}
+	limit   time.Duration
+}
+
+func (s *stuckConnector) Name() string                 { return "stuck" }
+func (s *stuckConnector) SearchTimeout() time.Duration { return s.limit }
+
+func (s *stuckConnector) Search(context.Context, connectors.Request) (connectors.Page, error) {
+	<-s.release
+	return connectors.Page{}, nil
+}
+
+func TestEngine_Execute_AbandonsConnectorsOverTheirTimeLimit(t *testing.T) {
+	stuck := &stuckConnector{release: make(chan struct{}), limit: 20 * time.Millisecond}
+	defer close(stuck.release)
+	ok := new(MockConnector)
+	ok.On("Name").Return("ok")
+	ok.On("Search", mock.Anything, "q").Return([]connectors.Result{{Title: "Found"}}, nil)
+
+	resp, err := New(stuck, ok).Execute(context.Background(), Request{Query: "q"})
+
+	require.NoError(t, err)
+	assert.Len(t, resp.Results, 1)
+	require.Len(t, resp.Failed(), 1)
+	assert.Equal(t, "stuck", resp.Failed()[0].Name)
+	assert.Equal(t, "timed out after 20ms", resp.Failed()[0].Error)
+}
+
+type panickingConnector struct{}
+
+func (panickingConnector) Name() string { return "broken" }
+
+func (panickingConnector) Search(context.Context, connectors.Request) (connectors.Page, error) {
+	var m map[string]int
+	m["boom"]++
+	return connectors.Page{}, nil
+}
+
+func TestEngine_Execute_IsolatesPanics(t *testing.T) {
+	ok := new(MockConnector)
+	ok.On("Name").Return("ok")
+	ok.On("Search", mock.Anything, "q").Return([]connectors.Result{{Title: "Found"}}, nil)
+
+	resp, err := New(panickingConnector{}, ok).Execute(context.Background(), Request{Query: "q"})
+
+	require.NoError(t, err)
+	assert.Len(t, resp.Results, 1)
+	require.Len(t, resp.Failed(), 1)
+	assert.Contains(t, resp.Failed()[0].Error, "connector panicked: assignment to entry in nil map")
+}
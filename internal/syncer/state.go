@@ -0,0 +1,91 @@
+package syncer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// State records each source's crawl progress between runs.
+type State struct {
+	Sources map[string]*SourceState `json:"sources"`
+}
+
+// SourceState is one source's crawl progress.
+type SourceState struct {
+	// Cursor is where an interrupted crawl resumes; empty when the last
+	// crawl finished.
+	Cursor string `json:"cursor,omitempty"`
+	// Indexed counts the documents indexed by the current or last crawl.
+	Indexed int `json:"indexed"`
+	// LastSync is when the last crawl or incremental sync finished.
+	LastSync time.Time `json:"last_sync,omitzero"`
+	// ChangeCursor is where the next incremental sync starts, for sources
+	// that track changes. It is empty until a full crawl has finished.
+	ChangeCursor string `json:"change_cursor,omitempty"`
+	// CrawlChangeCursor is the change cursor taken when the crawl in
+	// progress started. It becomes ChangeCursor when the crawl finishes.
+	CrawlChangeCursor string `json:"crawl_change_cursor,omitempty"`
+}
+
+// LoadState reads the state file at path. A missing file yields an empty
+// state.
+func LoadState(path string) (*State, error) {
+	st := &State{Sources: map[string]*SourceState{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read sync state: %w", err)
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("read sync state %s: %w", path, err)
+	}
+	if st.Sources == nil {
+		st.Sources = map[string]*SourceState{}
+	}
+	return st, nil
+}
+
+// Save writes the state to path, replacing the file atomically.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("save sync state: %w", err)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("create sync state directory: %w", err)
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("save sync state: %w", err)
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("save sync state: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("save sync state: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("save sync state: %w", err)
+	}
+	return nil
+}
+
+// source returns the named source's state, creating it if needed.
+func (s *State) source(name string) *SourceState {
+	st, ok := s.Sources[name]
+	if !ok {
+		st = &SourceState{}
+		s.Sources[name] = st
+	}
+	return st
+}
@@ -0,0 +1,195 @@
+// Package syncer copies documents from crawlable connectors into the local
+// index. Progress is saved after every page, so an interrupted sync resumes
+// where it stopped instead of starting over. Sources that implement
+// connectors.ChangeTracker are crawled once and then only asked for what
+// changed since the previous sync.
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+)
+
+// Progress reports a sync's advance through one source.
+type Progress struct {
+	Source string
+	// Incremental is true when only changes since the last sync are being
+	// applied, rather than a full crawl.
+	Incremental bool
+	// Indexed is the number of documents indexed so far by this crawl,
+	// including pages indexed before an interrupted crawl was resumed. For an
+	// incremental sync it counts documents added or updated by this run.
+	Indexed int
+	// Deleted counts documents removed by an incremental sync.
+	Deleted int
+	// Done is true once the source's crawl has finished.
+	Done bool
+	// Err is set when the source failed; the sync continues with the next.
+	Err error
+}
+
+// Syncer crawls sources into an index.
+type Syncer struct {
+	Index *index.Index
+	// StatePath is the file crawl progress is saved to.
+	StatePath string
+	Crawlers  []connectors.Crawler
+}
+
+// Run crawls every source in turn, calling progress (if non-nil) after each
+// page and when a source fails. A failing source does not stop the others;
+// their errors are joined in the returned error. Cancelling ctx stops the
+// sync after saving the pages already indexed.
+func (s *Syncer) Run(ctx context.Context, progress func(Progress)) error {
+	if progress == nil {
+		progress = func(Progress) {}
+	}
+	state, err := LoadState(s.StatePath)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, c := range s.Crawlers {
+		if err := s.syncSource(ctx, c, state, progress); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			progress(Progress{Source: c.Name(), Indexed: state.source(c.Name()).Indexed, Err: err})
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// syncSource brings one source up to date: incrementally when it tracks
+// changes and has been fully crawled before, otherwise with a crawl.
+func (s *Syncer) syncSource(ctx context.Context, c connectors.Crawler, state *State, progress func(Progress)) error {
+	st := state.source(c.Name())
+	if t, ok := c.(connectors.ChangeTracker); ok && st.ChangeCursor != "" && st.Cursor == "" {
+		err := s.applyChanges(ctx, t, state, progress)
+		if !errors.Is(err, connectors.ErrCursorExpired) {
+			return err
+		}
+		// The source no longer has history that far back.
+		st.ChangeCursor = ""
+	}
+	return s.crawl(ctx, c, state, progress)
+}
+
+// applyChanges applies the changes made at the source since the last sync.
+func (s *Syncer) applyChanges(ctx context.Context, t connectors.ChangeTracker, state *State, progress func(Progress)) error {
+	name := t.Name()
+	st := state.source(name)
+	var updated, deleted int
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page, err := t.Changes(ctx, st.ChangeCursor)
+		if err != nil {
+			return err
+		}
+		for _, ch := range page.Changes {
+			if ch.Deleted {
+				if s.Index.Delete(name, ch.ID) {
+					deleted++
+				}
+				continue
+			}
+			d := ch.Document
+			d.Source = name
+			s.Index.Put(d)
+			updated++
+		}
+		st.ChangeCursor = page.NextCursor
+		if page.Done {
+			st.LastSync = time.Now().UTC()
+		}
+
+		if err := s.save(state); err != nil {
+			return err
+		}
+		progress(Progress{Source: name, Incremental: true, Indexed: updated, Deleted: deleted, Done: page.Done})
+		if page.Done {
+			return nil
+		}
+	}
+}
+
+// save persists the index and then the state, so the state never records
+// pages the index has lost. Re-applying a page is harmless.
+func (s *Syncer) save(state *State) error {
+	if err := s.Index.Save(); err != nil {
+		return err
+	}
+	return state.Save(s.StatePath)
+}
+
+// crawl copies one source into the index, page by page, from where its
+// last crawl stopped.
+func (s *Syncer) crawl(ctx context.Context, c connectors.Crawler, state *State, progress func(Progress)) error {
+	name := c.Name()
+	st := state.source(name)
+	resumed := st.Cursor != ""
+	if !resumed {
+		st.Indexed = 0
+		// Take the change cursor first, so changes made while the crawl
+		// runs are picked up by the next incremental sync.
+		if t, ok := c.(connectors.ChangeTracker); ok {
+			cursor, err := t.StartCursor(ctx)
+			if err != nil {
+				return err
+			}
+			st.CrawlChangeCursor = cursor
+		}
+	}
+	seen := map[string]bool{}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page, err := c.Crawl(ctx, st.Cursor)
+		if err != nil {
+			return err
+		}
+		for _, d := range page.Documents {
+			d.Source = name
+			seen[d.ID] = true
+			s.Index.Put(d)
+		}
+		st.Indexed += len(page.Documents)
+		st.Cursor = page.NextCursor
+
+		done := page.NextCursor == ""
+		if done {
+			// Documents missing from a complete crawl were deleted at the
+			// source. A resumed crawl did not see the earlier pages, so it
+			// cannot tell.
+			if !resumed {
+				for _, id := range s.Index.IDs(name) {
+					if !seen[id] {
+						s.Index.Delete(name, id)
+					}
+				}
+			}
+			st.LastSync = time.Now().UTC()
+			st.ChangeCursor, st.CrawlChangeCursor = st.CrawlChangeCursor, ""
+		}
+
+		if err := s.save(state); err != nil {
+			return err
+		}
+		progress(Progress{Source: name, Indexed: st.Indexed, Done: done})
+		if done {
+			return nil
+		}
+	}
+}
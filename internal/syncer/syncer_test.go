@@ -0,0 +1,255 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/index"
+	"github.com/cwoolley/personal-knowledge-base/internal/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCrawler serves pages keyed by cursor and records the cursors asked
+// for. A page missing from pages fails with err.
+type fakeCrawler struct {
+	name    string
+	pages   map[string]connectors.CrawlPage
+	err     error
+	cursors []string
+}
+
+func (f *fakeCrawler) Name() string { return f.name }
+
+func (f *fakeCrawler) Search(context.Context, connectors.Request) (connectors.Page, error) {
+	return connectors.Page{}, nil
+}
+
+func (f *fakeCrawler) Crawl(_ context.Context, cursor string) (connectors.CrawlPage, error) {
+	f.cursors = append(f.cursors, cursor)
+	page, ok := f.pages[cursor]
+	if !ok {
+		return connectors.CrawlPage{}, f.err
+	}
+	return page, nil
+}
+
+func docs(ids ...string) []connectors.Document {
+	ds := make([]connectors.Document, len(ids))
+	for i, id := range ids {
+		ds[i] = connectors.Document{Result: connectors.Result{ID: id, Title: "budget " + id}}
+	}
+	return ds
+}
+
+func newSyncer(t *testing.T, crawlers ...connectors.Crawler) *Syncer {
+	t.Helper()
+	dir := t.TempDir()
+	ix, err := index.Open(filepath.Join(dir, "index.gob"))
+	require.NoError(t, err)
+	return &Syncer{Index: ix, StatePath: filepath.Join(dir, "sync.json"), Crawlers: crawlers}
+}
+
+func search(t *testing.T, ix *index.Index, s string) int {
+	t.Helper()
+	q, err := query.Parse(s)
+	require.NoError(t, err)
+	return len(ix.Search(q))
+}
+
+func TestRun_IndexesEveryPageAndReportsProgress(t *testing.T) {
+	c := &fakeCrawler{name: "mail", pages: map[string]connectors.CrawlPage{
+		"":   {Documents: docs("1", "2"), NextCursor: "p2"},
+		"p2": {Documents: docs("3")},
+	}}
+	s := newSyncer(t, c)
+
+	var progress []Progress
+	require.NoError(t, s.Run(context.Background(), func(p Progress) { progress = append(progress, p) }))
+
+	assert.Equal(t, []Progress{{Source: "mail", Indexed: 2}, {Source: "mail", Indexed: 3, Done: true}}, progress)
+	assert.Equal(t, 3, search(t, s.Index, "budget"))
+	assert.Equal(t, []string{"1", "2", "3"}, s.Index.IDs("mail"), "documents are stored under the crawler's name")
+
+	state, err := LoadState(s.StatePath)
+	require.NoError(t, err)
+	assert.Empty(t, state.Sources["mail"].Cursor)
+	assert.Equal(t, 3, state.Sources["mail"].Indexed)
+	assert.False(t, state.Sources["mail"].LastSync.IsZero())
+
+	reopened, err := index.Open(s.Index.Path())
+	require.NoError(t, err)
+	assert.Equal(t, 3, reopened.Len(), "the index is saved")
+}
+
+func TestRun_ResumesInterruptedCrawl(t *testing.T) {
+	c := &fakeCrawler{name: "mail", err: errors.New("connection reset"), pages: map[string]connectors.CrawlPage{
+		"": {Documents: docs("1"), NextCursor: "p2"},
+	}}
+	s := newSyncer(t, c)
+
+	err := s.Run(context.Background(), nil)
+	require.ErrorContains(t, err, "mail: connection reset")
+
+	c.pages["p2"] = connectors.CrawlPage{Documents: docs("2")}
+	c.cursors = nil
+	require.NoError(t, s.Run(context.Background(), nil))
+
+	assert.Equal(t, []string{"p2"}, c.cursors, "the crawl resumes from the saved cursor")
+	assert.Equal(t, []string{"1", "2"}, s.Index.IDs("mail"))
+	state, err := LoadState(s.StatePath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, state.Sources["mail"].Indexed)
+}
+
+func TestRun_CompleteCrawlRemovesDeletedDocuments(t *testing.T) {
+	c := &fakeCrawler{name: "mail", pages: map[string]connectors.CrawlPage{"": {Documents: docs("1", "2")}}}
+	s := newSyncer(t, c)
+	require.NoError(t, s.Run(context.Background(), nil))
+
+	c.pages[""] = connectors.CrawlPage{Documents: docs("2")}
+	require.NoError(t, s.Run(context.Background(), nil))
+	assert.Equal(t, []string{"2"}, s.Index.IDs("mail"))
+}
+
+func TestRun_FailingSourceDoesNotStopOthers(t *testing.T) {
+	broken := &fakeCrawler{name: "broken", err: errors.New("unauthorized")}
+	ok := &fakeCrawler{name: "ok", pages: map[string]connectors.CrawlPage{"": {Documents: docs("1")}}}
+	s := newSyncer(t, broken, ok)
+
+	var failed []Progress
+	err := s.Run(context.Background(), func(p Progress) {
+		if p.Err != nil {
+			failed = append(failed, p)
+		}
+	})
+
+	require.ErrorContains(t, err, "broken: unauthorized")
+	require.Len(t, failed, 1)
+	assert.Equal(t, "broken", failed[0].Source)
+	assert.Equal(t, []string{"1"}, s.Index.IDs("ok"))
+}
+
+func TestRun_Cancelled(t *testing.T) {
+	c := &fakeCrawler{name: "mail", pages: map[string]connectors.CrawlPage{"": {Documents: docs("1")}}}
+	s := newSyncer(t, c)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, s.Run(ctx, nil), context.Canceled)
+	assert.Empty(t, c.cursors)
+}
+
+func TestLoadState_RoundTripAndCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sync.json")
+	require.NoError(t, (&State{Sources: map[string]*SourceState{"mail": {Cursor: "c"}}}).Save(path))
+	st, err := LoadState(path)
+	require.NoError(t, err)
+	assert.Equal(t, "c", st.Sources["mail"].Cursor)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+	_, err = LoadState(path)
+	assert.ErrorContains(t, err, "read sync state")
+}
+
+// fakeTracker adds change tracking to fakeCrawler. A change cursor missing
+// from changes fails with changesErr.
+type fakeTracker struct {
+	fakeCrawler
+	start         string
+	changes       map[string]connectors.ChangePage
+	changesErr    error
+	changeCursors []string
+}
+
+func (f *fakeTracker) StartCursor(context.Context) (string, error) { return f.start, nil }
+
+func (f *fakeTracker) Changes(_ context.Context, cursor string) (connectors.ChangePage, error) {
+	f.changeCursors = append(f.changeCursors, cursor)
+	page, ok := f.changes[cursor]
+	if !ok {
+		return connectors.ChangePage{}, f.changesErr
+	}
+	return page, nil
+}
+
+func TestRun_AppliesChangesAfterFirstCrawl(t *testing.T) {
+	c := &fakeTracker{
+		fakeCrawler: fakeCrawler{name: "drive", pages: map[string]connectors.CrawlPage{"": {Documents: docs("1", "2")}}},
+		start:       "c1",
+		changes: map[string]connectors.ChangePage{
+			"c1": {Changes: []connectors.Change{
+				{ID: "3", Document: docs("3")[0]},
+				{ID: "1", Deleted: true},
+			}, NextCursor: "c1-p2"},
+			"c1-p2": {Changes: []connectors.Change{{ID: "404", Deleted: true}}, NextCursor: "c2", Done: true},
+		},
+	}
+	s := newSyncer(t, c)
+	require.NoError(t, s.Run(context.Background(), nil))
+
+	state, err := LoadState(s.StatePath)
+	require.NoError(t, err)
+	assert.Equal(t, "c1", state.Sources["drive"].ChangeCursor, "the cursor taken before the crawl is kept")
+	assert.Empty(t, c.changeCursors)
+
+	c.cursors = nil
+	var progress []Progress
+	require.NoError(t, s.Run(context.Background(), func(p Progress) { progress = append(progress, p) }))
+
+	assert.Empty(t, c.cursors, "no re-crawl")
+	assert.Equal(t, []string{"c1", "c1-p2"}, c.changeCursors)
+	assert.Equal(t, []string{"2", "3"}, s.Index.IDs("drive"))
+	assert.Equal(t, []Progress{
+		{Source: "drive", Incremental: true, Indexed: 1, Deleted: 1},
+		{Source: "drive", Incremental: true, Indexed: 1, Deleted: 1, Done: true},
+	}, progress, "deleting a document that was never indexed is not counted")
+
+	state, err = LoadState(s.StatePath)
+	require.NoError(t, err)
+	assert.Equal(t, "c2", state.Sources["drive"].ChangeCursor)
+}
+
+func TestRun_ResumesInterruptedChangeWalk(t *testing.T) {
+	c := &fakeTracker{
+		fakeCrawler: fakeCrawler{name: "drive", pages: map[string]connectors.CrawlPage{"": {}}},
+		start:       "c1",
+		changesErr:  errors.New("timeout"),
+		changes: map[string]connectors.ChangePage{
+			"c1": {Changes: []connectors.Change{{ID: "1", Document: docs("1")[0]}}, NextCursor: "c1-p2"},
+		},
+	}
+	s := newSyncer(t, c)
+	require.NoError(t, s.Run(context.Background(), nil))
+	require.ErrorContains(t, s.Run(context.Background(), nil), "timeout")
+
+	c.changes["c1-p2"] = connectors.ChangePage{NextCursor: "c2", Done: true}
+	c.changeCursors = nil
+	require.NoError(t, s.Run(context.Background(), nil))
+	assert.Equal(t, []string{"c1-p2"}, c.changeCursors)
+	assert.Equal(t, []string{"1"}, s.Index.IDs("drive"))
+}
+
+func TestRun_ExpiredChangeCursorFallsBackToCrawl(t *testing.T) {
+	c := &fakeTracker{
+		fakeCrawler: fakeCrawler{name: "mail", pages: map[string]connectors.CrawlPage{"": {Documents: docs("1")}}},
+		start:       "old",
+		changesErr:  connectors.ErrCursorExpired,
+	}
+	s := newSyncer(t, c)
+	require.NoError(t, s.Run(context.Background(), nil))
+
+	c.start = "new"
+	c.cursors = nil
+	require.NoError(t, s.Run(context.Background(), nil))
+
+	assert.Equal(t, []string{"old"}, c.changeCursors)
+	assert.Equal(t, []string{""}, c.cursors, "a full crawl runs instead")
+	state, err := LoadState(s.StatePath)
+	require.NoError(t, err)
+	assert.Equal(t, "new", state.Sources["mail"].ChangeCursor)
+}
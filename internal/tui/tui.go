@@ -3,30 +3,47 @@ package tui
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
-	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/search"
 )
 
 // SearchFunc is the function signature for performing a search.
-// sources filters which connectors to query; nil means all.
-type SearchFunc func(ctx context.Context, query string, sources []string) ([]connectors.Result, error)
+// req.Sources filters which connectors to query; nil means all.
+type SearchFunc func(ctx context.Context, req search.Request) (*search.Response, error)
 
 type state int
 
 const (
-	stateInput   state = iota
+	stateInput state = iota
 	stateLoading
 	stateResults
 )
 
-// searchResultMsg is sent when search results arrive.
+// searchStartMsg is sent when a search reports which sources it queries.
+type searchStartMsg struct {
+	sources []string
+	updates chan tea.Msg
+}
+
+// searchBatchMsg is sent each time one source finishes.
+type searchBatchMsg struct {
+	batch   search.Batch
+	updates chan tea.Msg
+}
+
+// searchResultMsg is sent when the search completes.
 type searchResultMsg struct {
 	results []connectors.Result
+	sources []search.SourceStatus
 	err     error
+	updates chan tea.Msg
 }
 
 // Model is the Bubble Tea model for the TUI.
@@ -34,6 +51,9 @@ type Model struct {
 	searchInput textinput.Model
 	searchFn    SearchFunc
 	results     []connectors.Result
+	sources     []search.SourceStatus
+	pending     []string
+	updates     chan tea.Msg
 	cursor      int
 	state       state
 	err         error
@@ -62,7 +82,21 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		return m.handleKey(msg)
+	case searchStartMsg:
+		if msg.updates != m.updates {
+			return m, nil // from a cancelled search
+		}
+		m.pending = msg.sources
+		return m, waitForUpdate(msg.updates)
+	case searchBatchMsg:
+		if msg.updates != m.updates {
+			return m, nil
+		}
+		return m.handleBatch(msg.batch), waitForUpdate(msg.updates)
 	case searchResultMsg:
+		if msg.updates != m.updates {
+			return m, nil
+		}
 		return m.handleSearchResult(msg)
 	}
 
@@ -87,6 +121,8 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.cancel()
 				m.cancel = nil
 			}
+			// Messages the cancelled search still sends are stale.
+			m.updates = nil
 			m.state = stateInput
 			m.searchInput.Focus()
 			return m, nil
@@ -102,7 +138,9 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			ctx, cancel := context.WithCancel(context.Background())
 			m.cancel = cancel
 			m.state = stateLoading
-			return m, m.doSearch(ctx, query)
+			m.results, m.sources, m.pending = nil, nil, nil
+			m.updates = make(chan tea.Msg)
+			return m, m.doSearch(ctx, query, m.updates)
 		}
 
 	case tea.KeyUp:
@@ -126,8 +164,29 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// handleBatch merges one source's results into those shown while the
+// search is still running.
+func (m Model) handleBatch(b search.Batch) Model {
+	pending := make([]string, 0, len(m.pending))
+	for _, name := range m.pending {
+		if name != b.Source {
+			pending = append(pending, name)
+		}
+	}
+	m.pending = pending
+
+	m.sources = append(m.sources, b.Status)
+	sort.Slice(m.sources, func(i, j int) bool { return m.sources[i].Name < m.sources[j].Name })
+
+	m.results = append(m.results, b.Results...)
+	search.SortResults(m.results, search.SortRelevance)
+	return m
+}
+
 func (m Model) handleSearchResult(msg searchResultMsg) (tea.Model, tea.Cmd) {
 	m.cancel = nil
+	m.updates = nil
+	m.pending = nil
 	if msg.err != nil {
 		m.err = msg.err
 		m.state = stateInput
@@ -137,27 +196,128 @@ func (m Model) handleSearchResult(msg searchResultMsg) (tea.Model, tea.Cmd) {
 
 	m.err = nil
 	m.results = msg.results
+	m.sources = msg.sources
 	m.cursor = 0
 	m.state = stateResults
 	return m, nil
 }
 
-func (m Model) doSearch(ctx context.Context, query string) tea.Cmd {
+// doSearch runs the search in the background and returns a command that
+// yields its first message. Start and batch messages are followed by
+// waitForUpdate, so results render as each source finishes; the final
+// searchResultMsg ends the sequence.
+func (m Model) doSearch(ctx context.Context, query string, updates chan tea.Msg) tea.Cmd {
 	searchFn := m.searchFn
+	send := func(msg tea.Msg) {
+		select {
+		case updates <- msg:
+		case <-ctx.Done():
+		}
+	}
+	run := func() {
+		defer close(updates)
+		resp, err := searchFn(ctx, search.Request{
+			Query:   query,
+			OnStart: func(sources []string) { send(searchStartMsg{sources: sources, updates: updates}) },
+			OnBatch: func(b search.Batch) { send(searchBatchMsg{batch: b, updates: updates}) },
+		})
+		if err != nil {
+			send(searchResultMsg{err: err, updates: updates})
+			return
+		}
+		send(searchResultMsg{results: resp.Results, sources: resp.Sources, updates: updates})
+	}
+	return func() tea.Msg {
+		go run()
+		return <-updates
+	}
+}
+
+// waitForUpdate returns a command that yields the next message of a
+// running search, or nil once the search has been cancelled.
+func waitForUpdate(updates chan tea.Msg) tea.Cmd {
 	return func() tea.Msg {
-		results, err := searchFn(ctx, query, nil)
-		return searchResultMsg{results: results, err: err}
+		return <-updates
 	}
 }
 
 var (
-	titleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
-	urlStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
-	sourceStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("5"))
-	selectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("11"))
-	headerStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("14"))
+	titleStyle     = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	urlStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	sourceStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("5"))
+	metaStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("7"))
+	okBadgeStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	failBadgeStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	pendingStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+	selectedStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("11"))
+	headerStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("14"))
 )
 
+// sourceBadges renders one badge per queried source, e.g. "✓ gmail (3)"
+// or "✗ google-drive", followed by each source's error or query warnings.
+func (m Model) sourceBadges() string {
+	if len(m.sources) == 0 {
+		return ""
+	}
+	badges := make([]string, len(m.sources))
+	var errs []string
+	for i, s := range m.sources {
+		if s.OK {
+			badges[i] = okBadgeStyle.Render(fmt.Sprintf("✓ %s (%d)", s.Name, s.Count))
+			for _, w := range s.Warnings {
+				errs = append(errs, fmt.Sprintf("\n  %s: %s", s.Name, w))
+			}
+			continue
+		}
+		badges[i] = failBadgeStyle.Render("✗ " + s.Name)
+		errs = append(errs, fmt.Sprintf("\n  %s: %s", s.Name, s.Error))
+	}
+	return strings.Join(badges, "  ") + failBadgeStyle.Render(strings.Join(errs, ""))
+}
+
+// pendingBadges renders a "still searching" badge per unfinished source.
+func (m Model) pendingBadges() string {
+	badges := make([]string, len(m.pending))
+	for i, name := range m.pending {
+		badges[i] = pendingStyle.Render("… " + name + " still searching")
+	}
+	return strings.Join(badges, "  ")
+}
+
+// byline formats the author and modification date of a result.
+func byline(r connectors.Result) string {
+	var parts []string
+	if r.Author != "" {
+		parts = append(parts, r.Author)
+	}
+	if !r.ModifiedAt.IsZero() {
+		parts = append(parts, r.ModifiedAt.Format(time.DateOnly))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// writeResults renders the numbered result list.
+func (m Model) writeResults(b *strings.Builder) {
+	if len(m.results) == 0 {
+		return
+	}
+	b.WriteString(fmt.Sprintf("  %d results:\n\n", len(m.results)))
+	for i, r := range m.results {
+		cursor := "  "
+		title := titleStyle.Render(r.Title)
+		if i == m.cursor {
+			cursor = "> "
+			title = selectedStyle.Render(r.Title)
+		}
+		b.WriteString(fmt.Sprintf("  %s%s\n", cursor, title))
+		if by := byline(r); by != "" {
+			b.WriteString(fmt.Sprintf("     %s\n", metaStyle.Render(by)))
+		}
+		b.WriteString(fmt.Sprintf("     %s\n", urlStyle.Render(r.URL)))
+		b.WriteString(fmt.Sprintf("     %s\n\n", sourceStyle.Render("["+r.Source+"]")))
+	}
+}
+
 func (m Model) View() string {
 	var b strings.Builder
 
@@ -168,24 +328,27 @@ func (m Model) View() string {
 
 	switch m.state {
 	case stateLoading:
-		b.WriteString("  Searching...\n")
+		if len(m.pending) == 0 && len(m.sources) == 0 {
+			b.WriteString("  Searching...\n")
+			break
+		}
+		if badges := m.sourceBadges(); badges != "" {
+			b.WriteString("  " + badges + "\n")
+		}
+		if pending := m.pendingBadges(); pending != "" {
+			b.WriteString("  " + pending + "\n")
+		}
+		b.WriteString("\n")
+		m.writeResults(&b)
 
 	case stateResults:
+		if badges := m.sourceBadges(); badges != "" {
+			b.WriteString("  " + badges + "\n\n")
+		}
 		if len(m.results) == 0 {
 			b.WriteString("  No results found.\n")
 		} else {
-			b.WriteString(fmt.Sprintf("  %d results:\n\n", len(m.results)))
-			for i, r := range m.results {
-				cursor := "  "
-				title := titleStyle.Render(r.Title)
-				if i == m.cursor {
-					cursor = "> "
-					title = selectedStyle.Render(r.Title)
-				}
-				b.WriteString(fmt.Sprintf("  %s%s\n", cursor, title))
-				b.WriteString(fmt.Sprintf("     %s\n", urlStyle.Render(r.URL)))
-				b.WriteString(fmt.Sprintf("     %s\n\n", sourceStyle.Render("["+r.Source+"]")))
-			}
+			m.writeResults(&b)
 		}
 	}
 
@@ -4,17 +4,22 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
-	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/cwoolley/personal-knowledge-base/internal/search"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func mockSearchFn(results []connectors.Result, err error) SearchFunc {
-	return func(_ context.Context, _ string, _ []string) ([]connectors.Result, error) {
-		return results, err
+	return func(_ context.Context, _ search.Request) (*search.Response, error) {
+		if err != nil {
+			return nil, err
+		}
+		return &search.Response{Results: results}, nil
 	}
 }
 
@@ -43,7 +48,7 @@ func TestModel_Search_DisplaysResults(t *testing.T) {
 	assert.Equal(t, stateLoading, model.state)
 
 	// Simulate receiving search results
-	updated, _ = model.Update(searchResultMsg{results: results})
+	updated, _ = model.Update(searchResultMsg{results: results, updates: model.updates})
 	model = updated.(Model)
 
 	assert.Equal(t, stateResults, model.state)
@@ -119,9 +124,9 @@ func TestModel_View_ResultsStatusBar_NoEnterOpen(t *testing.T) {
 
 func TestModel_DoSearch_SetsCancelFunc(t *testing.T) {
 	searchCalled := make(chan context.Context, 1)
-	m := NewModel(func(ctx context.Context, query string, sources []string) ([]connectors.Result, error) {
+	m := NewModel(func(ctx context.Context, _ search.Request) (*search.Response, error) {
 		searchCalled <- ctx
-		return nil, nil
+		return &search.Response{}, nil
 	})
 
 	m.searchInput.SetValue("test")
@@ -143,7 +148,7 @@ func TestModel_DoSearch_SetsCancelFunc(t *testing.T) {
 
 func TestModel_EscapeDuringLoading_CancelsContext(t *testing.T) {
 	searchCalled := make(chan context.Context, 1)
-	m := NewModel(func(ctx context.Context, query string, sources []string) ([]connectors.Result, error) {
+	m := NewModel(func(ctx context.Context, _ search.Request) (*search.Response, error) {
 		searchCalled <- ctx
 		<-ctx.Done()
 		return nil, ctx.Err()
@@ -339,3 +344,136 @@ func TestModel_SearchResult_ClearsCancelOnError(t *testing.T) {
 	assert.Nil(t, model.cancel, "cancel must be nil after search completes with error")
 	assert.Error(t, model.err)
 }
+
+func TestModel_View_ShowsByline(t *testing.T) {
+	m := NewModel(mockSearchFn(nil, nil))
+	m.state = stateResults
+	m.results = []connectors.Result{
+		{Title: "Doc", URL: "https://example.com", Source: "test", Author: "Alice", ModifiedAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	assert.Contains(t, m.View(), "Alice · 2024-03-01")
+}
+
+func TestModel_View_ShowsSourceBadges(t *testing.T) {
+	m := NewModel(mockSearchFn(nil, nil))
+	m.state = stateLoading
+
+	updated, _ := m.Update(searchResultMsg{
+		results: []connectors.Result{{Title: "Doc", URL: "u", Source: "gmail"}},
+		sources: []search.SourceStatus{
+			{Name: "gmail", OK: true, Count: 1},
+			{Name: "google-drive", Error: "quota exceeded"},
+		},
+	})
+	view := updated.(Model).View()
+
+	assert.Contains(t, view, "✓ gmail (1)")
+	assert.Contains(t, view, "✗ google-drive")
+	assert.Contains(t, view, "google-drive: quota exceeded")
+}
+
+func TestModel_DoSearch_PassesSourceStatuses(t *testing.T) {
+	statuses := []search.SourceStatus{{Name: "gmail", OK: true}}
+	m := NewModel(func(_ context.Context, req search.Request) (*search.Response, error) {
+		assert.Equal(t, "test", req.Query)
+		return &search.Response{Sources: statuses}, nil
+	})
+
+	msg := m.doSearch(context.Background(), "test", make(chan tea.Msg))()
+	assert.Equal(t, statuses, msg.(searchResultMsg).sources)
+}
+
+func TestModel_Streaming_RendersBatchesIncrementally(t *testing.T) {
+	release := make(chan struct{})
+	m := NewModel(func(ctx context.Context, req search.Request) (*search.Response, error) {
+		req.OnStart([]string{"gmail", "google-drive"})
+		req.OnBatch(search.Batch{
+			Source:  "gmail",
+			Results: []connectors.Result{{Title: "Fast Mail", URL: "u1", Source: "gmail", Score: 0.5}},
+			Status:  search.SourceStatus{Name: "gmail", OK: true, Count: 1},
+		})
+		<-release
+		return &search.Response{}, nil
+	})
+
+	m.searchInput.SetValue("test")
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model := updated.(Model)
+
+	updated, cmd = model.Update(cmd())
+	model = updated.(Model)
+	assert.Equal(t, []string{"gmail", "google-drive"}, model.pending)
+
+	updated, cmd = model.Update(cmd())
+	model = updated.(Model)
+	assert.Equal(t, stateLoading, model.state)
+	assert.Equal(t, []string{"google-drive"}, model.pending)
+
+	view := model.View()
+	assert.Contains(t, view, "Fast Mail", "results from finished sources render before the search completes")
+	assert.Contains(t, view, "✓ gmail (1)")
+	assert.Contains(t, view, "google-drive still searching")
+
+	close(release)
+	updated, _ = model.Update(cmd())
+	model = updated.(Model)
+	assert.Equal(t, stateResults, model.state)
+	assert.Empty(t, model.pending)
+	assert.NotContains(t, model.View(), "still searching")
+}
+
+func TestModel_Streaming_IgnoresStaleBatches(t *testing.T) {
+	m := NewModel(mockSearchFn(nil, nil))
+	m.state = stateLoading
+	m.updates = make(chan tea.Msg)
+
+	stale := make(chan tea.Msg)
+	updated, cmd := m.Update(searchBatchMsg{
+		batch:   search.Batch{Source: "gmail", Results: []connectors.Result{{Title: "Old"}}},
+		updates: stale,
+	})
+	assert.Nil(t, cmd)
+	assert.Empty(t, updated.(Model).results)
+}
+
+func TestModel_Streaming_IgnoresCancelledResult(t *testing.T) {
+	m := NewModel(mockSearchFn(nil, nil))
+	m.searchInput.SetValue("first")
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	cancelled := updated.(Model).updates
+	updated, _ = updated.(Model).Update(tea.KeyMsg{Type: tea.KeyEscape})
+	updated, _ = updated.(Model).Update(tea.KeyMsg{Type: tea.KeyEnter})
+	current := updated.(Model).updates
+	require.NotNil(t, current)
+
+	// The cancelled search's final message arrives after the new search
+	// started: it neither shows an error nor stops the new search.
+	updated, cmd := updated.(Model).Update(searchResultMsg{err: context.Canceled, updates: cancelled})
+	assert.Nil(t, cmd)
+	model := updated.(Model)
+	assert.NoError(t, model.err)
+	assert.Equal(t, stateLoading, model.state)
+	assert.Equal(t, current, model.updates)
+}
+
+func TestModel_HandleBatch_MergesByScore(t *testing.T) {
+	m := NewModel(mockSearchFn(nil, nil))
+	m.pending = []string{"a", "b"}
+	m = m.handleBatch(search.Batch{Source: "b", Results: []connectors.Result{{Title: "Low", Score: 0.1}}, Status: search.SourceStatus{Name: "b", OK: true}})
+	m = m.handleBatch(search.Batch{Source: "a", Results: []connectors.Result{{Title: "High", Score: 0.9}}, Status: search.SourceStatus{Name: "a", OK: true}})
+
+	require.Len(t, m.results, 2)
+	assert.Equal(t, "High", m.results[0].Title)
+	assert.Equal(t, "a", m.sources[0].Name)
+	assert.Empty(t, m.pending)
+}
+
+func TestModel_View_ShowsQueryWarnings(t *testing.T) {
+	m := NewModel(mockSearchFn(nil, nil))
+	m.state = stateLoading
+
+	updated, _ := m.Update(searchResultMsg{
+		sources: []search.SourceStatus{{Name: "google-drive", OK: true, Warnings: []string{"from:bob was ignored"}}},
+	})
+	assert.Contains(t, updated.(Model).View(), "google-drive: from:bob was ignored")
+}
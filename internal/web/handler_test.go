@@ -94,3 +94,37 @@ func TestHandler_HasJavaScript(t *testing.T) {
 	assert.Contains(t, html, "<script", "should have embedded JavaScript")
 	assert.Contains(t, html, "/search?q=", "JS should call the search API")
 }
+
+func TestHandler_HasSortSelector(t *testing.T) {
+	h := Handler()
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	html := string(body)
+
+	assert.Contains(t, html, `id="sort"`)
+	assert.Contains(t, html, `value="date"`)
+	assert.Contains(t, html, "&sort=", "JS should pass the sort order")
+}
+
+func TestHandler_RendersSourceStatus(t *testing.T) {
+	h := Handler()
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	html := string(body)
+
+	assert.Contains(t, html, `id="source-status"`)
+	assert.Contains(t, html, "data.results", "JS should read results from the envelope")
+	assert.Contains(t, html, "data.sources", "JS should render per-source status")
+}
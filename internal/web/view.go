@@ -0,0 +1,48 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+)
+
+//go:embed templates/view.html
+var templatesFS embed.FS
+
+var viewTemplate = template.Must(template.ParseFS(templatesFS, "templates/view.html"))
+
+// ViewFunc returns the item with the given ID from the named source.
+type ViewFunc func(ctx context.Context, source, id string) (connectors.View, error)
+
+// ViewHandler returns an http.Handler that renders an item as a page, for
+// requests to a pattern with {source} and {id} wildcards. Unknown sources
+// and items get a 404.
+func ViewHandler(view ViewFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source := r.PathValue("source")
+		v, err := view(r.Context(), source, r.PathValue("id"))
+		if errors.Is(err, connectors.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var buf bytes.Buffer
+		if err := viewTemplate.Execute(&buf, struct {
+			Source string
+			connectors.View
+		}{source, v}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = buf.WriteTo(w)
+	})
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cwoolley/personal-knowledge-base/internal/connectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newViewServer(t *testing.T, view ViewFunc) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle("GET /view/{source}/{id}", ViewHandler(view))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestViewHandler_RendersView(t *testing.T) {
+	var gotSource, gotID string
+	srv := newViewServer(t, func(_ context.Context, source, id string) (connectors.View, error) {
+		gotSource, gotID = source, id
+		return connectors.View{
+			Title:    "Q2 <budget>",
+			Fields:   []connectors.ViewField{{Name: "From", Value: "Alice <alice@example.com>"}},
+			Sections: []connectors.ViewSection{{Heading: "Alice", Text: "Line one\nLine two"}, {Text: "Reply", Anchor: "m1"}},
+		}, nil
+	})
+
+	status, html := get(t, srv.URL+"/view/old-mail/"+"%2Fmail%2FArchive.mbox%230")
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "old-mail", gotSource)
+	assert.Equal(t, "/mail/Archive.mbox#0", gotID)
+	assert.Contains(t, html, "<h1>Q2 &lt;budget&gt;</h1>", "values are escaped")
+	assert.Contains(t, html, "<dt>From</dt><dd>Alice &lt;alice@example.com&gt;</dd>")
+	assert.Contains(t, html, "<h2>Alice</h2>")
+	assert.Contains(t, html, "Line one\nLine two")
+	assert.Contains(t, html, `<section id="m1">`, "anchored sections can be linked to")
+}
+
+func TestViewHandler_NotFound(t *testing.T) {
+	srv := newViewServer(t, func(context.Context, string, string) (connectors.View, error) {
+		return connectors.View{}, fmt.Errorf("message x: %w", connectors.ErrNotFound)
+	})
+
+	status, body := get(t, srv.URL+"/view/mail/x")
+
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Contains(t, body, "message x: not found")
+}
+
+func TestViewHandler_Error(t *testing.T) {
+	srv := newViewServer(t, func(context.Context, string, string) (connectors.View, error) {
+		return connectors.View{}, errors.New("read message x: permission denied")
+	})
+
+	status, _ := get(t, srv.URL+"/view/mail/x")
+
+	assert.Equal(t, http.StatusInternalServerError, status)
+}